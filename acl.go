@@ -0,0 +1,448 @@
+package backends
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ACLEveryone is the ACL principal that matches every caller.
+const ACLEveryone = "*"
+
+// ACL is the access control block of a record. The entries are principals: user ids, "role:<role>",
+// "org:<organization>" or ACLEveryone. The owners can read, write and change the ACL, the writers can read and write,
+// and the readers can only read the record.
+type ACL struct {
+	Owners  []string `json:"owners,omitempty"`
+	Writers []string `json:"writers,omitempty"`
+	Readers []string `json:"readers,omitempty"`
+}
+
+// ACLIdentity is the caller whose access is checked.
+type ACLIdentity struct {
+	UserID        string
+	Roles         []string
+	Organizations []string
+}
+
+// ACLOptions configures the ACL checks.
+type ACLOptions struct {
+	// Property is the record property that holds the ACL. Default is "acl".
+	Property string
+	// KeyProperty is the record key, used to update and delete the checked records. Default is "id".
+	KeyProperty string
+	// AdminRoles are the roles that have full access to all records.
+	AdminRoles []string
+	// AllowUnprotected gives full access to the records without an ACL. By default only the admins can access them.
+	AllowUnprotected bool
+}
+
+// aclIdentityKey is the context key of the ACL identity.
+type aclIdentityKey struct{}
+
+// WithACLIdentity returns a context that carries the identity of the caller.
+func WithACLIdentity(ctx context.Context, identity *ACLIdentity) context.Context {
+	return context.WithValue(ctx, aclIdentityKey{}, identity)
+}
+
+// ACLIdentityFromContext returns the identity of the caller from the context. The second return value is false
+// if the context has no identity.
+func ACLIdentityFromContext(ctx context.Context) (*ACLIdentity, bool) {
+	identity, ok := ctx.Value(aclIdentityKey{}).(*ACLIdentity)
+	return identity, ok && identity != nil
+}
+
+// ACLIdentityFromClaims returns the identity from the Microkubes JWT claims ("userId", "roles" and "organizations"),
+// for example the claims of the token validated by the security chain of the service.
+func ACLIdentityFromClaims(claims map[string]interface{}) *ACLIdentity {
+	identity := &ACLIdentity{
+		Roles:         aclClaimStrings(claims["roles"]),
+		Organizations: aclClaimStrings(claims["organizations"]),
+	}
+	if userID, ok := claims["userId"]; ok && userID != nil {
+		identity.UserID = fmt.Sprintf("%v", userID)
+	}
+	return identity
+}
+
+// aclClaimStrings converts the claim value to a list of strings.
+func aclClaimStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		values := []string{}
+		for _, item := range v {
+			values = append(values, fmt.Sprintf("%v", item))
+		}
+		return values
+	case string:
+		if v == "" {
+			return []string{}
+		}
+		return strings.Split(v, ",")
+	}
+	return []string{}
+}
+
+// Principals returns the ACL principals of the identity.
+func (i *ACLIdentity) Principals() []string {
+	principals := []string{ACLEveryone}
+	if i.UserID != "" {
+		principals = append(principals, i.UserID)
+	}
+	for _, role := range i.Roles {
+		principals = append(principals, "role:"+role)
+	}
+	for _, organization := range i.Organizations {
+		principals = append(principals, "org:"+organization)
+	}
+	return principals
+}
+
+// NewOwnerACL returns an ACL with the identity as the only owner.
+func NewOwnerACL(identity *ACLIdentity) *ACL {
+	return &ACL{
+		Owners: []string{identity.UserID},
+	}
+}
+
+// IsOwner checks if the identity is an owner.
+func (a *ACL) IsOwner(identity *ACLIdentity) bool {
+	return aclMatches(a.Owners, identity)
+}
+
+// CanWrite checks if the identity is an owner or a writer.
+func (a *ACL) CanWrite(identity *ACLIdentity) bool {
+	return a.IsOwner(identity) || aclMatches(a.Writers, identity)
+}
+
+// CanRead checks if the identity is an owner, a writer or a reader.
+func (a *ACL) CanRead(identity *ACLIdentity) bool {
+	return a.CanWrite(identity) || aclMatches(a.Readers, identity)
+}
+
+// aclMatches checks if any of the principals of the identity is in the entries.
+func aclMatches(entries []string, identity *ACLIdentity) bool {
+	for _, principal := range identity.Principals() {
+		for _, entry := range entries {
+			if entry == principal {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GetACL returns the ACL stored in the record property. Returns nil if the record has no ACL.
+func GetACL(record map[string]interface{}, property string) (*ACL, error) {
+	value, ok := record[property]
+	if !ok || value == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+	acl := &ACL{}
+	if err := json.Unmarshal(data, acl); err != nil {
+		return nil, ErrInvalidInput(fmt.Sprintf("invalid ACL in property %s: %s", property, err.Error()))
+	}
+	return acl, nil
+}
+
+// SetACL stores the ACL in the record property.
+func SetACL(record map[string]interface{}, property string, acl *ACL) error {
+	value, err := normalizeValue(acl)
+	if err != nil {
+		return ErrInvalidInput(err)
+	}
+	record[property] = value
+	return nil
+}
+
+// ACLRepository is a Repository that checks the ACL of the records for an identity.
+// The reads return only the records the identity can read; the records it cannot read are treated as missing.
+// The writes fail with ErrForbidden on the records it can read, but cannot write. The new records get the identity
+// as owner, unless the ACL is set. Only the owners can change the ACL.
+//
+// The ACL is checked in memory, after the records are fetched, so GetAll fetches all records that match the filter
+// and paginates the readable ones.
+type ACLRepository struct {
+	Repository
+	identity *ACLIdentity
+	options  *ACLOptions
+}
+
+// NewACLRepository returns a view of the repository for the identity.
+func NewACLRepository(repo Repository, identity *ACLIdentity, options *ACLOptions) *ACLRepository {
+	return &ACLRepository{
+		Repository: repo,
+		identity:   identity,
+		options:    withACLDefaults(options),
+	}
+}
+
+// withACLDefaults returns a copy of the options with the defaults set.
+func withACLDefaults(options *ACLOptions) *ACLOptions {
+	withDefaults := ACLOptions{}
+	if options != nil {
+		withDefaults = *options
+	}
+	if withDefaults.Property == "" {
+		withDefaults.Property = "acl"
+	}
+	if withDefaults.KeyProperty == "" {
+		withDefaults.KeyProperty = "id"
+	}
+	return &withDefaults
+}
+
+// ACLRepositoryFromContext returns a view of the repository for the identity in the context (see WithACLIdentity).
+// Returns ErrForbidden if the context has no identity:
+//
+//	repo, err := backends.ACLRepositoryFromContext(ctx, notesRepo, aclOptions)
+//	if err != nil {
+//		return err
+//	}
+//	notes, err := repo.GetAll(filter, &Note{}, "createdAt", "desc", 20, 0)
+func ACLRepositoryFromContext(ctx context.Context, repo Repository, options *ACLOptions) (*ACLRepository, error) {
+	identity, ok := ACLIdentityFromContext(ctx)
+	if !ok {
+		return nil, ErrForbidden("no identity in context")
+	}
+	return NewACLRepository(repo, identity, options), nil
+}
+
+// GetOne fetches only one record for given filter, that the identity can read.
+func (r *ACLRepository) GetOne(filter Filter, result interface{}) (interface{}, error) {
+	records, err := r.readable(filter, "", "")
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrNotFound("record not found")
+	}
+
+	err = MapToInterface(&records[0], &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetAll fetches all matched records for given filter, that the identity can read.
+func (r *ACLRepository) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	records, err := r.readable(filter, order, sorting)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err = filterRecords(records, nil, "", "", limit, offset)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+
+	return recordsToResults(records, resultsTypeHint)
+}
+
+// Save creates new record unless it does not exist, otherwise it updates the record.
+// A new record without an ACL gets the identity as owner. An update requires write access, and changing the ACL
+// requires ownership.
+func (r *ACLRepository) Save(object interface{}, filter Filter) (interface{}, error) {
+	payload, err := InterfaceToMap(object)
+	if err != nil {
+		return nil, err
+	}
+	record := map[string]interface{}{}
+	for k, v := range *payload {
+		record[k] = v
+	}
+
+	if filter == nil {
+		if _, ok := record[r.options.Property]; !ok || record[r.options.Property] == nil {
+			if r.identity.UserID == "" {
+				return nil, ErrForbidden("anonymous callers cannot create records without an ACL")
+			}
+			if err := SetACL(record, r.options.Property, NewOwnerACL(r.identity)); err != nil {
+				return nil, err
+			}
+		}
+		return r.Repository.Save(&record, nil)
+	}
+
+	records, err := r.readable(filter, "", "")
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrNotFound("record not found")
+	}
+	existing := records[0]
+
+	if !r.can(existing, true, false) {
+		return nil, ErrForbidden("record is not writable")
+	}
+	if _, ok := record[r.options.Property]; ok && !r.can(existing, true, true) {
+		return nil, ErrForbidden("only the owners can change the ACL")
+	}
+
+	return r.Repository.Save(&record, NewFilter().Match(r.options.KeyProperty, existing[r.options.KeyProperty]))
+}
+
+// DeleteOne deletes only one record for given filter. Requires write access.
+func (r *ACLRepository) DeleteOne(filter Filter) error {
+	records, err := r.readable(filter, "", "")
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return ErrNotFound("record not found")
+	}
+	if !r.can(records[0], true, false) {
+		return ErrForbidden("record is not writable")
+	}
+	return r.Repository.DeleteOne(NewFilter().Match(r.options.KeyProperty, records[0][r.options.KeyProperty]))
+}
+
+// DeleteAll deletes all matched records for given filter, that the identity can read.
+// Returns ErrForbidden without deleting anything if any of them is not writable.
+func (r *ACLRepository) DeleteAll(filter Filter) error {
+	records, err := r.readable(filter, "", "")
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if !r.can(record, true, false) {
+			return ErrForbidden(fmt.Sprintf("record %v is not writable", record[r.options.KeyProperty]))
+		}
+	}
+	for _, record := range records {
+		err := r.Repository.DeleteOne(NewFilter().Match(r.options.KeyProperty, record[r.options.KeyProperty]))
+		if err != nil && !IsErrNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateAll updates all matched records for given filter, that the identity can read. Returns ErrForbidden without
+// updating anything if any of them is not writable, or if the update changes the ACL of a record the identity
+// does not own.
+func (r *ACLRepository) UpdateAll(filter Filter, update interface{}) (int64, error) {
+	payload, err := InterfaceToMap(update)
+	if err != nil {
+		return 0, err
+	}
+	_, changesACL := (*payload)[r.options.Property]
+
+	records, err := r.readable(filter, "", "")
+	if err != nil {
+		return 0, err
+	}
+	for _, record := range records {
+		if !r.can(record, true, false) {
+			return 0, ErrForbidden(fmt.Sprintf("record %v is not writable", record[r.options.KeyProperty]))
+		}
+		if changesACL && !r.can(record, true, true) {
+			return 0, ErrForbidden(fmt.Sprintf("only the owners can change the ACL of record %v", record[r.options.KeyProperty]))
+		}
+	}
+
+	var updated int64
+	for _, record := range records {
+		count, err := r.Repository.UpdateAll(NewFilter().Match(r.options.KeyProperty, record[r.options.KeyProperty]), payload)
+		updated += count
+		if err != nil {
+			return updated, err
+		}
+	}
+	return updated, nil
+}
+
+// SaveAll creates the objects as new records. The records without an ACL get the identity as owner.
+func (r *ACLRepository) SaveAll(objects interface{}) (interface{}, error) {
+	records, err := objectsToRecords(objects)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		if _, ok := record[r.options.Property]; ok && record[r.options.Property] != nil {
+			continue
+		}
+		if r.identity.UserID == "" {
+			return nil, ErrForbidden("anonymous callers cannot create records without an ACL")
+		}
+		if err := SetACL(record, r.options.Property, NewOwnerACL(r.identity)); err != nil {
+			return nil, err
+		}
+	}
+	return r.Repository.SaveAll(records)
+}
+
+// Count returns the number of records that match the filter, that the identity can read.
+func (r *ACLRepository) Count(filter Filter) (int64, error) {
+	records, err := r.readable(filter, "", "")
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(records)), nil
+}
+
+// Exists reports whether a record that the identity can read matches the filter.
+func (r *ACLRepository) Exists(filter Filter) (bool, error) {
+	records, err := r.readable(filter, "", "")
+	if err != nil {
+		return false, err
+	}
+	return len(records) > 0, nil
+}
+
+// readable returns the records that match the filter and the identity can read.
+func (r *ACLRepository) readable(filter Filter, order string, sorting string) ([]map[string]interface{}, error) {
+	results, err := r.Repository.GetAll(filter, &map[string]interface{}{}, order, sorting, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	all, err := syncRecords(results)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []map[string]interface{}{}
+	for _, record := range all {
+		if r.can(record, false, false) {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// can checks the access of the identity to the record: read, write or (if owner is true) ownership.
+func (r *ACLRepository) can(record map[string]interface{}, write bool, owner bool) bool {
+	for _, role := range r.identity.Roles {
+		for _, adminRole := range r.options.AdminRoles {
+			if role == adminRole {
+				return true
+			}
+		}
+	}
+
+	acl, err := GetACL(record, r.options.Property)
+	if err != nil {
+		return false
+	}
+	if acl == nil {
+		return r.options.AllowUnprotected
+	}
+
+	switch {
+	case owner:
+		return acl.IsOwner(r.identity)
+	case write:
+		return acl.CanWrite(r.identity)
+	}
+	return acl.CanRead(r.identity)
+}
@@ -0,0 +1,172 @@
+package backends
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func newACLTestRepository(t *testing.T) (Repository, func()) {
+	backend, err := CacheBackendBuilder(&config.DBInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := backend.DefineRepository("notes", RepositoryDefinitionMap{"name": "notes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo, backend.Shutdown
+}
+
+func aclTestIDs(t *testing.T, results interface{}) []string {
+	ids := []string{}
+	for _, record := range *results.(*[]*map[string]interface{}) {
+		ids = append(ids, (*record)["id"].(string))
+	}
+	return ids
+}
+
+func TestACLRepository(t *testing.T) {
+	repo, shutdown := newACLTestRepository(t)
+	defer shutdown()
+
+	alice := NewACLRepository(repo, &ACLIdentity{UserID: "alice", Organizations: []string{"acme"}}, nil)
+	bob := NewACLRepository(repo, &ACLIdentity{UserID: "bob", Roles: []string{"user"}}, nil)
+	admin := NewACLRepository(repo, &ACLIdentity{UserID: "root", Roles: []string{"admin"}}, &ACLOptions{AdminRoles: []string{"admin"}})
+
+	if _, err := alice.Save(&map[string]interface{}{"id": "1", "text": "private"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.Save(&map[string]interface{}{"id": "2", "text": "shared", "acl": &ACL{Owners: []string{"alice"}, Readers: []string{"role:user"}}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bob.Save(&map[string]interface{}{"id": "3", "text": "bob's", "acl": &ACL{Owners: []string{"bob"}, Writers: []string{"org:acme"}}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	// a record without an ACL, written directly
+	if _, err := repo.Save(&map[string]interface{}{"id": "4", "text": "unprotected"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := alice.GetAll(nil, &map[string]interface{}{}, "id", "asc", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := aclTestIDs(t, results); len(ids) != 3 || ids[0] != "1" || ids[2] != "3" {
+		t.Fatal("Expected alice to see 1, 2 and 3, got", ids)
+	}
+	results, err = bob.GetAll(nil, &map[string]interface{}{}, "id", "asc", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := aclTestIDs(t, results); len(ids) != 1 || ids[0] != "3" {
+		t.Fatal("Expected the second page of bob's records to be 3, got", ids)
+	}
+	results, err = admin.GetAll(nil, &map[string]interface{}{}, "", "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := aclTestIDs(t, results); len(ids) != 4 {
+		t.Fatal("Expected the admin to see all records, got", ids)
+	}
+	if count, err := bob.Count(nil); err != nil || count != 2 {
+		t.Fatal("Expected bob to count 2 records, got", count, err)
+	}
+	if exists, err := bob.Exists(NewFilter().Match("id", "1")); err != nil || exists {
+		t.Fatal("Expected alice's private record to be hidden from bob, got", exists, err)
+	}
+	if _, err := bob.UpdateAll(nil, &map[string]interface{}{"pinned": true}); err == nil || err.Error() != "forbidden" {
+		t.Fatal("Expected forbidden error when updating a read-only record, got", err)
+	}
+	if updated, err := alice.UpdateAll(nil, &map[string]interface{}{"pinned": true}); err != nil || updated != 3 {
+		t.Fatal("Expected alice to update 3 records, got", updated, err)
+	}
+	if _, err := alice.UpdateAll(NewFilter().Match("id", "3"), &map[string]interface{}{"acl": &ACL{Owners: []string{"alice"}}}); err == nil || err.Error() != "forbidden" {
+		t.Fatal("Expected forbidden error when a writer changes the ACL, got", err)
+	}
+	if count, err := repo.Count(NewFilter().Match("pinned", true)); err != nil || count != 3 {
+		t.Fatal("Expected the unprotected record not to be updated, got", count, err)
+	}
+
+	if _, err := bob.GetOne(NewFilter().Match("id", "1"), &map[string]interface{}{}); err == nil || err.Error() != "not found" {
+		t.Fatal("Expected not found error for alice's private record, got", err)
+	}
+	if _, err := bob.Save(&map[string]interface{}{"text": "changed"}, NewFilter().Match("id", "2")); err == nil || err.Error() != "forbidden" {
+		t.Fatal("Expected forbidden error for a read-only record, got", err)
+	}
+	if _, err := alice.Save(&map[string]interface{}{"text": "changed by alice"}, NewFilter().Match("id", "3")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.Save(&map[string]interface{}{"acl": &ACL{Owners: []string{"alice"}}}, NewFilter().Match("id", "3")); err == nil || err.Error() != "forbidden" {
+		t.Fatal("Expected forbidden error when a writer changes the ACL, got", err)
+	}
+
+	if err := bob.DeleteAll(nil); err == nil || err.Error() != "forbidden" {
+		t.Fatal("Expected forbidden error when deleting a read-only record, got", err)
+	}
+	if err := bob.DeleteOne(NewFilter().Match("id", "3")); err != nil {
+		t.Fatal(err)
+	}
+	if err := alice.DeleteAll(nil); err != nil {
+		t.Fatal(err)
+	}
+	results, err = repo.GetAll(nil, &map[string]interface{}{}, "", "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := aclTestIDs(t, results); len(ids) != 1 || ids[0] != "4" {
+		t.Fatal("Expected only the unprotected record to be left, got", ids)
+	}
+}
+
+func TestACLRepositoryFromContext(t *testing.T) {
+	repo, shutdown := newACLTestRepository(t)
+	defer shutdown()
+
+	if _, err := ACLRepositoryFromContext(context.Background(), repo, nil); err == nil || !IsErrForbidden(err) {
+		t.Fatal("Expected forbidden error without an identity, got", err)
+	}
+
+	identity := ACLIdentityFromClaims(map[string]interface{}{
+		"userId":        "alice",
+		"roles":         []interface{}{"user"},
+		"organizations": []interface{}{"acme"},
+	})
+	aclRepo, err := ACLRepositoryFromContext(WithACLIdentity(context.Background(), identity), repo, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := aclRepo.Save(&map[string]interface{}{"id": "1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acl, err := GetACL(saved.(map[string]interface{}), "acl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acl == nil || !acl.IsOwner(identity) || acl.IsOwner(&ACLIdentity{UserID: "bob"}) {
+		t.Fatal("Expected alice to own the new record, got", acl)
+	}
+
+	saved, err = aclRepo.SaveAll([]map[string]interface{}{{"id": "2"}, {"id": "3", "acl": &ACL{Readers: []string{ACLEveryone}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acl, err := GetACL(saved.([]interface{})[0].(map[string]interface{}), "acl"); err != nil || acl == nil || !acl.IsOwner(identity) {
+		t.Fatal("Expected alice to own the new records, got", acl, err)
+	}
+	if acl, err := GetACL(saved.([]interface{})[1].(map[string]interface{}), "acl"); err != nil || acl == nil || acl.IsOwner(identity) {
+		t.Fatal("Expected the given ACL to be kept, got", acl, err)
+	}
+	anonymous := NewACLRepository(repo, &ACLIdentity{}, nil)
+	if _, err := anonymous.SaveAll([]map[string]interface{}{{"id": "4"}}); err == nil || !IsErrForbidden(err) {
+		t.Fatal("Expected forbidden error for an anonymous caller, got", err)
+	}
+
+	public := &ACL{Readers: []string{ACLEveryone}}
+	if !public.CanRead(&ACLIdentity{}) || public.CanWrite(&ACLIdentity{}) {
+		t.Fatal("Expected everyone to be able to read, but not write")
+	}
+}
@@ -0,0 +1,228 @@
+package backends
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// IndexAdvisorOptions configures IndexAdvisor.
+type IndexAdvisorOptions struct {
+	// MinQueries is the number of queries with the same shape above which an index is suggested,
+	// even if the queries are not slow. Default is 100.
+	MinQueries int
+	// MinSlowQueries is the number of slow queries with the same shape above which an index is suggested.
+	// Default is 1.
+	MinSlowQueries int
+}
+
+// IndexSuggestion is a missing index suggested by IndexAdvisor.
+type IndexSuggestion struct {
+	// Repository is the name of the repository.
+	Repository string
+	// Fields are the fields of the suggested index, in order: the equality matches, the order property,
+	// and then the pattern matches.
+	Fields []string
+	// GSI is true if the repository is a DynamoDB table (it has a hash key), and a global secondary index
+	// is suggested. HashKey and RangeKey are the keys of the GSI.
+	GSI      bool
+	HashKey  string
+	RangeKey string
+	// Queries is the number of the queries that would use the index.
+	Queries int
+	// SlowQueries is the number of the slow queries that would use the index.
+	SlowQueries int
+	// AverageDuration is the average duration of the queries.
+	AverageDuration time.Duration
+	// Reason describes why the index is suggested.
+	Reason string
+}
+
+// IndexAdvisor suggests the missing indexes (and DynamoDB GSIs) of the repositories, from the query shapes and
+// the slow queries recorded by QueryTelemetry:
+//
+//	for _, suggestion := range backends.NewIndexAdvisor(backend, telemetry, nil).Advise() {
+//		log.Printf("%s: index on %v (%s)", suggestion.Repository, suggestion.Fields, suggestion.Reason)
+//	}
+//
+// The existing indexes are read from the repository definitions, if the backend keeps them
+// (see RepositoryDefinitionProvider) - pass the RepositoriesBackend, and not the HookedBackend that wraps it. Otherwise only the key ("id") is considered indexed.
+// The suggestions are meant to be reviewed by a person - an index has a storage and write cost, which the advisor
+// does not know about.
+type IndexAdvisor struct {
+	backend   Backend
+	telemetry *QueryTelemetry
+	options   *IndexAdvisorOptions
+}
+
+// NewIndexAdvisor creates new IndexAdvisor for the repositories of the backend.
+func NewIndexAdvisor(backend Backend, telemetry *QueryTelemetry, options *IndexAdvisorOptions) *IndexAdvisor {
+	if options == nil {
+		options = &IndexAdvisorOptions{}
+	}
+	if options.MinQueries <= 0 {
+		options.MinQueries = 100
+	}
+	if options.MinSlowQueries <= 0 {
+		options.MinSlowQueries = 1
+	}
+	return &IndexAdvisor{
+		backend:   backend,
+		telemetry: telemetry,
+		options:   options,
+	}
+}
+
+// Advise returns the suggested indexes, the ones that would speed up the most slow queries first.
+func (a *IndexAdvisor) Advise() []IndexSuggestion {
+	suggestions := map[string]*IndexSuggestion{}
+	durations := map[string]time.Duration{}
+
+	for _, stats := range a.telemetry.Shapes() {
+		fields := suggestedIndexFields(stats.Shape)
+		if len(fields) == 0 {
+			continue
+		}
+		def := a.definition(stats.Shape.Repository)
+		if indexCovers(def, stats.Shape) {
+			continue
+		}
+
+		key := stats.Shape.Repository + "|" + strings.Join(fields, ",")
+		suggestion, ok := suggestions[key]
+		if !ok {
+			suggestion = &IndexSuggestion{
+				Repository: stats.Shape.Repository,
+				Fields:     fields,
+			}
+			if def != nil && def.GetHashKey() != "" {
+				suggestion.GSI = true
+				suggestion.HashKey = fields[0]
+				if len(fields) > 1 {
+					suggestion.RangeKey = fields[1]
+				}
+			}
+			suggestions[key] = suggestion
+		}
+		suggestion.Queries += stats.Queries
+		suggestion.SlowQueries += stats.SlowQueries
+		durations[key] += stats.TotalDuration
+	}
+
+	result := []IndexSuggestion{}
+	for key, suggestion := range suggestions {
+		if suggestion.SlowQueries < a.options.MinSlowQueries && suggestion.Queries < a.options.MinQueries {
+			continue
+		}
+		suggestion.AverageDuration = durations[key] / time.Duration(suggestion.Queries)
+		if suggestion.SlowQueries >= a.options.MinSlowQueries {
+			suggestion.Reason = fmt.Sprintf("%d slow queries of %d, average duration %s", suggestion.SlowQueries, suggestion.Queries, suggestion.AverageDuration)
+		} else {
+			suggestion.Reason = fmt.Sprintf("%d queries, average duration %s", suggestion.Queries, suggestion.AverageDuration)
+		}
+		result = append(result, *suggestion)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].SlowQueries != result[j].SlowQueries {
+			return result[i].SlowQueries > result[j].SlowQueries
+		}
+		if result[i].Queries != result[j].Queries {
+			return result[i].Queries > result[j].Queries
+		}
+		return result[i].Repository+strings.Join(result[i].Fields, ",") < result[j].Repository+strings.Join(result[j].Fields, ",")
+	})
+	return result
+}
+
+// definition returns the definition of the repository, nil if the backend does not keep it.
+func (a *IndexAdvisor) definition(repository string) RepositoryDefinition {
+	provider, ok := a.backend.(RepositoryDefinitionProvider)
+	if !ok {
+		return nil
+	}
+	def, err := provider.GetRepositoryDefinition(repository)
+	if err != nil {
+		return nil
+	}
+	return def
+}
+
+// suggestedIndexFields returns the fields of the index for the query shape: the equality matches, then the order
+// property, then the pattern matches.
+func suggestedIndexFields(shape QueryShape) []string {
+	fields := append([]string{}, shape.Equality...)
+	if shape.Order != "" {
+		fields = appendUnique(fields, shape.Order)
+	}
+	for _, property := range shape.Patterns {
+		fields = appendUnique(fields, property)
+	}
+	return fields
+}
+
+// indexCovers checks if the repository has a key or an index that serves the queries with the shape.
+// An index serves the queries if it starts with all the equality matches (in any order), or, if there are none,
+// with the order property or a pattern match.
+func indexCovers(def RepositoryDefinition, shape QueryShape) bool {
+	keys := []string{"id"}
+	indexes := [][]string{}
+	if def != nil {
+		if def.GetHashKey() != "" {
+			keys = []string{def.GetHashKey()}
+		}
+		for _, index := range def.GetIndexes() {
+			indexes = append(indexes, index.GetFields())
+		}
+		for property := range def.GetGSI() {
+			indexes = append(indexes, []string{property})
+		}
+	}
+
+	for _, key := range keys {
+		for _, property := range shape.Equality {
+			if property == key {
+				return true
+			}
+		}
+		indexes = append(indexes, []string{key})
+	}
+
+	leading := shape.Equality
+	if len(leading) == 0 {
+		candidates := append([]string{}, shape.Patterns...)
+		if shape.Order != "" {
+			candidates = append([]string{shape.Order}, candidates...)
+		}
+		for _, fields := range indexes {
+			for _, candidate := range candidates {
+				if len(fields) > 0 && fields[0] == candidate {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	for _, fields := range indexes {
+		if len(fields) < len(leading) {
+			continue
+		}
+		prefix := map[string]bool{}
+		for _, field := range fields[:len(leading)] {
+			prefix[field] = true
+		}
+		covered := true
+		for _, property := range leading {
+			if !prefix[property] {
+				covered = false
+				break
+			}
+		}
+		if covered {
+			return true
+		}
+	}
+	return false
+}
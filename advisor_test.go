@@ -0,0 +1,71 @@
+package backends
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func TestIndexAdvisor(t *testing.T) {
+	backend, err := CacheBackendBuilder(&config.DBInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Shutdown()
+
+	telemetry := NewQueryTelemetry(&QueryTelemetryOptions{SlowQueryThreshold: time.Hour})
+	hooked := NewHookedBackend(backend, telemetry.Hooks())
+	users, err := hooked.DefineRepository("users", RepositoryDefinitionMap{
+		"name":    "users",
+		"indexes": []Index{NewIndex("email", true, "email")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables, err := hooked.DefineRepository("sessions", RepositoryDefinitionMap{
+		"name":    "sessions",
+		"hashKey": "token",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := func(repo Repository, filter Filter, order string, times int) {
+		for i := 0; i < times; i++ {
+			if _, err := repo.GetAll(filter, &map[string]interface{}{}, order, "asc", 0, 0); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	query(users, NewFilter().Match("email", "john@example.com"), "", 5)
+	query(users, NewFilter().Match("id", "1").Match("status", "active"), "", 5)
+	query(users, NewFilter().Match("status", "active").Match("org", "acme"), "createdAt", 3)
+	query(users, NewFilter().Match("org", "acme").Match("status", "active"), "createdAt", 1)
+	query(users, NewFilter().MatchPattern("name", "J%"), "", 1)
+	query(tables, NewFilter().Match("user", "john"), "createdAt", 2)
+	query(tables, NewFilter().Match("token", "abc"), "", 5)
+
+	suggestions := NewIndexAdvisor(backend, telemetry, &IndexAdvisorOptions{MinQueries: 2}).Advise()
+	if len(suggestions) != 2 {
+		t.Fatal("Expected 2 suggestions. Got: ", suggestions)
+	}
+	if suggestions[0].Repository != "users" || !reflect.DeepEqual(suggestions[0].Fields, []string{"org", "status", "createdAt"}) ||
+		suggestions[0].Queries != 4 || suggestions[0].GSI {
+		t.Fatal("Invalid index suggestion. Got: ", suggestions[0])
+	}
+	gsi := suggestions[1]
+	if gsi.Repository != "sessions" || !gsi.GSI || gsi.HashKey != "user" || gsi.RangeKey != "createdAt" || gsi.Reason == "" {
+		t.Fatal("Invalid GSI suggestion. Got: ", gsi)
+	}
+
+	// the slow queries are suggested even if they are rare
+	telemetry.Reset()
+	telemetry.options.SlowQueryThreshold = time.Nanosecond
+	query(users, NewFilter().MatchPattern("name", "J%"), "", 1)
+	suggestions = NewIndexAdvisor(backend, telemetry, nil).Advise()
+	if len(suggestions) != 1 || suggestions[0].SlowQueries != 1 || !reflect.DeepEqual(suggestions[0].Fields, []string{"name"}) {
+		t.Fatal("Expected an index for the slow query. Got: ", suggestions)
+	}
+}
@@ -0,0 +1,588 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+	driver "github.com/arangodb/go-driver"
+	arangohttp "github.com/arangodb/go-driver/http"
+)
+
+// ARANGO_CTX_KEY is ArangoDB context key
+var ARANGO_CTX_KEY = "ARANGO_DATABASE"
+
+// arangoRequestTimeout is the timeout for a single request to ArangoDB.
+const arangoRequestTimeout = 30 * time.Second
+
+// ArangoCollection is a repository backed by ArangoDB document collection.
+type ArangoCollection struct {
+	collection driver.Collection
+	db         driver.Database
+	repoDef    RepositoryDefinition
+}
+
+// ArangoQuery is an AQL filter with its bind variables. The filter refers to the
+// current document as "d", for example:
+//
+//	FILTER d.@p0 == @v0
+type ArangoQuery struct {
+	Filter   string
+	BindVars map[string]interface{}
+}
+
+// ArangoQueryTranslator translates filters into AQL filters (*ArangoQuery).
+type ArangoQueryTranslator struct{}
+
+// Translate translates the filter AST into AQL filter.
+func (t *ArangoQueryTranslator) Translate(ast *FilterAST) (interface{}, error) {
+	query := &ArangoQuery{
+		BindVars: map[string]interface{}{},
+	}
+	conditions := []string{}
+
+	for i, cond := range ast.Conditions {
+		property := fmt.Sprintf("p%d", i)
+		value := fmt.Sprintf("v%d", i)
+		query.BindVars[property] = cond.Property
+
+		switch cond.Operator {
+		case OpEq:
+			conditions = append(conditions, fmt.Sprintf("d.@%s == @%s", property, value))
+			query.BindVars[value] = cond.Value
+		case OpPattern:
+			conditions = append(conditions, fmt.Sprintf("REGEX_TEST(d.@%s, @%s)", property, value))
+			query.BindVars[value] = toMongoPattern(cond.Value.(string))
+		case OpRegex:
+			conditions = append(conditions, fmt.Sprintf("REGEX_TEST(d.@%s, @%s)", property, value))
+			query.BindVars[value] = cond.Value
+		case OpNe:
+			conditions = append(conditions, fmt.Sprintf("d.@%s != @%s", property, value))
+			query.BindVars[value] = cond.Value
+		case OpGt, OpGte:
+			conditions = append(conditions, fmt.Sprintf("d.@%s %s @%s", property, comparisonOperators[cond.Operator], value))
+			query.BindVars[value] = cond.Value
+		case OpLt, OpLte:
+			// null (a missing attribute) is less than any value in AQL
+			conditions = append(conditions, fmt.Sprintf("d.@%s != null AND d.@%s %s @%s", property, property, comparisonOperators[cond.Operator], value))
+			query.BindVars[value] = cond.Value
+		case OpIn:
+			conditions = append(conditions, fmt.Sprintf("d.@%s IN @%s", property, value))
+			query.BindVars[value] = cond.Value
+		case OpExists:
+			if cond.Value.(bool) {
+				conditions = append(conditions, fmt.Sprintf("HAS(d, @%s)", property))
+			} else {
+				conditions = append(conditions, fmt.Sprintf("!HAS(d, @%s)", property))
+			}
+		case OpNull:
+			if cond.Value.(bool) {
+				// a missing attribute is null in AQL
+				conditions = append(conditions, fmt.Sprintf("HAS(d, @%s) AND d.@%s == null", property, property))
+			} else {
+				conditions = append(conditions, fmt.Sprintf("d.@%s != null", property))
+			}
+		case OpNin:
+			conditions = append(conditions, fmt.Sprintf("d.@%s NOT IN @%s", property, value))
+			query.BindVars[value] = cond.Value
+		default:
+			return nil, ErrInvalidInput(fmt.Sprintf("operator %s is not supported by ArangoDB backend", cond.Operator))
+		}
+	}
+
+	if len(conditions) > 0 {
+		query.Filter = "FILTER " + strings.Join(conditions, " AND ")
+	}
+
+	return query, nil
+}
+
+var arangoQueryTranslator = &ArangoQueryTranslator{}
+
+// ArangoDBRepoBuilder builds new ArangoDB collection.
+// If it does not exist builder will create it
+func ArangoDBRepoBuilder(repoDef RepositoryDefinition, backend Backend) (Repository, error) {
+
+	dbObj := backend.GetFromContext(ARANGO_CTX_KEY)
+	if dbObj == nil {
+		return nil, ErrBackendError("arango database not configured")
+	}
+
+	db, ok := dbObj.(driver.Database)
+	if !ok {
+		return nil, ErrBackendError("unknown database type")
+	}
+
+	collectionName := repoDef.GetName()
+	if collectionName == "" {
+		return nil, ErrBackendError("collection name is missing and required")
+	}
+
+	collection, err := prepareArangoCollection(db, collectionName, repoDef)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ArangoCollection{
+		collection: collection,
+		db:         db,
+		repoDef:    repoDef,
+	}, nil
+}
+
+// ArangoDBBackendBuilder returns RepositoriesBackend.
+// The host may contain multiple comma separated endpoints. The database is created if it does not exist.
+func ArangoDBBackendBuilder(conf *config.DBInfo, manager BackendManager) (Backend, error) {
+
+	if conf.DatabaseName == "" {
+		return nil, ErrBackendError("database name is missing and required")
+	}
+
+	endpoints := []string{}
+	for _, host := range strings.Split(conf.Host, ",") {
+		if !strings.Contains(host, "://") {
+			host = "http://" + host
+		}
+		endpoints = append(endpoints, host)
+	}
+
+	conn, err := arangohttp.NewConnection(arangohttp.ConnectionConfig{
+		Endpoints: endpoints,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	clientConfig := driver.ClientConfig{
+		Connection: conn,
+	}
+	if conf.Username != "" {
+		clientConfig.Authentication = driver.BasicAuthentication(conf.Username, conf.Password)
+	}
+
+	client, err := driver.NewClient(clientConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), arangoRequestTimeout)
+	defer cancel()
+
+	exists, err := client.DatabaseExists(ctx, conf.DatabaseName)
+	if err != nil {
+		return nil, err
+	}
+
+	var db driver.Database
+	if exists {
+		db, err = client.Database(ctx, conf.DatabaseName)
+	} else {
+		db, err = client.CreateDatabase(ctx, conf.DatabaseName, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	backendCtx := context.WithValue(context.Background(), ARANGO_CTX_KEY, db)
+	cleanup := func() {}
+
+	return NewRepositoriesBackend(backendCtx, conf, ArangoDBRepoBuilder, cleanup), nil
+}
+
+// prepareArangoCollection creates the collection if it does not exist and ensures the indexes.
+// Unique indexes are created as hash indexes, non-unique indexes are created as skiplist indexes, so they can be
+// used for sorting and range queries as well.
+func prepareArangoCollection(db driver.Database, name string, repoDef RepositoryDefinition) (driver.Collection, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), arangoRequestTimeout)
+	defer cancel()
+
+	exists, err := db.CollectionExists(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var collection driver.Collection
+	if exists {
+		collection, err = db.Collection(ctx, name)
+	} else {
+		collection, err = db.CreateCollection(ctx, name, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, index := range repoDef.GetIndexes() {
+		if index.Unique() {
+			_, _, err = collection.EnsureHashIndex(ctx, index.GetFields(), &driver.EnsureHashIndexOptions{
+				Unique: true,
+				Sparse: true,
+			})
+		} else {
+			_, _, err = collection.EnsureSkipListIndex(ctx, index.GetFields(), &driver.EnsureSkipListIndexOptions{
+				Sparse: true,
+			})
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if repoDef.EnableTTL() {
+		if repoDef.GetTTLAttribute() == "" {
+			return nil, ErrBackendError("TTL attribute is reqired when TTL is enabled")
+		}
+
+		if repoDef.GetTTL() == 0 {
+			return nil, ErrBackendError("TTL value is missing and must be greater than zero")
+		}
+
+		if _, _, err := collection.EnsureTTLIndex(ctx, repoDef.GetTTLAttribute(), repoDef.GetTTL(), nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return collection, nil
+}
+
+// GetOne fetches only one record for given filter
+func (c *ArangoCollection) GetOne(filter Filter, result interface{}) (interface{}, error) {
+	records, err := c.query(filter, "", "", 1, 0, "RETURN d")
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrNotFound("record not found")
+	}
+
+	err = MapToInterface(&records[0], &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetAll fetches all matched records for given filter
+func (c *ArangoCollection) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	records, err := c.query(filter, order, sorting, limit, offset, "RETURN d")
+	if err != nil {
+		return nil, err
+	}
+
+	return recordsToResults(records, resultsTypeHint)
+}
+
+// Count returns the number of records that match the filter.
+func (c *ArangoCollection) Count(filter Filter) (int64, error) {
+	records, err := c.query(filter, "", "", 0, 0, "COLLECT WITH COUNT INTO total RETURN {total: total}")
+	if err != nil {
+		return 0, err
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+	total, ok := records[0]["total"].(float64)
+	if !ok {
+		return 0, ErrBackendError(fmt.Sprintf("unexpected count result %v", records[0]))
+	}
+	return int64(total), nil
+}
+
+// Exists reports whether a record matches the filter. Only the key of the first matching document is returned.
+func (c *ArangoCollection) Exists(filter Filter) (bool, error) {
+	records, err := c.query(filter, "", "", 1, 0, "RETURN {key: d._key}")
+	if err != nil {
+		return false, err
+	}
+	return len(records) > 0, nil
+}
+
+// Save creates new record unless it does not exist, otherwise it updates the record
+func (c *ArangoCollection) Save(object interface{}, filter Filter) (interface{}, error) {
+
+	var result interface{}
+
+	payload, err := InterfaceToMap(object)
+	if err != nil {
+		return nil, err
+	}
+
+	if filter == nil {
+		if !c.repoDef.IsCustomID() {
+			if id, ok := (*payload)["id"]; ok {
+				if id != nil && id != "" {
+					(*payload)["_key"] = id
+				}
+				delete(*payload, "id")
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), arangoRequestTimeout)
+		defer cancel()
+
+		var created map[string]interface{}
+		_, err = c.collection.CreateDocument(driver.WithReturnNew(ctx, &created), payload)
+		if err != nil {
+			if driver.IsConflict(err) {
+				return nil, ErrAlreadyExists("record already exists!")
+			}
+			return nil, err
+		}
+		c.fromArangoDocument(created)
+		payload = &created
+	} else {
+		c.removeImmutable(*payload)
+
+		records, err := c.query(filter, "", "", 1, 0, "UPDATE d WITH @payload IN @@collection RETURN NEW", map[string]interface{}{
+			"payload": payload,
+		})
+		if err != nil {
+			if driver.IsConflict(err) {
+				return nil, ErrAlreadyExists("record already exists!")
+			}
+			return nil, err
+		}
+		if len(records) == 0 {
+			return nil, ErrNotFound("record not found")
+		}
+		payload = &records[0]
+	}
+
+	err = MapToInterface(payload, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// SaveAll creates the objects (a slice) as new records, with a single request. Returns the created records, as
+// returned by Save. ArangoDB creates the documents independently: the documents that fail (for example because a
+// document with the same key exists) are not created, and the first failure is returned with the created records.
+func (c *ArangoCollection) SaveAll(objects interface{}) (interface{}, error) {
+	records, err := objectsToRecords(objects)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return []interface{}{}, nil
+	}
+	if !c.repoDef.IsCustomID() {
+		for _, record := range records {
+			if id, ok := record["id"]; ok {
+				if id != nil && id != "" {
+					record["_key"] = id
+				}
+				delete(record, "id")
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), arangoRequestTimeout)
+	defer cancel()
+
+	created := make([]map[string]interface{}, len(records))
+	_, errs, err := c.collection.CreateDocuments(driver.WithReturnNew(ctx, created), records)
+	if err != nil {
+		return nil, err
+	}
+
+	saved := []interface{}{}
+	var failure error
+	for i, document := range created {
+		if i < len(errs) && errs[i] != nil {
+			if failure == nil {
+				if driver.IsConflict(errs[i]) {
+					failure = ErrAlreadyExists("record already exists!")
+				} else {
+					failure = errs[i]
+				}
+			}
+			continue
+		}
+		c.fromArangoDocument(document)
+		var result interface{}
+		if err := MapToInterface(&document, &result); err != nil {
+			return saved, err
+		}
+		saved = append(saved, result)
+	}
+	return saved, failure
+}
+
+// UpdateAll updates all matched records for given filter with the properties of the update, with a single
+// AQL query. Returns the number of the updated records.
+func (c *ArangoCollection) UpdateAll(filter Filter, update interface{}) (int64, error) {
+	payload, err := InterfaceToMap(update)
+	if err != nil {
+		return 0, err
+	}
+	c.removeImmutable(*payload)
+
+	records, err := c.query(filter, "", "", 0, 0, "UPDATE d WITH @payload IN @@collection RETURN {key: NEW._key}", map[string]interface{}{
+		"payload": payload,
+	})
+	if err != nil {
+		if driver.IsConflict(err) {
+			return 0, ErrAlreadyExists("record already exists!")
+		}
+		return 0, err
+	}
+	return int64(len(records)), nil
+}
+
+// removeImmutable removes the attributes that cannot be updated from the payload.
+func (c *ArangoCollection) removeImmutable(payload map[string]interface{}) {
+	for _, key := range []string{"_key", "_id", "_rev"} {
+		// ArangoDB's own attributes are immutable.
+		delete(payload, key)
+	}
+	if !c.repoDef.IsCustomID() {
+		delete(payload, "id")
+	}
+}
+
+// DeleteOne deletes only one record for given filter
+func (c *ArangoCollection) DeleteOne(filter Filter) error {
+	records, err := c.query(filter, "", "", 1, 0, "REMOVE d IN @@collection RETURN OLD")
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return ErrNotFound("record not found")
+	}
+	return nil
+}
+
+// DeleteAll deletes all matched records for given filter
+func (c *ArangoCollection) DeleteAll(filter Filter) error {
+	_, err := c.query(filter, "", "", 0, 0, "REMOVE d IN @@collection")
+	return err
+}
+
+// query runs AQL query over the collection documents that match the filter. The given
+// operation (for example "RETURN d") is appended at the end of the query.
+func (c *ArangoCollection) query(filter Filter, order string, sorting string, limit int, offset int, operation string, bindVars ...map[string]interface{}) ([]map[string]interface{}, error) {
+	translated, err := TranslateFilter(c.toArangoFilter(filter), arangoQueryTranslator)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+	arangoQuery := translated.(*ArangoQuery)
+
+	vars := arangoQuery.BindVars
+	vars["@collection"] = c.collection.Name()
+	for _, extra := range bindVars {
+		for k, v := range extra {
+			vars[k] = v
+		}
+	}
+
+	aql := []string{"FOR d IN @@collection"}
+	if arangoQuery.Filter != "" {
+		aql = append(aql, arangoQuery.Filter)
+	}
+	if order != "" {
+		direction := "ASC"
+		if sorting == "desc" {
+			direction = "DESC"
+		}
+		aql = append(aql, "SORT d.@order "+direction)
+		// an array attribute name bind parameter is a path to a nested attribute
+		vars["order"] = strings.Split(c.toArangoProperty(order), ".")
+	}
+	if limit != 0 || offset != 0 {
+		count := limit
+		if count == 0 {
+			count = math.MaxInt32
+		}
+		aql = append(aql, "LIMIT @offset, @count")
+		vars["offset"] = offset
+		vars["count"] = count
+	}
+	aql = append(aql, operation)
+
+	return c.execute(strings.Join(aql, " "), vars)
+}
+
+// RawQuery runs the AQL operations of the query (*ArangoQuery) on the documents of the collection, for example
+// "FILTER d.age >= @age SORT d.name LIMIT 10". The operations refer to the current document as "d", and the matched
+// documents are returned. See RawQuerier.
+func (c *ArangoCollection) RawQuery(query interface{}, resultsTypeHint interface{}) (interface{}, error) {
+	arangoQuery, ok := query.(*ArangoQuery)
+	if !ok {
+		return nil, ErrInvalidInput(fmt.Sprintf("ArangoDB raw query must be *ArangoQuery, got %T", query))
+	}
+	vars := map[string]interface{}{}
+	for k, v := range arangoQuery.BindVars {
+		vars[k] = v
+	}
+	vars["@collection"] = c.collection.Name()
+
+	records, err := c.execute("FOR d IN @@collection "+arangoQuery.Filter+" RETURN d", vars)
+	if err != nil {
+		return nil, err
+	}
+	if resultsTypeHint == nil {
+		resultsTypeHint = &map[string]interface{}{}
+	}
+	return recordsToResults(records, resultsTypeHint)
+}
+
+// execute runs the AQL query and returns the documents as records.
+func (c *ArangoCollection) execute(aql string, vars map[string]interface{}) ([]map[string]interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), arangoRequestTimeout)
+	defer cancel()
+
+	cursor, err := c.db.Query(ctx, aql, vars)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	records := []map[string]interface{}{}
+	for cursor.HasMore() {
+		var record map[string]interface{}
+		if _, err := cursor.ReadDocument(ctx, &record); err != nil {
+			return nil, err
+		}
+		if record != nil {
+			c.fromArangoDocument(record)
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// toArangoProperty maps the "id" property to ArangoDB's "_key", unless the repository has custom ID handling.
+func (c *ArangoCollection) toArangoProperty(property string) string {
+	if property == "id" && !c.repoDef.IsCustomID() {
+		return "_key"
+	}
+	return property
+}
+
+// toArangoFilter maps the filter properties to ArangoDB document attributes.
+func (c *ArangoCollection) toArangoFilter(filter Filter) Filter {
+	arangoFilter := Filter{}
+	for property, value := range filter {
+		arangoFilter[c.toArangoProperty(property)] = value
+	}
+	return arangoFilter
+}
+
+// fromArangoDocument maps the ArangoDB's "_key" attribute to "id" (unless the repository has custom ID handling)
+// and removes the ArangoDB internal attributes.
+func (c *ArangoCollection) fromArangoDocument(record map[string]interface{}) {
+	if !c.repoDef.IsCustomID() {
+		if key, ok := record["_key"]; ok {
+			record["id"] = key
+			delete(record, "_key")
+		}
+	}
+	delete(record, "_id")
+	delete(record, "_rev")
+}
@@ -0,0 +1,134 @@
+package backends
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	driver "github.com/arangodb/go-driver"
+)
+
+func TestArangoQueryTranslator(t *testing.T) {
+	translated, err := TranslateFilter(NewFilter().MatchPattern("name", "John%").Match("role", "user"), arangoQueryTranslator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := translated.(*ArangoQuery)
+
+	if query.Filter != "FILTER REGEX_TEST(d.@p0, @v0) AND d.@p1 == @v1" {
+		t.Fatal("Invalid AQL filter. Got: ", query.Filter)
+	}
+	if query.BindVars["p0"] != "name" || query.BindVars["v0"] != "^John.*" || query.BindVars["p1"] != "role" || query.BindVars["v1"] != "user" {
+		t.Fatal("Invalid bind variables. Got: ", query.BindVars)
+	}
+
+	translated, err = TranslateFilter(NewFilter(), arangoQueryTranslator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if translated.(*ArangoQuery).Filter != "" {
+		t.Fatal("Expected empty AQL filter. Got: ", translated.(*ArangoQuery).Filter)
+	}
+}
+
+func TestArangoDocumentMapping(t *testing.T) {
+	coll := &ArangoCollection{
+		repoDef: RepositoryDefinitionMap{"name": "users"},
+	}
+
+	filter := coll.toArangoFilter(NewFilter().Match("id", "1234").Match("email", "a@b.c"))
+	if filter["_key"] != "1234" || filter["email"] != "a@b.c" {
+		t.Fatal("Expected id to be mapped to _key. Got: ", filter)
+	}
+
+	record := map[string]interface{}{
+		"_key":  "1234",
+		"_id":   "users/1234",
+		"_rev":  "_abc",
+		"email": "a@b.c",
+	}
+	coll.fromArangoDocument(record)
+	if len(record) != 2 || record["id"] != "1234" {
+		t.Fatal("Expected _key to be mapped to id. Got: ", record)
+	}
+}
+
+// fakeArangoDB runs the REMOVE queries on the documents of a single collection. It matches all documents, and
+// returns what ArangoDB returns: nothing without RETURN, the removed documents with RETURN OLD, and the removed keys
+// (bare strings) with RETURN OLD._key.
+type fakeArangoDB struct {
+	driver.Database
+	documents []map[string]interface{}
+}
+
+func (db *fakeArangoDB) Query(ctx context.Context, query string, bindVars map[string]interface{}) (driver.Cursor, error) {
+	if !strings.Contains(query, "REMOVE d IN @@collection") {
+		return nil, fmt.Errorf("unexpected query %s", query)
+	}
+	results := []interface{}{}
+	for _, document := range db.documents {
+		if strings.HasSuffix(query, "RETURN OLD._key") {
+			results = append(results, document["_key"])
+		} else if strings.HasSuffix(query, "RETURN OLD") {
+			results = append(results, document)
+		}
+	}
+	db.documents = nil
+	return &fakeArangoCursor{results: results}, nil
+}
+
+type fakeArangoCursor struct {
+	driver.Cursor
+	results []interface{}
+}
+
+func (c *fakeArangoCursor) HasMore() bool {
+	return len(c.results) > 0
+}
+
+func (c *fakeArangoCursor) ReadDocument(ctx context.Context, result interface{}) (driver.DocumentMeta, error) {
+	data, err := json.Marshal(c.results[0])
+	c.results = c.results[1:]
+	if err != nil {
+		return driver.DocumentMeta{}, err
+	}
+	return driver.DocumentMeta{}, json.Unmarshal(data, result)
+}
+
+func (c *fakeArangoCursor) Close() error {
+	return nil
+}
+
+type fakeArangoCollection struct {
+	driver.Collection
+}
+
+func (c *fakeArangoCollection) Name() string {
+	return "users"
+}
+
+func TestArangoDelete(t *testing.T) {
+	db := &fakeArangoDB{documents: []map[string]interface{}{
+		{"_key": "1", "role": "user"},
+		{"_key": "2", "role": "user"},
+	}}
+	coll := &ArangoCollection{
+		collection: &fakeArangoCollection{},
+		db:         db,
+		repoDef:    RepositoryDefinitionMap{"name": "users"},
+	}
+
+	if err := coll.DeleteAll(NewFilter().Match("role", "user")); err != nil {
+		t.Fatal("Expected the matched documents to be deleted. Got: ", err)
+	}
+	if err := coll.DeleteOne(NewFilter().Match("role", "user")); !IsErrNotFound(err) {
+		t.Fatal("Expected ErrNotFound when no document is left. Got: ", err)
+	}
+
+	db.documents = []map[string]interface{}{{"_key": "3", "role": "user"}}
+	if err := coll.DeleteOne(NewFilter().Match("role", "user")); err != nil {
+		t.Fatal(err)
+	}
+}
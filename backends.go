@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/Microkubes/microservice-tools/config"
 )
@@ -37,6 +38,7 @@ func (f Filter) Match(property string, value interface{}) Filter {
 // "a%" matches "ab" but not "ba"
 // "%ab%" matches anything that contains "ab"
 // "ab" does an exact match to "ab"
+// All other characters in the pattern are matched literally, so it is safe to use user input in the pattern.
 func (f Filter) MatchPattern(property, value string) Filter {
 	f[property] = map[string]string{
 		"$pattern": value,
@@ -44,19 +46,119 @@ func (f Filter) MatchPattern(property, value string) Filter {
 	return f
 }
 
+// MatchRegex sets a raw regular expression match for the given property.
+// The expression is passed to the backend as is, so it must never be built from user input - use
+// MatchPattern for that. Not all backends support regular expressions (DynamoDB does not), and the
+// supported syntax depends on the backend.
+func (f Filter) MatchRegex(property, regex string) Filter {
+	f[property] = map[string]string{
+		"$regex": regex,
+	}
+	return f
+}
+
+// MatchGt matches the records whose property is greater than the value. The range operators on the same property
+// are combined, for example:
+// 		filter := backends.NewFilter().MatchGte("createdAt", from).MatchLt("createdAt", to)
+// Numbers are compared with numbers and strings with strings. The times (time.Time and the RFC 3339 strings) are
+// compared as times, see TimeLayout.
+func (f Filter) MatchGt(property string, value interface{}) Filter {
+	return f.matchOperator(property, OpGt, value)
+}
+
+// MatchGte matches the records whose property is greater than or equal to the value. See Filter.MatchGt.
+func (f Filter) MatchGte(property string, value interface{}) Filter {
+	return f.matchOperator(property, OpGte, value)
+}
+
+// MatchLt matches the records whose property is less than the value. See Filter.MatchGt.
+func (f Filter) MatchLt(property string, value interface{}) Filter {
+	return f.matchOperator(property, OpLt, value)
+}
+
+// MatchLte matches the records whose property is less than or equal to the value. See Filter.MatchGt.
+func (f Filter) MatchLte(property string, value interface{}) Filter {
+	return f.matchOperator(property, OpLte, value)
+}
+
+// MatchTimeRange matches the records whose property is a time from (inclusive) to (exclusive). A zero time leaves
+// that end of the range open. See Filter.MatchGt.
+func (f Filter) MatchTimeRange(property string, from, to time.Time) Filter {
+	if !from.IsZero() {
+		f.MatchGte(property, from)
+	}
+	if !to.IsZero() {
+		f.MatchLt(property, to)
+	}
+	return f
+}
+
+// MatchIn matches the records whose property equals any of the values (a slice of any type).
+func (f Filter) MatchIn(property string, values interface{}) Filter {
+	return f.matchOperator(property, OpIn, values)
+}
+
+// MatchNotIn matches the records whose property equals none of the values (a slice of any type), or that don't
+// have the property.
+func (f Filter) MatchNotIn(property string, values interface{}) Filter {
+	return f.matchOperator(property, OpNin, values)
+}
+
+// MatchExists matches the records that have the property, even if it is null (exists is true), or that don't have
+// it (exists is false).
+func (f Filter) MatchExists(property string, exists bool) Filter {
+	return f.matchOperator(property, OpExists, exists)
+}
+
+// MatchNull matches the records whose property is null (null is true), or is set to a value other than null (null is
+// false). The records without the property are matched by neither - use MatchExists for them.
+func (f Filter) MatchNull(property string, null bool) Filter {
+	return f.matchOperator(property, OpNull, null)
+}
+
+// matchOperator adds the operator to the specification of the property. An exact match already set on the property
+// is kept as $eq.
+func (f Filter) matchOperator(property, operator string, value interface{}) Filter {
+	spec := map[string]interface{}{}
+	if current, ok := f[property]; ok {
+		specs, isSpec, err := toFilterSpecs(current)
+		if isSpec && err == nil {
+			spec = specs
+		} else {
+			spec[OpEq] = current
+		}
+	}
+	spec[operator] = value
+	f[property] = spec
+	return f
+}
+
 // Set is an alias for Filter.Match - do an exact match on the given property.
 func (f Filter) Set(property string, value interface{}) Filter {
 	f[property] = value
 	return f
 }
 
-// Repository defines the interface for accessing the data
+// Repository defines the interface for accessing the data.
+// GetAll treats limit 0 as "no limit" and offset 0 as "no offset", so a request for zero records
+// cannot be expressed with it. Use GetPage with the typed Limit, NoLimit and Offset options instead.
+// Count returns the number of records that match the filter, without fetching them (where the backend can count natively).
+// Exists reports whether a record matches the filter, without unmarshalling it into a result.
+// UpdateAll sets the properties of the update on all records that match the filter (the key is immutable) and returns
+// the number of the updated records. The backends with bulk updates (MongoDB, ArangoDB, Neo4j) update the records
+// with a single request.
+// SaveAll creates the objects (a slice of structs or maps) as new records and returns the created records. The
+// backends with batch writes (MongoDB, DynamoDB, ArangoDB, CouchDB) create the records with a single request or a few.
 type Repository interface {
 	GetOne(filter Filter, result interface{}) (interface{}, error)
 	GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error)
 	Save(object interface{}, filter Filter) (interface{}, error)
 	DeleteOne(filter Filter) error
 	DeleteAll(filter Filter) error
+	Count(filter Filter) (int64, error)
+	Exists(filter Filter) (bool, error)
+	UpdateAll(filter Filter, update interface{}) (int64, error)
+	SaveAll(objects interface{}) (interface{}, error)
 }
 
 type Index interface {
@@ -112,19 +214,26 @@ type RepositoryDefinitionMap map[string]interface{}
 // BackendCleanup is the collection/table clean  up func
 type BackendCleanup func()
 
-// DefaultBackendManager represents the backend store
+// DefaultBackendManager represents the backend store.
+// The mutex guards only the manager's maps - it is never held while a backend is being built,
+// so the backend builders may call back into the manager.
 type DefaultBackendManager struct {
 	backendBuilders map[string]BackendBuilder
 	backends        map[string]Backend
 	backendProps    map[string]interface{}
 	dbConfig        map[string]*config.DBInfo
+	building        map[string]chan struct{}
 	mutex           *sync.Mutex
 }
 
-// RepositoriesBackend represents the repository store
+// RepositoriesBackend represents the repository store.
+// The mutex guards only the repositories map and the context - it is never held while a repository
+// is being built, so the repository builders may call back into the backend.
 type RepositoriesBackend struct {
 	repositories      map[string]Repository
+	definitions       map[string]RepositoryDefinition
 	repositoryBuilder RepoBuilder
+	defining          map[string]*pendingRepository
 	mutex             *sync.Mutex
 	DBInfo            *config.DBInfo
 	ctx               context.Context
@@ -252,27 +361,137 @@ func (m RepositoryDefinitionMap) GetRangeKeyType() string {
 	return ""
 }
 
-// DefineRepository defines the repository (collection/table)
+// pendingRepository is a repository that is being defined. The error of the definition is set before done is
+// closed.
+type pendingRepository struct {
+	done chan struct{}
+	err  error
+}
+
+// definingBackend is the view of a RepositoriesBackend passed to the repository builder. It knows the repositories
+// that are being defined by the builder (and by the builders that called it), so a builder that defines one of them
+// again gets an error instead of waiting for itself.
+type definingBackend struct {
+	*RepositoriesBackend
+	defining []string
+}
+
+// DefineRepository defines the repository, unless the builder is defining it already.
+func (b *definingBackend) DefineRepository(name string, def RepositoryDefinition) (Repository, error) {
+	return b.RepositoriesBackend.define(name, def, b.defining)
+}
+
+// DefineRepository defines the repository (collection/table).
+// If the same repository is being defined concurrently, the call waits for that definition to complete, and
+// returns its error if it failed.
+// The repository builder is called without holding the backend lock, so it may call back into the backend
+// (through the backend it is given) to define the repositories it depends on. A builder that defines, directly or
+// through the builders it calls, the repository it is building gets ErrBackendError. Defining the repository
+// through another reference to the backend (for example from a hook of a repository used by the builder), or two
+// builders of concurrent definitions that define each other's repository, is not supported and deadlocks.
 func (m *RepositoriesBackend) DefineRepository(name string, def RepositoryDefinition) (Repository, error) {
+	return m.define(name, def, nil)
+}
 
+// define defines the repository. The names are the repositories being defined by the calling builders.
+func (m *RepositoriesBackend) define(name string, def RepositoryDefinition, defining []string) (Repository, error) {
+
+	m.mutex.Lock()
 	if repository, ok := m.repositories[name]; ok {
+		m.mutex.Unlock()
 		return repository, nil
 	}
+	for _, parent := range defining {
+		if parent == name {
+			m.mutex.Unlock()
+			return nil, ErrBackendError(fmt.Sprintf("repository %s is defined recursively by its builder", name))
+		}
+	}
+	if m.defining == nil {
+		m.defining = map[string]*pendingRepository{}
+	}
+	if pending, ok := m.defining[name]; ok {
+		m.mutex.Unlock()
+		<-pending.done
+		if pending.err != nil {
+			return nil, pending.err
+		}
+		return m.GetRepository(name)
+	}
+	pending := &pendingRepository{done: make(chan struct{})}
+	m.defining[name] = pending
+	m.mutex.Unlock()
+
+	builderBackend := &definingBackend{
+		RepositoriesBackend: m,
+		defining:            append(append([]string{}, defining...), name),
+	}
+	repository, err := m.repositoryBuilder(def, builderBackend)
+	if err == nil {
+		repository, err = wrapRepository(repository, def)
+	}
 
 	m.mutex.Lock()
-	defer m.mutex.Unlock()
+	delete(m.defining, name)
+	if err == nil {
+		m.repositories[name] = repository
+		if m.definitions == nil {
+			m.definitions = map[string]RepositoryDefinition{}
+		}
+		m.definitions[name] = def
+	}
+	pending.err = err
+	m.mutex.Unlock()
+	close(pending.done)
 
-	repository, err := m.repositoryBuilder(def, m)
 	if err != nil {
 		return nil, err
 	}
-
-	m.repositories[name] = repository
 	return repository, nil
 }
 
+// definitionWrapper is implemented by the wrappers that apply the rules of the definition of the repository to the
+// writes and the reads (DataSchemaRepository, VersionedRepository, EnumRepository and SoftDeleteRepository). They are
+// not a RepositoryWrapper, because the capabilities of the wrapped repository would bypass the rules, but the
+// transactions find the repository of the backend under them, and wrap the repository of the transaction the same way.
+type definitionWrapper interface {
+	wrapped() Repository
+}
+
+// wrapRepository wraps the repository built for the definition with the wrappers the definition enables: the data
+// schema, the versions, the enums, the model and the soft deletes.
+func wrapRepository(repo Repository, def RepositoryDefinition) (Repository, error) {
+	repo, err := withDataSchema(repo, def)
+	if err != nil {
+		return nil, err
+	}
+	repo = withVersioning(repo, def)
+	if repo, err = withEnums(repo, def); err != nil {
+		return nil, err
+	}
+	repo = withModel(repo, def)
+	return withSoftDelete(repo, def), nil
+}
+
+// unwrapRepository returns the repository built by the repository builder under the wrappers of wrapRepository.
+func unwrapRepository(repo Repository) Repository {
+	for {
+		switch wrapper := repo.(type) {
+		case definitionWrapper:
+			repo = wrapper.wrapped()
+		case RepositoryWrapper:
+			repo = wrapper.Unwrap()
+		default:
+			return repo
+		}
+	}
+}
+
 // GetRepository return the repository (collection/table)
 func (m *RepositoriesBackend) GetRepository(name string) (Repository, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
 	if repo, ok := m.repositories[name]; ok {
 		return repo, nil
 	}
@@ -280,6 +499,18 @@ func (m *RepositoriesBackend) GetRepository(name string) (Repository, error) {
 	return nil, fmt.Errorf("unknown repo")
 }
 
+// GetRepositoryDefinition returns the definition the repository (collection/table) was defined with.
+func (m *RepositoriesBackend) GetRepositoryDefinition(name string) (RepositoryDefinition, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if def, ok := m.definitions[name]; ok {
+		return def, nil
+	}
+
+	return nil, fmt.Errorf("unknown repo")
+}
+
 // GetConfig return the config
 func (m *RepositoriesBackend) GetConfig() *config.DBInfo {
 	return m.DBInfo
@@ -287,7 +518,11 @@ func (m *RepositoriesBackend) GetConfig() *config.DBInfo {
 
 // GetFromContext returns from config
 func (m *RepositoriesBackend) GetFromContext(key string) interface{} {
-	return m.ctx.Value(key)
+	m.mutex.Lock()
+	ctx := m.ctx
+	m.mutex.Unlock()
+
+	return ctx.Value(key)
 }
 
 // SetInContext sets in context
@@ -305,15 +540,37 @@ func (m *RepositoriesBackend) Shutdown() {
 	}
 }
 
-// GetBackend returns the RepositoryBackend
+// GetBackend returns the RepositoryBackend.
+// The backend is built on first use. The backend builder is called without holding the manager lock,
+// so it may call back into the manager (for example to get another backend).
 func (m *DefaultBackendManager) GetBackend(backendType string) (Backend, error) {
+	m.mutex.Lock()
 	if backend, ok := m.backends[backendType]; ok {
+		m.mutex.Unlock()
 		return backend, nil
 	}
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
+	if m.building == nil {
+		m.building = map[string]chan struct{}{}
+	}
+	if done, ok := m.building[backendType]; ok {
+		m.mutex.Unlock()
+		<-done
+		return m.GetBackend(backendType)
+	}
+	done := make(chan struct{})
+	m.building[backendType] = done
+	m.mutex.Unlock()
 
 	backend, err := m.buildBackend(backendType)
+
+	m.mutex.Lock()
+	delete(m.building, backendType)
+	if err == nil {
+		m.backends[backendType] = backend
+	}
+	m.mutex.Unlock()
+	close(done)
+
 	if err != nil {
 		return nil, err
 	}
@@ -322,12 +579,18 @@ func (m *DefaultBackendManager) GetBackend(backendType string) (Backend, error)
 
 // SupportBackend register the DB builder function and required props for the DB
 func (m *DefaultBackendManager) SupportBackend(backendType string, builder BackendBuilder, properties map[string]interface{}) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
 	m.backendBuilders[backendType] = builder
 	m.backendProps[backendType] = properties
 }
 
 // GetSupportedBackends returns the supported backedns
 func (m *DefaultBackendManager) GetSupportedBackends() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
 	supported := []string{}
 
 	for backendType, _ := range m.backendBuilders {
@@ -339,6 +602,9 @@ func (m *DefaultBackendManager) GetSupportedBackends() []string {
 
 // GetRequiredBackendProperties returns the required props for the selected backend
 func (m *DefaultBackendManager) GetRequiredBackendProperties(backendType string) (map[string]interface{}, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
 	if props, ok := m.backendProps[backendType]; ok {
 		return props.(map[string]interface{}), nil
 	}
@@ -347,19 +613,18 @@ func (m *DefaultBackendManager) GetRequiredBackendProperties(backendType string)
 
 // buildBackend builds new backend
 func (m *DefaultBackendManager) buildBackend(backendType string) (Backend, error) {
-	if backendBuilder, ok := m.backendBuilders[backendType]; ok {
-		dbInfo, ok := m.dbConfig[backendType]
-		if !ok || dbInfo == nil {
-			return nil, fmt.Errorf("backend not configured")
-		}
-		backend, err := backendBuilder(dbInfo, m)
-		if err != nil {
-			return nil, err
-		}
-		m.backends[backendType] = backend
-		return backend, nil
+	m.mutex.Lock()
+	backendBuilder, ok := m.backendBuilders[backendType]
+	dbInfo := m.dbConfig[backendType]
+	m.mutex.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("backend not supported")
 	}
-	return nil, fmt.Errorf("backend not supported")
+	if dbInfo == nil {
+		return nil, fmt.Errorf("backend not configured")
+	}
+	return backendBuilder(dbInfo, m)
 }
 
 // NewRepositoriesBackend sets new RepositoriesBackend
@@ -368,7 +633,9 @@ func NewRepositoriesBackend(ctx context.Context, dbInfo *config.DBInfo, repoBuil
 		DBInfo:            dbInfo,
 		mutex:             &sync.Mutex{},
 		repositories:      map[string]Repository{},
+		definitions:       map[string]RepositoryDefinition{},
 		repositoryBuilder: repoBuilder,
+		defining:          map[string]*pendingRepository{},
 		ctx:               ctx,
 		cleanupFn:         cleanup,
 	}
@@ -381,6 +648,7 @@ func NewBackendManager(dbConfig map[string]*config.DBInfo) BackendManager {
 		backendProps:    map[string]interface{}{},
 		backends:        map[string]Backend{},
 		dbConfig:        dbConfig,
+		building:        map[string]chan struct{}{},
 		mutex:           &sync.Mutex{},
 	}
 }
@@ -431,6 +699,86 @@ func NewNonUniqueIndex(fields ...string) Index {
 	return NewIndex(indexNameFromFields(fields...), false, fields...)
 }
 
+// IndexKey is a field of an index, with its sort direction.
+type IndexKey struct {
+	Field      string
+	Descending bool
+}
+
+// Ascending returns the key of the field sorted in the ascending order.
+func Ascending(field string) IndexKey {
+	return IndexKey{Field: field}
+}
+
+// Descending returns the key of the field sorted in the descending order.
+func Descending(field string) IndexKey {
+	return IndexKey{Field: field, Descending: true}
+}
+
+// SortedIndex is implemented by the indexes that set the sort direction of their fields (see NewSortedIndex). The
+// keys are in the order of the compound key of the index, the same as GetFields. The fields of the other indexes are
+// ascending.
+type SortedIndex interface {
+	Index
+	GetKeys() []IndexKey
+}
+
+// sortedIndex is an index with the sort directions of its fields.
+type sortedIndex struct {
+	fieldsIndex
+	keys []IndexKey
+}
+
+// GetKeys returns the fields of the index with their sort directions.
+func (s *sortedIndex) GetKeys() []IndexKey {
+	return s.keys
+}
+
+// NewSortedIndex creates an index with the sort direction of each field, for the queries that filter on the first
+// fields and sort by the next ones:
+//
+//	backends.NewSortedIndex("", false, backends.Ascending("userId"), backends.Descending("createdAt"))
+//
+// The name is built from the fields and their directions if it is empty ("userId_createdAt_desc"). MongoDB creates
+// the index with the directions; the other backends index the fields as with NewIndex.
+func NewSortedIndex(name string, unique bool, keys ...IndexKey) Index {
+	fields := []string{}
+	parts := []string{}
+	for _, key := range keys {
+		fields = append(fields, key.Field)
+		parts = append(parts, key.Field)
+		if key.Descending {
+			parts = append(parts, "desc")
+		}
+	}
+	if name == "" {
+		name = strings.Join(parts, "_")
+	}
+	if keys == nil {
+		keys = []IndexKey{}
+	}
+	return &sortedIndex{
+		fieldsIndex: fieldsIndex{
+			name:   name,
+			fields: fields,
+			unique: unique,
+		},
+		keys: keys,
+	}
+}
+
+// indexKeys returns the fields of the index with their sort directions, ascending unless the index is a SortedIndex.
+func indexKeys(index Index) []IndexKey {
+	if sorted, ok := index.(SortedIndex); ok {
+		return sorted.GetKeys()
+	}
+	keys := []IndexKey{}
+	for _, field := range index.GetFields() {
+		keys = append(keys, Ascending(field))
+	}
+	return keys
+}
+
 func asInt64(v interface{}) int64 {
 	if i, ok := v.(int64); ok {
 		return i
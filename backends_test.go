@@ -2,11 +2,11 @@ package backends
 
 import (
 	"context"
+	"reflect"
 	"sync"
 	"testing"
 
 	"github.com/Microkubes/microservice-tools/config"
-	"github.com/guregu/dynamo"
 )
 
 var props = map[string]interface{}{
@@ -68,8 +68,7 @@ func backendBuilderFn(dbInfo *config.DBInfo, manager BackendManager) (Backend, e
 
 func repoBuilderFn(repoDef RepositoryDefinition, backend Backend) (Repository, error) {
 	repo := DynamoCollection{
-		&dynamo.Table{},
-		&collectionInfo,
+		RepositoryDefinition: &collectionInfo,
 	}
 
 	return &repo, nil
@@ -83,6 +82,24 @@ func TestGetIndexes(t *testing.T) {
 	}
 }
 
+func TestNewSortedIndex(t *testing.T) {
+	index := NewSortedIndex("", true, Ascending("userId"), Descending("createdAt"))
+	if index.GetName() != "userId_createdAt_desc" || !index.Unique() || !reflect.DeepEqual(index.GetFields(), []string{"userId", "createdAt"}) {
+		t.Fatal("Expected the fields and the name of the index. Got: ", index.GetName(), index.GetFields())
+	}
+	if keys := indexKeys(index); !reflect.DeepEqual(keys, []IndexKey{{Field: "userId"}, {Field: "createdAt", Descending: true}}) {
+		t.Fatal("Expected the keys with their directions. Got: ", keys)
+	}
+	if named := NewSortedIndex("recent", false, Descending("createdAt")); named.GetName() != "recent" {
+		t.Fatal("Expected the given name. Got: ", named.GetName())
+	}
+
+	// the fields of the other indexes are ascending
+	if keys := indexKeys(NewNonUniqueIndex("email", "status")); !reflect.DeepEqual(keys, []IndexKey{Ascending("email"), Ascending("status")}) {
+		t.Fatal("Expected ascending keys. Got: ", keys)
+	}
+}
+
 func TestGetName(t *testing.T) {
 	name := collectionInfo.GetName()
 
@@ -155,6 +172,44 @@ func TestGetGSI(t *testing.T) {
 	}
 }
 
+func TestGetLSI(t *testing.T) {
+	if lsi := collectionInfo.GetLSI(); lsi != nil {
+		t.Errorf("Expected no LSI, got %v", lsi)
+	}
+	lsi := RepositoryDefinitionMap{"LSI": map[string]interface{}{"score": map[string]interface{}{"type": "N"}}}.GetLSI()
+	if lsi["score"] == nil {
+		t.Errorf("Expected the LSI on score, got %v", lsi)
+	}
+}
+
+func TestGetAutoScaling(t *testing.T) {
+	if autoScaling := collectionInfo.GetAutoScaling(); autoScaling != nil {
+		t.Errorf("Expected no auto scaling, got %v", autoScaling)
+	}
+	autoScaling := RepositoryDefinitionMap{"autoScaling": map[string]interface{}{"minCapacity": 5, "maxCapacity": 50}}.GetAutoScaling()
+	if autoScaling["maxCapacity"] != 50 {
+		t.Errorf("Expected the auto scaling up to 50, got %v", autoScaling)
+	}
+}
+
+func TestGetEncryption(t *testing.T) {
+	if encryption := collectionInfo.GetEncryption(); encryption != "" {
+		t.Errorf("Expected no encryption, got %v", encryption)
+	}
+	if encryption := (RepositoryDefinitionMap{"encryption": "AWS_MANAGED"}).GetEncryption(); encryption != "AWS_MANAGED" {
+		t.Errorf("Expected AWS_MANAGED encryption, got %v", encryption)
+	}
+}
+
+func TestEnablePointInTimeRecovery(t *testing.T) {
+	if collectionInfo.EnablePointInTimeRecovery() {
+		t.Errorf("Expected point-in-time recovery to be disabled")
+	}
+	if !(RepositoryDefinitionMap{"pointInTimeRecovery": true}).EnablePointInTimeRecovery() {
+		t.Errorf("Expected point-in-time recovery to be enabled")
+	}
+}
+
 func TestDefineRepository(t *testing.T) {
 	r, err := repoBuilder.DefineRepository("test-repo", collectionInfo)
 	if r == nil {
@@ -0,0 +1,411 @@
+// Package backendsbench drives configurable read/write workloads against any backends.Backend and reports the
+// throughput and the latency percentiles of every operation, so the backends can be compared for a given workload:
+//
+//	for name, backend := range map[string]backends.Backend{"mongodb": mongo, "dynamodb": dynamo, "postgres": sql} {
+//		report, err := backendsbench.Run(backend, &backendsbench.Workload{
+//			Name:        name,
+//			Schema:      backends.GeneratorSchema{"name": backends.FullName(), "age": backends.IntBetween(18, 90)},
+//			Mix:         map[backendsbench.Operation]int{backendsbench.OpGetOne: 70, backendsbench.OpSave: 20, backendsbench.OpUpdate: 10},
+//			Concurrency: 32,
+//			Duration:    time.Minute,
+//		})
+//		if err != nil {
+//			log.Fatal(err)
+//		}
+//		reports = append(reports, report)
+//	}
+//	backendsbench.Compare(os.Stdout, reports...)
+package backendsbench
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/JormungandrK/backends"
+)
+
+// Operation is a kind of operation of a workload.
+type Operation string
+
+const (
+	// OpGetOne fetches a record by its id.
+	OpGetOne Operation = "getOne"
+	// OpGetPage fetches a page of the records matched by Workload.Filter.
+	OpGetPage Operation = "getPage"
+	// OpCount counts the records matched by Workload.Filter.
+	OpCount Operation = "count"
+	// OpSave creates a new record.
+	OpSave Operation = "save"
+	// OpUpdate updates a record by its id.
+	OpUpdate Operation = "update"
+	// OpDelete deletes a record by its id.
+	OpDelete Operation = "delete"
+)
+
+// idPrefix is the prefix of the ids of the records created by the workload.
+const idPrefix = "bench-"
+
+// Workload describes the operations run against a backend.
+type Workload struct {
+	// Name is the name of the workload in the report, usually the name of the backend.
+	Name string
+	// Repository is the name of the repository the workload runs against. The repository is defined with
+	// Definition, and its records are deleted after the run, so use a dedicated repository. Default is "backendsbench".
+	Repository string
+	// Definition is the definition of the repository. Default is a repository with a custom string id ("id"), so
+	// the same definition works on all backends.
+	Definition backends.RepositoryDefinition
+	// Schema generates the records (see backends.Generate). The ids are generated by the workload.
+	Schema backends.GeneratorSchema
+	// Prefill is the number of records created before the run. Default is 1000.
+	Prefill int
+	// Mix gives the weights of the operations. Default is 80% OpGetOne, 10% OpSave and 10% OpUpdate.
+	Mix map[Operation]int
+	// Filter returns the filter of OpGetPage and OpCount. Default is all records.
+	Filter func(r *rand.Rand) backends.Filter
+	// PageSize is the number of records of OpGetPage. Default is 20.
+	PageSize int
+	// Concurrency is the number of concurrent workers. Default is 8.
+	Concurrency int
+	// Duration is the duration of the run. Default is 10 seconds.
+	Duration time.Duration
+	// Operations stops the run after this number of operations, if it is reached before Duration.
+	Operations int
+	// Seed seeds the random choices of the workers. Default is the current time.
+	Seed int64
+	// KeepRecords leaves the records in the repository after the run.
+	KeepRecords bool
+}
+
+// Stats are the results of the operations of one kind (or of all operations).
+type Stats struct {
+	// Operations is the number of completed operations, including the failed ones.
+	Operations int
+	// Errors is the number of failed operations. ErrNotFound is not a failure, because the workload deletes
+	// records.
+	Errors int
+	// FirstError is the error of the first failed operation.
+	FirstError error
+	// Throughput is the number of operations per second.
+	Throughput float64
+	// Mean is the mean latency.
+	Mean time.Duration
+	// P50 is the median latency.
+	P50 time.Duration
+	// P90 is the 90th percentile of the latencies.
+	P90 time.Duration
+	// P99 is the 99th percentile of the latencies.
+	P99 time.Duration
+	// Max is the highest latency.
+	Max time.Duration
+}
+
+// Report is the result of a run.
+type Report struct {
+	// Name is the name of the workload.
+	Name string
+	// Duration is the actual duration of the run, without the prefill.
+	Duration time.Duration
+	// Total are the results of all operations.
+	Total *Stats
+	// Operations are the results by operation.
+	Operations map[Operation]*Stats
+}
+
+// sample is the outcome of a single operation.
+type sample struct {
+	latency time.Duration
+	err     error
+}
+
+// Run defines the repository on the backend, prefills it and runs the workload. The operations are picked at
+// random by their weights in the mix.
+func Run(backend backends.Backend, workload *Workload) (*Report, error) {
+	w := withDefaults(workload)
+
+	repo, err := backend.DefineRepository(w.Repository, w.Definition)
+	if err != nil {
+		return nil, err
+	}
+	if !w.KeepRecords {
+		defer repo.DeleteAll(backends.NewFilter().MatchPattern("id", idPrefix+"%"))
+	}
+
+	prefill := backends.GeneratorSchema{}
+	for field, generator := range w.Schema {
+		prefill[field] = generator
+	}
+	prefill["id"] = backends.Sequence(idPrefix)
+	if _, err := backends.Generate(repo, prefill, &backends.GeneratorOptions{Count: w.Prefill, Seed: w.Seed}); err != nil {
+		return nil, fmt.Errorf("prefill failed: %v", err)
+	}
+
+	runner := &runner{
+		workload:   w,
+		repo:       repo,
+		operations: mixOperations(w.Mix),
+		next:       int64(w.Prefill),
+		deadline:   time.Now().Add(w.Duration),
+		samples:    map[Operation][]sample{},
+		mutex:      &sync.Mutex{},
+	}
+
+	start := time.Now()
+	wg := &sync.WaitGroup{}
+	for worker := 0; worker < w.Concurrency; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			runner.work(rand.New(rand.NewSource(w.Seed + int64(worker) + 1)))
+		}(worker)
+	}
+	wg.Wait()
+
+	return runner.report(time.Since(start)), nil
+}
+
+// withDefaults returns a copy of the workload with the defaults set.
+func withDefaults(workload *Workload) *Workload {
+	w := &Workload{}
+	if workload != nil {
+		*w = *workload
+	}
+	if w.Repository == "" {
+		w.Repository = "backendsbench"
+	}
+	if w.Definition == nil {
+		w.Definition = backends.RepositoryDefinitionMap{
+			"name":          w.Repository,
+			"customId":      true,
+			"hashKey":       "id",
+			"hashKeyType":   "S",
+			"readCapacity":  int64(5),
+			"writeCapacity": int64(5),
+		}
+	}
+	if w.Schema == nil {
+		w.Schema = backends.GeneratorSchema{
+			"name":  backends.FullName(),
+			"email": backends.Email("example.com"),
+			"age":   backends.IntBetween(18, 90),
+		}
+	}
+	if w.Prefill < 1 {
+		w.Prefill = 1000
+	}
+	if len(w.Mix) == 0 {
+		w.Mix = map[Operation]int{OpGetOne: 80, OpSave: 10, OpUpdate: 10}
+	}
+	if w.Filter == nil {
+		w.Filter = func(r *rand.Rand) backends.Filter {
+			return nil
+		}
+	}
+	if w.PageSize < 1 {
+		w.PageSize = 20
+	}
+	if w.Concurrency < 1 {
+		w.Concurrency = 8
+	}
+	if w.Duration <= 0 {
+		w.Duration = 10 * time.Second
+	}
+	if w.Seed == 0 {
+		w.Seed = time.Now().UnixNano()
+	}
+	return w
+}
+
+// mixOperations expands the mix to a list with every operation repeated by its weight.
+func mixOperations(mix map[Operation]int) []Operation {
+	operations := []Operation{}
+	for operation := range mix {
+		operations = append(operations, operation)
+	}
+	sort.Slice(operations, func(i, j int) bool {
+		return operations[i] < operations[j]
+	})
+	expanded := []Operation{}
+	for _, operation := range operations {
+		for i := 0; i < mix[operation]; i++ {
+			expanded = append(expanded, operation)
+		}
+	}
+	return expanded
+}
+
+// runner runs the operations of a workload.
+type runner struct {
+	workload   *Workload
+	repo       backends.Repository
+	operations []Operation
+	// next is the index of the next created record
+	next int64
+	// done is the number of started operations
+	done     int64
+	deadline time.Time
+	samples  map[Operation][]sample
+	mutex    *sync.Mutex
+}
+
+// work runs the operations until the deadline, or until the number of operations is reached.
+func (r *runner) work(random *rand.Rand) {
+	samples := map[Operation][]sample{}
+	for time.Now().Before(r.deadline) {
+		if r.workload.Operations > 0 && atomic.AddInt64(&r.done, 1) > int64(r.workload.Operations) {
+			break
+		}
+		operation := r.operations[random.Intn(len(r.operations))]
+		start := time.Now()
+		err := r.run(operation, random)
+		samples[operation] = append(samples[operation], sample{latency: time.Since(start), err: err})
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for operation, s := range samples {
+		r.samples[operation] = append(r.samples[operation], s...)
+	}
+}
+
+// run runs a single operation.
+func (r *runner) run(operation Operation, random *rand.Rand) error {
+	var err error
+	switch operation {
+	case OpGetOne:
+		_, err = r.repo.GetOne(r.existing(random), &map[string]interface{}{})
+	case OpGetPage:
+		_, err = backends.GetPage(r.repo, r.workload.Filter(random), &map[string]interface{}{}, "", "", backends.Limit(r.workload.PageSize))
+	case OpCount:
+		_, err = r.repo.Count(r.workload.Filter(random))
+	case OpSave:
+		index := int(atomic.AddInt64(&r.next, 1) - 1)
+		record := r.workload.Schema.Record(random, index)
+		record["id"] = fmt.Sprintf("%s%d", idPrefix, index)
+		_, err = r.repo.Save(&record, nil)
+	case OpUpdate:
+		index := random.Intn(int(atomic.LoadInt64(&r.next)))
+		update := r.workload.Schema.Record(random, index)
+		_, err = r.repo.UpdateAll(backends.NewFilter().Match("id", fmt.Sprintf("%s%d", idPrefix, index)), &update)
+	case OpDelete:
+		err = r.repo.DeleteOne(r.existing(random))
+	default:
+		err = fmt.Errorf("unknown operation %s", operation)
+	}
+	if err != nil && backends.IsErrNotFound(err) {
+		// the record was deleted by another operation
+		return nil
+	}
+	return err
+}
+
+// existing returns the filter of a random record created by the workload.
+func (r *runner) existing(random *rand.Rand) backends.Filter {
+	index := random.Intn(int(atomic.LoadInt64(&r.next)))
+	return backends.NewFilter().Match("id", fmt.Sprintf("%s%d", idPrefix, index))
+}
+
+// report computes the statistics of the samples.
+func (r *runner) report(duration time.Duration) *Report {
+	report := &Report{
+		Name:       r.workload.Name,
+		Duration:   duration,
+		Operations: map[Operation]*Stats{},
+	}
+	all := []sample{}
+	for operation, samples := range r.samples {
+		report.Operations[operation] = stats(samples, duration)
+		all = append(all, samples...)
+	}
+	report.Total = stats(all, duration)
+	return report
+}
+
+// stats computes the statistics of the samples.
+func stats(samples []sample, duration time.Duration) *Stats {
+	s := &Stats{Operations: len(samples)}
+	if len(samples) == 0 {
+		return s
+	}
+
+	latencies := make([]time.Duration, 0, len(samples))
+	var total time.Duration
+	for _, sample := range samples {
+		if sample.err != nil {
+			s.Errors++
+			if s.FirstError == nil {
+				s.FirstError = sample.err
+			}
+		}
+		latencies = append(latencies, sample.latency)
+		total += sample.latency
+	}
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+
+	s.Throughput = float64(len(samples)) / duration.Seconds()
+	s.Mean = total / time.Duration(len(samples))
+	s.P50 = percentile(latencies, 50)
+	s.P90 = percentile(latencies, 90)
+	s.P99 = percentile(latencies, 99)
+	s.Max = latencies[len(latencies)-1]
+	return s
+}
+
+// percentile returns the percentile of the sorted latencies (nearest rank).
+func percentile(latencies []time.Duration, p int) time.Duration {
+	rank := (p*len(latencies) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return latencies[rank-1]
+}
+
+// String formats the report as a table.
+func (r *Report) String() string {
+	builder := &strings.Builder{}
+	Compare(builder, r)
+	return builder.String()
+}
+
+// Compare writes the reports as a single table, with a row for every operation of every report, so the backends
+// can be compared side by side.
+func Compare(out io.Writer, reports ...*Report) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "workload\toperation\tops\terrors\tops/s\tmean\tp50\tp90\tp99\tmax\t")
+	for _, report := range reports {
+		operations := []Operation{}
+		for operation := range report.Operations {
+			operations = append(operations, operation)
+		}
+		sort.Slice(operations, func(i, j int) bool {
+			return operations[i] < operations[j]
+		})
+		for _, operation := range operations {
+			writeStats(w, report.Name, string(operation), report.Operations[operation])
+		}
+		writeStats(w, report.Name, "total", report.Total)
+	}
+	w.Flush()
+}
+
+func writeStats(w io.Writer, name string, operation string, s *Stats) {
+	fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%.1f\t%v\t%v\t%v\t%v\t%v\t\n", name, operation, s.Operations, s.Errors, s.Throughput,
+		round(s.Mean), round(s.P50), round(s.P90), round(s.P99), round(s.Max))
+}
+
+// round rounds the latency for display.
+func round(d time.Duration) time.Duration {
+	if d > time.Millisecond {
+		return d.Round(10 * time.Microsecond)
+	}
+	return d.Round(time.Microsecond)
+}
@@ -0,0 +1,72 @@
+package backendsbench
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JormungandrK/backends"
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func TestRun(t *testing.T) {
+	backend, err := backends.CacheBackendBuilder(&config.DBInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Shutdown()
+
+	report, err := Run(backend, &Workload{
+		Name:        "cache",
+		Prefill:     50,
+		Mix:         map[Operation]int{OpGetOne: 4, OpGetPage: 1, OpCount: 1, OpSave: 2, OpUpdate: 1, OpDelete: 1},
+		Concurrency: 4,
+		Duration:    time.Minute,
+		Operations:  500,
+		Seed:        42,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Total.Operations != 500 {
+		t.Fatal("Expected the run to stop after 500 operations. Got: ", report.Total.Operations)
+	}
+	if report.Total.Errors != 0 {
+		t.Fatal("Expected no errors. Got: ", report.Total.FirstError)
+	}
+	if len(report.Operations) != 6 || report.Operations[OpGetOne].Operations <= report.Operations[OpDelete].Operations {
+		t.Fatal("Expected all operations, by their weights. Got: ", report.Operations)
+	}
+	for operation, stats := range report.Operations {
+		if stats.P50 > stats.P90 || stats.P90 > stats.P99 || stats.P99 > stats.Max || stats.Throughput <= 0 {
+			t.Fatal("Invalid stats of ", operation, ": ", stats)
+		}
+	}
+
+	table := report.String()
+	if !strings.Contains(table, "p99") || !strings.Contains(table, "getPage") || !strings.Contains(table, "total") {
+		t.Fatal("Invalid report: ", table)
+	}
+
+	repo, err := backend.GetRepository("backendsbench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, err := repo.Count(nil); err != nil || count != 0 {
+		t.Fatal("Expected the records to be deleted after the run. Got: ", count, err)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	latencies := []time.Duration{}
+	for i := 1; i <= 100; i++ {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	if percentile(latencies, 50) != 50*time.Millisecond || percentile(latencies, 99) != 99*time.Millisecond {
+		t.Fatal("Invalid percentiles")
+	}
+	if percentile(latencies[:1], 99) != time.Millisecond {
+		t.Fatal("Expected the only latency")
+	}
+}
@@ -0,0 +1,114 @@
+// Package backendstest has the test suites for the implementations of the extension points of the backends package,
+// so the backends outside of the package can verify that they behave like the built-in ones.
+//
+// RunTranslatorConformance checks that a QueryTranslator gives the filters the same meaning as the built-in
+// translators. The query of the translator is evaluated on the records of the suite by an evaluator written for the
+// query language of the backend:
+//
+//	func TestMyTranslatorConformance(t *testing.T) {
+//		backendstest.RunTranslatorConformance(t, &MyTranslator{}, func(query interface{}, record map[string]interface{}) (bool, error) {
+//			return evalMyQuery(query.(*MyQuery), record)
+//		}, map[string]string{
+//			"regex": "my backend does not support regular expressions",
+//		})
+//	}
+package backendstest
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/JormungandrK/backends"
+)
+
+// ConformanceRecords are the records of the translator conformance suite, as JSON, so they are decoded like the
+// records that the backends read. The nickname of record 1 is null, and the name of record 4 has a regular expression
+// metacharacter.
+const ConformanceRecords = `[
+	{"id": "1", "name": "John", "age": 30, "email": "john@example.com", "nickname": null},
+	{"id": "2", "name": "Johnny", "age": 25, "nickname": "jj"},
+	{"id": "3", "name": "Ann", "age": 41, "email": "ann@example.com"},
+	{"id": "4", "name": "Jo.n", "age": 30.5}
+]`
+
+// ConformanceCase is a filter of the conformance suite, with the ids of the records of ConformanceRecords it matches.
+type ConformanceCase struct {
+	// Name identifies the case, for example to skip it.
+	Name    string
+	Filter  backends.Filter
+	Matches []string
+}
+
+// ConformanceCases are the filters of the translator conformance suite.
+var ConformanceCases = []ConformanceCase{
+	{Name: "match-string", Filter: backends.NewFilter().Match("name", "John"), Matches: []string{"1"}},
+	{Name: "match-number", Filter: backends.NewFilter().Match("age", 30), Matches: []string{"1"}},
+	{Name: "pattern-prefix", Filter: backends.NewFilter().MatchPattern("name", "John%"), Matches: []string{"1", "2"}},
+	{Name: "pattern-contains", Filter: backends.NewFilter().MatchPattern("name", "%oh%"), Matches: []string{"1", "2"}},
+	{Name: "pattern-literal", Filter: backends.NewFilter().MatchPattern("name", "Jo.n"), Matches: []string{"4"}},
+	{Name: "pattern-suffix", Filter: backends.NewFilter().MatchPattern("name", "%nn"), Matches: []string{"3"}},
+	{Name: "regex", Filter: backends.NewFilter().MatchRegex("name", "^Jo.n$"), Matches: []string{"1", "4"}},
+	{Name: "ne", Filter: backends.Filter{"name": map[string]interface{}{backends.OpNe: "John"}}, Matches: []string{"2", "3", "4"}},
+	{Name: "ne-missing", Filter: backends.Filter{"email": map[string]interface{}{backends.OpNe: "ann@example.com"}}, Matches: []string{"1", "2", "4"}},
+	{Name: "gt-number", Filter: backends.NewFilter().MatchGt("age", 30), Matches: []string{"3", "4"}},
+	{Name: "gte-number", Filter: backends.NewFilter().MatchGte("age", 30), Matches: []string{"1", "3", "4"}},
+	{Name: "lt-number", Filter: backends.NewFilter().MatchLt("age", 30), Matches: []string{"2"}},
+	{Name: "lte-number", Filter: backends.NewFilter().MatchLte("age", 30), Matches: []string{"1", "2"}},
+	{Name: "range-number", Filter: backends.NewFilter().MatchGte("age", 25).MatchLt("age", 41), Matches: []string{"1", "2", "4"}},
+	{Name: "gt-string", Filter: backends.NewFilter().MatchGt("name", "B"), Matches: []string{"1", "2", "4"}},
+	{Name: "lt-missing", Filter: backends.NewFilter().MatchLt("email", "b"), Matches: []string{"3"}},
+	{Name: "in", Filter: backends.NewFilter().MatchIn("name", []string{"John", "Ann"}), Matches: []string{"1", "3"}},
+	{Name: "nin-missing", Filter: backends.NewFilter().MatchNotIn("email", []string{"john@example.com"}), Matches: []string{"2", "3", "4"}},
+	{Name: "exists", Filter: backends.NewFilter().MatchExists("email", true), Matches: []string{"1", "3"}},
+	{Name: "not-exists", Filter: backends.NewFilter().MatchExists("email", false), Matches: []string{"2", "4"}},
+	{Name: "exists-null", Filter: backends.NewFilter().MatchExists("nickname", true), Matches: []string{"1", "2"}},
+	{Name: "not-exists-null", Filter: backends.NewFilter().MatchExists("nickname", false), Matches: []string{"3", "4"}},
+	{Name: "null", Filter: backends.NewFilter().MatchNull("nickname", true), Matches: []string{"1"}},
+	{Name: "not-null", Filter: backends.NewFilter().MatchNull("nickname", false), Matches: []string{"2"}},
+	{Name: "not-null-missing", Filter: backends.NewFilter().MatchNull("email", false), Matches: []string{"1", "3"}},
+	{Name: "pattern-and-range", Filter: backends.NewFilter().MatchPattern("name", "Jo%").MatchLte("age", 30), Matches: []string{"1", "2"}},
+	{Name: "empty", Filter: backends.NewFilter(), Matches: []string{"1", "2", "3", "4"}},
+}
+
+// QueryEvaluator evaluates the query of a translator on a record, with the semantics of the query language of the
+// backend.
+type QueryEvaluator func(query interface{}, record map[string]interface{}) (bool, error)
+
+// RunTranslatorConformance translates every filter of ConformanceCases with the translator, and checks that the
+// query matches the expected records of ConformanceRecords when it is evaluated with eval. Each case runs as a
+// subtest named after the case. The cases the backend can't express exactly are skipped with the reason in skip,
+// by the name of the case.
+func RunTranslatorConformance(t *testing.T, translator backends.QueryTranslator, eval QueryEvaluator, skip map[string]string) {
+	records := []map[string]interface{}{}
+	if err := json.Unmarshal([]byte(ConformanceRecords), &records); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range ConformanceCases {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			if reason, ok := skip[c.Name]; ok {
+				t.Skip(reason)
+			}
+			translated, err := backends.TranslateFilter(c.Filter, translator)
+			if err != nil {
+				t.Fatalf("failed to translate %v: %s", c.Filter, err)
+			}
+			matches := []string{}
+			for _, record := range records {
+				ok, err := eval(translated, record)
+				if err != nil {
+					t.Fatalf("failed to evaluate the query of %v: %s", c.Filter, err)
+				}
+				if ok {
+					matches = append(matches, fmt.Sprint(record["id"]))
+				}
+			}
+			if !reflect.DeepEqual(matches, c.Matches) {
+				t.Errorf("matched %v with %v, expected %v", matches, c.Filter, c.Matches)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package backends
+
+import "fmt"
+
+// BatchGetRepository is implemented by the repositories that fetch many records by their ids with a single request:
+// MongoDB ($in on the ids) and DynamoDB (BatchGetItem).
+type BatchGetRepository interface {
+	GetManyByIDs(ids []string, resultsTypeHint interface{}) (interface{}, error)
+}
+
+// GetManyByIDs fetches the records with the given ids, in the order of the ids. The ids that have no record are
+// skipped, and the duplicated ids are returned once. Use it instead of calling GetOne for every id, for example to
+// fetch the authors of a page of articles:
+//
+//	results, err := backends.GetManyByIDs(userRepo, authorIDs, &User{})
+//	authors := *results.(*[]*User)
+//
+// If the repository implements BatchGetRepository, the records are fetched by the backend. Otherwise they are
+// fetched one by one with GetOne.
+func GetManyByIDs(repo Repository, ids []string, resultsTypeHint interface{}) (interface{}, error) {
+	if resultsTypeHint == nil {
+		resultsTypeHint = &map[string]interface{}{}
+	}
+	var batchRepo BatchGetRepository
+	if AsRepository(repo, &batchRepo) {
+		return batchRepo.GetManyByIDs(ids, resultsTypeHint)
+	}
+
+	records := []map[string]interface{}{}
+	for _, id := range uniqueIDs(ids) {
+		record := map[string]interface{}{}
+		if _, err := repo.GetOne(NewFilter().Match("id", id), &record); err != nil {
+			if IsErrNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return recordsToResults(records, resultsTypeHint)
+}
+
+// uniqueIDs returns the ids without the duplicates, in the same order.
+func uniqueIDs(ids []string) []string {
+	seen := map[string]bool{}
+	unique := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// orderedRecords returns the records in the order of the ids. The records are matched with the ids by their id
+// property, so the ids must be unique.
+func orderedRecords(ids []string, records []map[string]interface{}, idProperty string) []map[string]interface{} {
+	byID := map[string]map[string]interface{}{}
+	for _, record := range records {
+		byID[fmt.Sprint(record[idProperty])] = record
+	}
+	ordered := make([]map[string]interface{}, 0, len(records))
+	for _, id := range ids {
+		if record, ok := byID[id]; ok {
+			ordered = append(ordered, record)
+		}
+	}
+	return ordered
+}
@@ -0,0 +1,40 @@
+package backends
+
+import (
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func TestGetManyByIDs(t *testing.T) {
+	backend, err := CacheBackendBuilder(&config.DBInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Shutdown()
+
+	repo, err := backend.DefineRepository("users", RepositoryDefinitionMap{"name": "users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.SaveAll([]map[string]interface{}{{"id": "1", "name": "John"}, {"id": "2", "name": "Jane"}, {"id": "3", "name": "Jim"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := GetManyByIDs(repo, []string{"3", "missing", "1", "3"}, &testAddress{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := *results.(*[]*testAddress)
+	if len(users) != 2 || users[0].ID != "3" || users[1].ID != "1" {
+		t.Fatal("Expected the users in the order of the ids, without the missing and the duplicated. Got: ", users)
+	}
+
+	results, err = GetManyByIDs(repo, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if users := *results.(*[]*map[string]interface{}); len(users) != 0 {
+		t.Fatal("Expected no users. Got: ", users)
+	}
+}
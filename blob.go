@@ -0,0 +1,79 @@
+package backends
+
+import (
+	"io"
+	"strings"
+	"time"
+)
+
+// BlobInfo describes a blob stored in a BlobRepository.
+type BlobInfo struct {
+	// Name is the name of the blob, unique in the repository.
+	Name string
+	// Size is the size of the content in bytes.
+	Size int64
+	// ContentType is the MIME type of the content, "application/octet-stream" if it was not set.
+	ContentType string
+	// Metadata are the custom properties of the blob. The keys are lower case.
+	Metadata map[string]string
+	// UpdatedAt is the time the blob was last stored.
+	UpdatedAt time.Time
+}
+
+// BlobRepository stores binary content (avatars, attachments, exports) by name, streaming it both ways so the
+// content is never held in memory as a whole:
+//
+//	info, err := avatars.Put(userID, file, "image/png", map[string]string{"uploadedBy": userID})
+//	...
+//	content, info, err := avatars.Get(userID)
+//	if err != nil {
+//		return err
+//	}
+//	defer content.Close()
+//	w.Header().Set("Content-Type", info.ContentType)
+//	io.Copy(w, content)
+//
+// Put replaces the blob with the same name, and the readers that already have its content keep reading the old one.
+// Get, Stat and Delete return ErrNotFound if there is no blob with the name.
+type BlobRepository interface {
+	Put(name string, content io.Reader, contentType string, metadata map[string]string) (*BlobInfo, error)
+	Get(name string) (io.ReadCloser, *BlobInfo, error)
+	Stat(name string) (*BlobInfo, error)
+	Delete(name string) error
+}
+
+// BlobBackend is implemented by the backends that store blobs (MongoDB in GridFS, S3 in the bucket of the backend).
+// The blob repositories are separate from the record repositories with the same name:
+//
+//	blobBackend, ok := backend.(backends.BlobBackend)
+//	if !ok {
+//		return errors.New("blobs are not supported")
+//	}
+//	avatars, err := blobBackend.GetBlobRepository("avatars")
+type BlobBackend interface {
+	Backend
+	GetBlobRepository(name string) (BlobRepository, error)
+}
+
+// blobContentType is the content type of the blobs stored without one.
+const blobContentType = "application/octet-stream"
+
+// blobMetadata returns the metadata with lower case keys, or nil if it is empty.
+func blobMetadata(metadata map[string]string) map[string]string {
+	if len(metadata) == 0 {
+		return nil
+	}
+	result := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		result[strings.ToLower(key)] = value
+	}
+	return result
+}
+
+// validateBlobName checks that the blob name is not empty.
+func validateBlobName(name string) error {
+	if name == "" {
+		return ErrInvalidInput("blob name must not be empty")
+	}
+	return nil
+}
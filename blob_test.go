@@ -0,0 +1,16 @@
+package backends
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBlobMetadata(t *testing.T) {
+	if metadata := blobMetadata(map[string]string{}); metadata != nil {
+		t.Fatal("Expected nil for empty metadata. Got: ", metadata)
+	}
+	metadata := blobMetadata(map[string]string{"Uploaded-By": "user-1", "size": "large"})
+	if !reflect.DeepEqual(metadata, map[string]string{"uploaded-by": "user-1", "size": "large"}) {
+		t.Fatal("Expected lower case keys. Got: ", metadata)
+	}
+}
@@ -0,0 +1,180 @@
+package backends
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BulkWrite is a single write of WriteRecords. It creates the Insert object as a new record, or sets the properties
+// of the Update object on all records matched by the Filter (like Repository.UpdateAll), or deletes all records
+// matched by the Filter if Delete is set (like Repository.DeleteAll). Exactly one of Insert, Update and Delete must
+// be set. A nil Filter matches all records.
+type BulkWrite struct {
+	Insert interface{}
+	Filter Filter
+	Update interface{}
+	Delete bool
+}
+
+// BulkResult is the result of WriteRecords.
+type BulkResult struct {
+	// Records has an entry for every write, in the order of the writes. The entry of an insert is the created record,
+	// with its id, and the entry of an update or a delete is nil.
+	Records []interface{}
+	// Updated is the number of the records modified by the updates.
+	Updated int64
+}
+
+// BulkWriteError is returned by WriteRecords when some of the writes fail. Errors has an entry for every write, in
+// the order of the writes. The entry is nil if the write succeeded. In the ordered mode the writes after the failed
+// one are not run, and their entries are a "not written" error, so the writes with a non-nil entry are the ones to
+// retry.
+type BulkWriteError struct {
+	Errors []error
+}
+
+// errBulkNotWritten is the error of the writes that were not run because an earlier write of an ordered bulk write
+// failed.
+var errBulkNotWritten = ErrBackendError("not written, an earlier write failed")
+
+// Error returns the messages of the errors of the failed writes, and the number of the writes that were not run.
+func (e *BulkWriteError) Error() string {
+	messages := []string{}
+	notWritten := 0
+	for i, err := range e.Errors {
+		if err == errBulkNotWritten {
+			notWritten++
+		} else if err != nil {
+			messages = append(messages, fmt.Sprintf("#%d: %s", i, err.Error()))
+		}
+	}
+	message := fmt.Sprintf("%d of %d bulk writes failed: %s", len(messages), len(e.Errors), strings.Join(messages, "; "))
+	if notWritten > 0 {
+		message += fmt.Sprintf(", %d not written", notWritten)
+	}
+	return message
+}
+
+// firstBulkError returns the error of the first failed write if err is a *BulkWriteError, otherwise err itself. Used
+// by the methods of Repository that run a bulk write, so they return the same errors as before.
+func firstBulkError(err error) error {
+	bulkErr, ok := err.(*BulkWriteError)
+	if !ok {
+		return err
+	}
+	for _, err := range bulkErr.Errors {
+		if err != nil && err != errBulkNotWritten {
+			return err
+		}
+	}
+	return bulkErr
+}
+
+// BulkWriter is implemented by the repositories that run many writes with a single bulk write (MongoDB).
+type BulkWriter interface {
+	// WriteAll runs the writes. In the ordered mode the writes run in order and stop at the first failure, in the
+	// unordered mode all writes are attempted. See WriteRecords.
+	WriteAll(writes []BulkWrite, ordered bool) (*BulkResult, error)
+}
+
+// bulkOptions holds the options of WriteRecords.
+type bulkOptions struct {
+	unordered bool
+}
+
+// BulkOption configures WriteRecords.
+type BulkOption func(o *bulkOptions)
+
+// Unordered makes WriteRecords attempt all writes, even when some of them fail, instead of stopping at the first
+// failure. The writes may run in any order, so they should not depend on each other.
+func Unordered() BulkOption {
+	return func(o *bulkOptions) {
+		o.unordered = true
+	}
+}
+
+// WriteRecords runs the inserts, the updates and the deletes. The repositories that implement BulkWriter run them
+// with a single bulk write, instead of a command per write; the other repositories run them one by one:
+//
+//	result, err := backends.WriteRecords(eventRepo, []backends.BulkWrite{
+//		{Insert: &Event{Type: "created", OrderID: orderID}},
+//		{Filter: backends.NewFilter().Match("id", orderID), Update: map[string]interface{}{"status": "created"}},
+//		{Filter: backends.NewFilter().Match("orderId", draftID), Delete: true},
+//	}, backends.Unordered())
+//
+// The writes run in order and stop at the first failure, unless the Unordered option is given. The bulk write is not
+// atomic: if some writes fail, *BulkWriteError reports the error of each write, and the result holds the records
+// created by the inserts that succeeded (Updated is not known, so it is 0).
+func WriteRecords(repo Repository, writes []BulkWrite, opts ...BulkOption) (*BulkResult, error) {
+	options := &bulkOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if err := validateBulkWrites(writes); err != nil {
+		return nil, err
+	}
+	var bulkWriter BulkWriter
+	if AsRepository(repo, &bulkWriter) {
+		return bulkWriter.WriteAll(writes, !options.unordered)
+	}
+	return writeEach(repo, writes, !options.unordered)
+}
+
+// validateBulkWrites checks that every write is exactly one of an insert, an update and a delete.
+func validateBulkWrites(writes []BulkWrite) error {
+	for i, write := range writes {
+		kinds := 0
+		if write.Insert != nil {
+			kinds++
+		}
+		if write.Update != nil {
+			kinds++
+		}
+		if write.Delete {
+			kinds++
+		}
+		if kinds != 1 {
+			return ErrInvalidInput(fmt.Sprintf("write %d must be exactly one of an insert, an update and a delete", i))
+		}
+		if write.Insert != nil && write.Filter != nil {
+			return ErrInvalidInput(fmt.Sprintf("insert %d can't have a filter", i))
+		}
+	}
+	return nil
+}
+
+// writeEach runs the writes one by one, with the methods of the repository. Used for the repositories that do not
+// implement BulkWriter.
+func writeEach(repo Repository, writes []BulkWrite, ordered bool) (*BulkResult, error) {
+	result := &BulkResult{Records: make([]interface{}, len(writes))}
+	errs := make([]error, len(writes))
+	failed := false
+	for i, write := range writes {
+		if failed && ordered {
+			errs[i] = errBulkNotWritten
+			continue
+		}
+		var err error
+		switch {
+		case write.Insert != nil:
+			result.Records[i], err = repo.Save(write.Insert, nil)
+		case write.Delete:
+			err = repo.DeleteAll(write.Filter)
+		default:
+			var updated int64
+			updated, err = repo.UpdateAll(write.Filter, write.Update)
+			result.Updated += updated
+		}
+		if err != nil {
+			errs[i] = err
+			failed = true
+		}
+	}
+
+	if failed {
+		result.Updated = 0
+		return result, &BulkWriteError{Errors: errs}
+	}
+	return result, nil
+}
@@ -0,0 +1,127 @@
+package backends
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+type duplicateRepository struct {
+	Repository
+	duplicate string
+}
+
+func (r *duplicateRepository) Save(object interface{}, filter Filter) (interface{}, error) {
+	if (*object.(*map[string]interface{}))["id"] == r.duplicate {
+		return nil, ErrAlreadyExists("record already exists!")
+	}
+	return r.Repository.Save(object, filter)
+}
+
+type bulkWritingRepository struct {
+	Repository
+	ordered bool
+}
+
+func (r *bulkWritingRepository) WriteAll(writes []BulkWrite, ordered bool) (*BulkResult, error) {
+	r.ordered = ordered
+	return &BulkResult{Records: make([]interface{}, len(writes))}, nil
+}
+
+func TestWriteRecords(t *testing.T) {
+	backend, err := CacheBackendBuilder(&config.DBInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Shutdown()
+
+	repo, err := backend.DefineRepository("events", RepositoryDefinitionMap{"name": "events"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Save(&map[string]interface{}{"id": "1", "status": "new"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := WriteRecords(repo, []BulkWrite{
+		{Insert: &map[string]interface{}{"id": "2", "status": "new"}},
+		{Filter: NewFilter().Match("id", "1"), Update: &map[string]interface{}{"status": "sent"}},
+		{Filter: NewFilter().Match("id", "2"), Delete: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Records) != 3 || result.Records[0] == nil || result.Records[1] != nil || result.Updated != 1 {
+		t.Fatal("Expected the created record and the updated count. Got: ", result)
+	}
+	sent, err := repo.GetOne(NewFilter().Match("id", "1"), &map[string]interface{}{})
+	if err != nil || (*sent.(*map[string]interface{}))["status"] != "sent" {
+		t.Fatal("Expected the record to be updated. Got: ", sent, err)
+	}
+	if _, err := repo.GetOne(NewFilter().Match("id", "2"), &map[string]interface{}{}); !IsErrNotFound(err) {
+		t.Fatal("Expected the inserted record to be deleted. Got: ", err)
+	}
+
+	failing := &duplicateRepository{Repository: repo, duplicate: "3"}
+	writes := func() []BulkWrite {
+		return []BulkWrite{
+			{Insert: &map[string]interface{}{"id": "3"}},
+			{Insert: &map[string]interface{}{"id": "4"}},
+		}
+	}
+	result, err = WriteRecords(failing, writes())
+	bulkErr, ok := err.(*BulkWriteError)
+	if !ok || !IsErrAlreadyExists(bulkErr.Errors[0]) || bulkErr.Errors[1] != errBulkNotWritten {
+		t.Fatal("Expected the ordered writes to stop at the failure. Got: ", err)
+	}
+	if result.Records[1] != nil {
+		t.Fatal("Expected no record of the write that was not run. Got: ", result.Records)
+	}
+	if !strings.Contains(err.Error(), "1 of 2 bulk writes failed") || !strings.Contains(err.Error(), "1 not written") {
+		t.Fatal("Unexpected error message: ", err.Error())
+	}
+
+	result, err = WriteRecords(failing, writes(), Unordered())
+	bulkErr, ok = err.(*BulkWriteError)
+	if !ok || !IsErrAlreadyExists(bulkErr.Errors[0]) || bulkErr.Errors[1] != nil || result.Records[1] == nil {
+		t.Fatal("Expected the unordered writes to continue after the failure. Got: ", result, err)
+	}
+
+	bulkWriting := &bulkWritingRepository{Repository: repo}
+	if _, err := WriteRecords(bulkWriting, writes(), Unordered()); err != nil || bulkWriting.ordered {
+		t.Fatal("Expected the unordered bulk write of the repository. Got: ", err)
+	}
+}
+
+func TestValidateBulkWrites(t *testing.T) {
+	if err := validateBulkWrites([]BulkWrite{
+		{Insert: map[string]interface{}{"id": "1"}},
+		{Update: map[string]interface{}{"status": "sent"}},
+		{Filter: NewFilter().Match("id", "1"), Delete: true},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for _, write := range []BulkWrite{
+		{},
+		{Filter: NewFilter().Match("id", "1")},
+		{Insert: map[string]interface{}{"id": "1"}, Delete: true},
+		{Update: map[string]interface{}{"status": "sent"}, Delete: true},
+		{Insert: map[string]interface{}{"id": "1"}, Filter: NewFilter().Match("id", "1")},
+	} {
+		if err := validateBulkWrites([]BulkWrite{write}); !IsErrInvalidInput(err) {
+			t.Fatal("Expected ErrInvalidInput for the write ", write)
+		}
+	}
+}
+
+func TestFirstBulkError(t *testing.T) {
+	notFound := ErrNotFound("missing")
+	err := firstBulkError(&BulkWriteError{Errors: []error{nil, notFound, errBulkNotWritten}})
+	if err != notFound {
+		t.Fatal("Expected the error of the first failed write. Got: ", err)
+	}
+	if err := firstBulkError(notFound); err != notFound {
+		t.Fatal("Expected the error itself. Got: ", err)
+	}
+}
@@ -0,0 +1,547 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+	"github.com/allegro/bigcache/v3"
+	"github.com/satori/go.uuid"
+)
+
+// CACHE_CTX_KEY is cache context key
+var CACHE_CTX_KEY = "CACHE_REGISTRY"
+
+// cacheNoExpiry is the life window of the repositories without TTL.
+const cacheNoExpiry = 100 * 365 * 24 * time.Hour
+
+// CacheSizeDefinition is implemented by the repository definitions that limit the memory used by a cache repository.
+// RepositoryDefinitionMap implements it with the "maxSizeMB" property.
+type CacheSizeDefinition interface {
+	GetMaxSizeMB() int
+}
+
+// GetMaxSizeMB returns the maximal size of the cache repository in MB. 0 means unlimited.
+func (m RepositoryDefinitionMap) GetMaxSizeMB() int {
+	if size, ok := m["maxSizeMB"]; ok {
+		return size.(int)
+	}
+
+	return 0
+}
+
+// CacheCollection is a process-local repository stored in a bigcache instance.
+// Every record is stored under its hash key value ("id" if the hash key is not set), encoded with the codec
+// of the repository (JSON by default, see Codec).
+// The records are not persisted and may be evicted at any time: after the TTL of the repository
+// expires, or when the repository reaches its maximal size (the oldest records are evicted first).
+// The records are filtered in memory, unless the filter has an exact match on the key property.
+// The keys are hashed by bigcache, so in the (unlikely) case of a hash collision a record replaces the other one.
+type CacheCollection struct {
+	cache   *bigcache.BigCache
+	ttl     time.Duration
+	codec   Codec
+	repoDef RepositoryDefinition
+	mutex   *sync.Mutex
+}
+
+// cacheRegistry holds the caches of a backend, so they can be closed on shutdown.
+type cacheRegistry struct {
+	caches []*bigcache.BigCache
+	mutex  *sync.Mutex
+}
+
+// CacheRepoBuilder builds new cache repository.
+func CacheRepoBuilder(repoDef RepositoryDefinition, backend Backend) (Repository, error) {
+
+	registryObj := backend.GetFromContext(CACHE_CTX_KEY)
+	if registryObj == nil {
+		return nil, ErrBackendError("cache registry not configured")
+	}
+
+	registry, ok := registryObj.(*cacheRegistry)
+	if !ok {
+		return nil, ErrBackendError("unknown registry type")
+	}
+
+	if repoDef.GetName() == "" {
+		return nil, ErrBackendError("repository name is missing and required")
+	}
+
+	cacheConfig := bigcache.Config{
+		Shards:             64,
+		LifeWindow:         cacheNoExpiry,
+		MaxEntriesInWindow: 64 * 64,
+		MaxEntrySize:       512,
+	}
+
+	var ttl time.Duration
+	if repoDef.EnableTTL() {
+		if repoDef.GetTTL() <= 0 {
+			return nil, ErrInvalidInput("TTL must be positive")
+		}
+		ttl = time.Duration(repoDef.GetTTL()) * time.Second
+		cacheConfig.LifeWindow = ttl
+		cacheConfig.CleanWindow = time.Second
+	}
+
+	codec, err := codecFor(repoDef)
+	if err != nil {
+		return nil, err
+	}
+
+	if sizeDef, ok := repoDef.(CacheSizeDefinition); ok {
+		cacheConfig.HardMaxCacheSize = sizeDef.GetMaxSizeMB()
+	}
+
+	cache, err := bigcache.New(context.Background(), cacheConfig)
+	if err != nil {
+		return nil, ErrBackendError(err)
+	}
+
+	registry.mutex.Lock()
+	registry.caches = append(registry.caches, cache)
+	registry.mutex.Unlock()
+
+	return &CacheCollection{
+		cache:   cache,
+		ttl:     ttl,
+		codec:   codec,
+		repoDef: repoDef,
+		mutex:   &sync.Mutex{},
+	}, nil
+}
+
+// CacheBackendBuilder returns RepositoriesBackend with process-local repositories.
+// It needs no connection properties. The repositories can be used as ephemeral repositories
+// (for example for sessions or one-time tokens), or as a local cache of the data stored in another backend.
+func CacheBackendBuilder(conf *config.DBInfo, manager BackendManager) (Backend, error) {
+
+	registry := &cacheRegistry{
+		caches: []*bigcache.BigCache{},
+		mutex:  &sync.Mutex{},
+	}
+
+	ctx := context.WithValue(context.Background(), CACHE_CTX_KEY, registry)
+	cleanup := func() {
+		registry.mutex.Lock()
+		defer registry.mutex.Unlock()
+		for _, cache := range registry.caches {
+			cache.Close()
+		}
+		registry.caches = nil
+	}
+
+	return NewRepositoriesBackend(ctx, conf, CacheRepoBuilder, cleanup), nil
+}
+
+// GetOne fetches only one record for given filter
+func (c *CacheCollection) GetOne(filter Filter, result interface{}) (interface{}, error) {
+	records, err := c.find(filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrNotFound("record not found")
+	}
+
+	record := records[0]
+	err = MapToInterface(&record, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetAll fetches all matched records for given filter
+func (c *CacheCollection) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	records, err := c.find(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err = filterRecords(records, nil, order, sorting, limit, offset)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+
+	return recordsToResults(records, resultsTypeHint)
+}
+
+// Count returns the number of records that match the filter.
+func (c *CacheCollection) Count(filter Filter) (int64, error) {
+	records, err := c.find(filter)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(records)), nil
+}
+
+// Exists reports whether a record matches the filter.
+func (c *CacheCollection) Exists(filter Filter) (bool, error) {
+	records, err := c.find(filter)
+	if err != nil {
+		return false, err
+	}
+	return len(records) > 0, nil
+}
+
+// Save creates new record unless it does not exist, otherwise it updates the record
+func (c *CacheCollection) Save(object interface{}, filter Filter) (interface{}, error) {
+
+	var result interface{}
+
+	payload, err := InterfaceToMap(object)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	keyProperty := c.keyProperty()
+	record := map[string]interface{}{}
+
+	if filter == nil {
+		for k, v := range *payload {
+			record[k] = v
+		}
+		if id, ok := record[keyProperty]; !ok || id == nil || id == "" {
+			id, err := uuid.NewV4()
+			if err != nil {
+				return nil, err
+			}
+			record[keyProperty] = id.String()
+		}
+
+		existing, err := c.get(c.key(record[keyProperty]))
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			return nil, ErrAlreadyExists("record already exists!")
+		}
+	} else {
+		records, err := c.find(filter)
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == 0 {
+			return nil, ErrNotFound("record not found")
+		}
+
+		record = records[0]
+		for k, v := range *payload {
+			if k == keyProperty {
+				// the key is immutable
+				continue
+			}
+			record[k] = v
+		}
+	}
+
+	if err := c.set(record); err != nil {
+		return nil, err
+	}
+
+	err = MapToInterface(&record, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Patch sets the properties of set and removes the unset fields of the first matched record. See Patch.
+func (c *CacheCollection) Patch(filter Filter, set interface{}, unset []string) (interface{}, error) {
+	var result interface{}
+
+	payload, err := InterfaceToMap(set)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	records, err := c.find(filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrNotFound("record not found")
+	}
+
+	keyProperty := c.keyProperty()
+	record := records[0]
+	for k, v := range *payload {
+		if k == keyProperty {
+			// the key is immutable
+			continue
+		}
+		record[k] = v
+	}
+	for _, field := range unset {
+		if field != keyProperty {
+			removeRecordPath(record, field)
+		}
+	}
+
+	if err := c.set(record); err != nil {
+		return nil, err
+	}
+
+	err = MapToInterface(&record, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SaveAll creates the objects (a slice) as new records. Returns the created records, as returned by Save.
+// Nothing is created if any of the records already exists.
+func (c *CacheCollection) SaveAll(objects interface{}) (interface{}, error) {
+	records, err := objectsToRecords(objects)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	keyProperty := c.keyProperty()
+	keys := map[string]bool{}
+	for _, record := range records {
+		if id, ok := record[keyProperty]; !ok || id == nil || id == "" {
+			id, err := uuid.NewV4()
+			if err != nil {
+				return nil, err
+			}
+			record[keyProperty] = id.String()
+		}
+
+		key := c.key(record[keyProperty])
+		existing, err := c.get(key)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil || keys[key] {
+			return nil, ErrAlreadyExists("record already exists!")
+		}
+		keys[key] = true
+	}
+
+	saved := []interface{}{}
+	for _, record := range records {
+		if err := c.set(record); err != nil {
+			return saved, err
+		}
+		var result interface{}
+		if err := MapToInterface(&record, &result); err != nil {
+			return saved, err
+		}
+		saved = append(saved, result)
+	}
+	return saved, nil
+}
+
+// UpdateAll updates all matched records for given filter with the properties of the update.
+// Returns the number of the updated records.
+func (c *CacheCollection) UpdateAll(filter Filter, update interface{}) (int64, error) {
+	payload, err := InterfaceToMap(update)
+	if err != nil {
+		return 0, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	records, err := c.find(filter)
+	if err != nil {
+		return 0, err
+	}
+
+	keyProperty := c.keyProperty()
+	var updated int64
+	for _, record := range records {
+		for k, v := range *payload {
+			if k == keyProperty {
+				// the key is immutable
+				continue
+			}
+			record[k] = v
+		}
+		if err := c.set(record); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+	return updated, nil
+}
+
+// set encodes and stores the record under its key.
+func (c *CacheCollection) set(record map[string]interface{}) error {
+	value, err := c.codec.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := c.cache.Set(c.key(record[c.keyProperty()]), value); err != nil {
+		return ErrBackendError(err)
+	}
+	return nil
+}
+
+// DeleteOne deletes only one record for given filter
+func (c *CacheCollection) DeleteOne(filter Filter) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	records, err := c.find(filter)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return ErrNotFound("record not found")
+	}
+
+	return c.delete(records[0])
+}
+
+// DeleteAll deletes all matched records for given filter
+func (c *CacheCollection) DeleteAll(filter Filter) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(filter) == 0 {
+		return c.cache.Reset()
+	}
+
+	records, err := c.find(filter)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if err := c.delete(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stats returns the number of the records and their encoded size. The expired records are not counted.
+func (c *CacheCollection) Stats() (*RepositoryStats, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stats := &RepositoryStats{}
+	iterator := c.cache.Iterator()
+	for iterator.SetNext() {
+		entry, err := iterator.Value()
+		if err != nil {
+			// the entry was removed while iterating
+			continue
+		}
+		if c.expired(entry.Timestamp()) {
+			continue
+		}
+		stats.Records++
+		stats.SizeBytes += int64(len(entry.Value()))
+	}
+	return stats, nil
+}
+
+// keyProperty returns the name of the property used as record key - the hash key if set, otherwise "id".
+func (c *CacheCollection) keyProperty() string {
+	if hashKey := c.repoDef.GetHashKey(); hashKey != "" {
+		return hashKey
+	}
+	return "id"
+}
+
+// key returns the cache key for the record with the given key value.
+func (c *CacheCollection) key(value interface{}) string {
+	return fmt.Sprintf("%v", value)
+}
+
+// delete removes the record from the cache. The record may have already been evicted.
+func (c *CacheCollection) delete(record map[string]interface{}) error {
+	err := c.cache.Delete(c.key(record[c.keyProperty()]))
+	if err != nil && err != bigcache.ErrEntryNotFound {
+		return ErrBackendError(err)
+	}
+	return nil
+}
+
+// expired returns true if the entry written at the timestamp (in seconds) is older than the TTL.
+// The expired entries are removed by bigcache periodically, so they may still be in the cache.
+func (c *CacheCollection) expired(timestamp uint64) bool {
+	if c.ttl == 0 {
+		return false
+	}
+	return time.Since(time.Unix(int64(timestamp), 0)) >= c.ttl
+}
+
+// get fetches and decodes the record stored under the key. Returns nil if there is no such record.
+func (c *CacheCollection) get(key string) (map[string]interface{}, error) {
+	data, response, err := c.cache.GetWithInfo(key)
+	if err == bigcache.ErrEntryNotFound || response.EntryStatus == bigcache.Expired {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, ErrBackendError(err)
+	}
+
+	record, err := c.codec.Unmarshal(data)
+	if err != nil {
+		return nil, ErrBackendError(err)
+	}
+	return record, nil
+}
+
+// find returns the records that match the filter.
+// If the filter has an exact match on the key property, only that record is fetched, otherwise
+// all records are iterated and matched in memory.
+func (c *CacheCollection) find(filter Filter) ([]map[string]interface{}, error) {
+	matcher, err := toRecordMatcher(filter)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+
+	records := []map[string]interface{}{}
+
+	if keyValue, ok := filter[c.keyProperty()]; ok && !isFilterSpec(keyValue) {
+		record, err := c.get(c.key(keyValue))
+		if err != nil {
+			return nil, err
+		}
+		if record != nil && matcher(record) {
+			records = append(records, record)
+		}
+		return records, nil
+	}
+
+	iterator := c.cache.Iterator()
+	for iterator.SetNext() {
+		entry, err := iterator.Value()
+		if err != nil {
+			// the entry was removed while iterating
+			continue
+		}
+		if c.expired(entry.Timestamp()) {
+			continue
+		}
+
+		record, err := c.codec.Unmarshal(entry.Value())
+		if err != nil {
+			return nil, ErrBackendError(err)
+		}
+		if matcher(record) {
+			records = append(records, record)
+		}
+	}
+
+	return records, nil
+}
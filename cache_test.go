@@ -0,0 +1,198 @@
+package backends
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func TestCacheRepository(t *testing.T) {
+	backend, err := CacheBackendBuilder(&config.DBInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Shutdown()
+
+	repo, err := backend.DefineRepository("sessions", RepositoryDefinitionMap{
+		"name":    "sessions",
+		"hashKey": "token",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, token := range []string{"a", "b", "c"} {
+		if _, err := repo.Save(&map[string]interface{}{"token": token, "user": "user-" + token, "admin": token == "b"}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = repo.Save(&map[string]interface{}{"token": "a"}, nil)
+	if err == nil || err.Error() != "already exists" {
+		t.Fatal("Expected already exists error, got", err)
+	}
+
+	created, err := repo.Save(&map[string]interface{}{"user": "user-d"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token, _ := created.(map[string]interface{})["token"].(string); token == "" {
+		t.Fatal("Expected generated token")
+	}
+
+	result, err := repo.GetOne(NewFilter().Match("token", "b"), &map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (*result.(*map[string]interface{}))["user"] != "user-b" {
+		t.Fatal("Expected user-b, got", result)
+	}
+
+	results, err := repo.GetAll(NewFilter().Match("admin", false), &map[string]interface{}{}, "user", "asc", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := *results.(*[]*map[string]interface{})
+	if len(list) != 2 || (*list[0])["user"] != "user-a" || (*list[1])["user"] != "user-c" {
+		t.Fatal("Expected user-a and user-c, got", list)
+	}
+	if count, err := repo.Count(NewFilter().Match("admin", false)); err != nil || count != 2 {
+		t.Fatal("Expected 2 non-admin sessions, got", count, err)
+	}
+	if exists, err := repo.Exists(NewFilter().Match("token", "c")); err != nil || !exists {
+		t.Fatal("Expected session c to exist, got", exists, err)
+	}
+	if exists, err := repo.Exists(NewFilter().Match("token", "z")); err != nil || exists {
+		t.Fatal("Expected session z not to exist, got", exists, err)
+	}
+	updated, err := repo.UpdateAll(NewFilter().Match("admin", false), &map[string]interface{}{"expired": true, "token": "x"})
+	if err != nil || updated != 2 {
+		t.Fatal("Expected 2 updated sessions, got", updated, err)
+	}
+	if count, err := repo.Count(NewFilter().Match("expired", true).Match("token", "c")); err != nil || count != 1 {
+		t.Fatal("Expected session c to be expired, got", count, err)
+	}
+
+	if _, err := repo.Save(&map[string]interface{}{"token": "x", "admin": true}, NewFilter().Match("user", "user-a")); err != nil {
+		t.Fatal(err)
+	}
+	result, err = repo.GetOne(NewFilter().Match("token", "a"), &map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (*result.(*map[string]interface{}))["admin"] != true {
+		t.Fatal("Expected a to be updated, got", result)
+	}
+
+	if err := repo.DeleteOne(NewFilter().Match("token", "b")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetOne(NewFilter().Match("token", "b"), &map[string]interface{}{}); err == nil || err.Error() != "not found" {
+		t.Fatal("Expected not found error, got", err)
+	}
+
+	if err := repo.DeleteAll(NewFilter().Match("admin", true)); err != nil {
+		t.Fatal(err)
+	}
+	results, err = repo.GetAll(nil, &map[string]interface{}{}, "", "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list := *results.(*[]*map[string]interface{}); len(list) != 2 {
+		t.Fatal("Expected 2 records, got", list)
+	}
+
+	if err := repo.DeleteAll(nil); err != nil {
+		t.Fatal(err)
+	}
+	results, err = repo.GetAll(nil, &map[string]interface{}{}, "", "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list := *results.(*[]*map[string]interface{}); len(list) != 0 {
+		t.Fatal("Expected no records, got", list)
+	}
+}
+
+func TestCacheSaveAll(t *testing.T) {
+	backend, err := CacheBackendBuilder(&config.DBInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Shutdown()
+
+	repo, err := backend.DefineRepository("sessions", RepositoryDefinitionMap{
+		"name":    "sessions",
+		"hashKey": "token",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := repo.SaveAll([]map[string]interface{}{{"token": "a", "user": "user-a"}, {"user": "user-b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list := saved.([]interface{}); len(list) != 2 || list[1].(map[string]interface{})["token"] == "" {
+		t.Fatal("Expected 2 sessions with tokens, got", list)
+	}
+
+	_, err = repo.SaveAll([]map[string]interface{}{{"token": "c"}, {"token": "a"}})
+	if err == nil || err.Error() != "already exists" {
+		t.Fatal("Expected already exists error, got", err)
+	}
+	_, err = repo.SaveAll([]map[string]interface{}{{"token": "d"}, {"token": "d"}})
+	if err == nil || err.Error() != "already exists" {
+		t.Fatal("Expected already exists error for the duplicate in the batch, got", err)
+	}
+	if count, err := repo.Count(nil); err != nil || count != 2 {
+		t.Fatal("Expected the failed batches not to create sessions, got", count, err)
+	}
+}
+
+func TestCacheRepositoryTTL(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping the TTL test in short mode")
+	}
+
+	backend, err := CacheBackendBuilder(&config.DBInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Shutdown()
+
+	repo, err := backend.DefineRepository("tokens", RepositoryDefinitionMap{
+		"name":      "tokens",
+		"enableTtl": true,
+		"ttl":       1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := repo.Save(&map[string]interface{}{"id": "token"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetOne(NewFilter().Match("id", "token"), &map[string]interface{}{}); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(2500 * time.Millisecond)
+
+	if _, err := repo.GetOne(NewFilter().Match("id", "token"), &map[string]interface{}{}); err == nil || err.Error() != "not found" {
+		t.Fatal("Expected the record to expire, got", err)
+	}
+	results, err := repo.GetAll(nil, &map[string]interface{}{}, "", "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list := *results.(*[]*map[string]interface{}); len(list) != 0 {
+		t.Fatal("Expected no records, got", list)
+	}
+
+	// the key is free again
+	if _, err := repo.Save(&map[string]interface{}{"id": "token"}, nil); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,66 @@
+package backends
+
+import (
+	"fmt"
+)
+
+// Capped is the size limit of a capped repository. A capped repository keeps the records in the order they were
+// inserted, and when it is full, it removes the oldest records to make room for the new ones, so it suits the audit
+// logs and the event logs that only keep the latest entries.
+type Capped struct {
+	// MaxBytes is the maximal size of the records in bytes. It is required.
+	MaxBytes int
+	// MaxDocuments is the maximal number of records, if set. The records are removed when either limit is reached.
+	MaxDocuments int
+}
+
+// CappedDefinition is implemented by the repository definitions of the capped repositories - MongoDB specific.
+// RepositoryDefinitionMap implements it with the "capped" property, with the "maxBytes" and "maxDocuments" of the
+// Capped.
+type CappedDefinition interface {
+	GetCapped() map[string]interface{}
+}
+
+// GetCapped returns the size limit of the capped repository - MongoDB specific.
+func (m RepositoryDefinitionMap) GetCapped() map[string]interface{} {
+	if capped, ok := m["capped"]; ok {
+		return capped.(map[string]interface{})
+	}
+
+	return nil
+}
+
+// repositoryCapped returns the size limit of the repository, or nil if it is not capped.
+func repositoryCapped(repoDef RepositoryDefinition) (*Capped, error) {
+	cappedDef, ok := repoDef.(CappedDefinition)
+	if !ok || cappedDef.GetCapped() == nil {
+		return nil, nil
+	}
+
+	capped := &Capped{}
+	for key, value := range cappedDef.GetCapped() {
+		var ok bool
+		switch key {
+		case "maxBytes":
+			capped.MaxBytes, ok = value.(int)
+		case "maxDocuments":
+			capped.MaxDocuments, ok = value.(int)
+		default:
+			return nil, ErrBackendError(fmt.Sprintf("unknown capped property %s", key))
+		}
+		if !ok {
+			return nil, ErrBackendError(fmt.Sprintf("invalid capped %s: %v", key, value))
+		}
+	}
+
+	if capped.MaxBytes <= 0 {
+		return nil, ErrBackendError("maxBytes of the capped repository is required and must be positive")
+	}
+	if capped.MaxDocuments < 0 {
+		return nil, ErrBackendError(fmt.Sprintf("maxDocuments of the capped repository must not be negative, got %d", capped.MaxDocuments))
+	}
+	if repoDef.EnableTTL() {
+		return nil, ErrBackendError("capped repository can't have a TTL")
+	}
+	return capped, nil
+}
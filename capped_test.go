@@ -0,0 +1,44 @@
+package backends
+
+import (
+	"testing"
+)
+
+func TestRepositoryCapped(t *testing.T) {
+	capped, err := repositoryCapped(RepositoryDefinitionMap{
+		"name":   "audit",
+		"capped": map[string]interface{}{"maxBytes": 1048576, "maxDocuments": 1000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *capped != (Capped{MaxBytes: 1048576, MaxDocuments: 1000}) {
+		t.Fatal("Expected the limits of the definition. Got: ", capped)
+	}
+
+	if capped, err := repositoryCapped(RepositoryDefinitionMap{"name": "audit"}); err != nil || capped != nil {
+		t.Fatal("Expected no limits. Got: ", capped, err)
+	}
+
+	for _, properties := range []map[string]interface{}{
+		{"maxDocuments": 1000},
+		{"maxBytes": 0},
+		{"maxBytes": "1MB"},
+		{"maxBytes": 4096, "maxDocuments": -1},
+		{"maxBytes": 4096, "maxAge": 60},
+	} {
+		if _, err := repositoryCapped(RepositoryDefinitionMap{"capped": properties}); err == nil {
+			t.Fatal("Expected an error for the limits ", properties)
+		}
+	}
+
+	_, err = repositoryCapped(RepositoryDefinitionMap{
+		"capped":       map[string]interface{}{"maxBytes": 4096},
+		"enableTtl":    true,
+		"ttl":          60,
+		"ttlAttribute": "createdAt",
+	})
+	if err == nil {
+		t.Fatal("Expected an error for a capped repository with a TTL")
+	}
+}
@@ -0,0 +1,185 @@
+package backends
+
+import (
+	"sync"
+	"time"
+)
+
+// ChangeType is the type of a change of a record.
+type ChangeType string
+
+const (
+	// ChangeInsert is a new record.
+	ChangeInsert ChangeType = "insert"
+	// ChangeUpdate is a modified (or replaced) record.
+	ChangeUpdate ChangeType = "update"
+	// ChangeDelete is a deleted record.
+	ChangeDelete ChangeType = "delete"
+)
+
+// ChangeEvent is a change of a record delivered by a ChangeStream.
+type ChangeEvent struct {
+	Type ChangeType
+	// Key is the key of the changed record
+	Key map[string]interface{}
+	// Record is the record after the change, if the backend delivers it. It is nil for ChangeDelete.
+	Record map[string]interface{}
+	// OldRecord is the record before the change, if the backend delivers it. It is nil for ChangeInsert.
+	OldRecord map[string]interface{}
+	// Time is the (approximate) time of the change
+	Time time.Time
+}
+
+// record returns the record after the change, or before it for the deletions, or only the key when the backend
+// delivers neither.
+func (e *ChangeEvent) record() map[string]interface{} {
+	if e.Record != nil {
+		return e.Record
+	}
+	if e.OldRecord != nil {
+		return e.OldRecord
+	}
+	return e.Key
+}
+
+// Decode decodes the record after the change into the result, or the record before the change for ChangeDelete.
+func (e *ChangeEvent) Decode(result interface{}) error {
+	record := e.record()
+	return MapToInterface(&record, result)
+}
+
+// ChangeStream delivers the changes of the records of a repository as they happen. The stream must be closed when
+// it is no longer read:
+//
+//	var watcher backends.ChangeWatcher
+//	if !backends.AsRepository(repo, &watcher) {
+//		return errors.New("the changes are not delivered")
+//	}
+//	changes, err := watcher.Watch(backends.NewFilter().Match("status", "active"))
+//	if err != nil {
+//		return err
+//	}
+//	defer changes.Close()
+//	for changes.Next() {
+//		event := changes.Event()
+//		cache.Invalidate(event.Key)
+//	}
+//	return changes.Err()
+type ChangeStream interface {
+	// Next waits for the next change, and reports whether there is one. Returns false once the stream fails or is
+	// closed.
+	Next() bool
+	// Event returns the current change.
+	Event() *ChangeEvent
+	// Err returns the error that stopped the stream, if any.
+	Err() error
+	// Close stops the stream and returns the error that stopped it, if any.
+	Close() error
+}
+
+// ChangeWatcher is implemented by the repositories that deliver the changes of their records: DynamoDB, with DynamoDB
+// Streams, and MongoDB, with change streams. Watch delivers the changes made after it returns, of the records that match the filter (after the change,
+// or before it for the deletions).
+type ChangeWatcher interface {
+	Watch(filter Filter) (ChangeStream, error)
+}
+
+// changeFeed is a ChangeStream fed by the goroutines of a backend, which stop once done is closed. The feeder closes
+// events when all goroutines have stopped.
+type changeFeed struct {
+	events  chan *ChangeEvent
+	done    chan struct{}
+	once    *sync.Once
+	mutex   *sync.Mutex
+	err     error
+	event   *ChangeEvent
+	matcher RecordMatcher
+}
+
+// newChangeFeed creates new changeFeed of the changes of the records that match the filter, which buffers up to size
+// changes.
+func newChangeFeed(filter Filter, size int) (*changeFeed, error) {
+	matcher, err := toRecordMatcher(filter)
+	if err != nil {
+		return nil, err
+	}
+	return &changeFeed{
+		events:  make(chan *ChangeEvent, size),
+		done:    make(chan struct{}),
+		once:    &sync.Once{},
+		mutex:   &sync.Mutex{},
+		matcher: matcher,
+	}, nil
+}
+
+// Next waits for the next change, and reports whether there is one.
+func (f *changeFeed) Next() bool {
+	event, ok := <-f.events
+	if !ok {
+		return false
+	}
+	f.event = event
+	return true
+}
+
+// Event returns the current change.
+func (f *changeFeed) Event() *ChangeEvent {
+	return f.event
+}
+
+// Err returns the first error of the feeder, if any.
+func (f *changeFeed) Err() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.err
+}
+
+// Close stops the feeder and returns its first error, if any.
+func (f *changeFeed) Close() error {
+	f.stop()
+	for range f.events {
+	}
+	return f.Err()
+}
+
+// publish delivers the change if it matches the filter. Returns false if the feed is stopped.
+func (f *changeFeed) publish(event *ChangeEvent) bool {
+	if !f.matcher(event.record()) {
+		return true
+	}
+	select {
+	case f.events <- event:
+		return true
+	case <-f.done:
+		return false
+	}
+}
+
+// wait waits for the duration. Returns false if the feed is stopped in the meantime.
+func (f *changeFeed) wait(duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-f.done:
+		return false
+	}
+}
+
+// fail records the first error and stops the feeder.
+func (f *changeFeed) fail(err error) {
+	f.mutex.Lock()
+	if f.err == nil {
+		f.err = err
+	}
+	f.mutex.Unlock()
+	f.stop()
+}
+
+// stop signals the feeder to stop.
+func (f *changeFeed) stop() {
+	f.once.Do(func() {
+		close(f.done)
+	})
+}
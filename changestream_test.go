@@ -0,0 +1,55 @@
+package backends
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestChangeFeed(t *testing.T) {
+	feed, err := newChangeFeed(NewFilter().Match("status", "active"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := []*ChangeEvent{
+		{Type: ChangeInsert, Key: map[string]interface{}{"id": "1"}, Record: map[string]interface{}{"id": "1", "status": "active"}},
+		{Type: ChangeUpdate, Key: map[string]interface{}{"id": "2"}, Record: map[string]interface{}{"id": "2", "status": "inactive"}},
+		{Type: ChangeDelete, Key: map[string]interface{}{"id": "3"}, OldRecord: map[string]interface{}{"id": "3", "status": "active"}},
+	}
+	for _, event := range events {
+		if !feed.publish(event) {
+			t.Fatal("Expected the feed to accept the event")
+		}
+	}
+	close(feed.events)
+
+	ids := []string{}
+	for feed.Next() {
+		var record struct {
+			ID string `json:"id"`
+		}
+		if err := feed.Event().Decode(&record); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, record.ID)
+	}
+	if len(ids) != 2 || ids[0] != "1" || ids[1] != "3" {
+		t.Fatal("Expected the matching insert and delete. Got: ", ids)
+	}
+
+	// the stopped feed does not accept events, and keeps the first error
+	feed, _ = newChangeFeed(nil, 0)
+	feed.fail(errors.New("first"))
+	feed.fail(errors.New("second"))
+	if feed.publish(events[0]) {
+		t.Fatal("Expected the stopped feed not to accept events")
+	}
+	if feed.wait(time.Hour) {
+		t.Fatal("Expected the stopped feed not to wait")
+	}
+	close(feed.events)
+	if err := feed.Close(); err == nil || err.Error() != "first" {
+		t.Fatal("Expected the first error. Got: ", err)
+	}
+}
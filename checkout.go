@@ -0,0 +1,175 @@
+package backends
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+// checkoutRetries is the number of times a checkout is attempted when the checkout of the record changes
+// concurrently.
+const checkoutRetries = 3
+
+// Checkout is a lease on a record, held by the owner (usually a user editing the record) until it is released or
+// expires.
+type Checkout struct {
+	// ID is the id of the checkout: the name of the repository and the id of the record ("articles:42").
+	ID string `json:"id"`
+	// Repository is the name of the repository.
+	Repository string `json:"repository"`
+	// RecordID is the id of the checked out record.
+	RecordID string `json:"recordId"`
+	// Owner is the user or session that checked out the record.
+	Owner string `json:"owner"`
+	// Token changes with every checkout and renewal. The checkouts are taken over only if the token is unchanged.
+	Token string `json:"token"`
+	// CheckedOutAt is the time of the checkout, in milliseconds since the epoch. The renewals keep the time.
+	CheckedOutAt int64 `json:"checkedOutAt"`
+	// ExpiresAt is the time the checkout expires, in milliseconds since the epoch.
+	ExpiresAt int64 `json:"expiresAt"`
+}
+
+// Expired reports whether the checkout has expired.
+func (c *Checkout) Expired() bool {
+	return syncNow() >= c.ExpiresAt
+}
+
+// CheckoutStore checks out the records of a repository, so the UIs can show that a record is being edited by
+// someone else, the same way for all backends:
+//
+//	checkouts := backends.NewCheckoutStore(checkoutRepo, "articles")
+//	checkout, err := checkouts.Checkout(articleID, userID, 5*time.Minute)
+//	if backends.IsErrCheckedOut(err) {
+//		return fmt.Errorf("the article is being edited by %s", checkout.Owner)
+//	}
+//	defer checkouts.Release(articleID, userID)
+//
+// The checkouts are saved in their own repository, keyed by the id of the checkout, and are taken with conditional
+// writes: a new checkout is created with Save, which fails if the record is already checked out, and an expired
+// checkout is taken over with UpdateAll, matched by its token. The repository on MongoDB must be defined with a
+// custom id. The checkouts are advisory: the writes to the checked out records are not rejected.
+type CheckoutStore struct {
+	repo       Repository
+	repository string
+}
+
+// NewCheckoutStore creates a CheckoutStore for the records of the named repository. The checkouts are saved in repo,
+// which can be shared by the stores of several repositories.
+func NewCheckoutStore(repo Repository, repository string) *CheckoutStore {
+	return &CheckoutStore{
+		repo:       repo,
+		repository: repository,
+	}
+}
+
+// Checkout checks out the record for the owner, for ttl. If the owner has already checked out the record, the
+// checkout is renewed. If another owner has checked out the record and the checkout has not expired, ErrCheckedOut
+// is returned together with that checkout, so the caller can tell who holds it.
+func (s *CheckoutStore) Checkout(id string, owner string, ttl time.Duration) (*Checkout, error) {
+	if owner == "" {
+		return nil, ErrInvalidInput("owner is required")
+	}
+	if ttl <= 0 {
+		return nil, ErrInvalidInput("ttl must be greater than zero")
+	}
+
+	for attempt := 0; attempt < checkoutRetries; attempt++ {
+		current, err := s.get(id)
+		if err != nil {
+			return nil, err
+		}
+
+		token, err := uuid.NewV4()
+		if err != nil {
+			return nil, err
+		}
+		now := syncNow()
+		checkout := &Checkout{
+			ID:           s.key(id),
+			Repository:   s.repository,
+			RecordID:     id,
+			Owner:        owner,
+			Token:        token.String(),
+			CheckedOutAt: now,
+			ExpiresAt:    now + int64(ttl/time.Millisecond),
+		}
+
+		if current == nil {
+			if _, err := s.repo.Save(checkout, nil); err != nil {
+				if IsErrAlreadyExists(err) {
+					// checked out concurrently
+					continue
+				}
+				return nil, err
+			}
+			return checkout, nil
+		}
+
+		if current.Owner != owner && !current.Expired() {
+			return current, ErrCheckedOut(fmt.Sprintf("%s %s is checked out by %s", s.repository, id, current.Owner))
+		}
+		if current.Owner == owner && !current.Expired() {
+			checkout.CheckedOutAt = current.CheckedOutAt
+		}
+
+		updated, err := s.repo.UpdateAll(NewFilter().Match("id", checkout.ID).Match("token", current.Token), &map[string]interface{}{
+			"owner":        checkout.Owner,
+			"token":        checkout.Token,
+			"checkedOutAt": checkout.CheckedOutAt,
+			"expiresAt":    checkout.ExpiresAt,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if updated > 0 {
+			return checkout, nil
+		}
+		// the checkout was renewed, taken over or released concurrently
+	}
+
+	current, err := s.CheckedOut(id)
+	if err != nil {
+		return nil, err
+	}
+	return current, ErrCheckedOut(fmt.Sprintf("%s %s is being checked out concurrently", s.repository, id))
+}
+
+// Release releases the checkout of the record. Does nothing if the record is not checked out. Returns ErrCheckedOut
+// if the record is checked out by another owner and the checkout has not expired.
+func (s *CheckoutStore) Release(id string, owner string) error {
+	current, err := s.get(id)
+	if err != nil || current == nil {
+		return err
+	}
+	if current.Owner != owner && !current.Expired() {
+		return ErrCheckedOut(fmt.Sprintf("%s %s is checked out by %s", s.repository, id, current.Owner))
+	}
+	return s.repo.DeleteAll(NewFilter().Match("id", current.ID).Match("token", current.Token))
+}
+
+// CheckedOut returns the checkout of the record, or nil if the record is not checked out or the checkout has expired.
+func (s *CheckoutStore) CheckedOut(id string) (*Checkout, error) {
+	current, err := s.get(id)
+	if err != nil || current == nil || current.Expired() {
+		return nil, err
+	}
+	return current, nil
+}
+
+// get fetches the checkout of the record, expired or not. Returns nil if there is none.
+func (s *CheckoutStore) get(id string) (*Checkout, error) {
+	result, err := s.repo.GetOne(NewFilter().Match("id", s.key(id)), &Checkout{})
+	if err != nil {
+		if IsErrNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return result.(*Checkout), nil
+}
+
+// key returns the id of the checkout of the record.
+func (s *CheckoutStore) key(id string) string {
+	return s.repository + ":" + id
+}
@@ -0,0 +1,76 @@
+package backends
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func TestCheckoutStore(t *testing.T) {
+	backend, err := CacheBackendBuilder(&config.DBInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Shutdown()
+
+	repo, err := backend.DefineRepository("checkouts", RepositoryDefinitionMap{"name": "checkouts"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkouts := NewCheckoutStore(repo, "articles")
+
+	checkout, err := checkouts.Checkout("42", "alice", 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkout.ID != "articles:42" || checkout.Owner != "alice" || checkout.Token == "" {
+		t.Fatal("Invalid checkout: ", checkout)
+	}
+
+	holder, err := checkouts.Checkout("42", "bob", time.Minute)
+	if err == nil || !IsErrCheckedOut(err) {
+		t.Fatal("Expected checked out error. Got: ", err)
+	}
+	if holder == nil || holder.Owner != "alice" {
+		t.Fatal("Expected the current checkout with the error. Got: ", holder)
+	}
+	if err := checkouts.Release("42", "bob"); err == nil || !IsErrCheckedOut(err) {
+		t.Fatal("Expected the checkout not to be released by another owner. Got: ", err)
+	}
+
+	renewed, err := checkouts.Checkout("42", "alice", 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renewed.Token == checkout.Token || renewed.CheckedOutAt != checkout.CheckedOutAt {
+		t.Fatal("Expected the checkout to be renewed. Got: ", renewed)
+	}
+
+	// the expired checkout is taken over
+	time.Sleep(60 * time.Millisecond)
+	if current, err := checkouts.CheckedOut("42"); err != nil || current != nil {
+		t.Fatal("Expected the checkout to expire. Got: ", current, err)
+	}
+	checkout, err = checkouts.Checkout("42", "bob", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current, err := checkouts.CheckedOut("42"); err != nil || current == nil || current.Owner != "bob" {
+		t.Fatal("Expected the record to be checked out by bob. Got: ", current, err)
+	}
+
+	if err := checkouts.Release("42", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if current, err := checkouts.CheckedOut("42"); err != nil || current != nil {
+		t.Fatal("Expected the checkout to be released. Got: ", current, err)
+	}
+	if err := checkouts.Release("42", "bob"); err != nil {
+		t.Fatal("Expected the release of a released checkout to do nothing. Got: ", err)
+	}
+
+	if _, err := NewCheckoutStore(repo, "comments").Checkout("42", "alice", time.Minute); err != nil {
+		t.Fatal("Expected the records of other repositories to be checked out separately. Got: ", err)
+	}
+}
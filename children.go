@@ -0,0 +1,256 @@
+package backends
+
+import (
+	"fmt"
+
+	"github.com/satori/go.uuid"
+)
+
+// ChildrenRepository is implemented by the repositories that modify an array of child records in place, without
+// rewriting the whole parent record: MongoDB (positional updates) and DynamoDB (document path updates).
+type ChildrenRepository interface {
+	// AddChild appends the child to the array field of the parent record.
+	AddChild(parent Filter, field string, idProperty string, child map[string]interface{}) error
+	// UpdateChild sets the properties of the child with the given id.
+	UpdateChild(parent Filter, field string, idProperty string, childID interface{}, update map[string]interface{}) error
+	// RemoveChild removes the child with the given id from the array field of the parent record.
+	RemoveChild(parent Filter, field string, idProperty string, childID interface{}) error
+}
+
+// ChildCollection treats an array field of the records of a repository as a collection of child records, each
+// identified by an id property:
+//
+//	addresses := backends.Children(userRepo, "addresses")
+//	address, err := addresses.Add(backends.NewFilter().Match("id", userID), &Address{City: "Skopje"})
+//	_, err = addresses.Update(backends.NewFilter().Match("id", userID), address["id"], map[string]interface{}{"zip": "1000"})
+//	err = addresses.Remove(backends.NewFilter().Match("id", userID), address["id"])
+//
+// If the repository implements ChildrenRepository, the array is modified in place by the backend. Otherwise the parent
+// record is read, the array is modified and the parent record is saved, so concurrent modifications of the same
+// parent may overwrite each other.
+type ChildCollection struct {
+	repo       Repository
+	field      string
+	idProperty string
+}
+
+// Children returns the child collection stored in the array field of the records of the repository. The children
+// are identified by their "id" property.
+func Children(parent Repository, field string) *ChildCollection {
+	return &ChildCollection{
+		repo:       parent,
+		field:      field,
+		idProperty: "id",
+	}
+}
+
+// WithIDProperty sets the property that identifies the children.
+func (c *ChildCollection) WithIDProperty(property string) *ChildCollection {
+	c.idProperty = property
+	return c
+}
+
+// List returns all children of the parent record.
+func (c *ChildCollection) List(parent Filter, resultsTypeHint interface{}) (interface{}, error) {
+	record, err := c.parent(parent)
+	if err != nil {
+		return nil, err
+	}
+	children := childRecords(record[c.field])
+	if resultsTypeHint == nil {
+		resultsTypeHint = &map[string]interface{}{}
+	}
+	return recordsToResults(children, resultsTypeHint)
+}
+
+// Get returns the child with the given id. Returns ErrNotFound if the parent record or the child does not exist.
+func (c *ChildCollection) Get(parent Filter, childID interface{}, result interface{}) (interface{}, error) {
+	record, err := c.parent(parent)
+	if err != nil {
+		return nil, err
+	}
+	children := childRecords(record[c.field])
+	index := childIndex(children, c.idProperty, childID)
+	if index < 0 {
+		return nil, ErrNotFound(fmt.Sprintf("child %v not found in %s", childID, c.field))
+	}
+	if err := MapToInterface(&children[index], &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Add appends the child to the children of the parent record. The id of the child is generated if it has none.
+// Returns the added child, or ErrAlreadyExists if the parent already has a child with the same id.
+func (c *ChildCollection) Add(parent Filter, child interface{}) (map[string]interface{}, error) {
+	record, err := childRecord(child)
+	if err != nil {
+		return nil, err
+	}
+	if id, ok := record[c.idProperty]; !ok || id == nil || id == "" {
+		id, err := uuid.NewV4()
+		if err != nil {
+			return nil, err
+		}
+		record[c.idProperty] = id.String()
+	}
+
+	var childrenRepo ChildrenRepository
+	if AsRepository(c.repo, &childrenRepo) {
+		if err := childrenRepo.AddChild(cloneFilter(parent), c.field, c.idProperty, record); err != nil {
+			return nil, err
+		}
+		return record, nil
+	}
+
+	err = c.modify(parent, func(children []interface{}) ([]interface{}, error) {
+		if childIndex(childRecords(children), c.idProperty, record[c.idProperty]) >= 0 {
+			return nil, ErrAlreadyExists(fmt.Sprintf("child %v already exists in %s", record[c.idProperty], c.field))
+		}
+		return append(children, record), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Update sets the properties of the child with the given id. The id of the child is immutable. Returns the updated
+// child, or ErrNotFound if the parent record or the child does not exist.
+func (c *ChildCollection) Update(parent Filter, childID interface{}, update interface{}) (map[string]interface{}, error) {
+	properties, err := childRecord(update)
+	if err != nil {
+		return nil, err
+	}
+	delete(properties, c.idProperty)
+
+	var childrenRepo ChildrenRepository
+	if AsRepository(c.repo, &childrenRepo) {
+		if len(properties) > 0 {
+			if err := childrenRepo.UpdateChild(cloneFilter(parent), c.field, c.idProperty, childID, properties); err != nil {
+				return nil, err
+			}
+		}
+		updated := map[string]interface{}{}
+		if _, err := c.Get(parent, childID, &updated); err != nil {
+			return nil, err
+		}
+		return updated, nil
+	}
+
+	var updated map[string]interface{}
+	err = c.modify(parent, func(children []interface{}) ([]interface{}, error) {
+		index := childIndex(childRecords(children), c.idProperty, childID)
+		if index < 0 {
+			return nil, ErrNotFound(fmt.Sprintf("child %v not found in %s", childID, c.field))
+		}
+		updated = map[string]interface{}{}
+		for k, v := range children[index].(map[string]interface{}) {
+			updated[k] = v
+		}
+		for k, v := range properties {
+			updated[k] = v
+		}
+		children[index] = updated
+		return children, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// Remove removes the child with the given id. Returns ErrNotFound if the parent record or the child does not exist.
+func (c *ChildCollection) Remove(parent Filter, childID interface{}) error {
+	var childrenRepo ChildrenRepository
+	if AsRepository(c.repo, &childrenRepo) {
+		return childrenRepo.RemoveChild(cloneFilter(parent), c.field, c.idProperty, childID)
+	}
+
+	return c.modify(parent, func(children []interface{}) ([]interface{}, error) {
+		index := childIndex(childRecords(children), c.idProperty, childID)
+		if index < 0 {
+			return nil, ErrNotFound(fmt.Sprintf("child %v not found in %s", childID, c.field))
+		}
+		return append(children[:index:index], children[index+1:]...), nil
+	})
+}
+
+// parent fetches the parent record.
+func (c *ChildCollection) parent(filter Filter) (map[string]interface{}, error) {
+	result, err := c.repo.GetOne(cloneFilter(filter), &map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	record, err := InterfaceToMap(result)
+	if err != nil {
+		return nil, err
+	}
+	return *record, nil
+}
+
+// modify reads the parent record, modifies its children and saves them.
+func (c *ChildCollection) modify(filter Filter, fn func(children []interface{}) ([]interface{}, error)) error {
+	record, err := c.parent(filter)
+	if err != nil {
+		return err
+	}
+	normalized, err := normalizeValue(record[c.field])
+	if err != nil {
+		return err
+	}
+	children, _ := normalized.([]interface{})
+	if children == nil {
+		children = []interface{}{}
+	}
+	children, err = fn(children)
+	if err != nil {
+		return err
+	}
+	_, err = c.repo.Save(&map[string]interface{}{c.field: children}, cloneFilter(filter))
+	return err
+}
+
+// childRecord converts the child (a struct or a map, or a pointer to one) to a record. The struct fields are encoded
+// as in JSON, so the empty fields tagged with omitempty are left out.
+func childRecord(child interface{}) (map[string]interface{}, error) {
+	normalized, err := normalizeValue(child)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+	record, ok := normalized.(map[string]interface{})
+	if !ok {
+		return nil, ErrInvalidInput("child must be a struct or a map")
+	}
+	return record, nil
+}
+
+// childRecords returns the children in the array. The values that are not records are returned as empty records, so
+// the indexes match the indexes in the array.
+func childRecords(value interface{}) []map[string]interface{} {
+	normalized, err := normalizeValue(value)
+	if err != nil {
+		return nil
+	}
+	values, _ := normalized.([]interface{})
+	children := make([]map[string]interface{}, 0, len(values))
+	for _, v := range values {
+		child, ok := v.(map[string]interface{})
+		if !ok {
+			child = map[string]interface{}{}
+		}
+		children = append(children, child)
+	}
+	return children
+}
+
+// childIndex returns the index of the child with the given id, or -1 if there is none. The ids are compared by
+// their string representation, so 1 matches the number 1 as decoded from JSON.
+func childIndex(children []map[string]interface{}, idProperty string, childID interface{}) int {
+	for i, child := range children {
+		if id, ok := child[idProperty]; ok && fmt.Sprint(id) == fmt.Sprint(childID) {
+			return i
+		}
+	}
+	return -1
+}
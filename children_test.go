@@ -0,0 +1,91 @@
+package backends
+
+import (
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+type testAddress struct {
+	ID   string `json:"id,omitempty"`
+	City string `json:"city,omitempty"`
+	Zip  string `json:"zip,omitempty"`
+}
+
+func TestChildren(t *testing.T) {
+	backend, err := CacheBackendBuilder(&config.DBInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Shutdown()
+
+	repo, err := backend.DefineRepository("users", RepositoryDefinitionMap{"name": "users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Save(&map[string]interface{}{"id": "john", "name": "John"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	user := NewFilter().Match("id", "john")
+	addresses := Children(repo, "addresses")
+
+	home, err := addresses.Add(user, &testAddress{City: "Skopje"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if home["id"] == nil || home["city"] != "Skopje" {
+		t.Fatal("Expected the added address with a generated id. Got: ", home)
+	}
+	if _, err := addresses.Add(user, &testAddress{ID: "work", City: "Bitola"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := addresses.Add(user, &testAddress{ID: "work", City: "Ohrid"}); err == nil || !IsErrAlreadyExists(err) {
+		t.Fatal("Expected already exists error for the duplicate child id. Got: ", err)
+	}
+
+	updated, err := addresses.Update(user, home["id"], map[string]interface{}{"id": "changed", "zip": "1000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated["id"] != home["id"] || updated["city"] != "Skopje" || updated["zip"] != "1000" {
+		t.Fatal("Expected the address to be updated, with the same id. Got: ", updated)
+	}
+
+	address, err := addresses.Get(user, "work", &testAddress{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if address.(*testAddress).City != "Bitola" {
+		t.Fatal("Invalid address: ", address)
+	}
+
+	if err := addresses.Remove(user, home["id"]); err != nil {
+		t.Fatal(err)
+	}
+	if err := addresses.Remove(user, home["id"]); err == nil || !IsErrNotFound(err) {
+		t.Fatal("Expected not found error for the removed child. Got: ", err)
+	}
+	if _, err := addresses.Update(user, "missing", map[string]interface{}{"zip": "1000"}); err == nil || !IsErrNotFound(err) {
+		t.Fatal("Expected not found error for the missing child. Got: ", err)
+	}
+
+	list, err := addresses.List(user, &testAddress{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results := *list.(*[]*testAddress); len(results) != 1 || results[0].ID != "work" {
+		t.Fatal("Expected only the work address. Got: ", results)
+	}
+
+	record := map[string]interface{}{}
+	if _, err := repo.GetOne(user, &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["name"] != "John" {
+		t.Fatal("Expected the other fields of the parent to be kept. Got: ", record)
+	}
+
+	if _, err := addresses.Add(NewFilter().Match("id", "jane"), &testAddress{City: "Skopje"}); err == nil {
+		t.Fatal("Expected an error for the missing parent")
+	}
+}
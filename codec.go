@@ -0,0 +1,207 @@
+package backends
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Codec names, used as the "codec" property of a repository definition.
+const (
+	// CodecJSON stores the records as JSON text. This is the default - the stored records are readable
+	// with the database tools.
+	CodecJSON = "json"
+	// CodecBSON stores the records as BSON, with the native BSON types (integers, dates, binary data).
+	CodecBSON = "bson"
+	// CodecMsgPack stores the records as MessagePack, the most compact and fastest of the codecs.
+	CodecMsgPack = "msgpack"
+)
+
+// Codec serializes the records of the backends that store them as blobs (SQL, the key-value stores and S3).
+// The index fields are extracted from the records by the backends, so they can be queried with any codec.
+// The codecs decode the records into the values they would have if stored as JSON (numbers are float64,
+// dates are RFC 3339 strings etc), so the filters and the sorting work the same with every codec.
+type Codec interface {
+	// Name returns the name of the codec.
+	Name() string
+	// Binary returns true if the encoded records are not valid UTF-8 text.
+	Binary() bool
+	// Marshal encodes the record.
+	Marshal(record map[string]interface{}) ([]byte, error)
+	// Unmarshal decodes the record.
+	Unmarshal(data []byte) (map[string]interface{}, error)
+}
+
+// CodecDefinition is implemented by the repository definitions that choose the codec of the stored records.
+// RepositoryDefinitionMap implements it with the "codec" property.
+type CodecDefinition interface {
+	GetCodec() string
+}
+
+// GetCodec returns the name of the codec of the repository. Empty means the default (JSON).
+func (m RepositoryDefinitionMap) GetCodec() string {
+	if codec, ok := m["codec"]; ok {
+		return codec.(string)
+	}
+
+	return ""
+}
+
+// jsonCodec stores the records as JSON.
+type jsonCodec struct{}
+
+// Name returns "json".
+func (c jsonCodec) Name() string {
+	return CodecJSON
+}
+
+// Binary returns false.
+func (c jsonCodec) Binary() bool {
+	return false
+}
+
+// Marshal encodes the record as JSON.
+func (c jsonCodec) Marshal(record map[string]interface{}) ([]byte, error) {
+	return json.Marshal(record)
+}
+
+// Unmarshal decodes the JSON record.
+func (c jsonCodec) Unmarshal(data []byte) (map[string]interface{}, error) {
+	record := map[string]interface{}{}
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// bsonCodec stores the records as BSON.
+type bsonCodec struct{}
+
+// Name returns "bson".
+func (c bsonCodec) Name() string {
+	return CodecBSON
+}
+
+// Binary returns true.
+func (c bsonCodec) Binary() bool {
+	return true
+}
+
+// Marshal encodes the record as BSON.
+func (c bsonCodec) Marshal(record map[string]interface{}) ([]byte, error) {
+	return bson.Marshal(record)
+}
+
+// Unmarshal decodes the BSON record.
+func (c bsonCodec) Unmarshal(data []byte) (map[string]interface{}, error) {
+	record := map[string]interface{}{}
+	if err := bson.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	return toJSONValue(record).(map[string]interface{}), nil
+}
+
+// msgpackCodec stores the records as MessagePack.
+type msgpackCodec struct{}
+
+// Name returns "msgpack".
+func (c msgpackCodec) Name() string {
+	return CodecMsgPack
+}
+
+// Binary returns true.
+func (c msgpackCodec) Binary() bool {
+	return true
+}
+
+// Marshal encodes the record as MessagePack.
+func (c msgpackCodec) Marshal(record map[string]interface{}) ([]byte, error) {
+	return msgpack.Marshal(record)
+}
+
+// Unmarshal decodes the MessagePack record.
+func (c msgpackCodec) Unmarshal(data []byte) (map[string]interface{}, error) {
+	record := map[string]interface{}{}
+	if err := msgpack.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	return toJSONValue(record).(map[string]interface{}), nil
+}
+
+// codecs are the supported codecs, by name.
+var codecs = map[string]Codec{
+	CodecJSON:    jsonCodec{},
+	CodecBSON:    bsonCodec{},
+	CodecMsgPack: msgpackCodec{},
+}
+
+// GetCodec returns the codec with the given name. An empty name returns the JSON codec.
+func GetCodec(name string) (Codec, error) {
+	if name == "" {
+		name = CodecJSON
+	}
+	codec, ok := codecs[name]
+	if !ok {
+		return nil, ErrInvalidInput(fmt.Sprintf("unknown codec %s", name))
+	}
+	return codec, nil
+}
+
+// codecFor returns the codec of the repository, JSON if the definition does not choose one.
+func codecFor(repoDef RepositoryDefinition) (Codec, error) {
+	if codecDef, ok := repoDef.(CodecDefinition); ok {
+		return GetCodec(codecDef.GetCodec())
+	}
+	return GetCodec("")
+}
+
+// toJSONValue converts the decoded value to the value it would have if decoded from JSON.
+func toJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, string, bool, float64:
+		return v
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = toJSONValue(item)
+		}
+		return v
+	case bson.M:
+		return toJSONValue(map[string]interface{}(v))
+	case []interface{}:
+		for i, item := range v {
+			v[i] = toJSONValue(item)
+		}
+		return v
+	case int:
+		return float64(v)
+	case int8:
+		return float64(v)
+	case int16:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint:
+		return float64(v)
+	case uint8:
+		return float64(v)
+	case uint16:
+		return float64(v)
+	case uint32:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	}
+
+	// dates, binary data, object ids etc.
+	normalized, err := normalizeValue(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return normalized
+}
@@ -0,0 +1,93 @@
+package backends
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func TestCodecs(t *testing.T) {
+	record := map[string]interface{}{
+		"id":   "1",
+		"name": "John",
+		"age":  42,
+		"address": map[string]interface{}{
+			"city": "Skopje",
+		},
+		"tags": []interface{}{"a", "b"},
+	}
+
+	for _, name := range []string{"", CodecJSON, CodecBSON, CodecMsgPack} {
+		codec, err := GetCodec(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := codec.Marshal(record)
+		if err != nil {
+			t.Fatal(codec.Name(), err)
+		}
+		decoded, err := codec.Unmarshal(data)
+		if err != nil {
+			t.Fatal(codec.Name(), err)
+		}
+
+		normalized, _ := normalizeValue(decoded)
+		expected, _ := normalizeValue(record)
+		if !reflect.DeepEqual(normalized, expected) {
+			t.Fatal(codec.Name(), "Expected the decoded record to equal the record, got", decoded)
+		}
+	}
+
+	if _, err := GetCodec("xml"); err == nil || err.Error() != "invalid input" {
+		t.Fatal("Expected invalid input error for an unknown codec, got", err)
+	}
+}
+
+func TestCodecFor(t *testing.T) {
+	codec, err := codecFor(RepositoryDefinitionMap{"name": "users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if codec.Name() != CodecJSON || codec.Binary() {
+		t.Fatal("Expected the JSON codec by default, got", codec.Name())
+	}
+
+	codec, err = codecFor(RepositoryDefinitionMap{"name": "users", "codec": "msgpack"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if codec.Name() != CodecMsgPack || !codec.Binary() {
+		t.Fatal("Expected the MessagePack codec, got", codec.Name())
+	}
+}
+
+func TestCacheRepositoryCodec(t *testing.T) {
+	backend, err := CacheBackendBuilder(&config.DBInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Shutdown()
+
+	if _, err := backend.DefineRepository("invalid", RepositoryDefinitionMap{"name": "invalid", "codec": "xml"}); err == nil {
+		t.Fatal("Expected error for an unknown codec")
+	}
+
+	repo, err := backend.DefineRepository("events", RepositoryDefinitionMap{"name": "events", "codec": CodecBSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Now().UTC().Truncate(time.Second)
+	if _, err := repo.Save(&map[string]interface{}{"id": "1", "count": 3, "at": at}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := repo.GetOne(NewFilter().Match("count", 3), &map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (*result.(*map[string]interface{}))["id"] != "1" {
+		t.Fatal("Expected the event, got", result)
+	}
+}
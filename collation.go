@@ -0,0 +1,93 @@
+package backends
+
+import (
+	"fmt"
+)
+
+// Collation compares the strings by the rules of a language, for example to sort "Ärger" before "Zorn" in German, or
+// to match "José" with "jose". It is the collation of a repository (see CollationDefinition) or of a single query
+// (see CollatedQuerier).
+type Collation struct {
+	// Locale is the ICU locale of the language, for example "de", "fr_CA" or "simple" (the binary comparison).
+	Locale string
+	// Strength is the level of the comparison: 1 ignores the case and the diacritics, 2 ignores the case and 3 (the
+	// default) compares both.
+	Strength int
+	// CaseLevel compares the case at the strength 1, so only the diacritics are ignored.
+	CaseLevel bool
+	// NumericOrdering compares the digits as numbers, so "item 9" is before "item 10".
+	NumericOrdering bool
+}
+
+// CollationDefinition is implemented by the repository definitions that compare the strings with a collation - MongoDB
+// specific. RepositoryDefinitionMap implements it with the "collation" property, with the "locale", "strength",
+// "caseLevel" and "numericOrdering" of the Collation.
+type CollationDefinition interface {
+	GetCollation() map[string]interface{}
+}
+
+// CollatedQuerier is implemented by the repositories that run a query with a collation other than the collation of
+// the repository (MongoDB):
+//
+//	var cq backends.CollatedQuerier
+//	if backends.AsRepository(userRepo, &cq) {
+//		users, err := cq.GetAllCollated(&backends.Collation{Locale: "de", Strength: 1}, nil, &User{}, "lastName", "asc", 0, 0)
+//	}
+//
+// The collation is used both to match the filter and to sort the results.
+type CollatedQuerier interface {
+	GetAllCollated(collation *Collation, filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error)
+}
+
+// GetCollation returns the collation of the repository - MongoDB specific.
+func (m RepositoryDefinitionMap) GetCollation() map[string]interface{} {
+	if collation, ok := m["collation"]; ok {
+		return collation.(map[string]interface{})
+	}
+
+	return nil
+}
+
+// repositoryCollation returns the collation of the repository, or nil if it has none.
+func repositoryCollation(repoDef RepositoryDefinition) (*Collation, error) {
+	collationDef, ok := repoDef.(CollationDefinition)
+	if !ok || collationDef.GetCollation() == nil {
+		return nil, nil
+	}
+	properties := collationDef.GetCollation()
+
+	collation := &Collation{}
+	for key, value := range properties {
+		var ok bool
+		switch key {
+		case "locale":
+			collation.Locale, ok = value.(string)
+		case "strength":
+			collation.Strength, ok = value.(int)
+		case "caseLevel":
+			collation.CaseLevel, ok = value.(bool)
+		case "numericOrdering":
+			collation.NumericOrdering, ok = value.(bool)
+		default:
+			return nil, ErrBackendError(fmt.Sprintf("unknown collation property %s", key))
+		}
+		if !ok {
+			return nil, ErrBackendError(fmt.Sprintf("invalid collation %s: %v", key, value))
+		}
+	}
+	if err := collation.validate(); err != nil {
+		return nil, ErrBackendError(err.Error())
+	}
+	return collation, nil
+}
+
+// validate checks that the collation has a locale and a valid strength.
+func (c *Collation) validate() error {
+	if c.Locale == "" {
+		return ErrInvalidInput("locale of the collation is required")
+	}
+	if c.Strength < 0 || c.Strength > 5 {
+		return ErrInvalidInput(fmt.Sprintf("strength of the collation must be between 1 and 5, got %d", c.Strength))
+	}
+	return nil
+}
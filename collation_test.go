@@ -0,0 +1,33 @@
+package backends
+
+import (
+	"testing"
+)
+
+func TestRepositoryCollation(t *testing.T) {
+	collation, err := repositoryCollation(RepositoryDefinitionMap{
+		"name":      "users",
+		"collation": map[string]interface{}{"locale": "de", "strength": 2, "numericOrdering": true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *collation != (Collation{Locale: "de", Strength: 2, NumericOrdering: true}) {
+		t.Fatal("Expected the collation of the definition. Got: ", collation)
+	}
+
+	if collation, err := repositoryCollation(RepositoryDefinitionMap{"name": "users"}); err != nil || collation != nil {
+		t.Fatal("Expected no collation. Got: ", collation, err)
+	}
+
+	for _, properties := range []map[string]interface{}{
+		{"strength": 1},
+		{"locale": "de", "strength": 6},
+		{"locale": "de", "strength": "1"},
+		{"locale": "de", "alternate": "shifted"},
+	} {
+		if _, err := repositoryCollation(RepositoryDefinitionMap{"collation": properties}); err == nil {
+			t.Fatal("Expected an error for the collation ", properties)
+		}
+	}
+}
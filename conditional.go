@@ -0,0 +1,25 @@
+package backends
+
+// ConditionalWriter is implemented by the repositories that write a record only if it matches a condition, checked
+// atomically with the write, so a record is not written over a concurrent change (for example, an order is updated
+// only while it is pending): DynamoDB, with the condition expressions of PutItem, UpdateItem and DeleteItem.
+//
+//	var writer backends.ConditionalWriter
+//	if !backends.AsRepository(repo, &writer) {
+//		return errors.New("conditional writes are not supported")
+//	}
+//	_, err := writer.SaveIf(order, backends.NewFilter().Match("id", order.ID),
+//		backends.NewFilter().Match("status", "pending"))
+//	if backends.IsErrConflict(err) {
+//		// the order is no longer pending
+//	}
+type ConditionalWriter interface {
+	// SaveIf saves the object as Save does, if the record matches the condition: the record matched by the filter,
+	// or the record with the key of the object when the filter is nil. A new record is then written over the existing
+	// one if it matches the condition, and a nil condition requires that no record has the key. Returns ErrConflict
+	// if the record does not match the condition.
+	SaveIf(object interface{}, filter Filter, condition Filter) (interface{}, error)
+	// DeleteIf deletes the record matched by the filter, if it matches the condition. Returns ErrNotFound if no
+	// record matches the filter, and ErrConflict if the record does not match the condition.
+	DeleteIf(filter Filter, condition Filter) error
+}
@@ -0,0 +1,451 @@
+package backends_test
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/JormungandrK/backends"
+	"github.com/JormungandrK/backends/backendstest"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	conformanceNeo4jNull     = "Neo4j does not store null properties, so a null property is a missing one"
+	conformanceDynamoPattern = "DynamoDB has no ends_with, so the pattern is matched with contains"
+	conformanceDynamoRegex   = "DynamoDB does not support regular expressions"
+)
+
+func TestMatcherTranslatorConformance(t *testing.T) {
+	backendstest.RunTranslatorConformance(t, &backends.MatcherTranslator{}, func(query interface{}, record map[string]interface{}) (bool, error) {
+		return query.(backends.RecordMatcher)(record), nil
+	}, nil)
+}
+
+func TestMongoQueryTranslatorConformance(t *testing.T) {
+	backendstest.RunTranslatorConformance(t, &backends.MongoQueryTranslator{}, func(query interface{}, record map[string]interface{}) (bool, error) {
+		return evalMongoQuery(query.(bson.M), record)
+	}, nil)
+}
+
+func TestDynamoQueryTranslatorConformance(t *testing.T) {
+	backendstest.RunTranslatorConformance(t, &backends.DynamoQueryTranslator{}, evalDynamoQuery, map[string]string{
+		"pattern-suffix": conformanceDynamoPattern,
+		"regex":          conformanceDynamoRegex,
+	})
+}
+
+func TestArangoQueryTranslatorConformance(t *testing.T) {
+	backendstest.RunTranslatorConformance(t, &backends.ArangoQueryTranslator{}, evalArangoQuery, nil)
+}
+
+func TestCypherQueryTranslatorConformance(t *testing.T) {
+	backendstest.RunTranslatorConformance(t, &backends.CypherQueryTranslator{}, evalCypherQuery, map[string]string{
+		"exists-null":     conformanceNeo4jNull,
+		"not-exists-null": conformanceNeo4jNull,
+		"null":            conformanceNeo4jNull,
+	})
+}
+
+// evalMongoQuery evaluates the MongoDB query on the record.
+func evalMongoQuery(query bson.M, record map[string]interface{}) (bool, error) {
+	for property, value := range query {
+		if property == "$and" {
+			for _, sub := range value.([]bson.M) {
+				if ok, err := evalMongoQuery(sub, record); err != nil || !ok {
+					return false, err
+				}
+			}
+			continue
+		}
+		spec, isSpec := value.(bson.M)
+		if !isSpec {
+			spec = bson.M{"$eq": value}
+		}
+		field, present := record[property]
+		if ok, err := evalMongoSpec(spec, field, present); err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// evalMongoSpec evaluates the operators of a MongoDB query on a field.
+func evalMongoSpec(spec bson.M, field interface{}, present bool) (bool, error) {
+	equal := func(operand interface{}) bool {
+		if operand == nil {
+			// null matches the missing fields as well
+			return !present || field == nil
+		}
+		return present && backends.EqualValues(field, operand)
+	}
+	for operator, operand := range spec {
+		if operator == "$not" {
+			ok, err := evalMongoSpec(operand.(bson.M), field, present)
+			if err != nil || ok {
+				return false, err
+			}
+			continue
+		}
+		operand, err := backends.NormalizeValue(operand)
+		if err != nil {
+			return false, err
+		}
+		var ok bool
+		switch operator {
+		case "$eq":
+			ok = equal(operand)
+		case "$ne":
+			ok = !equal(operand)
+		case "$gt", "$gte", "$lt", "$lte":
+			cmp, comparable := backends.CompareValues(field, operand)
+			ok = present && comparable && map[string]bool{"$gt": cmp > 0, "$gte": cmp >= 0, "$lt": cmp < 0, "$lte": cmp <= 0}[operator]
+		case "$in", "$nin":
+			for _, value := range operand.([]interface{}) {
+				ok = ok || equal(value)
+			}
+			ok = ok == (operator == "$in")
+		case "$exists":
+			ok = present == operand.(bool)
+		case "$type":
+			if operand != float64(10) {
+				return false, fmt.Errorf("unexpected $type %v", operand)
+			}
+			ok = present && field == nil
+		case "$regex":
+			text, isString := field.(string)
+			ok = isString && regexp.MustCompile(operand.(string)).MatchString(text)
+		default:
+			return false, fmt.Errorf("unexpected operator %s", operator)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// dynamoEvaluator evaluates a DynamoDB filter expression on a record. The "$" placeholders are the attribute names
+// and the "?" placeholders the values, taken from the args in the order of the placeholders.
+type dynamoEvaluator struct {
+	tokens []string
+	args   []interface{}
+	record map[string]interface{}
+	err    error
+}
+
+var dynamoTokens = regexp.MustCompile(`<>|<=|>=|[()=<>,$?]|[A-Za-z_]+`)
+
+func evalDynamoQuery(query interface{}, record map[string]interface{}) (bool, error) {
+	q := query.(*backends.DynamoQuery)
+	if q.Expression == "" {
+		return true, nil
+	}
+	e := &dynamoEvaluator{tokens: dynamoTokens.FindAllString(q.Expression, -1), args: q.Args, record: record}
+	ok := e.or()
+	if e.err == nil && (len(e.tokens) > 0 || len(e.args) > 0) {
+		e.err = fmt.Errorf("unexpected %v %v at the end of %s", e.tokens, e.args, q.Expression)
+	}
+	return ok, e.err
+}
+
+func (e *dynamoEvaluator) next() string {
+	if len(e.tokens) == 0 {
+		e.err = fmt.Errorf("unexpected end of the expression")
+		return ""
+	}
+	token := e.tokens[0]
+	e.tokens = e.tokens[1:]
+	return token
+}
+
+func (e *dynamoEvaluator) peek() string {
+	if len(e.tokens) == 0 {
+		return ""
+	}
+	return e.tokens[0]
+}
+
+func (e *dynamoEvaluator) expect(token string) {
+	if next := e.next(); next != token && e.err == nil {
+		e.err = fmt.Errorf("expected %s, got %s", token, next)
+	}
+}
+
+// operand returns the value of the next placeholder, and whether the attribute exists.
+func (e *dynamoEvaluator) operand() (interface{}, bool) {
+	token := e.next()
+	if len(e.args) == 0 {
+		e.err = fmt.Errorf("missing the argument of %s", token)
+		return nil, false
+	}
+	arg := e.args[0]
+	e.args = e.args[1:]
+	switch token {
+	case "$":
+		value, ok := e.record[arg.(string)]
+		return value, ok
+	case "?":
+		value, err := backends.NormalizeValue(arg)
+		if err != nil {
+			e.err = err
+		}
+		return value, true
+	}
+	e.err = fmt.Errorf("expected a placeholder, got %s", token)
+	return nil, false
+}
+
+func (e *dynamoEvaluator) or() bool {
+	ok := e.and()
+	for e.peek() == "OR" {
+		e.next()
+		other := e.and()
+		ok = ok || other
+	}
+	return ok
+}
+
+func (e *dynamoEvaluator) and() bool {
+	ok := e.not()
+	for e.peek() == "AND" {
+		e.next()
+		other := e.not()
+		ok = ok && other
+	}
+	return ok
+}
+
+func (e *dynamoEvaluator) not() bool {
+	if e.peek() == "NOT" {
+		e.next()
+		return !e.not()
+	}
+	return e.primary()
+}
+
+func (e *dynamoEvaluator) primary() bool {
+	switch function := e.peek(); function {
+	case "(":
+		e.next()
+		ok := e.or()
+		e.expect(")")
+		return ok
+	case "attribute_exists", "attribute_not_exists":
+		e.next()
+		e.expect("(")
+		_, exists := e.operand()
+		e.expect(")")
+		return exists == (function == "attribute_exists")
+	case "attribute_type", "begins_with", "contains":
+		e.next()
+		e.expect("(")
+		value, exists := e.operand()
+		e.expect(",")
+		arg, _ := e.operand()
+		e.expect(")")
+		if function == "attribute_type" {
+			return exists && arg == "NULL" && value == nil
+		}
+		text, isString := value.(string)
+		if function == "begins_with" {
+			return isString && strings.HasPrefix(text, arg.(string))
+		}
+		return isString && strings.Contains(text, arg.(string))
+	}
+
+	left, exists := e.operand()
+	operator := e.next()
+	if operator == "IN" {
+		e.expect("(")
+		in := false
+		for {
+			value, _ := e.operand()
+			in = in || (exists && backends.EqualValues(left, value))
+			if e.next() != "," {
+				break
+			}
+		}
+		return in
+	}
+	right, _ := e.operand()
+	if !exists {
+		// the comparisons with a missing attribute are false
+		return false
+	}
+	switch operator {
+	case "=":
+		return backends.EqualValues(left, right)
+	case "<>":
+		return !backends.EqualValues(left, right)
+	}
+	cmp, comparable := backends.CompareValues(left, right)
+	return comparable && map[string]bool{">": cmp > 0, ">=": cmp >= 0, "<": cmp < 0, "<=": cmp <= 0}[operator]
+}
+
+var (
+	arangoHas        = regexp.MustCompile(`^(!?)HAS\(d, @(\w+)\)$`)
+	arangoRegexTest  = regexp.MustCompile(`^REGEX_TEST\(d\.@(\w+), @(\w+)\)$`)
+	arangoComparison = regexp.MustCompile(`^d\.@(\w+) (==|!=|>=|<=|>|<|IN|NOT IN) (null|@\w+)$`)
+)
+
+// evalArangoQuery evaluates the AQL filter on the record. A missing attribute is null in AQL, and the values of
+// different types are ordered by their type (null, bool, number, string).
+func evalArangoQuery(query interface{}, record map[string]interface{}) (bool, error) {
+	q := query.(*backends.ArangoQuery)
+	if q.Filter == "" {
+		return true, nil
+	}
+	bindVar := func(name string) (interface{}, error) {
+		if name == "null" {
+			return nil, nil
+		}
+		return backends.NormalizeValue(q.BindVars[strings.TrimPrefix(name, "@")])
+	}
+
+	for _, condition := range strings.Split(strings.TrimPrefix(q.Filter, "FILTER "), " AND ") {
+		var ok bool
+		if m := arangoHas.FindStringSubmatch(condition); m != nil {
+			_, has := record[q.BindVars[m[2]].(string)]
+			ok = has == (m[1] == "")
+		} else if m := arangoRegexTest.FindStringSubmatch(condition); m != nil {
+			text, _ := record[q.BindVars[m[1]].(string)].(string)
+			ok = regexp.MustCompile(q.BindVars[m[2]].(string)).MatchString(text)
+		} else if m := arangoComparison.FindStringSubmatch(condition); m != nil {
+			value := record[q.BindVars[m[1]].(string)]
+			operand, err := bindVar(m[3])
+			if err != nil {
+				return false, err
+			}
+			switch m[2] {
+			case "IN", "NOT IN":
+				for _, item := range operand.([]interface{}) {
+					ok = ok || compareAQL(value, item) == 0
+				}
+				ok = ok == (m[2] == "IN")
+			default:
+				cmp := compareAQL(value, operand)
+				ok = map[string]bool{"==": cmp == 0, "!=": cmp != 0, ">": cmp > 0, ">=": cmp >= 0, "<": cmp < 0, "<=": cmp <= 0}[m[2]]
+			}
+		} else {
+			return false, fmt.Errorf("unexpected AQL condition %s", condition)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// compareAQL compares the values like AQL.
+func compareAQL(a, b interface{}) int {
+	rank := func(value interface{}) int {
+		switch value.(type) {
+		case nil:
+			return 0
+		case bool:
+			return 1
+		case float64:
+			return 2
+		case string:
+			return 3
+		}
+		return 4
+	}
+	if rank(a) != rank(b) {
+		return rank(a) - rank(b)
+	}
+	if a == nil {
+		return 0
+	}
+	cmp, _ := backends.CompareValues(a, b)
+	return cmp
+}
+
+var (
+	cypherNull       = regexp.MustCompile(`^n\[\$(\w+)\] IS (NOT )?NULL$`)
+	cypherComparison = regexp.MustCompile(`^n\[\$(\w+)\] (=~|=|<>|>=|<=|>|<|IN) \$(\w+)$`)
+)
+
+// evalCypherQuery evaluates the Cypher WHERE clause on the record, stored as a node. Neo4j does not store the null
+// properties, and the comparisons with null are null, which is neither true nor false.
+func evalCypherQuery(query interface{}, record map[string]interface{}) (bool, error) {
+	q := query.(*backends.CypherQuery)
+	if q.Where == "" {
+		return true, nil
+	}
+	node := map[string]interface{}{}
+	for property, value := range record {
+		if value != nil {
+			node[property] = value
+		}
+	}
+
+	for _, condition := range strings.Split(strings.TrimPrefix(q.Where, "WHERE "), " AND ") {
+		if strings.HasPrefix(condition, "(") {
+			condition = strings.TrimSuffix(strings.TrimPrefix(condition, "("), ")")
+		}
+		result := false
+		for _, alternative := range strings.Split(condition, " OR ") {
+			ok, known, err := evalCypherCondition(alternative, q.Params, node)
+			if err != nil {
+				return false, err
+			}
+			result = result || (known && ok)
+		}
+		if !result {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// evalCypherCondition evaluates the condition on the node. known is false if the result is null.
+func evalCypherCondition(condition string, params map[string]interface{}, node map[string]interface{}) (ok bool, known bool, err error) {
+	if strings.HasPrefix(condition, "NOT ") {
+		ok, known, err := evalCypherCondition(strings.TrimPrefix(condition, "NOT "), params, node)
+		return !ok, known, err
+	}
+	if m := cypherNull.FindStringSubmatch(condition); m != nil {
+		_, exists := node[params[m[1]].(string)]
+		return exists == (m[2] != ""), true, nil
+	}
+	m := cypherComparison.FindStringSubmatch(condition)
+	if m == nil {
+		return false, false, fmt.Errorf("unexpected Cypher condition %s", condition)
+	}
+	value, exists := node[params[m[1]].(string)]
+	if !exists {
+		return false, false, nil
+	}
+	operand, err := backends.NormalizeValue(params[m[3]])
+	if err != nil {
+		return false, false, err
+	}
+	switch m[2] {
+	case "=":
+		return backends.EqualValues(value, operand), true, nil
+	case "<>":
+		return !backends.EqualValues(value, operand), true, nil
+	case "=~":
+		text, isString := value.(string)
+		if !isString {
+			return false, false, nil
+		}
+		// the regular expression must match the whole value
+		return regexp.MustCompile("^(?:" + operand.(string) + ")$").MatchString(text), true, nil
+	case "IN":
+		for _, item := range operand.([]interface{}) {
+			if backends.EqualValues(value, item) {
+				return true, true, nil
+			}
+		}
+		return false, true, nil
+	}
+	cmp, comparable := backends.CompareValues(value, operand)
+	if !comparable {
+		return false, false, nil
+	}
+	return map[string]bool{">": cmp > 0, ">=": cmp >= 0, "<": cmp < 0, "<=": cmp <= 0}[m[2]], true, nil
+}
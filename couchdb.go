@@ -0,0 +1,814 @@
+package backends
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+	"github.com/satori/go.uuid"
+)
+
+// COUCHDB_CTX_KEY is CouchDB context key
+var COUCHDB_CTX_KEY = "COUCHDB_CLIENT"
+
+// couchDesignDoc is the id of the design document with the index views.
+const couchDesignDoc = "_design/backends"
+
+// couchPageSize is the number of documents fetched at once with a Mango query.
+const couchPageSize = 500
+
+// couchViewMap is the map function of an index view. It emits the values of the index fields (%s is the
+// JSON array of the field names) for the documents that have all of the fields. Nested fields are given
+// with dots, like in the filters.
+const couchViewMap = `function (doc) {
+  function get(object, path) {
+    if (path in object) return object[path];
+    var names = path.split(".");
+    for (var i = 0; i < names.length; i++) {
+      if (object === null || typeof object !== "object" || !(names[i] in object)) return undefined;
+      object = object[names[i]];
+    }
+    return object;
+  }
+  var fields = %s;
+  var key = [];
+  for (var i = 0; i < fields.length; i++) {
+    var value = get(doc, fields[i]);
+    if (value === undefined || value === null) return;
+    key.push(value);
+  }
+  emit(key, null);
+}`
+
+// CouchDBClient is a minimal CouchDB HTTP API client.
+type CouchDBClient struct {
+	url      string
+	username string
+	password string
+	client   *http.Client
+}
+
+// CouchDBCollection is a repository stored in a CouchDB database (<database>_<repository>, lowercase).
+// Every record is a document with the record key (the hash key if set, otherwise "id") as the document id.
+// The filters are translated into Mango queries. The filters with exact matches on all fields of an index
+// are served by the index views of the design document "_design/backends"; the records are then sorted and paginated
+// in memory. Unique indexes are checked before every write, but CouchDB cannot enforce them, so concurrent writes
+// may still create duplicates. TTL is not supported.
+type CouchDBCollection struct {
+	client   *CouchDBClient
+	database string
+	repoDef  RepositoryDefinition
+}
+
+// couchDocument is a CouchDB document: the record with its _id and _rev.
+type couchDocument map[string]interface{}
+
+// CouchDBQueryTranslator translates filters into CouchDB Mango selectors.
+type CouchDBQueryTranslator struct{}
+
+// Translate translates the filter AST into a Mango selector.
+func (t *CouchDBQueryTranslator) Translate(ast *FilterAST) (interface{}, error) {
+	selector := map[string]interface{}{}
+	for _, cond := range ast.Conditions {
+		spec, ok := selector[cond.Property].(map[string]interface{})
+		if !ok {
+			spec = map[string]interface{}{}
+			selector[cond.Property] = spec
+		}
+		switch cond.Operator {
+		case OpEq:
+			spec["$eq"] = cond.Value
+		case OpPattern, OpRegex:
+			if _, ok := spec["$regex"]; ok {
+				return nil, ErrInvalidInput(fmt.Sprintf("%s and %s cannot be combined on property %s", OpPattern, OpRegex, cond.Property))
+			}
+			if cond.Operator == OpPattern {
+				spec["$regex"] = toMongoPattern(cond.Value.(string))
+			} else {
+				spec["$regex"] = cond.Value
+			}
+		case OpNe, OpGt, OpGte, OpLt, OpLte, OpIn, OpNin, OpExists:
+			// the operators have the same names in Mango
+			spec[cond.Operator] = cond.Value
+		case OpNull:
+			if cond.Value.(bool) {
+				spec["$type"] = "null"
+				continue
+			}
+			if _, ok := spec["$ne"]; ok {
+				return nil, ErrInvalidInput(fmt.Sprintf("%s and %s cannot be combined on property %s", OpNull, OpNe, cond.Property))
+			}
+			// the missing fields match no operator except $exists
+			spec["$ne"] = nil
+		default:
+			return nil, ErrInvalidInput(fmt.Sprintf("operator %s is not supported by CouchDB backend", cond.Operator))
+		}
+	}
+
+	if len(selector) == 0 {
+		// match all documents
+		selector["_id"] = map[string]interface{}{"$gt": nil}
+	}
+	return selector, nil
+}
+
+var couchQueryTranslator = &CouchDBQueryTranslator{}
+
+// CouchDBRepoBuilder builds new CouchDB repository (database).
+// If the database does not exist, builder will create it, together with the index views.
+func CouchDBRepoBuilder(repoDef RepositoryDefinition, backend Backend) (Repository, error) {
+
+	clientObj := backend.GetFromContext(COUCHDB_CTX_KEY)
+	if clientObj == nil {
+		return nil, ErrBackendError("couchdb client not configured")
+	}
+
+	client, ok := clientObj.(*CouchDBClient)
+	if !ok {
+		return nil, ErrBackendError("unknown client type")
+	}
+
+	databaseName := backend.GetConfig().DatabaseName
+	if databaseName == "" {
+		return nil, ErrBackendError("database name is missing and required")
+	}
+
+	repositoryName := repoDef.GetName()
+	if repositoryName == "" {
+		return nil, ErrBackendError("repository name is missing and required")
+	}
+
+	if repoDef.EnableTTL() {
+		return nil, ErrBackendError("TTL is not supported by the couchdb backend")
+	}
+
+	collection := &CouchDBCollection{
+		client:   client,
+		database: strings.ToLower(databaseName + "_" + repositoryName),
+		repoDef:  repoDef,
+	}
+
+	status, err := client.do("PUT", "/"+url.PathEscape(collection.database), nil, nil, nil)
+	if err != nil && status != http.StatusPreconditionFailed {
+		return nil, err
+	}
+
+	if err := collection.createViews(); err != nil {
+		return nil, err
+	}
+
+	return collection, nil
+}
+
+// CouchDBBackendBuilder returns RepositoriesBackend. The host is the CouchDB URL, for example http://localhost:5984.
+func CouchDBBackendBuilder(conf *config.DBInfo, manager BackendManager) (Backend, error) {
+
+	if conf.Host == "" {
+		return nil, ErrBackendError("couchdb url is missing from config")
+	}
+
+	client := &CouchDBClient{
+		url:      strings.TrimRight(conf.Host, "/"),
+		username: conf.Username,
+		password: conf.Password,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+
+	if _, err := client.do("GET", "/", nil, nil, nil); err != nil {
+		return nil, err
+	}
+
+	ctx := context.WithValue(context.Background(), COUCHDB_CTX_KEY, client)
+	cleanup := func() {}
+
+	return NewRepositoriesBackend(ctx, conf, CouchDBRepoBuilder, cleanup), nil
+}
+
+// do sends the request with the JSON body and decodes the JSON response into the result.
+// Returns the status code, and an error if the status is not 2xx.
+func (c *CouchDBClient) do(method string, path string, query url.Values, body interface{}, result interface{}) (int, error) {
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, ErrInvalidInput(err)
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	requestURL := c.url + path
+	if len(query) > 0 {
+		requestURL += "?" + query.Encode()
+	}
+	request, err := http.NewRequest(method, requestURL, reader)
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Accept", "application/json")
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if c.username != "" {
+		request.SetBasicAuth(c.username, c.password)
+	}
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return response.StatusCode, err
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		couchError := struct {
+			Error  string `json:"error"`
+			Reason string `json:"reason"`
+		}{}
+		json.Unmarshal(data, &couchError)
+		return response.StatusCode, ErrBackendError(fmt.Sprintf("couchdb %s %s: %d %s %s", method, path, response.StatusCode, couchError.Error, couchError.Reason))
+	}
+
+	if result != nil {
+		if err := json.Unmarshal(data, result); err != nil {
+			return response.StatusCode, ErrBackendError(err)
+		}
+	}
+	return response.StatusCode, nil
+}
+
+// GetOne fetches only one record for given filter
+func (c *CouchDBCollection) GetOne(filter Filter, result interface{}) (interface{}, error) {
+	docs, err := c.find(filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, ErrNotFound("record not found")
+	}
+
+	record := docs[0].record()
+	err = MapToInterface(&record, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetAll fetches all matched records for given filter
+func (c *CouchDBCollection) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	docs, err := c.find(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []map[string]interface{}{}
+	for _, doc := range docs {
+		records = append(records, doc.record())
+	}
+
+	records, err = filterRecords(records, nil, order, sorting, limit, offset)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+
+	return recordsToResults(records, resultsTypeHint)
+}
+
+// Count returns the number of records that match the filter.
+func (c *CouchDBCollection) Count(filter Filter) (int64, error) {
+	records, err := c.find(filter)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(records)), nil
+}
+
+// Exists reports whether a record matches the filter.
+func (c *CouchDBCollection) Exists(filter Filter) (bool, error) {
+	records, err := c.find(filter)
+	if err != nil {
+		return false, err
+	}
+	return len(records) > 0, nil
+}
+
+// Save creates new record unless it does not exist, otherwise it updates the record
+func (c *CouchDBCollection) Save(object interface{}, filter Filter) (interface{}, error) {
+
+	var result interface{}
+
+	payload, err := InterfaceToMap(object)
+	if err != nil {
+		return nil, err
+	}
+
+	keyProperty := c.keyProperty()
+	doc := couchDocument{}
+
+	if filter == nil {
+		for k, v := range *payload {
+			doc[k] = v
+		}
+		if id, ok := doc[keyProperty]; !ok || id == nil || id == "" {
+			id, err := uuid.NewV4()
+			if err != nil {
+				return nil, err
+			}
+			doc[keyProperty] = id.String()
+		}
+		doc["_id"] = fmt.Sprintf("%v", doc[keyProperty])
+	} else {
+		docs, err := c.find(filter)
+		if err != nil {
+			return nil, err
+		}
+		if len(docs) == 0 {
+			return nil, ErrNotFound("record not found")
+		}
+
+		doc = docs[0]
+		c.merge(doc, *payload)
+	}
+
+	if err := c.checkUnique(doc); err != nil {
+		return nil, err
+	}
+
+	status, err := c.client.do("PUT", c.docPath(doc["_id"]), nil, doc, nil)
+	if status == http.StatusConflict {
+		if filter == nil {
+			return nil, ErrAlreadyExists("record already exists!")
+		}
+		return nil, ErrBackendError("record was modified concurrently")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	record := doc.record()
+	err = MapToInterface(&record, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// SaveAll creates the objects (a slice) as new records, in a single _bulk_docs request. Returns the created records,
+// as returned by Save. CouchDB creates the documents independently: the documents that fail (for example because a
+// document with the same id exists) are not created, and the first failure is returned with the created records.
+func (c *CouchDBCollection) SaveAll(objects interface{}) (interface{}, error) {
+	records, err := objectsToRecords(objects)
+	if err != nil {
+		return nil, err
+	}
+
+	keyProperty := c.keyProperty()
+	seen := map[string]bool{}
+	docs := []couchDocument{}
+	for _, record := range records {
+		doc := couchDocument{}
+		for k, v := range record {
+			doc[k] = v
+		}
+		if id, ok := doc[keyProperty]; !ok || id == nil || id == "" {
+			id, err := uuid.NewV4()
+			if err != nil {
+				return nil, err
+			}
+			doc[keyProperty] = id.String()
+		}
+		doc["_id"] = fmt.Sprintf("%v", doc[keyProperty])
+
+		keys := []string{"_id:" + doc["_id"].(string)}
+		for _, index := range c.repoDef.GetIndexes() {
+			if key := uniqueCouchKey(index, doc); key != "" {
+				keys = append(keys, key)
+			}
+		}
+		for _, key := range keys {
+			if seen[key] {
+				return nil, ErrAlreadyExists("record already exists!")
+			}
+			seen[key] = true
+		}
+		if err := c.checkUnique(doc); err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	if len(docs) == 0 {
+		return []interface{}{}, nil
+	}
+
+	results := []struct {
+		ID     string `json:"id"`
+		Error  string `json:"error"`
+		Reason string `json:"reason"`
+	}{}
+	if _, err := c.client.do("POST", "/"+url.PathEscape(c.database)+"/_bulk_docs", nil, map[string]interface{}{"docs": docs}, &results); err != nil {
+		return nil, err
+	}
+
+	saved := []interface{}{}
+	var failure error
+	for i, result := range results {
+		if result.Error != "" {
+			if failure == nil {
+				if result.Error == "conflict" {
+					failure = ErrAlreadyExists("record already exists!")
+				} else {
+					failure = ErrBackendError(fmt.Sprintf("failed to create %s: %s %s", result.ID, result.Error, result.Reason))
+				}
+			}
+			continue
+		}
+		record := docs[i].record()
+		var created interface{}
+		if err := MapToInterface(&record, &created); err != nil {
+			return saved, err
+		}
+		saved = append(saved, created)
+	}
+	return saved, failure
+}
+
+// UpdateAll updates all matched records for given filter with the properties of the update, in a single
+// _bulk_docs request. Returns the number of the updated records. The documents that fail to update (for example
+// because they were modified concurrently) are not counted, and the first failure is returned as an error.
+func (c *CouchDBCollection) UpdateAll(filter Filter, update interface{}) (int64, error) {
+	payload, err := InterfaceToMap(update)
+	if err != nil {
+		return 0, err
+	}
+
+	docs, err := c.find(filter)
+	if err != nil {
+		return 0, err
+	}
+	if len(docs) == 0 {
+		return 0, nil
+	}
+
+	seen := map[string]bool{}
+	updated := []couchDocument{}
+	for _, doc := range docs {
+		c.merge(doc, *payload)
+		for _, index := range c.repoDef.GetIndexes() {
+			key := uniqueCouchKey(index, doc)
+			if key == "" {
+				continue
+			}
+			if seen[key] {
+				return 0, ErrAlreadyExists("record already exists!")
+			}
+			seen[key] = true
+		}
+		if err := c.checkUnique(doc); err != nil {
+			return 0, err
+		}
+		updated = append(updated, doc)
+	}
+
+	results := []struct {
+		ID     string `json:"id"`
+		Error  string `json:"error"`
+		Reason string `json:"reason"`
+	}{}
+	if _, err := c.client.do("POST", "/"+url.PathEscape(c.database)+"/_bulk_docs", nil, map[string]interface{}{"docs": updated}, &results); err != nil {
+		return 0, err
+	}
+
+	var count int64
+	var failure error
+	for _, result := range results {
+		if result.Error != "" {
+			if failure == nil {
+				failure = ErrBackendError(fmt.Sprintf("failed to update %s: %s %s", result.ID, result.Error, result.Reason))
+			}
+			continue
+		}
+		count++
+	}
+	return count, failure
+}
+
+// merge sets the properties of the payload on the document, except the key and the CouchDB metadata.
+func (c *CouchDBCollection) merge(doc couchDocument, payload map[string]interface{}) {
+	keyProperty := c.keyProperty()
+	for k, v := range payload {
+		if k == keyProperty || k == "_id" || k == "_rev" {
+			// the key is immutable
+			continue
+		}
+		doc[k] = v
+	}
+}
+
+// DeleteOne deletes only one record for given filter
+func (c *CouchDBCollection) DeleteOne(filter Filter) error {
+	docs, err := c.find(filter)
+	if err != nil {
+		return err
+	}
+	if len(docs) == 0 {
+		return ErrNotFound("record not found")
+	}
+
+	_, err = c.client.do("DELETE", c.docPath(docs[0]["_id"]), url.Values{"rev": {fmt.Sprintf("%v", docs[0]["_rev"])}}, nil, nil)
+	return err
+}
+
+// DeleteAll deletes all matched records for given filter
+func (c *CouchDBCollection) DeleteAll(filter Filter) error {
+	docs, err := c.find(filter)
+	if err != nil {
+		return err
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+
+	deleted := []map[string]interface{}{}
+	for _, doc := range docs {
+		deleted = append(deleted, map[string]interface{}{
+			"_id":      doc["_id"],
+			"_rev":     doc["_rev"],
+			"_deleted": true,
+		})
+	}
+
+	results := []struct {
+		ID     string `json:"id"`
+		Error  string `json:"error"`
+		Reason string `json:"reason"`
+	}{}
+	if _, err := c.client.do("POST", "/"+url.PathEscape(c.database)+"/_bulk_docs", nil, map[string]interface{}{"docs": deleted}, &results); err != nil {
+		return err
+	}
+	for _, result := range results {
+		if result.Error != "" {
+			return ErrBackendError(fmt.Sprintf("failed to delete %s: %s %s", result.ID, result.Error, result.Reason))
+		}
+	}
+	return nil
+}
+
+// keyProperty returns the name of the property used as record key - the hash key if set, otherwise "id".
+func (c *CouchDBCollection) keyProperty() string {
+	if hashKey := c.repoDef.GetHashKey(); hashKey != "" {
+		return hashKey
+	}
+	return "id"
+}
+
+// docPath returns the path of the document with the given id.
+func (c *CouchDBCollection) docPath(id interface{}) string {
+	return "/" + url.PathEscape(c.database) + "/" + url.PathEscape(fmt.Sprintf("%v", id))
+}
+
+// viewName returns the name of the view of the index.
+func (c *CouchDBCollection) viewName(index Index) string {
+	return "idx_" + index.GetName()
+}
+
+// createViews creates (or updates) the design document with a view for every index of the repository.
+func (c *CouchDBCollection) createViews() error {
+	indexes := c.repoDef.GetIndexes()
+	if len(indexes) == 0 {
+		return nil
+	}
+
+	views := map[string]interface{}{}
+	for _, index := range indexes {
+		fields, err := json.Marshal(index.GetFields())
+		if err != nil {
+			return err
+		}
+		views[c.viewName(index)] = map[string]interface{}{
+			"map": fmt.Sprintf(couchViewMap, string(fields)),
+		}
+	}
+
+	design := map[string]interface{}{}
+	status, err := c.client.do("GET", "/"+url.PathEscape(c.database)+"/"+couchDesignDoc, nil, nil, &design)
+	if err != nil && status != http.StatusNotFound {
+		return err
+	}
+	if status != http.StatusNotFound {
+		existing, _ := normalizeValue(design["views"])
+		expected, _ := normalizeValue(views)
+		if reflect.DeepEqual(existing, expected) {
+			return nil
+		}
+	}
+
+	design["_id"] = couchDesignDoc
+	design["language"] = "javascript"
+	design["views"] = views
+	_, err = c.client.do("PUT", "/"+url.PathEscape(c.database)+"/"+couchDesignDoc, nil, design, nil)
+	return err
+}
+
+// indexFor returns the index that can serve the filter - the filter must have exact matches on all fields of the index.
+// Unique indexes are preferred. Returns nil if there is no such index.
+func (c *CouchDBCollection) indexFor(filter Filter) Index {
+	var found Index
+	for _, index := range c.repoDef.GetIndexes() {
+		covered := len(index.GetFields()) > 0
+		for _, field := range index.GetFields() {
+			value, ok := filter[field]
+			if !ok || isFilterSpec(value) {
+				covered = false
+				break
+			}
+		}
+		if covered && (found == nil || (index.Unique() && !found.Unique())) {
+			found = index
+		}
+	}
+	return found
+}
+
+// checkUnique returns ErrAlreadyExists if another document has the same values of the fields of a unique index.
+func (c *CouchDBCollection) checkUnique(doc couchDocument) error {
+	for _, index := range c.repoDef.GetIndexes() {
+		key := couchIndexKey(index, doc)
+		if !index.Unique() || key == nil {
+			continue
+		}
+
+		docs, err := c.view(index, key)
+		if err != nil {
+			return err
+		}
+		for _, other := range docs {
+			if other["_id"] != doc["_id"] {
+				return ErrAlreadyExists("record already exists!")
+			}
+		}
+	}
+	return nil
+}
+
+// couchIndexKey returns the view key of the index for the document, or nil if the document has no value for one
+// of the fields of the index.
+func couchIndexKey(index Index, doc couchDocument) []interface{} {
+	key := []interface{}{}
+	for _, field := range index.GetFields() {
+		value, ok := lookupPath(doc, field)
+		if !ok || value == nil {
+			return nil
+		}
+		key = append(key, value)
+	}
+	return key
+}
+
+// uniqueCouchKey returns a string form of the unique index key of the document, to detect the documents of a bulk
+// update that would get the same key. Returns an empty string for a non-unique index.
+func uniqueCouchKey(index Index, doc couchDocument) string {
+	key := couchIndexKey(index, doc)
+	if !index.Unique() || key == nil {
+		return ""
+	}
+	encoded, _ := json.Marshal(key)
+	return index.GetName() + string(encoded)
+}
+
+// view returns the documents of the index view with the given key.
+func (c *CouchDBCollection) view(index Index, key []interface{}) ([]couchDocument, error) {
+	encodedKey, err := json.Marshal(key)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+
+	response := struct {
+		Rows []struct {
+			Doc couchDocument `json:"doc"`
+		} `json:"rows"`
+	}{}
+	path := "/" + url.PathEscape(c.database) + "/" + couchDesignDoc + "/_view/" + url.PathEscape(c.viewName(index))
+	if _, err := c.client.do("GET", path, url.Values{"key": {string(encodedKey)}, "include_docs": {"true"}}, nil, &response); err != nil {
+		return nil, err
+	}
+
+	docs := []couchDocument{}
+	for _, row := range response.Rows {
+		if row.Doc != nil {
+			docs = append(docs, row.Doc)
+		}
+	}
+	return docs, nil
+}
+
+// find returns the documents that match the filter.
+// If the filter has an exact match on the key, only that document is fetched. If the filter is covered by an index,
+// the index view is used. Otherwise, the documents are found with a Mango query.
+func (c *CouchDBCollection) find(filter Filter) ([]couchDocument, error) {
+	matcher, err := toRecordMatcher(filter)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+
+	var candidates []couchDocument
+
+	if key, ok := filter[c.keyProperty()]; ok && !isFilterSpec(key) {
+		doc := couchDocument{}
+		status, err := c.client.do("GET", c.docPath(key), nil, nil, &doc)
+		if status == http.StatusNotFound {
+			return []couchDocument{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		candidates = []couchDocument{doc}
+	} else if index := c.indexFor(filter); index != nil {
+		key := []interface{}{}
+		for _, field := range index.GetFields() {
+			key = append(key, filter[field])
+		}
+		candidates, err = c.view(index, key)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		selector, err := TranslateFilter(filter, couchQueryTranslator)
+		if err != nil {
+			return nil, err
+		}
+		candidates, err = c.query(selector)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	docs := []couchDocument{}
+	for _, doc := range candidates {
+		if id, _ := doc["_id"].(string); strings.HasPrefix(id, "_design/") {
+			continue
+		}
+		if matcher(doc.record()) {
+			docs = append(docs, doc)
+		}
+	}
+	return docs, nil
+}
+
+// query returns all documents that match the Mango selector, paging with bookmarks.
+func (c *CouchDBCollection) query(selector interface{}) ([]couchDocument, error) {
+	docs := []couchDocument{}
+	bookmark := ""
+	for {
+		request := map[string]interface{}{
+			"selector": selector,
+			"limit":    couchPageSize,
+		}
+		if bookmark != "" {
+			request["bookmark"] = bookmark
+		}
+
+		response := struct {
+			Docs     []couchDocument `json:"docs"`
+			Bookmark string          `json:"bookmark"`
+		}{}
+		if _, err := c.client.do("POST", "/"+url.PathEscape(c.database)+"/_find", nil, request, &response); err != nil {
+			return nil, err
+		}
+
+		docs = append(docs, response.Docs...)
+		if len(response.Docs) < couchPageSize || response.Bookmark == "" {
+			return docs, nil
+		}
+		bookmark = response.Bookmark
+	}
+}
+
+// record returns the record stored in the document, without the CouchDB properties.
+func (d couchDocument) record() map[string]interface{} {
+	record := map[string]interface{}{}
+	for k, v := range d {
+		if k == "_id" || k == "_rev" {
+			continue
+		}
+		record[k] = v
+	}
+	return record
+}
@@ -0,0 +1,146 @@
+package backends
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func TestCouchDBQueryTranslator(t *testing.T) {
+	selector, err := TranslateFilter(NewFilter().MatchPattern("name", "John%").Match("role", "user"), couchQueryTranslator)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"name": map[string]interface{}{"$regex": "^John.*"},
+		"role": map[string]interface{}{"$eq": "user"},
+	}
+	if !reflect.DeepEqual(selector, expected) {
+		t.Fatal("Unexpected selector: ", selector)
+	}
+
+	selector, err = TranslateFilter(nil, couchQueryTranslator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(selector, map[string]interface{}{"_id": map[string]interface{}{"$gt": nil}}) {
+		t.Fatal("Expected a selector matching all documents. Got: ", selector)
+	}
+
+	_, err = TranslateFilter(Filter{"name": map[string]interface{}{"$pattern": "J%", "$regex": "^J"}}, couchQueryTranslator)
+	if err == nil {
+		t.Fatal("Expected error when combining $pattern and $regex")
+	}
+}
+
+func TestCouchDBIndexFor(t *testing.T) {
+	coll := &CouchDBCollection{
+		repoDef: RepositoryDefinitionMap{
+			"name":    "users",
+			"indexes": []Index{NewNonUniqueIndex("org"), NewUniqueIndex("org", "email")},
+		},
+	}
+
+	if index := coll.indexFor(NewFilter().Match("org", "a").Match("email", "a@example.com")); index == nil || !index.Unique() {
+		t.Fatal("Expected the unique index. Got: ", index)
+	}
+	if index := coll.indexFor(NewFilter().Match("org", "a")); index == nil || index.Unique() {
+		t.Fatal("Expected the org index. Got: ", index)
+	}
+	if index := coll.indexFor(NewFilter().MatchPattern("org", "a%")); index != nil {
+		t.Fatal("Expected no index for a pattern. Got: ", index)
+	}
+	if coll.keyProperty() != "id" {
+		t.Fatal("Expected id to be the key property. Got: ", coll.keyProperty())
+	}
+}
+
+func TestCouchDBRepoBuilder(t *testing.T) {
+	backend := NewRepositoriesBackend(context.Background(), &config.DBInfo{DatabaseName: "testdb"}, CouchDBRepoBuilder, nil)
+	if _, err := backend.DefineRepository("users", RepositoryDefinitionMap{"name": "users"}); err == nil {
+		t.Fatal("Expected error when couchdb client is not configured")
+	}
+}
+
+func TestCouchDBIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode.")
+	}
+
+	bm := NewBackendSupport(map[string]*config.DBInfo{
+		"couchdb": &config.DBInfo{
+			DatabaseName: "testdb",
+			Host:         "http://localhost:5984",
+			Username:     "admin",
+			Password:     "password",
+		},
+	})
+
+	backend, err := bm.GetBackend("couchdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := backend.DefineRepository("test_users", RepositoryDefinitionMap{
+		"name":    "test_users",
+		"indexes": []Index{NewUniqueIndex("email"), NewNonUniqueIndex("role")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.DeleteAll(nil)
+
+	for _, user := range []map[string]interface{}{
+		{"id": "1", "email": "alice@example.com", "role": "admin", "name": "Alice"},
+		{"id": "2", "email": "bob@example.com", "role": "user", "name": "Bob"},
+		{"id": "3", "email": "carol@example.com", "role": "admin", "name": "Carol"},
+	} {
+		if _, err := repo.Save(&user, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := repo.Save(&map[string]interface{}{"id": "1"}, nil); err == nil || err.Error() != "already exists" {
+		t.Fatal("Expected already exists error for the duplicate id, got", err)
+	}
+	if _, err := repo.Save(&map[string]interface{}{"email": "bob@example.com"}, nil); err == nil || err.Error() != "already exists" {
+		t.Fatal("Expected already exists error for the duplicate email, got", err)
+	}
+
+	results, err := repo.GetAll(NewFilter().Match("role", "admin"), &map[string]interface{}{}, "name", "desc", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list := *results.(*[]*map[string]interface{}); len(list) != 2 || (*list[0])["id"] != "3" {
+		t.Fatal("Expected carol and alice, got", list)
+	}
+
+	results, err = repo.GetAll(NewFilter().MatchPattern("name", "%o%"), &map[string]interface{}{}, "", "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list := *results.(*[]*map[string]interface{}); len(list) != 2 {
+		t.Fatal("Expected bob and carol, got", list)
+	}
+
+	if _, err := repo.Save(&map[string]interface{}{"role": "admin"}, NewFilter().Match("email", "bob@example.com")); err != nil {
+		t.Fatal(err)
+	}
+	result, err := repo.GetOne(NewFilter().Match("id", "2"), &map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (*result.(*map[string]interface{}))["role"] != "admin" {
+		t.Fatal("Expected bob to be admin, got", result)
+	}
+
+	if err := repo.DeleteOne(NewFilter().Match("id", "1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetOne(NewFilter().Match("id", "1"), &map[string]interface{}{}); err == nil || err.Error() != "not found" {
+		t.Fatal("Expected not found error, got", err)
+	}
+}
@@ -0,0 +1,55 @@
+package backends
+
+// EstimatedCounter is implemented by the repositories that estimate the number of all their records from the
+// metadata, without reading the records (MongoDB and DynamoDB).
+type EstimatedCounter interface {
+	EstimatedCount() (int64, error)
+}
+
+// countOptions holds the options of CountRecords.
+type countOptions struct {
+	estimated bool
+}
+
+// CountOption configures CountRecords.
+type CountOption func(o *countOptions)
+
+// Estimated allows CountRecords to estimate the count of all records from the metadata of the repository, instead of
+// counting them. The estimate may be stale (DynamoDB updates it approximately every six hours) and is used only if
+// the filter is empty.
+func Estimated() CountOption {
+	return func(o *countOptions) {
+		o.estimated = true
+	}
+}
+
+// CountRecords counts the records matched by the filter, with Repository.Count. With the Estimated option, the count
+// of all records is estimated, so a dashboard does not scan the whole table:
+//
+//	total, err := backends.CountRecords(userRepo, nil, backends.Estimated())
+//	active, err := backends.CountRecords(userRepo, backends.NewFilter().Match("status", "active"))
+//
+// The estimate is taken from EstimatedCounter, or from the statistics of the repository (see StatsRepository). The
+// filtered counts are always exact.
+func CountRecords(repo Repository, filter Filter, opts ...CountOption) (int64, error) {
+	options := &countOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if options.estimated && len(filter) == 0 {
+		var counter EstimatedCounter
+		if AsRepository(repo, &counter) {
+			return counter.EstimatedCount()
+		}
+		var statsRepo StatsRepository
+		if AsRepository(repo, &statsRepo) {
+			stats, err := statsRepo.Stats()
+			if err != nil {
+				return 0, err
+			}
+			return stats.Records, nil
+		}
+	}
+	return repo.Count(filter)
+}
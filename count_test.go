@@ -0,0 +1,60 @@
+package backends
+
+import (
+	"fmt"
+	"testing"
+)
+
+type estimatingRepository struct {
+	Repository
+	estimate int64
+}
+
+func (r *estimatingRepository) EstimatedCount() (int64, error) {
+	return r.estimate, nil
+}
+
+func TestCountRecords(t *testing.T) {
+	repo, shutdown := newACLTestRepository(t)
+	defer shutdown()
+
+	for i := 0; i < 10; i++ {
+		if _, err := repo.Save(&map[string]interface{}{"id": fmt.Sprintf("%d", i), "even": i%2 == 0}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	estimating := &estimatingRepository{Repository: repo, estimate: 12}
+	count, err := CountRecords(estimating, nil, Estimated())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 12 {
+		t.Fatal("Expected the estimated count. Got: ", count)
+	}
+
+	count, err = CountRecords(estimating, NewFilter().Match("even", true), Estimated())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 5 {
+		t.Fatal("Expected the exact count for a filter. Got: ", count)
+	}
+
+	count, err = CountRecords(estimating, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 10 {
+		t.Fatal("Expected the exact count without the Estimated option. Got: ", count)
+	}
+
+	// the cache reports its statistics
+	count, err = CountRecords(repo, NewFilter(), Estimated())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 10 {
+		t.Fatal("Expected the count from the statistics. Got: ", count)
+	}
+}
@@ -0,0 +1,87 @@
+package backends
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+)
+
+// CursorRepository is implemented by the repositories that continue a read where the previous page stopped, instead
+// of skipping the records of the previous pages: DynamoDB, with the LastEvaluatedKey of the scans and the queries.
+type CursorRepository interface {
+	GetAllAfter(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, pageToken string) (interface{}, string, error)
+}
+
+// offsetPageToken is the page token of the repositories that don't implement CursorRepository.
+type offsetPageToken struct {
+	Offset int `json:"offset"`
+}
+
+// GetAllAfter fetches at most limit matched records after the page token, and returns the token of the next page.
+// The first page is fetched with an empty token, and the token of the last page is empty:
+//
+//	token := ""
+//	for {
+//		users, next, err := backends.GetAllAfter(userRepo, filter, &User{}, "", "", 100, token)
+//		...
+//		if next == "" {
+//			break
+//		}
+//		token = next
+//	}
+//
+// The page tokens are opaque, and are valid only with the same filter and order. If the repository implements
+// CursorRepository, the read continues after the last record of the previous page, so a page costs the same however
+// deep it is. Otherwise the token holds the offset of the next page. Limit 0 fetches all remaining records.
+// Returns ErrInvalidInput if the page token is invalid.
+func GetAllAfter(repo Repository, filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, pageToken string) (interface{}, string, error) {
+	if limit < 0 {
+		return nil, "", ErrInvalidInput("limit must not be negative")
+	}
+	var cursorRepo CursorRepository
+	if AsRepository(repo, &cursorRepo) {
+		return cursorRepo.GetAllAfter(filter, resultsTypeHint, order, sorting, limit, pageToken)
+	}
+
+	token := offsetPageToken{}
+	if pageToken != "" {
+		if err := decodePageToken(pageToken, &token); err != nil || token.Offset < 0 {
+			return nil, "", ErrInvalidInput("invalid page token")
+		}
+	}
+	results, err := repo.GetAll(filter, resultsTypeHint, order, sorting, limit, token.Offset)
+	if err != nil {
+		return nil, "", err
+	}
+
+	count := 0
+	if value := reflect.Indirect(reflect.ValueOf(results)); value.Kind() == reflect.Slice {
+		count = value.Len()
+	}
+	if limit == 0 || count < limit {
+		return results, "", nil
+	}
+	next, err := encodePageToken(offsetPageToken{Offset: token.Offset + count})
+	if err != nil {
+		return nil, "", err
+	}
+	return results, next, nil
+}
+
+// encodePageToken encodes the value as an opaque page token.
+func encodePageToken(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodePageToken decodes the page token of encodePageToken into the value.
+func decodePageToken(pageToken string, value interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(pageToken)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
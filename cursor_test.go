@@ -0,0 +1,40 @@
+package backends
+
+import "testing"
+
+func TestGetAllAfter(t *testing.T) {
+	repo := newTestRepository()
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		if _, err := repo.Save(map[string]interface{}{"id": id}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids := []string{}
+	token := ""
+	pages := 0
+	for {
+		results, next, err := GetAllAfter(repo, nil, &map[string]interface{}{}, "id", "asc", 2, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, record := range *results.(*[]*map[string]interface{}) {
+			ids = append(ids, (*record)["id"].(string))
+		}
+		pages++
+		if next == "" {
+			break
+		}
+		token = next
+	}
+	if pages != 3 || len(ids) != 5 || ids[0] != "1" || ids[4] != "5" {
+		t.Fatalf("Expected 5 records in 3 pages. Got %v in %d pages", ids, pages)
+	}
+
+	if _, next, err := GetAllAfter(repo, nil, &map[string]interface{}{}, "id", "asc", 0, ""); err != nil || next != "" {
+		t.Fatal("Expected all records without a next page. Got: ", next, err)
+	}
+	if _, _, err := GetAllAfter(repo, nil, &map[string]interface{}{}, "id", "asc", 2, "not a token"); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input error for an invalid token. Got: ", err)
+	}
+}
@@ -0,0 +1,383 @@
+package backends
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"time"
+	"unicode/utf8"
+)
+
+// The types of the values of a DataSchema.
+const (
+	SchemaString  = "string"
+	SchemaNumber  = "number"
+	SchemaInteger = "integer"
+	SchemaBoolean = "boolean"
+	SchemaDate    = "date"
+	SchemaObject  = "object"
+	SchemaArray   = "array"
+)
+
+// DataSchema is the schema of the records of a repository, or of a value of a record. It is a subset of JSON Schema
+// that both this package and the databases can check:
+//
+//	userRepo, err := backend.DefineRepository("users", backends.RepositoryDefinitionMap{
+//		"name": "users",
+//	}.WithDataSchema(&backends.DataSchema{
+//		Type:     backends.SchemaObject,
+//		Required: []string{"email", "status"},
+//		Properties: map[string]*backends.DataSchema{
+//			"email":  {Type: backends.SchemaString, Pattern: "^[^@]+@[^@]+$"},
+//			"status": {Type: backends.SchemaString, Enum: []interface{}{"active", "invited"}},
+//			"age":    {Type: backends.SchemaInteger, Minimum: backends.SchemaLimit(0), Nullable: true},
+//		},
+//	}))
+//
+// The schema describes the records as they are stored, so the enum fields are codes and the versioned records have
+// the version property. The properties that are not declared may have any value.
+type DataSchema struct {
+	// Type is the type of the value (SchemaString, SchemaNumber, ...). Any type is valid if it is empty.
+	Type string
+	// Nullable allows null (a nil value) in addition to the type.
+	Nullable bool
+	// Properties are the schemas of the properties of an object.
+	Properties map[string]*DataSchema
+	// Required are the properties that an object must have.
+	Required []string
+	// Items is the schema of the items of an array.
+	Items *DataSchema
+	// Enum are the allowed values.
+	Enum []interface{}
+	// Minimum and Maximum are the inclusive limits of a number, if set.
+	Minimum *float64
+	Maximum *float64
+	// MinLength and MaxLength are the limits of the number of characters of a string. 0 means no limit.
+	MinLength int
+	MaxLength int
+	// Pattern is the regular expression that a string must match.
+	Pattern string
+}
+
+// DataSchemaDefinition is implemented by the repository definitions that have a schema of their records.
+// RepositoryDefinitionMap implements it - see RepositoryDefinitionMap.WithDataSchema.
+type DataSchemaDefinition interface {
+	GetDataSchema() *DataSchema
+}
+
+// SchemaLimit returns a pointer to the limit, for the Minimum and the Maximum of a DataSchema.
+func SchemaLimit(limit float64) *float64 {
+	return &limit
+}
+
+// WithDataSchema attaches the schema of the records to the repository. The records are validated against it when
+// they are written (see DataSchemaRepository), and MongoDB creates the collection with the schema as its $jsonSchema
+// validator, so the server rejects the invalid writes of the other clients too.
+func (m RepositoryDefinitionMap) WithDataSchema(schema *DataSchema) RepositoryDefinitionMap {
+	m["dataSchema"] = schema
+	return m
+}
+
+// GetDataSchema returns the schema of the records of the repository, or nil if there is no schema.
+func (m RepositoryDefinitionMap) GetDataSchema() *DataSchema {
+	schema, _ := m["dataSchema"].(*DataSchema)
+	return schema
+}
+
+// repositoryDataSchema returns the schema of the records of the repository, or nil if it has none.
+func repositoryDataSchema(repoDef RepositoryDefinition) (*DataSchema, error) {
+	schemaDef, ok := repoDef.(DataSchemaDefinition)
+	if !ok || schemaDef.GetDataSchema() == nil {
+		return nil, nil
+	}
+	schema := schemaDef.GetDataSchema()
+	if schema.Type != SchemaObject {
+		return nil, ErrBackendError("data schema of the records must be an object")
+	}
+	if err := schema.check("record"); err != nil {
+		return nil, ErrBackendError(err.Error())
+	}
+	return schema, nil
+}
+
+// DataSchemaRepository is a Repository that validates the records against the schema before they are written.
+// Returns ErrInvalidInput for an invalid record.
+type DataSchemaRepository struct {
+	Repository
+	schema *DataSchema
+}
+
+// NewDataSchemaRepository wraps the repository so the records are validated against the schema when written.
+func NewDataSchemaRepository(repo Repository, schema *DataSchema) Repository {
+	return &DataSchemaRepository{
+		Repository: repo,
+		schema:     schema,
+	}
+}
+
+// withDataSchema wraps the repository with DataSchemaRepository if the definition has a schema of the records.
+func withDataSchema(repo Repository, def RepositoryDefinition) (Repository, error) {
+	schema, err := repositoryDataSchema(def)
+	if err != nil || schema == nil {
+		return repo, err
+	}
+	return NewDataSchemaRepository(repo, schema), nil
+}
+
+// wrapped returns the wrapped repository, so the transactions can wrap their repository the same way.
+func (r *DataSchemaRepository) wrapped() Repository {
+	return r.Repository
+}
+
+// Save validates the object and saves it. A new record (nil filter) must have the required properties, while an
+// update only sets the properties of the object, so only they are validated.
+func (r *DataSchemaRepository) Save(object interface{}, filter Filter) (interface{}, error) {
+	payload, err := InterfaceToMap(object)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.schema.validateProperties("", *payload, filter == nil); err != nil {
+		return nil, err
+	}
+	return r.Repository.Save(object, filter)
+}
+
+// SaveAll validates the objects, which are created as new records, and saves them.
+func (r *DataSchemaRepository) SaveAll(objects interface{}) (interface{}, error) {
+	records, err := objectsToRecords(objects)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		if err := r.schema.validateProperties("", record, true); err != nil {
+			return nil, err
+		}
+	}
+	return r.Repository.SaveAll(objects)
+}
+
+// UpdateAll validates the properties of the update, and updates all records that match the filter.
+func (r *DataSchemaRepository) UpdateAll(filter Filter, update interface{}) (int64, error) {
+	payload, err := InterfaceToMap(update)
+	if err != nil {
+		return 0, err
+	}
+	if err := r.schema.validateProperties("", *payload, false); err != nil {
+		return 0, err
+	}
+	return r.Repository.UpdateAll(filter, update)
+}
+
+// Validate checks the record against the schema. Returns ErrInvalidInput naming the first invalid property.
+func (s *DataSchema) Validate(record map[string]interface{}) error {
+	if err := s.check("record"); err != nil {
+		return ErrInvalidInput(err.Error())
+	}
+	return s.validateProperties("", record, true)
+}
+
+// validateProperties checks the properties of the record, named with the prefix, and that the record has the
+// required properties if complete is set.
+func (s *DataSchema) validateProperties(prefix string, record map[string]interface{}, complete bool) error {
+	if complete {
+		for _, property := range s.Required {
+			if _, ok := record[property]; !ok {
+				return ErrInvalidInput(fmt.Sprintf("%s%s is required", prefix, property))
+			}
+		}
+	}
+	for property, value := range record {
+		if schema, ok := s.Properties[property]; ok {
+			if err := schema.validate(prefix+property, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validate checks the value at the path against the schema.
+func (s *DataSchema) validate(path string, value interface{}) error {
+	v := reflect.ValueOf(value)
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			v = reflect.Value{}
+			break
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		if s.Nullable || s.Type == "" {
+			return nil
+		}
+		return ErrInvalidInput(fmt.Sprintf("%s must not be null", path))
+	}
+
+	if s.Type != "" && !schemaTypeOf(s.Type, v) {
+		return ErrInvalidInput(fmt.Sprintf("%s must be of type %s", path, s.Type))
+	}
+	if len(s.Enum) > 0 {
+		allowed := false
+		for _, option := range s.Enum {
+			if sameSchemaValue(option, v.Interface()) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return ErrInvalidInput(fmt.Sprintf("%s must be one of %v", path, s.Enum))
+		}
+	}
+
+	switch {
+	case isSchemaNumber(v):
+		number := schemaNumber(v)
+		if s.Minimum != nil && number < *s.Minimum {
+			return ErrInvalidInput(fmt.Sprintf("%s must be at least %v", path, *s.Minimum))
+		}
+		if s.Maximum != nil && number > *s.Maximum {
+			return ErrInvalidInput(fmt.Sprintf("%s must be at most %v", path, *s.Maximum))
+		}
+	case v.Kind() == reflect.String:
+		length := utf8.RuneCountInString(v.String())
+		if length < s.MinLength {
+			return ErrInvalidInput(fmt.Sprintf("%s must have at least %d characters", path, s.MinLength))
+		}
+		if s.MaxLength > 0 && length > s.MaxLength {
+			return ErrInvalidInput(fmt.Sprintf("%s must have at most %d characters", path, s.MaxLength))
+		}
+		if s.Pattern != "" && !regexp.MustCompile(s.Pattern).MatchString(v.String()) {
+			return ErrInvalidInput(fmt.Sprintf("%s must match %s", path, s.Pattern))
+		}
+	case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+		if s.Items != nil {
+			for i := 0; i < v.Len(); i++ {
+				if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), v.Index(i).Interface()); err != nil {
+					return err
+				}
+			}
+		}
+	case v.Kind() == reflect.Map || (v.Kind() == reflect.Struct && v.Type() != reflect.TypeOf(time.Time{})):
+		if len(s.Properties) > 0 || len(s.Required) > 0 {
+			record, err := schemaRecord(v)
+			if err != nil {
+				return ErrInvalidInput(fmt.Sprintf("%s: %s", path, err.Error()))
+			}
+			return s.validateProperties(path+".", record, true)
+		}
+	}
+	return nil
+}
+
+// check checks that the schema at the path is valid: the types are known, and the patterns are valid regular
+// expressions.
+func (s *DataSchema) check(path string) error {
+	switch s.Type {
+	case "", SchemaString, SchemaNumber, SchemaInteger, SchemaBoolean, SchemaDate, SchemaObject, SchemaArray:
+	default:
+		return fmt.Errorf("unknown type %s of %s", s.Type, path)
+	}
+	if s.Pattern != "" {
+		if _, err := regexp.Compile(s.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern of %s: %s", path, err.Error())
+		}
+	}
+	if s.MinLength < 0 || s.MaxLength < 0 || (s.MaxLength > 0 && s.MinLength > s.MaxLength) {
+		return fmt.Errorf("invalid length limits of %s", path)
+	}
+	if s.Minimum != nil && s.Maximum != nil && *s.Minimum > *s.Maximum {
+		return fmt.Errorf("minimum of %s is greater than its maximum", path)
+	}
+	if s.Items != nil {
+		if err := s.Items.check(path + "[]"); err != nil {
+			return err
+		}
+	}
+	for property, schema := range s.Properties {
+		if schema == nil {
+			return fmt.Errorf("schema of %s.%s is missing", path, property)
+		}
+		if err := schema.check(path + "." + property); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// schemaTypeOf reports whether the value is of the schema type. The integers must be of an integer type, as the
+// databases store the floats as floats even without a fraction.
+func schemaTypeOf(schemaType string, v reflect.Value) bool {
+	switch schemaType {
+	case SchemaString:
+		return v.Kind() == reflect.String
+	case SchemaNumber:
+		return isSchemaNumber(v)
+	case SchemaInteger:
+		return isSchemaNumber(v) && v.Kind() != reflect.Float32 && v.Kind() != reflect.Float64
+	case SchemaBoolean:
+		return v.Kind() == reflect.Bool
+	case SchemaDate:
+		return v.Type() == reflect.TypeOf(time.Time{})
+	case SchemaObject:
+		return v.Kind() == reflect.Map || (v.Kind() == reflect.Struct && v.Type() != reflect.TypeOf(time.Time{}))
+	case SchemaArray:
+		return (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Type().Elem().Kind() != reflect.Uint8
+	}
+	return false
+}
+
+// isSchemaNumber reports whether the value is a number.
+func isSchemaNumber(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// schemaNumber returns the number as a float64.
+func schemaNumber(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	}
+	return v.Float()
+}
+
+// sameSchemaValue reports whether the values are equal. The numbers are compared by their value, whatever their type.
+func sameSchemaValue(a interface{}, b interface{}) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.IsValid() && vb.IsValid() && isSchemaNumber(va) && isSchemaNumber(vb) {
+		return schemaNumber(va) == schemaNumber(vb)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// schemaRecord returns the properties of the object (a map or a struct), named as they are stored.
+func schemaRecord(v reflect.Value) (map[string]interface{}, error) {
+	if record, ok := v.Interface().(map[string]interface{}); ok {
+		return record, nil
+	}
+	if v.Kind() == reflect.Map {
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("keys of the object must be strings")
+		}
+		record := map[string]interface{}{}
+		for _, key := range v.MapKeys() {
+			record[key.String()] = v.MapIndex(key).Interface()
+		}
+		return record, nil
+	}
+	// InterfaceToMap needs a pointer
+	ptr := reflect.New(v.Type())
+	ptr.Elem().Set(v)
+	record, err := InterfaceToMap(ptr.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return *record, nil
+}
@@ -0,0 +1,166 @@
+package backends
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+type schemaAddress struct {
+	City string `json:"city"`
+	Zip  string `json:"zip"`
+}
+
+func testDataSchema() *DataSchema {
+	return &DataSchema{
+		Type:     SchemaObject,
+		Required: []string{"email", "status"},
+		Properties: map[string]*DataSchema{
+			"email":     {Type: SchemaString, Pattern: "^[^@]+@[^@]+$", MaxLength: 20},
+			"status":    {Type: SchemaString, Enum: []interface{}{"active", "invited"}},
+			"age":       {Type: SchemaInteger, Minimum: SchemaLimit(0), Maximum: SchemaLimit(150), Nullable: true},
+			"score":     {Type: SchemaNumber},
+			"level":     {Enum: []interface{}{1, 2, 3}},
+			"createdAt": {Type: SchemaDate},
+			"tags":      {Type: SchemaArray, Items: &DataSchema{Type: SchemaString, MinLength: 2}},
+			"address": {
+				Type:       SchemaObject,
+				Required:   []string{"city"},
+				Properties: map[string]*DataSchema{"zip": {Type: SchemaString, MinLength: 4, MaxLength: 5}},
+			},
+		},
+	}
+}
+
+func TestDataSchemaValidate(t *testing.T) {
+	schema := testDataSchema()
+	valid := map[string]interface{}{
+		"email":     "john@example.com",
+		"status":    "active",
+		"age":       42,
+		"score":     9.5,
+		"level":     float64(2),
+		"createdAt": time.Now(),
+		"tags":      []string{"admin", "ops"},
+		"address":   &schemaAddress{City: "Skopje", Zip: "1000"},
+		"nickname":  true,
+	}
+	if err := schema.Validate(valid); err != nil {
+		t.Fatal(err)
+	}
+
+	var noAge *int
+	for property, value := range map[string]interface{}{
+		"age":     noAge,
+		"address": map[string]interface{}{"city": "Skopje"},
+	} {
+		record := copyRecord(valid)
+		record[property] = value
+		if err := schema.Validate(record); err != nil {
+			t.Fatalf("Expected %s %v to be valid. Got: %v", property, value, err)
+		}
+	}
+
+	for property, value := range map[string]interface{}{
+		"email":     "john",
+		"status":    "deleted",
+		"age":       -1,
+		"score":     "high",
+		"level":     4,
+		"createdAt": "2020-01-01",
+		"tags":      []string{"admin", "x"},
+		"address":   &schemaAddress{City: "Skopje", Zip: "100"},
+	} {
+		record := copyRecord(valid)
+		record[property] = value
+		if err := schema.Validate(record); !IsErrInvalidInput(err) {
+			t.Fatalf("Expected ErrInvalidInput for %s %v. Got: %v", property, value, err)
+		}
+	}
+	for property, value := range map[string]interface{}{
+		"age":     4.0,
+		"status":  nil,
+		"email":   "a.very.long.address@example.com",
+		"address": map[string]interface{}{"zip": "1000"},
+	} {
+		record := copyRecord(valid)
+		record[property] = value
+		if err := schema.Validate(record); !IsErrInvalidInput(err) {
+			t.Fatalf("Expected ErrInvalidInput for %s %v. Got: %v", property, value, err)
+		}
+	}
+
+	record := copyRecord(valid)
+	delete(record, "status")
+	if err := schema.Validate(record); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput without a required property. Got: ", err)
+	}
+}
+
+func copyRecord(record map[string]interface{}) map[string]interface{} {
+	copied := map[string]interface{}{}
+	for property, value := range record {
+		copied[property] = value
+	}
+	return copied
+}
+
+func TestRepositoryDataSchema(t *testing.T) {
+	if schema, err := repositoryDataSchema(RepositoryDefinitionMap{"name": "users"}); err != nil || schema != nil {
+		t.Fatal("Expected no schema. Got: ", schema, err)
+	}
+	for _, schema := range []*DataSchema{
+		{Type: SchemaString},
+		{Type: SchemaObject, Properties: map[string]*DataSchema{"age": {Type: "int"}}},
+		{Type: SchemaObject, Properties: map[string]*DataSchema{"email": {Pattern: "("}}},
+		{Type: SchemaObject, Properties: map[string]*DataSchema{"age": {Minimum: SchemaLimit(10), Maximum: SchemaLimit(1)}}},
+		{Type: SchemaObject, Properties: map[string]*DataSchema{"name": {MinLength: 5, MaxLength: 2}}},
+		{Type: SchemaObject, Properties: map[string]*DataSchema{"tags": {Items: &DataSchema{Type: "text"}}}},
+		{Type: SchemaObject, Properties: map[string]*DataSchema{"name": nil}},
+	} {
+		if _, err := repositoryDataSchema(RepositoryDefinitionMap{"name": "users"}.WithDataSchema(schema)); err == nil {
+			t.Fatal("Expected an error for the schema ", schema)
+		}
+	}
+}
+
+func TestDataSchemaRepository(t *testing.T) {
+	backend, err := CacheBackendBuilder(&config.DBInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Shutdown()
+
+	repo, err := backend.DefineRepository("users", RepositoryDefinitionMap{"name": "users"}.WithDataSchema(testDataSchema()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Save(&map[string]interface{}{"id": "john", "email": "john@example.com"}, nil); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for a new record without a required property. Got: ", err)
+	}
+	if _, err := repo.Save(&map[string]interface{}{"id": "john", "email": "john@example.com", "status": "invited"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// an update only sets some properties
+	john := NewFilter().Match("id", "john")
+	if _, err := repo.Save(&map[string]interface{}{"status": "active"}, john); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Save(&map[string]interface{}{"status": "deleted"}, john); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for an invalid update. Got: ", err)
+	}
+	if _, err := repo.UpdateAll(nil, &map[string]interface{}{"age": -1}); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for an invalid update of all records. Got: ", err)
+	}
+	if _, err := repo.SaveAll([]map[string]interface{}{
+		{"id": "jane", "email": "jane@example.com", "status": "active"},
+		{"id": "joe", "email": "joe"},
+	}); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for an invalid record of the batch. Got: ", err)
+	}
+	if count, err := repo.Count(nil); err != nil || count != 1 {
+		t.Fatal("Expected no record of the invalid batch to be saved. Got: ", count, err)
+	}
+}
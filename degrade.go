@@ -0,0 +1,246 @@
+package backends
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// DegradationAlert is raised when a backend is switched to read-only because of the write failures, and again when
+// it is writable again.
+type DegradationAlert struct {
+	// ReadOnly is true if the backend was switched to read-only, false if it recovered.
+	ReadOnly bool
+	// Failures is the number of consecutive write failures that switched the backend to read-only.
+	Failures int
+	// LastError is the error of the last failed write.
+	LastError error
+	// At is the time of the switch.
+	At time.Time
+}
+
+// DegradationOptions configures a DegradableBackend.
+type DegradationOptions struct {
+	// FailureThreshold is the number of consecutive failed writes that switch the backend to read-only. Any write
+	// that is not a failure (see IsFailure) resets the count. Default is 5.
+	FailureThreshold int
+	// RecoveryInterval is the time after which a read-only backend lets a single write through, to check whether
+	// the primary has recovered. If the write succeeds, the backend is writable again. Default is one minute.
+	RecoveryInterval time.Duration
+	// IsFailure decides whether the error of a write counts as a failure of the backend. Default is every error,
+	// except the errors caused by the caller (ErrNotFound, ErrAlreadyExists, ErrInvalidInput, ErrForbidden and
+	// ErrNotSupported).
+	IsFailure func(err error) bool
+	// OnAlert is called when the backend is switched to read-only and when it recovers. Default is to log the
+	// switch.
+	OnAlert func(alert *DegradationAlert)
+}
+
+// DegradableBackend is a Backend that switches to read-only when the writes keep failing. While read-only, the
+// reads are served as usual and the writes are rejected immediately with ErrReadOnly, instead of every request
+// waiting for a degraded primary to time out.
+type DegradableBackend struct {
+	Backend
+	options   *DegradationOptions
+	mutex     *sync.Mutex
+	failures  int
+	readOnly  bool
+	manual    bool
+	probing   bool
+	lastCheck time.Time
+}
+
+// NewDegradableBackend wraps the backend so that persistent write failures switch it to read-only:
+//
+//	backend = backends.NewDegradableBackend(backend, &backends.DegradationOptions{
+//		FailureThreshold: 10,
+//		OnAlert: func(alert *backends.DegradationAlert) {
+//			pager.Notify("users backend read-only: %v", alert.LastError)
+//		},
+//	})
+//
+// The backend recovers on its own: every RecoveryInterval a single write is let through, and the backend is writable
+// again once a write succeeds.
+func NewDegradableBackend(backend Backend, options *DegradationOptions) *DegradableBackend {
+	if options == nil {
+		options = &DegradationOptions{}
+	}
+	if options.FailureThreshold < 1 {
+		options.FailureThreshold = 5
+	}
+	if options.RecoveryInterval <= 0 {
+		options.RecoveryInterval = time.Minute
+	}
+	if options.IsFailure == nil {
+		options.IsFailure = isBackendFailure
+	}
+	if options.OnAlert == nil {
+		options.OnAlert = func(alert *DegradationAlert) {
+			if alert.ReadOnly {
+				log.Printf("WARN: backend switched to read-only after %d failed writes: %v\n", alert.Failures, alert.LastError)
+			} else {
+				log.Println("INFO: backend is writable again")
+			}
+		}
+	}
+	return &DegradableBackend{
+		Backend: backend,
+		options: options,
+		mutex:   &sync.Mutex{},
+	}
+}
+
+// isBackendFailure returns false for the errors caused by the caller, and true for all other errors.
+func isBackendFailure(err error) bool {
+	for _, callerErr := range []error{ErrNotFound(""), ErrAlreadyExists(""), ErrInvalidInput(""), ErrForbidden(""), ErrNotSupported(""), ErrReadOnly("")} {
+		if IsErrorOfType(err, callerErr) {
+			return false
+		}
+	}
+	return true
+}
+
+// DefineRepository defines the repository (collection/table) on the underlying backend.
+func (b *DegradableBackend) DefineRepository(name string, def RepositoryDefinition) (Repository, error) {
+	repo, err := b.Backend.DefineRepository(name, def)
+	if err != nil {
+		return nil, err
+	}
+	return &DegradableRepository{Repository: repo, backend: b}, nil
+}
+
+// GetRepository return the repository (collection/table) from the underlying backend.
+func (b *DegradableBackend) GetRepository(name string) (Repository, error) {
+	repo, err := b.Backend.GetRepository(name)
+	if err != nil {
+		return nil, err
+	}
+	return &DegradableRepository{Repository: repo, backend: b}, nil
+}
+
+// ReadOnly reports whether the backend is read-only.
+func (b *DegradableBackend) ReadOnly() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.readOnly
+}
+
+// SetReadOnly switches the backend to read-only or back to writable manually, for example for a maintenance
+// window. A backend switched to read-only manually does not recover on its own.
+func (b *DegradableBackend) SetReadOnly(readOnly bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.readOnly = readOnly
+	b.manual = readOnly
+	b.failures = 0
+	b.probing = false
+}
+
+// acquire checks whether a write can be executed. Returns ErrReadOnly if the backend is read-only. The second value
+// is true if the write is the recovery check.
+func (b *DegradableBackend) acquire() (bool, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if !b.readOnly {
+		return false, nil
+	}
+	if b.manual || b.probing || time.Since(b.lastCheck) < b.options.RecoveryInterval {
+		return false, ErrReadOnly("backend is read-only")
+	}
+	b.probing = true
+	b.lastCheck = time.Now()
+	return true, nil
+}
+
+// release records the outcome of a write.
+func (b *DegradableBackend) release(probe bool, err error) {
+	var alert *DegradationAlert
+
+	b.mutex.Lock()
+	if probe {
+		b.probing = false
+	}
+	if err != nil && b.options.IsFailure(err) {
+		b.failures++
+		if !b.readOnly && b.failures >= b.options.FailureThreshold {
+			b.readOnly = true
+			b.lastCheck = time.Now()
+			alert = &DegradationAlert{ReadOnly: true, Failures: b.failures, LastError: err, At: b.lastCheck}
+		}
+	} else {
+		b.failures = 0
+		if b.readOnly && probe {
+			b.readOnly = false
+			alert = &DegradationAlert{ReadOnly: false, At: time.Now()}
+		}
+	}
+	b.mutex.Unlock()
+
+	// no lock is held while calling out
+	if alert != nil {
+		b.options.OnAlert(alert)
+	}
+}
+
+// write runs the write operation, unless the backend is read-only.
+func (b *DegradableBackend) write(operation func() error) error {
+	probe, err := b.acquire()
+	if err != nil {
+		return err
+	}
+	err = operation()
+	b.release(probe, err)
+	return err
+}
+
+// DegradableRepository is a Repository of a DegradableBackend. The writes are rejected with ErrReadOnly while the
+// backend is read-only.
+type DegradableRepository struct {
+	Repository
+	backend *DegradableBackend
+}
+
+// Save creates new record unless it does not exist, otherwise it updates the record
+func (r *DegradableRepository) Save(object interface{}, filter Filter) (interface{}, error) {
+	var result interface{}
+	err := r.backend.write(func() (err error) {
+		result, err = r.Repository.Save(object, filter)
+		return err
+	})
+	return result, err
+}
+
+// SaveAll creates the objects as new records
+func (r *DegradableRepository) SaveAll(objects interface{}) (interface{}, error) {
+	var result interface{}
+	err := r.backend.write(func() (err error) {
+		result, err = r.Repository.SaveAll(objects)
+		return err
+	})
+	return result, err
+}
+
+// UpdateAll updates all matched records for given filter
+func (r *DegradableRepository) UpdateAll(filter Filter, update interface{}) (int64, error) {
+	var updated int64
+	err := r.backend.write(func() (err error) {
+		updated, err = r.Repository.UpdateAll(filter, update)
+		return err
+	})
+	return updated, err
+}
+
+// DeleteOne deletes only one record for given filter
+func (r *DegradableRepository) DeleteOne(filter Filter) error {
+	return r.backend.write(func() error {
+		return r.Repository.DeleteOne(filter)
+	})
+}
+
+// DeleteAll deletes all matched records for given filter
+func (r *DegradableRepository) DeleteAll(filter Filter) error {
+	return r.backend.write(func() error {
+		return r.Repository.DeleteAll(filter)
+	})
+}
@@ -0,0 +1,98 @@
+package backends
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+// flakyRepository is a test repository whose Save fails while fail is set.
+type flakyRepository struct {
+	*testRepository
+	fail bool
+}
+
+func (r *flakyRepository) Save(object interface{}, filter Filter) (interface{}, error) {
+	if r.fail {
+		return nil, ErrBackendError("write timed out")
+	}
+	return r.testRepository.Save(object, filter)
+}
+
+func TestDegradableBackend(t *testing.T) {
+	flaky := &flakyRepository{testRepository: newTestRepository()}
+	alerts := []*DegradationAlert{}
+	backend := NewDegradableBackend(NewRepositoriesBackend(context.Background(), &config.DBInfo{}, func(def RepositoryDefinition, backend Backend) (Repository, error) {
+		return flaky, nil
+	}, nil), &DegradationOptions{
+		FailureThreshold: 3,
+		RecoveryInterval: 20 * time.Millisecond,
+		OnAlert: func(alert *DegradationAlert) {
+			alerts = append(alerts, alert)
+		},
+	})
+	repo, err := backend.DefineRepository("users", RepositoryDefinitionMap{"name": "users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := repo.Save(&map[string]interface{}{"id": "1"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	flaky.fail = true
+	for i := 0; i < 5; i++ {
+		if i == 2 {
+			// the backend responds, so the failures are not consecutive
+			if err := repo.DeleteOne(NewFilter().Match("id", "x")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := repo.Save(&map[string]interface{}{"id": "2"}, nil); err == nil || IsErrReadOnly(err) {
+			t.Fatal("Expected the write to fail. Got: ", err)
+		}
+	}
+	if !backend.ReadOnly() || len(alerts) != 1 || !alerts[0].ReadOnly || alerts[0].Failures != 3 {
+		t.Fatal("Expected the backend to be switched to read-only. Got: ", alerts)
+	}
+
+	if _, err := repo.Save(&map[string]interface{}{"id": "2"}, nil); err == nil || !IsErrReadOnly(err) {
+		t.Fatal("Expected read only error. Got: ", err)
+	}
+	if err := repo.DeleteAll(nil); err == nil || !IsErrReadOnly(err) {
+		t.Fatal("Expected read only error. Got: ", err)
+	}
+	if _, err := repo.Count(nil); err != nil {
+		t.Fatal("Expected the reads to be served. Got: ", err)
+	}
+
+	// the recovery check fails, so the backend stays read-only
+	time.Sleep(25 * time.Millisecond)
+	if _, err := repo.Save(&map[string]interface{}{"id": "2"}, nil); err == nil || IsErrReadOnly(err) {
+		t.Fatal("Expected the recovery check to reach the backend. Got: ", err)
+	}
+	if !backend.ReadOnly() {
+		t.Fatal("Expected the backend to stay read-only")
+	}
+
+	flaky.fail = false
+	time.Sleep(25 * time.Millisecond)
+	if _, err := repo.Save(&map[string]interface{}{"id": "2"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if backend.ReadOnly() || len(alerts) != 2 || alerts[1].ReadOnly {
+		t.Fatal("Expected the backend to recover. Got: ", alerts)
+	}
+
+	backend.SetReadOnly(true)
+	time.Sleep(25 * time.Millisecond)
+	if err := repo.DeleteOne(NewFilter().Match("id", "2")); err == nil || !IsErrReadOnly(err) {
+		t.Fatal("Expected the backend switched manually not to recover on its own. Got: ", err)
+	}
+	backend.SetReadOnly(false)
+	if err := repo.DeleteOne(NewFilter().Match("id", "2")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,170 @@
+package backends
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/Microkubes/microservice-tools/config"
+
+	"gopkg.in/mgo.v2"
+)
+
+// DOCUMENTDB_CTX_KEY is the context key that switches the MongoDB backend to Amazon DocumentDB mode
+var DOCUMENTDB_CTX_KEY = "DOCUMENTDB_MODE"
+
+// DefaultDocumentDBCAFile is the path of the RDS CA bundle used to verify the DocumentDB certificates,
+// unless DOCUMENTDB_CA_FILE environment variable is set.
+// The bundle can be downloaded from https://truststore.pki.rds.amazonaws.com/global/global-bundle.pem
+var DefaultDocumentDBCAFile = "rds-combined-ca-bundle.pem"
+
+// documentDBUnsupportedCodes are the error codes DocumentDB returns for the unsupported index options:
+// BadValue, CannotCreateIndex, CommandNotSupported and DocumentDB's "Feature not supported".
+var documentDBUnsupportedCodes = map[int]bool{
+	2:   true,
+	67:  true,
+	115: true,
+	303: true,
+}
+
+// DocumentDBBackendBuilder returns RepositoriesBackend for Amazon DocumentDB. The CA bundle is read from
+// DOCUMENTDB_CA_FILE environment variable, or DefaultDocumentDBCAFile.
+func DocumentDBBackendBuilder(conf *config.DBInfo, manager BackendManager) (Backend, error) {
+	caFile := os.Getenv("DOCUMENTDB_CA_FILE")
+	if caFile == "" {
+		caFile = DefaultDocumentDBCAFile
+	}
+	return NewDocumentDBBackendBuilder(caFile)(conf, manager)
+}
+
+// NewDocumentDBBackendBuilder returns a BackendBuilder for Amazon DocumentDB that verifies the server certificates
+// with the CA bundle in caFile.
+//
+// DocumentDB is used through the MongoDB backend, with these differences:
+//   - TLS is mandatory.
+//   - Retryable writes are not used (the driver never retries the writes).
+//   - The index options that DocumentDB does not support (dropDups, background) are not sent, and if DocumentDB
+//     rejects a sparse index, it is created without the sparse option.
+func NewDocumentDBBackendBuilder(caFile string) BackendBuilder {
+	return func(conf *config.DBInfo, manager BackendManager) (Backend, error) {
+		tlsConfig, err := documentDBTLSConfig(caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		session, err := NewDocumentDBSession(conf.Host, conf.Username, conf.Password, conf.DatabaseName, tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		driver := newMongoDriver(conf, tlsConfig)
+		registry := &mongoSessionRegistry{mutex: &sync.Mutex{}}
+		ctx := context.WithValue(context.Background(), MONGO_CTX_KEY, session)
+		ctx = context.WithValue(ctx, DOCUMENTDB_CTX_KEY, true)
+		ctx = context.WithValue(ctx, MONGO_SESSIONS_CTX_KEY, registry)
+		ctx = context.WithValue(ctx, MONGO_CLIENT_CTX_KEY, driver)
+		done := make(chan struct{})
+		go watchSession(session, done)
+		cleanup := func() {
+			close(done)
+			registry.close()
+			session.Close()
+			driver.disconnect()
+		}
+
+		return NewRepositoriesBackend(ctx, conf, MongoDBRepoBuilder, cleanup), nil
+	}
+}
+
+// NewDocumentDBSession returns a new Mongo Session to Amazon DocumentDB, over TLS. The host may list the instances
+// of the cluster like for NewSession, for example "rs0/docdb-1:27017,docdb-2:27017".
+func NewDocumentDBSession(Host string, Username string, Password string, Database string, tlsConfig *tls.Config) (*mgo.Session, error) {
+
+	info, err := mongoDialInfo(Host, Username, Password, Database)
+	if err != nil {
+		return nil, err
+	}
+	info.DialServer = func(addr *mgo.ServerAddr) (net.Conn, error) {
+		return tls.Dial("tcp", addr.String(), tlsConfig)
+	}
+
+	session, err := mgo.DialWithInfo(info)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := configureMongoSession(session, Host); err != nil {
+		session.Close()
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// documentDBTLSConfig returns the TLS configuration that trusts the certificates of the CA bundle.
+func documentDBTLSConfig(caFile string) (*tls.Config, error) {
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, ErrBackendError("failed to read the DocumentDB CA bundle: " + err.Error())
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(pem) {
+		return nil, ErrBackendError("no certificates found in the DocumentDB CA bundle " + caFile)
+	}
+
+	return &tls.Config{
+		RootCAs: roots,
+	}, nil
+}
+
+// ensureDocumentDBIndex creates the index on DocumentDB, downgrading the options that DocumentDB does not support.
+func ensureDocumentDBIndex(collection *mgo.Collection, index mgo.Index) error {
+	variants := documentDBIndexVariants(index)
+	for i, variant := range variants {
+		err := collection.EnsureIndex(variant)
+		if err == nil {
+			return nil
+		}
+		if qe, ok := err.(*mgo.QueryError); ok && qe.Code == 85 {
+			// IndexOptionsConflict - the index already exists
+			log.Println("WARN: The index already exists and will not be updated. DocumentDB error: ", err.Error())
+			return nil
+		}
+		if i == len(variants)-1 || !isDocumentDBUnsupported(err) {
+			return err
+		}
+		log.Println("WARN: DocumentDB does not support the index options, creating the index without them. DocumentDB error: ", err.Error())
+	}
+	return nil
+}
+
+// documentDBIndexVariants returns the index to create on DocumentDB, followed by the downgraded variants of it
+// to try if DocumentDB rejects the index options.
+func documentDBIndexVariants(index mgo.Index) []mgo.Index {
+	// not supported by DocumentDB
+	index.DropDups = false
+	index.Background = false
+
+	variants := []mgo.Index{index}
+	if index.Sparse {
+		downgraded := index
+		downgraded.Sparse = false
+		variants = append(variants, downgraded)
+	}
+	return variants
+}
+
+// isDocumentDBUnsupported checks if the error is DocumentDB rejecting an unsupported option.
+func isDocumentDBUnsupported(err error) bool {
+	if qe, ok := err.(*mgo.QueryError); ok && documentDBUnsupportedCodes[qe.Code] {
+		return true
+	}
+	return strings.Contains(strings.ToLower(err.Error()), "not supported")
+}
@@ -0,0 +1,111 @@
+package backends
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2"
+)
+
+func writeTestCABundle(t *testing.T) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := ioutil.TempFile("", "ca-bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := pem.Encode(file, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+		t.Fatal(err)
+	}
+	return file.Name()
+}
+
+func TestDocumentDBTLSConfig(t *testing.T) {
+	caFile := writeTestCABundle(t)
+	defer os.Remove(caFile)
+
+	tlsConfig, err := documentDBTLSConfig(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsConfig.RootCAs == nil {
+		t.Fatal("Expected the CA bundle to be trusted")
+	}
+
+	if _, err := documentDBTLSConfig(caFile + ".missing"); err == nil {
+		t.Fatal("Expected error for a missing CA bundle")
+	}
+
+	empty, err := ioutil.TempFile("", "ca-bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty.Close()
+	defer os.Remove(empty.Name())
+	if _, err := documentDBTLSConfig(empty.Name()); err == nil {
+		t.Fatal("Expected error for a CA bundle without certificates")
+	}
+}
+
+func TestDocumentDBIndexVariants(t *testing.T) {
+	variants := documentDBIndexVariants(mgo.Index{
+		Key:        []string{"email"},
+		Unique:     true,
+		DropDups:   true,
+		Background: true,
+		Sparse:     true,
+	})
+	if len(variants) != 2 {
+		t.Fatal("Expected the index and a variant without sparse, got", variants)
+	}
+	if variants[0].DropDups || variants[0].Background || !variants[0].Sparse || !variants[0].Unique {
+		t.Fatal("Expected the unsupported options to be removed, got", variants[0])
+	}
+	if variants[1].Sparse || !variants[1].Unique {
+		t.Fatal("Expected a unique index without sparse, got", variants[1])
+	}
+
+	if variants := documentDBIndexVariants(mgo.Index{Key: []string{"email"}}); len(variants) != 1 {
+		t.Fatal("Expected no downgraded variants, got", variants)
+	}
+}
+
+func TestIsDocumentDBUnsupported(t *testing.T) {
+	if !isDocumentDBUnsupported(&mgo.QueryError{Code: 303, Message: "Feature not supported: dropDups"}) {
+		t.Fatal("Expected feature not supported error to be recognized")
+	}
+	if isDocumentDBUnsupported(&mgo.QueryError{Code: 11000, Message: "duplicate key"}) {
+		t.Fatal("Expected duplicate key error not to be recognized")
+	}
+}
+
+func TestDocumentDBBackendBuilder(t *testing.T) {
+	if _, err := NewDocumentDBBackendBuilder("missing-ca-bundle.pem")(nil, nil); err == nil {
+		t.Fatal("Expected error when the CA bundle is missing")
+	}
+}
@@ -2,31 +2,274 @@ package backends
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"math/rand"
+	"net/url"
+	"os"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Microkubes/microservice-tools/config"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
-	"github.com/guregu/dynamo"
+	"github.com/aws/aws-dax-go-v2/dax"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/ratelimit"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/applicationautoscaling"
+	autoscalingtypes "github.com/aws/aws-sdk-go-v2/service/applicationautoscaling/types"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	streamstypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
 	"github.com/satori/go.uuid"
 )
 
 // DYNAMO_CTX_KEY is dynamoDB context key
 var DYNAMO_CTX_KEY = "DYNAMO_SESSION"
 
-// DynamoCollection wraps a dynamo.Table to embed methods in models.
+// DYNAMO_AUTOSCALING_CTX_KEY is the context key of the Application Auto Scaling client of the dynamoDB backend
+var DYNAMO_AUTOSCALING_CTX_KEY = "DYNAMO_AUTOSCALING"
+
+// DYNAMO_STREAMS_CTX_KEY is the context key of the DynamoDB Streams client of the dynamoDB backend
+var DYNAMO_STREAMS_CTX_KEY = "DYNAMO_STREAMS"
+
+// DYNAMO_DAX_CTX_KEY is the context key of the DAX client of the dynamoDB backend
+var DYNAMO_DAX_CTX_KEY = "DYNAMO_DAX"
+
+// DYNAMO_ENCRYPTION_CTX_KEY is the context key of the default encryption of the tables of the dynamoDB backend
+var DYNAMO_ENCRYPTION_CTX_KEY = "DYNAMO_ENCRYPTION"
+
+// DYNAMO_RECONCILE_CTX_KEY is the context key of the DynamoReconcileMode of the dynamoDB backend
+var DYNAMO_RECONCILE_CTX_KEY = "DYNAMO_RECONCILE"
+
+// dynamoRequestTimeout is the timeout for a single request to DynamoDB.
+const dynamoRequestTimeout = 30 * time.Second
+
+// dynamoTableWaitTimeout is the maximal time to wait for a new table to become active.
+const dynamoTableWaitTimeout = 5 * time.Minute
+
+// dynamoBatchWriteSize is the maximal number of items in a BatchWriteItem request.
+const dynamoBatchWriteSize = 25
+
+// dynamoBatchWriteRetries is the number of times the unprocessed items of a BatchWriteItem request are resent.
+const dynamoBatchWriteRetries = 5
+
+// dynamoBatchGetSize is the maximal number of keys in a BatchGetItem request.
+const dynamoBatchGetSize = 100
+
+// dynamoBatchStatementSize is the maximal number of statements in a BatchExecuteStatement request.
+const dynamoBatchStatementSize = 25
+
+// dynamoMaxInValues is the maximal number of values of the IN comparator of an expression.
+const dynamoMaxInValues = 100
+
+// dynamoTransactionSize is the maximal number of items written in a TransactWriteItems request.
+const dynamoTransactionSize = 100
+
+// dynamoTransactionRetries is the number of times a transaction is run when the written items were modified
+// concurrently.
+const dynamoTransactionRetries = 3
+
+// dynamoMaxLSI is the maximal number of the LSIs of a table.
+const dynamoMaxLSI = 5
+
+// dynamoDefaultTargetUtilization is the default target utilization (in percent) of the auto scaled capacity.
+const dynamoDefaultTargetUtilization = 70
+
+// dynamoStreamPollInterval is the time to wait before reading a shard of a stream again when it had no new records.
+const dynamoStreamPollInterval = time.Second
+
+// dynamoStreamDescribeInterval is the interval of checking a stream for new shards.
+const dynamoStreamDescribeInterval = 30 * time.Second
+
+// dynamoChildrenRetries is the number of times a modification of the children is retried when the array was
+// modified concurrently.
+const dynamoChildrenRetries = 3
+
+const (
+	// dynamoEncryptionAWSOwned encrypts a table with a key owned by DynamoDB.
+	dynamoEncryptionAWSOwned = "AWS_OWNED"
+	// dynamoEncryptionAWSManaged encrypts a table with the AWS managed KMS key of DynamoDB.
+	dynamoEncryptionAWSManaged = "AWS_MANAGED"
+)
+
+// DynamoDefinition is implemented by the repository definitions with the settings of the DynamoDB tables.
+// RepositoryDefinitionMap implements it with the "LSI", "autoScaling", "enableStream", "streamViewType", "encryption"
+// and "pointInTimeRecovery" properties.
+type DynamoDefinition interface {
+	GetLSI() map[string]interface{}
+	GetAutoScaling() map[string]interface{}
+	EnableStream() bool
+	GetStreamViewType() string
+	GetEncryption() string
+	EnablePointInTimeRecovery() bool
+}
+
+// GetLSI returns local secondary indexes - AWS DynamoDB specific. The keys are the range keys of the indexes.
+func (m RepositoryDefinitionMap) GetLSI() map[string]interface{} {
+	if lsi, ok := m["LSI"]; ok {
+		return lsi.(map[string]interface{})
+	}
+
+	return nil
+}
+
+// GetAutoScaling returns the auto scaling of the read and the write capacity - AWS DynamoDB specific. It has the
+// "minCapacity", the "maxCapacity" and the "targetUtilization" (in percent) of the capacity.
+func (m RepositoryDefinitionMap) GetAutoScaling() map[string]interface{} {
+	if autoScaling, ok := m["autoScaling"]; ok {
+		return autoScaling.(map[string]interface{})
+	}
+
+	return nil
+}
+
+// EnableStream returns whether the changes of the table are streamed - AWS DynamoDB specific.
+func (m RepositoryDefinitionMap) EnableStream() bool {
+	if streamEnabled, ok := m["enableStream"]; ok {
+		return streamEnabled.(bool)
+	}
+
+	return false
+}
+
+// GetStreamViewType returns what the stream records of the table hold - AWS DynamoDB specific. Type may be
+// "KEYS_ONLY", "NEW_IMAGE", "OLD_IMAGE" or "NEW_AND_OLD_IMAGES".
+func (m RepositoryDefinitionMap) GetStreamViewType() string {
+	if streamViewType, ok := m["streamViewType"]; ok {
+		return streamViewType.(string)
+	}
+
+	return ""
+}
+
+// GetEncryption returns the encryption at rest of the table - AWS DynamoDB specific. Encryption may be "AWS_OWNED",
+// "AWS_MANAGED" or the ID, ARN or alias of a customer managed KMS key.
+func (m RepositoryDefinitionMap) GetEncryption() string {
+	if encryption, ok := m["encryption"]; ok {
+		return encryption.(string)
+	}
+
+	return ""
+}
+
+// EnablePointInTimeRecovery returns whether the point-in-time recovery of the table is enabled - AWS DynamoDB
+// specific.
+func (m RepositoryDefinitionMap) EnablePointInTimeRecovery() bool {
+	if pointInTimeRecovery, ok := m["pointInTimeRecovery"]; ok {
+		return pointInTimeRecovery.(bool)
+	}
+
+	return false
+}
+
+// dynamoDefinition returns the DynamoDB settings of the definition, which are all unset if the definition does not
+// implement DynamoDefinition.
+func dynamoDefinition(repoDef RepositoryDefinition) DynamoDefinition {
+	if dynamoDef, ok := repoDef.(DynamoDefinition); ok {
+		return dynamoDef
+	}
+	return RepositoryDefinitionMap{}
+}
+
+// DynamoDBAPI is the part of the DynamoDB client (*dynamodb.Client) used by the backend.
+type DynamoDBAPI interface {
+	ListTables(ctx context.Context, params *dynamodb.ListTablesInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ListTablesOutput, error)
+	CreateTable(ctx context.Context, params *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error)
+	DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error)
+	UpdateTimeToLive(ctx context.Context, params *dynamodb.UpdateTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTimeToLiveOutput, error)
+	DescribeTimeToLive(ctx context.Context, params *dynamodb.DescribeTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTimeToLiveOutput, error)
+	UpdateTable(ctx context.Context, params *dynamodb.UpdateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTableOutput, error)
+	UpdateContinuousBackups(ctx context.Context, params *dynamodb.UpdateContinuousBackupsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateContinuousBackupsOutput, error)
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+	BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
+	TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+	BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error)
+	ExecuteStatement(ctx context.Context, params *dynamodb.ExecuteStatementInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ExecuteStatementOutput, error)
+	BatchExecuteStatement(ctx context.Context, params *dynamodb.BatchExecuteStatementInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchExecuteStatementOutput, error)
+}
+
+// DynamoAutoScalingAPI is the part of the Application Auto Scaling client (*applicationautoscaling.Client) used to scale
+// the capacity of the tables and their GSIs.
+type DynamoAutoScalingAPI interface {
+	RegisterScalableTarget(ctx context.Context, params *applicationautoscaling.RegisterScalableTargetInput, optFns ...func(*applicationautoscaling.Options)) (*applicationautoscaling.RegisterScalableTargetOutput, error)
+	PutScalingPolicy(ctx context.Context, params *applicationautoscaling.PutScalingPolicyInput, optFns ...func(*applicationautoscaling.Options)) (*applicationautoscaling.PutScalingPolicyOutput, error)
+}
+
+// DynamoStreamsAPI is the part of the DynamoDB Streams client (*dynamodbstreams.Client) used to watch the changes of
+// the tables.
+type DynamoStreamsAPI interface {
+	DescribeStream(ctx context.Context, params *dynamodbstreams.DescribeStreamInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.DescribeStreamOutput, error)
+	GetShardIterator(ctx context.Context, params *dynamodbstreams.GetShardIteratorInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetShardIteratorOutput, error)
+	GetRecords(ctx context.Context, params *dynamodbstreams.GetRecordsInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetRecordsOutput, error)
+}
+
+// DynamoDAXAPI is the part of the DAX client (*dax.Dax) used to read the items through the cache of a DAX cluster.
+type DynamoDAXAPI interface {
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error)
+}
+
+// dynamoScalingTarget is a capacity of a table or a GSI scaled to keep its utilization at the target.
+type dynamoScalingTarget struct {
+	resourceID        string
+	dimension         autoscalingtypes.ScalableDimension
+	metric            autoscalingtypes.MetricType
+	minCapacity       int32
+	maxCapacity       int32
+	targetUtilization float64
+}
+
+// DynamoCollection is a DynamoDB table.
 type DynamoCollection struct {
-	*dynamo.Table
+	client    DynamoDBAPI
+	streams   DynamoStreamsAPI
+	dax       DynamoDAXAPI
+	tableName string
+	ctx       context.Context
+	// cachedReads reports whether the queries and the batch reads are sent to the DAX cluster
+	cachedReads bool
 	RepositoryDefinition
 }
 
+// DynamoBackend is a DynamoDB backend. It implements TransactionalBackend.
+type DynamoBackend struct {
+	Backend
+	client DynamoDBAPI
+}
+
+// dynamoTransaction is a Transaction that collects the writes on the tables of a DynamoBackend.
+type dynamoTransaction struct {
+	backend *DynamoBackend
+	ctx     context.Context
+	items   []types.TransactWriteItem
+	// creates reports whether the item at the same index is a new item
+	creates []bool
+	keys    map[string]bool
+}
+
+// dynamoTxnRepository is a repository whose writes are added to a DynamoDB transaction.
+type dynamoTxnRepository struct {
+	collection *DynamoCollection
+	tx         *dynamoTransaction
+}
+
 type patternCondition struct {
 	condition string
 	value     string
@@ -36,14 +279,14 @@ type patternCondition struct {
 // If it does not exist builder will create it
 func DynamoDBRepoBuilder(repoDef RepositoryDefinition, backend Backend) (Repository, error) {
 
-	sessionObj := backend.GetFromContext(DYNAMO_CTX_KEY)
-	if sessionObj == nil {
-		return nil, ErrBackendError("dynamo session not configured")
+	clientObj := backend.GetFromContext(DYNAMO_CTX_KEY)
+	if clientObj == nil {
+		return nil, ErrBackendError("dynamo client not configured")
 	}
 
-	sessionAWS, ok := sessionObj.(*session.Session)
+	client, ok := clientObj.(DynamoDBAPI)
 	if !ok {
-		return nil, ErrBackendError("unknown session type")
+		return nil, ErrBackendError("unknown client type")
 	}
 
 	databaseName := backend.GetConfig().DatabaseName
@@ -56,482 +299,3967 @@ func DynamoDBRepoBuilder(repoDef RepositoryDefinition, backend Backend) (Reposit
 		return nil, ErrBackendError("table name is missing and required")
 	}
 
-	svc := dynamodb.New(sessionAWS)
-	err := createTable(svc, repoDef)
+	encryption, _ := backend.GetFromContext(DYNAMO_ENCRYPTION_CTX_KEY).(string)
+	err := createTable(client, repoDef, encryption)
+	if err != nil {
+		return nil, err
+	}
+
+	err = setTTL(client, repoDef)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkTTLExpired(repoDef)
+	if err != nil {
+		return nil, err
+	}
+
+	mode, _ := backend.GetFromContext(DYNAMO_RECONCILE_CTX_KEY).(DynamoReconcileMode)
+	err = reconcileTable(client, repoDef, mode)
 	if err != nil {
 		return nil, err
 	}
 
-	err = setTTL(svc, repoDef)
+	err = setPointInTimeRecovery(client, repoDef)
 	if err != nil {
 		return nil, err
 	}
 
-	db := dynamo.New(sessionAWS)
-	table := db.Table(tableName)
+	scaling, _ := backend.GetFromContext(DYNAMO_AUTOSCALING_CTX_KEY).(DynamoAutoScalingAPI)
+	err = setAutoScaling(client, scaling, repoDef)
+	if err != nil {
+		return nil, err
+	}
+
+	streams, _ := backend.GetFromContext(DYNAMO_STREAMS_CTX_KEY).(DynamoStreamsAPI)
+	daxClient, _ := backend.GetFromContext(DYNAMO_DAX_CTX_KEY).(DynamoDAXAPI)
 
 	return &DynamoCollection{
-		&table,
-		repoDef,
+		client:               client,
+		streams:              streams,
+		dax:                  daxClient,
+		tableName:            tableName,
+		ctx:                  context.Background(),
+		RepositoryDefinition: repoDef,
 	}, nil
 }
 
-// DynamoDBBackendBuilder returns RepositoriesBackend
+// DynamoDBBackendBuilder returns RepositoriesBackend. The options of the backend are set in the query of the
+// endpoint of the config, like the options of a MongoDB connection string, for example
+// "http://dynamo:8000?dax=dax://cluster.dax-clusters.us-east-1.amazonaws.com&encryption=AWS_MANAGED", or only
+// "?reconcile=dry-run" to keep the default endpoint of the region:
+//   - dax: the reads are cached by the DAX cluster of the endpoint (see SetDAX),
+//   - encryption: the encryption of the created tables (see SetEncryption),
+//   - maxAttempts, retryBackoff and retryMaxBackoff: the retries of the throttled requests (see DynamoRetryOptions),
+//   - reconcile: the existing tables are reconciled with their definitions if it is "apply", or the differences are
+//     only reported if it is "dry-run" (see SetReconcile).
+//
+// The options that are not set in the endpoint are taken from the DYNAMO_DAX_ENDPOINT, DYNAMO_ENCRYPTION,
+// DYNAMO_MAX_ATTEMPTS, DYNAMO_RETRY_BACKOFF, DYNAMO_RETRY_MAX_BACKOFF and DYNAMO_RECONCILE environment variables.
 func DynamoDBBackendBuilder(dbInfo *config.DBInfo, manager BackendManager) (Backend, error) {
 
-	staticCredentials := dbInfo.AWSSecretKeyID != "" || dbInfo.AWSSecretAccessKey != "" || dbInfo.AWSSessionToken != ""
+	configAWS, err := newAWSConfig(dbInfo)
+	if err != nil {
+		return nil, err
+	}
 
-	if staticCredentials {
-		if dbInfo.AWSSecretKeyID == "" {
-			return nil, ErrBackendError("AWSSecretKeyID missing")
-		}
-		if dbInfo.AWSSecretAccessKey == "" {
-			return nil, ErrBackendError("AWSSecretAccessKey missing")
-		}
-	} else if dbInfo.AWSCredentials == "" {
-		return nil, ErrBackendError("either AWSCredentials file or AWSSecretKeyID/AWSSecretAccessKey must be specified")
+	endpoint, options, err := dynamoEndpoint(dbInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	retryOptions, err := dynamoRetryOptions(options)
+	if err != nil {
+		return nil, err
 	}
 
-	if dbInfo.AWSRegion == "" {
-		return nil, ErrBackendError("AWS region is missing from config")
+	backend := NewDynamoBackend(dbInfo, newDynamoDBClient(configAWS, endpoint, retryOptions))
+	backend.SetAutoScaling(applicationautoscaling.NewFromConfig(configAWS))
+	backend.SetStreams(newDynamoStreamsClient(configAWS, endpoint))
+
+	if daxEndpoint := dynamoOption(options, "dax", "DYNAMO_DAX_ENDPOINT"); daxEndpoint != "" {
+		daxConfig := dax.DefaultConfig()
+		daxConfig.HostPorts = []string{daxEndpoint}
+		daxConfig.Region = configAWS.Region
+		daxConfig.Credentials = configAWS.Credentials
+		daxClient, err := dax.New(daxConfig)
+		if err != nil {
+			return nil, ErrBackendError(err)
+		}
+		log.Println("Using DAX Endpoint: ", daxEndpoint)
+		backend.SetDAX(daxClient)
 	}
 
-	configAWS := &aws.Config{
-		Region: aws.String(dbInfo.AWSRegion),
+	if encryption := dynamoOption(options, "encryption", "DYNAMO_ENCRYPTION"); encryption != "" {
+		backend.SetEncryption(encryption)
 	}
 
-	if dbInfo.AWSEndpoint != "" {
-		configAWS.Endpoint = aws.String(dbInfo.AWSEndpoint)
-		log.Println("Using AWS Endpoint: ", dbInfo.AWSEndpoint)
+	switch reconcile := dynamoOption(options, "reconcile", "DYNAMO_RECONCILE"); reconcile {
+	case "":
+	case "apply":
+		backend.SetReconcile(DynamoReconcileApply)
+	case "dry-run":
+		backend.SetReconcile(DynamoReconcileDryRun)
+	default:
+		return nil, ErrBackendError(fmt.Sprintf("invalid reconcile %s, must be apply or dry-run", reconcile))
 	}
 
-	if staticCredentials {
-		log.Println("Using static AWS Credentials.")
-		configAWS.Credentials = credentials.NewStaticCredentials(dbInfo.AWSSecretKeyID, dbInfo.AWSSecretAccessKey, dbInfo.AWSSessionToken)
+	return backend, nil
+}
+
+// NewDynamoBackend creates a DynamoBackend with the client.
+func NewDynamoBackend(dbInfo *config.DBInfo, client DynamoDBAPI) *DynamoBackend {
+	ctx := context.WithValue(context.Background(), DYNAMO_CTX_KEY, client)
+	cleanup := func() {}
+
+	return &DynamoBackend{
+		Backend: NewRepositoriesBackend(ctx, dbInfo, DynamoDBRepoBuilder, cleanup),
+		client:  client,
 	}
+}
 
-	if dbInfo.AWSCredentials != "" {
-		log.Println("Using Shared AWS Credentials from file.")
-		configAWS.Credentials = credentials.NewSharedCredentials(dbInfo.AWSCredentials, "")
+// SetAutoScaling sets the Application Auto Scaling client that scales the capacity of the tables defined with
+// "autoScaling". DynamoDBBackendBuilder sets the client of the AWS config of the backend.
+func (b *DynamoBackend) SetAutoScaling(client DynamoAutoScalingAPI) {
+	b.SetInContext(DYNAMO_AUTOSCALING_CTX_KEY, client)
+}
+
+// SetStreams sets the DynamoDB Streams client that watches the changes of the tables defined with "enableStream".
+// DynamoDBBackendBuilder sets the client of the AWS config of the backend.
+func (b *DynamoBackend) SetStreams(client DynamoStreamsAPI) {
+	b.SetInContext(DYNAMO_STREAMS_CTX_KEY, client)
+}
+
+// SetDAX sets the client of the DAX cluster that caches the reads of the records: the queries and the batch reads
+// of GetOne, GetAll, GetAllAfter, Count, Exists, GetManyByIDs and GetManyByKeys. The scans, and the reads of the
+// updates and the deletes, are sent to DynamoDB. The writes are sent to DynamoDB too, so the cached reads may return
+// the items as they were up to the TTL of the caches of the cluster (5 minutes by default).
+func (b *DynamoBackend) SetDAX(client DynamoDAXAPI) {
+	b.SetInContext(DYNAMO_DAX_CTX_KEY, client)
+}
+
+// SetEncryption sets the encryption at rest of the tables created without "encryption" in their definition:
+// "AWS_OWNED", "AWS_MANAGED" or the ID, ARN or alias of a customer managed KMS key.
+func (b *DynamoBackend) SetEncryption(encryption string) {
+	b.SetInContext(DYNAMO_ENCRYPTION_CTX_KEY, encryption)
+}
+
+// SetReconcile sets how the existing tables are reconciled with their definitions when the repositories are defined
+// (see ReconcileTable). The tables are not reconciled by default.
+func (b *DynamoBackend) SetReconcile(mode DynamoReconcileMode) {
+	b.SetInContext(DYNAMO_RECONCILE_CTX_KEY, mode)
+}
+
+// Transact runs the function in a DynamoDB transaction. The writes on the repositories obtained from the transaction
+// are collected and committed with a single TransactWriteItems request when the function returns, so:
+//   - the reads see the committed items, not the writes of the transaction,
+//   - the updates and deletes are conditioned on the filter, so they fail if the item no longer matches it,
+//   - an item can be written only once, and a transaction writes at most 100 items,
+//   - the repositories implement ConditionChecker, to commit only if other items still match a filter.
+//
+// The function is run again if the items were modified concurrently, so it must not have side effects outside of the
+// transaction. Returns ErrConflict if the items were modified on every attempt, and ErrAlreadyExists if a created
+// item already exists. The reads of the transaction and the TransactWriteItems request are sent with the context.
+func (b *DynamoBackend) Transact(ctx context.Context, fn func(tx Transaction) error) error {
+	for attempt := 0; attempt < dynamoTransactionRetries; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		tx := &dynamoTransaction{
+			backend: b,
+			ctx:     ctx,
+			keys:    map[string]bool{},
+		}
+		if err := fn(tx); err != nil {
+			return err
+		}
+		if len(tx.items) == 0 {
+			return nil
+		}
+
+		requestCtx, cancel := context.WithTimeout(ctx, dynamoRequestTimeout)
+		_, err := b.client.TransactWriteItems(requestCtx, &dynamodb.TransactWriteItemsInput{
+			TransactItems: tx.items,
+		})
+		cancel()
+		if err == nil {
+			return nil
+		}
+		var canceled *types.TransactionCanceledException
+		if !errors.As(err, &canceled) {
+			return err
+		}
+		for i, reason := range canceled.CancellationReasons {
+			if aws.ToString(reason.Code) == "ConditionalCheckFailed" && i < len(tx.creates) && tx.creates[i] {
+				return ErrAlreadyExists("record already exists!")
+			}
+		}
+		// the items were modified since they were read
 	}
-	sess, err := session.NewSession(configAWS)
+	return ErrConflict(fmt.Sprintf("transaction failed %d times because of concurrent writes", dynamoTransactionRetries))
+}
+
+// GetRepository returns the repository with its writes added to the transaction. It is wrapped like the repository of
+// the backend, so the data schema, the versions, the enums, the model and the soft deletes apply to the transaction.
+func (t *dynamoTransaction) GetRepository(name string) (Repository, error) {
+	repo, err := t.backend.GetRepository(name)
 	if err != nil {
 		return nil, err
 	}
+	collection, ok := unwrapRepository(repo).(*DynamoCollection)
+	if !ok {
+		return nil, ErrBackendError(fmt.Sprintf("repository %s is not a dynamodb repository", name))
+	}
+	return wrapRepository(&dynamoTxnRepository{
+		collection: collection.WithContext(t.ctx),
+		tx:         t,
+	}, collection.RepositoryDefinition)
+}
 
-	ctx := context.WithValue(context.Background(), DYNAMO_CTX_KEY, sess)
-	cleanup := func() {}
+// add adds the write of the item with the key to the transaction.
+func (t *dynamoTransaction) add(table string, key map[string]types.AttributeValue, item types.TransactWriteItem, create bool) error {
+	keyID := fmt.Sprintf("%s:%v", table, unmarshalDynamoItem(key))
+	if t.keys[keyID] {
+		return ErrInvalidInput(fmt.Sprintf("item %s is already written in the transaction", keyID))
+	}
+	if len(t.items) >= dynamoTransactionSize {
+		return ErrInvalidInput(fmt.Sprintf("a transaction can write at most %d items", dynamoTransactionSize))
+	}
+	t.keys[keyID] = true
+	t.items = append(t.items, item)
+	t.creates = append(t.creates, create)
+	return nil
+}
+
+// GetOne fetches only one record for given filter. The writes of the transaction are not visible.
+func (r *dynamoTxnRepository) GetOne(filter Filter, result interface{}) (interface{}, error) {
+	return r.collection.GetOne(filter, result)
+}
 
-	return NewRepositoriesBackend(ctx, dbInfo, DynamoDBRepoBuilder, cleanup), nil
+// GetAll returns all matched records. The writes of the transaction are not visible.
+func (r *dynamoTxnRepository) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	return r.collection.GetAll(filter, resultsTypeHint, order, sorting, limit, offset)
+}
+
+// Count returns the number of items that match the filter. The writes of the transaction are not visible.
+func (r *dynamoTxnRepository) Count(filter Filter) (int64, error) {
+	return r.collection.Count(filter)
+}
 
+// Exists reports whether an item matches the filter. The writes of the transaction are not visible.
+func (r *dynamoTxnRepository) Exists(filter Filter) (bool, error) {
+	return r.collection.Exists(filter)
 }
 
-// createTable creates table if it does not exist
-func createTable(svc *dynamodb.DynamoDB, repoDef RepositoryDefinition) error {
-	result, err := svc.ListTables(&dynamodb.ListTablesInput{})
+// Save adds the creation of the item to the transaction if the filter is nil. Otherwise it adds the update of the
+// first matched item, conditioned on the filter. Returns the record as it will be saved.
+func (r *dynamoTxnRepository) Save(object interface{}, filter Filter) (interface{}, error) {
+	payload, err := InterfaceToMap(object)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	var attributes []*dynamodb.AttributeDefinition
-	var keySchemaElements []*dynamodb.KeySchemaElement
-	var globalSecondaryIndexes []*dynamodb.GlobalSecondaryIndex
+	if filter == nil {
+		return r.create(*payload)
+	}
 
-	tableName := repoDef.GetName()
-	tableNames := result.TableNames
-	hashKey := repoDef.GetHashKey()
-	rangeKey := repoDef.GetRangeKey()
+	var item interface{}
+	if _, err := r.collection.GetOne(cloneFilter(filter), &item); err != nil {
+		return nil, err
+	}
+	record := item.(map[string]interface{})
+	if err := r.update(record, filter, *payload); err != nil {
+		return nil, err
+	}
 
-	if contains(tableNames, tableName) {
-		return nil
+	hashKey := r.collection.RepositoryDefinition.GetHashKey()
+	rangeKey := r.collection.RepositoryDefinition.GetRangeKey()
+	for k, v := range *payload {
+		if k != hashKey && k != rangeKey {
+			record[k] = v
+		}
 	}
+	return record, nil
+}
 
-	if hashKey != "" {
-		haskKeyType := repoDef.GetHashKeyType()
-		if haskKeyType == "" {
-			haskKeyType = "S"
+// SaveAll adds the creation of the items to the transaction. Returns the records as they will be saved.
+func (r *dynamoTxnRepository) SaveAll(objects interface{}) (interface{}, error) {
+	records, err := objectsToRecords(objects)
+	if err != nil {
+		return nil, err
+	}
+	saved := []interface{}{}
+	for _, record := range records {
+		created, err := r.create(record)
+		if err != nil {
+			return nil, err
 		}
-		attributes = append(attributes, &dynamodb.AttributeDefinition{
-			AttributeName: aws.String(hashKey),
-			AttributeType: aws.String(haskKeyType),
-		})
+		saved = append(saved, created)
+	}
+	return saved, nil
+}
 
-		keySchemaElements = append(keySchemaElements, &dynamodb.KeySchemaElement{
-			AttributeName: aws.String(hashKey),
-			KeyType:       aws.String("HASH"),
-		})
+// UpdateAll adds the updates of all items that match the filter to the transaction, each conditioned on the filter.
+// Returns the number of the items to update.
+func (r *dynamoTxnRepository) UpdateAll(filter Filter, update interface{}) (int64, error) {
+	payload, err := InterfaceToMap(update)
+	if err != nil {
+		return 0, err
+	}
+	keys, err := r.collection.scanKeys(cloneFilter(filter))
+	if err != nil {
+		return 0, err
+	}
+	for _, key := range keys {
+		if err := r.update(unmarshalDynamoItem(key), filter, *payload); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(keys)), nil
+}
 
-	} else {
-		return ErrBackendError(fmt.Sprintf("Hash key is missing for table %s", tableName))
+// DeleteOne adds the deletion of the first matched item to the transaction, conditioned on the filter.
+func (r *dynamoTxnRepository) DeleteOne(filter Filter) error {
+	var item interface{}
+	if _, err := r.collection.GetOne(cloneFilter(filter), &item); err != nil {
+		return err
+	}
+	key, err := r.collection.itemKey(item.(map[string]interface{}))
+	if err != nil {
+		return err
 	}
+	return r.delete(key, filter)
+}
 
-	if rangeKey != "" {
-		rangeKeyType := repoDef.GetRangeKeyType()
-		if rangeKeyType == "" {
-			rangeKeyType = "S"
+// DeleteAll adds the deletions of all items that match the filter to the transaction, each conditioned on the filter.
+func (r *dynamoTxnRepository) DeleteAll(filter Filter) error {
+	keys, err := r.collection.scanKeys(cloneFilter(filter))
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := r.delete(key, filter); err != nil {
+			return err
 		}
-		attributes = append(attributes, &dynamodb.AttributeDefinition{
-			AttributeName: aws.String(rangeKey),
-			AttributeType: aws.String(rangeKeyType),
-		})
+	}
+	return nil
+}
 
-		keySchemaElements = append(keySchemaElements, &dynamodb.KeySchemaElement{
-			AttributeName: aws.String(rangeKey),
-			KeyType:       aws.String("RANGE"),
-		})
+// Check adds a condition check of the first matched item to the transaction, so the transaction is committed only
+// if the item still matches the filter. The item is not written, and it can't be written in the same transaction.
+// Returns ErrNotFound if no item matches the filter. See ConditionChecker.
+func (r *dynamoTxnRepository) Check(filter Filter) error {
+	var item interface{}
+	if _, err := r.collection.GetOne(cloneFilter(filter), &item); err != nil {
+		return err
+	}
+	key, err := r.collection.itemKey(item.(map[string]interface{}))
+	if err != nil {
+		return err
 	}
 
-	gsi := repoDef.GetGSI()
-	if gsi != nil {
-		for index, value := range gsi {
-
-			var keySchemaGSI []*dynamodb.KeySchemaElement
-			if index == hashKey {
-				keySchemaGSI = append(keySchemaGSI, &dynamodb.KeySchemaElement{
-					AttributeName: aws.String(index),
-					KeyType:       aws.String("HASH"),
-				})
-			} else if index == rangeKey {
-				keySchemaGSI = append(keySchemaGSI, &dynamodb.KeySchemaElement{
-					AttributeName: aws.String(index),
-					KeyType:       aws.String("RANGE"),
-				})
-			} else {
-				return ErrBackendError("GSI must be hash or range key")
-			}
+	expressions := newDynamoExpressions()
+	condition, err := r.condition(expressions, filter)
+	if err != nil {
+		return err
+	}
+	return r.tx.add(r.collection.tableName, key, types.TransactWriteItem{
+		ConditionCheck: &types.ConditionCheck{
+			TableName:                 aws.String(r.collection.tableName),
+			Key:                       key,
+			ConditionExpression:       aws.String(condition),
+			ExpressionAttributeNames:  expressions.attributeNames(),
+			ExpressionAttributeValues: expressions.attributeValues(),
+		},
+	}, false)
+}
 
-			v := value.(map[string]interface{})
-			globalSecondaryIndexes = append(globalSecondaryIndexes, &dynamodb.GlobalSecondaryIndex{
-				IndexName: aws.String(fmt.Sprintf("%s-index", index)),
-				KeySchema: keySchemaGSI,
-				Projection: &dynamodb.Projection{
-					ProjectionType: aws.String("ALL"),
-				},
-				ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
-					ReadCapacityUnits:  aws.Int64(int64(v["readCapacity"].(int))),
-					WriteCapacityUnits: aws.Int64(int64(v["writeCapacity"].(int))),
-				},
-			})
-		}
+// create adds a Put of the new item, conditioned on the item not existing.
+func (r *dynamoTxnRepository) create(record map[string]interface{}) (map[string]interface{}, error) {
+	item, err := r.collection.newItem(record)
+	if err != nil {
+		return nil, err
+	}
+	key, err := r.collection.itemKey(unmarshalDynamoItem(item))
+	if err != nil {
+		return nil, err
 	}
 
-	input := &dynamodb.CreateTableInput{
-		AttributeDefinitions:   attributes,
-		KeySchema:              keySchemaElements,
-		GlobalSecondaryIndexes: globalSecondaryIndexes,
-		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
-			ReadCapacityUnits:  aws.Int64(repoDef.GetReadCapacity()),
-			WriteCapacityUnits: aws.Int64(repoDef.GetWriteCapacity()),
+	expressions := newDynamoExpressions()
+	condition, err := expressions.add(&DynamoQuery{Expression: "attribute_not_exists($)", Args: []interface{}{r.collection.RepositoryDefinition.GetHashKey()}})
+	if err != nil {
+		return nil, err
+	}
+	err = r.tx.add(r.collection.tableName, key, types.TransactWriteItem{
+		Put: &types.Put{
+			TableName:                aws.String(r.collection.tableName),
+			Item:                     item,
+			ConditionExpression:      aws.String(condition),
+			ExpressionAttributeNames: expressions.attributeNames(),
 		},
-		TableName: aws.String(tableName),
+	}, true)
+	if err != nil {
+		return nil, err
 	}
+	return unmarshalDynamoItem(item), nil
+}
 
-	// Create the table
-	cto, err := svc.CreateTable(input)
+// update adds an Update of the item, conditioned on the item matching the filter.
+func (r *dynamoTxnRepository) update(record map[string]interface{}, filter Filter, payload map[string]interface{}) error {
+	key, err := r.collection.itemKey(record)
 	if err != nil {
 		return err
 	}
 
-	log.Printf("Table created: %v\n", cto)
+	expressions := newDynamoExpressions()
+	updateExpression, err := r.collection.updateExpression(expressions, payload, nil)
+	if err != nil || updateExpression == "" {
+		return err
+	}
+	condition, err := r.condition(expressions, filter)
+	if err != nil {
+		return err
+	}
+	return r.tx.add(r.collection.tableName, key, types.TransactWriteItem{
+		Update: &types.Update{
+			TableName:                 aws.String(r.collection.tableName),
+			Key:                       key,
+			UpdateExpression:          aws.String(updateExpression),
+			ConditionExpression:       aws.String(condition),
+			ExpressionAttributeNames:  expressions.attributeNames(),
+			ExpressionAttributeValues: expressions.attributeValues(),
+		},
+	}, false)
+}
+
+// delete adds a Delete of the item, conditioned on the item matching the filter.
+func (r *dynamoTxnRepository) delete(key map[string]types.AttributeValue, filter Filter) error {
+	expressions := newDynamoExpressions()
+	condition, err := r.condition(expressions, filter)
+	if err != nil {
+		return err
+	}
+	return r.tx.add(r.collection.tableName, key, types.TransactWriteItem{
+		Delete: &types.Delete{
+			TableName:                 aws.String(r.collection.tableName),
+			Key:                       key,
+			ConditionExpression:       aws.String(condition),
+			ExpressionAttributeNames:  expressions.attributeNames(),
+			ExpressionAttributeValues: expressions.attributeValues(),
+		},
+	}, false)
+}
+
+// condition builds the condition that the item exists and still matches the filter.
+func (r *dynamoTxnRepository) condition(expressions *dynamoExpressions, filter Filter) (string, error) {
+	query, err := r.collection.scanFilter(cloneFilter(filter))
+	if err != nil {
+		return "", err
+	}
+	condition := &DynamoQuery{Expression: "attribute_exists($)", Args: []interface{}{r.collection.RepositoryDefinition.GetHashKey()}}
+	if query.Expression != "" {
+		condition.and(query.Expression, query.Args...)
+	}
+	return expressions.add(condition)
+}
+
+// checkAWSConfig validates the AWS properties of the config. Returns true if static credentials
+// (AWSSecretKeyID/AWSSecretAccessKey) are set.
+func checkAWSConfig(dbInfo *config.DBInfo) (bool, error) {
+
+	staticCredentials := dbInfo.AWSSecretKeyID != "" || dbInfo.AWSSecretAccessKey != "" || dbInfo.AWSSessionToken != ""
+
+	if staticCredentials {
+		if dbInfo.AWSSecretKeyID == "" {
+			return false, ErrBackendError("AWSSecretKeyID missing")
+		}
+		if dbInfo.AWSSecretAccessKey == "" {
+			return false, ErrBackendError("AWSSecretAccessKey missing")
+		}
+	}
+
+	return staticCredentials, nil
+}
+
+// newAWSConfig loads the AWS config from the AWS properties of the config (credentials and region). Without static
+// credentials or a credentials file, the credentials and the region are taken from the default AWS credential chain:
+// the environment, the shared config, the web identity token of EKS (IRSA), the ECS task role or the EC2 instance
+// profile. The role of the DYNAMO_ROLE_ARN environment variable is then assumed with these credentials, with the
+// external ID of the DYNAMO_EXTERNAL_ID environment variable, if they are set.
+func newAWSConfig(dbInfo *config.DBInfo) (aws.Config, error) {
+
+	staticCredentials, err := checkAWSConfig(dbInfo)
+	if err != nil {
+		return aws.Config{}, err
+	}
+
+	options := []func(*awsconfig.LoadOptions) error{}
+
+	if dbInfo.AWSRegion != "" {
+		options = append(options, awsconfig.WithRegion(dbInfo.AWSRegion))
+	}
+
+	if staticCredentials {
+		log.Println("Using static AWS Credentials.")
+		options = append(options, awsconfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(dbInfo.AWSSecretKeyID, dbInfo.AWSSecretAccessKey, dbInfo.AWSSessionToken),
+		))
+	}
+
+	if dbInfo.AWSCredentials != "" {
+		log.Println("Using Shared AWS Credentials from file.")
+		options = append(options, awsconfig.WithSharedCredentialsFiles([]string{dbInfo.AWSCredentials}))
+	}
+
+	configAWS, err := awsconfig.LoadDefaultConfig(context.Background(), options...)
+	if err != nil {
+		return aws.Config{}, ErrBackendError(err)
+	}
+
+	if configAWS.Region == "" {
+		return aws.Config{}, ErrBackendError("AWS region is missing from config")
+	}
+
+	if roleARN := os.Getenv("DYNAMO_ROLE_ARN"); roleARN != "" {
+		log.Println("Assuming AWS Role: ", roleARN)
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(configAWS), roleARN, func(o *stscreds.AssumeRoleOptions) {
+			if externalID := os.Getenv("DYNAMO_EXTERNAL_ID"); externalID != "" {
+				o.ExternalID = aws.String(externalID)
+			}
+		})
+		configAWS.Credentials = aws.NewCredentialsCache(provider)
+	}
+
+	return configAWS, nil
+}
+
+// newDynamoDBClient creates new DynamoDB client from the AWS config, with the endpoint (unless it is empty) and the
+// retries of the options.
+func newDynamoDBClient(configAWS aws.Config, endpoint string, retryOptions *DynamoRetryOptions) *dynamodb.Client {
+	return dynamodb.NewFromConfig(configAWS, func(o *dynamodb.Options) {
+		o.Retryer = NewDynamoRetryer(retryOptions)
+		if endpoint != "" {
+			log.Println("Using AWS Endpoint: ", endpoint)
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+}
+
+// DynamoRetryOptions configures the retries of the DynamoDB requests that are throttled (ThrottlingException,
+// ProvisionedThroughputExceededException, RequestLimitExceeded) or fail with a transient error.
+type DynamoRetryOptions struct {
+	// MaxAttempts is the maximal number of attempts of a request, including the first one. Default is 10.
+	MaxAttempts int
+	// Backoff is the wait before the first retry. It is doubled for every next retry. Default is 50 milliseconds.
+	Backoff time.Duration
+	// MaxBackoff is the maximal wait before a retry. Default is 20 seconds.
+	MaxBackoff time.Duration
+	// Jitter is the part of the wait that is random, between 0 and 1, so the clients throttled together do not retry
+	// together. Default is 1 (the wait is random, up to the backoff), and a negative jitter disables it.
+	Jitter float64
+}
+
+// dynamoThrottlingCodes are the error codes of the throttled DynamoDB requests.
+var dynamoThrottlingCodes = map[string]struct{}{
+	"ThrottlingException":                    {},
+	"ProvisionedThroughputExceededException": {},
+	"RequestLimitExceeded":                   {},
+}
+
+// NewDynamoRetryer creates the retryer of a DynamoDB client with the options (the defaults if nil). The throttled
+// requests are retried up to MaxAttempts, without the retry quota of the standard retryer of the SDK, which fails
+// the requests once too many were retried. The retryer of a client created for NewDynamoBackend is set with:
+//
+//	client := dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+//		o.Retryer = backends.NewDynamoRetryer(&backends.DynamoRetryOptions{MaxAttempts: 5})
+//	})
+func NewDynamoRetryer(options *DynamoRetryOptions) aws.Retryer {
+	options = dynamoRetryDefaults(options)
+	return retry.NewStandard(func(o *retry.StandardOptions) {
+		o.MaxAttempts = options.MaxAttempts
+		o.MaxBackoff = options.MaxBackoff
+		o.Backoff = &dynamoBackoff{options: options}
+		o.RateLimiter = ratelimit.None
+		o.Retryables = append(o.Retryables, retry.RetryableErrorCode{Codes: dynamoThrottlingCodes})
+	})
+}
+
+// IsThrottlingErr reports whether the DynamoDB request was throttled, after all retries.
+func IsThrottlingErr(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	_, ok := dynamoThrottlingCodes[apiErr.ErrorCode()]
+	return ok
+}
+
+// dynamoRetryDefaults returns a copy of the options with the defaults of the unset options.
+func dynamoRetryDefaults(options *DynamoRetryOptions) *DynamoRetryOptions {
+	result := &DynamoRetryOptions{}
+	if options != nil {
+		*result = *options
+	}
+	if result.MaxAttempts < 1 {
+		result.MaxAttempts = 10
+	}
+	if result.Backoff <= 0 {
+		result.Backoff = 50 * time.Millisecond
+	}
+	if result.MaxBackoff <= 0 {
+		result.MaxBackoff = 20 * time.Second
+	}
+	if result.Jitter < 0 {
+		result.Jitter = 0
+	} else if result.Jitter == 0 || result.Jitter > 1 {
+		result.Jitter = 1
+	}
+	return result
+}
+
+// dynamoEndpoint splits the endpoint of the config into the DynamoDB endpoint and the options of the backend set in
+// its query (see DynamoDBBackendBuilder).
+func dynamoEndpoint(dbInfo *config.DBInfo) (string, url.Values, error) {
+	endpoint, query := dbInfo.AWSEndpoint, ""
+	if i := strings.Index(endpoint, "?"); i >= 0 {
+		endpoint, query = endpoint[:i], endpoint[i+1:]
+	}
+	options, err := url.ParseQuery(query)
+	if err != nil {
+		return "", nil, ErrBackendError(fmt.Sprintf("invalid options of the DynamoDB endpoint: %s", err))
+	}
+	return endpoint, options, nil
+}
+
+// dynamoOption returns the option of the endpoint, or the environment variable if the option is not set.
+func dynamoOption(options url.Values, name string, env string) string {
+	if value := options.Get(name); value != "" {
+		return value
+	}
+	return os.Getenv(env)
+}
+
+// dynamoRetryOptions reads the retry options from the maxAttempts, retryBackoff and retryMaxBackoff options of the
+// endpoint, or the DYNAMO_MAX_ATTEMPTS, DYNAMO_RETRY_BACKOFF and DYNAMO_RETRY_MAX_BACKOFF environment variables
+// (durations like "100ms"). The unset options have the defaults.
+func dynamoRetryOptions(options url.Values) (*DynamoRetryOptions, error) {
+	retryOptions := &DynamoRetryOptions{}
+	if maxAttempts := dynamoOption(options, "maxAttempts", "DYNAMO_MAX_ATTEMPTS"); maxAttempts != "" {
+		value, err := strconv.Atoi(maxAttempts)
+		if err != nil {
+			return nil, ErrBackendError(fmt.Sprintf("invalid maxAttempts %s", maxAttempts))
+		}
+		retryOptions.MaxAttempts = value
+	}
+	for _, option := range []struct {
+		name     string
+		env      string
+		duration *time.Duration
+	}{
+		{"retryBackoff", "DYNAMO_RETRY_BACKOFF", &retryOptions.Backoff},
+		{"retryMaxBackoff", "DYNAMO_RETRY_MAX_BACKOFF", &retryOptions.MaxBackoff},
+	} {
+		if value := dynamoOption(options, option.name, option.env); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, ErrBackendError(fmt.Sprintf("invalid %s %s", option.name, value))
+			}
+			*option.duration = parsed
+		}
+	}
+	return retryOptions, nil
+}
+
+// dynamoBackoff is the exponential backoff of the retries, with jitter.
+type dynamoBackoff struct {
+	options *DynamoRetryOptions
+}
+
+// BackoffDelay returns the wait before the retry after the attempt (1 for the first retry).
+func (b *dynamoBackoff) BackoffDelay(attempt int, err error) (time.Duration, error) {
+	delay := b.options.Backoff
+	for i := 1; i < attempt && delay < b.options.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > b.options.MaxBackoff {
+		delay = b.options.MaxBackoff
+	}
+	jitter := time.Duration(float64(delay) * b.options.Jitter * rand.Float64())
+	return delay - jitter, nil
+}
+
+// newDynamoStreamsClient creates new DynamoDB Streams client from the AWS config, with the endpoint (unless it is
+// empty).
+func newDynamoStreamsClient(configAWS aws.Config, endpoint string) *dynamodbstreams.Client {
+	return dynamodbstreams.NewFromConfig(configAWS, func(o *dynamodbstreams.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+}
+
+// createTable creates table if it does not exist. The table is encrypted with the encryption of the definition, or
+// the default encryption if the definition has none.
+func createTable(client DynamoDBAPI, repoDef RepositoryDefinition, encryption string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dynamoRequestTimeout)
+	defer cancel()
+
+	tableNames := []string{}
+	paginator := dynamodb.NewListTablesPaginator(client, &dynamodb.ListTablesInput{})
+	for paginator.HasMorePages() {
+		result, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		tableNames = append(tableNames, result.TableNames...)
+	}
+
+	var attributes []types.AttributeDefinition
+	var keySchemaElements []types.KeySchemaElement
+	var globalSecondaryIndexes []types.GlobalSecondaryIndex
+
+	tableName := repoDef.GetName()
+	hashKey := repoDef.GetHashKey()
+	rangeKey := repoDef.GetRangeKey()
+
+	if contains(tableNames, tableName) {
+		return nil
+	}
+
+	if hashKey != "" {
+		haskKeyType := repoDef.GetHashKeyType()
+		if haskKeyType == "" {
+			haskKeyType = "S"
+		}
+		attributes = append(attributes, types.AttributeDefinition{
+			AttributeName: aws.String(hashKey),
+			AttributeType: types.ScalarAttributeType(haskKeyType),
+		})
+
+		keySchemaElements = append(keySchemaElements, types.KeySchemaElement{
+			AttributeName: aws.String(hashKey),
+			KeyType:       types.KeyTypeHash,
+		})
+
+	} else {
+		return ErrBackendError(fmt.Sprintf("Hash key is missing for table %s", tableName))
+	}
+
+	if rangeKey != "" {
+		rangeKeyType := repoDef.GetRangeKeyType()
+		if rangeKeyType == "" {
+			rangeKeyType = "S"
+		}
+		attributes = append(attributes, types.AttributeDefinition{
+			AttributeName: aws.String(rangeKey),
+			AttributeType: types.ScalarAttributeType(rangeKeyType),
+		})
+
+		keySchemaElements = append(keySchemaElements, types.KeySchemaElement{
+			AttributeName: aws.String(rangeKey),
+			KeyType:       types.KeyTypeRange,
+		})
+	}
+
+	// the GSIs by name, like dynamoIndexKeys
+	gsi := repoDef.GetGSI()
+	indexes := []string{}
+	for index := range gsi {
+		indexes = append(indexes, index)
+	}
+	sort.Strings(indexes)
+	for _, index := range indexes {
+		globalSecondaryIndex, indexAttributes, err := dynamoGlobalIndex(repoDef, index, attributes)
+		if err != nil {
+			return err
+		}
+		attributes = indexAttributes
+		globalSecondaryIndexes = append(globalSecondaryIndexes, globalSecondaryIndex)
+	}
+
+	// the LSIs share the hash key of the table, with another range key
+	lsi := dynamoDefinition(repoDef).GetLSI()
+	if len(lsi) > 0 && rangeKey == "" {
+		return ErrBackendError(fmt.Sprintf("LSI requires a range key for table %s", tableName))
+	}
+	if len(lsi) > dynamoMaxLSI {
+		return ErrBackendError(fmt.Sprintf("table %s can have at most %d LSIs", tableName, dynamoMaxLSI))
+	}
+	localIndexes := []string{}
+	for index := range lsi {
+		localIndexes = append(localIndexes, index)
+	}
+	sort.Strings(localIndexes)
+	var localSecondaryIndexes []types.LocalSecondaryIndex
+	for _, index := range localIndexes {
+		if index == hashKey || index == rangeKey {
+			return ErrBackendError("LSI must not be on the hash or the range key")
+		}
+		v, _ := lsi[index].(map[string]interface{})
+		projection, err := dynamoIndexProjection(v)
+		if err != nil {
+			return err
+		}
+		attributes = addAttributeDefinition(attributes, index, dynamoKeyType(v["type"]))
+		localSecondaryIndexes = append(localSecondaryIndexes, types.LocalSecondaryIndex{
+			IndexName: aws.String(dynamoLocalIndexName(index)),
+			KeySchema: []types.KeySchemaElement{
+				{AttributeName: aws.String(hashKey), KeyType: types.KeyTypeHash},
+				{AttributeName: aws.String(index), KeyType: types.KeyTypeRange},
+			},
+			Projection: projection,
+		})
+	}
+
+	streamSpecification, err := dynamoStreamSpecification(repoDef)
+	if err != nil {
+		return err
+	}
+
+	if dynamoDefinition(repoDef).GetEncryption() != "" {
+		encryption = dynamoDefinition(repoDef).GetEncryption()
+	}
+	sseSpecification := dynamoSSESpecification(encryption)
+
+	input := &dynamodb.CreateTableInput{
+		AttributeDefinitions:   attributes,
+		KeySchema:              keySchemaElements,
+		GlobalSecondaryIndexes: globalSecondaryIndexes,
+		LocalSecondaryIndexes:  localSecondaryIndexes,
+		StreamSpecification:    streamSpecification,
+		SSESpecification:       sseSpecification,
+		ProvisionedThroughput: &types.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(repoDef.GetReadCapacity()),
+			WriteCapacityUnits: aws.Int64(repoDef.GetWriteCapacity()),
+		},
+		TableName: aws.String(tableName),
+	}
+
+	// Create the table
+	cto, err := client.CreateTable(ctx, input)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Table created: %v\n", aws.ToString(cto.TableDescription.TableName))
 
 	return nil
 }
 
+// dynamoStreamSpecification returns the stream of the table defined with "enableStream", with the "streamViewType"
+// ("NEW_AND_OLD_IMAGES" by default).
+func dynamoStreamSpecification(repoDef RepositoryDefinition) (*types.StreamSpecification, error) {
+	if !dynamoDefinition(repoDef).EnableStream() {
+		return nil, nil
+	}
+	viewType := types.StreamViewType(dynamoDefinition(repoDef).GetStreamViewType())
+	if viewType == "" {
+		viewType = types.StreamViewTypeNewAndOldImages
+	}
+	switch viewType {
+	case types.StreamViewTypeKeysOnly, types.StreamViewTypeNewImage, types.StreamViewTypeOldImage, types.StreamViewTypeNewAndOldImages:
+	default:
+		return nil, ErrBackendError(fmt.Sprintf("invalid stream view type %s, must be KEYS_ONLY, NEW_IMAGE, OLD_IMAGE or NEW_AND_OLD_IMAGES", viewType))
+	}
+	return &types.StreamSpecification{
+		StreamEnabled:  aws.Bool(true),
+		StreamViewType: viewType,
+	}, nil
+}
+
+// dynamoGlobalIndex returns the GSI of the definition on the attribute, and the attribute definitions with the keys
+// of the index added.
+func dynamoGlobalIndex(repoDef RepositoryDefinition, index string, attributes []types.AttributeDefinition) (types.GlobalSecondaryIndex, []types.AttributeDefinition, error) {
+	var keySchemaGSI []types.KeySchemaElement
+	v := repoDef.GetGSI()[index].(map[string]interface{})
+	if index == repoDef.GetRangeKey() {
+		keySchemaGSI = append(keySchemaGSI, types.KeySchemaElement{
+			AttributeName: aws.String(index),
+			KeyType:       types.KeyTypeRange,
+		})
+	} else {
+		keySchemaGSI = append(keySchemaGSI, types.KeySchemaElement{
+			AttributeName: aws.String(index),
+			KeyType:       types.KeyTypeHash,
+		})
+		attributes = addAttributeDefinition(attributes, index, dynamoKeyType(v["type"]))
+		if gsiRangeKey, ok := v["rangeKey"].(string); ok && gsiRangeKey != "" {
+			keySchemaGSI = append(keySchemaGSI, types.KeySchemaElement{
+				AttributeName: aws.String(gsiRangeKey),
+				KeyType:       types.KeyTypeRange,
+			})
+			attributes = addAttributeDefinition(attributes, gsiRangeKey, dynamoKeyType(v["rangeKeyType"]))
+		}
+	}
+
+	projection, err := dynamoIndexProjection(v)
+	if err != nil {
+		return types.GlobalSecondaryIndex{}, nil, err
+	}
+	return types.GlobalSecondaryIndex{
+		IndexName:  aws.String(dynamoIndexName(index)),
+		KeySchema:  keySchemaGSI,
+		Projection: projection,
+		ProvisionedThroughput: &types.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(int64(v["readCapacity"].(int))),
+			WriteCapacityUnits: aws.Int64(int64(v["writeCapacity"].(int))),
+		},
+	}, attributes, nil
+}
+
+// dynamoSSESpecification returns the encryption at rest of the table: with a key owned by DynamoDB for "AWS_OWNED"
+// (the default), with the AWS managed KMS key of DynamoDB (aws/dynamodb) for "AWS_MANAGED", otherwise with the
+// customer managed KMS key of the ID, ARN or alias.
+func dynamoSSESpecification(encryption string) *types.SSESpecification {
+	switch encryption {
+	case "", dynamoEncryptionAWSOwned:
+		return nil
+	case dynamoEncryptionAWSManaged:
+		return &types.SSESpecification{
+			Enabled: aws.Bool(true),
+			SSEType: types.SSETypeKms,
+		}
+	}
+	return &types.SSESpecification{
+		Enabled:        aws.Bool(true),
+		SSEType:        types.SSETypeKms,
+		KMSMasterKeyId: aws.String(encryption),
+	}
+}
+
+// dynamoIndexProjection returns the projection of the index definition: its "projection" ("ALL" by default,
+// "KEYS_ONLY" or "INCLUDE"), with the projected "attributes" for "INCLUDE".
+func dynamoIndexProjection(definition map[string]interface{}) (*types.Projection, error) {
+	projectionType, _ := definition["projection"].(string)
+	if projectionType == "" {
+		projectionType = string(types.ProjectionTypeAll)
+	}
+	projection := &types.Projection{ProjectionType: types.ProjectionType(projectionType)}
+	switch projection.ProjectionType {
+	case types.ProjectionTypeAll, types.ProjectionTypeKeysOnly:
+	case types.ProjectionTypeInclude:
+		attributes, ok := definition["attributes"].([]string)
+		if !ok || len(attributes) == 0 {
+			return nil, ErrBackendError("INCLUDE projection requires the projected attributes")
+		}
+		projection.NonKeyAttributes = attributes
+	default:
+		return nil, ErrBackendError(fmt.Sprintf("invalid projection %s, must be ALL, KEYS_ONLY or INCLUDE", projectionType))
+	}
+	return projection, nil
+}
+
+// addAttributeDefinition adds the definition of the key attribute, unless it is already defined.
+func addAttributeDefinition(attributes []types.AttributeDefinition, name string, attributeType string) []types.AttributeDefinition {
+	for _, attribute := range attributes {
+		if aws.ToString(attribute.AttributeName) == name {
+			return attributes
+		}
+	}
+	return append(attributes, types.AttributeDefinition{
+		AttributeName: aws.String(name),
+		AttributeType: types.ScalarAttributeType(attributeType),
+	})
+}
+
 // setTTL sets TimeToLive to the table
-func setTTL(svc *dynamodb.DynamoDB, repoDef RepositoryDefinition) error {
+func setTTL(client DynamoDBAPI, repoDef RepositoryDefinition) error {
+
+	if repoDef.EnableTTL() {
+		enabled := repoDef.EnableTTL()
+		attribute := repoDef.GetTTLAttribute()
+		tableName := repoDef.GetName()
+		TTL := repoDef.GetTTL()
+
+		if attribute == "" {
+			return ErrBackendError("TTL attribute is reqired when TTL is enabled")
+		}
+
+		if TTL == 0 {
+			return ErrBackendError("TTL value is missing and must be greater than zero")
+		}
+
+		err := dynamodb.NewTableExistsWaiter(client).Wait(context.Background(), &dynamodb.DescribeTableInput{
+			TableName: &tableName,
+		}, dynamoTableWaitTimeout)
+		if err != nil {
+			return nil
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), dynamoRequestTimeout)
+		defer cancel()
+
+		// fails if the TTL is already enabled
+		client.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+			TableName: &tableName,
+			TimeToLiveSpecification: &types.TimeToLiveSpecification{
+				AttributeName: &attribute,
+				Enabled:       &enabled,
+			},
+		})
+	}
+
+	return nil
+}
+
+// DynamoReconcileMode is the way the existing tables are reconciled with their definitions.
+type DynamoReconcileMode int
+
+const (
+	// DynamoReconcileOff leaves the existing tables as they are (the default).
+	DynamoReconcileOff DynamoReconcileMode = iota
+	// DynamoReconcileDryRun logs the differences between the existing tables and their definitions, without changing
+	// the tables.
+	DynamoReconcileDryRun
+	// DynamoReconcileApply changes the existing tables to match their definitions, and logs the changes.
+	DynamoReconcileApply
+)
+
+// DynamoTableChange is a difference between an existing table and its definition, found by ReconcileTable.
+type DynamoTableChange struct {
+	// Description describes the difference, for example "read/write capacity 5/5 -> 10/5".
+	Description string
+	// Manual is true for the differences that are not changed by ReconcileTable, like the GSIs that are not defined.
+	Manual bool
+	// update is the UpdateTable request of the change.
+	update *dynamodb.UpdateTableInput
+	// ttl is the UpdateTimeToLive request of the change.
+	ttl *dynamodb.UpdateTimeToLiveInput
+}
+
+// ReconcileTable compares the existing table with its definition, and changes the table to match it unless dryRun
+// is set. Returns the differences:
+//   - the read and the write capacity of the table and its GSIs, unless they are auto scaled or the table is billed
+//     per request,
+//   - the GSIs that are missing, which are created (and backfilled by DynamoDB in the background),
+//   - the TTL, which is enabled or disabled.
+//
+// The GSIs that are not defined are never deleted, and the TTL attribute is not changed, as it can be enabled again
+// only an hour after it is disabled: these differences are Manual. DynamoDB allows a single GSI to be created by an
+// UpdateTable request, so the changes are applied one by one, waiting for the table to be active before each.
+func ReconcileTable(client DynamoDBAPI, repoDef RepositoryDefinition, dryRun bool) ([]*DynamoTableChange, error) {
+	tableName := repoDef.GetName()
+
+	ctx, cancel := context.WithTimeout(context.Background(), dynamoRequestTimeout)
+	defer cancel()
+
+	output, err := client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(tableName)})
+	if err != nil {
+		return nil, ErrBackendError(err)
+	}
+	table := output.Table
+	changes, err := dynamoCapacityChanges(repoDef, table)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl, err := client.DescribeTimeToLive(ctx, &dynamodb.DescribeTimeToLiveInput{TableName: aws.String(tableName)})
+	if err != nil {
+		return nil, ErrBackendError(err)
+	}
+	changes = append(changes, dynamoTTLChanges(repoDef, ttl.TimeToLiveDescription)...)
+
+	if dryRun {
+		return changes, nil
+	}
+	for _, change := range changes {
+		if change.Manual {
+			continue
+		}
+		err := dynamodb.NewTableExistsWaiter(client).Wait(context.Background(), &dynamodb.DescribeTableInput{
+			TableName: aws.String(tableName),
+		}, dynamoTableWaitTimeout)
+		if err != nil {
+			return nil, ErrBackendError(err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), dynamoRequestTimeout)
+		if change.update != nil {
+			_, err = client.UpdateTable(ctx, change.update)
+		} else {
+			_, err = client.UpdateTimeToLive(ctx, change.ttl)
+		}
+		cancel()
+		if err != nil {
+			return nil, ErrBackendError(fmt.Sprintf("failed to change %s of table %s: %s", change.Description, tableName, err))
+		}
+	}
+	return changes, nil
+}
+
+// dynamoCapacityChanges returns the differences of the capacities and the GSIs between the table and its definition.
+func dynamoCapacityChanges(repoDef RepositoryDefinition, table *types.TableDescription) ([]*DynamoTableChange, error) {
+	changes := []*DynamoTableChange{}
+	tableName := table.TableName
+	provisioned := table.BillingModeSummary == nil || table.BillingModeSummary.BillingMode != types.BillingModePayPerRequest
+	capacity := func(throughput *types.ProvisionedThroughputDescription) (int64, int64) {
+		if throughput == nil {
+			return 0, 0
+		}
+		return aws.ToInt64(throughput.ReadCapacityUnits), aws.ToInt64(throughput.WriteCapacityUnits)
+	}
+
+	read, write := capacity(table.ProvisionedThroughput)
+	if provisioned && dynamoDefinition(repoDef).GetAutoScaling() == nil && repoDef.GetReadCapacity() > 0 && repoDef.GetWriteCapacity() > 0 &&
+		(read != repoDef.GetReadCapacity() || write != repoDef.GetWriteCapacity()) {
+		changes = append(changes, &DynamoTableChange{
+			Description: fmt.Sprintf("read/write capacity %d/%d -> %d/%d", read, write, repoDef.GetReadCapacity(), repoDef.GetWriteCapacity()),
+			update: &dynamodb.UpdateTableInput{
+				TableName: tableName,
+				ProvisionedThroughput: &types.ProvisionedThroughput{
+					ReadCapacityUnits:  aws.Int64(repoDef.GetReadCapacity()),
+					WriteCapacityUnits: aws.Int64(repoDef.GetWriteCapacity()),
+				},
+			},
+		})
+	}
+
+	existing := map[string]types.GlobalSecondaryIndexDescription{}
+	for _, index := range table.GlobalSecondaryIndexes {
+		existing[aws.ToString(index.IndexName)] = index
+	}
+	gsi := repoDef.GetGSI()
+	indexes := []string{}
+	for index := range gsi {
+		indexes = append(indexes, index)
+	}
+	sort.Strings(indexes)
+	defined := map[string]bool{}
+	for _, index := range indexes {
+		globalSecondaryIndex, attributes, err := dynamoGlobalIndex(repoDef, index, append([]types.AttributeDefinition{}, table.AttributeDefinitions...))
+		if err != nil {
+			return nil, err
+		}
+		indexName := aws.ToString(globalSecondaryIndex.IndexName)
+		defined[indexName] = true
+		throughput := globalSecondaryIndex.ProvisionedThroughput
+		if !provisioned {
+			throughput = nil
+		}
+
+		description, ok := existing[indexName]
+		if !ok {
+			changes = append(changes, &DynamoTableChange{
+				Description: fmt.Sprintf("missing GSI %s", indexName),
+				update: &dynamodb.UpdateTableInput{
+					TableName:            tableName,
+					AttributeDefinitions: attributes,
+					GlobalSecondaryIndexUpdates: []types.GlobalSecondaryIndexUpdate{{
+						Create: &types.CreateGlobalSecondaryIndexAction{
+							IndexName:             globalSecondaryIndex.IndexName,
+							KeySchema:             globalSecondaryIndex.KeySchema,
+							Projection:            globalSecondaryIndex.Projection,
+							ProvisionedThroughput: throughput,
+						},
+					}},
+				},
+			})
+			continue
+		}
+
+		definition, _ := gsi[index].(map[string]interface{})
+		if throughput == nil || definition["autoScaling"] != nil || dynamoDefinition(repoDef).GetAutoScaling() != nil {
+			continue
+		}
+		read, write := capacity(description.ProvisionedThroughput)
+		if read != aws.ToInt64(throughput.ReadCapacityUnits) || write != aws.ToInt64(throughput.WriteCapacityUnits) {
+			changes = append(changes, &DynamoTableChange{
+				Description: fmt.Sprintf("GSI %s read/write capacity %d/%d -> %d/%d", indexName, read, write,
+					aws.ToInt64(throughput.ReadCapacityUnits), aws.ToInt64(throughput.WriteCapacityUnits)),
+				update: &dynamodb.UpdateTableInput{
+					TableName: tableName,
+					GlobalSecondaryIndexUpdates: []types.GlobalSecondaryIndexUpdate{{
+						Update: &types.UpdateGlobalSecondaryIndexAction{
+							IndexName:             globalSecondaryIndex.IndexName,
+							ProvisionedThroughput: throughput,
+						},
+					}},
+				},
+			})
+		}
+	}
+
+	for _, index := range table.GlobalSecondaryIndexes {
+		if indexName := aws.ToString(index.IndexName); !defined[indexName] {
+			changes = append(changes, &DynamoTableChange{
+				Description: fmt.Sprintf("GSI %s is not defined", indexName),
+				Manual:      true,
+			})
+		}
+	}
+	return changes, nil
+}
+
+// dynamoTTLChanges returns the differences of the TTL between the table and its definition.
+func dynamoTTLChanges(repoDef RepositoryDefinition, ttl *types.TimeToLiveDescription) []*DynamoTableChange {
+	status := types.TimeToLiveStatusDisabled
+	attribute := ""
+	if ttl != nil {
+		status = ttl.TimeToLiveStatus
+		attribute = aws.ToString(ttl.AttributeName)
+	}
+	enabled := status == types.TimeToLiveStatusEnabled || status == types.TimeToLiveStatusEnabling
+	tableName := aws.String(repoDef.GetName())
+
+	switch {
+	case repoDef.EnableTTL() && status == types.TimeToLiveStatusDisabled && repoDef.GetTTLAttribute() != "":
+		return []*DynamoTableChange{{
+			Description: fmt.Sprintf("enable TTL on %s", repoDef.GetTTLAttribute()),
+			ttl: &dynamodb.UpdateTimeToLiveInput{
+				TableName: tableName,
+				TimeToLiveSpecification: &types.TimeToLiveSpecification{
+					AttributeName: aws.String(repoDef.GetTTLAttribute()),
+					Enabled:       aws.Bool(true),
+				},
+			},
+		}}
+	case repoDef.EnableTTL() && enabled && attribute != repoDef.GetTTLAttribute():
+		return []*DynamoTableChange{{
+			Description: fmt.Sprintf("TTL attribute %s -> %s", attribute, repoDef.GetTTLAttribute()),
+			Manual:      true,
+		}}
+	case !repoDef.EnableTTL() && enabled:
+		return []*DynamoTableChange{{
+			Description: fmt.Sprintf("disable TTL on %s", attribute),
+			ttl: &dynamodb.UpdateTimeToLiveInput{
+				TableName: tableName,
+				TimeToLiveSpecification: &types.TimeToLiveSpecification{
+					AttributeName: aws.String(attribute),
+					Enabled:       aws.Bool(false),
+				},
+			},
+		}}
+	}
+	return nil
+}
+
+// reconcileTable reconciles the table with its definition in the mode, and logs the differences.
+func reconcileTable(client DynamoDBAPI, repoDef RepositoryDefinition, mode DynamoReconcileMode) error {
+	if mode == DynamoReconcileOff {
+		return nil
+	}
+	changes, err := ReconcileTable(client, repoDef, mode == DynamoReconcileDryRun)
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		switch {
+		case change.Manual:
+			log.Printf("WARN: table %s differs from its definition in %s, which must be changed manually\n", repoDef.GetName(), change.Description)
+		case mode == DynamoReconcileDryRun:
+			log.Printf("WARN: table %s differs from its definition in %s\n", repoDef.GetName(), change.Description)
+		default:
+			log.Printf("Table updated: %s: %s\n", repoDef.GetName(), change.Description)
+		}
+	}
+	return nil
+}
+
+// setPointInTimeRecovery enables the point-in-time recovery of the table defined with "pointInTimeRecovery", so the
+// table can be restored to any second of the last 35 days. It is enabled on the existing tables too, but it is never
+// disabled.
+func setPointInTimeRecovery(client DynamoDBAPI, repoDef RepositoryDefinition) error {
+	if !dynamoDefinition(repoDef).EnablePointInTimeRecovery() {
+		return nil
+	}
+
+	tableName := repoDef.GetName()
+	err := dynamodb.NewTableExistsWaiter(client).Wait(context.Background(), &dynamodb.DescribeTableInput{
+		TableName: &tableName,
+	}, dynamoTableWaitTimeout)
+	if err != nil {
+		return ErrBackendError(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dynamoRequestTimeout)
+	defer cancel()
+
+	_, err = client.UpdateContinuousBackups(ctx, &dynamodb.UpdateContinuousBackupsInput{
+		TableName: &tableName,
+		PointInTimeRecoverySpecification: &types.PointInTimeRecoverySpecification{
+			PointInTimeRecoveryEnabled: aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return ErrBackendError(err)
+	}
+	return nil
+}
+
+// setAutoScaling registers the read and the write capacity of the table and its GSIs as scalable targets, with a
+// target tracking policy of their utilization, when they are defined with "autoScaling". A GSI without "autoScaling"
+// is scaled like the table. The targets and the policies are updated if they already exist.
+func setAutoScaling(client DynamoDBAPI, scaling DynamoAutoScalingAPI, repoDef RepositoryDefinition) error {
+	targets, err := dynamoScalingTargets(repoDef)
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+	if scaling == nil {
+		return ErrBackendError("dynamo auto scaling client not configured")
+	}
+
+	tableName := repoDef.GetName()
+	err = dynamodb.NewTableExistsWaiter(client).Wait(context.Background(), &dynamodb.DescribeTableInput{
+		TableName: &tableName,
+	}, dynamoTableWaitTimeout)
+	if err != nil {
+		return ErrBackendError(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dynamoRequestTimeout)
+	defer cancel()
+
+	for _, target := range targets {
+		_, err = scaling.RegisterScalableTarget(ctx, &applicationautoscaling.RegisterScalableTargetInput{
+			ServiceNamespace:  autoscalingtypes.ServiceNamespaceDynamodb,
+			ResourceId:        aws.String(target.resourceID),
+			ScalableDimension: target.dimension,
+			MinCapacity:       aws.Int32(target.minCapacity),
+			MaxCapacity:       aws.Int32(target.maxCapacity),
+		})
+		if err != nil {
+			return ErrBackendError(err)
+		}
+		_, err = scaling.PutScalingPolicy(ctx, &applicationautoscaling.PutScalingPolicyInput{
+			PolicyName:        aws.String(fmt.Sprintf("%s:%s", target.metric, target.resourceID)),
+			ServiceNamespace:  autoscalingtypes.ServiceNamespaceDynamodb,
+			ResourceId:        aws.String(target.resourceID),
+			ScalableDimension: target.dimension,
+			PolicyType:        autoscalingtypes.PolicyTypeTargetTrackingScaling,
+			TargetTrackingScalingPolicyConfiguration: &autoscalingtypes.TargetTrackingScalingPolicyConfiguration{
+				TargetValue: aws.Float64(target.targetUtilization),
+				PredefinedMetricSpecification: &autoscalingtypes.PredefinedMetricSpecification{
+					PredefinedMetricType: target.metric,
+				},
+			},
+		})
+		if err != nil {
+			return ErrBackendError(err)
+		}
+	}
+
+	return nil
+}
+
+// dynamoScalingTargets returns the scaled capacities of the table and its GSIs (by name, like createTable).
+func dynamoScalingTargets(repoDef RepositoryDefinition) ([]dynamoScalingTarget, error) {
+	tableResource := "table/" + repoDef.GetName()
+	tableScaling := dynamoDefinition(repoDef).GetAutoScaling()
+
+	targets := []dynamoScalingTarget{}
+	if tableScaling != nil {
+		read, write, err := dynamoCapacityTargets(tableResource, tableScaling, autoscalingtypes.ScalableDimensionDynamoDBTableReadCapacityUnits, autoscalingtypes.ScalableDimensionDynamoDBTableWriteCapacityUnits)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, read, write)
+	}
+
+	gsi := repoDef.GetGSI()
+	indexes := []string{}
+	for index := range gsi {
+		indexes = append(indexes, index)
+	}
+	sort.Strings(indexes)
+	for _, index := range indexes {
+		v, _ := gsi[index].(map[string]interface{})
+		scaling, ok := v["autoScaling"].(map[string]interface{})
+		if !ok {
+			scaling = tableScaling
+		}
+		if scaling == nil {
+			continue
+		}
+		read, write, err := dynamoCapacityTargets(tableResource+"/index/"+dynamoIndexName(index), scaling, autoscalingtypes.ScalableDimensionDynamoDBIndexReadCapacityUnits, autoscalingtypes.ScalableDimensionDynamoDBIndexWriteCapacityUnits)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, read, write)
+	}
+
+	return targets, nil
+}
+
+// dynamoCapacityTargets returns the scaled read and write capacity of the resource, with the "minCapacity", the
+// "maxCapacity" and the "targetUtilization" (70 percent by default) of the auto scaling definition.
+func dynamoCapacityTargets(resourceID string, scaling map[string]interface{}, readDimension autoscalingtypes.ScalableDimension, writeDimension autoscalingtypes.ScalableDimension) (dynamoScalingTarget, dynamoScalingTarget, error) {
+	minCapacity, minOk := dynamoScalingNumber(scaling["minCapacity"])
+	maxCapacity, maxOk := dynamoScalingNumber(scaling["maxCapacity"])
+	if !minOk || !maxOk || minCapacity < 1 || maxCapacity < minCapacity || maxCapacity > math.MaxInt32 {
+		return dynamoScalingTarget{}, dynamoScalingTarget{}, ErrBackendError(fmt.Sprintf("auto scaling of %s requires a minCapacity of at least 1 and a greater or equal maxCapacity", resourceID))
+	}
+	targetUtilization := float64(dynamoDefaultTargetUtilization)
+	if value, ok := scaling["targetUtilization"]; ok {
+		targetUtilization, ok = dynamoScalingNumber(value)
+		if !ok || targetUtilization < 20 || targetUtilization > 90 {
+			return dynamoScalingTarget{}, dynamoScalingTarget{}, ErrBackendError(fmt.Sprintf("target utilization of %s must be between 20 and 90 percent", resourceID))
+		}
+	}
+
+	read := dynamoScalingTarget{
+		resourceID:        resourceID,
+		dimension:         readDimension,
+		metric:            autoscalingtypes.MetricTypeDynamoDBReadCapacityUtilization,
+		minCapacity:       int32(minCapacity),
+		maxCapacity:       int32(maxCapacity),
+		targetUtilization: targetUtilization,
+	}
+	write := read
+	write.dimension = writeDimension
+	write.metric = autoscalingtypes.MetricTypeDynamoDBWriteCapacityUtilization
+	return read, write, nil
+}
+
+// dynamoScalingNumber returns the number of the auto scaling definition.
+func dynamoScalingNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// WithContext returns a copy of the collection that sends the requests with the given context,
+// so they are canceled together with the context (for example, when the client of the service disconnects).
+func (c *DynamoCollection) WithContext(ctx context.Context) *DynamoCollection {
+	collection := *c
+	collection.ctx = ctx
+	return &collection
+}
+
+// cached returns a copy of the collection that sends the queries and the batch reads to the DAX cluster, if the
+// backend has one. It is used by the reads of the records only (see SetDAX).
+func (c *DynamoCollection) cached() *DynamoCollection {
+	if c.dax == nil {
+		return c
+	}
+	collection := *c
+	collection.cachedReads = true
+	return &collection
+}
+
+// reader returns the client of the queries and the batch reads.
+func (c *DynamoCollection) reader() DynamoDAXAPI {
+	if c.cachedReads {
+		return c.dax
+	}
+	return c.client
+}
+
+// requestContext returns the context for a single request.
+func (c *DynamoCollection) requestContext() (context.Context, context.CancelFunc) {
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithTimeout(ctx, dynamoRequestTimeout)
+}
+
+// GetOne looks up for an item by given filter. The table (or its GSI) is queried if the filter matches the hash key,
+// otherwise it is scanned. See newRead.
+// Example filter:
+//	filter := Filter{
+// 		"id":    "54acb6c5-baeb-4213-b10f-e707a6055e64",
+// }
+func (c *DynamoCollection) GetOne(filter Filter, result interface{}) (interface{}, error) {
+	return c.cached().getOne(filter, result)
+}
+
+// getOne looks up for an item by given filter, without the DAX cluster unless the collection is cached.
+func (c *DynamoCollection) getOne(filter Filter, result interface{}) (interface{}, error) {
+
+	var record map[string]interface{}
+
+	read, err := c.newRead(filter)
+	if err != nil {
+		return nil, err
+	}
+	item, _, err := c.readFrom(read, nil, nil, 0, 1, func(item map[string]interface{}) error {
+		record = item
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, ErrNotFound("Record not found")
+	}
+
+	// The structs are decoded from the item directly, so the numbers keep their precision.
+	if v := reflect.ValueOf(result); v.Kind() == reflect.Ptr && !v.IsNil() && v.Elem().Kind() == reflect.Struct {
+		if err := UnmarshalDynamoItem(item, result); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	err = MapToInterface(&record, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetManyByIDs fetches the items with the given hash keys with BatchGetItem requests of up to 100 keys. The
+// unprocessed keys are requested again. The tables with a range key are not supported, use GetManyByKeys for
+// them. See GetManyByIDs.
+func (c *DynamoCollection) GetManyByIDs(ids []string, resultsTypeHint interface{}) (interface{}, error) {
+	hashKey := c.RepositoryDefinition.GetHashKey()
+	if c.RepositoryDefinition.GetRangeKey() != "" {
+		return nil, ErrNotSupported("the items of a table with a range key can not be fetched by the hash key only")
+	}
+	ids = uniqueIDs(ids)
+
+	keys := make([]map[string]types.AttributeValue, 0, len(ids))
+	for _, id := range ids {
+		var key types.AttributeValue = &types.AttributeValueMemberS{Value: id}
+		if c.RepositoryDefinition.GetHashKeyType() == "N" {
+			key = &types.AttributeValueMemberN{Value: id}
+		}
+		keys = append(keys, map[string]types.AttributeValue{hashKey: key})
+	}
+	records, err := c.cached().batchGetAll(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	if resultsTypeHint == nil {
+		resultsTypeHint = &map[string]interface{}{}
+	}
+	return recordsToResults(orderedRecords(ids, records, hashKey), resultsTypeHint)
+}
+
+// GetManyByKeys fetches the items with the given primary keys, like GetManyByIDs. Every key is a filter with the
+// hash key and the range key (if the table has one) of an item:
+//
+//	results, err := sessions.GetManyByKeys([]backends.Filter{
+//		backends.NewFilter().Match("user", "john").Match("createdAt", "2019-01-02T15:04:05Z"),
+//		backends.NewFilter().Match("user", "jane").Match("createdAt", "2019-01-03T10:00:00Z"),
+//	}, &Session{})
+//
+// The items are returned in the order of the keys. The keys without an item are skipped, and the duplicated keys
+// are returned once. Returns ErrInvalidInput if a key is incomplete.
+func (c *DynamoCollection) GetManyByKeys(keys []Filter, resultsTypeHint interface{}) (interface{}, error) {
+	keyAttributes := []string{c.RepositoryDefinition.GetHashKey()}
+	if rangeKey := c.RepositoryDefinition.GetRangeKey(); rangeKey != "" {
+		keyAttributes = append(keyAttributes, rangeKey)
+	}
+
+	keyIDs := []string{}
+	itemKeys := make([]map[string]types.AttributeValue, 0, len(keys))
+	seen := map[string]bool{}
+	for _, key := range keys {
+		if len(key) != len(keyAttributes) {
+			return nil, ErrInvalidInput(fmt.Sprintf("key must have only the key attributes %v, got %v", keyAttributes, key))
+		}
+		for _, attribute := range keyAttributes {
+			if _, ok := key[attribute]; !ok {
+				return nil, ErrInvalidInput(fmt.Sprintf("key must have only the key attributes %v, got %v", keyAttributes, key))
+			}
+		}
+		itemKey, err := c.itemKey(key)
+		if err != nil {
+			return nil, err
+		}
+		keyID := fmt.Sprintf("%v", unmarshalDynamoItem(itemKey))
+		if seen[keyID] {
+			continue
+		}
+		seen[keyID] = true
+		keyIDs = append(keyIDs, keyID)
+		itemKeys = append(itemKeys, itemKey)
+	}
+	records, err := c.cached().batchGetAll(itemKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	byKey := map[string]map[string]interface{}{}
+	for _, record := range records {
+		itemKey, err := c.itemKey(record)
+		if err != nil {
+			return nil, err
+		}
+		byKey[fmt.Sprintf("%v", unmarshalDynamoItem(itemKey))] = record
+	}
+	ordered := make([]map[string]interface{}, 0, len(records))
+	for _, keyID := range keyIDs {
+		if record, ok := byKey[keyID]; ok {
+			ordered = append(ordered, record)
+		}
+	}
+
+	if resultsTypeHint == nil {
+		resultsTypeHint = &map[string]interface{}{}
+	}
+	return recordsToResults(ordered, resultsTypeHint)
+}
+
+// batchGetAll fetches the items with the keys with BatchGetItem requests of up to 100 keys, and skips the expired
+// items.
+func (c *DynamoCollection) batchGetAll(keys []map[string]types.AttributeValue) ([]map[string]interface{}, error) {
+	records := []map[string]interface{}{}
+	for start := 0; start < len(keys); start += dynamoBatchGetSize {
+		end := start + dynamoBatchGetSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		items, err := c.batchGet(keys[start:end])
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			record := unmarshalDynamoItem(item)
+			if c.expired(record) {
+				continue
+			}
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// batchGet fetches the items with BatchGetItem, requesting the unprocessed keys until all are fetched.
+func (c *DynamoCollection) batchGet(keys []map[string]types.AttributeValue) ([]map[string]types.AttributeValue, error) {
+	items := []map[string]types.AttributeValue{}
+	for attempt := 0; len(keys) > 0; attempt++ {
+		if attempt > 0 {
+			if attempt > dynamoBatchWriteRetries {
+				return nil, fmt.Errorf("%d items not read after %d retries", len(keys), dynamoBatchWriteRetries)
+			}
+			time.Sleep(time.Duration(1<<uint(attempt-1)) * 50 * time.Millisecond)
+		}
+
+		ctx, cancel := c.requestContext()
+		output, err := c.reader().BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+			RequestItems: map[string]types.KeysAndAttributes{c.tableName: {Keys: keys}},
+		})
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, output.Responses[c.tableName]...)
+		keys = output.UnprocessedKeys[c.tableName].Keys
+	}
+	return items, nil
+}
+
+// expired reports whether the TTL of the item has passed (for longer than the grace period, see TTLExpiredDefinition).
+// DynamoDB deletes the expired items only eventually, so the requests that are not filtered (see scanFilter) skip
+// them with expired.
+func (c *DynamoCollection) expired(record map[string]interface{}) bool {
+	grace, ok := ttlGrace(c.RepositoryDefinition)
+	if !ok {
+		return false
+	}
+	expires, ok := record[c.RepositoryDefinition.GetTTLAttribute()].(string)
+	if !ok {
+		return false
+	}
+	t, ok := parseTime(expires)
+	return ok && !t.After(time.Now().Add(-grace))
+}
+
+// GetAll returns all matched records. You can specify limit and offset as well.
+// The records are sorted by DynamoDB only if the order is the range key of the queried index, otherwise all matched
+// records are read and sorted in memory. See GetAllFields.
+func (c *DynamoCollection) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	return c.GetAllFields(filter, resultsTypeHint, nil, order, sorting, limit, offset)
+}
+
+// GetAllFields returns all matched records, with only the selected attributes. The attributes are selected with
+// a projection expression, so the other attributes are not transferred. The items queried by a key (see newRead) are
+// ordered by the range key of the index, if it is the order. The pages of a single Scan or Query are read one after
+// another, skipping the offset, until the limit is reached (see readFrom). The items ordered by any other attribute
+// (a nested one too) are all read first and sorted in memory, so the limit does not cut the read short then.
+func (c *DynamoCollection) GetAllFields(filter Filter, resultsTypeHint interface{}, fields []string, order string, sorting string, limit int, offset int) (interface{}, error) {
+	var results reflect.Value
+
+	resultHint := AsPtr(resultsTypeHint)
+
+	results = NewSliceOfType(resultHint)
+
+	read, err := c.newRead(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	appendRecord := func(item map[string]interface{}) error {
+		record, err := CreateNewAsExample(resultHint)
+		if err != nil {
+			return err
+		}
+		if err := MapToInterface(&item, record); err != nil {
+			return err
+		}
+		results = reflect.Append(results, reflect.ValueOf(record))
+		return nil
+	}
+
+	if read.orderBy(order, sorting) {
+		if err := c.cached().readItems(read, fields, offset, limit, appendRecord); err != nil {
+			return nil, err
+		}
+		return results.Interface(), nil
+	}
+
+	// the order attribute is read with the selected fields, and projected out after sorting
+	readFields := fields
+	if len(fields) > 0 && !contains(fields, order) {
+		readFields = append(append([]string{}, fields...), order)
+	}
+	records := []map[string]interface{}{}
+	err = c.cached().readItems(read, readFields, 0, 0, func(item map[string]interface{}) error {
+		records = append(records, item)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if records, err = filterRecords(records, nil, order, sorting, limit, offset); err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		if len(readFields) > len(fields) {
+			record = projectRecord(record, fields)
+		}
+		if err := appendRecord(record); err != nil {
+			return nil, err
+		}
+	}
+
+	return results.Interface(), nil
+}
+
+// GetAllAfter returns at most limit matched records after the page token, and the token of the next page. The token
+// holds the key of the last returned item, so the next page continues the scan or the query where this one stopped
+// (with ExclusiveStartKey) instead of reading the previous pages again. The pages are ordered only by the range key
+// of the queried index, as the other orders need all records (see GetAllFields). See CursorRepository.
+func (c *DynamoCollection) GetAllAfter(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, pageToken string) (interface{}, string, error) {
+	if strings.Contains(order, ".") {
+		return nil, "", ErrNotSupported(fmt.Sprintf("sorting by nested attribute %s is not supported by DynamoDB backend", order))
+	}
+	var start map[string]types.AttributeValue
+	if pageToken != "" {
+		var err error
+		if start, err = decodeDynamoPageToken(pageToken); err != nil {
+			return nil, "", err
+		}
+	}
+
+	read, err := c.newRead(filter)
+	if err != nil {
+		return nil, "", err
+	}
+	read.orderBy(order, sorting)
+
+	resultHint := AsPtr(resultsTypeHint)
+	results := NewSliceOfType(resultHint)
+	last, more, err := c.cached().readFrom(read, nil, start, 0, limit, func(item map[string]interface{}) error {
+		record, err := CreateNewAsExample(resultHint)
+		if err != nil {
+			return err
+		}
+		if err := MapToInterface(&item, record); err != nil {
+			return err
+		}
+		results = reflect.Append(results, reflect.ValueOf(record))
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if !more {
+		return results.Interface(), "", nil
+	}
+
+	// the start key of a GSI query holds the keys of the index and of the table
+	key := map[string]types.AttributeValue{}
+	for _, attribute := range []string{c.RepositoryDefinition.GetHashKey(), c.RepositoryDefinition.GetRangeKey(), read.indexKey.hashKey, read.indexKey.rangeKey} {
+		if value, ok := last[attribute]; ok && attribute != "" {
+			key[attribute] = value
+		}
+	}
+	next, err := encodeDynamoPageToken(key)
+	if err != nil {
+		return nil, "", err
+	}
+	return results.Interface(), next, nil
+}
+
+// dynamoMaxSegments is the maximal number of the segments of a parallel scan.
+const dynamoMaxSegments = 1000000
+
+// DynamoIterator streams the items read by ParallelScan. The items of the segments are merged in the order they are
+// read, so their order is not defined. The iterator must be closed if it is not read to the end:
+//
+//	it, err := users.ParallelScan(nil, 8)
+//	if err != nil {
+//		return err
+//	}
+//	defer it.Close()
+//	for it.Next() {
+//		export(it.Record())
+//	}
+//	return it.Err()
+type DynamoIterator struct {
+	items  chan map[string]interface{}
+	done   chan struct{}
+	once   *sync.Once
+	mutex  *sync.Mutex
+	err    error
+	record map[string]interface{}
+}
+
+// newDynamoIterator creates new DynamoIterator that buffers up to size items.
+func newDynamoIterator(size int) *DynamoIterator {
+	return &DynamoIterator{
+		items: make(chan map[string]interface{}, size),
+		done:  make(chan struct{}),
+		once:  &sync.Once{},
+		mutex: &sync.Mutex{},
+	}
+}
+
+// Next waits for the next item, and reports whether there is one. Returns false once all items are read, a segment
+// fails or the iterator is closed.
+func (it *DynamoIterator) Next() bool {
+	record, ok := <-it.items
+	if !ok {
+		return false
+	}
+	it.record = record
+	return true
+}
+
+// Record returns the current item.
+func (it *DynamoIterator) Record() map[string]interface{} {
+	return it.record
+}
+
+// Decode decodes the current item into the result.
+func (it *DynamoIterator) Decode(result interface{}) error {
+	return MapToInterface(&it.record, result)
+}
+
+// Err returns the error of the first failed segment, if any.
+func (it *DynamoIterator) Err() error {
+	it.mutex.Lock()
+	defer it.mutex.Unlock()
+	return it.err
+}
+
+// Close stops the scan of all segments and returns the error of the first failed segment, if any.
+func (it *DynamoIterator) Close() error {
+	it.stop()
+	for range it.items {
+	}
+	return it.Err()
+}
+
+// fail records the first error and stops the scan of the other segments.
+func (it *DynamoIterator) fail(err error) {
+	it.mutex.Lock()
+	if it.err == nil {
+		it.err = err
+	}
+	it.mutex.Unlock()
+	it.stop()
+}
+
+// stop signals the segments to stop.
+func (it *DynamoIterator) stop() {
+	it.once.Do(func() {
+		close(it.done)
+	})
+}
+
+// ParallelScan reads the items that match the filter with a parallel scan of the table (Segment and TotalSegments),
+// one goroutine per segment, and streams them through the returned iterator. A full read of a large table, like an
+// export, is about as many times faster as there are segments, at the same read cost. The segments count against the
+// read capacity of the table at the same time, so throttling should be expected on tables with low capacity.
+// A filter that matches a key is read with a single Query (see newRead). Returns ErrInvalidInput if the number of the
+// segments is not between 1 and 1000000.
+func (c *DynamoCollection) ParallelScan(filter Filter, segments int) (*DynamoIterator, error) {
+	if segments < 1 || segments > dynamoMaxSegments {
+		return nil, ErrInvalidInput(fmt.Sprintf("number of segments must be between 1 and %d, got %d", dynamoMaxSegments, segments))
+	}
+	read, err := c.newRead(filter)
+	if err != nil {
+		return nil, err
+	}
+	if read.key != nil {
+		segments = 1
+	}
+
+	inputs := []interface{}{}
+	for segment := 0; segment < segments; segment++ {
+		input, err := c.readInput(read, nil, false)
+		if err != nil {
+			return nil, err
+		}
+		if scan, ok := input.(*dynamodb.ScanInput); ok && segments > 1 {
+			scan.Segment = aws.Int32(int32(segment))
+			scan.TotalSegments = aws.Int32(int32(segments))
+		}
+		inputs = append(inputs, input)
+	}
+
+	it := newDynamoIterator(100)
+	wg := &sync.WaitGroup{}
+	for _, input := range inputs {
+		wg.Add(1)
+		go func(input interface{}) {
+			defer wg.Done()
+			if err := c.scanSegment(read, input, it); err != nil {
+				it.fail(err)
+			}
+		}(input)
+	}
+	go func() {
+		wg.Wait()
+		close(it.items)
+	}()
+	return it, nil
+}
+
+// scanSegment reads all pages of the input of readInput into the iterator, until the iterator is stopped.
+func (c *DynamoCollection) scanSegment(read *dynamoRead, input interface{}, it *DynamoIterator) error {
+	var start map[string]types.AttributeValue
+	for {
+		select {
+		case <-it.done:
+			return nil
+		default:
+		}
+		page, err := c.readPage(input, start)
+		if err != nil {
+			return err
+		}
+		items := page.items
+		if read.partial(nil) {
+			if items, err = c.tableItems(items); err != nil {
+				return err
+			}
+		}
+
+		for _, item := range items {
+			select {
+			case it.items <- unmarshalDynamoItem(item):
+			case <-it.done:
+				return nil
+			}
+		}
+
+		if len(page.lastKey) == 0 {
+			return nil
+		}
+		start = page.lastKey
+	}
+}
+
+// dynamoStreamReader reads the shards of the stream of a table into a change feed. The shards that are open when the
+// watch starts are read from their latest record, and the shards created later (when a shard is split or rotated,
+// about every 4 hours) from their first record, once their parent shard is read to its end, so the changes of an item
+// are delivered in order.
+type dynamoStreamReader struct {
+	collection *DynamoCollection
+	streamArn  string
+	feed       *changeFeed
+	// started are the shards that are being read (or were closed before the watch started)
+	started map[string]bool
+	// finished are the shards that were read to their end
+	finished map[string]bool
+	// closed receives the shards that were read to their end
+	closed chan string
+	wg     *sync.WaitGroup
+}
+
+// Watch delivers the changes of the items that match the filter, read from the DynamoDB Stream of the table, so the
+// table must be defined with "enableStream". The changes made after Watch returns are delivered, in order for each
+// item, with the images of the "streamViewType" of the table: the filter matches the new image, or the old image of
+// the removed items, or only the keys if the stream has no images. Returns ErrNotSupported if the table has no stream.
+func (c *DynamoCollection) Watch(filter Filter) (ChangeStream, error) {
+	if c.streams == nil {
+		return nil, ErrBackendError("dynamo streams client not configured")
+	}
+	feed, err := newChangeFeed(filter, 100)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := c.requestContext()
+	defer cancel()
+	table, err := c.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(c.tableName)})
+	if err != nil {
+		return nil, ErrBackendError(err)
+	}
+	streamArn := aws.ToString(table.Table.LatestStreamArn)
+	if spec := table.Table.StreamSpecification; streamArn == "" || spec == nil || !aws.ToBool(spec.StreamEnabled) {
+		return nil, ErrNotSupported(fmt.Sprintf("streams are not enabled on table %s", c.tableName))
+	}
+	shards, err := c.streamShards(streamArn)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := &dynamoStreamReader{
+		collection: c,
+		streamArn:  streamArn,
+		feed:       feed,
+		started:    map[string]bool{},
+		finished:   map[string]bool{},
+		closed:     make(chan string),
+		wg:         &sync.WaitGroup{},
+	}
+	for _, shard := range shards {
+		shardID := aws.ToString(shard.ShardId)
+		if shard.SequenceNumberRange != nil && shard.SequenceNumberRange.EndingSequenceNumber != nil {
+			reader.started[shardID] = true
+			reader.finished[shardID] = true
+			continue
+		}
+		if err := reader.start(shardID, streamstypes.ShardIteratorTypeLatest); err != nil {
+			feed.stop()
+			reader.wg.Wait()
+			return nil, err
+		}
+	}
+	go reader.run()
+	return feed, nil
+}
+
+// streamShards returns all shards of the stream.
+func (c *DynamoCollection) streamShards(streamArn string) ([]streamstypes.Shard, error) {
+	ctx, cancel := c.requestContext()
+	defer cancel()
+
+	shards := []streamstypes.Shard{}
+	var start *string
+	for {
+		output, err := c.streams.DescribeStream(ctx, &dynamodbstreams.DescribeStreamInput{
+			StreamArn:             aws.String(streamArn),
+			ExclusiveStartShardId: start,
+		})
+		if err != nil {
+			return nil, ErrBackendError(err)
+		}
+		shards = append(shards, output.StreamDescription.Shards...)
+		start = output.StreamDescription.LastEvaluatedShardId
+		if start == nil {
+			return shards, nil
+		}
+	}
+}
+
+// run starts reading the new shards of the stream when a shard is read to its end and periodically, until the feed
+// is stopped. The events of the feed are closed once all shards have stopped.
+func (r *dynamoStreamReader) run() {
+	defer func() {
+		r.wg.Wait()
+		close(r.feed.events)
+	}()
+	ticker := time.NewTicker(dynamoStreamDescribeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.feed.done:
+			return
+		case shardID := <-r.closed:
+			r.finished[shardID] = true
+		case <-ticker.C:
+		}
+
+		shards, err := r.collection.streamShards(r.streamArn)
+		if err != nil {
+			r.feed.fail(err)
+			return
+		}
+		known := map[string]bool{}
+		for _, shard := range shards {
+			known[aws.ToString(shard.ShardId)] = true
+		}
+		for _, shard := range shards {
+			shardID := aws.ToString(shard.ShardId)
+			parentID := aws.ToString(shard.ParentShardId)
+			if r.started[shardID] || (parentID != "" && known[parentID] && !r.finished[parentID]) {
+				continue
+			}
+			if err := r.start(shardID, streamstypes.ShardIteratorTypeTrimHorizon); err != nil {
+				r.feed.fail(err)
+				return
+			}
+		}
+	}
+}
+
+// start starts reading the shard from the position of the iterator type.
+func (r *dynamoStreamReader) start(shardID string, iteratorType streamstypes.ShardIteratorType) error {
+	ctx, cancel := r.collection.requestContext()
+	defer cancel()
+
+	output, err := r.collection.streams.GetShardIterator(ctx, &dynamodbstreams.GetShardIteratorInput{
+		StreamArn:         aws.String(r.streamArn),
+		ShardId:           aws.String(shardID),
+		ShardIteratorType: iteratorType,
+	})
+	if err != nil {
+		return ErrBackendError(err)
+	}
+
+	r.started[shardID] = true
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.readShard(shardID, output.ShardIterator)
+	}()
+	return nil
+}
+
+// readShard publishes the records of the shard until the shard is read to its end or the feed is stopped.
+func (r *dynamoStreamReader) readShard(shardID string, iterator *string) {
+	for iterator != nil {
+		select {
+		case <-r.feed.done:
+			return
+		default:
+		}
+
+		ctx, cancel := r.collection.requestContext()
+		output, err := r.collection.streams.GetRecords(ctx, &dynamodbstreams.GetRecordsInput{ShardIterator: iterator})
+		cancel()
+		if err != nil {
+			r.feed.fail(ErrBackendError(err))
+			return
+		}
+		for _, record := range output.Records {
+			if !r.feed.publish(dynamoChangeEvent(record)) {
+				return
+			}
+		}
+
+		iterator = output.NextShardIterator
+		if len(output.Records) == 0 && iterator != nil && !r.feed.wait(dynamoStreamPollInterval) {
+			return
+		}
+	}
+
+	select {
+	case r.closed <- shardID:
+	case <-r.feed.done:
+	}
+}
+
+// dynamoChangeEvent converts the stream record to a ChangeEvent.
+func dynamoChangeEvent(record streamstypes.Record) *ChangeEvent {
+	event := &ChangeEvent{}
+	switch record.EventName {
+	case streamstypes.OperationTypeInsert:
+		event.Type = ChangeInsert
+	case streamstypes.OperationTypeModify:
+		event.Type = ChangeUpdate
+	case streamstypes.OperationTypeRemove:
+		event.Type = ChangeDelete
+	}
+	if change := record.Dynamodb; change != nil {
+		event.Key = unmarshalDynamoItem(dynamoStreamItem(change.Keys))
+		if change.NewImage != nil {
+			event.Record = unmarshalDynamoItem(dynamoStreamItem(change.NewImage))
+		}
+		if change.OldImage != nil {
+			event.OldRecord = unmarshalDynamoItem(dynamoStreamItem(change.OldImage))
+		}
+		if change.ApproximateCreationDateTime != nil {
+			event.Time = *change.ApproximateCreationDateTime
+		}
+	}
+	return event
+}
+
+// dynamoStreamItem converts the item of a stream record to a DynamoDB item.
+func dynamoStreamItem(item map[string]streamstypes.AttributeValue) map[string]types.AttributeValue {
+	converted := make(map[string]types.AttributeValue, len(item))
+	for key, value := range item {
+		converted[key] = dynamoStreamValue(value)
+	}
+	return converted
+}
+
+// dynamoStreamValue converts the attribute value of a stream record to a DynamoDB attribute value.
+func dynamoStreamValue(value streamstypes.AttributeValue) types.AttributeValue {
+	switch v := value.(type) {
+	case *streamstypes.AttributeValueMemberS:
+		return &types.AttributeValueMemberS{Value: v.Value}
+	case *streamstypes.AttributeValueMemberN:
+		return &types.AttributeValueMemberN{Value: v.Value}
+	case *streamstypes.AttributeValueMemberB:
+		return &types.AttributeValueMemberB{Value: v.Value}
+	case *streamstypes.AttributeValueMemberBOOL:
+		return &types.AttributeValueMemberBOOL{Value: v.Value}
+	case *streamstypes.AttributeValueMemberSS:
+		return &types.AttributeValueMemberSS{Value: v.Value}
+	case *streamstypes.AttributeValueMemberNS:
+		return &types.AttributeValueMemberNS{Value: v.Value}
+	case *streamstypes.AttributeValueMemberBS:
+		return &types.AttributeValueMemberBS{Value: v.Value}
+	case *streamstypes.AttributeValueMemberL:
+		list := make([]types.AttributeValue, len(v.Value))
+		for i, item := range v.Value {
+			list[i] = dynamoStreamValue(item)
+		}
+		return &types.AttributeValueMemberL{Value: list}
+	case *streamstypes.AttributeValueMemberM:
+		return &types.AttributeValueMemberM{Value: dynamoStreamItem(v.Value)}
+	}
+	return &types.AttributeValueMemberNULL{Value: true}
+}
+
+// Count returns the number of items that match the filter. The items are read with Select COUNT (see newRead),
+// so only the number of the items is transferred.
+func (c *DynamoCollection) Count(filter Filter) (int64, error) {
+	return c.cached().count(filter, 0)
+}
+
+// Exists reports whether an item matches the filter. The items are read with Select COUNT until
+// the first matching item is found.
+func (c *DynamoCollection) Exists(filter Filter) (bool, error) {
+	count, err := c.cached().count(filter, 1)
+	return count > 0, err
+}
+
+// count counts the items that match the filter with Select COUNT reads. The read stops once
+// at least max items are counted, unless max is 0.
+func (c *DynamoCollection) count(filter Filter, max int64) (int64, error) {
+	read, err := c.newRead(filter)
+	if err != nil {
+		return 0, err
+	}
+	input, err := c.readInput(read, nil, true)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	var start map[string]types.AttributeValue
+	for {
+		page, err := c.readPage(input, start)
+		if err != nil {
+			return 0, err
+		}
+
+		count += page.count
+		if len(page.lastKey) == 0 || (max > 0 && count >= max) {
+			return count, nil
+		}
+		start = page.lastKey
+	}
+}
+
+// Save creates new item or updates the existing one
+func (c *DynamoCollection) Save(object interface{}, filter Filter) (interface{}, error) {
+	return c.save(object, filter, nil)
+}
+
+// SaveIf saves the object as Save does, if the item matches the condition. The condition is added to the condition
+// expression of the write, instead of attribute_not_exists of the hash key for a new item. See ConditionalWriter.
+func (c *DynamoCollection) SaveIf(object interface{}, filter Filter, condition Filter) (interface{}, error) {
+	query, err := c.conditionQuery(condition)
+	if err != nil {
+		return nil, err
+	}
+	return c.save(object, filter, query)
+}
+
+// save creates the item if the filter is nil, otherwise updates the item matched by the filter. The write is
+// conditioned on the condition expression, if there is one.
+func (c *DynamoCollection) save(object interface{}, filter Filter, conditionQuery *DynamoQuery) (interface{}, error) {
+
+	var result interface{}
+
+	payload, err := dynamoRecord(object)
+	if err != nil {
+		return nil, err
+	}
+
+	hashKey := c.RepositoryDefinition.GetHashKey()
+
+	if filter == nil {
+		// Create item
+		item, err := c.newItem(*payload)
+		if err != nil {
+			return nil, err
+		}
+
+		expressions := newDynamoExpressions()
+		query := conditionQuery
+		if query == nil {
+			query = &DynamoQuery{Expression: "attribute_not_exists($)", Args: []interface{}{hashKey}}
+		}
+		condition, err := expressions.add(query)
+		if err != nil {
+			return nil, err
+		}
+
+		ctx, cancel := c.requestContext()
+		defer cancel()
+
+		_, err = c.client.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName:                 aws.String(c.tableName),
+			Item:                      item,
+			ConditionExpression:       aws.String(condition),
+			ExpressionAttributeNames:  expressions.attributeNames(),
+			ExpressionAttributeValues: expressions.attributeValues(),
+		})
+		if err != nil {
+			if IsConditionalCheckErr(err) {
+				if conditionQuery != nil {
+					return nil, ErrConflict("record does not match the condition")
+				}
+				return nil, ErrAlreadyExists("record already exists!")
+			}
+			return nil, err
+		}
+
+		saved := unmarshalDynamoItem(item)
+		payload = &saved
+	} else {
+		// Update item
+
+		var item interface{}
+		_, err = c.getOne(filter, &item)
+		if err != nil {
+			return nil, err
+		}
+		res := item.(map[string]interface{})
+
+		key, err := c.itemKey(res)
+		if err != nil {
+			return nil, err
+		}
+
+		updatedItem, err := c.updateItemIf(key, *payload, nil, conditionQuery)
+		if err != nil {
+			return nil, err
+		}
+		if updatedItem == nil {
+			payload = &res
+		} else {
+			payload = &updatedItem
+		}
+	}
+
+	err = MapToInterface(payload, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Patch sets the properties of set and removes the unset attributes of the first matched item, with a single
+// UpdateItem. The unset fields are document paths ("address.zip"). See Patch.
+func (c *DynamoCollection) Patch(filter Filter, set interface{}, unset []string) (interface{}, error) {
+	var result interface{}
+
+	payload, err := InterfaceToMap(set)
+	if err != nil {
+		return nil, err
+	}
+
+	var item map[string]interface{}
+	err = c.readFilter(filter, nil, 0, 1, func(found map[string]interface{}) error {
+		item = found
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, ErrNotFound("record not found")
+	}
+
+	key, err := c.itemKey(item)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := c.updateItem(key, *payload, unset)
+	if err != nil {
+		return nil, err
+	}
+	if updated == nil {
+		updated = item
+	}
+
+	err = MapToInterface(&updated, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SaveAll creates the objects (a slice) as new items, with BatchWriteItem requests of up to 25 items. Returns the
+// created records. BatchWriteItem has no condition expressions, so unlike Save, an existing item with the same key
+// is replaced. The items written before a failed request are kept.
+func (c *DynamoCollection) SaveAll(objects interface{}) (interface{}, error) {
+	records, err := objectsToRecords(objects)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]map[string]types.AttributeValue, len(records))
+	keys := map[string]bool{}
+	for i, record := range records {
+		item, err := c.newItem(record)
+		if err != nil {
+			return nil, err
+		}
+		key, err := c.itemKey(unmarshalDynamoItem(item))
+		if err != nil {
+			return nil, err
+		}
+		keyID := fmt.Sprintf("%v", unmarshalDynamoItem(key))
+		if keys[keyID] {
+			return nil, ErrInvalidInput(fmt.Sprintf("duplicate key %s in the batch", keyID))
+		}
+		keys[keyID] = true
+		items[i] = item
+	}
+
+	saved := []interface{}{}
+	for start := 0; start < len(items); start += dynamoBatchWriteSize {
+		end := start + dynamoBatchWriteSize
+		if end > len(items) {
+			end = len(items)
+		}
+		requests := make([]types.WriteRequest, 0, end-start)
+		for _, item := range items[start:end] {
+			requests = append(requests, types.WriteRequest{PutRequest: &types.PutRequest{Item: item}})
+		}
+		if err := c.batchWrite(requests); err != nil {
+			return saved, err
+		}
+		for _, item := range items[start:end] {
+			saved = append(saved, unmarshalDynamoItem(item))
+		}
+	}
+	return saved, nil
+}
+
+// batchWrite writes the requests with BatchWriteItem, resending the unprocessed requests until all are written.
+func (c *DynamoCollection) batchWrite(requests []types.WriteRequest) error {
+	for attempt := 0; len(requests) > 0; attempt++ {
+		if attempt > 0 {
+			if attempt > dynamoBatchWriteRetries {
+				return fmt.Errorf("%d items not written after %d retries", len(requests), dynamoBatchWriteRetries)
+			}
+			time.Sleep(time.Duration(1<<uint(attempt-1)) * 50 * time.Millisecond)
+		}
+
+		ctx, cancel := c.requestContext()
+		output, err := c.client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]types.WriteRequest{c.tableName: requests},
+		})
+		cancel()
+		if err != nil {
+			return err
+		}
+		requests = output.UnprocessedItems[c.tableName]
+	}
+	return nil
+}
+
+// newItem converts the record of a new item to a DynamoDB item. Generates the id if the record has none and sets
+// the TTL attribute if TTL is enabled for the table.
+func (c *DynamoCollection) newItem(record map[string]interface{}) (map[string]types.AttributeValue, error) {
+	if _, ok := record["id"]; !ok {
+		id, err := uuid.NewV4()
+		if err != nil {
+			return nil, err
+		}
+
+		record["id"] = id.String()
+	}
+
+	if c.RepositoryDefinition.EnableTTL() {
+		attribute := c.RepositoryDefinition.GetTTLAttribute()
+		TTL := c.RepositoryDefinition.GetTTL()
+
+		record[attribute] = time.Now().Add(time.Second * time.Duration(TTL))
+	}
+
+	return marshalDynamoItem(record)
+}
+
+// UpdateAll sets the attributes of the update on all items that match the filter. DynamoDB has no bulk update,
+// so the keys of the matching items are scanned first and every item is updated with UpdateItem.
+// Returns the number of the updated items. The items deleted while updating are skipped.
+func (c *DynamoCollection) UpdateAll(filter Filter, update interface{}) (int64, error) {
+	payload, err := InterfaceToMap(update)
+	if err != nil {
+		return 0, err
+	}
+
+	keys, err := c.scanKeys(filter)
+	if err != nil {
+		return 0, err
+	}
+
+	var updated int64
+	for _, key := range keys {
+		if _, err := c.updateItem(key, *payload, nil); err != nil {
+			if IsErrNotFound(err) {
+				continue
+			}
+			return updated, err
+		}
+		updated++
+	}
+	return updated, nil
+}
+
+// scanKeys returns the keys of all items that match the filter.
+func (c *DynamoCollection) scanKeys(filter Filter) ([]map[string]types.AttributeValue, error) {
+	keys := []map[string]types.AttributeValue{}
+	keyAttributes := []string{c.RepositoryDefinition.GetHashKey()}
+	if rangeKey := c.RepositoryDefinition.GetRangeKey(); rangeKey != "" {
+		keyAttributes = append(keyAttributes, rangeKey)
+	}
+	err := c.readFilter(filter, keyAttributes, 0, 0, func(item map[string]interface{}) error {
+		key, err := c.itemKey(item)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// updateItem sets the attributes of the payload, except the keys, on the existing item with the key, and removes
+// the unset attributes (document paths, like "address.zip").
+// Returns the updated item, or nil if there are no attributes to update. Returns ErrNotFound if the
+// item does not exist.
+func (c *DynamoCollection) updateItem(key map[string]types.AttributeValue, payload map[string]interface{}, unset []string) (map[string]interface{}, error) {
+	return c.updateItemIf(key, payload, unset, nil)
+}
+
+// updateItemIf updates the item like updateItem, if it also matches the condition expression (if there is one).
+// Returns ErrConflict if the item exists, but does not match the condition.
+func (c *DynamoCollection) updateItemIf(key map[string]types.AttributeValue, payload map[string]interface{}, unset []string, conditionQuery *DynamoQuery) (map[string]interface{}, error) {
+	expressions := newDynamoExpressions()
+	updateExpression, err := c.updateExpression(expressions, payload, unset)
+	if err != nil {
+		return nil, err
+	}
+	if updateExpression == "" {
+		return nil, nil
+	}
+	condition, err := expressions.add(c.existsCondition(conditionQuery))
+	if err != nil {
+		return nil, err
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(c.tableName),
+		Key:                       key,
+		UpdateExpression:          aws.String(updateExpression),
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeNames:  expressions.attributeNames(),
+		ExpressionAttributeValues: expressions.attributeValues(),
+		ReturnValues:              types.ReturnValueAllNew,
+	}
+	if conditionQuery != nil {
+		input.ReturnValuesOnConditionCheckFailure = types.ReturnValuesOnConditionCheckFailureAllOld
+	}
+
+	ctx, cancel := c.requestContext()
+	defer cancel()
+
+	output, err := c.client.UpdateItem(ctx, input)
+	if err != nil {
+		return nil, conditionError(err)
+	}
+	return unmarshalDynamoItem(output.Attributes), nil
+}
+
+// DeleteIf deletes the item matched by the filter, if it matches the condition. See ConditionalWriter.
+func (c *DynamoCollection) DeleteIf(filter Filter, condition Filter) error {
+	conditionQuery, err := c.conditionQuery(condition)
+	if err != nil {
+		return err
+	}
+
+	var item interface{}
+	if _, err := c.getOne(filter, &item); err != nil {
+		return err
+	}
+	key, err := c.itemKey(item.(map[string]interface{}))
+	if err != nil {
+		return err
+	}
+
+	expressions := newDynamoExpressions()
+	expression, err := expressions.add(c.existsCondition(conditionQuery))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := c.requestContext()
+	defer cancel()
+
+	_, err = c.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:                           aws.String(c.tableName),
+		Key:                                 key,
+		ConditionExpression:                 aws.String(expression),
+		ExpressionAttributeNames:            expressions.attributeNames(),
+		ExpressionAttributeValues:           expressions.attributeValues(),
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	return conditionError(err)
+}
+
+// conditionQuery translates the condition of a conditional write. A nil condition has no expression.
+func (c *DynamoCollection) conditionQuery(condition Filter) (*DynamoQuery, error) {
+	if condition == nil {
+		return nil, nil
+	}
+	query, err := c.scanFilter(cloneFilter(condition))
+	if err != nil {
+		return nil, err
+	}
+	if query.Expression == "" {
+		return nil, nil
+	}
+	return query, nil
+}
+
+// existsCondition returns the condition that the item exists, and matches the condition expression (if there is one).
+func (c *DynamoCollection) existsCondition(conditionQuery *DynamoQuery) *DynamoQuery {
+	condition := &DynamoQuery{Expression: "attribute_exists($)", Args: []interface{}{c.RepositoryDefinition.GetHashKey()}}
+	if conditionQuery != nil {
+		condition.and(conditionQuery.Expression, conditionQuery.Args...)
+	}
+	return condition
+}
+
+// conditionError converts the error of a write conditioned on existsCondition: ErrNotFound if the item no longer
+// exists, ErrConflict if it exists (the item is returned with ReturnValuesOnConditionCheckFailure), but does not
+// match the condition.
+func conditionError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var failed *types.ConditionalCheckFailedException
+	if !errors.As(err, &failed) {
+		return err
+	}
+	if len(failed.Item) > 0 {
+		return ErrConflict("record does not match the condition")
+	}
+	return ErrNotFound("record not found")
+}
+
+// updateExpression builds the update expression that sets the attributes of the payload, except the keys, and
+// removes the unset attributes. Returns an empty expression if there are no attributes to update.
+func (c *DynamoCollection) updateExpression(expressions *dynamoExpressions, payload map[string]interface{}, unset []string) (string, error) {
+	hashKey := c.RepositoryDefinition.GetHashKey()
+	rangeKey := c.RepositoryDefinition.GetRangeKey()
+
+	// the attribute name is always passed as expression attribute name, so names that are
+	// reserved words (status, name, timestamp...) or contain dots and dashes work as well.
+	update := &DynamoQuery{}
+	for k, v := range payload {
+		if k != hashKey && k != rangeKey {
+			if update.Expression != "" {
+				update.Expression += ", "
+			}
+			update.Expression += "$ = ?"
+			update.Args = append(update.Args, k, v)
+		}
+	}
+	remove := &DynamoQuery{}
+	for _, field := range unset {
+		if field == hashKey || field == rangeKey {
+			continue
+		}
+		if remove.Expression != "" {
+			remove.Expression += ", "
+		}
+		segments := strings.Split(field, ".")
+		remove.Expression += strings.TrimSuffix(strings.Repeat("$.", len(segments)), ".")
+		for _, segment := range segments {
+			remove.Args = append(remove.Args, segment)
+		}
+	}
+
+	updateExpression := ""
+	if update.Expression != "" {
+		set, err := expressions.add(update)
+		if err != nil {
+			return "", err
+		}
+		updateExpression = "SET " + set
+	}
+	if remove.Expression != "" {
+		removeExpression, err := expressions.add(remove)
+		if err != nil {
+			return "", err
+		}
+		updateExpression = strings.TrimSpace(updateExpression + " REMOVE " + removeExpression)
+	}
+	return updateExpression, nil
+}
+
+// DeleteOne deletes only one item at the time
+// Example filter:
+//	filter := map[string]interface{}{
+// 		"email": "keitaro-user1@keitaro.com",
+// }
+func (c *DynamoCollection) DeleteOne(filter Filter) error {
+
+	var item interface{}
+	_, err := c.getOne(filter, &item)
+	if err != nil {
+		return err
+	}
+
+	key, err := c.itemKey(item.(map[string]interface{}))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := c.requestContext()
+	defer cancel()
+
+	output, err := c.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:    aws.String(c.tableName),
+		Key:          key,
+		ReturnValues: types.ReturnValueAllOld,
+	})
+	if err != nil {
+		return err
+	}
+	if len(output.Attributes) == 0 {
+		return ErrNotFound("record not found")
+	}
+
+	return nil
+}
+
+// DeleteAll deletes all items that match the filter. The keys of the items are read first (see newRead), then the
+// items are deleted with BatchWriteItem, up to 25 per request. The unprocessed deletes are resent, like in SaveAll.
+// Example filter:
+// filter := map[string]interface{}{
+// 			"email": "keitaro-user1@keitaro.com",
+// 			"id":    "378d9777-6a32-4453-849e-858ff243635b",
+// 		}
+// email is the hash key, id is the range key
+func (c *DynamoCollection) DeleteAll(filter Filter) error {
+	hashKey := c.RepositoryDefinition.GetHashKey()
+
+	if _, ok := filter[hashKey]; !ok {
+		return ErrInvalidInput("range hash key must be provided")
+	}
+
+	keys, err := c.scanKeys(filter)
+	if err != nil {
+		return err
+	}
+
+	for start := 0; start < len(keys); start += dynamoBatchWriteSize {
+		end := start + dynamoBatchWriteSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		requests := []types.WriteRequest{}
+		for _, key := range keys[start:end] {
+			requests = append(requests, types.WriteRequest{
+				DeleteRequest: &types.DeleteRequest{Key: key},
+			})
+		}
+		if err := c.batchWrite(requests); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RawQuery scans the table with a filter expression (*DynamoQuery), or runs a PartiQL statement (*DynamoStatement)
+// with ExecuteStatement. The attribute names and the values are passed as the arguments of the expression, as
+// described in DynamoQuery, and the values as the parameters of the statement. The items selected by the statement
+// are returned; the statements that write (INSERT, UPDATE and DELETE) return no items. See RawQuerier.
+func (c *DynamoCollection) RawQuery(query interface{}, resultsTypeHint interface{}) (interface{}, error) {
+	records := []map[string]interface{}{}
+	switch rawQuery := query.(type) {
+	case *DynamoQuery:
+		err := c.readItems(&dynamoRead{filter: rawQuery}, nil, 0, 0, func(item map[string]interface{}) error {
+			records = append(records, item)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	case *DynamoStatement:
+		items, err := c.executeStatement(rawQuery)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			records = append(records, unmarshalDynamoItem(item))
+		}
+	default:
+		return nil, ErrInvalidInput(fmt.Sprintf("DynamoDB raw query must be *DynamoQuery or *DynamoStatement, got %T", query))
+	}
+	if resultsTypeHint == nil {
+		resultsTypeHint = &map[string]interface{}{}
+	}
+	return recordsToResults(records, resultsTypeHint)
+}
+
+// executeStatement runs the PartiQL statement and returns the items of all its pages.
+func (c *DynamoCollection) executeStatement(statement *DynamoStatement) ([]map[string]types.AttributeValue, error) {
+	parameters, err := statement.parameters()
+	if err != nil {
+		return nil, err
+	}
+
+	items := []map[string]types.AttributeValue{}
+	var nextToken *string
+	for {
+		ctx, cancel := c.requestContext()
+		output, err := c.client.ExecuteStatement(ctx, &dynamodb.ExecuteStatementInput{
+			Statement:  aws.String(statement.Statement),
+			Parameters: parameters,
+			NextToken:  nextToken,
+		})
+		cancel()
+		if err != nil {
+			return nil, dynamoStatementError(err)
+		}
+		items = append(items, output.Items...)
+		nextToken = output.NextToken
+		if nextToken == nil {
+			return items, nil
+		}
+	}
+}
+
+// DynamoStatementResult is the result of a statement of ExecuteBatch: the selected item, or the error of the
+// statement.
+type DynamoStatementResult struct {
+	Item map[string]interface{}
+	Err  error
+}
+
+// ExecuteBatch runs up to 25 PartiQL statements with a single BatchExecuteStatement request. The statements must all
+// read single items (a SELECT by the full primary key) or all write. They are not run atomically: each statement
+// succeeds or fails on its own, so the results have the item (for the reads) or the error of each statement, in the
+// order of the statements - ErrConflict if the condition of the statement failed, ErrAlreadyExists if an INSERT
+// found an existing item. Returns ErrInvalidInput if there are more than 25 statements.
+func (c *DynamoCollection) ExecuteBatch(statements []*DynamoStatement) ([]*DynamoStatementResult, error) {
+	if len(statements) > dynamoBatchStatementSize {
+		return nil, ErrInvalidInput(fmt.Sprintf("at most %d statements can be run in a batch, got %d", dynamoBatchStatementSize, len(statements)))
+	}
+	if len(statements) == 0 {
+		return []*DynamoStatementResult{}, nil
+	}
+
+	requests := []types.BatchStatementRequest{}
+	for _, statement := range statements {
+		parameters, err := statement.parameters()
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, types.BatchStatementRequest{
+			Statement:  aws.String(statement.Statement),
+			Parameters: parameters,
+		})
+	}
+
+	ctx, cancel := c.requestContext()
+	defer cancel()
+	output, err := c.client.BatchExecuteStatement(ctx, &dynamodb.BatchExecuteStatementInput{Statements: requests})
+	if err != nil {
+		return nil, ErrBackendError(err)
+	}
+
+	results := []*DynamoStatementResult{}
+	for _, response := range output.Responses {
+		result := &DynamoStatementResult{}
+		if response.Item != nil {
+			result.Item = unmarshalDynamoItem(response.Item)
+		}
+		if response.Error != nil {
+			message := fmt.Sprintf("%s: %s", response.Error.Code, aws.ToString(response.Error.Message))
+			switch response.Error.Code {
+			case types.BatchStatementErrorCodeEnumConditionalCheckFailed:
+				result.Err = ErrConflict(message)
+			case types.BatchStatementErrorCodeEnumDuplicateItem:
+				result.Err = ErrAlreadyExists(message)
+			default:
+				result.Err = ErrBackendError(message)
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// dynamoStatementError converts the error of ExecuteStatement: ErrConflict if the condition of the statement failed,
+// ErrAlreadyExists if an INSERT found an existing item.
+func dynamoStatementError(err error) error {
+	var duplicate *types.DuplicateItemException
+	switch {
+	case IsConditionalCheckErr(err):
+		return ErrConflict(err.Error())
+	case errors.As(err, &duplicate):
+		return ErrAlreadyExists(err.Error())
+	}
+	return ErrBackendError(err)
+}
+
+// AddChild appends the child to the list attribute of the parent item with list_append. The update is conditioned on
+// the size of the list, so the check for a duplicate id holds even if the list is modified concurrently.
+func (c *DynamoCollection) AddChild(parent Filter, field string, idProperty string, child map[string]interface{}) error {
+	return c.updateChildren(parent, field, func(children []map[string]interface{}) (*DynamoQuery, *DynamoQuery, error) {
+		if childIndex(children, idProperty, child[idProperty]) >= 0 {
+			return nil, nil, ErrAlreadyExists(fmt.Sprintf("child %v already exists in %s", child[idProperty], field))
+		}
+		if children == nil {
+			return &DynamoQuery{Expression: "SET $ = ?", Args: []interface{}{field, []interface{}{child}}},
+				&DynamoQuery{Expression: "attribute_not_exists($)", Args: []interface{}{field}}, nil
+		}
+		return &DynamoQuery{Expression: "SET $ = list_append($, ?)", Args: []interface{}{field, field, []interface{}{child}}},
+			&DynamoQuery{Expression: "size($) = ?", Args: []interface{}{field, len(children)}}, nil
+	})
+}
+
+// UpdateChild sets the properties of the child with a document path (addresses[2].city). The update is conditioned on
+// the id of the child at that index.
+func (c *DynamoCollection) UpdateChild(parent Filter, field string, idProperty string, childID interface{}, update map[string]interface{}) error {
+	return c.updateChildren(parent, field, func(children []map[string]interface{}) (*DynamoQuery, *DynamoQuery, error) {
+		index := childIndex(children, idProperty, childID)
+		if index < 0 {
+			return nil, nil, ErrNotFound(fmt.Sprintf("child %v not found in %s", childID, field))
+		}
+		query := &DynamoQuery{}
+		for k, v := range update {
+			if query.Expression != "" {
+				query.Expression += ", "
+			}
+			query.Expression += fmt.Sprintf("$[%d].$ = ?", index)
+			query.Args = append(query.Args, field, k, v)
+		}
+		query.Expression = "SET " + query.Expression
+		return query, &DynamoQuery{Expression: fmt.Sprintf("$[%d].$ = ?", index), Args: []interface{}{field, idProperty, children[index][idProperty]}}, nil
+	})
+}
+
+// RemoveChild removes the child from the list attribute by its index. The update is conditioned on the id of the
+// child at that index.
+func (c *DynamoCollection) RemoveChild(parent Filter, field string, idProperty string, childID interface{}) error {
+	return c.updateChildren(parent, field, func(children []map[string]interface{}) (*DynamoQuery, *DynamoQuery, error) {
+		index := childIndex(children, idProperty, childID)
+		if index < 0 {
+			return nil, nil, ErrNotFound(fmt.Sprintf("child %v not found in %s", childID, field))
+		}
+		return &DynamoQuery{Expression: fmt.Sprintf("REMOVE $[%d]", index), Args: []interface{}{field}},
+			&DynamoQuery{Expression: fmt.Sprintf("$[%d].$ = ?", index), Args: []interface{}{field, idProperty, children[index][idProperty]}}, nil
+	})
+}
+
+// updateChildren fetches the parent item and runs the update built from its children. The children are nil if the
+// item has no such attribute. The update is retried if its condition fails, because the list was modified concurrently.
+func (c *DynamoCollection) updateChildren(parent Filter, field string, build func(children []map[string]interface{}) (*DynamoQuery, *DynamoQuery, error)) error {
+	for attempt := 0; attempt < dynamoChildrenRetries; attempt++ {
+		var item map[string]interface{}
+		err := c.readFilter(parent, nil, 0, 1, func(found map[string]interface{}) error {
+			item = found
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if item == nil {
+			return ErrNotFound("record not found")
+		}
+
+		var children []map[string]interface{}
+		if value, ok := item[field]; ok {
+			children = childRecords(value)
+		}
+		update, condition, err := build(children)
+		if err != nil {
+			return err
+		}
+
+		key, err := c.itemKey(item)
+		if err != nil {
+			return err
+		}
+		expressions := newDynamoExpressions()
+		updateExpression, err := expressions.add(update)
+		if err != nil {
+			return err
+		}
+		conditionExpression, err := expressions.add(condition)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := c.requestContext()
+		_, err = c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:                 aws.String(c.tableName),
+			Key:                       key,
+			UpdateExpression:          aws.String(updateExpression),
+			ConditionExpression:       aws.String(conditionExpression),
+			ExpressionAttributeNames:  expressions.attributeNames(),
+			ExpressionAttributeValues: expressions.attributeValues(),
+		})
+		cancel()
+		if err == nil || !IsConditionalCheckErr(err) {
+			return err
+		}
+	}
+	return ErrBackendError(fmt.Sprintf("%s was modified concurrently, giving up after %d attempts", field, dynamoChildrenRetries))
+}
+
+// Explain counts the items that match the filter with Select COUNT reads, and reports the number of the read items.
+// The table or its GSI is queried if the filter matches the key of the index (see newRead), otherwise the table is
+// scanned. See ExplainRepository.
+func (c *DynamoCollection) Explain(filter Filter, order string, sorting string) (*QueryPlan, error) {
+	read, err := c.newRead(filter)
+	if err != nil {
+		return nil, err
+	}
+	input, err := c.readInput(read, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	counting, err := c.readInput(read, nil, true)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &QueryPlan{
+		Backend:  "dynamodb",
+		Query:    input,
+		FullScan: read.key == nil,
+		Index:    read.indexKey.index,
+	}
+	start := time.Now()
+	var startKey map[string]types.AttributeValue
+	for {
+		page, err := c.readPage(counting, startKey)
+		if err != nil {
+			return nil, err
+		}
+
+		plan.Scanned += page.scanned
+		plan.Matched += page.count
+		if len(page.lastKey) == 0 {
+			break
+		}
+		startKey = page.lastKey
+	}
+	plan.Duration = time.Since(start)
+	return plan, nil
+}
+
+// EstimatedCount returns the number of the items of the table, as reported by DescribeTable. See EstimatedCounter.
+func (c *DynamoCollection) EstimatedCount() (int64, error) {
+	stats, err := c.Stats()
+	if err != nil {
+		return 0, err
+	}
+	return stats.Records, nil
+}
+
+// Stats returns the number of the items and the size of the table, as reported by DescribeTable.
+// DynamoDB updates these values approximately every six hours.
+func (c *DynamoCollection) Stats() (*RepositoryStats, error) {
+	ctx, cancel := c.requestContext()
+	defer cancel()
+
+	output, err := c.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(c.tableName),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &RepositoryStats{
+		Records:   aws.ToInt64(output.Table.ItemCount),
+		SizeBytes: aws.ToInt64(output.Table.TableSizeBytes),
+	}, nil
+}
+
+// dynamoRead is a read of the items that match a filter: a Query of the table or of a GSI if the filter matches
+// the hash key of the index, otherwise a Scan of the table.
+type dynamoRead struct {
+	// indexKey is the key of the queried index.
+	indexKey dynamoIndexKey
+	// key is the key condition of the Query, nil for a Scan.
+	key *DynamoQuery
+	// filter is the filter expression of the read.
+	filter *DynamoQuery
+	// forward is the order of the queried items by the range key, nil for ascending.
+	forward *bool
+}
+
+// partial reports whether the items read lack some of the fields (any attribute if there are no fields), because
+// they are not projected into the queried GSI. The partial items are fetched from the table (see tableItems).
+func (r *dynamoRead) partial(fields []string) bool {
+	if r.key == nil || r.indexKey.projected == nil {
+		return false
+	}
+	return len(fields) == 0 || !r.indexKey.covers(fields)
+}
+
+// orderBy orders the queried items by the range key of the index, if it is the order. Reports whether the items are
+// read in the order, which DynamoDB can not do for the scans and the other attributes.
+func (r *dynamoRead) orderBy(order string, sorting string) bool {
+	if order == "" {
+		return true
+	}
+	if r.key != nil && order == r.indexKey.rangeKey {
+		r.forward = aws.Bool(sorting != "desc")
+		return true
+	}
+	return false
+}
+
+// dynamoIndexKey is the key schema of the table (the index is empty) or of a GSI.
+type dynamoIndexKey struct {
+	index     string
+	local     bool
+	hashKey   string
+	hashType  string
+	rangeKey  string
+	rangeType string
+	// projected are the attributes projected into a GSI, nil if all attributes are projected
+	projected []string
+}
+
+// covers reports whether the attributes (or the paths of the nested attributes) are projected into the index.
+func (k dynamoIndexKey) covers(attributes []string) bool {
+	if k.projected == nil {
+		return true
+	}
+	for _, attribute := range attributes {
+		if !contains(k.projected, strings.Split(attribute, ".")[0]) {
+			return false
+		}
+	}
+	return true
+}
+
+// dynamoPage is a page of the items read by a Query or a Scan.
+type dynamoPage struct {
+	items   []map[string]types.AttributeValue
+	count   int64
+	scanned int64
+	lastKey map[string]types.AttributeValue
+}
+
+// dynamoIndexName returns the name of the GSI on the attribute.
+func dynamoIndexName(attribute string) string {
+	return fmt.Sprintf("%s-index", attribute)
+}
+
+// dynamoLocalIndexName returns the name of the LSI on the attribute.
+func dynamoLocalIndexName(attribute string) string {
+	return fmt.Sprintf("%s-local-index", attribute)
+}
+
+// dynamoIndexKeys returns the keys of the table that can be queried: the primary key of the table first, then the
+// GSIs and the LSIs by name. A GSI is on the hash key of the table, or has the attribute as hash key and the optional
+// "rangeKey" of its definition as range key, with the attributes of its "projection" (see dynamoIndexProjection).
+// The GSIs on the range key of the table have no hash key, so they are not queried. An LSI has the hash key of the
+// table and the attribute as range key.
+func dynamoIndexKeys(repoDef RepositoryDefinition) []dynamoIndexKey {
+	table := dynamoIndexKey{
+		hashKey:   repoDef.GetHashKey(),
+		hashType:  dynamoKeyType(repoDef.GetHashKeyType()),
+		rangeKey:  repoDef.GetRangeKey(),
+		rangeType: dynamoKeyType(repoDef.GetRangeKeyType()),
+	}
+
+	indexes := []dynamoIndexKey{}
+	for attribute, value := range repoDef.GetGSI() {
+		if attribute == table.rangeKey {
+			continue
+		}
+		definition, _ := value.(map[string]interface{})
+		rangeKey, _ := definition["rangeKey"].(string)
+		key := dynamoIndexKey{
+			index:     dynamoIndexName(attribute),
+			hashKey:   attribute,
+			hashType:  dynamoKeyType(definition["type"]),
+			rangeKey:  rangeKey,
+			rangeType: dynamoKeyType(definition["rangeKeyType"]),
+		}
+		if attribute == table.hashKey {
+			key.hashType = table.hashType
+		}
+		projection, err := dynamoIndexProjection(definition)
+		if err != nil {
+			continue
+		}
+		if projection.ProjectionType != types.ProjectionTypeAll {
+			key.projected = append([]string{table.hashKey, table.rangeKey, key.hashKey, key.rangeKey}, projection.NonKeyAttributes...)
+		}
+		indexes = append(indexes, key)
+	}
+	sort.Slice(indexes, func(i, j int) bool {
+		return indexes[i].index < indexes[j].index
+	})
+
+	localIndexes := []dynamoIndexKey{}
+	if table.rangeKey != "" {
+		for attribute, value := range dynamoDefinition(repoDef).GetLSI() {
+			definition, _ := value.(map[string]interface{})
+			localIndexes = append(localIndexes, dynamoIndexKey{
+				index:     dynamoLocalIndexName(attribute),
+				local:     true,
+				hashKey:   table.hashKey,
+				hashType:  table.hashType,
+				rangeKey:  attribute,
+				rangeType: dynamoKeyType(definition["type"]),
+			})
+		}
+	}
+	sort.Slice(localIndexes, func(i, j int) bool {
+		return localIndexes[i].index < localIndexes[j].index
+	})
+
+	return append(append([]dynamoIndexKey{table}, indexes...), localIndexes...)
+}
+
+// dynamoKeyType returns the attribute type of a key ("S", "N" or "B"), "S" if it is not set.
+func dynamoKeyType(keyType interface{}) string {
+	if s, ok := keyType.(string); ok && s != "" {
+		return s
+	}
+	return "S"
+}
 
-	if repoDef.EnableTTL() {
-		enabled := repoDef.EnableTTL()
-		attribute := repoDef.GetTTLAttribute()
-		tableName := repoDef.GetName()
-		TTL := repoDef.GetTTL()
+// newRead plans the read of the items that match the filter. An index of dynamoIndexKeys can be queried if the filter
+// matches its hash key with a plain value, and the conditions on its range key make a key condition: an equality,
+// one comparison, or a range with $gte and $lte (a Query can not filter the items by the keys of the index). The
+// index whose key condition covers the most conditions is queried, the first one of dynamoIndexKeys if there are
+// more. A GSI that does not project all attributes is queried only if the other conditions are on the projected
+// attributes, and the items are then fetched from the table (see partial). The table is scanned if no index can be
+// queried.
+func (c *DynamoCollection) newRead(filter Filter) (*dynamoRead, error) {
+	ast, err := ParseFilter(filter)
+	if err != nil {
+		return nil, err
+	}
 
-		if attribute == "" {
-			return ErrBackendError("TTL attribute is reqired when TTL is enabled")
+	var best *dynamoRead
+	var bestRest *FilterAST
+	for _, indexKey := range dynamoIndexKeys(c.RepositoryDefinition) {
+		key, rest, ok := dynamoKeyCondition(ast, indexKey)
+		if !ok || (bestRest != nil && len(rest.Conditions) >= len(bestRest.Conditions)) {
+			continue
 		}
-
-		if TTL == 0 {
-			return ErrBackendError("TTL value is missing and must be greater than zero")
+		// the items of a GSI are filtered by the projected attributes only
+		filtered := []string{}
+		for _, cond := range rest.Conditions {
+			filtered = append(filtered, cond.Property)
 		}
-
-		err := svc.WaitUntilTableExists(&dynamodb.DescribeTableInput{
-			TableName: &tableName,
-		})
+		if _, ok := ttlGrace(c.RepositoryDefinition); ok {
+			filtered = append(filtered, c.RepositoryDefinition.GetTTLAttribute())
+		}
+		if !indexKey.covers(filtered) {
+			continue
+		}
+		best = &dynamoRead{indexKey: indexKey, key: key}
+		bestRest = rest
+	}
+	if best != nil {
+		query, err := c.filterQuery(bestRest)
 		if err != nil {
-			return nil
+			return nil, err
 		}
-
-		svc.UpdateTimeToLive(&dynamodb.UpdateTimeToLiveInput{
-			TableName: &tableName,
-			TimeToLiveSpecification: &dynamodb.TimeToLiveSpecification{
-				AttributeName: &attribute,
-				Enabled:       &enabled,
-			},
-		})
+		best.filter = query
+		return best, nil
 	}
 
-	return nil
+	query, err := c.filterQuery(ast)
+	if err != nil {
+		return nil, err
+	}
+	return &dynamoRead{filter: query}, nil
 }
 
-// GetOne looks up for an item by given filter
-// Example filter:
-//	filter := Filter{
-// 		"id":    "54acb6c5-baeb-4213-b10f-e707a6055e64",
-// }
-func (c *DynamoCollection) GetOne(filter Filter, result interface{}) (interface{}, error) {
-
-	var record map[string]interface{}
-	var records []map[string]interface{}
+// dynamoKeyCondition splits the conditions of the AST into the key condition of the index and the other conditions.
+// Returns false if the index can not be queried with the conditions.
+func dynamoKeyCondition(ast *FilterAST, indexKey dynamoIndexKey) (*DynamoQuery, *FilterAST, bool) {
+	if indexKey.hashKey == "" {
+		return nil, nil, false
+	}
 
-	var query []string
-	var args []interface{}
-	for k, v := range filter {
-		query = append(query, "$ = ?")
-		args = append(args, k)
-		args = append(args, v)
+	hash := []*FilterCondition{}
+	ranges := map[string]interface{}{}
+	rest := &FilterAST{Conditions: []*FilterCondition{}}
+	for _, cond := range ast.Conditions {
+		switch {
+		case cond.Property == indexKey.hashKey:
+			hash = append(hash, cond)
+		case indexKey.rangeKey != "" && cond.Property == indexKey.rangeKey:
+			ranges[cond.Operator] = cond.Value
+		default:
+			rest.Conditions = append(rest.Conditions, cond)
+		}
+	}
+	if len(hash) != 1 || hash[0].Operator != OpEq || !dynamoKeyValue(hash[0].Value, indexKey.hashType) {
+		return nil, nil, false
+	}
+	for _, value := range ranges {
+		if !dynamoKeyValue(value, indexKey.rangeType) {
+			return nil, nil, false
+		}
 	}
 
-	if c.RepositoryDefinition.EnableTTL() {
-		query = append(query, "$ > ?")
-		args = append(args, c.RepositoryDefinition.GetTTLAttribute())
-		args = append(args, time.Now())
+	key := &DynamoQuery{Expression: "$ = ?", Args: []interface{}{indexKey.hashKey, hash[0].Value}}
+	_, gte := ranges[OpGte]
+	_, lte := ranges[OpLte]
+	switch {
+	case len(ranges) == 0:
+	case len(ranges) == 2 && gte && lte:
+		key.and("$ BETWEEN ? AND ?", indexKey.rangeKey, ranges[OpGte], ranges[OpLte])
+	case len(ranges) == 1:
+		for operator, value := range ranges {
+			symbol, ok := comparisonOperators[operator]
+			if operator == OpEq {
+				symbol, ok = "=", true
+			}
+			if !ok {
+				return nil, nil, false
+			}
+			key.and(fmt.Sprintf("$ %s ?", symbol), indexKey.rangeKey, value)
+		}
+	default:
+		return nil, nil, false
 	}
+	return key, rest, true
+}
 
-	err := c.Table.Scan().Filter(strings.Join(query, " AND "), args...).Limit(int64(1)).All(&records)
+// dynamoKeyValue reports whether the value can be the value of a key of the type in a key condition.
+func dynamoKeyValue(value interface{}, keyType string) bool {
+	attribute, err := marshalDynamoValue(value)
 	if err != nil {
-		return nil, err
+		return false
 	}
-	if records == nil {
-		return nil, ErrNotFound("Record not found")
+	switch v := attribute.(type) {
+	case *types.AttributeValueMemberS:
+		return keyType == "S" && v.Value != ""
+	case *types.AttributeValueMemberN:
+		return keyType == "N"
+	case *types.AttributeValueMemberB:
+		return keyType == "B"
 	}
+	return false
+}
 
-	record = records[0]
-	err = MapToInterface(&record, &result)
+// readFilter reads the items that match the filter. See readItems.
+func (c *DynamoCollection) readFilter(filter Filter, fields []string, offset int, limit int, fn func(item map[string]interface{}) error) error {
+	read, err := c.newRead(filter)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return result, nil
+	return c.readItems(read, fields, offset, limit, fn)
 }
 
-// GetAll returns all matched records. You can specify limit and offset as well.
-func (c *DynamoCollection) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
-	var results reflect.Value
+// readItems reads the items of the read, skips the first offset items and calls fn for at most limit items
+// (all items if limit is 0).
+func (c *DynamoCollection) readItems(read *dynamoRead, fields []string, offset int, limit int, fn func(item map[string]interface{}) error) error {
+	_, _, err := c.readFrom(read, fields, nil, offset, limit, fn)
+	return err
+}
 
-	resultHint := AsPtr(resultsTypeHint)
+// readFrom reads the items of the read after the start key (from the first item if the start key is nil), like
+// readItems. Returns the last item passed to fn, and whether the read stopped at the limit before all items were read.
+func (c *DynamoCollection) readFrom(read *dynamoRead, fields []string, start map[string]types.AttributeValue, offset int, limit int, fn func(item map[string]interface{}) error) (map[string]types.AttributeValue, bool, error) {
+	partial := read.partial(fields)
+	readFields := fields
+	if partial {
+		readFields = nil
+	}
+	input, err := c.readInput(read, readFields, false)
+	if err != nil {
+		return nil, false, err
+	}
 
-	results = NewSliceOfType(resultHint)
+	skipped := 0
+	count := 0
+	var last map[string]types.AttributeValue
+	for {
+		page, err := c.readPage(input, start)
+		if err != nil {
+			return nil, false, err
+		}
 
-	var query []string
-	var args []interface{}
-	for k, v := range filter {
-		if specs, ok := v.(map[string]interface{}); ok {
-			if pattern, ok := specs["$pattern"]; ok {
-				for _, cond := range patternToDynamodbCondition(pattern.(string)) {
-					query = append(query, fmt.Sprintf("$ %s ?", cond.condition))
-					args = append(args, k)
-					args = append(args, cond.value)
-				}
+		items := page.items
+		if partial {
+			if items, err = c.tableItems(items); err != nil {
+				return nil, false, err
+			}
+		}
+		for i, item := range items {
+			if skipped < offset {
+				skipped++
+				continue
+			}
+			record := unmarshalDynamoItem(item)
+			if partial && len(fields) > 0 {
+				record = projectRecord(record, fields)
+			}
+			if err := fn(record); err != nil {
+				return nil, false, err
+			}
+			last = item
+			count++
+			if limit > 0 && count >= limit {
+				return last, i < len(items)-1 || len(page.lastKey) > 0, nil
 			}
-			continue
 		}
-		query = append(query, "$ = ?")
-		args = append(args, k)
-		args = append(args, v)
-	}
 
-	if c.RepositoryDefinition.EnableTTL() {
-		query = append(query, "$ > ?")
-		args = append(args, c.RepositoryDefinition.GetTTLAttribute())
-		args = append(args, time.Now())
+		if len(page.lastKey) == 0 {
+			return last, false, nil
+		}
+		start = page.lastKey
 	}
+}
 
-	startFrom := 1
-	if offset != 0 {
-		startFrom = offset + 1
+// tableItems fetches the items of the table with the keys of the items read from a GSI, in the same order. The items
+// deleted since they were read are skipped.
+func (c *DynamoCollection) tableItems(items []map[string]types.AttributeValue) ([]map[string]types.AttributeValue, error) {
+	keys := make([]map[string]types.AttributeValue, 0, len(items))
+	keyIDs := make([]string, 0, len(items))
+	for _, item := range items {
+		key := c.tableKey(item)
+		keys = append(keys, key)
+		keyIDs = append(keyIDs, fmt.Sprintf("%v", unmarshalDynamoItem(key)))
 	}
 
-	itr := c.Table.Scan().Filter(strings.Join(query, " AND "), args...).SearchLimit(int64(startFrom)).Iter()
-	for i := 0; ; i++ {
-		record, err := CreateNewAsExample(resultHint)
+	byKey := map[string]map[string]types.AttributeValue{}
+	for start := 0; start < len(keys); start += dynamoBatchGetSize {
+		end := start + dynamoBatchGetSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		fetched, err := c.batchGet(keys[start:end])
 		if err != nil {
 			return nil, err
 		}
-		more := itr.Next(record)
-		if itr.Err() != nil {
-			return nil, itr.Err()
+		for _, item := range fetched {
+			byKey[fmt.Sprintf("%v", unmarshalDynamoItem(c.tableKey(item)))] = item
 		}
-		if !more {
-			break
+	}
+
+	ordered := make([]map[string]types.AttributeValue, 0, len(items))
+	for _, keyID := range keyIDs {
+		if item, ok := byKey[keyID]; ok {
+			ordered = append(ordered, item)
 		}
-		if limit != 0 && i >= limit {
-			break
+	}
+	return ordered, nil
+}
+
+// tableKey returns the primary key (hash and range key) of the DynamoDB item.
+func (c *DynamoCollection) tableKey(item map[string]types.AttributeValue) map[string]types.AttributeValue {
+	key := map[string]types.AttributeValue{}
+	for _, attribute := range []string{c.RepositoryDefinition.GetHashKey(), c.RepositoryDefinition.GetRangeKey()} {
+		if attribute != "" {
+			key[attribute] = item[attribute]
 		}
-		results = reflect.ValueOf(reflect.Append(results, reflect.ValueOf(record)).Interface())
+	}
+	return key
+}
 
-		itr = c.Table.Scan().StartFrom(itr.LastEvaluatedKey()).SearchLimit(1).Iter()
+// readInput returns the input of the read: *dynamodb.QueryInput if the read has a key condition, otherwise
+// *dynamodb.ScanInput. Only the number of the items is read if count is true.
+func (c *DynamoCollection) readInput(read *dynamoRead, fields []string, count bool) (interface{}, error) {
+	expressions := newDynamoExpressions()
+	var keyExpression, filterExpression, projection *string
+	if read.key != nil {
+		expression, err := expressions.add(read.key)
+		if err != nil {
+			return nil, err
+		}
+		keyExpression = aws.String(expression)
+	}
+	if read.filter.Expression != "" {
+		expression, err := expressions.add(read.filter)
+		if err != nil {
+			return nil, err
+		}
+		filterExpression = aws.String(expression)
+	}
+	if len(fields) > 0 {
+		expression, err := expressions.add(dynamoProjection(fields))
+		if err != nil {
+			return nil, err
+		}
+		projection = aws.String(expression)
+	}
+	var selection types.Select
+	if count {
+		selection = types.SelectCount
+	} else if read.indexKey.local && projection == nil {
+		// the attributes that are not projected into the LSI are fetched from the table
+		selection = types.SelectAllAttributes
 	}
 
-	return results.Interface(), nil
+	if read.key == nil {
+		return &dynamodb.ScanInput{
+			TableName:                 aws.String(c.tableName),
+			FilterExpression:          filterExpression,
+			ProjectionExpression:      projection,
+			Select:                    selection,
+			ExpressionAttributeNames:  expressions.attributeNames(),
+			ExpressionAttributeValues: expressions.attributeValues(),
+		}, nil
+	}
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(c.tableName),
+		KeyConditionExpression:    keyExpression,
+		FilterExpression:          filterExpression,
+		ProjectionExpression:      projection,
+		Select:                    selection,
+		ScanIndexForward:          read.forward,
+		ExpressionAttributeNames:  expressions.attributeNames(),
+		ExpressionAttributeValues: expressions.attributeValues(),
+	}
+	if read.indexKey.index != "" {
+		input.IndexName = aws.String(read.indexKey.index)
+	}
+	return input, nil
 }
 
-// Save creates new item or updates the existing one
-func (c *DynamoCollection) Save(object interface{}, filter Filter) (interface{}, error) {
+// readPage reads the page of the input of readInput that starts after the start key (the first page if the start
+// key is nil).
+func (c *DynamoCollection) readPage(input interface{}, start map[string]types.AttributeValue) (*dynamoPage, error) {
+	ctx, cancel := c.requestContext()
+	defer cancel()
 
-	var result interface{}
+	if query, ok := input.(*dynamodb.QueryInput); ok {
+		query.ExclusiveStartKey = start
+		output, err := c.reader().Query(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		return &dynamoPage{
+			items:   output.Items,
+			count:   int64(output.Count),
+			scanned: int64(output.ScannedCount),
+			lastKey: output.LastEvaluatedKey,
+		}, nil
+	}
 
-	payload, err := InterfaceToMap(object)
+	scan := input.(*dynamodb.ScanInput)
+	scan.ExclusiveStartKey = start
+	output, err := c.client.Scan(ctx, scan)
 	if err != nil {
 		return nil, err
 	}
+	return &dynamoPage{
+		items:   output.Items,
+		count:   int64(output.Count),
+		scanned: int64(output.ScannedCount),
+		lastKey: output.LastEvaluatedKey,
+	}, nil
+}
 
-	hashKey := c.RepositoryDefinition.GetHashKey()
-	rangeKey := c.RepositoryDefinition.GetRangeKey()
+// dynamoProjection returns the projection expression of the fields. The nested attributes are given as paths
+// ("profile.name").
+func dynamoProjection(fields []string) *DynamoQuery {
+	paths := []string{}
+	args := []interface{}{}
+	for _, field := range fields {
+		segments := strings.Split(field, ".")
+		for _, segment := range segments {
+			args = append(args, segment)
+		}
+		paths = append(paths, strings.TrimSuffix(strings.Repeat("$.", len(segments)), "."))
+	}
+	return &DynamoQuery{Expression: strings.Join(paths, ", "), Args: args}
+}
 
-	if filter == nil {
-		// Create item
-		if _, ok := (*payload)["id"]; !ok {
-			id, err := uuid.NewV4()
+// encodeDynamoPageToken encodes the key of an item as a page token. The key attributes keep their types, so the
+// token can be sent back as ExclusiveStartKey.
+func encodeDynamoPageToken(key map[string]types.AttributeValue) (string, error) {
+	attributes := map[string]map[string]string{}
+	for name, value := range key {
+		switch v := value.(type) {
+		case *types.AttributeValueMemberS:
+			attributes[name] = map[string]string{"S": v.Value}
+		case *types.AttributeValueMemberN:
+			attributes[name] = map[string]string{"N": v.Value}
+		case *types.AttributeValueMemberB:
+			attributes[name] = map[string]string{"B": base64.StdEncoding.EncodeToString(v.Value)}
+		default:
+			return "", ErrBackendError(fmt.Sprintf("key attribute %s must be a string, a number or binary", name))
+		}
+	}
+	return encodePageToken(attributes)
+}
+
+// decodeDynamoPageToken decodes the key of the page token of encodeDynamoPageToken. Returns ErrInvalidInput if the
+// token is invalid.
+func decodeDynamoPageToken(pageToken string) (map[string]types.AttributeValue, error) {
+	attributes := map[string]map[string]string{}
+	if err := decodePageToken(pageToken, &attributes); err != nil || len(attributes) == 0 {
+		return nil, ErrInvalidInput("invalid page token")
+	}
+	key := map[string]types.AttributeValue{}
+	for name, value := range attributes {
+		if s, ok := value["S"]; ok {
+			key[name] = &types.AttributeValueMemberS{Value: s}
+		} else if n, ok := value["N"]; ok {
+			key[name] = &types.AttributeValueMemberN{Value: n}
+		} else if b, ok := value["B"]; ok {
+			data, err := base64.StdEncoding.DecodeString(b)
 			if err != nil {
-				return nil, err
+				return nil, ErrInvalidInput("invalid page token")
 			}
+			key[name] = &types.AttributeValueMemberB{Value: data}
+		} else {
+			return nil, ErrInvalidInput("invalid page token")
+		}
+	}
+	return key, nil
+}
 
-			(*payload)["id"] = id.String()
+// itemKey returns the primary key (hash and range key) of the item.
+func (c *DynamoCollection) itemKey(item map[string]interface{}) (map[string]types.AttributeValue, error) {
+	key := map[string]interface{}{}
+	for _, keyAttribute := range []string{c.RepositoryDefinition.GetHashKey(), c.RepositoryDefinition.GetRangeKey()} {
+		if keyAttribute != "" {
+			key[keyAttribute] = item[keyAttribute]
 		}
+	}
+	return marshalDynamoItem(key)
+}
 
-		if c.RepositoryDefinition.EnableTTL() {
-			attribute := c.RepositoryDefinition.GetTTLAttribute()
-			TTL := c.RepositoryDefinition.GetTTL()
+// marshalDynamoItem converts the record to a DynamoDB item.
+func marshalDynamoItem(record map[string]interface{}) (map[string]types.AttributeValue, error) {
+	value, err := marshalDynamoValue(record)
+	if err != nil {
+		return nil, err
+	}
+	return value.(*types.AttributeValueMemberM).Value, nil
+}
 
-			(*payload)[attribute] = time.Now().Add(time.Second * time.Duration(TTL))
-		}
+// marshalDynamoValue converts the value to a DynamoDB attribute value without a JSON round trip, so the numbers
+// keep their precision and []byte is stored as binary. The structs are stored as maps, see MarshalDynamoItem. The
+// dates are stored as strings in TimeLayout, so DynamoDB compares them correctly.
+func marshalDynamoValue(value interface{}) (types.AttributeValue, error) {
+	return encodeDynamoValue(reflect.ValueOf(value))
+}
 
-		av, err := dynamodbattribute.MarshalMap(payload)
-		if err != nil {
-			return nil, err
+// toDynamoValue converts the JSON value to a DynamoDB attribute value.
+func toDynamoValue(value interface{}) types.AttributeValue {
+	switch v := value.(type) {
+	case string:
+		return &types.AttributeValueMemberS{Value: v}
+	case float64:
+		return &types.AttributeValueMemberN{Value: strconv.FormatFloat(v, 'f', -1, 64)}
+	case bool:
+		return &types.AttributeValueMemberBOOL{Value: v}
+	case []interface{}:
+		list := make([]types.AttributeValue, len(v))
+		for i, item := range v {
+			list[i] = toDynamoValue(item)
 		}
-
-		err = c.Table.Put(av).If("attribute_not_exists($)", hashKey).Run()
-		if err != nil {
-			if IsConditionalCheckErr(err) {
-				return nil, ErrAlreadyExists("record already exists!")
-			}
-			return nil, err
+		return &types.AttributeValueMemberL{Value: list}
+	case map[string]interface{}:
+		m := make(map[string]types.AttributeValue, len(v))
+		for key, item := range v {
+			m[key] = toDynamoValue(item)
 		}
-	} else {
-		// Update item
+		return &types.AttributeValueMemberM{Value: m}
+	}
+	return &types.AttributeValueMemberNULL{Value: true}
+}
 
-		var item interface{}
-		_, err = c.GetOne(filter, &item)
-		if err != nil {
-			return nil, err
-		}
-		res := item.(map[string]interface{})
+// unmarshalDynamoItem converts the DynamoDB item to a record.
+func unmarshalDynamoItem(item map[string]types.AttributeValue) map[string]interface{} {
+	record := make(map[string]interface{}, len(item))
+	for key, value := range item {
+		record[key] = fromDynamoValue(value)
+	}
+	return record
+}
 
-		query := c.Table.Update(hashKey, res[hashKey])
-		if rangeKey != "" {
-			query = query.Range(rangeKey, res[rangeKey])
+// fromDynamoValue converts the DynamoDB attribute value to the value it would have if decoded from JSON.
+// The binary values are converted to base64 strings, the sets to lists.
+func fromDynamoValue(value types.AttributeValue) interface{} {
+	switch v := value.(type) {
+	case *types.AttributeValueMemberS:
+		return v.Value
+	case *types.AttributeValueMemberN:
+		return dynamoNumber(v.Value)
+	case *types.AttributeValueMemberBOOL:
+		return v.Value
+	case *types.AttributeValueMemberB:
+		return base64.StdEncoding.EncodeToString(v.Value)
+	case *types.AttributeValueMemberL:
+		list := make([]interface{}, len(v.Value))
+		for i, item := range v.Value {
+			list[i] = fromDynamoValue(item)
 		}
-
-		for k, v := range *payload {
-			if k != hashKey && k != rangeKey {
-				query = query.Set(k, v)
-			}
+		return list
+	case *types.AttributeValueMemberM:
+		return unmarshalDynamoItem(v.Value)
+	case *types.AttributeValueMemberSS:
+		list := make([]interface{}, len(v.Value))
+		for i, item := range v.Value {
+			list[i] = item
 		}
-
-		var updatedItem map[string]interface{}
-		err = query.Value(&updatedItem)
-		if err != nil {
-			return nil, err
+		return list
+	case *types.AttributeValueMemberNS:
+		list := make([]interface{}, len(v.Value))
+		for i, item := range v.Value {
+			list[i] = dynamoNumber(item)
 		}
-
-		payload = &updatedItem
+		return list
+	case *types.AttributeValueMemberBS:
+		list := make([]interface{}, len(v.Value))
+		for i, item := range v.Value {
+			list[i] = base64.StdEncoding.EncodeToString(item)
+		}
+		return list
 	}
+	return nil
+}
 
-	err = MapToInterface(payload, &result)
+// dynamoNumber converts the DynamoDB number to float64. The numbers that do not fit are returned as strings.
+func dynamoNumber(number string) interface{} {
+	value, err := strconv.ParseFloat(number, 64)
 	if err != nil {
-		return nil, err
+		return number
 	}
-
-	return result, nil
+	return value
 }
 
-// DeleteOne deletes only one item at the time
-// Example filter:
-//	filter := map[string]interface{}{
-// 		"email": "keitaro-user1@keitaro.com",
-// }
-func (c *DynamoCollection) DeleteOne(filter Filter) error {
+// DynamoQuery is a DynamoDB expression with its arguments - "$" is a placeholder for attribute name and "?" is
+// a placeholder for a value.
+// The attribute names must never be written in the expression directly. They are always passed as "$" arguments,
+// so they are sent as expression attribute names and don't collide with the DynamoDB reserved words.
+type DynamoQuery struct {
+	Expression string
+	Args       []interface{}
+}
 
-	hashKey := c.RepositoryDefinition.GetHashKey()
-	rangeKey := c.RepositoryDefinition.GetRangeKey()
+// DynamoStatement is a PartiQL statement with its parameters, the values of the "?" placeholders of the statement:
+//
+//	&DynamoStatement{Statement: `SELECT * FROM "users" WHERE "org" = ? AND "logins" > ?`, Parameters: []interface{}{"a", 10}}
+//
+// The table is named in the statement, so a statement can run on any table of the backend.
+type DynamoStatement struct {
+	Statement  string
+	Parameters []interface{}
+}
 
-	var item interface{}
-	_, err := c.GetOne(filter, &item)
-	if err != nil {
-		return err
+// parameters marshals the parameters of the statement.
+func (s *DynamoStatement) parameters() ([]types.AttributeValue, error) {
+	if len(s.Parameters) == 0 {
+		return nil, nil
+	}
+	parameters := make([]types.AttributeValue, len(s.Parameters))
+	for i, parameter := range s.Parameters {
+		value, err := marshalDynamoValue(parameter)
+		if err != nil {
+			return nil, err
+		}
+		parameters[i] = value
 	}
-	result := item.(map[string]interface{})
+	return parameters, nil
+}
 
-	query := c.Table.Delete(hashKey, result[hashKey])
+// DynamoQueryTranslator translates filters into DynamoDB filter expressions (*DynamoQuery).
+type DynamoQueryTranslator struct{}
 
-	if rangeKey != "" {
-		query = query.Range(rangeKey, result[rangeKey])
+// Translate translates the filter AST into a DynamoDB filter expression.
+func (t *DynamoQueryTranslator) Translate(ast *FilterAST) (interface{}, error) {
+	query := &DynamoQuery{
+		Args: []interface{}{},
 	}
+	conditions := []string{}
 
-	var old map[string]interface{}
-	err = query.OldValue(&old)
-	if err != nil {
-		if err == dynamo.ErrNotFound {
-			return ErrNotFound(err)
+	for _, cond := range ast.Conditions {
+		switch cond.Operator {
+		case OpEq:
+			conditions = append(conditions, "$ = ?")
+			query.Args = append(query.Args, cond.Property, cond.Value)
+		case OpPattern:
+			for _, pc := range patternToDynamodbCondition(cond.Value.(string)) {
+				conditions = append(conditions, pc.expression())
+				query.Args = append(query.Args, cond.Property, pc.value)
+			}
+		case OpNe:
+			// comparisons with a missing attribute are false in DynamoDB
+			conditions = append(conditions, "(attribute_not_exists($) OR $ <> ?)")
+			query.Args = append(query.Args, cond.Property, cond.Property, cond.Value)
+		case OpGt, OpGte, OpLt, OpLte:
+			conditions = append(conditions, fmt.Sprintf("$ %s ?", comparisonOperators[cond.Operator]))
+			query.Args = append(query.Args, cond.Property, cond.Value)
+		case OpExists:
+			if cond.Value.(bool) {
+				conditions = append(conditions, "attribute_exists($)")
+			} else {
+				conditions = append(conditions, "attribute_not_exists($)")
+			}
+			query.Args = append(query.Args, cond.Property)
+		case OpNull:
+			if cond.Value.(bool) {
+				conditions = append(conditions, "attribute_type($, ?)")
+				query.Args = append(query.Args, cond.Property, "NULL")
+			} else {
+				conditions = append(conditions, "(attribute_exists($) AND NOT attribute_type($, ?))")
+				query.Args = append(query.Args, cond.Property, cond.Property, "NULL")
+			}
+		case OpIn, OpNin:
+			values := cond.Value.([]interface{})
+			if len(values) > dynamoMaxInValues {
+				return nil, ErrInvalidInput(fmt.Sprintf("%s on property %s can have at most %d values in DynamoDB", cond.Operator, cond.Property, dynamoMaxInValues))
+			}
+			in := "$ IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ") + ")"
+			if cond.Operator == OpIn {
+				conditions = append(conditions, in)
+				query.Args = append(append(query.Args, cond.Property), values...)
+				continue
+			}
+			conditions = append(conditions, "(attribute_not_exists($) OR NOT "+in+")")
+			query.Args = append(append(query.Args, cond.Property, cond.Property), values...)
+		default:
+			return nil, ErrInvalidInput(fmt.Sprintf("operator %s is not supported by DynamoDB backend", cond.Operator))
 		}
-		return err
 	}
 
-	return nil
+	query.Expression = strings.Join(conditions, " AND ")
+	return query, nil
 }
 
-// DeleteAll deletes batch of items
-// Example filter:
-// filter := map[string]interface{}{
-// 			"email": "keitaro-user1@keitaro.com",
-// 			"id":    "378d9777-6a32-4453-849e-858ff243635b",
-// 		}
-// email is the hash key, id is the range key
-func (c *DynamoCollection) DeleteAll(filter Filter) error {
-	hashKey := c.RepositoryDefinition.GetHashKey()
-	rangeKey := c.RepositoryDefinition.GetRangeKey()
+var dynamoQueryTranslator = &DynamoQueryTranslator{}
 
-	if _, ok := filter[hashKey]; !ok {
-		return ErrInvalidInput("range hash key must be provided")
+// and adds another condition to the query.
+func (q *DynamoQuery) and(expression string, args ...interface{}) {
+	if q.Expression != "" {
+		q.Expression += " AND "
 	}
+	q.Expression += expression
+	q.Args = append(q.Args, args...)
+}
 
-	batchSize := 128
-	offset := 0
+// dynamoExpressions collects the expression attribute names and values of the expressions sent with one request.
+type dynamoExpressions struct {
+	names  map[string]string
+	values map[string]types.AttributeValue
+}
 
-	for {
-		resultsIntf, err := c.GetAll(filter, &map[string]interface{}{}, hashKey, "ascending", batchSize, offset)
-		if err != nil {
-			return err
-		}
-		results := resultsIntf.([]*map[string]interface{})
+// newDynamoExpressions creates new empty dynamoExpressions.
+func newDynamoExpressions() *dynamoExpressions {
+	return &dynamoExpressions{
+		names:  map[string]string{},
+		values: map[string]types.AttributeValue{},
+	}
+}
 
-		if len(results) == 0 {
-			break
-		}
+// add replaces the placeholders of the query with expression attribute names (#n0, #n1...) and values (:v0, :v1...),
+// and returns the expression.
+func (e *dynamoExpressions) add(q *DynamoQuery) (string, error) {
+	expression := ""
+	arg := 0
 
-		for _, result := range results {
-			delFilter := NewFilter().Match(hashKey, (*result)[hashKey])
-			if rangeKey != "" {
-				delFilter = delFilter.Match(rangeKey, (*result)[rangeKey])
+	for _, c := range q.Expression {
+		if c != '$' && c != '?' {
+			expression += string(c)
+			continue
+		}
+		if arg >= len(q.Args) {
+			return "", ErrInvalidInput(fmt.Sprintf("missing argument %d of expression %s", arg, q.Expression))
+		}
+		placeholder := len(e.names) + len(e.values)
+		if c == '$' {
+			name, ok := q.Args[arg].(string)
+			if !ok {
+				return "", ErrInvalidInput(fmt.Sprintf("attribute name must be a string, got %v", q.Args[arg]))
 			}
-			if err = c.DeleteOne(delFilter); err != nil {
-				return err
+			e.names[fmt.Sprintf("#n%d", placeholder)] = name
+			expression += fmt.Sprintf("#n%d", placeholder)
+		} else {
+			value, err := marshalDynamoValue(q.Args[arg])
+			if err != nil {
+				return "", err
 			}
+			e.values[fmt.Sprintf(":v%d", placeholder)] = value
+			expression += fmt.Sprintf(":v%d", placeholder)
 		}
-		offset += len(results)
+		arg++
 	}
 
-	return nil
+	return expression, nil
+}
+
+// attributeNames returns the expression attribute names, nil if there are none (DynamoDB rejects empty maps).
+func (e *dynamoExpressions) attributeNames() map[string]string {
+	if len(e.names) == 0 {
+		return nil
+	}
+	return e.names
+}
+
+// attributeValues returns the expression attribute values, nil if there are none (DynamoDB rejects empty maps).
+func (e *dynamoExpressions) attributeValues() map[string]types.AttributeValue {
+	if len(e.values) == 0 {
+		return nil
+	}
+	return e.values
+}
+
+// scanFilter translates the filter and appends the TTL condition if the expired items are excluded (see ttlGrace).
+func (c *DynamoCollection) scanFilter(filter Filter) (*DynamoQuery, error) {
+	ast, err := ParseFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	return c.filterQuery(ast)
+}
+
+// filterQuery translates the filter AST and appends the TTL condition if the expired items are excluded.
+func (c *DynamoCollection) filterQuery(ast *FilterAST) (*DynamoQuery, error) {
+	translated, err := dynamoQueryTranslator.Translate(ast)
+	if err != nil {
+		return nil, err
+	}
+	query := translated.(*DynamoQuery)
+
+	if grace, ok := ttlGrace(c.RepositoryDefinition); ok {
+		query.and("$ > ?", c.RepositoryDefinition.GetTTLAttribute(), time.Now().Add(-grace))
+	}
+
+	return query, nil
 }
 
 func patternToDynamodbCondition(pattern string) []*patternCondition {
@@ -624,3 +4352,15 @@ func (p *patternCondition) Equals(other *patternCondition) bool {
 
 	return p.condition == other.condition && p.value == other.value
 }
+
+// expression returns the DynamoDB condition expression for this pattern condition.
+func (p *patternCondition) expression() string {
+	switch p.condition {
+	case "EQ":
+		return "$ = ?"
+	case "BEGINS_WITH":
+		return "begins_with($, ?)"
+	default:
+		return "contains($, ?)"
+	}
+}
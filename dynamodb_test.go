@@ -1,7 +1,29 @@
 package backends
 
 import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/applicationautoscaling"
+	autoscalingtypes "github.com/aws/aws-sdk-go-v2/service/applicationautoscaling/types"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	streamstypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
 )
 
 func TestTokenize(t *testing.T) {
@@ -194,3 +216,2702 @@ func TestPatternToDynamoDBCondition(t *testing.T) {
 		t.Fatal("Invalid conditions. Got: ", conds)
 	}
 }
+
+func TestDynamoQueryTranslator(t *testing.T) {
+	translated, err := TranslateFilter(NewFilter().MatchPattern("name", "John%").Match("role", "user"), dynamoQueryTranslator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := translated.(*DynamoQuery)
+
+	if query.Expression != "begins_with($, ?) AND $ = ?" {
+		t.Fatal("Invalid expression. Got: ", query.Expression)
+	}
+	if len(query.Args) != 4 || query.Args[0] != "name" || query.Args[1] != "John" || query.Args[2] != "role" || query.Args[3] != "user" {
+		t.Fatal("Invalid arguments. Got: ", query.Args)
+	}
+
+	query.and("$ > ?", "ttl", 1)
+	if query.Expression != "begins_with($, ?) AND $ = ? AND $ > ?" {
+		t.Fatal("Invalid expression after adding condition. Got: ", query.Expression)
+	}
+}
+
+func TestDynamoQueryTranslatorComparisons(t *testing.T) {
+	translated, err := TranslateFilter(Filter{
+		"age":    map[string]interface{}{OpGte: 18, OpNe: 30},
+		"status": map[string]interface{}{OpIn: []string{"active", "invited"}},
+	}, dynamoQueryTranslator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := translated.(*DynamoQuery)
+
+	if query.Expression != "$ >= ? AND (attribute_not_exists($) OR $ <> ?) AND $ IN (?, ?)" {
+		t.Fatal("Invalid expression. Got: ", query.Expression)
+	}
+	if len(query.Args) != 8 || query.Args[5] != "status" || query.Args[7] != "invited" {
+		t.Fatal("Invalid arguments. Got: ", query.Args)
+	}
+
+	translated, err = TranslateFilter(NewFilter().MatchNotIn("status", []string{"deleted"}), dynamoQueryTranslator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expression := translated.(*DynamoQuery).Expression; expression != "(attribute_not_exists($) OR NOT $ IN (?))" {
+		t.Fatal("Invalid expression of $nin. Got: ", expression)
+	}
+
+	translated, err = TranslateFilter(NewFilter().MatchExists("email", false).MatchNull("phone", false), dynamoQueryTranslator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query = translated.(*DynamoQuery)
+	if query.Expression != "attribute_not_exists($) AND (attribute_exists($) AND NOT attribute_type($, ?))" {
+		t.Fatal("Invalid expression of $exists and $null. Got: ", query.Expression)
+	}
+	if len(query.Args) != 4 || query.Args[3] != "NULL" {
+		t.Fatal("Invalid arguments of $exists and $null. Got: ", query.Args)
+	}
+
+	_, err = TranslateFilter(Filter{"id": map[string]interface{}{OpIn: make([]interface{}, dynamoMaxInValues+1)}}, dynamoQueryTranslator)
+	if err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for too many values of $in. Got: ", err)
+	}
+}
+
+func TestDynamoQueryTranslatorReservedWords(t *testing.T) {
+	translated, err := TranslateFilter(NewFilter().Match("status", "active").MatchPattern("name", "%doe"), dynamoQueryTranslator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := translated.(*DynamoQuery)
+
+	if strings.Contains(query.Expression, "status") || strings.Contains(query.Expression, "name") {
+		t.Fatal("Attribute names must be passed as expression attribute names. Got: ", query.Expression)
+	}
+	if query.Expression != "contains($, ?) AND $ = ?" {
+		t.Fatal("Invalid expression. Got: ", query.Expression)
+	}
+	if query.Args[0] != "name" || query.Args[2] != "status" {
+		t.Fatal("Invalid arguments. Got: ", query.Args)
+	}
+}
+
+// fakeDynamoDB is an in-memory DynamoDB client with "id" as hash key of all tables. The scans and the queries
+// return two items per page and support only the expressions with equality conditions and comparisons.
+type fakeDynamoDB struct {
+	DynamoDBAPI
+	mutex   sync.Mutex
+	tables  []string
+	created []*dynamodb.CreateTableInput
+	items   map[string]map[string]types.AttributeValue
+	batches int
+	// scans is the number of Scan requests
+	scans int
+	// segments are the segments of the parallel scans
+	segments []int32
+	// queries are the Query requests
+	queries []*dynamodb.QueryInput
+	// transactions is the number of TransactWriteItems requests
+	transactions int
+	// statements are the ExecuteStatement requests
+	statements []*dynamodb.ExecuteStatementInput
+	// backups are the tables with point-in-time recovery
+	backups []string
+	// updates are the UpdateTable requests
+	updates []*dynamodb.UpdateTableInput
+	// ttl is the TTL of the tables
+	ttl map[string]*types.TimeToLiveSpecification
+}
+
+func newFakeDynamoDB() *fakeDynamoDB {
+	return &fakeDynamoDB{
+		items: map[string]map[string]types.AttributeValue{},
+		ttl:   map[string]*types.TimeToLiveSpecification{},
+	}
+}
+
+func (f *fakeDynamoDB) ListTables(ctx context.Context, input *dynamodb.ListTablesInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ListTablesOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return &dynamodb.ListTablesOutput{TableNames: f.tables}, nil
+}
+
+func (f *fakeDynamoDB) CreateTable(ctx context.Context, input *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.tables = append(f.tables, aws.ToString(input.TableName))
+	f.created = append(f.created, input)
+	return &dynamodb.CreateTableOutput{TableDescription: &types.TableDescription{TableName: input.TableName}}, nil
+}
+
+func (f *fakeDynamoDB) UpdateContinuousBackups(ctx context.Context, input *dynamodb.UpdateContinuousBackupsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateContinuousBackupsOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if aws.ToBool(input.PointInTimeRecoverySpecification.PointInTimeRecoveryEnabled) {
+		f.backups = append(f.backups, aws.ToString(input.TableName))
+	}
+	return &dynamodb.UpdateContinuousBackupsOutput{}, nil
+}
+
+func (f *fakeDynamoDB) DescribeTable(ctx context.Context, input *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	table := &types.TableDescription{
+		TableName:      input.TableName,
+		TableStatus:    types.TableStatusActive,
+		ItemCount:      aws.Int64(int64(len(f.items))),
+		TableSizeBytes: aws.Int64(int64(100 * len(f.items))),
+	}
+	for _, created := range f.created {
+		if aws.ToString(created.TableName) != aws.ToString(input.TableName) {
+			continue
+		}
+		table.KeySchema = created.KeySchema
+		table.AttributeDefinitions = created.AttributeDefinitions
+		table.ProvisionedThroughput = fakeDynamoThroughput(created.ProvisionedThroughput)
+		for _, index := range created.GlobalSecondaryIndexes {
+			table.GlobalSecondaryIndexes = append(table.GlobalSecondaryIndexes, types.GlobalSecondaryIndexDescription{
+				IndexName:             index.IndexName,
+				KeySchema:             index.KeySchema,
+				Projection:            index.Projection,
+				IndexStatus:           types.IndexStatusActive,
+				ProvisionedThroughput: fakeDynamoThroughput(index.ProvisionedThroughput),
+			})
+		}
+		if created.StreamSpecification != nil {
+			table.StreamSpecification = created.StreamSpecification
+			table.LatestStreamArn = aws.String("stream/" + aws.ToString(input.TableName))
+		}
+	}
+	return &dynamodb.DescribeTableOutput{Table: table}, nil
+}
+
+func fakeDynamoThroughput(throughput *types.ProvisionedThroughput) *types.ProvisionedThroughputDescription {
+	if throughput == nil {
+		return nil
+	}
+	return &types.ProvisionedThroughputDescription{
+		ReadCapacityUnits:  throughput.ReadCapacityUnits,
+		WriteCapacityUnits: throughput.WriteCapacityUnits,
+	}
+}
+
+// UpdateTable changes the capacities and creates the GSIs of the created table.
+func (f *fakeDynamoDB) UpdateTable(ctx context.Context, input *dynamodb.UpdateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTableOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.updates = append(f.updates, input)
+	for _, created := range f.created {
+		if aws.ToString(created.TableName) != aws.ToString(input.TableName) {
+			continue
+		}
+		if input.ProvisionedThroughput != nil {
+			created.ProvisionedThroughput = input.ProvisionedThroughput
+		}
+		if input.AttributeDefinitions != nil {
+			created.AttributeDefinitions = input.AttributeDefinitions
+		}
+		for _, update := range input.GlobalSecondaryIndexUpdates {
+			if update.Create != nil {
+				created.GlobalSecondaryIndexes = append(created.GlobalSecondaryIndexes, types.GlobalSecondaryIndex{
+					IndexName:             update.Create.IndexName,
+					KeySchema:             update.Create.KeySchema,
+					Projection:            update.Create.Projection,
+					ProvisionedThroughput: update.Create.ProvisionedThroughput,
+				})
+			}
+			for i, index := range created.GlobalSecondaryIndexes {
+				if update.Update != nil && aws.ToString(index.IndexName) == aws.ToString(update.Update.IndexName) {
+					created.GlobalSecondaryIndexes[i].ProvisionedThroughput = update.Update.ProvisionedThroughput
+				}
+			}
+		}
+	}
+	return &dynamodb.UpdateTableOutput{}, nil
+}
+
+func (f *fakeDynamoDB) UpdateTimeToLive(ctx context.Context, input *dynamodb.UpdateTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTimeToLiveOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.ttl[aws.ToString(input.TableName)] = input.TimeToLiveSpecification
+	return &dynamodb.UpdateTimeToLiveOutput{TimeToLiveSpecification: input.TimeToLiveSpecification}, nil
+}
+
+func (f *fakeDynamoDB) DescribeTimeToLive(ctx context.Context, input *dynamodb.DescribeTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTimeToLiveOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	description := &types.TimeToLiveDescription{TimeToLiveStatus: types.TimeToLiveStatusDisabled}
+	if ttl, ok := f.ttl[aws.ToString(input.TableName)]; ok && aws.ToBool(ttl.Enabled) {
+		description = &types.TimeToLiveDescription{TimeToLiveStatus: types.TimeToLiveStatusEnabled, AttributeName: ttl.AttributeName}
+	}
+	return &dynamodb.DescribeTimeToLiveOutput{TimeToLiveDescription: description}, nil
+}
+
+func (f *fakeDynamoDB) Scan(ctx context.Context, input *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.scans++
+
+	if input.TotalSegments != nil {
+		f.segments = append(f.segments, aws.ToInt32(input.Segment))
+	}
+	page := f.page(input.ExclusiveStartKey, input.Segment, input.TotalSegments, nil, input.FilterExpression, input.ProjectionExpression, input.Select, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	return &dynamodb.ScanOutput{
+		Items:            page.Items,
+		Count:            page.Count,
+		ScannedCount:     page.ScannedCount,
+		LastEvaluatedKey: page.LastEvaluatedKey,
+	}, nil
+}
+
+// Query reads the items that match the key condition, of the table or of any index.
+func (f *fakeDynamoDB) Query(ctx context.Context, input *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.queries = append(f.queries, input)
+
+	return f.page(input.ExclusiveStartKey, nil, nil, input.KeyConditionExpression, input.FilterExpression, input.ProjectionExpression, input.Select, input.ExpressionAttributeNames, input.ExpressionAttributeValues), nil
+}
+
+// page reads the two items of the segment after the start key that match the key condition, and returns the ones
+// that match the filter. The items are split into the segments by their position.
+func (f *fakeDynamoDB) page(start map[string]types.AttributeValue, segment *int32, totalSegments *int32, key *string, filter *string, projection *string, selection types.Select, names map[string]string, values map[string]types.AttributeValue) *dynamodb.QueryOutput {
+	ids := []string{}
+	for id, item := range f.items {
+		if f.matches(item, key, names, values) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	if totalSegments != nil {
+		segmentIDs := []string{}
+		for i, id := range ids {
+			if int32(i)%aws.ToInt32(totalSegments) == aws.ToInt32(segment) {
+				segmentIDs = append(segmentIDs, id)
+			}
+		}
+		ids = segmentIDs
+	}
+
+	first := 0
+	if start != nil {
+		last := fromDynamoValue(start["id"]).(string)
+		first = sort.SearchStrings(ids, last) + 1
+	}
+
+	output := &dynamodb.QueryOutput{}
+	for i := first; i < len(ids) && i < first+2; i++ {
+		item := f.items[ids[i]]
+		output.ScannedCount++
+		if f.matches(item, filter, names, values) {
+			if selection == types.SelectCount {
+				output.Count++
+			} else if projection != nil {
+				projected := map[string]types.AttributeValue{}
+				for _, name := range strings.Split(aws.ToString(projection), ", ") {
+					attribute := names[name]
+					if value, ok := item[attribute]; ok {
+						projected[attribute] = value
+					}
+				}
+				output.Items = append(output.Items, projected)
+			} else {
+				output.Items = append(output.Items, item)
+			}
+		}
+		output.LastEvaluatedKey = map[string]types.AttributeValue{"id": item["id"]}
+	}
+	if first+2 >= len(ids) {
+		output.LastEvaluatedKey = nil
+	}
+	return output
+}
+
+func (f *fakeDynamoDB) matches(item map[string]types.AttributeValue, expression *string, names map[string]string, values map[string]types.AttributeValue) bool {
+	if expression == nil {
+		return true
+	}
+	for _, condition := range strings.Split(aws.ToString(expression), " AND ") {
+		parts := strings.Split(condition, " ")
+		if len(parts) != 3 {
+			continue
+		}
+		name := names[parts[0]]
+		value := fromDynamoValue(item[name])
+		expected := fromDynamoValue(values[parts[2]])
+		if parts[1] == "=" {
+			if !reflect.DeepEqual(value, expected) {
+				return false
+			}
+			continue
+		}
+		// DynamoDB compares the strings by their bytes
+		cmp, ok := compareValues(value, expected)
+		if a, isString := value.(string); isString {
+			b, _ := expected.(string)
+			cmp, ok = strings.Compare(a, b), isString
+		}
+		if !ok || !map[string]bool{">": cmp > 0, ">=": cmp >= 0, "<": cmp < 0, "<=": cmp <= 0}[parts[1]] {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *fakeDynamoDB) PutItem(ctx context.Context, input *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	id := fromDynamoValue(input.Item["id"]).(string)
+	record := map[string]interface{}{}
+	if item, ok := f.items[id]; ok {
+		record = unmarshalDynamoItem(item)
+	}
+	if !fakeDynamoCondition(record, &dynamodb.UpdateItemInput{
+		ConditionExpression:       input.ConditionExpression,
+		ExpressionAttributeNames:  input.ExpressionAttributeNames,
+		ExpressionAttributeValues: input.ExpressionAttributeValues,
+	}) {
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+	f.items[id] = input.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeDynamoDB) UpdateItem(ctx context.Context, input *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.update(input)
+}
+
+// update applies the update expression of the input on the item.
+func (f *fakeDynamoDB) update(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+	id := fromDynamoValue(input.Key["id"]).(string)
+	item, ok := f.items[id]
+	if !ok {
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+	record := unmarshalDynamoItem(item)
+	if !fakeDynamoCondition(record, input) {
+		if input.ReturnValuesOnConditionCheckFailure == types.ReturnValuesOnConditionCheckFailureAllOld {
+			return nil, &types.ConditionalCheckFailedException{Item: item}
+		}
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+	names := input.ExpressionAttributeNames
+	expression := aws.ToString(input.UpdateExpression)
+	remove := ""
+	if index := strings.Index(expression, "REMOVE "); index >= 0 {
+		remove = strings.TrimPrefix(expression[index:], "REMOVE ")
+		expression = strings.TrimSpace(expression[:index])
+	}
+	// the attributes that are set as they are keep their attribute values (the numbers their precision, the sets
+	// their type), like the attributes that are not updated.
+	raw := map[string]types.AttributeValue{}
+	for name, value := range item {
+		raw[name] = value
+	}
+	if expression != "" {
+		for _, assignment := range fakeDynamoAssignments(strings.TrimPrefix(expression, "SET ")) {
+			parts := strings.SplitN(assignment, " = ", 2)
+			path := fakeDynamoPath(parts[0], names)
+			delete(raw, path[0].(string))
+			if attribute, ok := input.ExpressionAttributeValues[parts[1]]; ok && len(path) == 1 {
+				raw[path[0].(string)] = attribute
+			}
+			value := fromDynamoValue(input.ExpressionAttributeValues[parts[1]])
+			if strings.HasPrefix(parts[1], "list_append(") {
+				operands := strings.Split(strings.TrimSuffix(strings.TrimPrefix(parts[1], "list_append("), ")"), ", ")
+				list, _ := fakeDynamoGet(record, fakeDynamoPath(operands[0], names))
+				values, _ := list.([]interface{})
+				value = append(values, fromDynamoValue(input.ExpressionAttributeValues[operands[1]]).([]interface{})...)
+			}
+			fakeDynamoUpdate(record, fakeDynamoPath(parts[0], names), value, false)
+		}
+	}
+	if remove != "" {
+		for _, path := range strings.Split(remove, ", ") {
+			segments := fakeDynamoPath(path, names)
+			delete(raw, segments[0].(string))
+			fakeDynamoUpdate(record, segments, nil, true)
+		}
+	}
+	updated, err := marshalDynamoItem(record)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range raw {
+		updated[name] = value
+	}
+	f.items[id] = updated
+	return &dynamodb.UpdateItemOutput{Attributes: updated}, nil
+}
+
+// fakeDynamoAssignments splits the assignments of a SET expression.
+func fakeDynamoAssignments(expression string) []string {
+	assignments := []string{}
+	depth := 0
+	start := 0
+	for i, c := range expression {
+		switch {
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			assignments = append(assignments, expression[start:i])
+			start = i + 2
+		}
+	}
+	return append(assignments, expression[start:])
+}
+
+// fakeDynamoCondition evaluates the condition expressions used by the collection.
+func fakeDynamoCondition(record map[string]interface{}, input *dynamodb.UpdateItemInput) bool {
+	for _, condition := range strings.Split(aws.ToString(input.ConditionExpression), " AND ") {
+		if !fakeDynamoConditionTerm(record, condition, input) {
+			return false
+		}
+	}
+	return true
+}
+
+// fakeDynamoConditionTerm evaluates a single condition (function or equality).
+func fakeDynamoConditionTerm(record map[string]interface{}, condition string, input *dynamodb.UpdateItemInput) bool {
+	names := input.ExpressionAttributeNames
+	switch {
+	case condition == "":
+		return true
+	case strings.HasPrefix(condition, "attribute_exists("):
+		_, ok := fakeDynamoGet(record, fakeDynamoPath(strings.TrimSuffix(strings.TrimPrefix(condition, "attribute_exists("), ")"), names))
+		return ok
+	case strings.HasPrefix(condition, "attribute_not_exists("):
+		_, ok := fakeDynamoGet(record, fakeDynamoPath(strings.TrimSuffix(strings.TrimPrefix(condition, "attribute_not_exists("), ")"), names))
+		return !ok
+	}
+	parts := strings.SplitN(condition, " = ", 2)
+	expected := fromDynamoValue(input.ExpressionAttributeValues[parts[1]])
+	if strings.HasPrefix(parts[0], "size(") {
+		list, _ := fakeDynamoGet(record, fakeDynamoPath(strings.TrimSuffix(strings.TrimPrefix(parts[0], "size("), ")"), names))
+		values, _ := list.([]interface{})
+		return fmt.Sprint(len(values)) == fmt.Sprint(expected)
+	}
+	value, _ := fakeDynamoGet(record, fakeDynamoPath(parts[0], names))
+	return fmt.Sprint(value) == fmt.Sprint(expected)
+}
+
+// fakeDynamoPath resolves the document path (#n0[2].#n1) to its segments: the attribute names and the list indexes.
+func fakeDynamoPath(path string, names map[string]string) []interface{} {
+	segments := []interface{}{}
+	for _, part := range strings.Split(path, ".") {
+		name := part
+		indexes := ""
+		if i := strings.Index(part, "["); i >= 0 {
+			name, indexes = part[:i], part[i:]
+		}
+		segments = append(segments, names[name])
+		for _, index := range strings.Split(strings.Trim(indexes, "[]"), "][") {
+			if index != "" {
+				n, _ := strconv.Atoi(index)
+				segments = append(segments, n)
+			}
+		}
+	}
+	return segments
+}
+
+func fakeDynamoGet(value interface{}, path []interface{}) (interface{}, bool) {
+	for _, segment := range path {
+		switch s := segment.(type) {
+		case string:
+			record, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if value, ok = record[s]; !ok {
+				return nil, false
+			}
+		case int:
+			list, ok := value.([]interface{})
+			if !ok || s >= len(list) {
+				return nil, false
+			}
+			value = list[s]
+		}
+	}
+	return value, true
+}
+
+// fakeDynamoUpdate sets or removes the value at the path.
+func fakeDynamoUpdate(record map[string]interface{}, path []interface{}, value interface{}, remove bool) {
+	container, ok := fakeDynamoGet(record, path[:len(path)-1])
+	if !ok {
+		return
+	}
+	switch s := path[len(path)-1].(type) {
+	case string:
+		if remove {
+			delete(container.(map[string]interface{}), s)
+			return
+		}
+		container.(map[string]interface{})[s] = value
+	case int:
+		list := container.([]interface{})
+		if remove {
+			fakeDynamoUpdate(record, path[:len(path)-1], append(list[:s:s], list[s+1:]...), false)
+			return
+		}
+		list[s] = value
+	}
+}
+
+func (f *fakeDynamoDB) DeleteItem(ctx context.Context, input *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	id := fromDynamoValue(input.Key["id"]).(string)
+	old := f.items[id]
+	if input.ConditionExpression != nil && !f.check(input.Key, input.ConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues) {
+		if old != nil && input.ReturnValuesOnConditionCheckFailure == types.ReturnValuesOnConditionCheckFailureAllOld {
+			return nil, &types.ConditionalCheckFailedException{Item: old}
+		}
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+	delete(f.items, id)
+	return &dynamodb.DeleteItemOutput{Attributes: old}, nil
+}
+
+func (f *fakeDynamoDB) TransactWriteItems(ctx context.Context, input *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.transactions++
+
+	// the conditions of all items are checked before any item is written
+	reasons := []types.CancellationReason{}
+	canceled := false
+	for _, item := range input.TransactItems {
+		ok := true
+		switch {
+		case item.Put != nil:
+			_, exists := f.items[fromDynamoValue(item.Put.Item["id"]).(string)]
+			ok = !exists
+		case item.Update != nil:
+			ok = f.check(item.Update.Key, item.Update.ConditionExpression, item.Update.ExpressionAttributeNames, item.Update.ExpressionAttributeValues)
+		case item.Delete != nil:
+			ok = f.check(item.Delete.Key, item.Delete.ConditionExpression, item.Delete.ExpressionAttributeNames, item.Delete.ExpressionAttributeValues)
+		case item.ConditionCheck != nil:
+			ok = f.check(item.ConditionCheck.Key, item.ConditionCheck.ConditionExpression, item.ConditionCheck.ExpressionAttributeNames, item.ConditionCheck.ExpressionAttributeValues)
+		}
+		code := "None"
+		if !ok {
+			code = "ConditionalCheckFailed"
+			canceled = true
+		}
+		reasons = append(reasons, types.CancellationReason{Code: aws.String(code)})
+	}
+	if canceled {
+		return nil, &types.TransactionCanceledException{CancellationReasons: reasons}
+	}
+
+	for _, item := range input.TransactItems {
+		switch {
+		case item.Put != nil:
+			f.items[fromDynamoValue(item.Put.Item["id"]).(string)] = item.Put.Item
+		case item.Update != nil:
+			if _, err := f.update(&dynamodb.UpdateItemInput{
+				Key:                       item.Update.Key,
+				UpdateExpression:          item.Update.UpdateExpression,
+				ExpressionAttributeNames:  item.Update.ExpressionAttributeNames,
+				ExpressionAttributeValues: item.Update.ExpressionAttributeValues,
+			}); err != nil {
+				return nil, err
+			}
+		case item.Delete != nil:
+			delete(f.items, fromDynamoValue(item.Delete.Key["id"]).(string))
+		}
+	}
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+// check evaluates the condition on the item with the key.
+func (f *fakeDynamoDB) check(key map[string]types.AttributeValue, condition *string, names map[string]string, values map[string]types.AttributeValue) bool {
+	item, ok := f.items[fromDynamoValue(key["id"]).(string)]
+	if !ok {
+		return false
+	}
+	return fakeDynamoCondition(unmarshalDynamoItem(item), &dynamodb.UpdateItemInput{
+		ConditionExpression:       condition,
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	})
+}
+
+func (f *fakeDynamoDB) BatchGetItem(ctx context.Context, input *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.batches++
+	output := &dynamodb.BatchGetItemOutput{
+		Responses:       map[string][]map[string]types.AttributeValue{},
+		UnprocessedKeys: map[string]types.KeysAndAttributes{},
+	}
+	for table, request := range input.RequestItems {
+		if len(request.Keys) > 100 {
+			return nil, fmt.Errorf("too many keys in the batch: %d", len(request.Keys))
+		}
+		for i, key := range request.Keys {
+			// the last key of every first attempt is left unprocessed, as DynamoDB does when throttled
+			if i == len(request.Keys)-1 && f.batches%2 == 1 {
+				output.UnprocessedKeys[table] = types.KeysAndAttributes{Keys: []map[string]types.AttributeValue{key}}
+				continue
+			}
+			if item, ok := f.items[fromDynamoValue(key["id"]).(string)]; ok {
+				output.Responses[table] = append(output.Responses[table], item)
+			}
+		}
+	}
+	return output, nil
+}
+
+func (f *fakeDynamoDB) BatchWriteItem(ctx context.Context, input *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.batches++
+	unprocessed := map[string][]types.WriteRequest{}
+	for table, requests := range input.RequestItems {
+		if len(requests) > 25 {
+			return nil, fmt.Errorf("too many items in the batch: %d", len(requests))
+		}
+		for i, request := range requests {
+			// the last item of every first attempt is left unprocessed, as DynamoDB does when throttled
+			if i == len(requests)-1 && f.batches%2 == 1 {
+				unprocessed[table] = append(unprocessed[table], request)
+				continue
+			}
+			if request.DeleteRequest != nil {
+				delete(f.items, fromDynamoValue(request.DeleteRequest.Key["id"]).(string))
+				continue
+			}
+			f.items[fromDynamoValue(request.PutRequest.Item["id"]).(string)] = request.PutRequest.Item
+		}
+	}
+	return &dynamodb.BatchWriteItemOutput{UnprocessedItems: unprocessed}, nil
+}
+
+type fakeDynamoAutoScaling struct {
+	targets  []*applicationautoscaling.RegisterScalableTargetInput
+	policies []*applicationautoscaling.PutScalingPolicyInput
+}
+
+func (f *fakeDynamoAutoScaling) RegisterScalableTarget(ctx context.Context, input *applicationautoscaling.RegisterScalableTargetInput, optFns ...func(*applicationautoscaling.Options)) (*applicationautoscaling.RegisterScalableTargetOutput, error) {
+	f.targets = append(f.targets, input)
+	return &applicationautoscaling.RegisterScalableTargetOutput{}, nil
+}
+
+func (f *fakeDynamoAutoScaling) PutScalingPolicy(ctx context.Context, input *applicationautoscaling.PutScalingPolicyInput, optFns ...func(*applicationautoscaling.Options)) (*applicationautoscaling.PutScalingPolicyOutput, error) {
+	f.policies = append(f.policies, input)
+	return &applicationautoscaling.PutScalingPolicyOutput{}, nil
+}
+
+type fakeDynamoStreams struct {
+	mutex  sync.Mutex
+	shards []streamstypes.Shard
+	// records are the records of the shards, returned by the first GetRecords of the shard
+	records map[string][]streamstypes.Record
+	// children are the shards created when the shard is read to its end
+	children  map[string]streamstypes.Shard
+	iterators []*dynamodbstreams.GetShardIteratorInput
+}
+
+func (f *fakeDynamoStreams) DescribeStream(ctx context.Context, input *dynamodbstreams.DescribeStreamInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.DescribeStreamOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	// one shard per page
+	shards := f.shards
+	if input.ExclusiveStartShardId != nil {
+		for i, shard := range f.shards {
+			if aws.ToString(shard.ShardId) == aws.ToString(input.ExclusiveStartShardId) {
+				shards = f.shards[i+1:]
+			}
+		}
+	}
+	description := &streamstypes.StreamDescription{StreamArn: input.StreamArn}
+	if len(shards) > 0 {
+		description.Shards = shards[:1]
+		if len(shards) > 1 {
+			description.LastEvaluatedShardId = shards[0].ShardId
+		}
+	}
+	return &dynamodbstreams.DescribeStreamOutput{StreamDescription: description}, nil
+}
+
+func (f *fakeDynamoStreams) GetShardIterator(ctx context.Context, input *dynamodbstreams.GetShardIteratorInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetShardIteratorOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.iterators = append(f.iterators, input)
+	return &dynamodbstreams.GetShardIteratorOutput{ShardIterator: input.ShardId}, nil
+}
+
+func (f *fakeDynamoStreams) GetRecords(ctx context.Context, input *dynamodbstreams.GetRecordsInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetRecordsOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	shardID := aws.ToString(input.ShardIterator)
+	output := &dynamodbstreams.GetRecordsOutput{Records: f.records[shardID], NextShardIterator: input.ShardIterator}
+	delete(f.records, shardID)
+	if child, ok := f.children[shardID]; ok {
+		f.shards = append(f.shards, child)
+		delete(f.children, shardID)
+		output.NextShardIterator = nil
+	}
+	return output, nil
+}
+
+func fakeDynamoStreamRecord(name streamstypes.OperationType, id string, image map[string]streamstypes.AttributeValue) streamstypes.Record {
+	record := streamstypes.Record{
+		EventName: name,
+		Dynamodb: &streamstypes.StreamRecord{
+			Keys: map[string]streamstypes.AttributeValue{"id": &streamstypes.AttributeValueMemberS{Value: id}},
+		},
+	}
+	if name == streamstypes.OperationTypeRemove {
+		record.Dynamodb.OldImage = image
+	} else {
+		record.Dynamodb.NewImage = image
+	}
+	return record
+}
+
+// ExecuteStatement rejects the INSERT statements as duplicates, and returns all items, 2 per page, for the others.
+func (f *fakeDynamoDB) ExecuteStatement(ctx context.Context, input *dynamodb.ExecuteStatementInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ExecuteStatementOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.statements = append(f.statements, input)
+	if strings.HasPrefix(aws.ToString(input.Statement), "INSERT") {
+		return nil, &types.DuplicateItemException{Message: aws.String("duplicate")}
+	}
+	ids := []string{}
+	for id := range f.items {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	start, _ := strconv.Atoi(aws.ToString(input.NextToken))
+	output := &dynamodb.ExecuteStatementOutput{}
+	for i := start; i < len(ids) && i < start+2; i++ {
+		output.Items = append(output.Items, f.items[ids[i]])
+	}
+	if start+2 < len(ids) {
+		output.NextToken = aws.String(strconv.Itoa(start + 2))
+	}
+	return output, nil
+}
+
+// BatchExecuteStatement returns the item of the id of the first parameter of each statement, or a failed condition.
+func (f *fakeDynamoDB) BatchExecuteStatement(ctx context.Context, input *dynamodb.BatchExecuteStatementInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchExecuteStatementOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	output := &dynamodb.BatchExecuteStatementOutput{}
+	for _, statement := range input.Statements {
+		id := statement.Parameters[0].(*types.AttributeValueMemberS).Value
+		if item, ok := f.items[id]; ok {
+			output.Responses = append(output.Responses, types.BatchStatementResponse{Item: item})
+		} else {
+			output.Responses = append(output.Responses, types.BatchStatementResponse{Error: &types.BatchStatementError{
+				Code:    types.BatchStatementErrorCodeEnumConditionalCheckFailed,
+				Message: aws.String("condition failed"),
+			}})
+		}
+	}
+	return output, nil
+}
+
+type fakeDynamoDAX struct {
+	client  *fakeDynamoDB
+	queries int
+	batches int
+}
+
+func (f *fakeDynamoDAX) Query(ctx context.Context, input *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	f.queries++
+	return f.client.Query(ctx, input, optFns...)
+}
+
+func (f *fakeDynamoDAX) BatchGetItem(ctx context.Context, input *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	f.batches++
+	return f.client.BatchGetItem(ctx, input, optFns...)
+}
+
+func newFakeDynamoCollection(t *testing.T, client *fakeDynamoDB) Repository {
+	ctx := context.WithValue(context.Background(), DYNAMO_CTX_KEY, client)
+	backend := NewRepositoriesBackend(ctx, &config.DBInfo{DatabaseName: "test"}, DynamoDBRepoBuilder, func() {})
+	repo, err := backend.DefineRepository("users", RepositoryDefinitionMap{
+		"name":          "users",
+		"hashKey":       "id",
+		"readCapacity":  5,
+		"writeCapacity": 5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func TestDynamoDBRepoBuilder(t *testing.T) {
+	client := newFakeDynamoDB()
+	newFakeDynamoCollection(t, client)
+
+	if len(client.created) != 1 {
+		t.Fatal("Expected the table to be created")
+	}
+	input := client.created[0]
+	if aws.ToString(input.TableName) != "users" || aws.ToString(input.KeySchema[0].AttributeName) != "id" || input.KeySchema[0].KeyType != types.KeyTypeHash {
+		t.Fatal("Invalid table definition. Got: ", input)
+	}
+	if input.AttributeDefinitions[0].AttributeType != types.ScalarAttributeTypeS {
+		t.Fatal("Expected string hash key. Got: ", input.AttributeDefinitions[0].AttributeType)
+	}
+
+	// the existing tables are not created again
+	newFakeDynamoCollection(t, client)
+	if len(client.created) != 1 {
+		t.Fatal("Expected the existing table not to be created again")
+	}
+}
+
+func TestDynamoCollection(t *testing.T) {
+	client := newFakeDynamoDB()
+	repo := newFakeDynamoCollection(t, client)
+
+	for _, name := range []string{"alice", "bob", "carol", "dave", "eve"} {
+		_, err := repo.Save(&map[string]interface{}{
+			"id":     name,
+			"status": "active",
+			"age":    30,
+			"tags":   []string{"a", "b"},
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := repo.Save(&map[string]interface{}{"id": "alice"}, nil); err == nil || !IsErrAlreadyExists(err) {
+		t.Fatal("Expected already exists error. Got: ", err)
+	}
+
+	result, err := repo.GetOne(NewFilter().Match("id", "carol"), &map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := *result.(*map[string]interface{})
+	if record["age"] != float64(30) || !reflect.DeepEqual(record["tags"], []interface{}{"a", "b"}) {
+		t.Fatal("Invalid record. Got: ", record)
+	}
+
+	results, err := repo.GetAll(nil, &map[string]interface{}{}, "", "", 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := results.([]*map[string]interface{})
+	if len(page) != 2 || (*page[0])["id"] != "bob" || (*page[1])["id"] != "carol" {
+		t.Fatal("Expected bob and carol on the page. Got: ", page)
+	}
+
+	updated, err := repo.Save(&map[string]interface{}{"status": "inactive"}, NewFilter().Match("id", "dave"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.(map[string]interface{})["status"] != "inactive" || updated.(map[string]interface{})["age"] != float64(30) {
+		t.Fatal("Invalid updated record. Got: ", updated)
+	}
+
+	results, err = repo.GetAll(NewFilter().Match("status", "active"), &map[string]interface{}{}, "", "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.([]*map[string]interface{})) != 4 {
+		t.Fatal("Expected 4 active records. Got: ", len(results.([]*map[string]interface{})))
+	}
+	if count, err := repo.Count(NewFilter().Match("status", "active")); err != nil || count != 4 {
+		t.Fatal("Expected to count 4 active records. Got: ", count, err)
+	}
+	if exists, err := repo.Exists(NewFilter().Match("status", "inactive")); err != nil || !exists {
+		t.Fatal("Expected an inactive record. Got: ", exists, err)
+	}
+	if exists, err := repo.Exists(NewFilter().Match("id", "frank")); err != nil || exists {
+		t.Fatal("Expected frank not to exist. Got: ", exists, err)
+	}
+
+	if count, err := repo.UpdateAll(NewFilter().Match("status", "active"), &map[string]interface{}{"age": 31, "id": "x"}); err != nil || count != 4 {
+		t.Fatal("Expected 4 updated records. Got: ", count, err)
+	}
+	if count, err := repo.Count(NewFilter().Match("age", 31)); err != nil || count != 4 {
+		t.Fatal("Expected to count 4 updated records. Got: ", count, err)
+	}
+
+	results, err = GetPage(repo, NewFilter().Match("status", "active"), &map[string]interface{}{}, "", "", WithFields("id", "age"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	projected := results.([]*map[string]interface{})
+	if len(projected) != 4 || len(*projected[0]) != 2 || (*projected[0])["age"] != float64(31) {
+		t.Fatal("Expected the id and age of the active records. Got: ", projected)
+	}
+
+	if err := repo.DeleteOne(NewFilter().Match("id", "eve")); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.DeleteOne(NewFilter().Match("id", "eve")); err == nil || !IsErrNotFound(err) {
+		t.Fatal("Expected not found error. Got: ", err)
+	}
+
+	if err := repo.DeleteAll(NewFilter().Match("id", "alice")); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.items) != 3 {
+		t.Fatal("Expected 3 records left. Got: ", len(client.items))
+	}
+
+	stats, err := GetStats(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Records != 3 || stats.SizeBytes != 300 {
+		t.Fatal("Invalid stats. Got: ", stats)
+	}
+}
+
+func TestDynamoSaveAll(t *testing.T) {
+	client := newFakeDynamoDB()
+	repo := newFakeDynamoCollection(t, client)
+
+	users := []map[string]interface{}{}
+	for i := 0; i < 30; i++ {
+		users = append(users, map[string]interface{}{"id": fmt.Sprintf("user-%d", i), "age": i})
+	}
+	users = append(users, map[string]interface{}{"name": "anonymous"})
+
+	saved, err := repo.SaveAll(users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list := saved.([]interface{}); len(list) != 31 || list[30].(map[string]interface{})["id"] == nil {
+		t.Fatal("Expected 31 created records with ids. Got: ", list)
+	}
+	if len(client.items) != 31 {
+		t.Fatal("Expected the unprocessed items to be written. Got: ", len(client.items))
+	}
+	if client.batches != 4 {
+		t.Fatal("Expected 2 batches and 2 retries. Got: ", client.batches)
+	}
+
+	_, err = repo.SaveAll([]map[string]interface{}{{"id": "x"}, {"id": "x"}})
+	if err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input error for the duplicate key. Got: ", err)
+	}
+}
+
+func TestDynamoDeleteAll(t *testing.T) {
+	client := newFakeDynamoDB()
+	repo := newFakeDynamoCollection(t, client)
+	records := []map[string]interface{}{}
+	for i := 0; i < 30; i++ {
+		records = append(records, map[string]interface{}{"id": fmt.Sprintf("%02d", i)})
+	}
+	if _, err := repo.SaveAll(records); err != nil {
+		t.Fatal(err)
+	}
+
+	batches := client.batches
+	if err := repo.DeleteAll(NewFilter().MatchLt("id", "27")); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.items) != 3 {
+		t.Fatal("Expected 3 items left. Got: ", len(client.items))
+	}
+	// 2 batches, and the retries of the unprocessed deletes
+	if client.batches-batches < 2 || client.batches-batches > 4 {
+		t.Fatal("Expected the items to be deleted in batches. Got batches: ", client.batches-batches)
+	}
+
+	if err := repo.DeleteAll(NewFilter().Match("role", "user")); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input error without the hash key. Got: ", err)
+	}
+}
+
+func TestDynamoRawQuery(t *testing.T) {
+	client := newFakeDynamoDB()
+	repo := newFakeDynamoCollection(t, client)
+
+	if _, err := repo.SaveAll([]map[string]interface{}{{"id": "alice", "org": "a"}, {"id": "bob", "org": "b"}, {"id": "carol", "org": "a"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := repo.(RawQuerier).RawQuery(&DynamoQuery{Expression: "$ = ?", Args: []interface{}{"org", "a"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := *results.(*[]*map[string]interface{})
+	if len(users) != 2 || (*users[0])["id"] != "alice" || (*users[1])["id"] != "carol" {
+		t.Fatal("Expected the users of org a. Got: ", users)
+	}
+
+	if _, err := repo.(RawQuerier).RawQuery("org = a", nil); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input error for a query of another type. Got: ", err)
+	}
+}
+
+func TestDynamoStatements(t *testing.T) {
+	client := newFakeDynamoDB()
+	repo := newFakeDynamoCollection(t, client)
+
+	if _, err := repo.SaveAll([]map[string]interface{}{{"id": "alice", "logins": 3}, {"id": "bob"}, {"id": "carol"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// all pages of the statement are read
+	results, err := repo.(RawQuerier).RawQuery(&DynamoStatement{Statement: `SELECT * FROM "users" WHERE "logins" >= ?`, Parameters: []interface{}{0}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := *results.(*[]*map[string]interface{})
+	if len(users) != 3 || (*users[0])["logins"] != float64(3) || (*users[2])["id"] != "carol" {
+		t.Fatal("Expected all users. Got: ", users)
+	}
+	if len(client.statements) != 2 || aws.ToString(client.statements[1].NextToken) != "2" {
+		t.Fatal("Expected the statement to be run for 2 pages. Got: ", client.statements)
+	}
+	if parameter, ok := client.statements[0].Parameters[0].(*types.AttributeValueMemberN); !ok || parameter.Value != "0" {
+		t.Fatal("Expected a number parameter. Got: ", client.statements[0].Parameters)
+	}
+
+	if _, err := repo.(RawQuerier).RawQuery(&DynamoStatement{Statement: `INSERT INTO "users" VALUE {'id': ?}`, Parameters: []interface{}{"alice"}}, nil); !IsErrAlreadyExists(err) {
+		t.Fatal("Expected ErrAlreadyExists. Got: ", err)
+	}
+
+	batch, err := repo.(*DynamoCollection).ExecuteBatch([]*DynamoStatement{
+		{Statement: `SELECT * FROM "users" WHERE "id" = ?`, Parameters: []interface{}{"bob"}},
+		{Statement: `SELECT * FROM "users" WHERE "id" = ?`, Parameters: []interface{}{"dave"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batch) != 2 || batch[0].Err != nil || batch[0].Item["id"] != "bob" || batch[1].Err == nil || !IsErrConflict(batch[1].Err) {
+		t.Fatal("Expected bob and a failed condition. Got: ", batch)
+	}
+
+	statements := make([]*DynamoStatement, 26)
+	if _, err := repo.(*DynamoCollection).ExecuteBatch(statements); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input error for too many statements. Got: ", err)
+	}
+}
+
+func TestDynamoPatch(t *testing.T) {
+	client := newFakeDynamoDB()
+	repo := newFakeDynamoCollection(t, client)
+	if _, ok := repo.(PatchRepository); !ok {
+		t.Fatal("Expected the fields to be removed natively")
+	}
+
+	if _, err := repo.Save(&map[string]interface{}{
+		"id":      "john",
+		"status":  "pending",
+		"code":    "1234",
+		"address": map[string]interface{}{"city": "Skopje", "zip": "1000"},
+	}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Patch(repo, NewFilter().Match("id", "john"), &map[string]interface{}{"status": "verified"}, []string{"code", "address.zip"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	patched := result.(map[string]interface{})
+	if _, ok := patched["code"]; ok || patched["status"] != "verified" {
+		t.Fatal("Expected the status to be set and the code removed. Got: ", patched)
+	}
+	address := patched["address"].(map[string]interface{})
+	if _, ok := address["zip"]; ok || address["city"] != "Skopje" {
+		t.Fatal("Expected only the zip to be removed from the address. Got: ", address)
+	}
+
+	if _, err := Patch(repo, NewFilter().Match("id", "jane"), nil, []string{"status"}); err == nil || !IsErrNotFound(err) {
+		t.Fatal("Expected not found error. Got: ", err)
+	}
+}
+
+func TestDynamoTransact(t *testing.T) {
+	client := newFakeDynamoDB()
+	backend := NewDynamoBackend(&config.DBInfo{DatabaseName: "test"}, client)
+	var txBackend TransactionalBackend = backend
+
+	users, err := backend.DefineRepository("users", RepositoryDefinitionMap{"name": "users", "hashKey": "id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.DefineRepository("tokens", RepositoryDefinitionMap{"name": "tokens", "hashKey": "id"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := users.Save(&map[string]interface{}{"id": "john", "status": "pending"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	attempts := 0
+	err = txBackend.Transact(context.Background(), func(tx Transaction) error {
+		attempts++
+		txUsers, err := tx.GetRepository("users")
+		if err != nil {
+			return err
+		}
+		txTokens, err := tx.GetRepository("tokens")
+		if err != nil {
+			return err
+		}
+		if _, err := txUsers.Save(&map[string]interface{}{"status": "active"}, NewFilter().Match("id", "john").Match("status", "pending")); err != nil {
+			return err
+		}
+		if _, err := txTokens.Save(&map[string]interface{}{"id": "token-1", "user": "john"}, nil); err != nil {
+			return err
+		}
+		if attempts == 1 {
+			// modified concurrently, after it was read by the transaction
+			if _, err := users.Save(&map[string]interface{}{"status": "blocked"}, NewFilter().Match("id", "john")); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil || !IsErrNotFound(err) {
+		t.Fatal("Expected the retried transaction to find no pending user. Got: ", err)
+	}
+	if attempts != 2 || client.transactions != 1 {
+		t.Fatal("Expected the transaction to be retried once. Got attempts and requests: ", attempts, client.transactions)
+	}
+	if exists, _ := users.Exists(NewFilter().Match("id", "token-1")); exists {
+		t.Fatal("Expected nothing to be written by the failed transaction")
+	}
+
+	if _, err := users.Save(&map[string]interface{}{"status": "pending"}, NewFilter().Match("id", "john")); err != nil {
+		t.Fatal(err)
+	}
+	err = txBackend.Transact(context.Background(), func(tx Transaction) error {
+		txUsers, err := tx.GetRepository("users")
+		if err != nil {
+			return err
+		}
+		txTokens, err := tx.GetRepository("tokens")
+		if err != nil {
+			return err
+		}
+		if _, err := txUsers.Save(&map[string]interface{}{"status": "active"}, NewFilter().Match("id", "john").Match("status", "pending")); err != nil {
+			return err
+		}
+		if _, err := txUsers.Save(&map[string]interface{}{"status": "active"}, NewFilter().Match("id", "john")); err == nil || !IsErrInvalidInput(err) {
+			t.Fatal("Expected invalid input error for a second write of the same item. Got: ", err)
+		}
+		_, err = txTokens.SaveAll([]map[string]interface{}{{"id": "token-1", "user": "john"}, {"id": "token-2", "user": "john"}})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := users.GetOne(NewFilter().Match("id", "john"), &map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (*user.(*map[string]interface{}))["status"] != "active" {
+		t.Fatal("Expected the user to be activated. Got: ", user)
+	}
+	if count, err := users.Count(NewFilter().Match("user", "john")); err != nil || count != 2 {
+		t.Fatal("Expected the tokens to be saved with the user. Got: ", count, err)
+	}
+
+	err = txBackend.Transact(context.Background(), func(tx Transaction) error {
+		txTokens, err := tx.GetRepository("tokens")
+		if err != nil {
+			return err
+		}
+		if err := txTokens.DeleteAll(NewFilter().Match("user", "john")); err != nil {
+			return err
+		}
+		_, err = txTokens.Save(&map[string]interface{}{"id": "john"}, nil)
+		return err
+	})
+	if err == nil || !IsErrAlreadyExists(err) {
+		t.Fatal("Expected already exists error for the existing item. Got: ", err)
+	}
+	if count, err := users.Count(NewFilter().Match("user", "john")); err != nil || count != 2 {
+		t.Fatal("Expected the tokens to be kept. Got: ", count, err)
+	}
+}
+
+func TestDynamoTransactCheck(t *testing.T) {
+	client := newFakeDynamoDB()
+	backend := NewDynamoBackend(&config.DBInfo{DatabaseName: "test"}, client)
+	accounts, err := backend.DefineRepository("accounts", RepositoryDefinitionMap{"name": "accounts", "hashKey": "id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.DefineRepository("orders", RepositoryDefinitionMap{"name": "orders", "hashKey": "id"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := accounts.Save(&map[string]interface{}{"id": "acme", "status": "active"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	order := func(id string, blocked bool) error {
+		return backend.Transact(context.Background(), func(tx Transaction) error {
+			txAccounts, err := tx.GetRepository("accounts")
+			if err != nil {
+				return err
+			}
+			txOrders, err := tx.GetRepository("orders")
+			if err != nil {
+				return err
+			}
+			if err := txAccounts.(ConditionChecker).Check(NewFilter().Match("id", "acme").Match("status", "active")); err != nil {
+				return err
+			}
+			if _, err := txOrders.Save(&map[string]interface{}{"id": id, "account": "acme"}, nil); err != nil {
+				return err
+			}
+			if blocked {
+				// blocked concurrently, after it was checked by the transaction
+				if _, err := accounts.Save(&map[string]interface{}{"status": "blocked"}, NewFilter().Match("id", "acme")); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	if err := order("order-1", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := order("order-2", true); err == nil || !IsErrNotFound(err) {
+		t.Fatal("Expected the retried transaction to find no active account. Got: ", err)
+	}
+	if count, err := accounts.Count(NewFilter().Match("account", "acme")); err != nil || count != 1 {
+		t.Fatal("Expected only the first order to be saved. Got: ", count, err)
+	}
+
+	err = backend.Transact(context.Background(), func(tx Transaction) error {
+		txAccounts, err := tx.GetRepository("accounts")
+		if err != nil {
+			return err
+		}
+		if err := txAccounts.(ConditionChecker).Check(NewFilter().Match("id", "acme")); err != nil {
+			return err
+		}
+		_, err = txAccounts.Save(&map[string]interface{}{"status": "active"}, NewFilter().Match("id", "acme"))
+		return err
+	})
+	if err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input error for a write of the checked item. Got: ", err)
+	}
+}
+
+func TestDynamoTransactContext(t *testing.T) {
+	client := newFakeDynamoDB()
+	backend := NewDynamoBackend(&config.DBInfo{DatabaseName: "test"}, client)
+	if _, err := backend.DefineRepository("users", RepositoryDefinitionMap{"name": "users", "hashKey": "id"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := backend.Transact(ctx, func(tx Transaction) error {
+		t.Fatal("Expected the transaction not to run with a canceled context")
+		return nil
+	})
+	if err != context.Canceled || client.transactions != 0 {
+		t.Fatal("Expected the error of the context. Got: ", err, client.transactions)
+	}
+}
+
+func TestDynamoTransactDefinition(t *testing.T) {
+	backend := NewDynamoBackend(&config.DBInfo{DatabaseName: "test"}, newFakeDynamoDB())
+	articles, err := backend.DefineRepository("articles", RepositoryDefinitionMap{
+		"name":       "articles",
+		"hashKey":    "id",
+		"versioned":  true,
+		"softDelete": true,
+	}.WithEnum("status", NewEnum("draft", "published")).WithDataSchema(&DataSchema{
+		Type:       SchemaObject,
+		Required:   []string{"title"},
+		Properties: map[string]*DataSchema{"title": {Type: SchemaString}},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := articles.Save(&map[string]interface{}{"id": "a1", "title": "First", "status": "draft"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	byID := NewFilter().Match("id", "a1")
+
+	err = backend.Transact(context.Background(), func(tx Transaction) error {
+		txArticles, err := tx.GetRepository("articles")
+		if err != nil {
+			return err
+		}
+		if _, err := txArticles.Save(&map[string]interface{}{"id": "a2", "title": 2}, nil); err == nil || !IsErrInvalidInput(err) {
+			t.Fatal("Expected the data schema to be validated in the transaction. Got: ", err)
+		}
+		if _, err := txArticles.Save(&map[string]interface{}{"status": "archived", "version": 1}, byID); err == nil || !IsErrInvalidInput(err) {
+			t.Fatal("Expected the enum to be validated in the transaction. Got: ", err)
+		}
+		if _, err := txArticles.Save(&map[string]interface{}{"status": "published"}, byID); err == nil || !IsErrInvalidInput(err) {
+			t.Fatal("Expected the version to be required in the transaction. Got: ", err)
+		}
+		_, err = txArticles.Save(&map[string]interface{}{"status": "published", "version": 1}, byID)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	article := map[string]interface{}{}
+	if _, err := articles.GetOne(byID, &article); err != nil {
+		t.Fatal(err)
+	}
+	if article["status"] != "published" || fmt.Sprint(article["version"]) != "2" {
+		t.Fatal("Expected the article to be published at version 2. Got: ", article)
+	}
+
+	err = backend.Transact(context.Background(), func(tx Transaction) error {
+		txArticles, err := tx.GetRepository("articles")
+		if err != nil {
+			return err
+		}
+		_, err = txArticles.Save(&map[string]interface{}{"title": "Stale", "version": 1}, byID)
+		return err
+	})
+	if err == nil || !IsErrConflict(err) {
+		t.Fatal("Expected a conflict for the stale version. Got: ", err)
+	}
+
+	err = backend.Transact(context.Background(), func(tx Transaction) error {
+		txArticles, err := tx.GetRepository("articles")
+		if err != nil {
+			return err
+		}
+		return txArticles.DeleteOne(byID)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := articles.GetOne(byID, nil); err == nil || !IsErrNotFound(err) {
+		t.Fatal("Expected the article to be soft-deleted. Got: ", err)
+	}
+	collection, ok := unwrapRepository(articles).(*DynamoCollection)
+	if !ok {
+		t.Fatal("Expected the DynamoDB collection under the wrappers. Got: ", articles)
+	}
+	if deleted, err := collection.Exists(NewFilter().Match("id", "a1").Match(SoftDeleteField, 0)); err != nil || deleted {
+		t.Fatal("Expected the article to be kept with the deletion time. Got: ", deleted, err)
+	}
+	if exists, err := collection.Exists(byID); err != nil || !exists {
+		t.Fatal("Expected the deleted article to be kept. Got: ", exists, err)
+	}
+
+	err = backend.Transact(context.Background(), func(tx Transaction) error {
+		txArticles, err := tx.GetRepository("articles")
+		if err != nil {
+			return err
+		}
+		if exists, err := txArticles.Exists(byID); err != nil || exists {
+			t.Fatal("Expected the soft-deleted article to be hidden in the transaction. Got: ", exists, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDynamoRangeFilter(t *testing.T) {
+	repo := newFakeDynamoCollection(t, newFakeDynamoDB())
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	records := []map[string]interface{}{}
+	for i := 0; i < 10; i++ {
+		records = append(records, map[string]interface{}{
+			"id":        fmt.Sprintf("event-%d", i),
+			"index":     i,
+			"createdAt": start.Add(time.Duration(i) * 24 * time.Hour),
+		})
+	}
+	if _, err := repo.SaveAll(records); err != nil {
+		t.Fatal(err)
+	}
+
+	filter := NewFilter().MatchGte("createdAt", start.Add(2*24*time.Hour)).MatchLt("createdAt", start.Add(5*24*time.Hour))
+	results, err := repo.GetAll(filter, &map[string]interface{}{}, "createdAt", "asc", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := results.([]*map[string]interface{})
+	if len(events) != 3 || (*events[0])["id"] != "event-2" || (*events[2])["id"] != "event-4" {
+		t.Fatal("Expected the events of the 3 days in the range. Got: ", events)
+	}
+
+	// the times in other zones and with fractional seconds are stored in UTC, so they compare as times
+	zone := time.FixedZone("CEST", 2*60*60)
+	if _, err := repo.Save(&map[string]interface{}{"id": "event-zone", "index": 10, "createdAt": start.Add(3*24*time.Hour + 500*time.Millisecond).In(zone)}, nil); err != nil {
+		t.Fatal(err)
+	}
+	results, err = repo.GetAll(NewFilter().MatchTimeRange("createdAt", start.Add(3*24*time.Hour), start.Add(4*24*time.Hour)), &map[string]interface{}{}, "createdAt", "asc", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events = results.([]*map[string]interface{})
+	if len(events) != 2 || (*events[1])["id"] != "event-zone" || (*events[1])["createdAt"] != "2020-01-04T00:00:00.500000000Z" {
+		t.Fatal("Expected the event in another zone in the range, stored in UTC. Got: ", events)
+	}
+
+	estimated, err := CountRecords(repo, nil, Estimated())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if estimated != 11 {
+		t.Fatal("Expected the item count of the table. Got: ", estimated)
+	}
+
+	count, err := repo.Count(NewFilter().MatchGt("index", 7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Fatal("Expected 3 events with index greater than 7. Got: ", count)
+	}
+}
+
+func TestDynamoExplain(t *testing.T) {
+	repo := newFakeDynamoCollection(t, newFakeDynamoDB())
+	if _, err := repo.SaveAll([]map[string]interface{}{{"id": "1", "role": "admin"}, {"id": "2", "role": "user"}, {"id": "3", "role": "user"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := Explain(repo, NewFilter().Match("role", "user"), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, ok := plan.Query.(*dynamodb.ScanInput)
+	if !ok || aws.ToString(input.FilterExpression) != "#n0 = :v1" || input.Select != "" {
+		t.Fatal("Expected the scan input of the filter. Got: ", plan.Query)
+	}
+	if plan.Backend != "dynamodb" || !plan.FullScan || plan.Scanned != 3 || plan.Matched != 2 {
+		t.Fatal("Expected a full scan of 3 items matching 2. Got: ", plan)
+	}
+}
+
+func TestDynamoQueryByKey(t *testing.T) {
+	client := newFakeDynamoDB()
+	repo := newFakeDynamoCollection(t, client)
+	if _, err := repo.SaveAll([]map[string]interface{}{{"id": "1", "role": "admin"}, {"id": "2", "role": "user"}, {"id": "3", "role": "user"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := repo.GetOne(NewFilter().Match("id", "2"), &map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (*result.(*map[string]interface{}))["role"] != "user" {
+		t.Fatal("Invalid record. Got: ", result)
+	}
+	count, err := repo.Count(NewFilter().Match("id", "2").Match("role", "admin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Fatal("Expected no match. Got: ", count)
+	}
+	if len(client.queries) != 2 || client.scans != 0 {
+		t.Fatalf("Expected 2 queries and no scans. Got %d queries and %d scans", len(client.queries), client.scans)
+	}
+	input := client.queries[1]
+	if aws.ToString(input.KeyConditionExpression) != "#n0 = :v1" || aws.ToString(input.FilterExpression) != "#n2 = :v3" || input.IndexName != nil {
+		t.Fatal("Expected the key condition on the id. Got: ", input)
+	}
+
+	// the key can not be queried with other operators
+	if _, err := repo.Count(NewFilter().MatchIn("id", []string{"1", "2"})); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.queries) != 2 || client.scans == 0 {
+		t.Fatal("Expected the table to be scanned")
+	}
+
+	plan, err := Explain(repo, NewFilter().Match("id", "3"), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := plan.Query.(*dynamodb.QueryInput); !ok || plan.FullScan || plan.Scanned != 1 || plan.Matched != 1 {
+		t.Fatal("Expected a query of 1 item. Got: ", plan)
+	}
+}
+
+func TestDynamoGSIProjection(t *testing.T) {
+	client := newFakeDynamoDB()
+	ctx := context.WithValue(context.Background(), DYNAMO_CTX_KEY, client)
+	backend := NewRepositoriesBackend(ctx, &config.DBInfo{DatabaseName: "test"}, DynamoDBRepoBuilder, func() {})
+	repo, err := backend.DefineRepository("members", RepositoryDefinitionMap{
+		"name":          "members",
+		"hashKey":       "id",
+		"readCapacity":  5,
+		"writeCapacity": 5,
+		"GSI": map[string]interface{}{
+			"email": map[string]interface{}{"readCapacity": 1, "writeCapacity": 1, "projection": "KEYS_ONLY"},
+			"team":  map[string]interface{}{"readCapacity": 1, "writeCapacity": 1, "projection": "INCLUDE", "attributes": []string{"role"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gsi := client.created[0].GlobalSecondaryIndexes
+	if gsi[0].Projection.ProjectionType != types.ProjectionTypeKeysOnly || gsi[1].Projection.ProjectionType != types.ProjectionTypeInclude ||
+		!reflect.DeepEqual(gsi[1].Projection.NonKeyAttributes, []string{"role"}) {
+		t.Fatal("Expected the projections of the GSIs. Got: ", gsi)
+	}
+	_, err = repo.SaveAll([]map[string]interface{}{
+		{"id": "1", "email": "john@example.com", "team": "red", "role": "admin", "name": "John"},
+		{"id": "2", "email": "jane@example.com", "team": "red", "role": "user", "name": "Jane"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the items of the KEYS_ONLY GSI are fetched from the table
+	batches := client.batches
+	results, err := repo.GetAll(NewFilter().Match("email", "jane@example.com"), &map[string]interface{}{}, "", "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := results.([]*map[string]interface{})
+	if len(found) != 1 || (*found[0])["name"] != "Jane" || aws.ToString(client.queries[len(client.queries)-1].IndexName) != "email-index" {
+		t.Fatal("Expected the item from the email GSI. Got: ", found)
+	}
+	if client.batches == batches {
+		t.Fatal("Expected the item to be fetched from the table")
+	}
+	batches = client.batches
+
+	// the projected attributes are read from the GSI only
+	results, err = GetAllFields(repo, NewFilter().Match("team", "red").Match("role", "user"), &map[string]interface{}{}, []string{"id", "role"}, "", "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found = results.([]*map[string]interface{})
+	if len(found) != 1 || (*found[0])["id"] != "2" || client.batches != batches || aws.ToString(client.queries[len(client.queries)-1].IndexName) != "team-index" {
+		t.Fatal("Expected the projected attributes of the team GSI. Got: ", found)
+	}
+	if count, err := repo.Count(NewFilter().Match("team", "red")); err != nil || count != 2 || client.batches != batches {
+		t.Fatal("Expected the items to be counted in the GSI. Got: ", count, err)
+	}
+
+	// the table is scanned for the filters on the attributes that are not projected
+	queries := len(client.queries)
+	if count, err := repo.Count(NewFilter().Match("email", "jane@example.com").Match("name", "Jane")); err != nil || count != 1 || len(client.queries) != queries {
+		t.Fatal("Expected the table to be scanned. Got: ", count, err)
+	}
+}
+
+func TestDynamoCreateTableLSI(t *testing.T) {
+	client := newFakeDynamoDB()
+	definition := RepositoryDefinitionMap{
+		"name":          "scores",
+		"hashKey":       "user",
+		"rangeKey":      "createdAt",
+		"readCapacity":  5,
+		"writeCapacity": 5,
+		"LSI": map[string]interface{}{
+			"score": map[string]interface{}{"type": "N", "projection": "INCLUDE", "attributes": []string{"game"}},
+			"level": map[string]interface{}{"projection": "KEYS_ONLY"},
+		},
+	}
+	if err := createTable(client, definition, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	input := client.created[0]
+	if len(input.AttributeDefinitions) != 4 || len(input.LocalSecondaryIndexes) != 2 {
+		t.Fatal("Expected the attributes of the keys and 2 LSIs. Got: ", input)
+	}
+	lsi := input.LocalSecondaryIndexes[1]
+	if aws.ToString(lsi.IndexName) != "score-local-index" || aws.ToString(lsi.KeySchema[0].AttributeName) != "user" ||
+		aws.ToString(lsi.KeySchema[1].AttributeName) != "score" || lsi.KeySchema[1].KeyType != types.KeyTypeRange ||
+		lsi.Projection.ProjectionType != types.ProjectionTypeInclude || !reflect.DeepEqual(lsi.Projection.NonKeyAttributes, []string{"game"}) {
+		t.Fatal("Invalid LSI. Got: ", lsi)
+	}
+	if input.AttributeDefinitions[3].AttributeType != types.ScalarAttributeTypeN {
+		t.Fatal("Expected a number range key of the LSI. Got: ", input.AttributeDefinitions[3])
+	}
+
+	// the LSI is queried when the filter has a condition on its range key
+	collection := &DynamoCollection{tableName: "scores", RepositoryDefinition: definition}
+	read, err := collection.newRead(NewFilter().Match("user", "john").MatchGt("score", 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, err := collection.readInput(read, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queryInput, ok := query.(*dynamodb.QueryInput); !ok || aws.ToString(queryInput.IndexName) != "score-local-index" ||
+		aws.ToString(queryInput.KeyConditionExpression) != "#n0 = :v1 AND #n2 > :v3" || queryInput.Select != types.SelectAllAttributes {
+		t.Fatal("Expected a query of the LSI with all attributes. Got: ", query)
+	}
+	if read, _ = collection.newRead(NewFilter().Match("user", "john")); read.indexKey.index != "" {
+		t.Fatal("Expected a query of the table. Got: ", read.indexKey.index)
+	}
+
+	invalid := []RepositoryDefinitionMap{
+		{"name": "a", "hashKey": "user", "LSI": map[string]interface{}{"score": map[string]interface{}{}}},
+		{"name": "b", "hashKey": "user", "rangeKey": "createdAt", "LSI": map[string]interface{}{"createdAt": map[string]interface{}{}}},
+		{"name": "c", "hashKey": "user", "rangeKey": "createdAt", "LSI": map[string]interface{}{"score": map[string]interface{}{"projection": "INCLUDE"}}},
+		{"name": "d", "hashKey": "user", "rangeKey": "createdAt", "LSI": map[string]interface{}{"score": map[string]interface{}{"projection": "SOME"}}},
+	}
+	for _, definition := range invalid {
+		if err := createTable(newFakeDynamoDB(), definition, ""); err == nil {
+			t.Fatal("Expected an error for the invalid LSI of table ", definition.GetName())
+		}
+	}
+}
+
+func TestDynamoAutoScaling(t *testing.T) {
+	client := newFakeDynamoDB()
+	scaling := &fakeDynamoAutoScaling{}
+	backend := NewDynamoBackend(&config.DBInfo{DatabaseName: "test"}, client)
+	backend.SetAutoScaling(scaling)
+
+	_, err := backend.DefineRepository("users", RepositoryDefinitionMap{
+		"name":          "users",
+		"hashKey":       "id",
+		"readCapacity":  5,
+		"writeCapacity": 5,
+		"autoScaling":   map[string]interface{}{"minCapacity": 5, "maxCapacity": 100},
+		"GSI": map[string]interface{}{
+			"email": map[string]interface{}{"readCapacity": 1, "writeCapacity": 1},
+			"name": map[string]interface{}{
+				"readCapacity":  1,
+				"writeCapacity": 1,
+				"autoScaling":   map[string]interface{}{"minCapacity": 1, "maxCapacity": 10, "targetUtilization": 50.0},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(scaling.targets) != 6 || len(scaling.policies) != 6 {
+		t.Fatalf("Expected the read and write capacity of the table and 2 GSIs to be scaled. Got %d targets and %d policies", len(scaling.targets), len(scaling.policies))
+	}
+	table := scaling.targets[0]
+	if aws.ToString(table.ResourceId) != "table/users" || table.ScalableDimension != autoscalingtypes.ScalableDimensionDynamoDBTableReadCapacityUnits ||
+		aws.ToInt32(table.MinCapacity) != 5 || aws.ToInt32(table.MaxCapacity) != 100 {
+		t.Fatal("Invalid scalable target of the table. Got: ", table)
+	}
+	policy := scaling.policies[1]
+	if aws.ToString(policy.PolicyName) != "DynamoDBWriteCapacityUtilization:table/users" || policy.PolicyType != autoscalingtypes.PolicyTypeTargetTrackingScaling ||
+		aws.ToFloat64(policy.TargetTrackingScalingPolicyConfiguration.TargetValue) != 70 ||
+		policy.TargetTrackingScalingPolicyConfiguration.PredefinedMetricSpecification.PredefinedMetricType != autoscalingtypes.MetricTypeDynamoDBWriteCapacityUtilization {
+		t.Fatal("Invalid scaling policy of the table. Got: ", policy)
+	}
+	// the GSI without auto scaling is scaled like the table
+	if index := scaling.targets[2]; aws.ToString(index.ResourceId) != "table/users/index/email-index" ||
+		index.ScalableDimension != autoscalingtypes.ScalableDimensionDynamoDBIndexReadCapacityUnits || aws.ToInt32(index.MaxCapacity) != 100 {
+		t.Fatal("Invalid scalable target of the email GSI. Got: ", index)
+	}
+	if index := scaling.targets[4]; aws.ToString(index.ResourceId) != "table/users/index/name-index" || aws.ToInt32(index.MaxCapacity) != 10 ||
+		aws.ToFloat64(scaling.policies[4].TargetTrackingScalingPolicyConfiguration.TargetValue) != 50 {
+		t.Fatal("Invalid scalable target of the name GSI. Got: ", index)
+	}
+
+	// the tables without auto scaling don't need the client
+	if err := setAutoScaling(client, nil, RepositoryDefinitionMap{"name": "plain", "hashKey": "id"}); err != nil {
+		t.Fatal(err)
+	}
+	invalid := []RepositoryDefinitionMap{
+		{"name": "a", "hashKey": "id", "autoScaling": map[string]interface{}{"minCapacity": 5}},
+		{"name": "b", "hashKey": "id", "autoScaling": map[string]interface{}{"minCapacity": 10, "maxCapacity": 5}},
+		{"name": "c", "hashKey": "id", "autoScaling": map[string]interface{}{"minCapacity": 1, "maxCapacity": 5, "targetUtilization": 95}},
+		{"name": "d", "hashKey": "id", "GSI": map[string]interface{}{"email": map[string]interface{}{"autoScaling": map[string]interface{}{"minCapacity": 0, "maxCapacity": 5}}}},
+	}
+	for _, definition := range invalid {
+		if err := setAutoScaling(client, scaling, definition); err == nil {
+			t.Fatal("Expected an error for the invalid auto scaling of table ", definition.GetName())
+		}
+	}
+	if err := setAutoScaling(client, nil, RepositoryDefinitionMap{"name": "e", "hashKey": "id", "autoScaling": map[string]interface{}{"minCapacity": 1, "maxCapacity": 5}}); err == nil {
+		t.Fatal("Expected an error without the auto scaling client")
+	}
+}
+
+func TestDynamoWatch(t *testing.T) {
+	client := newFakeDynamoDB()
+	active := func(id string, status string) map[string]streamstypes.AttributeValue {
+		return map[string]streamstypes.AttributeValue{
+			"id":     &streamstypes.AttributeValueMemberS{Value: id},
+			"status": &streamstypes.AttributeValueMemberS{Value: status},
+			"logins": &streamstypes.AttributeValueMemberN{Value: "3"},
+		}
+	}
+	streams := &fakeDynamoStreams{
+		shards: []streamstypes.Shard{
+			{ShardId: aws.String("s0"), SequenceNumberRange: &streamstypes.SequenceNumberRange{EndingSequenceNumber: aws.String("10")}},
+			{ShardId: aws.String("s1"), ParentShardId: aws.String("s0"), SequenceNumberRange: &streamstypes.SequenceNumberRange{}},
+		},
+		records: map[string][]streamstypes.Record{
+			"s0": {fakeDynamoStreamRecord(streamstypes.OperationTypeInsert, "u0", active("u0", "active"))},
+			"s1": {
+				fakeDynamoStreamRecord(streamstypes.OperationTypeInsert, "u1", active("u1", "active")),
+				fakeDynamoStreamRecord(streamstypes.OperationTypeModify, "u2", active("u2", "inactive")),
+			},
+			"s2": {fakeDynamoStreamRecord(streamstypes.OperationTypeRemove, "u3", active("u3", "active"))},
+		},
+		children: map[string]streamstypes.Shard{
+			"s1": {ShardId: aws.String("s2"), ParentShardId: aws.String("s1"), SequenceNumberRange: &streamstypes.SequenceNumberRange{}},
+		},
+	}
+	backend := NewDynamoBackend(&config.DBInfo{DatabaseName: "test"}, client)
+	backend.SetStreams(streams)
+
+	repo, err := backend.DefineRepository("users", RepositoryDefinitionMap{
+		"name":          "users",
+		"hashKey":       "id",
+		"readCapacity":  5,
+		"writeCapacity": 5,
+		"enableStream":  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec := client.created[0].StreamSpecification; spec == nil || !aws.ToBool(spec.StreamEnabled) || spec.StreamViewType != types.StreamViewTypeNewAndOldImages {
+		t.Fatal("Expected the stream of the new and old images to be enabled. Got: ", spec)
+	}
+
+	changes, err := repo.(ChangeWatcher).Watch(NewFilter().Match("status", "active"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := []*ChangeEvent{}
+	for len(events) < 2 && changes.Next() {
+		events = append(events, changes.Event())
+	}
+	if err := changes.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatal("Expected 2 changes. Got: ", events)
+	}
+	if events[0].Type != ChangeInsert || events[0].Key["id"] != "u1" || events[0].Record["logins"] != float64(3) {
+		t.Fatal("Invalid insert. Got: ", events[0])
+	}
+	if events[1].Type != ChangeDelete || events[1].Key["id"] != "u3" || events[1].Record != nil || events[1].OldRecord["status"] != "active" {
+		t.Fatal("Invalid delete. Got: ", events[1])
+	}
+
+	// the open shard is read from its latest record, the closed one is skipped, and its child is read from the start
+	// once the open shard is read to its end
+	streams.mutex.Lock()
+	iterators := streams.iterators
+	streams.mutex.Unlock()
+	if len(iterators) != 2 || aws.ToString(iterators[0].ShardId) != "s1" || iterators[0].ShardIteratorType != streamstypes.ShardIteratorTypeLatest ||
+		aws.ToString(iterators[1].ShardId) != "s2" || iterators[1].ShardIteratorType != streamstypes.ShardIteratorTypeTrimHorizon {
+		t.Fatal("Invalid shard iterators. Got: ", iterators)
+	}
+
+	// the tables without a stream can't be watched
+	plain, err := backend.DefineRepository("plain", RepositoryDefinitionMap{"name": "plain", "hashKey": "id", "readCapacity": 5, "writeCapacity": 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plain.(ChangeWatcher).Watch(nil); !IsErrorOfType(err, ErrNotSupported("")) {
+		t.Fatal("Expected ErrNotSupported. Got: ", err)
+	}
+	if err := createTable(client, RepositoryDefinitionMap{"name": "invalid", "hashKey": "id", "enableStream": true, "streamViewType": "ALL"}, ""); err == nil {
+		t.Fatal("Expected an error for the invalid stream view type")
+	}
+}
+
+func TestDynamoDAX(t *testing.T) {
+	client := newFakeDynamoDB()
+	cache := &fakeDynamoDAX{client: client}
+	backend := NewDynamoBackend(&config.DBInfo{DatabaseName: "test"}, client)
+	backend.SetDAX(cache)
+	repo, err := backend.DefineRepository("users", RepositoryDefinitionMap{
+		"name":          "users",
+		"hashKey":       "id",
+		"readCapacity":  5,
+		"writeCapacity": 5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.SaveAll([]map[string]interface{}{{"id": "alice"}, {"id": "bob"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the reads of the records are sent to DAX
+	if _, err := repo.GetOne(NewFilter().Match("id", "alice"), &map[string]interface{}{}); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := repo.(*DynamoCollection).Exists(NewFilter().Match("id", "bob")); err != nil || !exists {
+		t.Fatal("Expected bob to exist. Got: ", exists, err)
+	}
+	if _, err := repo.(*DynamoCollection).GetManyByIDs([]string{"alice", "bob"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if cache.queries != 2 || cache.batches == 0 || len(client.queries) != 2 {
+		t.Fatalf("Expected the queries and the batch reads to be sent to DAX. Got %d queries and %d batch reads", cache.queries, cache.batches)
+	}
+
+	// the reads of the deletes are sent to DynamoDB
+	if err := repo.DeleteOne(NewFilter().Match("id", "alice")); err != nil {
+		t.Fatal(err)
+	}
+	if cache.queries != 2 || len(client.queries) != 3 {
+		t.Fatalf("Expected the read of the delete to be sent to DynamoDB. Got %d queries of DAX and %d of DynamoDB", cache.queries, len(client.queries))
+	}
+}
+
+func TestDynamoConditionalWrites(t *testing.T) {
+	client := newFakeDynamoDB()
+	repo := newFakeDynamoCollection(t, client)
+	if _, err := repo.Save(&map[string]interface{}{"id": "1", "status": "pending"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	writer := repo.(ConditionalWriter)
+
+	// the record is updated while it matches the condition
+	pending := NewFilter().Match("status", "pending")
+	if _, err := writer.SaveIf(&map[string]interface{}{"status": "paid"}, NewFilter().Match("id", "1"), pending); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.SaveIf(&map[string]interface{}{"status": "canceled"}, NewFilter().Match("id", "1"), pending); err == nil || !IsErrConflict(err) {
+		t.Fatal("Expected conflict error for a record that is not pending. Got: ", err)
+	}
+	record := map[string]interface{}{}
+	if _, err := repo.GetOne(NewFilter().Match("id", "1"), &record); err != nil || record["status"] != "paid" {
+		t.Fatal("Expected the record to stay paid. Got: ", record, err)
+	}
+
+	// a new record is written over the existing one if it matches the condition
+	if _, err := writer.SaveIf(&map[string]interface{}{"id": "1", "status": "new"}, nil, pending); err == nil || !IsErrConflict(err) {
+		t.Fatal("Expected conflict error for a record that is not pending. Got: ", err)
+	}
+	if _, err := writer.SaveIf(&map[string]interface{}{"id": "1", "status": "new"}, nil, NewFilter().Match("status", "paid")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.SaveIf(&map[string]interface{}{"id": "1"}, nil, nil); err == nil || !IsErrAlreadyExists(err) {
+		t.Fatal("Expected already exists error without a condition. Got: ", err)
+	}
+
+	// the record is deleted only if it matches the condition
+	if err := writer.DeleteIf(NewFilter().Match("id", "1"), pending); err == nil || !IsErrConflict(err) {
+		t.Fatal("Expected conflict error for a record that is not pending. Got: ", err)
+	}
+	if err := writer.DeleteIf(NewFilter().Match("id", "1"), NewFilter().Match("status", "new")); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.DeleteIf(NewFilter().Match("id", "1"), nil); err == nil || !IsErrNotFound(err) {
+		t.Fatal("Expected not found error for a deleted record. Got: ", err)
+	}
+}
+
+func TestDynamoGetAllPages(t *testing.T) {
+	client := newFakeDynamoDB()
+	repo := newFakeDynamoCollection(t, client)
+	records := []map[string]interface{}{}
+	for i := 0; i < 9; i++ {
+		records = append(records, map[string]interface{}{"id": fmt.Sprintf("%02d", i)})
+	}
+	if _, err := repo.SaveAll(records); err != nil {
+		t.Fatal(err)
+	}
+
+	// the pages of a single scan are read until the offset and the limit are reached (2 items per page)
+	for _, test := range []struct {
+		limit, offset, scans int
+		ids                  []string
+	}{
+		{0, 0, 5, []string{"00", "01", "02", "03", "04", "05", "06", "07", "08"}},
+		{3, 4, 4, []string{"04", "05", "06"}},
+		{2, 0, 1, []string{"00", "01"}},
+		{5, 7, 5, []string{"07", "08"}},
+	} {
+		scans := client.scans
+		results, err := repo.GetAll(nil, &map[string]interface{}{}, "", "", test.limit, test.offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []string{}
+		for _, record := range results.([]*map[string]interface{}) {
+			ids = append(ids, (*record)["id"].(string))
+		}
+		if !reflect.DeepEqual(ids, test.ids) || client.scans-scans != test.scans {
+			t.Fatalf("Expected %v in %d scans for limit %d and offset %d. Got %v in %d scans", test.ids, test.scans, test.limit, test.offset, ids, client.scans-scans)
+		}
+	}
+}
+
+func TestDynamoGetAllOrder(t *testing.T) {
+	client := newFakeDynamoDB()
+	repo := newFakeDynamoCollection(t, client)
+	records := []map[string]interface{}{}
+	for i, name := range []string{"carol", "alice", "erin", "bob", "dave"} {
+		records = append(records, map[string]interface{}{"id": fmt.Sprintf("%02d", i), "name": name, "profile": map[string]interface{}{"age": 30 - i}})
+	}
+	if _, err := repo.SaveAll(records); err != nil {
+		t.Fatal(err)
+	}
+
+	// a scan can not be ordered by DynamoDB, so all matched records are read and sorted before the limit and offset
+	for _, test := range []struct {
+		order, sorting string
+		limit, offset  int
+		ids            []string
+	}{
+		{"name", "asc", 0, 0, []string{"01", "03", "00", "04", "02"}},
+		{"name", "desc", 2, 1, []string{"04", "00"}},
+		{"profile.age", "asc", 3, 0, []string{"04", "03", "02"}},
+	} {
+		results, err := repo.GetAll(nil, &map[string]interface{}{}, test.order, test.sorting, test.limit, test.offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []string{}
+		for _, record := range results.([]*map[string]interface{}) {
+			ids = append(ids, (*record)["id"].(string))
+		}
+		if !reflect.DeepEqual(ids, test.ids) {
+			t.Fatalf("Expected %v ordered by %s %s. Got %v", test.ids, test.order, test.sorting, ids)
+		}
+	}
+
+	// the order attribute is not returned if it is not selected
+	results, err := repo.(*DynamoCollection).GetAllFields(nil, &map[string]interface{}{}, []string{"id"}, "name", "desc", 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record := *results.([]*map[string]interface{})[0]; !reflect.DeepEqual(record, map[string]interface{}{"id": "02"}) {
+		t.Fatal("Expected only the id of the last record by name. Got: ", record)
+	}
+
+	// the queried items are ordered by the range key of the index
+	read := &dynamoRead{key: &DynamoQuery{}, indexKey: dynamoIndexKey{hashKey: "user", rangeKey: "createdAt"}}
+	if !read.orderBy("createdAt", "desc") || aws.ToBool(read.forward) {
+		t.Fatal("Expected the query to be ordered by the range key descending. Got: ", read.forward)
+	}
+	if read := (&dynamoRead{}); read.orderBy("createdAt", "asc") || read.forward != nil {
+		t.Fatal("Expected the scan not to be ordered")
+	}
+}
+
+func TestDynamoGetAllAfter(t *testing.T) {
+	client := newFakeDynamoDB()
+	repo := newFakeDynamoCollection(t, client)
+	_, err := repo.SaveAll([]map[string]interface{}{
+		{"id": "1", "role": "user"}, {"id": "2", "role": "user"}, {"id": "3", "role": "admin"},
+		{"id": "4", "role": "user"}, {"id": "5", "role": "user"}, {"id": "6", "role": "user"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the pages continue where the previous one stopped
+	ids := []string{}
+	token := ""
+	for {
+		scans := client.scans
+		results, next, err := GetAllAfter(repo, NewFilter().Match("role", "user"), &map[string]interface{}{}, "", "", 2, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, record := range results.([]*map[string]interface{}) {
+			ids = append(ids, (*record)["id"].(string))
+		}
+		if client.scans-scans > 2 {
+			t.Fatal("Expected the page to be read from the token. Got scans: ", client.scans-scans)
+		}
+		if next == "" {
+			break
+		}
+		token = next
+	}
+	if !reflect.DeepEqual(ids, []string{"1", "2", "4", "5", "6"}) {
+		t.Fatal("Expected all users. Got: ", ids)
+	}
+
+	if _, _, err := GetAllAfter(repo, nil, &map[string]interface{}{}, "", "", 2, "e30"); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input error for an empty token. Got: ", err)
+	}
+	key := map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: "1"}, "n": &types.AttributeValueMemberN{Value: "1.5"}, "b": &types.AttributeValueMemberB{Value: []byte{1, 2}}}
+	token, err = encodeDynamoPageToken(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded, err := decodeDynamoPageToken(token); err != nil || !reflect.DeepEqual(decoded, key) {
+		t.Fatal("Expected the key of the token. Got: ", decoded, err)
+	}
+}
+
+func TestDynamoParallelScan(t *testing.T) {
+	client := newFakeDynamoDB()
+	repo := newFakeDynamoCollection(t, client)
+	records := []map[string]interface{}{}
+	for i := 0; i < 10; i++ {
+		records = append(records, map[string]interface{}{"id": fmt.Sprintf("%02d", i), "even": i%2 == 0})
+	}
+	if _, err := repo.SaveAll(records); err != nil {
+		t.Fatal(err)
+	}
+	collection := repo.(*DynamoCollection)
+
+	it, err := collection.ParallelScan(NewFilter().Match("even", true), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for it.Next() {
+		var record struct {
+			ID string `json:"id"`
+		}
+		if err := it.Decode(&record); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, record.ID)
+	}
+	if err := it.Close(); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(ids)
+	if !reflect.DeepEqual(ids, []string{"00", "02", "04", "06", "08"}) {
+		t.Fatal("Expected the even records of all segments. Got: ", ids)
+	}
+	segments := map[int32]bool{}
+	for _, segment := range client.segments {
+		segments[segment] = true
+	}
+	if len(segments) != 3 {
+		t.Fatal("Expected 3 segments to be scanned. Got: ", client.segments)
+	}
+
+	// the scan stops when the iterator is closed early
+	it, err = collection.ParallelScan(nil, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !it.Next() || it.Record()["id"] == nil {
+		t.Fatal("Expected a record")
+	}
+	if err := it.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := collection.ParallelScan(nil, 0); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input error for 0 segments. Got: ", err)
+	}
+}
+
+func TestDynamoKeyCondition(t *testing.T) {
+	keys := dynamoIndexKeys(RepositoryDefinitionMap{
+		"hashKey":      "user",
+		"rangeKey":     "createdAt",
+		"rangeKeyType": "S",
+		"GSI": map[string]interface{}{
+			"email":     map[string]interface{}{"readCapacity": 1, "writeCapacity": 1},
+			"createdAt": map[string]interface{}{"readCapacity": 1, "writeCapacity": 1},
+			"tenant":    map[string]interface{}{"readCapacity": 1, "writeCapacity": 1, "rangeKey": "age", "rangeKeyType": "N"},
+		},
+	})
+	if len(keys) != 3 || keys[0].index != "" || keys[1].index != "email-index" || keys[2].index != "tenant-index" || keys[2].rangeKey != "age" {
+		t.Fatal("Invalid index keys. Got: ", keys)
+	}
+
+	tests := []struct {
+		filter     Filter
+		index      string
+		expression string
+		rest       int
+	}{
+		{NewFilter().Match("user", "john"), "", "$ = ?", 0},
+		{NewFilter().Match("user", "john").Match("status", "active"), "", "$ = ?", 1},
+		{NewFilter().Match("user", "john").MatchGte("createdAt", "2020").MatchLte("createdAt", "2021"), "", "$ = ? AND $ BETWEEN ? AND ?", 0},
+		{NewFilter().Match("user", "john").MatchGt("createdAt", "2020"), "", "$ = ? AND $ > ?", 0},
+		{NewFilter().Match("email", "john@example.com"), "email-index", "$ = ?", 0},
+		{NewFilter().Match("tenant", "acme").Match("age", 30), "tenant-index", "$ = ? AND $ = ?", 0},
+		// a range that is not a key condition, or a key of another type
+		{NewFilter().Match("user", "john").MatchGt("createdAt", "2020").MatchLt("createdAt", "2021"), "none", "", 0},
+		{NewFilter().Match("tenant", "acme").Match("age", "30"), "none", "", 0},
+		{NewFilter().MatchIn("user", []string{"john", "jane"}), "none", "", 0},
+		{NewFilter().Match("user", ""), "none", "", 0},
+	}
+	for _, test := range tests {
+		ast, err := ParseFilter(test.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		index := "none"
+		var key *DynamoQuery
+		var rest *FilterAST
+		for _, indexKey := range keys {
+			var ok bool
+			if key, rest, ok = dynamoKeyCondition(ast, indexKey); ok {
+				index = indexKey.index
+				break
+			}
+		}
+		if index != test.index || (key != nil && (key.Expression != test.expression || len(rest.Conditions) != test.rest)) {
+			t.Fatalf("Invalid key condition of %v. Got index %q, key %v and rest %v", test.filter, index, key, rest)
+		}
+	}
+}
+
+func TestDynamoEncryption(t *testing.T) {
+	client := newFakeDynamoDB()
+	backend := NewDynamoBackend(&config.DBInfo{DatabaseName: "test"}, client)
+	backend.SetEncryption("AWS_MANAGED")
+	key := "arn:aws:kms:us-east-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+	for name, encryption := range map[string]string{"users": "", "tokens": key, "logs": "AWS_OWNED"} {
+		definition := RepositoryDefinitionMap{"name": name, "hashKey": "id", "readCapacity": 5, "writeCapacity": 5}
+		if encryption != "" {
+			definition["encryption"] = encryption
+		}
+		if _, err := backend.DefineRepository(name, definition); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	specifications := map[string]*types.SSESpecification{}
+	for _, created := range client.created {
+		specifications[aws.ToString(created.TableName)] = created.SSESpecification
+	}
+	// the tables without encryption are encrypted with the default encryption of the backend
+	if sse := specifications["users"]; sse == nil || !aws.ToBool(sse.Enabled) || sse.SSEType != types.SSETypeKms || sse.KMSMasterKeyId != nil {
+		t.Fatal("Expected the AWS managed KMS key. Got: ", sse)
+	}
+	if sse := specifications["tokens"]; sse == nil || sse.SSEType != types.SSETypeKms || aws.ToString(sse.KMSMasterKeyId) != key {
+		t.Fatal("Expected the customer managed KMS key. Got: ", sse)
+	}
+	if sse := specifications["logs"]; sse != nil {
+		t.Fatal("Expected the key owned by DynamoDB. Got: ", sse)
+	}
+}
+
+func TestDynamoAWSConfig(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", dir+"/config")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", dir+"/credentials")
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+
+	if _, err := newAWSConfig(&config.DBInfo{AWSSecretKeyID: "key"}); err == nil {
+		t.Fatal("Expected an error for the static credentials without the secret key")
+	}
+	if _, err := newAWSConfig(&config.DBInfo{}); err == nil {
+		t.Fatal("Expected an error without a region")
+	}
+
+	// the region and the credentials are taken from the default credential chain
+	t.Setenv("AWS_REGION", "eu-west-1")
+	configAWS, err := newAWSConfig(&config.DBInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configAWS.Region != "eu-west-1" || configAWS.Credentials == nil {
+		t.Fatal("Expected the region and the credentials of the default chain. Got: ", configAWS.Region, configAWS.Credentials)
+	}
+
+	// the role is assumed with the credentials of the chain
+	t.Setenv("DYNAMO_ROLE_ARN", "arn:aws:iam::123456789012:role/backends")
+	t.Setenv("DYNAMO_EXTERNAL_ID", "external")
+	configAWS, err = newAWSConfig(&config.DBInfo{AWSRegion: "us-east-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache, ok := configAWS.Credentials.(*aws.CredentialsCache)
+	if configAWS.Region != "us-east-1" || !ok || !cache.IsCredentialsProvider(&stscreds.AssumeRoleProvider{}) {
+		t.Fatal("Expected the credentials of the assumed role. Got: ", configAWS.Credentials)
+	}
+}
+
+// fakeDynamoHTTP throttles the first requests, then returns the item.
+type fakeDynamoHTTP struct {
+	throttled int
+	requests  int
+}
+
+func (f *fakeDynamoHTTP) Do(req *http.Request) (*http.Response, error) {
+	f.requests++
+	status, body := http.StatusOK, `{"Item":{"id":{"S":"1"}}}`
+	if f.requests <= f.throttled {
+		status, body = http.StatusBadRequest, `{"__type":"com.amazonaws.dynamodb.v20120810#ProvisionedThroughputExceededException","message":"throttled"}`
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": []string{"application/x-amz-json-1.0"}},
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+func TestDynamoRetryer(t *testing.T) {
+	newClient := func(httpClient *fakeDynamoHTTP, options *DynamoRetryOptions) *dynamodb.Client {
+		return dynamodb.New(dynamodb.Options{
+			Region:       "us-east-1",
+			BaseEndpoint: aws.String("http://dynamo.test"),
+			Credentials:  credentials.NewStaticCredentialsProvider("key", "secret", ""),
+			HTTPClient:   httpClient,
+			Retryer:      NewDynamoRetryer(options),
+		})
+	}
+	input := &dynamodb.GetItemInput{TableName: aws.String("users"), Key: map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: "1"}}}
+
+	// the throttled requests are retried
+	httpClient := &fakeDynamoHTTP{throttled: 4}
+	output, err := newClient(httpClient, &DynamoRetryOptions{MaxAttempts: 5, Backoff: time.Millisecond}).GetItem(context.Background(), input)
+	if err != nil || httpClient.requests != 5 || len(output.Item) == 0 {
+		t.Fatal("Expected the item after 4 retries. Got: ", httpClient.requests, err)
+	}
+
+	// the request fails with the throttling error after the last attempt
+	httpClient = &fakeDynamoHTTP{throttled: 5}
+	if _, err := newClient(httpClient, &DynamoRetryOptions{MaxAttempts: 3, Backoff: time.Millisecond}).GetItem(context.Background(), input); !IsThrottlingErr(err) || httpClient.requests != 3 {
+		t.Fatal("Expected the throttling error after 3 attempts. Got: ", httpClient.requests, err)
+	}
+
+	// the backoff is doubled up to the maximal backoff
+	backoff := &dynamoBackoff{options: dynamoRetryDefaults(&DynamoRetryOptions{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second, Jitter: -1})}
+	delays := []time.Duration{}
+	for attempt := 1; attempt <= 6; attempt++ {
+		delay, _ := backoff.BackoffDelay(attempt, nil)
+		delays = append(delays, delay)
+	}
+	if !reflect.DeepEqual(delays, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}) {
+		t.Fatal("Invalid backoff. Got: ", delays)
+	}
+	backoff.options.Jitter = 0.5
+	if delay, _ := backoff.BackoffDelay(1, nil); delay <= 50*time.Millisecond || delay > 100*time.Millisecond {
+		t.Fatal("Expected the backoff with jitter between 50 and 100 milliseconds. Got: ", delay)
+	}
+
+	t.Setenv("DYNAMO_MAX_ATTEMPTS", "4")
+	t.Setenv("DYNAMO_RETRY_BACKOFF", "20ms")
+	if options, err := dynamoRetryOptions(url.Values{}); err != nil || options.MaxAttempts != 4 || options.Backoff != 20*time.Millisecond {
+		t.Fatal("Expected the retry options of the environment. Got: ", options, err)
+	}
+	// the options of the endpoint override the environment
+	_, endpointOptions, err := dynamoEndpoint(&config.DBInfo{AWSEndpoint: "http://dynamo:8000?maxAttempts=6&retryMaxBackoff=5s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options, err := dynamoRetryOptions(endpointOptions); err != nil || options.MaxAttempts != 6 || options.Backoff != 20*time.Millisecond || options.MaxBackoff != 5*time.Second {
+		t.Fatal("Expected the retry options of the endpoint. Got: ", options, err)
+	}
+	t.Setenv("DYNAMO_RETRY_MAX_BACKOFF", "never")
+	if _, err := dynamoRetryOptions(url.Values{}); err == nil {
+		t.Fatal("Expected an error for the invalid maximal backoff")
+	}
+}
+
+func TestDynamoEndpoint(t *testing.T) {
+	endpoint, options, err := dynamoEndpoint(&config.DBInfo{AWSEndpoint: "http://dynamo:8000?dax=dax://cluster:8111&encryption=AWS_MANAGED"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if endpoint != "http://dynamo:8000" || options.Get("dax") != "dax://cluster:8111" || options.Get("encryption") != "AWS_MANAGED" {
+		t.Fatal("Expected the endpoint without the options. Got: ", endpoint, options)
+	}
+
+	// only the options, with the default endpoint of the region
+	t.Setenv("DYNAMO_ENCRYPTION", "alias/backends")
+	t.Setenv("DYNAMO_RECONCILE", "apply")
+	endpoint, options, err = dynamoEndpoint(&config.DBInfo{AWSEndpoint: "?reconcile=dry-run"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if endpoint != "" || dynamoOption(options, "reconcile", "DYNAMO_RECONCILE") != "dry-run" {
+		t.Fatal("Expected the option of the endpoint. Got: ", endpoint, options)
+	}
+	if encryption := dynamoOption(options, "encryption", "DYNAMO_ENCRYPTION"); encryption != "alias/backends" {
+		t.Fatal("Expected the environment variable for the option that is not set. Got: ", encryption)
+	}
+
+	if _, _, err := dynamoEndpoint(&config.DBInfo{AWSEndpoint: "http://dynamo:8000?encryption=%zz"}); err == nil {
+		t.Fatal("Expected an error for the invalid options")
+	}
+}
+
+func TestDynamoReconcileTable(t *testing.T) {
+	client := newFakeDynamoDB()
+	backend := NewDynamoBackend(&config.DBInfo{DatabaseName: "test"}, client)
+	definition := RepositoryDefinitionMap{
+		"name":          "users",
+		"hashKey":       "id",
+		"readCapacity":  5,
+		"writeCapacity": 5,
+		"enableTtl":     true,
+		"ttlAttribute":  "expiresAt",
+		"ttl":           60,
+		"GSI": map[string]interface{}{
+			"email": map[string]interface{}{"readCapacity": 1, "writeCapacity": 1},
+		},
+	}
+	if _, err := backend.DefineRepository("users", definition); err != nil {
+		t.Fatal(err)
+	}
+
+	// the definition is changed: the capacities, a new GSI and no TTL
+	changed := RepositoryDefinitionMap{
+		"name":          "users",
+		"hashKey":       "id",
+		"readCapacity":  10,
+		"writeCapacity": 5,
+		"GSI": map[string]interface{}{
+			"email":   map[string]interface{}{"readCapacity": 2, "writeCapacity": 2},
+			"country": map[string]interface{}{"readCapacity": 1, "writeCapacity": 1, "rangeKey": "createdAt", "rangeKeyType": "N"},
+		},
+	}
+	descriptions := func(changes []*DynamoTableChange) []string {
+		result := []string{}
+		for _, change := range changes {
+			result = append(result, change.Description)
+		}
+		return result
+	}
+	expected := []string{"read/write capacity 5/5 -> 10/5", "missing GSI country-index", "GSI email-index read/write capacity 1/1 -> 2/2", "disable TTL on expiresAt"}
+
+	// the dry run only reports the changes
+	changes, err := ReconcileTable(client, changed, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(descriptions(changes), expected) || len(client.updates) != 0 {
+		t.Fatal("Expected the changes to be reported only. Got: ", descriptions(changes), len(client.updates))
+	}
+
+	// the changes are applied one by one when the service is restarted
+	backend = NewDynamoBackend(&config.DBInfo{DatabaseName: "test"}, client)
+	backend.SetReconcile(DynamoReconcileApply)
+	if _, err := backend.DefineRepository("users", changed); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.updates) != 3 || aws.ToBool(client.ttl["users"].Enabled) {
+		t.Fatal("Expected 3 updates of the table and the TTL disabled. Got: ", len(client.updates), client.ttl["users"])
+	}
+	create := client.updates[1].GlobalSecondaryIndexUpdates[0].Create
+	if create == nil || aws.ToString(create.IndexName) != "country-index" || len(create.KeySchema) != 2 || len(client.updates[1].AttributeDefinitions) != 4 {
+		t.Fatal("Expected the country GSI to be created with its keys. Got: ", create, client.updates[1].AttributeDefinitions)
+	}
+	if changes, err := ReconcileTable(client, changed, true); err != nil || len(changes) != 0 {
+		t.Fatal("Expected the table to match the definition. Got: ", descriptions(changes), err)
+	}
+
+	// the GSIs that are not defined are not deleted
+	delete(changed["GSI"].(map[string]interface{}), "country")
+	if changes, err := ReconcileTable(client, changed, false); err != nil || !reflect.DeepEqual(descriptions(changes), []string{"GSI country-index is not defined"}) || !changes[0].Manual {
+		t.Fatal("Expected a manual change for the GSI that is not defined. Got: ", descriptions(changes), err)
+	}
+}
+
+func TestDynamoTTLExpired(t *testing.T) {
+	client := newFakeDynamoDB()
+	now := time.Now()
+	// the items expired 10 minutes ago, 30 seconds ago and the one that expires in an hour
+	for id, expiresAt := range map[string]time.Time{"1": now.Add(-10 * time.Minute), "2": now.Add(-30 * time.Second), "3": now.Add(time.Hour)} {
+		item, err := marshalDynamoItem(map[string]interface{}{"id": id, "expiresAt": expiresAt})
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.items[id] = item
+	}
+
+	for _, test := range []struct {
+		expired     string
+		gracePeriod int
+		count       int64
+	}{
+		{"", 0, 1},
+		{TTLExpiredExclude, 60, 2},
+		{TTLExpiredInclude, 0, 3},
+	} {
+		backend := NewDynamoBackend(&config.DBInfo{DatabaseName: "test"}, client)
+		repo, err := backend.DefineRepository("sessions", RepositoryDefinitionMap{
+			"name":           "sessions",
+			"hashKey":        "id",
+			"readCapacity":   5,
+			"writeCapacity":  5,
+			"enableTtl":      true,
+			"ttlAttribute":   "expiresAt",
+			"ttl":            3600,
+			"ttlExpired":     test.expired,
+			"ttlGracePeriod": test.gracePeriod,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count, err := repo.Count(nil); err != nil || count != test.count {
+			t.Fatalf("Expected %d items with %q expired and %d seconds grace period. Got %d, %v", test.count, test.expired, test.gracePeriod, count, err)
+		}
+		results, err := repo.(*DynamoCollection).GetManyByIDs([]string{"1", "2", "3"}, &map[string]interface{}{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fetched := reflect.Indirect(reflect.ValueOf(results)).Len(); int64(fetched) != test.count {
+			t.Fatalf("Expected %d items fetched by the ids with %q expired. Got %d", test.count, test.expired, fetched)
+		}
+	}
+
+	backend := NewDynamoBackend(&config.DBInfo{DatabaseName: "test"}, client)
+	if _, err := backend.DefineRepository("sessions", RepositoryDefinitionMap{"name": "sessions", "hashKey": "id", "ttlExpired": "hide"}); err == nil {
+		t.Fatal("Expected an error for the unknown handling of the expired items")
+	}
+}
+
+func TestDynamoPointInTimeRecovery(t *testing.T) {
+	client := newFakeDynamoDB()
+	backend := NewDynamoBackend(&config.DBInfo{DatabaseName: "test"}, client)
+	for name, enabled := range map[string]bool{"users": true, "logs": false} {
+		definition := RepositoryDefinitionMap{"name": name, "hashKey": "id", "readCapacity": 5, "writeCapacity": 5, "pointInTimeRecovery": enabled}
+		if _, err := backend.DefineRepository(name, definition); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(client.backups, []string{"users"}) {
+		t.Fatal("Expected point-in-time recovery of users only. Got: ", client.backups)
+	}
+}
+
+func TestDynamoCreateTableGSI(t *testing.T) {
+	client := newFakeDynamoDB()
+	err := createTable(client, RepositoryDefinitionMap{
+		"name":          "sessions",
+		"hashKey":       "id",
+		"readCapacity":  5,
+		"writeCapacity": 5,
+		"GSI": map[string]interface{}{
+			"user": map[string]interface{}{"readCapacity": 1, "writeCapacity": 1, "rangeKey": "createdAt"},
+			"id":   map[string]interface{}{"readCapacity": 1, "writeCapacity": 1},
+		},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := client.created[0]
+	if len(input.AttributeDefinitions) != 3 || len(input.GlobalSecondaryIndexes) != 2 {
+		t.Fatal("Expected the attributes of the keys and 2 GSIs. Got: ", input)
+	}
+	gsi := input.GlobalSecondaryIndexes[1]
+	if aws.ToString(gsi.IndexName) != "user-index" || len(gsi.KeySchema) != 2 ||
+		aws.ToString(gsi.KeySchema[0].AttributeName) != "user" || gsi.KeySchema[0].KeyType != types.KeyTypeHash ||
+		aws.ToString(gsi.KeySchema[1].AttributeName) != "createdAt" || gsi.KeySchema[1].KeyType != types.KeyTypeRange {
+		t.Fatal("Invalid GSI. Got: ", gsi)
+	}
+}
+
+func TestDynamoGetManyByIDs(t *testing.T) {
+	client := newFakeDynamoDB()
+	repo := newFakeDynamoCollection(t, client)
+	if _, ok := repo.(BatchGetRepository); !ok {
+		t.Fatal("Expected the records to be fetched with BatchGetItem")
+	}
+
+	records := []map[string]interface{}{}
+	ids := []string{}
+	for i := 0; i < 250; i++ {
+		id := fmt.Sprintf("user-%03d", i)
+		records = append(records, map[string]interface{}{"id": id, "index": i})
+		if i%2 == 0 {
+			ids = append([]string{id}, ids...)
+		}
+	}
+	if _, err := repo.SaveAll(records); err != nil {
+		t.Fatal(err)
+	}
+	ids = append(ids, "missing", ids[0])
+
+	client.batches = 0
+	results, err := GetManyByIDs(repo, ids, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := *results.(*[]*map[string]interface{})
+	if len(users) != 125 || (*users[0])["id"] != "user-248" || (*users[124])["id"] != "user-000" {
+		t.Fatal("Expected the users in the order of the ids, without the missing and the duplicated. Got: ", len(users))
+	}
+	if client.batches != 4 {
+		t.Fatal("Expected a request for every 100 keys, and the retries of the unprocessed keys. Got: ", client.batches)
+	}
+}
+
+func TestDynamoGetManyByKeys(t *testing.T) {
+	client := newFakeDynamoDB()
+	ctx := context.WithValue(context.Background(), DYNAMO_CTX_KEY, client)
+	backend := NewRepositoriesBackend(ctx, &config.DBInfo{DatabaseName: "test"}, DynamoDBRepoBuilder, func() {})
+	repo, err := backend.DefineRepository("sessions", RepositoryDefinitionMap{
+		"name":          "sessions",
+		"hashKey":       "id",
+		"rangeKey":      "createdAt",
+		"readCapacity":  5,
+		"writeCapacity": 5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.SaveAll([]map[string]interface{}{
+		{"id": "a", "createdAt": "2019-01-02T15:04:05Z"},
+		{"id": "b", "createdAt": "2019-01-03T15:04:05Z"},
+		{"id": "c", "createdAt": "2019-01-04T15:04:05Z"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions := repo.(*DynamoCollection)
+
+	if _, err := GetManyByIDs(sessions, []string{"a"}, nil); err == nil || !IsErrorOfType(err, ErrNotSupported("")) {
+		t.Fatal("Expected not supported error for the hash key only. Got: ", err)
+	}
+
+	results, err := sessions.GetManyByKeys([]Filter{
+		NewFilter().Match("id", "c").Match("createdAt", "2019-01-04T16:04:05+01:00"),
+		NewFilter().Match("id", "x").Match("createdAt", "2019-01-04T15:04:05Z"),
+		NewFilter().Match("id", "a").Match("createdAt", "2019-01-02T15:04:05Z"),
+		NewFilter().Match("id", "c").Match("createdAt", "2019-01-04T15:04:05Z"),
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := *results.(*[]*map[string]interface{})
+	if len(found) != 2 || (*found[0])["id"] != "c" || (*found[1])["id"] != "a" {
+		t.Fatal("Expected the items in the order of the keys, without the missing and the duplicated. Got: ", found)
+	}
+
+	if _, err := sessions.GetManyByKeys([]Filter{NewFilter().Match("id", "a")}, nil); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input error for an incomplete key. Got: ", err)
+	}
+}
+
+func TestDynamoChildren(t *testing.T) {
+	client := newFakeDynamoDB()
+	repo := newFakeDynamoCollection(t, client)
+	if _, ok := repo.(ChildrenRepository); !ok {
+		t.Fatal("Expected the children to be modified natively")
+	}
+
+	if _, err := repo.Save(&map[string]interface{}{"id": "john"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	user := NewFilter().Match("id", "john")
+	addresses := Children(repo, "addresses")
+
+	for _, city := range []string{"Skopje", "Bitola", "Ohrid"} {
+		if _, err := addresses.Add(user, map[string]interface{}{"id": city, "city": city}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := addresses.Add(user, map[string]interface{}{"id": "Ohrid"}); err == nil || !IsErrAlreadyExists(err) {
+		t.Fatal("Expected already exists error for the duplicate child id. Got: ", err)
+	}
+
+	updated, err := addresses.Update(user, "Bitola", map[string]interface{}{"zip": "7000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated["city"] != "Bitola" || updated["zip"] != "7000" {
+		t.Fatal("Expected the address to be updated. Got: ", updated)
+	}
+
+	if err := addresses.Remove(user, "Skopje"); err != nil {
+		t.Fatal(err)
+	}
+	if err := addresses.Remove(user, "Skopje"); err == nil || !IsErrNotFound(err) {
+		t.Fatal("Expected not found error for the removed child. Got: ", err)
+	}
+
+	list, err := addresses.List(user, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := *list.(*[]*map[string]interface{})
+	if len(results) != 2 || (*results[0])["id"] != "Bitola" || (*results[0])["zip"] != "7000" || (*results[1])["id"] != "Ohrid" {
+		t.Fatal("Invalid addresses: ", results)
+	}
+
+	if err := addresses.Remove(NewFilter().Match("id", "jane"), "Ohrid"); err == nil || !IsErrNotFound(err) {
+		t.Fatal("Expected not found error for the missing parent. Got: ", err)
+	}
+}
+
+func TestDynamoExpressions(t *testing.T) {
+	expressions := newDynamoExpressions()
+
+	update, err := expressions.add(&DynamoQuery{Expression: "$ = ?, $ = ?", Args: []interface{}{"status", "active", "count", 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	condition, err := expressions.add(&DynamoQuery{Expression: "attribute_exists($)", Args: []interface{}{"id"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if update != "#n0 = :v1, #n2 = :v3" || condition != "attribute_exists(#n4)" {
+		t.Fatal("Invalid expressions. Got: ", update, condition)
+	}
+	if !reflect.DeepEqual(expressions.attributeNames(), map[string]string{"#n0": "status", "#n2": "count", "#n4": "id"}) {
+		t.Fatal("Invalid attribute names. Got: ", expressions.attributeNames())
+	}
+	if expressions.attributeValues()[":v3"].(*types.AttributeValueMemberN).Value != "2" {
+		t.Fatal("Invalid attribute values. Got: ", expressions.attributeValues())
+	}
+
+	if _, err := newDynamoExpressions().add(&DynamoQuery{Expression: "$ = ?", Args: []interface{}{"status"}}); err == nil {
+		t.Fatal("Expected error for missing argument")
+	}
+	if newDynamoExpressions().attributeValues() != nil {
+		t.Fatal("Expected no attribute values")
+	}
+}
+
+func TestDynamoValues(t *testing.T) {
+	record := map[string]interface{}{
+		"name":    "John",
+		"age":     42.5,
+		"admin":   true,
+		"deleted": nil,
+		"roles":   []interface{}{"user", "admin"},
+		"address": map[string]interface{}{"city": "Skopje"},
+	}
+
+	item, err := marshalDynamoItem(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item["age"].(*types.AttributeValueMemberN).Value != "42.5" {
+		t.Fatal("Invalid number. Got: ", item["age"])
+	}
+	if decoded := unmarshalDynamoItem(item); !reflect.DeepEqual(decoded, record) {
+		t.Fatal("Expected", record, "got", decoded)
+	}
+
+	if value := fromDynamoValue(&types.AttributeValueMemberSS{Value: []string{"a"}}); !reflect.DeepEqual(value, []interface{}{"a"}) {
+		t.Fatal("Expected sets to be decoded as lists. Got: ", value)
+	}
+	if value := fromDynamoValue(&types.AttributeValueMemberB{Value: []byte("hi")}); value != "aGk=" {
+		t.Fatal("Expected binary values to be decoded as base64. Got: ", value)
+	}
+}
+
+func TestDynamoDefinition(t *testing.T) {
+	def := RepositoryDefinitionMap{
+		"name":         "users",
+		"LSI":          map[string]interface{}{"score": map[string]interface{}{"type": "N"}},
+		"enableStream": true,
+	}
+	if lsi := dynamoDefinition(def).GetLSI(); len(lsi) != 1 || !dynamoDefinition(def).EnableStream() {
+		t.Fatal("Expected the DynamoDB settings of the definition map. Got: ", lsi)
+	}
+
+	// the definitions that don't implement DynamoDefinition have no DynamoDB settings
+	plain := struct{ RepositoryDefinition }{def}
+	if dynamoDefinition(plain).GetLSI() != nil || dynamoDefinition(plain).EnableStream() || dynamoDefinition(plain).GetEncryption() != "" {
+		t.Fatal("Expected no DynamoDB settings")
+	}
+}
@@ -0,0 +1,610 @@
+package backends
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var (
+	dynamoTimeType      = reflect.TypeOf(time.Time{})
+	dynamoNumberType    = reflect.TypeOf(json.Number(""))
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// dynamoField is a field of a struct stored as a DynamoDB attribute.
+type dynamoField struct {
+	index     []int
+	name      string
+	omitEmpty bool
+	// set is "stringset", "numberset" or "binaryset" for the slices stored as DynamoDB sets.
+	set string
+}
+
+// dynamoSetValue is a value of a field stored as a DynamoDB set.
+type dynamoSetValue struct {
+	value reflect.Value
+	set   string
+}
+
+// dynamoFields returns the fields of the struct type stored as attributes. The name and the options of a field are
+// taken from its dynamodbav or dynamo tag, otherwise from its json tag, like encoding/json: the embedded structs
+// without a name are flattened, the fields tagged "-" are skipped. The fields of a saved record (top) are named
+// like InterfaceToMap names them instead: by the bson or json tag, otherwise the lowercase field name.
+func dynamoFields(t reflect.Type, top bool) []dynamoField {
+	fields := []dynamoField{}
+	for i := 0; i < t.NumField(); i++ {
+		structField := t.Field(i)
+		if structField.PkgPath != "" && !structField.Anonymous {
+			continue
+		}
+
+		field := dynamoField{index: []int{i}}
+		tagged := false
+		tags := []string{"dynamodbav", "dynamo", "json"}
+		if top {
+			tags = []string{"dynamodbav", "dynamo", "bson", "json"}
+		}
+		for _, key := range tags {
+			tag, ok := structField.Tag.Lookup(key)
+			if !ok {
+				continue
+			}
+			if tag == "-" {
+				field.name = "-"
+				break
+			}
+			parts := strings.Split(tag, ",")
+			field.name = parts[0]
+			tagged = field.name != ""
+			for _, option := range parts[1:] {
+				switch {
+				case option == "omitempty":
+					field.omitEmpty = true
+				case key == "dynamodbav" || key == "dynamo":
+					if option == "stringset" || option == "numberset" || option == "binaryset" {
+						field.set = option
+					}
+				}
+			}
+			break
+		}
+		if field.name == "-" {
+			continue
+		}
+
+		fieldType := structField.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if structField.Anonymous && !tagged && !top && fieldType.Kind() == reflect.Struct {
+			for _, embedded := range dynamoFields(fieldType, false) {
+				embedded.index = append([]int{i}, embedded.index...)
+				fields = append(fields, embedded)
+			}
+			continue
+		}
+		if structField.PkgPath != "" {
+			continue
+		}
+		if !tagged {
+			field.name = structField.Name
+			if top {
+				field.name = strings.ToLower(structField.Name)
+			}
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// dynamoFieldValue returns the value of the field of the struct, and false if it is in a nil embedded struct.
+func dynamoFieldValue(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, fieldIndex := range index {
+		if i > 0 {
+			if v.Kind() == reflect.Ptr {
+				if v.IsNil() {
+					return reflect.Value{}, false
+				}
+				v = v.Elem()
+			}
+		}
+		v = v.Field(fieldIndex)
+	}
+	return v, true
+}
+
+// dynamoRecord converts the object (a pointer to a struct or to a map) to the record that is saved. The values of
+// the fields of a struct are kept as they are, so they are stored with their precision by marshalDynamoValue.
+func dynamoRecord(object interface{}) (*map[string]interface{}, error) {
+	v := reflect.ValueOf(object)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return InterfaceToMap(object)
+	}
+	v = v.Elem()
+	record := map[string]interface{}{}
+	for _, field := range dynamoFields(v.Type(), true) {
+		value, ok := dynamoFieldValue(v, field.index)
+		if !ok || (field.omitEmpty && isEmptyDynamoValue(value)) {
+			continue
+		}
+		if field.set != "" {
+			// DynamoDB does not store empty sets.
+			if isEmptyDynamoValue(value) {
+				continue
+			}
+			record[field.name] = &dynamoSetValue{value: value, set: field.set}
+			continue
+		}
+		record[field.name] = value.Interface()
+	}
+	return &record, nil
+}
+
+// MarshalDynamoItem converts the object (a pointer to a struct or to a map) to the DynamoDB item that Save stores.
+// The numbers keep their precision (an int64 is stored exactly), []byte is stored as binary, and the slices of a
+// struct field tagged with the stringset, numberset or binaryset option are stored as sets:
+//
+//	type Device struct {
+//		ID      string   `json:"id"`
+//		Serial  uint64   `json:"serial"`
+//		Tags    []string `json:"tags" dynamodbav:"tags,stringset"`
+//		Key     []byte   `dynamo:"key"`
+//		Comment string   `dynamodbav:"comment,omitempty"`
+//	}
+//
+// The fields are named by their dynamodbav or dynamo tags, otherwise like InterfaceToMap names them. The values whose
+// type implements json.Marshaler are stored as they are encoded to JSON, the dates as strings in TimeLayout.
+func MarshalDynamoItem(object interface{}) (map[string]types.AttributeValue, error) {
+	record, err := dynamoRecord(object)
+	if err != nil {
+		return nil, err
+	}
+	return marshalDynamoItem(*record)
+}
+
+// UnmarshalDynamoItem decodes the DynamoDB item into the result (a pointer to a struct, a map or an interface{}).
+// The numbers are decoded into the integer fields exactly, the sets into slices and the binary values into []byte.
+// The fields are matched by the names of MarshalDynamoItem, or by the field names case-insensitively like
+// encoding/json. The values that can not be decoded directly (for example into a type that implements
+// json.Unmarshaler) are decoded as from JSON.
+func UnmarshalDynamoItem(item map[string]types.AttributeValue, result interface{}) error {
+	v := reflect.ValueOf(result)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return ErrInvalidInput("result should be a non-nil pointer")
+	}
+	return decodeDynamoValue(&types.AttributeValueMemberM{Value: item}, v.Elem())
+}
+
+// encodeDynamoValue converts the value to a DynamoDB attribute value.
+func encodeDynamoValue(v reflect.Value) (types.AttributeValue, error) {
+	if !v.IsValid() {
+		return &types.AttributeValueMemberNULL{Value: true}, nil
+	}
+	if v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return &types.AttributeValueMemberNULL{Value: true}, nil
+		}
+		if set, ok := v.Interface().(*dynamoSetValue); ok {
+			return encodeDynamoSet(set)
+		}
+		return encodeDynamoValue(v.Elem())
+	}
+
+	switch {
+	case v.Type() == dynamoTimeType:
+		return &types.AttributeValueMemberS{Value: formatTime(v.Interface().(time.Time))}, nil
+	case v.Type() == dynamoNumberType:
+		if _, err := strconv.ParseFloat(v.String(), 64); err != nil {
+			return nil, ErrInvalidInput(fmt.Sprintf("invalid number %q", v.String()))
+		}
+		return &types.AttributeValueMemberN{Value: v.String()}, nil
+	case v.Type().Implements(jsonMarshalerType):
+		normalized, err := normalizeValue(v.Interface())
+		if err != nil {
+			return nil, ErrInvalidInput(err)
+		}
+		return toDynamoValue(canonicalTimes(normalized)), nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return toDynamoValue(canonicalTimes(v.String())), nil
+	case reflect.Bool:
+		return &types.AttributeValueMemberBOOL{Value: v.Bool()}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &types.AttributeValueMemberN{Value: strconv.FormatInt(v.Int(), 10)}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &types.AttributeValueMemberN{Value: strconv.FormatUint(v.Uint(), 10)}, nil
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, ErrInvalidInput(fmt.Sprintf("unsupported number %v", f))
+		}
+		bits := 64
+		if v.Kind() == reflect.Float32 {
+			bits = 32
+		}
+		return &types.AttributeValueMemberN{Value: strconv.FormatFloat(f, 'f', -1, bits)}, nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return &types.AttributeValueMemberNULL{Value: true}, nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return &types.AttributeValueMemberB{Value: append([]byte{}, v.Bytes()...)}, nil
+		}
+		return encodeDynamoList(v)
+	case reflect.Array:
+		return encodeDynamoList(v)
+	case reflect.Map:
+		if v.IsNil() {
+			return &types.AttributeValueMemberNULL{Value: true}, nil
+		}
+		m := make(map[string]types.AttributeValue, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := dynamoMapKey(iter.Key())
+			if err != nil {
+				return nil, err
+			}
+			attribute, err := encodeDynamoValue(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			if attribute != nil {
+				m[key] = attribute
+			}
+		}
+		return &types.AttributeValueMemberM{Value: m}, nil
+	case reflect.Struct:
+		m := map[string]types.AttributeValue{}
+		for _, field := range dynamoFields(v.Type(), false) {
+			value, ok := dynamoFieldValue(v, field.index)
+			if !ok || (field.omitEmpty && isEmptyDynamoValue(value)) {
+				continue
+			}
+			var attribute types.AttributeValue
+			var err error
+			if field.set != "" {
+				attribute, err = encodeDynamoSet(&dynamoSetValue{value: value, set: field.set})
+			} else {
+				attribute, err = encodeDynamoValue(value)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if attribute != nil {
+				m[field.name] = attribute
+			}
+		}
+		return &types.AttributeValueMemberM{Value: m}, nil
+	}
+	return nil, ErrInvalidInput(fmt.Sprintf("unsupported type %s", v.Type()))
+}
+
+// encodeDynamoList converts the slice or the array to a DynamoDB list.
+func encodeDynamoList(v reflect.Value) (types.AttributeValue, error) {
+	list := make([]types.AttributeValue, v.Len())
+	for i := range list {
+		item, err := encodeDynamoValue(v.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		list[i] = item
+	}
+	return &types.AttributeValueMemberL{Value: list}, nil
+}
+
+// encodeDynamoSet converts the slice of the field to a DynamoDB set. Returns nil for an empty slice, as DynamoDB
+// does not store empty sets.
+func encodeDynamoSet(set *dynamoSetValue) (types.AttributeValue, error) {
+	v := set.value
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, ErrInvalidInput(fmt.Sprintf("%s of type %s, must be a slice", set.set, v.Type()))
+	}
+	if v.Len() == 0 {
+		return nil, nil
+	}
+
+	strs := []string{}
+	binaries := [][]byte{}
+	for i := 0; i < v.Len(); i++ {
+		item, err := encodeDynamoValue(v.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		switch value := item.(type) {
+		case *types.AttributeValueMemberS:
+			if set.set == "stringset" {
+				strs = append(strs, value.Value)
+				continue
+			}
+		case *types.AttributeValueMemberN:
+			if set.set == "numberset" {
+				strs = append(strs, value.Value)
+				continue
+			}
+		case *types.AttributeValueMemberB:
+			if set.set == "binaryset" {
+				binaries = append(binaries, value.Value)
+				continue
+			}
+		}
+		return nil, ErrInvalidInput(fmt.Sprintf("%s of type %s", set.set, v.Type()))
+	}
+	switch set.set {
+	case "stringset":
+		return &types.AttributeValueMemberSS{Value: strs}, nil
+	case "numberset":
+		return &types.AttributeValueMemberNS{Value: strs}, nil
+	}
+	return &types.AttributeValueMemberBS{Value: binaries}, nil
+}
+
+// dynamoMapKey converts the key of a map to the name of the attribute, like encoding/json.
+func dynamoMapKey(key reflect.Value) (string, error) {
+	switch key.Kind() {
+	case reflect.String:
+		return key.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(key.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(key.Uint(), 10), nil
+	}
+	return "", ErrInvalidInput(fmt.Sprintf("unsupported map key type %s", key.Type()))
+}
+
+// isEmptyDynamoValue reports whether the value is empty for omitempty, like encoding/json.
+func isEmptyDynamoValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// decodeDynamoValue decodes the DynamoDB attribute value into the settable value.
+func decodeDynamoValue(av types.AttributeValue, v reflect.Value) error {
+	if _, ok := av.(*types.AttributeValueMemberNULL); ok {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return decodeDynamoValue(av, v.Elem())
+	}
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		if value := fromDynamoValue(av); value != nil {
+			v.Set(reflect.ValueOf(value))
+		} else {
+			v.Set(reflect.Zero(v.Type()))
+		}
+		return nil
+	}
+	if v.Type() == dynamoTimeType {
+		if s, ok := av.(*types.AttributeValueMemberS); ok {
+			if t, ok := parseTime(s.Value); ok {
+				v.Set(reflect.ValueOf(t))
+				return nil
+			}
+		}
+		return decodeDynamoJSON(av, v)
+	}
+	if v.Type() != dynamoNumberType && reflect.PtrTo(v.Type()).Implements(jsonUnmarshalerType) {
+		return decodeDynamoJSON(av, v)
+	}
+
+	switch value := av.(type) {
+	case *types.AttributeValueMemberS:
+		if v.Kind() == reflect.String && v.Type() != dynamoNumberType {
+			v.SetString(value.Value)
+			return nil
+		}
+	case *types.AttributeValueMemberN:
+		if decodeDynamoNumber(value.Value, v) {
+			return nil
+		}
+	case *types.AttributeValueMemberBOOL:
+		if v.Kind() == reflect.Bool {
+			v.SetBool(value.Value)
+			return nil
+		}
+	case *types.AttributeValueMemberB:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes(append([]byte{}, value.Value...))
+			return nil
+		}
+	case *types.AttributeValueMemberL:
+		return decodeDynamoList(value.Value, v)
+	case *types.AttributeValueMemberSS:
+		return decodeDynamoList(dynamoSetItems(value), v)
+	case *types.AttributeValueMemberNS:
+		return decodeDynamoList(dynamoSetItems(value), v)
+	case *types.AttributeValueMemberBS:
+		return decodeDynamoList(dynamoSetItems(value), v)
+	case *types.AttributeValueMemberM:
+		return decodeDynamoMap(value.Value, v)
+	}
+	return decodeDynamoJSON(av, v)
+}
+
+// decodeDynamoNumber decodes the DynamoDB number into the numeric (or json.Number) value. Returns false if the number
+// does not fit the value.
+func decodeDynamoNumber(number string, v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(number, 10, 64)
+		if err != nil || v.OverflowInt(n) {
+			return false
+		}
+		v.SetInt(n)
+		return true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(number, 10, 64)
+		if err != nil || v.OverflowUint(n) {
+			return false
+		}
+		v.SetUint(n)
+		return true
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(number, v.Type().Bits())
+		if err != nil {
+			return false
+		}
+		v.SetFloat(n)
+		return true
+	case reflect.String:
+		if v.Type() == dynamoNumberType {
+			v.SetString(number)
+			return true
+		}
+	}
+	return false
+}
+
+// dynamoSetItems returns the items of the DynamoDB set as attribute values.
+func dynamoSetItems(set types.AttributeValue) []types.AttributeValue {
+	items := []types.AttributeValue{}
+	switch value := set.(type) {
+	case *types.AttributeValueMemberSS:
+		for _, item := range value.Value {
+			items = append(items, &types.AttributeValueMemberS{Value: item})
+		}
+	case *types.AttributeValueMemberNS:
+		for _, item := range value.Value {
+			items = append(items, &types.AttributeValueMemberN{Value: item})
+		}
+	case *types.AttributeValueMemberBS:
+		for _, item := range value.Value {
+			items = append(items, &types.AttributeValueMemberB{Value: item})
+		}
+	}
+	return items
+}
+
+// decodeDynamoList decodes the items of the DynamoDB list (or set) into the slice or the array.
+func decodeDynamoList(items []types.AttributeValue, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Slice:
+		slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := decodeDynamoValue(item, slice.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if i >= len(items) {
+				v.Index(i).Set(reflect.Zero(v.Type().Elem()))
+				continue
+			}
+			if err := decodeDynamoValue(items[i], v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return decodeDynamoJSON(&types.AttributeValueMemberL{Value: items}, v)
+}
+
+// decodeDynamoMap decodes the DynamoDB map into the struct or the map. The attributes are matched with the fields
+// by their names, or case-insensitively like encoding/json.
+func decodeDynamoMap(item map[string]types.AttributeValue, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Struct:
+		for _, field := range dynamoFields(v.Type(), false) {
+			value, ok := item[field.name]
+			if !ok {
+				for name, attribute := range item {
+					if strings.EqualFold(name, field.name) {
+						value, ok = attribute, true
+						break
+					}
+				}
+			}
+			if !ok {
+				continue
+			}
+			fieldValue, err := dynamoSettableField(v, field.index)
+			if err != nil {
+				return err
+			}
+			if err := decodeDynamoValue(value, fieldValue); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			break
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMapWithSize(v.Type(), len(item)))
+		}
+		for name, attribute := range item {
+			value := reflect.New(v.Type().Elem()).Elem()
+			if err := decodeDynamoValue(attribute, value); err != nil {
+				return err
+			}
+			v.SetMapIndex(reflect.ValueOf(name).Convert(v.Type().Key()), value)
+		}
+		return nil
+	}
+	return decodeDynamoJSON(&types.AttributeValueMemberM{Value: item}, v)
+}
+
+// dynamoSettableField returns the field of the struct, allocating the nil embedded structs on the way.
+func dynamoSettableField(v reflect.Value, index []int) (reflect.Value, error) {
+	for i, fieldIndex := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, ErrInvalidInput(fmt.Sprintf("can not set embedded struct %s", v.Type()))
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(fieldIndex)
+	}
+	return v, nil
+}
+
+// decodeDynamoJSON decodes the attribute value into the value as the JSON of fromDynamoValue, like MapToInterface
+// did before the values were decoded directly. As with MapToInterface, the values that do not match are left as
+// they are.
+func decodeDynamoJSON(av types.AttributeValue, v reflect.Value) error {
+	data, err := json.Marshal(fromDynamoValue(av))
+	if err != nil {
+		return err
+	}
+	json.Unmarshal(data, v.Addr().Interface())
+	return nil
+}
@@ -0,0 +1,146 @@
+package backends
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type dynamoValueAddress struct {
+	City string `json:"city"`
+	Zip  int
+}
+
+type dynamoValueDevice struct {
+	ID       string              `json:"id"`
+	Serial   int64               `json:"serial"`
+	Counter  uint64              `bson:"counter"`
+	Ratio    float64             `json:"ratio"`
+	Tags     []string            `json:"tags" dynamodbav:"tags,stringset"`
+	Ports    []int               `dynamo:"ports,numberset"`
+	Keys     [][]byte            `dynamodbav:"keys,binaryset"`
+	Secret   []byte              `json:"secret"`
+	Comment  string              `dynamodbav:"comment,omitempty"`
+	Address  *dynamoValueAddress `json:"address"`
+	Created  time.Time           `json:"created"`
+	Internal string              `json:"-"`
+	Owner    string
+}
+
+func TestMarshalDynamoItem(t *testing.T) {
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	item, err := MarshalDynamoItem(&dynamoValueDevice{
+		ID:       "1",
+		Serial:   9007199254740993,
+		Counter:  18446744073709551615,
+		Ratio:    0.1,
+		Tags:     []string{"a", "b"},
+		Ports:    []int{80, 443},
+		Keys:     [][]byte{{1, 2}},
+		Secret:   []byte{0, 1, 2},
+		Address:  &dynamoValueAddress{City: "Skopje", Zip: 1000},
+		Created:  created,
+		Internal: "internal",
+		Owner:    "john",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]types.AttributeValue{
+		"id":      &types.AttributeValueMemberS{Value: "1"},
+		"serial":  &types.AttributeValueMemberN{Value: "9007199254740993"},
+		"counter": &types.AttributeValueMemberN{Value: "18446744073709551615"},
+		"ratio":   &types.AttributeValueMemberN{Value: "0.1"},
+		"tags":    &types.AttributeValueMemberSS{Value: []string{"a", "b"}},
+		"ports":   &types.AttributeValueMemberNS{Value: []string{"80", "443"}},
+		"keys":    &types.AttributeValueMemberBS{Value: [][]byte{{1, 2}}},
+		"secret":  &types.AttributeValueMemberB{Value: []byte{0, 1, 2}},
+		"address": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+			"city": &types.AttributeValueMemberS{Value: "Skopje"},
+			"Zip":  &types.AttributeValueMemberN{Value: "1000"},
+		}},
+		"created": &types.AttributeValueMemberS{Value: formatTime(created)},
+		"owner":   &types.AttributeValueMemberS{Value: "john"},
+	}
+	if !reflect.DeepEqual(item, expected) {
+		t.Fatal("Invalid item. Got: ", item)
+	}
+
+	// the empty sets are not stored
+	item, err = MarshalDynamoItem(&dynamoValueDevice{ID: "2", Comment: "note"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := item["tags"]; ok {
+		t.Fatal("Expected the empty set not to be stored. Got: ", item["tags"])
+	}
+	if comment, ok := item["comment"].(*types.AttributeValueMemberS); !ok || comment.Value != "note" {
+		t.Fatal("Expected the comment to be stored. Got: ", item["comment"])
+	}
+}
+
+func TestUnmarshalDynamoItem(t *testing.T) {
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	device := &dynamoValueDevice{
+		ID:      "1",
+		Serial:  -9007199254740993,
+		Counter: 18446744073709551615,
+		Ratio:   0.1,
+		Tags:    []string{"a", "b"},
+		Ports:   []int{80, 443},
+		Keys:    [][]byte{{1, 2}},
+		Secret:  []byte{0, 1, 2},
+		Address: &dynamoValueAddress{City: "Skopje", Zip: 1000},
+		Created: created,
+		Owner:   "john",
+	}
+	item, err := MarshalDynamoItem(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := dynamoValueDevice{}
+	if err := UnmarshalDynamoItem(item, &result); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&result, device) {
+		t.Fatal("Invalid result. Got: ", result)
+	}
+
+	if err := UnmarshalDynamoItem(item, result); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input error for a result that is not a pointer. Got: ", err)
+	}
+}
+
+func TestDynamoNativeValues(t *testing.T) {
+	client := newFakeDynamoDB()
+	repo := newFakeDynamoCollection(t, client)
+
+	device := &dynamoValueDevice{ID: "1", Serial: 9007199254740993, Tags: []string{"a"}, Secret: []byte{0, 1}}
+	if _, err := repo.Save(device, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := client.items["1"]["tags"].(*types.AttributeValueMemberSS); !ok {
+		t.Fatal("Expected the tags to be stored as a string set. Got: ", client.items["1"]["tags"])
+	}
+	if _, ok := client.items["1"]["secret"].(*types.AttributeValueMemberB); !ok {
+		t.Fatal("Expected the secret to be stored as binary. Got: ", client.items["1"]["secret"])
+	}
+
+	// the updates keep the precision and the sets too
+	update := &dynamoValueDevice{ID: "1", Serial: 9007199254740995, Tags: []string{"a", "b"}, Secret: []byte{0, 1}}
+	if _, err := repo.Save(update, NewFilter().Match("id", "1")); err != nil {
+		t.Fatal(err)
+	}
+
+	result := dynamoValueDevice{}
+	if _, err := repo.GetOne(NewFilter().Match("id", "1"), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Serial != 9007199254740995 || !reflect.DeepEqual(result.Tags, []string{"a", "b"}) || !reflect.DeepEqual(result.Secret, []byte{0, 1}) {
+		t.Fatal("Invalid result. Got: ", result)
+	}
+}
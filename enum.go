@@ -0,0 +1,382 @@
+package backends
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// Enum maps the labels of an enum field to the compact integer codes stored in the backend.
+type Enum map[string]int
+
+// NewEnum creates an Enum with the labels coded 1, 2, 3... in the given order. Append the new labels at the end,
+// so the codes of the stored records do not change.
+func NewEnum(labels ...string) Enum {
+	enum := Enum{}
+	for i, label := range labels {
+		enum[label] = i + 1
+	}
+	return enum
+}
+
+// Labels returns the labels of the enum, ordered by code.
+func (e Enum) Labels() []string {
+	labels := make([]string, 0, len(e))
+	for label := range e {
+		labels = append(labels, label)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		return e[labels[i]] < e[labels[j]]
+	})
+	return labels
+}
+
+// Encode returns the code of the label. Returns ErrInvalidInput if the value is not a label of the enum.
+func (e Enum) Encode(value interface{}) (int, error) {
+	label, ok := value.(string)
+	if ok {
+		if code, found := e[label]; found {
+			return code, nil
+		}
+	}
+	return 0, ErrInvalidInput(fmt.Sprintf("%v is not one of %v", value, e.Labels()))
+}
+
+// Decode returns the label of the stored code. The second value is false if the value is not a code of the enum.
+func (e Enum) Decode(value interface{}) (string, bool) {
+	code, ok := enumCode(value)
+	if !ok {
+		return "", false
+	}
+	for label, c := range e {
+		if c == code {
+			return label, true
+		}
+	}
+	return "", false
+}
+
+// validate checks that every label has a distinct code.
+func (e Enum) validate() error {
+	labels := map[int]string{}
+	for label, code := range e {
+		if other, ok := labels[code]; ok {
+			return ErrInvalidInput(fmt.Sprintf("labels %s and %s have the same code %d", other, label, code))
+		}
+		labels[code] = label
+	}
+	return nil
+}
+
+// EnumDefinition is implemented by the repository definitions that declare enum fields.
+// RepositoryDefinitionMap implements it - see RepositoryDefinitionMap.WithEnum.
+type EnumDefinition interface {
+	GetEnums() map[string]Enum
+}
+
+// WithEnum declares the property as an enum field. The repositories defined with enum fields accept only the
+// labels of the enum in the saved records and in the filters, store the codes of the labels and return the
+// labels when reading:
+//
+//	userRepo, err := backend.DefineRepository("users", backends.RepositoryDefinitionMap{
+//		"name": "users",
+//	}.WithEnum("status", backends.NewEnum("active", "suspended", "deleted")))
+//
+//	_, err = userRepo.Save(&User{Status: "active"}, nil)   // stored as "status": 1
+//	_, err = userRepo.Save(&User{Status: "archived"}, nil) // ErrInvalidInput
+func (m RepositoryDefinitionMap) WithEnum(property string, enum Enum) RepositoryDefinitionMap {
+	enums := m.GetEnums()
+	if enums == nil {
+		enums = map[string]Enum{}
+	}
+	enums[property] = enum
+	m["enums"] = enums
+	return m
+}
+
+// GetEnums returns the enum fields of the repository by property name, or nil if there are none.
+func (m RepositoryDefinitionMap) GetEnums() map[string]Enum {
+	enums, _ := m["enums"].(map[string]Enum)
+	return enums
+}
+
+// EnumRepository is a Repository that stores the enum fields as codes and returns them as labels.
+// The records are sorted by the code when ordered by an enum field.
+type EnumRepository struct {
+	Repository
+	enums map[string]Enum
+}
+
+// NewEnumRepository wraps the repository so the enum fields are validated, encoded on write and decoded on read.
+func NewEnumRepository(repo Repository, enums map[string]Enum) (Repository, error) {
+	for property, enum := range enums {
+		if err := enum.validate(); err != nil {
+			return nil, ErrInvalidInput(fmt.Sprintf("enum %s: %s", property, err.Error()))
+		}
+	}
+	return &EnumRepository{
+		Repository: repo,
+		enums:      enums,
+	}, nil
+}
+
+// withEnums wraps the repository with EnumRepository if the definition declares enum fields.
+func withEnums(repo Repository, def RepositoryDefinition) (Repository, error) {
+	enumDef, ok := def.(EnumDefinition)
+	if !ok {
+		return repo, nil
+	}
+	enums := enumDef.GetEnums()
+	if len(enums) == 0 {
+		return repo, nil
+	}
+	return NewEnumRepository(repo, enums)
+}
+
+// wrapped returns the wrapped repository, so the transactions can wrap their repository the same way.
+func (r *EnumRepository) wrapped() Repository {
+	return r.Repository
+}
+
+// GetOne fetches only one record for given filter. The enum fields are decoded into labels.
+func (r *EnumRepository) GetOne(filter Filter, result interface{}) (interface{}, error) {
+	encoded, err := r.encodeFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	record := map[string]interface{}{}
+	if _, err := r.Repository.GetOne(encoded, &record); err != nil {
+		return nil, err
+	}
+	r.decode(record)
+
+	if result == nil {
+		result = &map[string]interface{}{}
+	}
+	if err := MapToInterface(record, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetAll fetches all matched records for given filter. The enum fields are decoded into labels.
+func (r *EnumRepository) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	encoded, err := r.encodeFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	results, err := r.Repository.GetAll(encoded, &map[string]interface{}{}, order, sorting, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	records, err := syncRecords(results)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		r.decode(record)
+	}
+
+	if resultsTypeHint == nil {
+		resultsTypeHint = &map[string]interface{}{}
+	}
+	return recordsToResults(records, resultsTypeHint)
+}
+
+// Save validates and encodes the enum fields of the object, and saves it. The enum fields of the saved record are
+// decoded into labels.
+func (r *EnumRepository) Save(object interface{}, filter Filter) (interface{}, error) {
+	payload, err := r.encode(object)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, err := r.encodeFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	result, err := r.Repository.Save(payload, encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	switch record := result.(type) {
+	case map[string]interface{}:
+		r.decode(record)
+	case *map[string]interface{}:
+		r.decode(*record)
+	}
+	return result, nil
+}
+
+// UpdateAll validates and encodes the enum fields of the update, and updates all records that match the filter.
+func (r *EnumRepository) UpdateAll(filter Filter, update interface{}) (int64, error) {
+	payload, err := r.encode(update)
+	if err != nil {
+		return 0, err
+	}
+	encoded, err := r.encodeFilter(filter)
+	if err != nil {
+		return 0, err
+	}
+	return r.Repository.UpdateAll(encoded, payload)
+}
+
+// SaveAll validates and encodes the enum fields of the objects, and creates them as new records. The enum fields
+// of the created records are decoded into labels.
+func (r *EnumRepository) SaveAll(objects interface{}) (interface{}, error) {
+	records, err := objectsToRecords(objects)
+	if err != nil {
+		return nil, err
+	}
+	payloads := make([]*map[string]interface{}, len(records))
+	for i, record := range records {
+		if payloads[i], err = r.encode(&record); err != nil {
+			return nil, err
+		}
+	}
+
+	results, err := r.Repository.SaveAll(payloads)
+	if saved, ok := results.([]interface{}); ok {
+		for _, result := range saved {
+			switch record := result.(type) {
+			case map[string]interface{}:
+				r.decode(record)
+			case *map[string]interface{}:
+				r.decode(*record)
+			}
+		}
+	}
+	return results, err
+}
+
+// DeleteOne deletes one record that matches the filter.
+func (r *EnumRepository) DeleteOne(filter Filter) error {
+	encoded, err := r.encodeFilter(filter)
+	if err != nil {
+		return err
+	}
+	return r.Repository.DeleteOne(encoded)
+}
+
+// DeleteAll deletes all records that match the filter.
+func (r *EnumRepository) DeleteAll(filter Filter) error {
+	encoded, err := r.encodeFilter(filter)
+	if err != nil {
+		return err
+	}
+	return r.Repository.DeleteAll(encoded)
+}
+
+// Count returns the number of records that match the filter.
+func (r *EnumRepository) Count(filter Filter) (int64, error) {
+	encoded, err := r.encodeFilter(filter)
+	if err != nil {
+		return 0, err
+	}
+	return r.Repository.Count(encoded)
+}
+
+// Exists reports whether a record matches the filter.
+func (r *EnumRepository) Exists(filter Filter) (bool, error) {
+	encoded, err := r.encodeFilter(filter)
+	if err != nil {
+		return false, err
+	}
+	return r.Repository.Exists(encoded)
+}
+
+// encode converts the object to a record with the labels of the enum fields replaced with the codes.
+func (r *EnumRepository) encode(object interface{}) (*map[string]interface{}, error) {
+	payload, err := InterfaceToMap(object)
+	if err != nil {
+		return nil, err
+	}
+	for property, enum := range r.enums {
+		value, ok := (*payload)[property]
+		if !ok || value == nil || value == "" {
+			// the zero values of the struct fields are stored as they are
+			continue
+		}
+		code, err := enum.Encode(value)
+		if err != nil {
+			return nil, ErrInvalidInput(fmt.Sprintf("invalid value of %s: %s", property, err.Error()))
+		}
+		(*payload)[property] = code
+	}
+	return payload, nil
+}
+
+// encodeFilter returns a copy of the filter with the labels of the enum fields replaced with the codes.
+// Only exact matches are supported on the enum fields.
+func (r *EnumRepository) encodeFilter(filter Filter) (Filter, error) {
+	if filter == nil {
+		return nil, nil
+	}
+	encoded := Filter{}
+	for property, value := range filter {
+		enum, ok := r.enums[property]
+		if !ok {
+			encoded[property] = value
+			continue
+		}
+
+		specs, isSpec, err := toFilterSpecs(value)
+		if err != nil {
+			return nil, err
+		}
+		if !isSpec {
+			specs = map[string]interface{}{OpEq: value}
+		}
+		codes := map[string]interface{}{}
+		for operator, operand := range specs {
+			if operator != OpEq {
+				return nil, ErrInvalidInput(fmt.Sprintf("operator %s is not supported on the enum field %s", operator, property))
+			}
+			code, err := enum.Encode(operand)
+			if err != nil {
+				return nil, ErrInvalidInput(fmt.Sprintf("invalid filter on %s: %s", property, err.Error()))
+			}
+			codes[operator] = code
+		}
+		if isSpec {
+			encoded[property] = codes
+		} else {
+			encoded[property] = codes[OpEq]
+		}
+	}
+	return encoded, nil
+}
+
+// decode replaces the codes of the enum fields in the record with the labels. The values that are not codes of
+// the enum are left as stored.
+func (r *EnumRepository) decode(record map[string]interface{}) {
+	for property, enum := range r.enums {
+		if label, ok := enum.Decode(record[property]); ok {
+			record[property] = label
+		}
+	}
+}
+
+// enumCode converts a stored numeric value into an enum code. The codecs and the backends decode the numbers
+// into different types (float64 from JSON, int32 or int64 from BSON, the smallest integer type from MessagePack).
+func enumCode(value interface{}) (int, bool) {
+	if value == nil {
+		return 0, false
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if f != math.Trunc(f) {
+			return 0, false
+		}
+		return int(f), true
+	}
+	return 0, false
+}
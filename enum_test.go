@@ -0,0 +1,171 @@
+package backends
+
+import (
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+type enumTestUser struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+func TestEnum(t *testing.T) {
+	enum := NewEnum("active", "suspended", "deleted")
+
+	if code, err := enum.Encode("suspended"); err != nil || code != 2 {
+		t.Fatal("Expected code 2, got", code, err)
+	}
+	if _, err := enum.Encode("archived"); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input error, got", err)
+	}
+	if _, err := enum.Encode(1); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input error for a code, got", err)
+	}
+
+	for _, stored := range []interface{}{3, int8(3), int32(3), int64(3), uint8(3), float64(3)} {
+		if label, ok := enum.Decode(stored); !ok || label != "deleted" {
+			t.Fatalf("Expected deleted for %T, got %s", stored, label)
+		}
+	}
+	for _, stored := range []interface{}{4, 1.5, "active", nil} {
+		if label, ok := enum.Decode(stored); ok {
+			t.Fatalf("Expected %v not to be decoded, got %s", stored, label)
+		}
+	}
+
+	if labels := enum.Labels(); len(labels) != 3 || labels[0] != "active" || labels[2] != "deleted" {
+		t.Fatal("Expected the labels ordered by code, got", labels)
+	}
+}
+
+func TestEnumRepository(t *testing.T) {
+	backend, err := CacheBackendBuilder(&config.DBInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Shutdown()
+
+	stored, err := backend.DefineRepository("raw-users", RepositoryDefinitionMap{"name": "raw-users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := NewEnumRepository(stored, map[string]Enum{"status": NewEnum("active", "suspended")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := repo.Save(&enumTestUser{ID: "1", Name: "alice", Status: "active"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := repo.Save(&map[string]interface{}{"id": "2", "name": "bob", "status": "suspended"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.(map[string]interface{})["status"] != "suspended" {
+		t.Fatal("Expected the saved record to have the label, got", saved)
+	}
+	if _, err := repo.Save(&map[string]interface{}{"id": "3", "status": "archived"}, nil); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input error, got", err)
+	}
+
+	raw, err := stored.GetOne(NewFilter().Match("id", "2"), &map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, ok := enumCode((*raw.(*map[string]interface{}))["status"]); !ok || code != 2 {
+		t.Fatal("Expected the code to be stored, got", raw)
+	}
+
+	result, err := repo.GetOne(NewFilter().Match("status", "suspended"), &enumTestUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user := result.(*enumTestUser); user.ID != "2" || user.Status != "suspended" {
+		t.Fatal("Expected bob, got", user)
+	}
+
+	results, err := repo.GetAll(nil, &enumTestUser{}, "status", "asc", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := *results.(*[]*enumTestUser)
+	if len(users) != 2 || users[0].Status != "active" || users[1].Status != "suspended" {
+		t.Fatal("Expected alice and bob, got", users)
+	}
+
+	if _, err := repo.GetAll(NewFilter().MatchPattern("status", "act%"), nil, "", "", 0, 0); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input error for a pattern, got", err)
+	}
+	if _, err := repo.Count(NewFilter().Match("status", "archived")); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input error for an unknown label, got", err)
+	}
+	if count, err := repo.Count(Filter{"status": map[string]interface{}{OpEq: "active"}}); err != nil || count != 1 {
+		t.Fatal("Expected one active user, got", count, err)
+	}
+
+	if _, err := repo.UpdateAll(nil, &map[string]interface{}{"status": "archived"}); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input error for an unknown label, got", err)
+	}
+	if updated, err := repo.UpdateAll(NewFilter().Match("status", "active"), &map[string]interface{}{"status": "suspended"}); err != nil || updated != 1 {
+		t.Fatal("Expected alice to be suspended, got", updated, err)
+	}
+	if count, err := repo.Count(NewFilter().Match("status", "suspended")); err != nil || count != 2 {
+		t.Fatal("Expected two suspended users, got", count, err)
+	}
+
+	saved, err = repo.SaveAll([]enumTestUser{{ID: "4", Status: "active"}, {ID: "5", Status: "suspended"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list := saved.([]interface{}); len(list) != 2 || list[1].(map[string]interface{})["status"] != "suspended" {
+		t.Fatal("Expected the created records to have the labels, got", list)
+	}
+	if _, err := repo.SaveAll([]enumTestUser{{ID: "6", Status: "archived"}}); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input error, got", err)
+	}
+	if err := repo.DeleteAll(NewFilter().Match("status", "active")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.DeleteAll(NewFilter().Match("status", "suspended")); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := repo.Exists(NewFilter().Match("id", "2")); err != nil || exists {
+		t.Fatal("Expected bob to be deleted, got", exists, err)
+	}
+}
+
+func TestDefineRepositoryWithEnum(t *testing.T) {
+	backend, err := CacheBackendBuilder(&config.DBInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Shutdown()
+
+	repo, err := backend.DefineRepository("users", RepositoryDefinitionMap{
+		"name": "users",
+	}.WithEnum("status", NewEnum("active", "suspended")).WithModel(&enumTestUser{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Save(&enumTestUser{ID: "1", Status: "suspended"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	result, err := repo.GetOne(NewFilter().Match("id", "1"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user := result.(*enumTestUser); user.Status != "suspended" {
+		t.Fatal("Expected the label, got", user)
+	}
+
+	_, err = backend.DefineRepository("accounts", RepositoryDefinitionMap{
+		"name": "accounts",
+	}.WithEnum("type", Enum{"personal": 1, "business": 1}))
+	if err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input error for duplicate codes, got", err)
+	}
+}
@@ -71,6 +71,26 @@ var ErrAlreadyExists = ErrorClass("already exists")
 // ErrInvalidInput is a generic error class related to invalid input parameters specified on a backend function.
 var ErrInvalidInput = ErrorClass("invalid input")
 
+// ErrNotSupported is an error class for operations (or options) that the backend does not support.
+var ErrNotSupported = ErrorClass("not supported")
+
+// ErrForbidden is an error class for operations that the caller is not allowed to do (see ACLRepository).
+var ErrForbidden = ErrorClass("forbidden")
+
+// ErrReadOnly is an error class for writes rejected because the backend is read-only (see DegradableBackend), or
+// because the repository is a view (see MongoView).
+var ErrReadOnly = ErrorClass("read only")
+
+// ErrSchemaViolation is an error class for repositories that are not declared, or are defined differently than
+// declared (see SchemaManager).
+var ErrSchemaViolation = ErrorClass("schema violation")
+
+// ErrCheckedOut is an error class for records checked out by another owner (see CheckoutStore).
+var ErrCheckedOut = ErrorClass("checked out")
+
+// ErrConflict is an error class for updates of records that were modified concurrently (see VersionedRepository).
+var ErrConflict = ErrorClass("conflict")
+
 // ErrBackendError is a genering error class capturing errors that happened during processing in the backend.
 var ErrBackendError = func(args ...interface{}) error {
 	return &BackendErrorInfo{
@@ -97,3 +117,28 @@ func IsErrAlreadyExists(err error) bool {
 func IsErrInvalidInput(err error) bool {
 	return IsErrorOfType(err, ErrInvalidInput(""))
 }
+
+// IsErrForbidden check of the error is of the ErrForbidden class.
+func IsErrForbidden(err error) bool {
+	return IsErrorOfType(err, ErrForbidden(""))
+}
+
+// IsErrReadOnly check of the error is of the ErrReadOnly class.
+func IsErrReadOnly(err error) bool {
+	return IsErrorOfType(err, ErrReadOnly(""))
+}
+
+// IsErrSchemaViolation check of the error is of the ErrSchemaViolation class.
+func IsErrSchemaViolation(err error) bool {
+	return IsErrorOfType(err, ErrSchemaViolation(""))
+}
+
+// IsErrCheckedOut check of the error is of the ErrCheckedOut class.
+func IsErrCheckedOut(err error) bool {
+	return IsErrorOfType(err, ErrCheckedOut(""))
+}
+
+// IsErrConflict check of the error is of the ErrConflict class.
+func IsErrConflict(err error) bool {
+	return IsErrorOfType(err, ErrConflict(""))
+}
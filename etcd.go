@@ -0,0 +1,400 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+	"github.com/satori/go.uuid"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// ETCD_CTX_KEY is etcd context key
+var ETCD_CTX_KEY = "ETCD_CLIENT"
+
+// etcdRequestTimeout is the timeout for a single request to etcd.
+const etcdRequestTimeout = 30 * time.Second
+
+// EtcdCollection is a repository stored in etcd.
+// Every record is stored, encoded with the codec of the repository (JSON by default, see Codec), under the repository prefix: /<database>/<repository>/<id>.
+// The records are filtered in memory, so the etcd backend is meant for small repositories, like configurations.
+type EtcdCollection struct {
+	client  *clientv3.Client
+	prefix  string
+	codec   Codec
+	repoDef RepositoryDefinition
+}
+
+// etcdRecord is a decoded record together with its etcd key and revision.
+type etcdRecord struct {
+	key         string
+	modRevision int64
+	value       map[string]interface{}
+}
+
+// EtcdRepoBuilder builds new etcd repository (keys prefix).
+func EtcdRepoBuilder(repoDef RepositoryDefinition, backend Backend) (Repository, error) {
+
+	clientObj := backend.GetFromContext(ETCD_CTX_KEY)
+	if clientObj == nil {
+		return nil, ErrBackendError("etcd client not configured")
+	}
+
+	client, ok := clientObj.(*clientv3.Client)
+	if !ok {
+		return nil, ErrBackendError("unknown client type")
+	}
+
+	databaseName := backend.GetConfig().DatabaseName
+	if databaseName == "" {
+		return nil, ErrBackendError("database name is missing and required")
+	}
+
+	repositoryName := repoDef.GetName()
+	if repositoryName == "" {
+		return nil, ErrBackendError("repository name is missing and required")
+	}
+
+	if repoDef.EnableTTL() && repoDef.GetTTL() == 0 {
+		return nil, ErrBackendError("TTL value is missing and must be greater than zero")
+	}
+
+	codec, err := codecFor(repoDef)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EtcdCollection{
+		client:  client,
+		prefix:  fmt.Sprintf("/%s/%s/", databaseName, repositoryName),
+		codec:   codec,
+		repoDef: repoDef,
+	}, nil
+}
+
+// EtcdBackendBuilder returns RepositoriesBackend.
+// The host may contain multiple comma separated etcd endpoints.
+func EtcdBackendBuilder(conf *config.DBInfo, manager BackendManager) (Backend, error) {
+
+	if conf.Host == "" {
+		return nil, ErrBackendError("etcd endpoints are missing from config")
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   strings.Split(conf.Host, ","),
+		Username:    conf.Username,
+		Password:    conf.Password,
+		DialTimeout: 30 * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.WithValue(context.Background(), ETCD_CTX_KEY, client)
+	cleanup := func() {
+		client.Close()
+	}
+
+	return NewRepositoriesBackend(ctx, conf, EtcdRepoBuilder, cleanup), nil
+}
+
+// GetOne fetches only one record for given filter
+func (c *EtcdCollection) GetOne(filter Filter, result interface{}) (interface{}, error) {
+	records, err := c.find(filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrNotFound("record not found")
+	}
+
+	err = MapToInterface(&records[0].value, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetAll fetches all matched records for given filter
+func (c *EtcdCollection) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	records, err := c.find(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	values := []map[string]interface{}{}
+	for _, record := range records {
+		values = append(values, record.value)
+	}
+
+	values, err = filterRecords(values, filter, order, sorting, limit, offset)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+
+	return recordsToResults(values, resultsTypeHint)
+}
+
+// Count returns the number of records that match the filter.
+func (c *EtcdCollection) Count(filter Filter) (int64, error) {
+	records, err := c.find(filter)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(records)), nil
+}
+
+// Exists reports whether a record matches the filter.
+func (c *EtcdCollection) Exists(filter Filter) (bool, error) {
+	records, err := c.find(filter)
+	if err != nil {
+		return false, err
+	}
+	return len(records) > 0, nil
+}
+
+// Save creates new record unless it does not exist, otherwise it updates the record
+func (c *EtcdCollection) Save(object interface{}, filter Filter) (interface{}, error) {
+
+	var result interface{}
+
+	payload, err := InterfaceToMap(object)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+
+	if filter == nil {
+		keyProperty := c.keyProperty()
+		if err := c.ensureKey(*payload); err != nil {
+			return nil, err
+		}
+
+		value, err := c.codec.Marshal(*payload)
+		if err != nil {
+			return nil, err
+		}
+
+		opts := []clientv3.OpOption{}
+		if c.repoDef.EnableTTL() {
+			// the TTL is mapped to etcd lease - the key is removed when the lease expires.
+			lease, err := c.client.Grant(ctx, int64(c.repoDef.GetTTL()))
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, clientv3.WithLease(lease.ID))
+		}
+
+		key := c.key((*payload)[keyProperty])
+		resp, err := c.client.Txn(ctx).
+			If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+			Then(clientv3.OpPut(key, string(value), opts...)).
+			Commit()
+		if err != nil {
+			return nil, err
+		}
+		if !resp.Succeeded {
+			return nil, ErrAlreadyExists("record already exists!")
+		}
+	} else {
+		records, err := c.find(filter)
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == 0 {
+			return nil, ErrNotFound("record not found")
+		}
+		record := records[0]
+		if err := c.update(ctx, record, *payload); err != nil {
+			return nil, err
+		}
+		payload = &record.value
+	}
+
+	err = MapToInterface(payload, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// SaveAll creates the objects (a slice) as new records, one by one. Returns the created records, as returned by Save.
+// The records created before a failure are not removed.
+func (c *EtcdCollection) SaveAll(objects interface{}) (interface{}, error) {
+	records, err := objectsToRecords(objects)
+	if err != nil {
+		return nil, err
+	}
+	return saveEach(records, c.Save)
+}
+
+// UpdateAll updates all matched records for given filter with the properties of the update.
+// Returns the number of the updated records.
+func (c *EtcdCollection) UpdateAll(filter Filter, update interface{}) (int64, error) {
+	payload, err := InterfaceToMap(update)
+	if err != nil {
+		return 0, err
+	}
+
+	records, err := c.find(filter)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+
+	var updated int64
+	for _, record := range records {
+		if err := c.update(ctx, record, *payload); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+	return updated, nil
+}
+
+// update sets the properties of the payload on the record, except the key. The update succeeds only if the record
+// was not changed since it was read.
+func (c *EtcdCollection) update(ctx context.Context, record *etcdRecord, payload map[string]interface{}) error {
+	for k, v := range payload {
+		if k == c.keyProperty() {
+			// the key is immutable
+			continue
+		}
+		record.value[k] = v
+	}
+
+	value, err := c.codec.Marshal(record.value)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(record.key), "=", record.modRevision)).
+		Then(clientv3.OpPut(record.key, string(value), clientv3.WithIgnoreLease())).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrBackendError("record was modified concurrently")
+	}
+	return nil
+}
+
+// DeleteOne deletes only one record for given filter
+func (c *EtcdCollection) DeleteOne(filter Filter) error {
+	records, err := c.find(filter)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return ErrNotFound("record not found")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+
+	_, err = c.client.Delete(ctx, records[0].key)
+	return err
+}
+
+// DeleteAll deletes all matched records for given filter
+func (c *EtcdCollection) DeleteAll(filter Filter) error {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+
+	if len(filter) == 0 {
+		_, err := c.client.Delete(ctx, c.prefix, clientv3.WithPrefix())
+		return err
+	}
+
+	records, err := c.find(filter)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		if _, err := c.client.Delete(ctx, record.key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// keyProperty returns the name of the property used as record key - the hash key if set, otherwise "id".
+func (c *EtcdCollection) keyProperty() string {
+	if hashKey := c.repoDef.GetHashKey(); hashKey != "" {
+		return hashKey
+	}
+	return "id"
+}
+
+// ensureKey generates a UUID key for the record if its key is missing, nil or empty.
+func (c *EtcdCollection) ensureKey(record map[string]interface{}) error {
+	keyProperty := c.keyProperty()
+	if id, ok := record[keyProperty]; ok && id != nil && id != "" {
+		return nil
+	}
+	id, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+	record[keyProperty] = id.String()
+	return nil
+}
+
+// key returns the etcd key for the record with the given key value.
+func (c *EtcdCollection) key(value interface{}) string {
+	return c.prefix + url.PathEscape(fmt.Sprintf("%v", value))
+}
+
+// find returns the records that match the filter.
+// If the filter has an exact match on the key property, only that key is fetched, otherwise
+// all records under the repository prefix are fetched and matched in memory.
+func (c *EtcdCollection) find(filter Filter) ([]*etcdRecord, error) {
+	matcher, err := toRecordMatcher(filter)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+
+	var resp *clientv3.GetResponse
+	if keyValue, ok := filter[c.keyProperty()]; ok && !isFilterSpec(keyValue) {
+		resp, err = c.client.Get(ctx, c.key(keyValue))
+	} else {
+		resp, err = c.client.Get(ctx, c.prefix, clientv3.WithPrefix())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	records := []*etcdRecord{}
+	for _, kv := range resp.Kvs {
+		value, err := c.codec.Unmarshal(kv.Value)
+		if err != nil {
+			return nil, ErrBackendError(err)
+		}
+		if !matcher(value) {
+			continue
+		}
+		records = append(records, &etcdRecord{
+			key:         string(kv.Key),
+			modRevision: kv.ModRevision,
+			value:       value,
+		})
+	}
+
+	return records, nil
+}
@@ -0,0 +1,107 @@
+package backends
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func TestEtcdKey(t *testing.T) {
+	coll := &EtcdCollection{
+		prefix:  "/testdb/configs/",
+		repoDef: RepositoryDefinitionMap{"name": "configs"},
+	}
+
+	if coll.keyProperty() != "id" {
+		t.Fatal("Expected id to be the default key property. Got: ", coll.keyProperty())
+	}
+	if key := coll.key("a/b"); key != "/testdb/configs/a%2Fb" {
+		t.Fatal("Expected the key to be escaped. Got: ", key)
+	}
+
+	coll.repoDef = RepositoryDefinitionMap{"name": "configs", "hashKey": "name"}
+	if coll.keyProperty() != "name" {
+		t.Fatal("Expected the hash key to be the key property. Got: ", coll.keyProperty())
+	}
+}
+
+func TestEtcdEnsureKey(t *testing.T) {
+	coll := &EtcdCollection{repoDef: RepositoryDefinitionMap{"name": "configs"}}
+
+	for _, record := range []map[string]interface{}{{}, {"id": nil}, {"id": ""}} {
+		if err := coll.ensureKey(record); err != nil {
+			t.Fatal(err)
+		}
+		if id, ok := record["id"].(string); !ok || id == "" {
+			t.Fatal("Expected a generated key. Got: ", record["id"])
+		}
+	}
+
+	record := map[string]interface{}{"id": "feature-flags"}
+	if err := coll.ensureKey(record); err != nil || record["id"] != "feature-flags" {
+		t.Fatal("Expected the key to be kept. Got: ", record["id"], err)
+	}
+}
+
+func TestEtcdRepoBuilder(t *testing.T) {
+	backend := NewRepositoriesBackend(context.Background(), &config.DBInfo{DatabaseName: "testdb"}, EtcdRepoBuilder, nil)
+	if _, err := backend.DefineRepository("configs", RepositoryDefinitionMap{"name": "configs"}); err == nil {
+		t.Fatal("Expected error when etcd client is not configured")
+	}
+}
+
+func TestEtcdIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode.")
+	}
+
+	bm := NewBackendSupport(map[string]*config.DBInfo{
+		"etcd": &config.DBInfo{
+			DatabaseName: "testdb",
+			Host:         "localhost:2379",
+		},
+	})
+
+	backend, err := bm.GetBackend("etcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := backend.DefineRepository("test_configs", RepositoryDefinitionMap{
+		"name": "test_configs",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.DeleteAll(nil)
+
+	for _, entry := range []TestEntry{
+		TestEntry{
+			Value: "aa",
+		},
+		TestEntry{
+			Value: "ab",
+		},
+		TestEntry{
+			Value: "ba",
+		},
+	} {
+		if _, err := repo.Save(&entry, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := repo.GetAll(NewFilter().MatchPattern("value", "a%"), &TestEntry{}, "value", "asc", 100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resArr, ok := results.(*[]*TestEntry)
+	if !ok {
+		t.Fatal("Expected a pointer to an array of entries. Got type: ", reflect.TypeOf(results))
+	}
+	if len(*resArr) != 2 {
+		t.Fatal("Expected 2 results, but got: ", len(*resArr))
+	}
+}
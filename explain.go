@@ -0,0 +1,67 @@
+package backends
+
+import (
+	"time"
+)
+
+// QueryPlan describes how a repository runs a query: the native query generated for the filter, whether the whole
+// collection is read, and the statistics of running it.
+type QueryPlan struct {
+	// Backend is the backend that planned the query ("mongodb", "dynamodb", "sql"), empty if the repository does not
+	// explain its queries.
+	Backend string
+	// Query is the native query: bson.M for MongoDB, *dynamodb.QueryInput or *dynamodb.ScanInput for DynamoDB,
+	// *SQLQuery for SQL. The repositories that don't explain their queries return the canonical form of the filter
+	// (see Filter.Canonical).
+	Query interface{}
+	// FullScan is true if all records of the collection are read to find the matched ones.
+	FullScan bool
+	// Index is the name of the index used by the query, if the backend reports it.
+	Index string
+	// Scanned is the number of the records read to run the query, -1 if the backend does not report it.
+	Scanned int64
+	// Matched is the number of the records matched by the filter.
+	Matched int64
+	// Duration is the time it took to run the query.
+	Duration time.Duration
+	// Details is the explain output of the backend, if any (the explain document of MongoDB).
+	Details interface{}
+}
+
+// ExplainRepository is implemented by the repositories that explain their queries (MongoDB, DynamoDB and SQL).
+type ExplainRepository interface {
+	Explain(filter Filter, order string, sorting string) (*QueryPlan, error)
+}
+
+// Explain runs the query of the filter on the repository and describes how it was run, to find out why a query is
+// slow - for example that it scans the whole table:
+//
+//	plan, err := backends.Explain(userRepo, backends.NewFilter().Match("email", email), "", "")
+//	if plan.FullScan {
+//		log.Printf("query %v scans %d records to find %d", plan.Query, plan.Scanned, plan.Matched)
+//	}
+//
+// The query is run, so Explain should be used for debugging only. The repositories that don't explain their queries
+// (see ExplainRepository) only count the matched records.
+func Explain(repo Repository, filter Filter, order string, sorting string) (*QueryPlan, error) {
+	var explainRepo ExplainRepository
+	if AsRepository(repo, &explainRepo) {
+		return explainRepo.Explain(cloneFilter(filter), order, sorting)
+	}
+
+	canonical, err := filter.Canonical()
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	matched, err := repo.Count(cloneFilter(filter))
+	if err != nil {
+		return nil, err
+	}
+	return &QueryPlan{
+		Query:    canonical,
+		Scanned:  -1,
+		Matched:  matched,
+		Duration: time.Since(start),
+	}, nil
+}
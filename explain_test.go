@@ -0,0 +1,59 @@
+package backends
+
+import (
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestExplain(t *testing.T) {
+	repo, shutdown := newACLTestRepository(t)
+	defer shutdown()
+
+	for _, role := range []string{"admin", "user", "user"} {
+		if _, err := repo.Save(&map[string]interface{}{"role": role}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plan, err := Explain(repo, NewFilter().Match("role", "user"), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Query != `[["role","$eq",["string","user"]]]` || plan.Scanned != -1 || plan.Matched != 2 {
+		t.Fatal("Expected the canonical filter and the count of the matched records. Got: ", plan)
+	}
+}
+
+func TestExplainMongoPlan(t *testing.T) {
+	plan := &QueryPlan{Scanned: -1}
+	explainMongoPlan(bson.M{
+		"queryPlanner": bson.M{
+			"winningPlan": bson.M{
+				"stage": "FETCH",
+				"inputStage": bson.M{
+					"stage":     "IXSCAN",
+					"indexName": "email_1",
+				},
+			},
+		},
+		"executionStats": bson.M{
+			"nReturned":         1,
+			"totalDocsExamined": 1,
+		},
+	}, plan)
+	if plan.FullScan || plan.Index != "email_1" || plan.Scanned != 1 {
+		t.Fatal("Expected the index scan. Got: ", plan)
+	}
+
+	plan = &QueryPlan{Scanned: -1}
+	explainMongoPlan(bson.M{
+		"queryPlanner": bson.M{
+			"winningPlan": bson.M{"stage": "COLLSCAN"},
+		},
+		"executionStats": bson.M{"totalDocsExamined": int64(1000)},
+	}, plan)
+	if !plan.FullScan || plan.Index != "" || plan.Scanned != 1000 {
+		t.Fatal("Expected the collection scan. Got: ", plan)
+	}
+}
@@ -0,0 +1,8 @@
+package backends
+
+// The helpers of the package used by the external tests (package backends_test).
+var (
+	NormalizeValue = normalizeValue
+	EqualValues    = equalValues
+	CompareValues  = compareValues
+)
@@ -0,0 +1,340 @@
+package backends
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Filter operators. An operator is given as a key in a filter specification map, for example:
+//
+//	filter := backends.Filter{"name": map[string]interface{}{"$pattern": "John%"}}
+const (
+	// OpEq is the operator for exact match. Plain (non-specification) filter values are parsed as OpEq.
+	OpEq = "$eq"
+	// OpPattern is the operator for 'LIKE' pattern matching. See Filter.MatchPattern.
+	OpPattern = "$pattern"
+	// OpRegex is the operator for raw regular expression matching. See Filter.MatchRegex.
+	OpRegex = "$regex"
+	// OpNe is the operator for "not equal". The records without the property are matched as well.
+	OpNe = "$ne"
+	// OpGt is the operator for "greater than". Numbers are compared with numbers and strings with strings.
+	OpGt = "$gt"
+	// OpGte is the operator for "greater than or equal".
+	OpGte = "$gte"
+	// OpLt is the operator for "less than".
+	OpLt = "$lt"
+	// OpLte is the operator for "less than or equal".
+	OpLte = "$lte"
+	// OpIn is the operator for matching any of the values of a list.
+	OpIn = "$in"
+	// OpNin is the operator for matching none of the values of a list. The records without the property are
+	// matched as well.
+	OpNin = "$nin"
+	// OpExists is the operator for matching the records that have the property (true), even if it is null, or that
+	// don't have it (false).
+	OpExists = "$exists"
+	// OpNull is the operator for matching the records whose property is null (true), or is set to a value other than
+	// null (false). The records without the property are matched by neither.
+	OpNull = "$null"
+)
+
+// supportedOperators lists the operators that ParseFilter understands.
+var supportedOperators = map[string]bool{
+	OpEq:      true,
+	OpPattern: true,
+	OpRegex:   true,
+	OpNe:      true,
+	OpGt:      true,
+	OpGte:     true,
+	OpLt:      true,
+	OpLte:     true,
+	OpIn:      true,
+	OpNin:     true,
+	OpExists:  true,
+	OpNull:    true,
+}
+
+// comparisonOperators maps the comparison operators to their symbols, shared by the query languages of the backends.
+var comparisonOperators = map[string]string{
+	OpGt:  ">",
+	OpGte: ">=",
+	OpLt:  "<",
+	OpLte: "<=",
+}
+
+// FilterCondition is a node in the filter AST. It matches the value of a property
+// against the operand using the given operator.
+type FilterCondition struct {
+	Property string
+	Operator string
+	Value    interface{}
+}
+
+// FilterAST is the parsed, backend independent representation of a Filter.
+// All conditions must be satisfied (they are joined with AND).
+// The conditions are ordered by property and then by operator, so the same
+// filter always yields the same AST.
+type FilterAST struct {
+	Conditions []*FilterCondition
+}
+
+// QueryTranslator translates a filter AST into a backend-native query.
+// Backend implementations (including the ones outside of this package) should
+// translate filters through a QueryTranslator, so every backend gives the same meaning
+// to the same Filter. The parity of a translator is verified with backendstest.RunTranslatorConformance.
+type QueryTranslator interface {
+	Translate(ast *FilterAST) (interface{}, error)
+}
+
+// ParseFilter parses the filter into a FilterAST.
+// Returns ErrInvalidInput if the filter contains an unknown operator or an invalid operand.
+func ParseFilter(filter Filter) (*FilterAST, error) {
+	ast := &FilterAST{
+		Conditions: []*FilterCondition{},
+	}
+
+	for property, value := range filter {
+		specs, isSpec, err := toFilterSpecs(value)
+		if err != nil {
+			return nil, err
+		}
+		if !isSpec {
+			ast.Conditions = append(ast.Conditions, &FilterCondition{
+				Property: property,
+				Operator: OpEq,
+				Value:    value,
+			})
+			continue
+		}
+		for operator, operand := range specs {
+			if !supportedOperators[operator] {
+				return nil, ErrInvalidInput(fmt.Sprintf("unknown filter operator %s on property %s", operator, property))
+			}
+			if operator == OpPattern || operator == OpRegex {
+				if _, ok := operand.(string); !ok {
+					return nil, ErrInvalidInput(fmt.Sprintf("%s on property %s must be a string", operator, property))
+				}
+			}
+			if operator == OpExists || operator == OpNull {
+				if _, ok := operand.(bool); !ok {
+					return nil, ErrInvalidInput(fmt.Sprintf("%s on property %s must be a boolean", operator, property))
+				}
+			}
+			if operator == OpIn || operator == OpNin {
+				values, ok := toFilterList(operand)
+				if !ok || len(values) == 0 {
+					return nil, ErrInvalidInput(fmt.Sprintf("%s on property %s must be a non-empty list", operator, property))
+				}
+				operand = values
+			}
+			ast.Conditions = append(ast.Conditions, &FilterCondition{
+				Property: property,
+				Operator: operator,
+				Value:    operand,
+			})
+		}
+	}
+
+	sort.Slice(ast.Conditions, func(i, j int) bool {
+		a, b := ast.Conditions[i], ast.Conditions[j]
+		if a.Property != b.Property {
+			return a.Property < b.Property
+		}
+		return a.Operator < b.Operator
+	})
+
+	return ast, nil
+}
+
+// TranslateFilter parses the filter and translates it with the given translator.
+func TranslateFilter(filter Filter, translator QueryTranslator) (interface{}, error) {
+	ast, err := ParseFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	return translator.Translate(ast)
+}
+
+// Canonical returns a deterministic, normalized string representation of the filter.
+// Equivalent filters have the same canonical form regardless of map iteration order or how the
+// operators were specified (for example, a plain value and {"$eq": value} are the same condition,
+// and the order and the duplicates of the $in and $nin values don't matter), while the values are
+// tagged with their type, so a time, an ObjectId or a []byte differs from its string. The canonical
+// form is suitable for cache keys, logging and deduplication.
+func (f Filter) Canonical() (string, error) {
+	ast, err := ParseFilter(f)
+	if err != nil {
+		return "", err
+	}
+	return ast.Canonical()
+}
+
+// Canonical returns the canonical string representation of the AST. See Filter.Canonical.
+func (ast *FilterAST) Canonical() (string, error) {
+	conditions := [][]interface{}{}
+	for _, cond := range ast.Conditions {
+		value, err := canonicalValue(cond.Value)
+		if err != nil {
+			return "", ErrInvalidInput(err)
+		}
+		if cond.Operator == OpIn || cond.Operator == OpNin {
+			if value, err = canonicalSet(value); err != nil {
+				return "", ErrInvalidInput(err)
+			}
+		}
+		conditions = append(conditions, []interface{}{cond.Property, cond.Operator, value})
+	}
+
+	// encoding/json writes the map keys in sorted order, so nested values are canonical as well.
+	canonical, err := json.Marshal(conditions)
+	if err != nil {
+		return "", ErrInvalidInput(err)
+	}
+	return string(canonical), nil
+}
+
+// canonicalValue returns the value tagged with its type, as ["<type>", <value>], for the canonical form of the
+// filters. The numbers of all types are the same, the times are in UTC (see TimeLayout), the ObjectIds are in hex and
+// the other values without a tag of their own are tagged as their JSON.
+func canonicalValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		return []interface{}{"null"}, nil
+	case time.Time:
+		return []interface{}{"time", formatTime(v)}, nil
+	case []byte:
+		return []interface{}{"binary", v}, nil
+	case interface{ Hex() string }:
+		return []interface{}{"objectId", v.Hex()}, nil
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Bool:
+		return []interface{}{"bool", v.Bool()}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return []interface{}{"number", value}, nil
+	case reflect.String:
+		return []interface{}{"string", v.String()}, nil
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return []interface{}{"null"}, nil
+		}
+		return canonicalValue(v.Elem().Interface())
+	case reflect.Map:
+		if v.Type().Key().Kind() == reflect.String {
+			entries := map[string]interface{}{}
+			for _, key := range v.MapKeys() {
+				entry, err := canonicalValue(v.MapIndex(key).Interface())
+				if err != nil {
+					return nil, err
+				}
+				entries[key.String()] = entry
+			}
+			return []interface{}{"map", entries}, nil
+		}
+	case reflect.Slice, reflect.Array:
+		items := []interface{}{}
+		for i := 0; i < v.Len(); i++ {
+			item, err := canonicalValue(v.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return []interface{}{"list", items}, nil
+	}
+
+	normalized, err := normalizeValue(value)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{"json", normalized}, nil
+}
+
+// canonicalSet sorts the items of the canonical list (see canonicalValue) and removes their duplicates.
+func canonicalSet(list interface{}) (interface{}, error) {
+	items := list.([]interface{})[1].([]interface{})
+	encoded := map[string]json.RawMessage{}
+	keys := []string{}
+	for _, item := range items {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := encoded[string(data)]; !ok {
+			encoded[string(data)] = data
+			keys = append(keys, string(data))
+		}
+	}
+	sort.Strings(keys)
+
+	set := []interface{}{}
+	for _, key := range keys {
+		set = append(set, encoded[key])
+	}
+	return []interface{}{"list", set}, nil
+}
+
+// isFilterSpec checks if the filter value is an operator specification, and not a value to be matched exactly.
+func isFilterSpec(value interface{}) bool {
+	_, isSpec, err := toFilterSpecs(value)
+	return isSpec || err != nil
+}
+
+// toFilterSpecs checks if the filter value is an operator specification map (all keys start with "$").
+// Both map[string]string and map[string]interface{} specifications are supported.
+func toFilterSpecs(value interface{}) (map[string]interface{}, bool, error) {
+	specs := map[string]interface{}{}
+
+	switch v := value.(type) {
+	case map[string]string:
+		for key, val := range v {
+			specs[key] = val
+		}
+	case map[string]interface{}:
+		for key, val := range v {
+			specs[key] = val
+		}
+	default:
+		return nil, false, nil
+	}
+
+	operators := 0
+	for key := range specs {
+		if strings.HasPrefix(key, "$") {
+			operators++
+		}
+	}
+	if operators == 0 {
+		// a plain map value, to be matched exactly
+		return nil, false, nil
+	}
+	if operators != len(specs) {
+		return nil, false, ErrInvalidInput("filter specification cannot mix operators and plain values")
+	}
+
+	return specs, true, nil
+}
+
+// toFilterList converts the operand of OpIn and OpNin (a slice or an array of any type) to []interface{}.
+func toFilterList(value interface{}) ([]interface{}, bool) {
+	if value == nil {
+		return nil, false
+	}
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, false
+	}
+	values := make([]interface{}, v.Len())
+	for i := range values {
+		values[i] = v.Index(i).Interface()
+	}
+	return values, true
+}
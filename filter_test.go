@@ -0,0 +1,178 @@
+package backends
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestParseFilter(t *testing.T) {
+	ast, err := ParseFilter(NewFilter().MatchPattern("name", "John%").Match("role", "user").Match("age", 30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ast.Conditions) != 3 {
+		t.Fatal("Expected 3 conditions. Got: ", len(ast.Conditions))
+	}
+
+	expected := []FilterCondition{
+		{Property: "age", Operator: OpEq, Value: 30},
+		{Property: "name", Operator: OpPattern, Value: "John%"},
+		{Property: "role", Operator: OpEq, Value: "user"},
+	}
+	for i, cond := range ast.Conditions {
+		if *cond != expected[i] {
+			t.Fatalf("Expected condition %d to be %v. Got: %v", i, expected[i], *cond)
+		}
+	}
+}
+
+func TestParseFilterSpecificationTypes(t *testing.T) {
+	ast, err := ParseFilter(Filter{
+		"name": map[string]interface{}{
+			"$pattern": "%doe",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ast.Conditions) != 1 || ast.Conditions[0].Operator != OpPattern {
+		t.Fatal("Expected one $pattern condition. Got: ", ast.Conditions)
+	}
+
+	// plain maps are matched exactly
+	ast, err = ParseFilter(Filter{
+		"address": map[string]interface{}{
+			"city": "Skopje",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ast.Conditions) != 1 || ast.Conditions[0].Operator != OpEq {
+		t.Fatal("Expected one exact match condition. Got: ", ast.Conditions)
+	}
+}
+
+func TestParseFilterInvalid(t *testing.T) {
+	if _, err := ParseFilter(Filter{"name": map[string]interface{}{"$unknown": "x"}}); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input error for unknown operator. Got: ", err)
+	}
+
+	if _, err := ParseFilter(Filter{"name": map[string]interface{}{"$pattern": "x", "city": "y"}}); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input error for mixed specification. Got: ", err)
+	}
+
+	if _, err := ParseFilter(Filter{"name": map[string]interface{}{"$pattern": 10}}); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input error for non-string pattern. Got: ", err)
+	}
+	if _, err := ParseFilter(Filter{"name": map[string]interface{}{"$in": "John"}}); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input error for $in that is not a list. Got: ", err)
+	}
+}
+
+type countingTranslator struct{}
+
+func (t *countingTranslator) Translate(ast *FilterAST) (interface{}, error) {
+	return len(ast.Conditions), nil
+}
+
+func TestTranslateFilter(t *testing.T) {
+	result, err := TranslateFilter(NewFilter().Match("a", 1).Match("b", 2), &countingTranslator{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.(int) != 2 {
+		t.Fatal("Expected the custom translator to get 2 conditions. Got: ", result)
+	}
+}
+
+func TestFilterCanonical(t *testing.T) {
+	a, err := NewFilter().Match("role", "user").MatchPattern("name", "John%").Canonical()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Filter{
+		"name": map[string]interface{}{"$pattern": "John%"},
+		"role": map[string]interface{}{"$eq": "user"},
+	}.Canonical()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a != b {
+		t.Fatalf("Expected equivalent filters to have the same canonical form. Got: %s and %s", a, b)
+	}
+	if a != `[["name","$pattern",["string","John%"]],["role","$eq",["string","user"]]]` {
+		t.Fatal("Invalid canonical form. Got: ", a)
+	}
+
+	empty, err := NewFilter().Canonical()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty != "[]" {
+		t.Fatal("Expected empty canonical form. Got: ", empty)
+	}
+}
+
+func TestFilterCanonicalValues(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	id := bson.NewObjectId()
+	different := map[string][]Filter{
+		"time":     {NewFilter().Match("createdAt", created), NewFilter().Match("createdAt", created.Format(time.RFC3339))},
+		"objectId": {NewFilter().Match("ownerId", id), NewFilter().Match("ownerId", id.Hex())},
+		"binary":   {NewFilter().Match("hash", []byte("abc")), NewFilter().Match("hash", "YWJj")},
+		"number":   {NewFilter().Match("age", 30), NewFilter().Match("age", "30")},
+	}
+	for name, filters := range different {
+		a, err := filters[0].Canonical()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := filters[1].Canonical()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a == b {
+			t.Fatalf("Expected the %s and its string to have different canonical forms. Got: %s", name, a)
+		}
+	}
+
+	equivalent := map[string][]Filter{
+		"in":     {NewFilter().MatchIn("age", []int{1, 2}), NewFilter().MatchIn("age", []interface{}{2, 1, 2.0})},
+		"nin":    {Filter{"role": map[string]interface{}{"$nin": []string{"admin", "guest"}}}, Filter{"role": map[string]interface{}{"$nin": []string{"guest", "admin", "guest"}}}},
+		"number": {NewFilter().Match("age", 30), NewFilter().Match("age", 30.0)},
+		"time":   {NewFilter().Match("createdAt", created), NewFilter().Match("createdAt", created.In(time.FixedZone("CET", 3600)))},
+	}
+	for name, filters := range equivalent {
+		a, err := filters[0].Canonical()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := filters[1].Canonical()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a != b {
+			t.Fatalf("Expected the equivalent %s filters to have the same canonical form. Got: %s and %s", name, a, b)
+		}
+	}
+}
+
+func TestFilterRange(t *testing.T) {
+	filter := NewFilter().Match("age", 30).MatchGte("age", 18).MatchLt("age", 65).MatchPattern("name", "J%").MatchLte("name", "K")
+
+	age, ok := filter["age"].(map[string]interface{})
+	if !ok || age[OpEq] != 30 || age[OpGte] != 18 || age[OpLt] != 65 {
+		t.Fatal("Expected the exact match and the range on age. Got: ", filter["age"])
+	}
+	name, ok := filter["name"].(map[string]interface{})
+	if !ok || name[OpPattern] != "J%" || name[OpLte] != "K" {
+		t.Fatal("Expected the pattern and the range on name. Got: ", filter["name"])
+	}
+	if _, err := ParseFilter(filter); err != nil {
+		t.Fatal(err)
+	}
+}
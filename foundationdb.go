@@ -0,0 +1,548 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+	"github.com/satori/go.uuid"
+)
+
+// FDB_CTX_KEY is FoundationDB context key
+var FDB_CTX_KEY = "FDB_DATABASE"
+
+// fdbAPIVersion is the FoundationDB API version used by the backend.
+const fdbAPIVersion = 610
+
+// fdbMaxValueSize is the maximal size of a value in FoundationDB.
+const fdbMaxValueSize = 100000
+
+// FDBCollection is a repository stored in FoundationDB.
+// Every record is stored, encoded with the codec of the repository (JSON by default, see Codec), under the key ("<database>", "<repository>", "<id>") (tuple encoded).
+// The records are filtered in memory, unless the filter has an exact match on the id.
+// Every operation runs in a FoundationDB transaction. Multiple operations on multiple repositories can
+// run in a single transaction through FDBBackend.Transact.
+type FDBCollection struct {
+	db      fdb.Database
+	space   subspace.Subspace
+	codec   Codec
+	repoDef RepositoryDefinition
+}
+
+// FDBBackend is a FoundationDB backend. It implements TransactionalBackend.
+type FDBBackend struct {
+	Backend
+	db fdb.Database
+}
+
+// fdbTransaction is a Transaction over FoundationDB transaction.
+type fdbTransaction struct {
+	backend *FDBBackend
+	tr      fdb.Transaction
+}
+
+// fdbTxnRepository is a repository whose operations run within a FoundationDB transaction.
+type fdbTxnRepository struct {
+	collection *FDBCollection
+	tr         fdb.Transaction
+}
+
+// FDBRepoBuilder builds new FoundationDB repository (subspace).
+func FDBRepoBuilder(repoDef RepositoryDefinition, backend Backend) (Repository, error) {
+
+	dbObj := backend.GetFromContext(FDB_CTX_KEY)
+	if dbObj == nil {
+		return nil, ErrBackendError("foundationdb database not configured")
+	}
+
+	db, ok := dbObj.(fdb.Database)
+	if !ok {
+		return nil, ErrBackendError("unknown database type")
+	}
+
+	databaseName := backend.GetConfig().DatabaseName
+	if databaseName == "" {
+		return nil, ErrBackendError("database name is missing and required")
+	}
+
+	repositoryName := repoDef.GetName()
+	if repositoryName == "" {
+		return nil, ErrBackendError("repository name is missing and required")
+	}
+
+	if repoDef.EnableTTL() {
+		return nil, ErrBackendError("TTL is not supported by the foundationdb backend")
+	}
+
+	codec, err := codecFor(repoDef)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FDBCollection{
+		db:      db,
+		space:   subspace.Sub(databaseName, repositoryName),
+		codec:   codec,
+		repoDef: repoDef,
+	}, nil
+}
+
+// FDBBackendBuilder returns FDBBackend.
+// The host is the path to the cluster file. If empty, the default cluster file is used.
+func FDBBackendBuilder(conf *config.DBInfo, manager BackendManager) (Backend, error) {
+
+	if !fdb.IsAPIVersionSelected() {
+		if err := fdb.APIVersion(fdbAPIVersion); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := fdb.OpenDatabase(conf.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.WithValue(context.Background(), FDB_CTX_KEY, db)
+	cleanup := func() {}
+
+	return &FDBBackend{
+		Backend: NewRepositoriesBackend(ctx, conf, FDBRepoBuilder, cleanup),
+		db:      db,
+	}, nil
+}
+
+// Transact runs the function in a FoundationDB transaction. The operations on all repositories obtained from
+// the transaction are committed atomically. The function is retried on conflicts, so it must be idempotent.
+// The deadline of the context is the timeout of the transaction, including its commit, and no attempt is started
+// once the context is done.
+func (b *FDBBackend) Transact(ctx context.Context, fn func(tx Transaction) error) error {
+	_, err := b.db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			timeout := int64(time.Until(deadline) / time.Millisecond)
+			if timeout < 1 {
+				return nil, context.DeadlineExceeded
+			}
+			if err := tr.Options().SetTimeout(timeout); err != nil {
+				return nil, err
+			}
+		}
+		return nil, fn(&fdbTransaction{
+			backend: b,
+			tr:      tr,
+		})
+	})
+	if ctxErr := ctx.Err(); err != nil && ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+// GetRepository returns the repository with its operations running within the transaction. It is wrapped like the
+// repository of the backend, so the data schema, the versions, the enums, the model and the soft deletes apply to the
+// transaction.
+func (t *fdbTransaction) GetRepository(name string) (Repository, error) {
+	repo, err := t.backend.GetRepository(name)
+	if err != nil {
+		return nil, err
+	}
+	collection, ok := unwrapRepository(repo).(*FDBCollection)
+	if !ok {
+		return nil, ErrBackendError(fmt.Sprintf("repository %s is not a foundationdb repository", name))
+	}
+	return wrapRepository(&fdbTxnRepository{
+		collection: collection,
+		tr:         t.tr,
+	}, collection.repoDef)
+}
+
+// GetOne fetches only one record for given filter
+func (c *FDBCollection) GetOne(filter Filter, result interface{}) (interface{}, error) {
+	records, err := c.read(filter)
+	if err != nil {
+		return nil, err
+	}
+	return c.getOne(records, result)
+}
+
+// GetAll fetches all matched records for given filter
+func (c *FDBCollection) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	records, err := c.read(filter)
+	if err != nil {
+		return nil, err
+	}
+	return c.getAll(records, resultsTypeHint, order, sorting, limit, offset)
+}
+
+// Count returns the number of records that match the filter.
+func (c *FDBCollection) Count(filter Filter) (int64, error) {
+	records, err := c.read(filter)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(records)), nil
+}
+
+// Exists reports whether a record matches the filter.
+func (c *FDBCollection) Exists(filter Filter) (bool, error) {
+	records, err := c.read(filter)
+	if err != nil {
+		return false, err
+	}
+	return len(records) > 0, nil
+}
+
+// Save creates new record unless it does not exist, otherwise it updates the record
+func (c *FDBCollection) Save(object interface{}, filter Filter) (interface{}, error) {
+	return c.db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		return c.save(tr, object, filter)
+	})
+}
+
+// SaveAll creates the objects (a slice) as new records, in a single transaction. Returns the created records, as
+// returned by Save. Nothing is created if any of the records already exists.
+func (c *FDBCollection) SaveAll(objects interface{}) (interface{}, error) {
+	return c.db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		return c.saveAll(tr, objects)
+	})
+}
+
+// UpdateAll updates all matched records for given filter with the properties of the update, in a single
+// transaction. Returns the number of the updated records.
+func (c *FDBCollection) UpdateAll(filter Filter, update interface{}) (int64, error) {
+	updated, err := c.db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		return c.updateAll(tr, filter, update)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return updated.(int64), nil
+}
+
+// DeleteOne deletes only one record for given filter
+func (c *FDBCollection) DeleteOne(filter Filter) error {
+	_, err := c.db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		return nil, c.deleteOne(tr, filter)
+	})
+	return err
+}
+
+// DeleteAll deletes all matched records for given filter
+func (c *FDBCollection) DeleteAll(filter Filter) error {
+	_, err := c.db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		return nil, c.deleteAll(tr, filter)
+	})
+	return err
+}
+
+// GetOne fetches only one record for given filter
+func (r *fdbTxnRepository) GetOne(filter Filter, result interface{}) (interface{}, error) {
+	records, err := r.collection.find(r.tr, filter)
+	if err != nil {
+		return nil, err
+	}
+	return r.collection.getOne(records, result)
+}
+
+// GetAll fetches all matched records for given filter
+func (r *fdbTxnRepository) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	records, err := r.collection.find(r.tr, filter)
+	if err != nil {
+		return nil, err
+	}
+	return r.collection.getAll(records, resultsTypeHint, order, sorting, limit, offset)
+}
+
+// Count returns the number of records that match the filter.
+func (r *fdbTxnRepository) Count(filter Filter) (int64, error) {
+	records, err := r.collection.find(r.tr, filter)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(records)), nil
+}
+
+// Exists reports whether a record matches the filter.
+func (r *fdbTxnRepository) Exists(filter Filter) (bool, error) {
+	records, err := r.collection.find(r.tr, filter)
+	if err != nil {
+		return false, err
+	}
+	return len(records) > 0, nil
+}
+
+// Save creates new record unless it does not exist, otherwise it updates the record
+func (r *fdbTxnRepository) Save(object interface{}, filter Filter) (interface{}, error) {
+	return r.collection.save(r.tr, object, filter)
+}
+
+// SaveAll creates the objects (a slice) as new records.
+func (r *fdbTxnRepository) SaveAll(objects interface{}) (interface{}, error) {
+	return r.collection.saveAll(r.tr, objects)
+}
+
+// UpdateAll updates all matched records for given filter with the properties of the update.
+func (r *fdbTxnRepository) UpdateAll(filter Filter, update interface{}) (int64, error) {
+	return r.collection.updateAll(r.tr, filter, update)
+}
+
+// DeleteOne deletes only one record for given filter
+func (r *fdbTxnRepository) DeleteOne(filter Filter) error {
+	return r.collection.deleteOne(r.tr, filter)
+}
+
+// DeleteAll deletes all matched records for given filter
+func (r *fdbTxnRepository) DeleteAll(filter Filter) error {
+	return r.collection.deleteAll(r.tr, filter)
+}
+
+// read finds the records that match the filter in a read-only transaction.
+func (c *FDBCollection) read(filter Filter) ([]fdb.KeyValue, error) {
+	records, err := c.db.ReadTransact(func(rtr fdb.ReadTransaction) (interface{}, error) {
+		return c.find(rtr, filter)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records.([]fdb.KeyValue), nil
+}
+
+func (c *FDBCollection) getOne(records []fdb.KeyValue, result interface{}) (interface{}, error) {
+	if len(records) == 0 {
+		return nil, ErrNotFound("record not found")
+	}
+
+	record, err := c.codec.Unmarshal(records[0].Value)
+	if err != nil {
+		return nil, ErrBackendError(err)
+	}
+
+	err = MapToInterface(&record, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (c *FDBCollection) getAll(records []fdb.KeyValue, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	values := []map[string]interface{}{}
+	for _, kv := range records {
+		value, err := c.codec.Unmarshal(kv.Value)
+		if err != nil {
+			return nil, ErrBackendError(err)
+		}
+		values = append(values, value)
+	}
+
+	values, err := filterRecords(values, nil, order, sorting, limit, offset)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+
+	return recordsToResults(values, resultsTypeHint)
+}
+
+func (c *FDBCollection) save(tr fdb.Transaction, object interface{}, filter Filter) (interface{}, error) {
+
+	var result interface{}
+
+	payload, err := InterfaceToMap(object)
+	if err != nil {
+		return nil, err
+	}
+
+	var key fdb.Key
+	record := map[string]interface{}{}
+
+	if filter == nil {
+		for k, v := range *payload {
+			record[k] = v
+		}
+		if id, ok := record["id"]; !ok || id == nil || id == "" {
+			id, err := uuid.NewV4()
+			if err != nil {
+				return nil, err
+			}
+			record["id"] = id.String()
+		}
+
+		key = c.key(record["id"])
+		existing, err := tr.Get(key).Get()
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			return nil, ErrAlreadyExists("record already exists!")
+		}
+	} else {
+		records, err := c.find(tr, filter)
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == 0 {
+			return nil, ErrNotFound("record not found")
+		}
+
+		key = records[0].Key
+		if record, err = c.codec.Unmarshal(records[0].Value); err != nil {
+			return nil, ErrBackendError(err)
+		}
+		for k, v := range *payload {
+			if k == "id" {
+				// the id is immutable
+				continue
+			}
+			record[k] = v
+		}
+	}
+
+	if err := c.write(tr, key, record); err != nil {
+		return nil, err
+	}
+
+	err = MapToInterface(&record, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (c *FDBCollection) saveAll(tr fdb.Transaction, objects interface{}) (interface{}, error) {
+	records, err := objectsToRecords(objects)
+	if err != nil {
+		return nil, err
+	}
+	saved := []interface{}{}
+	for _, record := range records {
+		// the transaction reads its own writes, so the duplicates within the objects are found as well
+		result, err := c.save(tr, &record, nil)
+		if err != nil {
+			return nil, err
+		}
+		saved = append(saved, result)
+	}
+	return saved, nil
+}
+
+func (c *FDBCollection) updateAll(tr fdb.Transaction, filter Filter, update interface{}) (int64, error) {
+	payload, err := InterfaceToMap(update)
+	if err != nil {
+		return 0, err
+	}
+
+	records, err := c.find(tr, filter)
+	if err != nil {
+		return 0, err
+	}
+	for _, kv := range records {
+		record, err := c.codec.Unmarshal(kv.Value)
+		if err != nil {
+			return 0, ErrBackendError(err)
+		}
+		for k, v := range *payload {
+			if k == "id" {
+				// the id is immutable
+				continue
+			}
+			record[k] = v
+		}
+		if err := c.write(tr, kv.Key, record); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(records)), nil
+}
+
+// write encodes the record and sets it under the key in the transaction.
+func (c *FDBCollection) write(tr fdb.Transaction, key fdb.Key, record map[string]interface{}) error {
+	value, err := c.codec.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if len(value) > fdbMaxValueSize {
+		return ErrInvalidInput(fmt.Sprintf("record is larger than %d bytes", fdbMaxValueSize))
+	}
+	tr.Set(key, value)
+	return nil
+}
+
+func (c *FDBCollection) deleteOne(tr fdb.Transaction, filter Filter) error {
+	records, err := c.find(tr, filter)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return ErrNotFound("record not found")
+	}
+	tr.Clear(records[0].Key)
+	return nil
+}
+
+func (c *FDBCollection) deleteAll(tr fdb.Transaction, filter Filter) error {
+	if len(filter) == 0 {
+		tr.ClearRange(c.space)
+		return nil
+	}
+
+	records, err := c.find(tr, filter)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		tr.Clear(record.Key)
+	}
+	return nil
+}
+
+// key returns the FoundationDB key for the record with the given id.
+func (c *FDBCollection) key(id interface{}) fdb.Key {
+	return c.space.Pack(tuple.Tuple{fmt.Sprintf("%v", id)})
+}
+
+// find returns the records (keys and JSON values) that match the filter.
+// If the filter has an exact match on the id, only that key is read, otherwise
+// all records of the repository are read and matched in memory.
+func (c *FDBCollection) find(rtr fdb.ReadTransaction, filter Filter) ([]fdb.KeyValue, error) {
+	matcher, err := toRecordMatcher(filter)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+
+	var candidates []fdb.KeyValue
+	if id, ok := filter["id"]; ok && !isFilterSpec(id) {
+		key := c.key(id)
+		value, err := rtr.Get(key).Get()
+		if err != nil {
+			return nil, err
+		}
+		if value != nil {
+			candidates = []fdb.KeyValue{{Key: key, Value: value}}
+		}
+	} else {
+		candidates, err = rtr.GetRange(c.space, fdb.RangeOptions{}).GetSliceWithError()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	records := []fdb.KeyValue{}
+	for _, kv := range candidates {
+		value, err := c.codec.Unmarshal(kv.Value)
+		if err != nil {
+			return nil, ErrBackendError(err)
+		}
+		if matcher(value) {
+			records = append(records, kv)
+		}
+	}
+
+	return records, nil
+}
@@ -0,0 +1,92 @@
+package backends
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func TestFDBRepoBuilder(t *testing.T) {
+	backend := NewRepositoriesBackend(context.Background(), &config.DBInfo{DatabaseName: "testdb"}, FDBRepoBuilder, nil)
+	if _, err := backend.DefineRepository("users", RepositoryDefinitionMap{"name": "users"}); err == nil {
+		t.Fatal("Expected error when foundationdb database is not configured")
+	}
+}
+
+func TestFDBIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode.")
+	}
+
+	bm := NewBackendSupport(map[string]*config.DBInfo{
+		"foundationdb": &config.DBInfo{
+			DatabaseName: "testdb",
+		},
+	})
+
+	backend, err := bm.GetBackend("foundationdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"test_orders", "test_stock"} {
+		repo, err := backend.DefineRepository(name, RepositoryDefinitionMap{"name": name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer repo.DeleteAll(nil)
+	}
+
+	stock, _ := backend.GetRepository("test_stock")
+	if _, err = stock.Save(&map[string]interface{}{"id": "item1", "available": 1}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	txBackend, ok := backend.(TransactionalBackend)
+	if !ok {
+		t.Fatal("Expected foundationdb backend to be transactional")
+	}
+
+	err = txBackend.Transact(context.Background(), func(tx Transaction) error {
+		orders, err := tx.GetRepository("test_orders")
+		if err != nil {
+			return err
+		}
+		txStock, err := tx.GetRepository("test_stock")
+		if err != nil {
+			return err
+		}
+		if _, err = orders.Save(&map[string]interface{}{"id": "order1", "item": "item1"}, nil); err != nil {
+			return err
+		}
+		_, err = txStock.Save(&map[string]interface{}{"available": 0}, NewFilter().Match("id", "item1"))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a failed transaction leaves no changes behind
+	err = txBackend.Transact(context.Background(), func(tx Transaction) error {
+		orders, err := tx.GetRepository("test_orders")
+		if err != nil {
+			return err
+		}
+		if _, err = orders.Save(&map[string]interface{}{"id": "order2", "item": "item1"}, nil); err != nil {
+			return err
+		}
+		return ErrInvalidInput("out of stock")
+	})
+	if err == nil {
+		t.Fatal("Expected the transaction error")
+	}
+
+	orders, _ := backend.GetRepository("test_orders")
+	if _, err = orders.GetOne(NewFilter().Match("id", "order2"), &map[string]interface{}{}); err == nil {
+		t.Fatal("Expected order2 to be rolled back")
+	}
+	if _, err = orders.GetOne(NewFilter().Match("id", "order1"), &map[string]interface{}{}); err != nil {
+		t.Fatal(err)
+	}
+}
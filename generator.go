@@ -0,0 +1,309 @@
+package backends
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FieldGenerator generates the value of a field of a fake record. The index is the index of the record, starting
+// at 0.
+type FieldGenerator func(r *rand.Rand, index int) interface{}
+
+// GeneratorSchema maps the fields of the fake records to their generators. The fields of embedded documents are
+// given as paths ("address.city").
+type GeneratorSchema map[string]FieldGenerator
+
+// GeneratorOptions configures the generation of fake records.
+type GeneratorOptions struct {
+	// Count is the number of records to generate.
+	Count int
+	// BatchSize is the number of records saved with a single SaveAll. Default is 100.
+	BatchSize int
+	// Seed seeds the random values. The same seed and schema generate the same records. Default is the current time.
+	Seed int64
+	// OnProgress is called after every saved batch with the number of records saved so far.
+	OnProgress func(saved int)
+}
+
+// generatorOmitted is returned by the generators of the fields left out of a record (see Optional).
+var generatorOmitted = &struct{}{}
+
+// Generate generates fake records by the schema and saves them into the repository, in batches. Use it to fill
+// a repository for load testing:
+//
+//	saved, err := backends.Generate(userRepo, backends.GeneratorSchema{
+//		"id":        backends.Sequence("user-"),
+//		"name":      backends.FullName(),
+//		"email":     backends.Email("example.com"),
+//		"status":    backends.Weighted(map[interface{}]int{"active": 90, "suspended": 9, "deleted": 1}),
+//		"age":       backends.NormalInt(35, 12, 18, 90),
+//		"createdAt": backends.TimeBetween(time.Now().AddDate(-2, 0, 0), time.Now()),
+//		"phone":     backends.Optional(0.3, backends.Digits(9)),
+//	}, &backends.GeneratorOptions{Count: 1000000, Seed: 42})
+//
+// The generated values are fake (no real data is used), so the records can be shared freely. Returns the number of
+// saved records.
+func Generate(repo Repository, schema GeneratorSchema, options *GeneratorOptions) (int, error) {
+	if options == nil || options.Count < 1 {
+		return 0, ErrInvalidInput("count must be greater than zero")
+	}
+	batchSize := options.BatchSize
+	if batchSize < 1 {
+		batchSize = 100
+	}
+	seed := options.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	r := rand.New(rand.NewSource(seed))
+
+	fields := schema.fields()
+	saved := 0
+	for saved < options.Count {
+		batch := []map[string]interface{}{}
+		for i := saved; i < options.Count && len(batch) < batchSize; i++ {
+			batch = append(batch, schema.record(fields, r, i))
+		}
+		if _, err := repo.SaveAll(batch); err != nil {
+			return saved, err
+		}
+		saved += len(batch)
+		if options.OnProgress != nil {
+			options.OnProgress(saved)
+		}
+	}
+	return saved, nil
+}
+
+// Record generates a single fake record with the given index.
+func (s GeneratorSchema) Record(r *rand.Rand, index int) map[string]interface{} {
+	return s.record(s.fields(), r, index)
+}
+
+// fields returns the fields of the schema, sorted. The fields are generated in the same order every time, so the
+// seed gives the same records.
+func (s GeneratorSchema) fields() []string {
+	fields := make([]string, 0, len(s))
+	for field := range s {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// record generates the fields of a record.
+func (s GeneratorSchema) record(fields []string, r *rand.Rand, index int) map[string]interface{} {
+	record := map[string]interface{}{}
+	for _, field := range fields {
+		value := s[field](r, index)
+		if value == generatorOmitted {
+			continue
+		}
+		setRecordPath(record, field, value)
+	}
+	return record
+}
+
+// setRecordPath sets the value of the field given as a path ("address.city").
+func setRecordPath(record map[string]interface{}, path string, value interface{}) {
+	segments := strings.Split(path, ".")
+	for _, segment := range segments[:len(segments)-1] {
+		nested, ok := record[segment].(map[string]interface{})
+		if !ok {
+			nested = map[string]interface{}{}
+			record[segment] = nested
+		}
+		record = nested
+	}
+	record[segments[len(segments)-1]] = value
+}
+
+// Sequence generates unique ids: the prefix followed by the index of the record.
+func Sequence(prefix string) FieldGenerator {
+	return func(r *rand.Rand, index int) interface{} {
+		return fmt.Sprintf("%s%d", prefix, index)
+	}
+}
+
+// Constant generates the same value for every record.
+func Constant(value interface{}) FieldGenerator {
+	return func(r *rand.Rand, index int) interface{} {
+		return value
+	}
+}
+
+// OneOf picks one of the values, uniformly.
+func OneOf(values ...interface{}) FieldGenerator {
+	return func(r *rand.Rand, index int) interface{} {
+		return values[r.Intn(len(values))]
+	}
+}
+
+// Weighted picks one of the values, with the probability proportional to its weight.
+func Weighted(weights map[interface{}]int) FieldGenerator {
+	values := []interface{}{}
+	for value := range weights {
+		values = append(values, value)
+	}
+	// the values are picked in the same order every time, so the seed gives the same records
+	sort.Slice(values, func(i, j int) bool {
+		return fmt.Sprint(values[i]) < fmt.Sprint(values[j])
+	})
+	total := 0
+	for _, value := range values {
+		total += weights[value]
+	}
+	return func(r *rand.Rand, index int) interface{} {
+		n := r.Intn(total)
+		for _, value := range values {
+			n -= weights[value]
+			if n < 0 {
+				return value
+			}
+		}
+		return values[len(values)-1]
+	}
+}
+
+// IntBetween generates integers between min and max (inclusive), uniformly.
+func IntBetween(min, max int) FieldGenerator {
+	return func(r *rand.Rand, index int) interface{} {
+		return min + r.Intn(max-min+1)
+	}
+}
+
+// NormalInt generates normally distributed integers with the mean and the standard deviation, clamped to min and max.
+func NormalInt(mean, stddev float64, min, max int) FieldGenerator {
+	return func(r *rand.Rand, index int) interface{} {
+		value := int(math.Round(r.NormFloat64()*stddev + mean))
+		if value < min {
+			return min
+		}
+		if value > max {
+			return max
+		}
+		return value
+	}
+}
+
+// Zipf generates integers between 0 and max with a Zipf (power law) distribution: 0 is the most frequent value,
+// and the higher the skew, the more frequent it is. The skew must be greater than 1. Use it for the skewed fields,
+// like the owners of the records or the tags.
+func Zipf(skew float64, max uint64) FieldGenerator {
+	if skew <= 1 {
+		skew = 1.01
+	}
+	var zipf *rand.Zipf
+	var source *rand.Rand
+	return func(r *rand.Rand, index int) interface{} {
+		if source != r {
+			zipf = rand.NewZipf(r, skew, 1, max)
+			source = r
+		}
+		return int(zipf.Uint64())
+	}
+}
+
+// Bool generates true with the probability.
+func Bool(probability float64) FieldGenerator {
+	return func(r *rand.Rand, index int) interface{} {
+		return r.Float64() < probability
+	}
+}
+
+// TimeBetween generates times between from and to, uniformly.
+func TimeBetween(from, to time.Time) FieldGenerator {
+	span := to.Sub(from)
+	return func(r *rand.Rand, index int) interface{} {
+		if span <= 0 {
+			return from
+		}
+		return from.Add(time.Duration(r.Int63n(int64(span))))
+	}
+}
+
+// Digits generates strings of n random digits, for example phone numbers.
+func Digits(n int) FieldGenerator {
+	return func(r *rand.Rand, index int) interface{} {
+		digits := make([]byte, n)
+		for i := range digits {
+			digits[i] = byte('0' + r.Intn(10))
+		}
+		return string(digits)
+	}
+}
+
+// Words generates text of min to max words.
+func Words(min, max int) FieldGenerator {
+	return func(r *rand.Rand, index int) interface{} {
+		n := min + r.Intn(max-min+1)
+		words := make([]string, n)
+		for i := range words {
+			words[i] = generatorWords[r.Intn(len(generatorWords))]
+		}
+		return strings.Join(words, " ")
+	}
+}
+
+// FirstName generates first names.
+func FirstName() FieldGenerator {
+	return func(r *rand.Rand, index int) interface{} {
+		return generatorFirstNames[r.Intn(len(generatorFirstNames))]
+	}
+}
+
+// LastName generates last names.
+func LastName() FieldGenerator {
+	return func(r *rand.Rand, index int) interface{} {
+		return generatorLastNames[r.Intn(len(generatorLastNames))]
+	}
+}
+
+// FullName generates first and last names.
+func FullName() FieldGenerator {
+	return func(r *rand.Rand, index int) interface{} {
+		return generatorFirstNames[r.Intn(len(generatorFirstNames))] + " " + generatorLastNames[r.Intn(len(generatorLastNames))]
+	}
+}
+
+// Email generates unique email addresses in the domain. The index of the record is part of the address, so the
+// addresses can be used for the fields with a unique index.
+func Email(domain string) FieldGenerator {
+	return func(r *rand.Rand, index int) interface{} {
+		first := generatorFirstNames[r.Intn(len(generatorFirstNames))]
+		last := generatorLastNames[r.Intn(len(generatorLastNames))]
+		return strings.ToLower(fmt.Sprintf("%s.%s%d@%s", first, last, index, domain))
+	}
+}
+
+// Optional leaves the field out of the record with the probability, otherwise it is generated by the generator.
+func Optional(probability float64, generator FieldGenerator) FieldGenerator {
+	return func(r *rand.Rand, index int) interface{} {
+		if r.Float64() < probability {
+			return generatorOmitted
+		}
+		return generator(r, index)
+	}
+}
+
+var generatorFirstNames = []string{
+	"Alice", "Bob", "Carol", "Dave", "Eve", "Frank", "Grace", "Heidi", "Ivan", "Judy",
+	"Karl", "Laura", "Mallory", "Nina", "Oscar", "Peggy", "Quinn", "Rupert", "Sybil", "Trent",
+	"Ursula", "Victor", "Wendy", "Xavier", "Yvonne", "Zoran",
+}
+
+var generatorLastNames = []string{
+	"Anderson", "Brown", "Clark", "Davis", "Evans", "Fisher", "Garcia", "Harris", "Ivanov", "Jones",
+	"King", "Lee", "Miller", "Nowak", "Olsen", "Petrov", "Quinn", "Rossi", "Smith", "Taylor",
+	"Ulrich", "Vasquez", "Walker", "Xu", "Young", "Zimmerman",
+}
+
+var generatorWords = []string{
+	"lorem", "ipsum", "dolor", "sit", "amet", "consectetur", "adipiscing", "elit", "sed", "do",
+	"eiusmod", "tempor", "incididunt", "ut", "labore", "et", "dolore", "magna", "aliqua", "enim",
+	"ad", "minim", "veniam", "quis", "nostrud", "exercitation", "ullamco", "laboris", "nisi", "aliquip",
+}
@@ -0,0 +1,87 @@
+package backends
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func TestGenerate(t *testing.T) {
+	backend, err := CacheBackendBuilder(&config.DBInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Shutdown()
+
+	schema := GeneratorSchema{
+		"id":           Sequence("user-"),
+		"name":         FullName(),
+		"email":        Email("example.com"),
+		"status":       Weighted(map[interface{}]int{"active": 9, "suspended": 1, "deleted": 0}),
+		"age":          NormalInt(35, 12, 18, 90),
+		"score":        Zipf(1.5, 100),
+		"createdAt":    TimeBetween(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)),
+		"phone":        Optional(0.5, Digits(9)),
+		"address.city": OneOf("Skopje", "Bitola"),
+	}
+
+	records := map[string][]map[string]interface{}{}
+	for _, name := range []string{"users", "copy"} {
+		repo, err := backend.DefineRepository(name, RepositoryDefinitionMap{"name": name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		progress := []int{}
+		saved, err := Generate(repo, schema, &GeneratorOptions{
+			Count:     250,
+			BatchSize: 100,
+			Seed:      42,
+			OnProgress: func(saved int) {
+				progress = append(progress, saved)
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if saved != 250 || !reflect.DeepEqual(progress, []int{100, 200, 250}) {
+			t.Fatal("Expected 250 records saved in 3 batches. Got: ", saved, progress)
+		}
+		results, err := repo.GetAll(nil, &map[string]interface{}{}, "id", "asc", 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records[name], err = syncRecords(results)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !reflect.DeepEqual(records["users"], records["copy"]) {
+		t.Fatal("Expected the same seed to generate the same records")
+	}
+
+	withPhone := 0
+	for _, record := range records["users"] {
+		if record["status"] == "deleted" {
+			t.Fatal("Expected no values with zero weight. Got: ", record)
+		}
+		if age := record["age"].(float64); age < 18 || age > 90 {
+			t.Fatal("Expected the age to be clamped. Got: ", age)
+		}
+		if address, ok := record["address"].(map[string]interface{}); !ok || (address["city"] != "Skopje" && address["city"] != "Bitola") {
+			t.Fatal("Expected the embedded city. Got: ", record["address"])
+		}
+		if _, ok := record["phone"]; ok {
+			withPhone++
+		}
+	}
+	if withPhone == 0 || withPhone == len(records["users"]) {
+		t.Fatal("Expected the phone to be left out of some records. Got: ", withPhone)
+	}
+
+	if _, err := Generate(newTestRepository(), schema, nil); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input error without the count. Got: ", err)
+	}
+}
@@ -0,0 +1,198 @@
+package backends
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// GrowthLimits are the soft limits of a repository. Zero means no limit.
+type GrowthLimits struct {
+	// MaxRecords is the number of records above which an alert is raised.
+	MaxRecords int64
+	// MaxSizeBytes is the storage size above which an alert is raised. Ignored if the backend does not report
+	// the size of the repository (see GetStats).
+	MaxSizeBytes int64
+}
+
+// GrowthAlert is raised when a repository exceeds its soft limits.
+type GrowthAlert struct {
+	// Repository is the name of the repository.
+	Repository string
+	// Stats are the statistics of the repository at the time of the check.
+	Stats RepositoryStats
+	// Limits are the limits of the repository.
+	Limits GrowthLimits
+	// RecordsExceeded is true if the number of records exceeds the limit.
+	RecordsExceeded bool
+	// SizeExceeded is true if the storage size exceeds the limit.
+	SizeExceeded bool
+	// CheckedAt is the time of the check.
+	CheckedAt time.Time
+}
+
+// GrowthMonitorOptions configures a GrowthMonitor.
+type GrowthMonitorOptions struct {
+	// Interval is the time between the checks. Default is one hour.
+	Interval time.Duration
+	// OnAlert is called when a repository exceeds its limits. It is called once when the limits are exceeded,
+	// and again only after the repository is back within the limits and exceeds them again.
+	OnAlert func(alert *GrowthAlert)
+	// OnStats is called with the statistics of every checked repository, for example to export them as metrics.
+	OnStats func(repository string, stats *RepositoryStats)
+	// OnError is called when the statistics of a repository cannot be read. Default is to log the error.
+	OnError func(repository string, err error)
+}
+
+// GrowthMonitor checks the growth of the repositories of a backend on a schedule, and raises alerts when
+// they exceed their soft limits, so the capacity issues surface before DynamoDB throttles or the MongoDB disks fill:
+//
+//	monitor := backends.NewGrowthMonitor(backend, &backends.GrowthMonitorOptions{
+//		Interval: 30 * time.Minute,
+//		OnAlert: func(alert *backends.GrowthAlert) {
+//			log.Printf("repository %s has %d records", alert.Repository, alert.Stats.Records)
+//		},
+//	})
+//	monitor.Limit("events", backends.GrowthLimits{MaxRecords: 10000000, MaxSizeBytes: 50 << 30})
+//	monitor.Start()
+//	defer monitor.Stop()
+//
+// The statistics are read with GetStats.
+type GrowthMonitor struct {
+	backend  Backend
+	options  *GrowthMonitorOptions
+	limits   map[string]GrowthLimits
+	exceeded map[string]bool
+	mutex    *sync.Mutex
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewGrowthMonitor creates new GrowthMonitor for the repositories of the backend.
+func NewGrowthMonitor(backend Backend, options *GrowthMonitorOptions) *GrowthMonitor {
+	if options == nil {
+		options = &GrowthMonitorOptions{}
+	}
+	if options.Interval <= 0 {
+		options.Interval = time.Hour
+	}
+	if options.OnError == nil {
+		options.OnError = func(repository string, err error) {
+			log.Printf("WARN: failed to read the statistics of repository %s: %s\n", repository, err.Error())
+		}
+	}
+	return &GrowthMonitor{
+		backend:  backend,
+		options:  options,
+		limits:   map[string]GrowthLimits{},
+		exceeded: map[string]bool{},
+		mutex:    &sync.Mutex{},
+	}
+}
+
+// Limit sets the soft limits of the repository.
+func (m *GrowthMonitor) Limit(repository string, limits GrowthLimits) *GrowthMonitor {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.limits[repository] = limits
+	return m
+}
+
+// Check checks all repositories with limits once, and returns the alerts raised by this check.
+func (m *GrowthMonitor) Check() []*GrowthAlert {
+	m.mutex.Lock()
+	limits := map[string]GrowthLimits{}
+	for repository, repoLimits := range m.limits {
+		limits[repository] = repoLimits
+	}
+	m.mutex.Unlock()
+
+	alerts := []*GrowthAlert{}
+	for repository, repoLimits := range limits {
+		alert, err := m.check(repository, repoLimits)
+		if err != nil {
+			m.options.OnError(repository, err)
+			continue
+		}
+		if alert != nil {
+			alerts = append(alerts, alert)
+			if m.options.OnAlert != nil {
+				m.options.OnAlert(alert)
+			}
+		}
+	}
+	return alerts
+}
+
+// check checks the repository. Returns an alert if the repository has just exceeded its limits.
+func (m *GrowthMonitor) check(repository string, limits GrowthLimits) (*GrowthAlert, error) {
+	repo, err := m.backend.GetRepository(repository)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := GetStats(repo)
+	if err != nil {
+		return nil, err
+	}
+	if m.options.OnStats != nil {
+		m.options.OnStats(repository, stats)
+	}
+
+	alert := &GrowthAlert{
+		Repository:      repository,
+		Stats:           *stats,
+		Limits:          limits,
+		RecordsExceeded: limits.MaxRecords > 0 && stats.Records > limits.MaxRecords,
+		SizeExceeded:    limits.MaxSizeBytes > 0 && stats.SizeBytes > limits.MaxSizeBytes,
+		CheckedAt:       time.Now(),
+	}
+	exceeded := alert.RecordsExceeded || alert.SizeExceeded
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	wasExceeded := m.exceeded[repository]
+	m.exceeded[repository] = exceeded
+	if !exceeded || wasExceeded {
+		return nil, nil
+	}
+	return alert, nil
+}
+
+// Start starts checking the repositories in the background, every Interval. The first check is done immediately.
+func (m *GrowthMonitor) Start() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.stop != nil {
+		return
+	}
+	m.stop = make(chan struct{})
+	m.done = make(chan struct{})
+
+	go func(stop chan struct{}, done chan struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(m.options.Interval)
+		defer ticker.Stop()
+		for {
+			m.Check()
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}(m.stop, m.done)
+}
+
+// Stop stops the background checks and waits for the running check to finish.
+func (m *GrowthMonitor) Stop() {
+	m.mutex.Lock()
+	stop, done := m.stop, m.done
+	m.stop, m.done = nil, nil
+	m.mutex.Unlock()
+
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
@@ -0,0 +1,120 @@
+package backends
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func TestGrowthMonitor(t *testing.T) {
+	backend, err := CacheBackendBuilder(&config.DBInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Shutdown()
+	repo, err := backend.DefineRepository("events", RepositoryDefinitionMap{"name": "events"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mutex := &sync.Mutex{}
+	alerts := []*GrowthAlert{}
+	failed := []string{}
+	checked := map[string]int64{}
+	monitor := NewGrowthMonitor(backend, &GrowthMonitorOptions{
+		OnAlert: func(alert *GrowthAlert) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			alerts = append(alerts, alert)
+		},
+		OnStats: func(repository string, stats *RepositoryStats) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			checked[repository] = stats.Records
+		},
+		OnError: func(repository string, err error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			failed = append(failed, repository)
+		},
+	})
+	monitor.Limit("events", GrowthLimits{MaxRecords: 2}).Limit("missing", GrowthLimits{MaxRecords: 1})
+
+	save := func(id int) {
+		if _, err := repo.Save(&map[string]interface{}{"id": fmt.Sprintf("%d", id)}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	save(1)
+	save(2)
+
+	if raised := monitor.Check(); len(raised) != 0 {
+		t.Fatal("Expected no alerts within the limits. Got: ", raised)
+	}
+	if checked["events"] != 2 || len(failed) != 1 || failed[0] != "missing" {
+		t.Fatal("Expected the stats of events and an error for the missing repository. Got: ", checked, failed)
+	}
+
+	save(3)
+	raised := monitor.Check()
+	if len(raised) != 1 || !raised[0].RecordsExceeded || raised[0].SizeExceeded || raised[0].Stats.Records != 3 {
+		t.Fatal("Expected records exceeded alert. Got: ", raised)
+	}
+	if len(alerts) != 1 {
+		t.Fatal("Expected OnAlert to be called. Got: ", alerts)
+	}
+
+	save(4)
+	if raised := monitor.Check(); len(raised) != 0 {
+		t.Fatal("Expected no repeated alert. Got: ", raised)
+	}
+
+	if err := repo.DeleteAll(nil); err != nil {
+		t.Fatal(err)
+	}
+	monitor.Check()
+	save(1)
+	save(2)
+	save(3)
+	if raised := monitor.Check(); len(raised) != 1 {
+		t.Fatal("Expected a new alert after the repository was back within the limits. Got: ", raised)
+	}
+}
+
+func TestGrowthMonitorStartStop(t *testing.T) {
+	backend, err := CacheBackendBuilder(&config.DBInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Shutdown()
+	if _, err := backend.DefineRepository("events", RepositoryDefinitionMap{"name": "events"}); err != nil {
+		t.Fatal(err)
+	}
+
+	checks := make(chan string, 10)
+	monitor := NewGrowthMonitor(backend, &GrowthMonitorOptions{
+		Interval: 10 * time.Millisecond,
+		OnStats: func(repository string, stats *RepositoryStats) {
+			select {
+			case checks <- repository:
+			default:
+			}
+		},
+	})
+	monitor.Limit("events", GrowthLimits{MaxRecords: 100})
+
+	monitor.Start()
+	monitor.Start()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-checks:
+		case <-time.After(time.Second):
+			t.Fatal("Expected the repository to be checked on schedule")
+		}
+	}
+	monitor.Stop()
+	monitor.Stop()
+}
@@ -2,12 +2,14 @@ package backends
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"reflect"
 	"strings"
 
 	"gopkg.in/mgo.v2/bson"
 
-	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
 // InterfaceToMap converts interface type (struct or map pointer) to *map[string]interface{}
@@ -95,34 +97,132 @@ func IterateOverSlice(slice interface{}, callback func(i int, item interface{})
 	return nil
 }
 
-// stringToObjectID converts _id key from string to bson.ObjectId
-func stringToObjectID(object map[string]interface{}) error {
-	if id, ok := object["id"]; ok {
-		delete(object, "id")
-		if !bson.IsObjectIdHex(id.(string)) {
-			return ErrInvalidInput("id is a invalid hex representation of an ObjectId")
+// objectsToRecords converts the objects of a slice (structs, maps or pointers to them) to records.
+// Returns ErrInvalidInput if objects is not a slice.
+func objectsToRecords(objects interface{}) ([]map[string]interface{}, error) {
+	if objects == nil {
+		return nil, ErrInvalidInput("objects must be a slice")
+	}
+	records := []map[string]interface{}{}
+	err := IterateOverSlice(objects, func(i int, item interface{}) error {
+		record, err := objectToRecord(i, item)
+		if err != nil {
+			return err
 		}
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// objectToRecord converts the i-th object (a struct, a map or a pointer to them) to a record.
+func objectToRecord(i int, object interface{}) (map[string]interface{}, error) {
+	value := reflect.ValueOf(object)
+	if !value.IsValid() || (value.Kind() == reflect.Ptr && value.IsNil()) {
+		return nil, ErrInvalidInput(fmt.Sprintf("object %d is nil", i))
+	}
+	if value.Kind() != reflect.Ptr {
+		// InterfaceToMap needs a pointer
+		ptr := reflect.New(value.Type())
+		ptr.Elem().Set(value)
+		object = ptr.Interface()
+	}
+	record, err := InterfaceToMap(object)
+	if err != nil {
+		return nil, err
+	}
+	return *record, nil
+}
 
-		if reflect.TypeOf(id).String() != "bson.ObjectId" {
-			object["_id"] = bson.ObjectIdHex(id.(string))
+// saveEach creates the records one by one with the save function. Used by the backends without batch writes.
+// Returns the saved records, up to the first failure.
+func saveEach(records []map[string]interface{}, save func(object interface{}, filter Filter) (interface{}, error)) ([]interface{}, error) {
+	saved := []interface{}{}
+	for _, record := range records {
+		record := record
+		result, err := save(&record, nil)
+		if err != nil {
+			return saved, err
 		}
+		saved = append(saved, result)
 	}
+	return saved, nil
+}
 
+// stringToObjectID converts _id key from string to bson.ObjectId. The values of the operators (for example the list
+// of $in) are converted as well.
+func stringToObjectID(object map[string]interface{}) error {
+	id, ok := object["id"]
+	if !ok {
+		return nil
+	}
+	delete(object, "id")
+
+	specs, isSpec, err := toFilterSpecs(id)
+	if err != nil {
+		return err
+	}
+	if !isSpec {
+		objectID, err := toObjectID(id)
+		if err != nil {
+			return err
+		}
+		object["_id"] = objectID
+		return nil
+	}
+
+	converted := map[string]interface{}{}
+	for operator, operand := range specs {
+		switch operator {
+		case OpIn, OpNin:
+			values, ok := toFilterList(operand)
+			if !ok {
+				return ErrInvalidInput(fmt.Sprintf("%s on id must be a list", operator))
+			}
+			objectIDs := make([]interface{}, len(values))
+			for i, value := range values {
+				if objectIDs[i], err = toObjectID(value); err != nil {
+					return err
+				}
+			}
+			converted[operator] = objectIDs
+		case OpPattern, OpRegex:
+			return ErrInvalidInput(fmt.Sprintf("%s is not supported on id", operator))
+		default:
+			if converted[operator], err = toObjectID(operand); err != nil {
+				return err
+			}
+		}
+	}
+	object["_id"] = converted
 	return nil
 }
 
+// toObjectID converts the hex representation of an ObjectId to bson.ObjectId.
+func toObjectID(id interface{}) (bson.ObjectId, error) {
+	if objectID, ok := id.(bson.ObjectId); ok {
+		return objectID, nil
+	}
+	hex, ok := id.(string)
+	if !ok || !bson.IsObjectIdHex(hex) {
+		return "", ErrInvalidInput("id is a invalid hex representation of an ObjectId")
+	}
+	return bson.ObjectIdHex(hex), nil
+}
+
 // IsConditionalCheckErr check if err is dynamoDB condition error
 func IsConditionalCheckErr(err error) bool {
-	if ae, ok := err.(awserr.RequestFailure); ok {
-		return ae.Code() == "ConditionalCheckFailedException"
-	}
-	return false
+	var ce *types.ConditionalCheckFailedException
+	return errors.As(err, &ce)
 }
 
 // contains checks if item is in s array
-func contains(s []*string, item string) bool {
+func contains(s []string, item string) bool {
 	for _, a := range s {
-		if *a == item {
+		if a == item {
 			return true
 		}
 	}
@@ -187,3 +287,27 @@ func valueOrError(val reflect.Value) (reflect.Value, error) {
 	}
 	return val, nil
 }
+
+// recordsToResults decodes the records into a new slice of values of the same type as the results type hint.
+// Returns a pointer to the slice of pointers to the decoded values.
+func recordsToResults(records []map[string]interface{}, resultsTypeHint interface{}) (interface{}, error) {
+	resultsTypeHint = AsPtr(resultsTypeHint)
+	results := NewSliceOfType(resultsTypeHint)
+
+	for _, record := range records {
+		item, err := CreateNewAsExample(resultsTypeHint)
+		if err != nil {
+			return nil, err
+		}
+		if err = MapToInterface(record, item); err != nil {
+			return nil, err
+		}
+		results = reflect.Append(results, reflect.ValueOf(item))
+	}
+
+	// Create a pointer to a slice value and set it to the slice
+	slicePointer := reflect.New(results.Type())
+	slicePointer.Elem().Set(results)
+
+	return slicePointer.Interface(), nil
+}
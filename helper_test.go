@@ -3,6 +3,9 @@ package backends
 import (
 	"fmt"
 	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"gopkg.in/mgo.v2/bson"
 )
 
 func TestInterfaceToMap(t *testing.T) {
@@ -51,17 +54,42 @@ func TestStringToObjectID(t *testing.T) {
 	}
 }
 
+func TestStringToObjectIDOperators(t *testing.T) {
+	filter := Filter{}.MatchIn("id", []string{"5975c461f9f8eb02aae053f3", "5975c461f9f8eb02aae053f4"})
+	if err := stringToObjectID(filter); err != nil {
+		t.Fatal(err)
+	}
+	spec, ok := filter["_id"].(map[string]interface{})
+	if !ok {
+		t.Fatal("Expected the specification of _id. Got: ", filter)
+	}
+	ids := spec[OpIn].([]interface{})
+	if len(ids) != 2 || ids[1] != bson.ObjectIdHex("5975c461f9f8eb02aae053f4") {
+		t.Fatal("Expected the ids converted to ObjectIds. Got: ", ids)
+	}
+
+	if err := stringToObjectID(Filter{}.MatchIn("id", []string{"invalid"})); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for an invalid id. Got: ", err)
+	}
+}
+
 func TestIsConditionalCheckErr(t *testing.T) {
 	ok := IsConditionalCheckErr(fmt.Errorf("Some error"))
 
 	if ok {
 		t.Errorf("Error is not ConditionalCheckFailedException")
 	}
+
+	ok = IsConditionalCheckErr(fmt.Errorf("put item: %w", &types.ConditionalCheckFailedException{}))
+
+	if !ok {
+		t.Errorf("Expected wrapped ConditionalCheckFailedException to be recognized")
+	}
 }
 
 func TestContains(t *testing.T) {
 	val := "value"
-	arr := []*string{&val}
+	arr := []string{val}
 
 	ok := contains(arr, val)
 
@@ -0,0 +1,218 @@
+package backends
+
+// Repository operation names, as passed to the hooks in Operation.Name.
+const (
+	OperationGetOne    = "GetOne"
+	OperationGetAll    = "GetAll"
+	OperationSave      = "Save"
+	OperationDeleteOne = "DeleteOne"
+	OperationDeleteAll = "DeleteAll"
+	OperationCount     = "Count"
+	OperationExists    = "Exists"
+	OperationUpdateAll = "UpdateAll"
+	OperationSaveAll   = "SaveAll"
+)
+
+// Operation describes a repository operation passed to the hooks.
+type Operation struct {
+	// Name is the name of the operation (OperationGetOne, OperationSave etc).
+	Name string
+	// Repository is the name of the repository.
+	Repository string
+	// Backend is the backend that owns the repository. Hooks may use it to access other repositories.
+	Backend Backend
+	// Filter is the filter passed to the operation (if any).
+	Filter Filter
+	// Object is the object passed to Save, or the update passed to UpdateAll.
+	Object interface{}
+	// Order is the property the results of GetAll are ordered by (if any).
+	Order string
+	// Sorting is the sort direction passed to GetAll.
+	Sorting string
+}
+
+// BeforeHook is called before a repository operation. If it returns an error, the operation
+// is not executed and the error is returned to the caller.
+type BeforeHook func(op *Operation) error
+
+// AfterHook is called after a repository operation, with the result and the error of the operation.
+type AfterHook func(op *Operation, result interface{}, err error)
+
+// Hooks holds the hooks called around the repository operations.
+//
+// Execution model:
+//
+// The hooks are called synchronously, on the goroutine that called the repository operation.
+// No lock of this package is held while a hook runs: RepositoriesBackend and DefaultBackendManager
+// never call out (to repository builders, backend builders or hooks) while holding their locks.
+// A hook may therefore call any repository of the same backend or manager, including the repository
+// it is attached to, and may define new repositories. A hook that runs while a repository is being built must not
+// define that repository (see RepositoriesBackend.DefineRepository).
+//
+// Calls made from a hook go through the hooks of the target repository as usual, so a hook that
+// writes to a hooked repository must not trigger itself indefinitely (for example, an audit hook
+// should not be attached to the audit log repository).
+//
+// When combined with a LimitedBackend, wrap the limited backend with the hooks (and not the other way around),
+// so the hooks don't hold a concurrency slot while calling other repositories:
+//
+//	backend = backends.NewHookedBackend(backends.NewLimitedBackend(backend, limiter), hooks)
+type Hooks struct {
+	Before []BeforeHook
+	After  []AfterHook
+}
+
+// HookedBackend is a Backend whose repositories call the hooks around every operation.
+type HookedBackend struct {
+	Backend
+	hooks *Hooks
+}
+
+// NewHookedBackend wraps the backend so the hooks are called around the operations of all of its repositories.
+func NewHookedBackend(backend Backend, hooks *Hooks) Backend {
+	return &HookedBackend{
+		Backend: backend,
+		hooks:   hooks,
+	}
+}
+
+// DefineRepository defines the repository (collection/table) on the underlying backend.
+func (b *HookedBackend) DefineRepository(name string, def RepositoryDefinition) (Repository, error) {
+	repo, err := b.Backend.DefineRepository(name, def)
+	if err != nil {
+		return nil, err
+	}
+	return b.wrap(name, repo), nil
+}
+
+// GetRepository return the repository (collection/table) from the underlying backend.
+func (b *HookedBackend) GetRepository(name string) (Repository, error) {
+	repo, err := b.Backend.GetRepository(name)
+	if err != nil {
+		return nil, err
+	}
+	return b.wrap(name, repo), nil
+}
+
+func (b *HookedBackend) wrap(name string, repo Repository) Repository {
+	return &HookedRepository{
+		Repository: repo,
+		name:       name,
+		backend:    b,
+		hooks:      b.hooks,
+	}
+}
+
+// HookedRepository is a Repository that calls the hooks around every operation.
+type HookedRepository struct {
+	Repository
+	name    string
+	backend Backend
+	hooks   *Hooks
+}
+
+// NewHookedRepository wraps the repository so the hooks are called around every operation.
+// The backend is passed to the hooks in Operation.Backend.
+func NewHookedRepository(name string, repo Repository, backend Backend, hooks *Hooks) Repository {
+	return &HookedRepository{
+		Repository: repo,
+		name:       name,
+		backend:    backend,
+		hooks:      hooks,
+	}
+}
+
+// run calls the before hooks, the operation and then the after hooks.
+func (r *HookedRepository) run(op *Operation, operation func() (interface{}, error)) (interface{}, error) {
+	op.Repository = r.name
+	op.Backend = r.backend
+
+	for _, before := range r.hooks.Before {
+		if err := before(op); err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := operation()
+
+	for _, after := range r.hooks.After {
+		after(op, result, err)
+	}
+
+	return result, err
+}
+
+// GetOne fetches only one record for given filter
+func (r *HookedRepository) GetOne(filter Filter, result interface{}) (interface{}, error) {
+	return r.run(&Operation{Name: OperationGetOne, Filter: filter}, func() (interface{}, error) {
+		return r.Repository.GetOne(filter, result)
+	})
+}
+
+// GetAll fetches all matched records for given filter
+func (r *HookedRepository) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	return r.run(&Operation{Name: OperationGetAll, Filter: filter, Order: order, Sorting: sorting}, func() (interface{}, error) {
+		return r.Repository.GetAll(filter, resultsTypeHint, order, sorting, limit, offset)
+	})
+}
+
+// Save creates new record unless it does not exist, otherwise it updates the record
+func (r *HookedRepository) Save(object interface{}, filter Filter) (interface{}, error) {
+	return r.run(&Operation{Name: OperationSave, Filter: filter, Object: object}, func() (interface{}, error) {
+		return r.Repository.Save(object, filter)
+	})
+}
+
+// DeleteOne deletes only one record for given filter
+func (r *HookedRepository) DeleteOne(filter Filter) error {
+	_, err := r.run(&Operation{Name: OperationDeleteOne, Filter: filter}, func() (interface{}, error) {
+		return nil, r.Repository.DeleteOne(filter)
+	})
+	return err
+}
+
+// DeleteAll deletes all matched records for given filter
+func (r *HookedRepository) DeleteAll(filter Filter) error {
+	_, err := r.run(&Operation{Name: OperationDeleteAll, Filter: filter}, func() (interface{}, error) {
+		return nil, r.Repository.DeleteAll(filter)
+	})
+	return err
+}
+
+// Count returns the number of records that match the filter
+func (r *HookedRepository) Count(filter Filter) (int64, error) {
+	result, err := r.run(&Operation{Name: OperationCount, Filter: filter}, func() (interface{}, error) {
+		return r.Repository.Count(filter)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result.(int64), nil
+}
+
+// Exists reports whether a record matches the filter
+func (r *HookedRepository) Exists(filter Filter) (bool, error) {
+	result, err := r.run(&Operation{Name: OperationExists, Filter: filter}, func() (interface{}, error) {
+		return r.Repository.Exists(filter)
+	})
+	if err != nil {
+		return false, err
+	}
+	return result.(bool), nil
+}
+
+// UpdateAll updates all matched records for given filter
+func (r *HookedRepository) UpdateAll(filter Filter, update interface{}) (int64, error) {
+	result, err := r.run(&Operation{Name: OperationUpdateAll, Filter: filter, Object: update}, func() (interface{}, error) {
+		return r.Repository.UpdateAll(filter, update)
+	})
+	updated, _ := result.(int64)
+	return updated, err
+}
+
+// SaveAll creates the objects as new records
+func (r *HookedRepository) SaveAll(objects interface{}) (interface{}, error) {
+	return r.run(&Operation{Name: OperationSaveAll, Object: objects}, func() (interface{}, error) {
+		return r.Repository.SaveAll(objects)
+	})
+}
@@ -0,0 +1,329 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+// testRepository is a simple in-memory Repository used in tests.
+type testRepository struct {
+	mutex   *sync.Mutex
+	records []map[string]interface{}
+}
+
+func newTestRepository() *testRepository {
+	return &testRepository{
+		mutex:   &sync.Mutex{},
+		records: []map[string]interface{}{},
+	}
+}
+
+func (r *testRepository) GetOne(filter Filter, result interface{}) (interface{}, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	records, err := filterRecords(r.records, filter, "", "", 1, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrNotFound("record not found")
+	}
+	err = MapToInterface(records[0], &result)
+	return result, err
+}
+
+func (r *testRepository) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	records, err := filterRecords(r.records, filter, order, sorting, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return recordsToResults(records, resultsTypeHint)
+}
+
+func (r *testRepository) Save(object interface{}, filter Filter) (interface{}, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	record := map[string]interface{}{}
+	if err := MapToInterface(object, &record); err != nil {
+		return nil, err
+	}
+	r.records = append(r.records, record)
+	return object, nil
+}
+
+func (r *testRepository) DeleteOne(filter Filter) error {
+	return r.DeleteAll(filter)
+}
+
+func (r *testRepository) DeleteAll(filter Filter) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	matcher, err := toRecordMatcher(filter)
+	if err != nil {
+		return err
+	}
+	kept := []map[string]interface{}{}
+	for _, record := range r.records {
+		if !matcher(record) {
+			kept = append(kept, record)
+		}
+	}
+	r.records = kept
+	return nil
+}
+
+func (r *testRepository) Count(filter Filter) (int64, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	records, err := filterRecords(r.records, filter, "", "", 0, 0)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(records)), nil
+}
+
+func (r *testRepository) UpdateAll(filter Filter, update interface{}) (int64, error) {
+	payload, err := InterfaceToMap(update)
+	if err != nil {
+		return 0, err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	matcher, err := toRecordMatcher(filter)
+	if err != nil {
+		return 0, err
+	}
+	var updated int64
+	for _, record := range r.records {
+		if matcher(record) {
+			for k, v := range *payload {
+				record[k] = v
+			}
+			updated++
+		}
+	}
+	return updated, nil
+}
+
+func (r *testRepository) Exists(filter Filter) (bool, error) {
+	count, err := r.Count(filter)
+	return count > 0, err
+}
+
+func (r *testRepository) SaveAll(objects interface{}) (interface{}, error) {
+	records, err := objectsToRecords(objects)
+	if err != nil {
+		return nil, err
+	}
+	return saveEach(records, r.Save)
+}
+
+func testRepoBuilder(def RepositoryDefinition, backend Backend) (Repository, error) {
+	return newTestRepository(), nil
+}
+
+// withTimeout fails the test if fn does not complete in time (for example because of a deadlock), or if it fails.
+func withTimeout(t *testing.T, fn func() error) {
+	done := make(chan error)
+	go func() {
+		done <- fn()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Operation did not complete - possible deadlock")
+	}
+}
+
+func TestHookCallsOtherRepository(t *testing.T) {
+	// the hook runs on the goroutine of withTimeout, so it reports its errors back
+	hookErrs := make(chan error, 1)
+	backend := NewHookedBackend(NewRepositoriesBackend(context.Background(), &config.DBInfo{}, testRepoBuilder, nil), &Hooks{
+		After: []AfterHook{
+			func(op *Operation, result interface{}, err error) {
+				if op.Repository == "audit" || err != nil {
+					return
+				}
+				audit, err := op.Backend.DefineRepository("audit", RepositoryDefinitionMap{"name": "audit"})
+				if err == nil {
+					_, err = audit.Save(&map[string]interface{}{"operation": op.Name, "repository": op.Repository}, nil)
+				}
+				if err != nil {
+					hookErrs <- err
+				}
+			},
+		},
+	})
+
+	users, err := backend.DefineRepository("users", RepositoryDefinitionMap{"name": "users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withTimeout(t, func() error {
+		_, err := users.Save(&map[string]interface{}{"email": "john@example.com"}, nil)
+		return err
+	})
+	select {
+	case err := <-hookErrs:
+		t.Fatal(err)
+	default:
+	}
+
+	audit, err := backend.GetRepository("audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := audit.GetAll(NewFilter().Match("operation", OperationSave), &map[string]interface{}{}, "", "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*results.(*[]*map[string]interface{})) != 1 {
+		t.Fatal("Expected one audit record. Got: ", results)
+	}
+}
+
+func TestBeforeHookAbortsOperation(t *testing.T) {
+	inner := newTestRepository()
+	repo := NewHookedRepository("users", inner, nil, &Hooks{
+		Before: []BeforeHook{
+			func(op *Operation) error {
+				return ErrInvalidInput("rejected")
+			},
+		},
+	})
+
+	if _, err := repo.Save(&map[string]interface{}{"email": "john@example.com"}, nil); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected the before hook error. Got: ", err)
+	}
+	if len(inner.records) != 0 {
+		t.Fatal("Expected the operation not to be executed")
+	}
+}
+
+func TestCountHook(t *testing.T) {
+	inner := newTestRepository()
+	inner.records = append(inner.records, map[string]interface{}{"id": "1"}, map[string]interface{}{"id": "2"})
+
+	operations := []string{}
+	repo := NewHookedRepository("users", inner, nil, &Hooks{
+		After: []AfterHook{
+			func(op *Operation, result interface{}, err error) {
+				operations = append(operations, op.Name)
+			},
+		},
+	})
+
+	count, err := repo.Count(NewFilter().Match("id", "2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatal("Expected one record. Got: ", count)
+	}
+	if len(operations) != 1 || operations[0] != OperationCount {
+		t.Fatal("Expected the Count operation to be hooked. Got: ", operations)
+	}
+}
+
+func TestRepoBuilderCallsBackIntoBackend(t *testing.T) {
+	var builder RepoBuilder
+	builder = func(def RepositoryDefinition, backend Backend) (Repository, error) {
+		backend.SetInContext("defined-"+def.GetName(), true)
+		if def.GetName() == "data" {
+			// the data repository depends on the schema repository
+			if _, err := backend.DefineRepository("schemas", RepositoryDefinitionMap{"name": "schemas"}); err != nil {
+				return nil, err
+			}
+		}
+		return newTestRepository(), nil
+	}
+	backend := NewRepositoriesBackend(context.Background(), &config.DBInfo{}, builder, nil)
+
+	withTimeout(t, func() error {
+		_, err := backend.DefineRepository("data", RepositoryDefinitionMap{"name": "data"})
+		return err
+	})
+
+	if _, err := backend.GetRepository("schemas"); err != nil {
+		t.Fatal(err)
+	}
+	if backend.GetFromContext("defined-schemas") == nil {
+		t.Fatal("Expected the builder to set the context value")
+	}
+}
+
+func TestRepoBuilderDefinesItself(t *testing.T) {
+	builder := func(def RepositoryDefinition, backend Backend) (Repository, error) {
+		// the data repository depends on the schema repository, which depends on the data repository
+		dependency := map[string]string{"data": "schemas", "schemas": "data"}[def.GetName()]
+		if _, err := backend.DefineRepository(dependency, RepositoryDefinitionMap{"name": dependency}); err != nil {
+			return nil, err
+		}
+		return newTestRepository(), nil
+	}
+	backend := NewRepositoriesBackend(context.Background(), &config.DBInfo{}, builder, nil)
+
+	withTimeout(t, func() error {
+		if _, err := backend.DefineRepository("data", RepositoryDefinitionMap{"name": "data"}); err == nil || !strings.Contains(err.Error(), "recursively") {
+			return fmt.Errorf("expected the recursive definition to fail, got: %v", err)
+		}
+		return nil
+	})
+	if _, err := backend.GetRepository("data"); err == nil {
+		t.Fatal("Expected the data repository not to be defined")
+	}
+}
+
+func TestDefineRepositoryConcurrentError(t *testing.T) {
+	backend := NewRepositoriesBackend(context.Background(), &config.DBInfo{}, testRepoBuilder, nil).(*RepositoriesBackend)
+
+	// a concurrent definition of the repository failed while this one was waiting for it
+	failed := ErrBackendError("table creation failed")
+	pending := &pendingRepository{done: make(chan struct{}), err: failed}
+	close(pending.done)
+	backend.defining["data"] = pending
+
+	if _, err := backend.DefineRepository("data", RepositoryDefinitionMap{"name": "data"}); err != failed {
+		t.Fatal("Expected the error of the concurrent definition. Got: ", err)
+	}
+}
+
+func TestBackendBuilderCallsBackIntoManager(t *testing.T) {
+	manager := NewBackendManager(map[string]*config.DBInfo{
+		"primary":   &config.DBInfo{},
+		"secondary": &config.DBInfo{},
+	})
+	manager.SupportBackend("secondary", func(conf *config.DBInfo, manager BackendManager) (Backend, error) {
+		return NewRepositoriesBackend(context.Background(), conf, testRepoBuilder, nil), nil
+	}, map[string]interface{}{})
+	manager.SupportBackend("primary", func(conf *config.DBInfo, manager BackendManager) (Backend, error) {
+		if _, err := manager.GetBackend("secondary"); err != nil {
+			return nil, fmt.Errorf("secondary backend: %s", err)
+		}
+		return NewRepositoriesBackend(context.Background(), conf, testRepoBuilder, nil), nil
+	}, map[string]interface{}{})
+
+	withTimeout(t, func() error {
+		_, err := manager.GetBackend("primary")
+		return err
+	})
+}
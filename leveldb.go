@@ -0,0 +1,661 @@
+package backends
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/Microkubes/microservice-tools/config"
+	"github.com/satori/go.uuid"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// LEVELDB_CTX_KEY is LevelDB context key
+var LEVELDB_CTX_KEY = "LEVELDB_DB"
+
+// levelDBSeparator separates the parts of the LevelDB keys. The values in the keys are JSON encoded,
+// and JSON never contains raw NUL characters.
+const levelDBSeparator = "\x00"
+
+// LevelDBCollection is a repository stored in embedded LevelDB database.
+//
+// The keys are laid out as:
+//
+//	r<NUL><repository><NUL><id>                                   => encoded record
+//	i<NUL><repository><NUL><index><NUL><values><NUL><id>          => (empty), for non-unique indexes
+//	u<NUL><repository><NUL><index><NUL><values>                   => id, for unique indexes
+//
+// where the id and the index values are JSON encoded, and the record is encoded with the codec of the repository
+// (JSON by default, see Codec). Records that don't have all of the index fields are not indexed.
+// Filters with exact matches on the id or on all fields of an index are served from the keys, all other filters
+// iterate over the repository records.
+type LevelDBCollection struct {
+	db      *leveldb.DB
+	name    string
+	codec   Codec
+	repoDef RepositoryDefinition
+	// mutex serializes the writes, so the index keys are always consistent with the records.
+	mutex *sync.Mutex
+}
+
+// LevelDBRepoBuilder builds new LevelDB repository (keys prefix).
+func LevelDBRepoBuilder(repoDef RepositoryDefinition, backend Backend) (Repository, error) {
+
+	dbObj := backend.GetFromContext(LEVELDB_CTX_KEY)
+	if dbObj == nil {
+		return nil, ErrBackendError("leveldb database not configured")
+	}
+
+	db, ok := dbObj.(*leveldb.DB)
+	if !ok {
+		return nil, ErrBackendError("unknown database type")
+	}
+
+	repositoryName := repoDef.GetName()
+	if repositoryName == "" {
+		return nil, ErrBackendError("repository name is missing and required")
+	}
+
+	if repoDef.EnableTTL() {
+		return nil, ErrBackendError("TTL is not supported by the leveldb backend")
+	}
+
+	codec, err := codecFor(repoDef)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LevelDBCollection{
+		db:      db,
+		name:    repositoryName,
+		codec:   codec,
+		repoDef: repoDef,
+		mutex:   &sync.Mutex{},
+	}, nil
+}
+
+// LevelDBBackendBuilder returns RepositoriesBackend.
+// The database name is the path to the LevelDB database directory. The database is created if it does not exist.
+func LevelDBBackendBuilder(conf *config.DBInfo, manager BackendManager) (Backend, error) {
+
+	if conf.DatabaseName == "" {
+		return nil, ErrBackendError("database path is missing from config")
+	}
+
+	db, err := leveldb.OpenFile(conf.DatabaseName, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.WithValue(context.Background(), LEVELDB_CTX_KEY, db)
+	cleanup := func() {
+		db.Close()
+	}
+
+	return NewRepositoriesBackend(ctx, conf, LevelDBRepoBuilder, cleanup), nil
+}
+
+// GetOne fetches only one record for given filter
+func (c *LevelDBCollection) GetOne(filter Filter, result interface{}) (interface{}, error) {
+	records, err := c.find(filter, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrNotFound("record not found")
+	}
+
+	err = MapToInterface(&records[0], &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetAll fetches all matched records for given filter.
+// Without ordering, the iteration stops as soon as offset+limit records are matched.
+func (c *LevelDBCollection) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	max := 0
+	if order == "" && limit != 0 {
+		max = offset + limit
+	}
+
+	records, err := c.find(filter, max)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err = filterRecords(records, nil, order, sorting, limit, offset)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+
+	return recordsToResults(records, resultsTypeHint)
+}
+
+// Count returns the number of records that match the filter.
+func (c *LevelDBCollection) Count(filter Filter) (int64, error) {
+	records, err := c.find(filter, 0)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(records)), nil
+}
+
+// Exists reports whether a record matches the filter. The scan stops at the first matching record.
+func (c *LevelDBCollection) Exists(filter Filter) (bool, error) {
+	records, err := c.find(filter, 1)
+	if err != nil {
+		return false, err
+	}
+	return len(records) > 0, nil
+}
+
+// Save creates new record unless it does not exist, otherwise it updates the record
+func (c *LevelDBCollection) Save(object interface{}, filter Filter) (interface{}, error) {
+
+	var result interface{}
+
+	payload, err := InterfaceToMap(object)
+	if err != nil {
+		return nil, err
+	}
+
+	normalized, err := normalizeValue(*payload)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+	record := normalized.(map[string]interface{})
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	batch := &leveldb.Batch{}
+
+	if filter == nil {
+		if id, ok := record["id"]; !ok || id == nil || id == "" {
+			id, err := uuid.NewV4()
+			if err != nil {
+				return nil, err
+			}
+			record["id"] = id.String()
+		}
+
+		key, err := c.recordKey(record["id"])
+		if err != nil {
+			return nil, err
+		}
+		exists, err := c.db.Has(key, nil)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return nil, ErrAlreadyExists("record already exists!")
+		}
+
+		if err = c.writeRecord(batch, nil, record); err != nil {
+			return nil, err
+		}
+	} else {
+		records, err := c.find(filter, 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == 0 {
+			return nil, ErrNotFound("record not found")
+		}
+		updated := c.merge(records[0], record)
+		if err = c.writeRecord(batch, records[0], updated); err != nil {
+			return nil, err
+		}
+		record = updated
+	}
+
+	if err = c.db.Write(batch, nil); err != nil {
+		return nil, err
+	}
+
+	err = MapToInterface(&record, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// SaveAll creates the objects (a slice) as new records, with a single batch write. Returns the created records, as
+// returned by Save. Nothing is created if any of the records already exists or violates a unique index.
+func (c *LevelDBCollection) SaveAll(objects interface{}) (interface{}, error) {
+	payloads, err := objectsToRecords(objects)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	batch := &leveldb.Batch{}
+	// the batch is not visible to writeRecord, so the keys are checked within the batch as well
+	written := map[string]bool{}
+	records := []map[string]interface{}{}
+	for _, payload := range payloads {
+		normalized, err := normalizeValue(payload)
+		if err != nil {
+			return nil, ErrInvalidInput(err)
+		}
+		record := normalized.(map[string]interface{})
+		if id, ok := record["id"]; !ok || id == nil || id == "" {
+			id, err := uuid.NewV4()
+			if err != nil {
+				return nil, err
+			}
+			record["id"] = id.String()
+		}
+
+		key, err := c.recordKey(record["id"])
+		if err != nil {
+			return nil, err
+		}
+		exists, err := c.db.Has(key, nil)
+		if err != nil {
+			return nil, err
+		}
+		if exists || written[string(key)] {
+			return nil, ErrAlreadyExists("record already exists!")
+		}
+		written[string(key)] = true
+
+		indexKeys, err := c.indexKeys(record)
+		if err != nil {
+			return nil, err
+		}
+		for index, indexKey := range indexKeys {
+			if !strings.HasPrefix(indexKey, "u"+levelDBSeparator) {
+				continue
+			}
+			if written[indexKey] {
+				return nil, ErrAlreadyExists("unique index " + index + " violated")
+			}
+			written[indexKey] = true
+		}
+
+		if err := c.writeRecord(batch, nil, record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	if err := c.db.Write(batch, nil); err != nil {
+		return nil, err
+	}
+
+	saved := []interface{}{}
+	for _, record := range records {
+		var result interface{}
+		if err := MapToInterface(&record, &result); err != nil {
+			return nil, err
+		}
+		saved = append(saved, result)
+	}
+	return saved, nil
+}
+
+// UpdateAll updates all matched records for given filter with the properties of the update.
+// Returns the number of the updated records. Each record is written with its index keys in a separate batch,
+// so a unique index violation stops the update after the records updated so far.
+func (c *LevelDBCollection) UpdateAll(filter Filter, update interface{}) (int64, error) {
+	payload, err := InterfaceToMap(update)
+	if err != nil {
+		return 0, err
+	}
+	normalized, err := normalizeValue(*payload)
+	if err != nil {
+		return 0, ErrInvalidInput(err)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	records, err := c.find(filter, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	var updated int64
+	for _, old := range records {
+		batch := &leveldb.Batch{}
+		if err := c.writeRecord(batch, old, c.merge(old, normalized.(map[string]interface{}))); err != nil {
+			return updated, err
+		}
+		if err := c.db.Write(batch, nil); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+	return updated, nil
+}
+
+// merge returns a copy of the old record with the properties of the payload set, except the id.
+func (c *LevelDBCollection) merge(old map[string]interface{}, payload map[string]interface{}) map[string]interface{} {
+	updated := map[string]interface{}{}
+	for k, v := range old {
+		updated[k] = v
+	}
+	for k, v := range payload {
+		if k == "id" {
+			// the id is immutable
+			continue
+		}
+		updated[k] = v
+	}
+	return updated
+}
+
+// DeleteOne deletes only one record for given filter
+func (c *LevelDBCollection) DeleteOne(filter Filter) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	records, err := c.find(filter, 1)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return ErrNotFound("record not found")
+	}
+
+	return c.deleteRecords(records)
+}
+
+// DeleteAll deletes all matched records for given filter
+func (c *LevelDBCollection) DeleteAll(filter Filter) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	records, err := c.find(filter, 0)
+	if err != nil {
+		return err
+	}
+
+	return c.deleteRecords(records)
+}
+
+func (c *LevelDBCollection) deleteRecords(records []map[string]interface{}) error {
+	batch := &leveldb.Batch{}
+	for _, record := range records {
+		key, err := c.recordKey(record["id"])
+		if err != nil {
+			return err
+		}
+		batch.Delete(key)
+
+		indexKeys, err := c.indexKeys(record)
+		if err != nil {
+			return err
+		}
+		for _, indexKey := range indexKeys {
+			batch.Delete([]byte(indexKey))
+		}
+	}
+	return c.db.Write(batch, nil)
+}
+
+// writeRecord adds the record and its index keys to the batch. If the old record is given, its index keys that
+// are no longer valid are deleted. Returns ErrAlreadyExists if the record violates a unique index.
+func (c *LevelDBCollection) writeRecord(batch *leveldb.Batch, old map[string]interface{}, record map[string]interface{}) error {
+	key, err := c.recordKey(record["id"])
+	if err != nil {
+		return err
+	}
+	value, err := c.codec.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	newKeys, err := c.indexKeys(record)
+	if err != nil {
+		return err
+	}
+	oldKeys := map[string]string{}
+	if old != nil {
+		if oldKeys, err = c.indexKeys(old); err != nil {
+			return err
+		}
+	}
+
+	for index, indexKey := range oldKeys {
+		if newKeys[index] != indexKey {
+			batch.Delete([]byte(indexKey))
+		}
+	}
+
+	for index, indexKey := range newKeys {
+		if oldKeys[index] == indexKey {
+			continue
+		}
+		if strings.HasPrefix(indexKey, "u"+levelDBSeparator) {
+			exists, err := c.db.Has([]byte(indexKey), nil)
+			if err != nil {
+				return err
+			}
+			if exists {
+				return ErrAlreadyExists("unique index " + index + " violated")
+			}
+			id, _ := json.Marshal(record["id"])
+			batch.Put([]byte(indexKey), id)
+			continue
+		}
+		batch.Put([]byte(indexKey), nil)
+	}
+
+	batch.Put(key, value)
+	return nil
+}
+
+// find returns the records that match the filter. If max is not 0, at most max records are returned.
+func (c *LevelDBCollection) find(filter Filter, max int) ([]map[string]interface{}, error) {
+	matcher, err := toRecordMatcher(filter)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+
+	records := []map[string]interface{}{}
+	collect := func(record map[string]interface{}) bool {
+		if matcher(record) {
+			records = append(records, record)
+		}
+		return max == 0 || len(records) < max
+	}
+
+	if id, ok := filter["id"]; ok && !isFilterSpec(id) {
+		record, err := c.get(id)
+		if err != nil || record == nil {
+			return records, err
+		}
+		collect(record)
+		return records, nil
+	}
+
+	if prefix, unique, ok, err := c.indexPrefix(filter); ok || err != nil {
+		if err != nil {
+			return nil, err
+		}
+		if unique {
+			id, err := c.db.Get(prefix, nil)
+			if err == leveldb.ErrNotFound {
+				return records, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			return records, c.collectIDs([][]byte{id}, collect)
+		}
+
+		ids := [][]byte{}
+		iter := c.db.NewIterator(util.BytesPrefix(prefix), nil)
+		for iter.Next() {
+			ids = append(ids, append([]byte{}, iter.Key()[len(prefix):]...))
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return nil, err
+		}
+		return records, c.collectIDs(ids, collect)
+	}
+
+	iter := c.db.NewIterator(util.BytesPrefix([]byte(c.keyPrefix("r"))), nil)
+	defer iter.Release()
+	for iter.Next() {
+		record, err := c.codec.Unmarshal(iter.Value())
+		if err != nil {
+			return nil, ErrBackendError(err)
+		}
+		if !collect(record) {
+			break
+		}
+	}
+
+	return records, iter.Error()
+}
+
+// collectIDs fetches the records with the given JSON encoded ids and passes them to collect, until collect returns false.
+func (c *LevelDBCollection) collectIDs(ids [][]byte, collect func(map[string]interface{}) bool) error {
+	for _, encodedID := range ids {
+		var id interface{}
+		if err := json.Unmarshal(encodedID, &id); err != nil {
+			return ErrBackendError(err)
+		}
+		record, err := c.get(id)
+		if err != nil {
+			return err
+		}
+		if record != nil && !collect(record) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// get returns the record with the given id, or nil if there is no such record.
+func (c *LevelDBCollection) get(id interface{}) (map[string]interface{}, error) {
+	key, err := c.recordKey(id)
+	if err != nil {
+		return nil, err
+	}
+	value, err := c.db.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	record, err := c.codec.Unmarshal(value)
+	if err != nil {
+		return nil, ErrBackendError(err)
+	}
+	return record, nil
+}
+
+// indexPrefix returns the key prefix of the index that can serve the filter - the filter must have exact matches
+// on all fields of the index. Unique indexes are preferred. For unique indexes the prefix is the whole index key.
+func (c *LevelDBCollection) indexPrefix(filter Filter) ([]byte, bool, bool, error) {
+	var found Index
+	for _, index := range c.repoDef.GetIndexes() {
+		covered := len(index.GetFields()) > 0
+		for _, field := range index.GetFields() {
+			value, ok := filter[field]
+			if !ok || isFilterSpec(value) {
+				covered = false
+				break
+			}
+		}
+		if covered && (found == nil || (index.Unique() && !found.Unique())) {
+			found = index
+		}
+	}
+	if found == nil {
+		return nil, false, false, nil
+	}
+
+	values, _, err := c.indexValues(found, filter)
+	if err != nil {
+		return nil, false, false, err
+	}
+	if found.Unique() {
+		return []byte(c.keyPrefix("u", found.GetName(), values)), true, true, nil
+	}
+	return []byte(c.keyPrefix("i", found.GetName(), values) + levelDBSeparator), false, true, nil
+}
+
+// indexKeys returns the index keys of the record, by index name.
+func (c *LevelDBCollection) indexKeys(record map[string]interface{}) (map[string]string, error) {
+	keys := map[string]string{}
+	id, err := json.Marshal(record["id"])
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+
+	for _, index := range c.repoDef.GetIndexes() {
+		values, ok, err := c.indexValues(index, record)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			// sparse index - the record does not have all of the fields
+			continue
+		}
+		if index.Unique() {
+			keys[index.GetName()] = c.keyPrefix("u", index.GetName(), values)
+			continue
+		}
+		keys[index.GetName()] = c.keyPrefix("i", index.GetName(), values, string(id))
+	}
+
+	return keys, nil
+}
+
+// indexValues returns the JSON encoded values of the index fields. The second return value is false
+// if any of the fields is missing.
+func (c *LevelDBCollection) indexValues(index Index, values map[string]interface{}) (string, bool, error) {
+	fields := []interface{}{}
+	for _, field := range index.GetFields() {
+		value, ok := values[field]
+		if !ok || value == nil {
+			return "", false, nil
+		}
+		fields = append(fields, value)
+	}
+
+	normalized, err := normalizeValue(fields)
+	if err != nil {
+		return "", false, ErrInvalidInput(err)
+	}
+	encoded, err := json.Marshal(normalized)
+	if err != nil {
+		return "", false, ErrInvalidInput(err)
+	}
+	return string(encoded), true, nil
+}
+
+// recordKey returns the key of the record with the given id.
+func (c *LevelDBCollection) recordKey(id interface{}) ([]byte, error) {
+	normalized, err := normalizeValue(id)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+	encoded, err := json.Marshal(normalized)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+	return []byte(c.keyPrefix("r", string(encoded))), nil
+}
+
+// keyPrefix joins the key type, the repository name and the given parts with the separator.
+// For the record type without parts, the prefix of all records of the repository is returned.
+func (c *LevelDBCollection) keyPrefix(keyType string, parts ...string) string {
+	key := keyType + levelDBSeparator + c.name + levelDBSeparator
+	return key + strings.Join(parts, levelDBSeparator)
+}
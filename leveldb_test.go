@@ -0,0 +1,154 @@
+package backends
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func TestLevelDBRepoBuilder(t *testing.T) {
+	backend := NewRepositoriesBackend(context.Background(), &config.DBInfo{DatabaseName: "testdb"}, LevelDBRepoBuilder, nil)
+	if _, err := backend.DefineRepository("users", RepositoryDefinitionMap{"name": "users"}); err == nil {
+		t.Fatal("Expected error when leveldb database is not configured")
+	}
+}
+
+func TestLevelDBRepository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "leveldb-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bm := NewBackendSupport(map[string]*config.DBInfo{
+		"leveldb": &config.DBInfo{
+			DatabaseName: dir,
+		},
+	})
+	backend, err := bm.GetBackend("leveldb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Shutdown()
+
+	repo, err := backend.DefineRepository("users", RepositoryDefinitionMap{
+		"name": "users",
+		"indexes": []Index{
+			NewIndex("email", true, "email"),
+			NewIndex("role", false, "role"),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := []map[string]interface{}{
+		{"id": "1", "email": "john@example.com", "role": "admin", "name": "John"},
+		{"id": "2", "email": "jane@example.com", "role": "user", "name": "Jane"},
+		{"id": "3", "email": "bob@example.com", "role": "user", "name": "Bob"},
+	}
+	for _, user := range users {
+		if _, err = repo.Save(&user, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err = repo.Save(&map[string]interface{}{"id": "1"}, nil); err == nil {
+		t.Fatal("Expected error for duplicate id")
+	}
+	if _, err = repo.Save(&map[string]interface{}{"id": "4", "email": "john@example.com"}, nil); err == nil {
+		t.Fatal("Expected error for duplicate email")
+	}
+
+	result, err := repo.GetOne(NewFilter().Match("email", "jane@example.com"), &map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (*result.(*map[string]interface{}))["id"] != "2" {
+		t.Fatal("Expected Jane by unique index. Got: ", result)
+	}
+
+	results, err := repo.GetAll(NewFilter().Match("role", "user"), map[string]interface{}{}, "name", "asc", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := *results.(*[]*map[string]interface{})
+	if len(found) != 2 || (*found[0])["name"] != "Bob" || (*found[1])["name"] != "Jane" {
+		t.Fatal("Expected Bob and Jane by index. Got: ", found)
+	}
+
+	results, err = repo.GetAll(NewFilter().MatchPattern("name", "J%"), map[string]interface{}{}, "", "", 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*results.(*[]*map[string]interface{})) != 1 {
+		t.Fatal("Expected 1 result. Got: ", results)
+	}
+
+	// moving Jane to admins updates the role index
+	if _, err = repo.Save(&map[string]interface{}{"role": "admin"}, NewFilter().Match("id", "2")); err != nil {
+		t.Fatal(err)
+	}
+	results, err = repo.GetAll(NewFilter().Match("role", "user"), map[string]interface{}{}, "", "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found = *results.(*[]*map[string]interface{}); len(found) != 1 || (*found[0])["id"] != "3" {
+		t.Fatal("Expected only Bob in the user role. Got: ", found)
+	}
+
+	if _, err = repo.Save(&map[string]interface{}{"email": "bob@example.com"}, NewFilter().Match("id", "2")); err == nil {
+		t.Fatal("Expected error when updating to a duplicate email")
+	}
+
+	updated, err := repo.UpdateAll(NewFilter().Match("role", "admin"), &map[string]interface{}{"role": "owner", "id": "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated != 2 {
+		t.Fatal("Expected 2 updated records. Got: ", updated)
+	}
+	if count, err := repo.Count(NewFilter().Match("role", "owner")); err != nil || count != 2 {
+		t.Fatal("Expected 2 owners by index. Got: ", count, err)
+	}
+	if exists, err := repo.Exists(NewFilter().Match("id", "x")); err != nil || exists {
+		t.Fatal("Expected the ids not to be updated. Got: ", exists, err)
+	}
+	if _, err = repo.UpdateAll(NewFilter().Match("role", "user"), &map[string]interface{}{"email": "jane@example.com"}); err == nil || !IsErrAlreadyExists(err) {
+		t.Fatal("Expected already exists error when updating to a duplicate email. Got: ", err)
+	}
+
+	saved, err := repo.SaveAll([]map[string]interface{}{{"id": "6", "email": "ann@example.com", "role": "user"}, {"email": "max@example.com", "role": "user"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list := saved.([]interface{}); len(list) != 2 || list[1].(map[string]interface{})["id"] == "" {
+		t.Fatal("Expected 2 created records with ids. Got: ", list)
+	}
+	if count, err := repo.Count(NewFilter().Match("role", "user")); err != nil || count != 3 {
+		t.Fatal("Expected 3 users by index. Got: ", count, err)
+	}
+	if _, err = repo.SaveAll([]map[string]interface{}{{"id": "7", "email": "eve@example.com"}, {"id": "8", "email": "eve@example.com"}}); err == nil || !IsErrAlreadyExists(err) {
+		t.Fatal("Expected already exists error for the duplicate email in the batch. Got: ", err)
+	}
+	if exists, err := repo.Exists(NewFilter().Match("id", "7")); err != nil || exists {
+		t.Fatal("Expected the failed batch not to be written. Got: ", exists, err)
+	}
+
+	if err = repo.DeleteOne(NewFilter().Match("email", "john@example.com")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repo.Save(&map[string]interface{}{"id": "5", "email": "john@example.com"}, nil); err != nil {
+		t.Fatal("Expected the email to be free after delete. Got: ", err)
+	}
+
+	if err = repo.DeleteAll(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repo.GetOne(NewFilter().Match("id", "3"), &map[string]interface{}{}); err == nil {
+		t.Fatal("Expected not found after DeleteAll")
+	}
+}
@@ -0,0 +1,217 @@
+package backends
+
+import "sync"
+
+// Priority is the priority class of a repository operation.
+type Priority int
+
+const (
+	// PriorityHigh is the priority of the interactive traffic (API requests). This is the default priority.
+	PriorityHigh Priority = iota
+	// PriorityLow is the priority of the maintenance work (exports, reindexing, migrations).
+	// Low priority operations yield to the high priority ones.
+	PriorityLow
+)
+
+// ConcurrencyLimiter limits the number of concurrent operations on a backend.
+// When the limiter is saturated, the waiting high priority operations are always let through
+// before the low priority ones. The low priority operations can use at most maxLowPriority slots,
+// so there is always room left for the interactive traffic.
+type ConcurrencyLimiter struct {
+	mutex          *sync.Mutex
+	cond           *sync.Cond
+	maxConcurrent  int
+	maxLowPriority int
+	active         int
+	activeLow      int
+	waitingHigh    int
+	waitingLow     int
+}
+
+// NewConcurrencyLimiter creates new ConcurrencyLimiter that allows at most maxConcurrent operations to run at the same time,
+// of which at most maxLowPriority may be low priority operations.
+func NewConcurrencyLimiter(maxConcurrent int, maxLowPriority int) *ConcurrencyLimiter {
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+	if maxLowPriority < 1 {
+		maxLowPriority = 1
+	}
+	if maxLowPriority > maxConcurrent {
+		maxLowPriority = maxConcurrent
+	}
+	mutex := &sync.Mutex{}
+	return &ConcurrencyLimiter{
+		mutex:          mutex,
+		cond:           sync.NewCond(mutex),
+		maxConcurrent:  maxConcurrent,
+		maxLowPriority: maxLowPriority,
+	}
+}
+
+// Acquire blocks until a slot is available for an operation with the given priority.
+// Returns a function that releases the slot. It must be called once the operation is done.
+func (l *ConcurrencyLimiter) Acquire(priority Priority) func() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if priority == PriorityLow {
+		l.waitingLow++
+		for l.active >= l.maxConcurrent || l.activeLow >= l.maxLowPriority || l.waitingHigh > 0 {
+			l.cond.Wait()
+		}
+		l.waitingLow--
+		l.activeLow++
+	} else {
+		l.waitingHigh++
+		for l.active >= l.maxConcurrent {
+			l.cond.Wait()
+		}
+		l.waitingHigh--
+	}
+	l.active++
+
+	released := false
+	return func() {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+
+		if released {
+			return
+		}
+		released = true
+
+		l.active--
+		if priority == PriorityLow {
+			l.activeLow--
+		}
+		l.cond.Broadcast()
+	}
+}
+
+// Waiting returns the numbers of the high and the low priority operations that wait for a slot, for example to
+// report the queue of the limiter as a metric.
+func (l *ConcurrencyLimiter) Waiting() (high int, low int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.waitingHigh, l.waitingLow
+}
+
+// LimitedBackend is a Backend whose repositories run their operations through a ConcurrencyLimiter.
+type LimitedBackend struct {
+	Backend
+	limiter *ConcurrencyLimiter
+}
+
+// NewLimitedBackend wraps the backend so all operations on its repositories go through the limiter.
+// The repositories operate with PriorityHigh by default. Use WithPriority to get a lower priority view of a repository.
+func NewLimitedBackend(backend Backend, limiter *ConcurrencyLimiter) Backend {
+	return &LimitedBackend{
+		Backend: backend,
+		limiter: limiter,
+	}
+}
+
+// DefineRepository defines the repository (collection/table) on the underlying backend.
+func (b *LimitedBackend) DefineRepository(name string, def RepositoryDefinition) (Repository, error) {
+	repo, err := b.Backend.DefineRepository(name, def)
+	if err != nil {
+		return nil, err
+	}
+	return b.wrap(repo), nil
+}
+
+// GetRepository return the repository (collection/table) from the underlying backend.
+func (b *LimitedBackend) GetRepository(name string) (Repository, error) {
+	repo, err := b.Backend.GetRepository(name)
+	if err != nil {
+		return nil, err
+	}
+	return b.wrap(repo), nil
+}
+
+func (b *LimitedBackend) wrap(repo Repository) Repository {
+	return &PrioritizedRepository{
+		Repository: repo,
+		limiter:    b.limiter,
+		priority:   PriorityHigh,
+	}
+}
+
+// PrioritizedRepository is a Repository that runs every operation through a concurrency limiter with a given priority.
+type PrioritizedRepository struct {
+	Repository
+	limiter  *ConcurrencyLimiter
+	priority Priority
+}
+
+// WithPriority returns a view of the repository that runs the operations with the given priority.
+// If the repository is not obtained from a LimitedBackend, the repository is returned unchanged.
+// For example:
+//
+//	exportRepo := backends.WithPriority(repo, backends.PriorityLow)
+func WithPriority(repo Repository, priority Priority) Repository {
+	if prioritized, ok := repo.(*PrioritizedRepository); ok {
+		return &PrioritizedRepository{
+			Repository: prioritized.Repository,
+			limiter:    prioritized.limiter,
+			priority:   priority,
+		}
+	}
+	return repo
+}
+
+// GetOne fetches only one record for given filter
+func (r *PrioritizedRepository) GetOne(filter Filter, result interface{}) (interface{}, error) {
+	defer r.limiter.Acquire(r.priority)()
+	return r.Repository.GetOne(filter, result)
+}
+
+// GetAll fetches all matched records for given filter
+func (r *PrioritizedRepository) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	defer r.limiter.Acquire(r.priority)()
+	return r.Repository.GetAll(filter, resultsTypeHint, order, sorting, limit, offset)
+}
+
+// Save creates new record unless it does not exist, otherwise it updates the record
+func (r *PrioritizedRepository) Save(object interface{}, filter Filter) (interface{}, error) {
+	defer r.limiter.Acquire(r.priority)()
+	return r.Repository.Save(object, filter)
+}
+
+// DeleteOne deletes only one record for given filter
+func (r *PrioritizedRepository) DeleteOne(filter Filter) error {
+	defer r.limiter.Acquire(r.priority)()
+	return r.Repository.DeleteOne(filter)
+}
+
+// DeleteAll deletes all matched records for given filter
+func (r *PrioritizedRepository) DeleteAll(filter Filter) error {
+	defer r.limiter.Acquire(r.priority)()
+	return r.Repository.DeleteAll(filter)
+}
+
+// Count returns the number of records that match the filter
+func (r *PrioritizedRepository) Count(filter Filter) (int64, error) {
+	defer r.limiter.Acquire(r.priority)()
+	return r.Repository.Count(filter)
+}
+
+// Exists reports whether a record matches the filter
+func (r *PrioritizedRepository) Exists(filter Filter) (bool, error) {
+	defer r.limiter.Acquire(r.priority)()
+	return r.Repository.Exists(filter)
+}
+
+// UpdateAll updates all matched records for given filter
+func (r *PrioritizedRepository) UpdateAll(filter Filter, update interface{}) (int64, error) {
+	defer r.limiter.Acquire(r.priority)()
+	return r.Repository.UpdateAll(filter, update)
+}
+
+// SaveAll creates the objects as new records
+func (r *PrioritizedRepository) SaveAll(objects interface{}) (interface{}, error) {
+	defer r.limiter.Acquire(r.priority)()
+	return r.Repository.SaveAll(objects)
+}
@@ -0,0 +1,91 @@
+package backends
+
+import (
+	"runtime"
+	"testing"
+)
+
+// waitForWaiting blocks until the given numbers of high and low priority operations wait for a slot of the limiter.
+func waitForWaiting(limiter *ConcurrencyLimiter, high int, low int) {
+	for {
+		waitingHigh, waitingLow := limiter.Waiting()
+		if waitingHigh == high && waitingLow == low {
+			return
+		}
+		runtime.Gosched()
+	}
+}
+
+func TestConcurrencyLimiterPriority(t *testing.T) {
+	limiter := NewConcurrencyLimiter(1, 1)
+
+	release := limiter.Acquire(PriorityHigh)
+
+	order := make(chan Priority, 2)
+	acquire := func(priority Priority) {
+		done := limiter.Acquire(priority)
+		order <- priority
+		done()
+	}
+
+	go acquire(PriorityLow)
+	waitForWaiting(limiter, 0, 1)
+	go acquire(PriorityHigh)
+	waitForWaiting(limiter, 1, 1)
+
+	release()
+
+	if first := <-order; first != PriorityHigh {
+		t.Fatal("Expected the high priority operation to acquire the slot first")
+	}
+	if second := <-order; second != PriorityLow {
+		t.Fatal("Expected the low priority operation to acquire the slot second")
+	}
+}
+
+func TestConcurrencyLimiterLowPriorityShare(t *testing.T) {
+	limiter := NewConcurrencyLimiter(2, 1)
+
+	releaseLow := limiter.Acquire(PriorityLow)
+	defer releaseLow()
+
+	acquired := make(chan bool)
+	go func() {
+		release := limiter.Acquire(PriorityLow)
+		defer release()
+		acquired <- true
+	}()
+
+	waitForWaiting(limiter, 0, 1)
+	select {
+	case <-acquired:
+		t.Fatal("Expected the second low priority operation to wait")
+	default:
+	}
+
+	// the high priority operations can still use the free slot
+	releaseHigh := limiter.Acquire(PriorityHigh)
+	releaseHigh()
+
+	releaseLow()
+	<-acquired
+}
+
+func TestLimitedBackend(t *testing.T) {
+	backend := NewLimitedBackend(repoBuilder, NewConcurrencyLimiter(10, 2))
+
+	repo, err := backend.DefineRepository("limited-repo", collectionInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prioritized, ok := repo.(*PrioritizedRepository)
+	if !ok || prioritized.priority != PriorityHigh {
+		t.Fatal("Expected high priority repository. Got: ", repo)
+	}
+
+	low, ok := WithPriority(repo, PriorityLow).(*PrioritizedRepository)
+	if !ok || low.priority != PriorityLow || low.Repository != prioritized.Repository {
+		t.Fatal("Expected low priority view of the same repository. Got: ", low)
+	}
+}
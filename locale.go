@@ -0,0 +1,221 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Localized fields hold one value per language, keyed by the language tag:
+//
+//	{"id": "1", "title": {"en": "Hello", "de": "Hallo", "pt-BR": "Olá"}}
+//
+// A LocalizedRepository flattens the localized fields of the records it reads to the value in the requested language.
+
+// LocaleOptions configures the localized fields of a repository.
+type LocaleOptions struct {
+	// Fields are the localized properties of the records.
+	Fields []string
+	// DefaultLocale is used when the context has no locale, and as a fallback when a value has no translation
+	// for the requested locale.
+	DefaultLocale string
+}
+
+// localeKey is the context key of the requested locale.
+type localeKey struct{}
+
+// WithLocale returns a context that requests the values of the localized fields in the given language (for example "de"
+// or "de-AT").
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeKey{}, locale)
+}
+
+// LocaleFromContext returns the locale requested in the context. The second return value is false if the context
+// has no locale.
+func LocaleFromContext(ctx context.Context) (string, bool) {
+	locale, ok := ctx.Value(localeKey{}).(string)
+	return locale, ok && locale != ""
+}
+
+// normalizeLocale lower-cases the language tag and uses "-" as separator, so "pt_BR" and "pt-br" are the same locale.
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.Replace(locale, "_", "-", -1))
+}
+
+// localeLanguage returns the language of the tag, "de" for "de-AT".
+func localeLanguage(locale string) string {
+	if i := strings.Index(locale, "-"); i >= 0 {
+		return locale[:i]
+	}
+	return locale
+}
+
+// Localize returns the translation of the localized value for the locale. When there is no translation for the
+// locale, the first one found is used of:
+//
+//   - the parent tags of the locale ("de-AT" for "de-AT-1996", then "de"),
+//   - another region of the same language ("de-CH" for "de-AT"), in alphabetical order,
+//   - the fallback locale and its parent tags,
+//   - the first language in alphabetical order.
+//
+// The second return value is false if the value is not a localized value (a map of language tags) or has no
+// translations.
+func Localize(value interface{}, locale string, fallback string) (interface{}, bool) {
+	translations := map[string]interface{}{}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for tag, text := range v {
+			translations[normalizeLocale(tag)] = text
+		}
+	case map[string]string:
+		for tag, text := range v {
+			translations[normalizeLocale(tag)] = text
+		}
+	default:
+		return nil, false
+	}
+	if len(translations) == 0 {
+		return nil, false
+	}
+
+	tags := make([]string, 0, len(translations))
+	for tag := range translations {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	lookup := func(locale string) (interface{}, bool) {
+		for locale != "" {
+			if text, ok := translations[locale]; ok {
+				return text, true
+			}
+			i := strings.LastIndex(locale, "-")
+			if i < 0 {
+				break
+			}
+			locale = locale[:i]
+		}
+		return nil, false
+	}
+
+	locale = normalizeLocale(locale)
+	if text, ok := lookup(locale); ok {
+		return text, true
+	}
+	if language := localeLanguage(locale); language != "" {
+		for _, tag := range tags {
+			if localeLanguage(tag) == language {
+				return translations[tag], true
+			}
+		}
+	}
+	if text, ok := lookup(normalizeLocale(fallback)); ok {
+		return text, true
+	}
+	return translations[tags[0]], true
+}
+
+// LocalizeRecord replaces the localized fields of the record with the translation for the locale (see Localize).
+// The fields that are not localized values are left as they are.
+func LocalizeRecord(record map[string]interface{}, locale string, options *LocaleOptions) {
+	for _, field := range options.Fields {
+		if text, ok := Localize(record[field], locale, options.DefaultLocale); ok {
+			record[field] = text
+		}
+	}
+}
+
+// SetLocalized sets the translation of the localized field of the record for the locale, keeping the other
+// translations. Returns ErrInvalidInput if the field has a value that is not a localized value.
+func SetLocalized(record map[string]interface{}, field string, locale string, text interface{}) error {
+	translations := map[string]interface{}{}
+	switch v := record[field].(type) {
+	case nil:
+	case map[string]interface{}:
+		for tag, value := range v {
+			translations[tag] = value
+		}
+	case map[string]string:
+		for tag, value := range v {
+			translations[tag] = value
+		}
+	default:
+		return ErrInvalidInput(fmt.Sprintf("%s is not a localized field", field))
+	}
+	translations[locale] = text
+	record[field] = translations
+	return nil
+}
+
+// LocalizedRepository is a view of the repository that returns the localized fields in one language.
+// The records are saved as they are, with all translations.
+type LocalizedRepository struct {
+	Repository
+	locale  string
+	options *LocaleOptions
+}
+
+// NewLocalizedRepository returns a view of the repository that flattens the localized fields of the records to the locale.
+func NewLocalizedRepository(repo Repository, locale string, options *LocaleOptions) *LocalizedRepository {
+	if options == nil {
+		options = &LocaleOptions{}
+	}
+	if locale == "" {
+		locale = options.DefaultLocale
+	}
+	return &LocalizedRepository{
+		Repository: repo,
+		locale:     locale,
+		options:    options,
+	}
+}
+
+// LocalizedRepositoryFromContext returns a view of the repository for the locale in the context (see WithLocale),
+// or for the default locale if the context has no locale:
+//
+//	articles := backends.LocalizedRepositoryFromContext(ctx, articlesRepo, &backends.LocaleOptions{
+//		Fields:        []string{"title", "body"},
+//		DefaultLocale: "en",
+//	})
+func LocalizedRepositoryFromContext(ctx context.Context, repo Repository, options *LocaleOptions) *LocalizedRepository {
+	locale, _ := LocaleFromContext(ctx)
+	return NewLocalizedRepository(repo, locale, options)
+}
+
+// GetOne fetches only one record for given filter, with the localized fields in the locale of the repository.
+func (r *LocalizedRepository) GetOne(filter Filter, result interface{}) (interface{}, error) {
+	record := map[string]interface{}{}
+	if _, err := r.Repository.GetOne(filter, &record); err != nil {
+		return nil, err
+	}
+	LocalizeRecord(record, r.locale, r.options)
+
+	if result == nil {
+		result = &map[string]interface{}{}
+	}
+	if err := MapToInterface(record, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetAll fetches all matched records for given filter, with the localized fields in the locale of the repository.
+func (r *LocalizedRepository) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	results, err := r.Repository.GetAll(filter, &map[string]interface{}{}, order, sorting, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	records, err := syncRecords(results)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		LocalizeRecord(record, r.locale, r.options)
+	}
+
+	if resultsTypeHint == nil {
+		resultsTypeHint = &map[string]interface{}{}
+	}
+	return recordsToResults(records, resultsTypeHint)
+}
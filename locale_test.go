@@ -0,0 +1,115 @@
+package backends
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+type localeTestArticle struct {
+	Title  string `json:"title"`
+	Author string `json:"author"`
+}
+
+func TestLocalize(t *testing.T) {
+	title := map[string]interface{}{"en": "Colour", "en-US": "Color", "de-CH": "Farbe (CH)", "pt_BR": "Cor"}
+
+	cases := []struct {
+		locale   string
+		fallback string
+		expected string
+	}{
+		{"en-US", "", "Color"},
+		{"en-us", "", "Color"},
+		{"en-GB", "", "Colour"},
+		{"en-US-posix", "", "Color"},
+		{"de", "", "Farbe (CH)"},
+		{"de-AT", "", "Farbe (CH)"},
+		{"pt-BR", "", "Cor"},
+		{"fr", "en", "Colour"},
+		{"fr", "en-US", "Color"},
+		{"fr", "", "Farbe (CH)"},
+		{"", "pt-br", "Cor"},
+	}
+	for _, c := range cases {
+		text, ok := Localize(title, c.locale, c.fallback)
+		if !ok || text != c.expected {
+			t.Errorf("Expected %s for %s (fallback %q), got %v", c.expected, c.locale, c.fallback, text)
+		}
+	}
+
+	if _, ok := Localize("plain", "en", ""); ok {
+		t.Fatal("Expected a plain value not to be localized")
+	}
+	if _, ok := Localize(map[string]interface{}{}, "en", ""); ok {
+		t.Fatal("Expected a value without translations not to be localized")
+	}
+}
+
+func TestSetLocalized(t *testing.T) {
+	record := map[string]interface{}{"name": "plain"}
+	if err := SetLocalized(record, "title", "en", "Hello"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetLocalized(record, "title", "de", "Hallo"); err != nil {
+		t.Fatal(err)
+	}
+	if title := record["title"].(map[string]interface{}); len(title) != 2 || title["de"] != "Hallo" {
+		t.Fatal("Expected both translations, got", title)
+	}
+	if err := SetLocalized(record, "name", "en", "x"); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input error, got", err)
+	}
+}
+
+func TestLocalizedRepository(t *testing.T) {
+	backend, err := CacheBackendBuilder(&config.DBInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Shutdown()
+
+	repo, err := backend.DefineRepository("articles", RepositoryDefinitionMap{"name": "articles"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	articles := []map[string]interface{}{
+		{"id": "1", "title": map[string]interface{}{"en": "Hello", "de": "Hallo"}, "author": "alice"},
+		{"id": "2", "title": map[string]interface{}{"en": "Goodbye"}, "author": "bob"},
+	}
+	for _, article := range articles {
+		if _, err := repo.Save(&article, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	options := &LocaleOptions{Fields: []string{"title"}, DefaultLocale: "en"}
+	german := LocalizedRepositoryFromContext(WithLocale(context.Background(), "de-AT"), repo, options)
+
+	result, err := german.GetOne(NewFilter().Match("id", "1"), &localeTestArticle{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if article := result.(*localeTestArticle); article.Title != "Hallo" || article.Author != "alice" {
+		t.Fatal("Expected the German title, got", article)
+	}
+
+	results, err := german.GetAll(nil, nil, "id", "asc", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := *results.(*[]*map[string]interface{})
+	if len(list) != 2 || (*list[0])["title"] != "Hallo" || (*list[1])["title"] != "Goodbye" {
+		t.Fatal("Expected the German title and the English fallback, got", list)
+	}
+
+	english := LocalizedRepositoryFromContext(context.Background(), repo, options)
+	result, err = english.GetOne(NewFilter().Match("id", "1"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title := (*result.(*map[string]interface{}))["title"]; title != "Hello" {
+		t.Fatal("Expected the default locale, got", title)
+	}
+}
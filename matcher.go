@@ -0,0 +1,274 @@
+package backends
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RecordMatcher reports whether a record (decoded as generic JSON map) matches a filter.
+type RecordMatcher func(record map[string]interface{}) bool
+
+// MatcherTranslator translates filters into RecordMatcher functions.
+// It is used by the backends that cannot filter the records natively (for example key-value stores),
+// so they evaluate the filters in memory with the same semantics as the other backends.
+type MatcherTranslator struct{}
+
+// Translate translates the filter AST into a RecordMatcher.
+func (t *MatcherTranslator) Translate(ast *FilterAST) (interface{}, error) {
+	matchers := []RecordMatcher{}
+
+	for _, cond := range ast.Conditions {
+		property := cond.Property
+
+		switch cond.Operator {
+		case OpEq:
+			expected, err := normalizeValue(cond.Value)
+			if err != nil {
+				return nil, ErrInvalidInput(err)
+			}
+			matchers = append(matchers, func(record map[string]interface{}) bool {
+				value, ok := record[property]
+				return ok && equalValues(value, expected)
+			})
+		case OpPattern, OpRegex:
+			expr := cond.Value.(string)
+			if cond.Operator == OpPattern {
+				expr = toMongoPattern(expr)
+			}
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, ErrInvalidInput(err)
+			}
+			matchers = append(matchers, func(record map[string]interface{}) bool {
+				value, ok := record[property].(string)
+				return ok && re.MatchString(value)
+			})
+		case OpNe:
+			unexpected, err := normalizeValue(cond.Value)
+			if err != nil {
+				return nil, ErrInvalidInput(err)
+			}
+			matchers = append(matchers, func(record map[string]interface{}) bool {
+				value, ok := record[property]
+				return !ok || !equalValues(value, unexpected)
+			})
+		case OpGt, OpGte, OpLt, OpLte:
+			bound, err := normalizeValue(cond.Value)
+			if err != nil {
+				return nil, ErrInvalidInput(err)
+			}
+			operator := cond.Operator
+			matchers = append(matchers, func(record map[string]interface{}) bool {
+				value, ok := record[property]
+				if !ok {
+					return false
+				}
+				cmp, ok := compareValues(value, bound)
+				if !ok {
+					return false
+				}
+				switch operator {
+				case OpGt:
+					return cmp > 0
+				case OpGte:
+					return cmp >= 0
+				case OpLt:
+					return cmp < 0
+				}
+				return cmp <= 0
+			})
+		case OpIn, OpNin:
+			values, err := normalizeValue(cond.Value)
+			if err != nil {
+				return nil, ErrInvalidInput(err)
+			}
+			in := cond.Operator == OpIn
+			matchers = append(matchers, func(record map[string]interface{}) bool {
+				value, ok := record[property]
+				if !ok {
+					return !in
+				}
+				for _, expected := range values.([]interface{}) {
+					if equalValues(value, expected) {
+						return in
+					}
+				}
+				return !in
+			})
+		case OpExists:
+			exists := cond.Value.(bool)
+			matchers = append(matchers, func(record map[string]interface{}) bool {
+				_, ok := record[property]
+				return ok == exists
+			})
+		case OpNull:
+			null := cond.Value.(bool)
+			matchers = append(matchers, func(record map[string]interface{}) bool {
+				value, ok := record[property]
+				return ok && (value == nil) == null
+			})
+		default:
+			return nil, ErrInvalidInput(fmt.Sprintf("operator %s is not supported", cond.Operator))
+		}
+	}
+
+	return RecordMatcher(func(record map[string]interface{}) bool {
+		for _, match := range matchers {
+			if !match(record) {
+				return false
+			}
+		}
+		return true
+	}), nil
+}
+
+var matcherTranslator = &MatcherTranslator{}
+
+// toRecordMatcher translates the filter into a RecordMatcher.
+func toRecordMatcher(filter Filter) (RecordMatcher, error) {
+	matcher, err := TranslateFilter(filter, matcherTranslator)
+	if err != nil {
+		return nil, err
+	}
+	return matcher.(RecordMatcher), nil
+}
+
+// filterRecords applies the filter, the ordering and the limit/offset on the given records, in memory.
+// The records must be decoded from JSON (see normalizeValue).
+func filterRecords(records []map[string]interface{}, filter Filter, order string, sorting string, limit int, offset int) ([]map[string]interface{}, error) {
+	matcher, err := toRecordMatcher(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	matched := []map[string]interface{}{}
+	for _, record := range records {
+		if matcher(record) {
+			matched = append(matched, record)
+		}
+	}
+
+	if order != "" {
+		sortRecords(matched, order, sorting)
+	}
+
+	if offset != 0 {
+		if offset >= len(matched) {
+			return []map[string]interface{}{}, nil
+		}
+		matched = matched[offset:]
+	}
+	if limit != 0 && limit < len(matched) {
+		matched = matched[:limit]
+	}
+
+	return matched, nil
+}
+
+// sortRecords sorts the records by the value of the order property.
+// The order property may be a path to a nested property (for example "profile.lastName").
+// The records that don't have the property are sorted last.
+func sortRecords(records []map[string]interface{}, order string, sorting string) {
+	desc := sorting == "desc"
+	sort.SliceStable(records, func(i, j int) bool {
+		a, aok := lookupPath(records[i], order)
+		b, bok := lookupPath(records[j], order)
+		if !aok || !bok {
+			return aok && !bok
+		}
+		cmp, ok := compareValues(a, b)
+		if !ok {
+			return false
+		}
+		if desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+}
+
+// lookupPath returns the value of the property with the given path. The path elements are separated with dots.
+// A property whose name is exactly the path (dots included) takes precedence over the nested property.
+func lookupPath(record map[string]interface{}, path string) (interface{}, bool) {
+	if value, ok := record[path]; ok {
+		return value, true
+	}
+
+	var current interface{} = record
+	for _, name := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = object[name]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// compareValues compares two JSON decoded values of the same type (number, string or bool). The strings that are
+// both RFC 3339 times are compared as times.
+// The second return value is false if the values cannot be compared.
+func compareValues(a, b interface{}) (int, bool) {
+	switch av := a.(type) {
+	case float64:
+		bv, ok := b.(float64)
+		if !ok {
+			return 0, false
+		}
+		if av < bv {
+			return -1, true
+		}
+		if av > bv {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		bv, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		if at, bt, ok := parseTimes(av, bv); ok {
+			// the times with different offsets or precision don't sort as strings
+			if at.Before(bt) {
+				return -1, true
+			}
+			if at.After(bt) {
+				return 1, true
+			}
+			return 0, true
+		}
+		return strings.Compare(av, bv), true
+	case bool:
+		bv, ok := b.(bool)
+		if !ok {
+			return 0, false
+		}
+		if av == bv {
+			return 0, true
+		}
+		if !av {
+			return -1, true
+		}
+		return 1, true
+	}
+	return 0, false
+}
+
+// normalizeValue converts the value to the form it would have after being stored as JSON and decoded
+// back into interface{} (numbers become float64, structs become maps etc).
+func normalizeValue(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
@@ -0,0 +1,183 @@
+package backends
+
+import (
+	"testing"
+	"time"
+)
+
+var matcherRecords = []map[string]interface{}{
+	{"id": "1", "name": "John", "age": float64(30)},
+	{"id": "2", "name": "Jane", "age": float64(25)},
+	{"id": "3", "name": "Bob", "age": float64(41)},
+	{"id": "4", "name": "Johnny"},
+}
+
+func TestRecordMatcher(t *testing.T) {
+	matcher, err := toRecordMatcher(NewFilter().MatchPattern("name", "Jo%").Match("age", 30))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matched := 0
+	for _, record := range matcherRecords {
+		if matcher(record) {
+			matched++
+			if record["id"] != "1" {
+				t.Fatal("Expected only John to match. Got: ", record)
+			}
+		}
+	}
+	if matched != 1 {
+		t.Fatal("Expected exactly 1 match. Got: ", matched)
+	}
+}
+
+func TestRecordMatcherEscaping(t *testing.T) {
+	matcher, err := toRecordMatcher(NewFilter().MatchPattern("name", "J.hn%"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range matcherRecords {
+		if matcher(record) {
+			t.Fatal("Expected '.' to be matched literally. Got match: ", record)
+		}
+	}
+
+	matcher, err = toRecordMatcher(NewFilter().MatchRegex("name", "^J.hn$"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !matcher(matcherRecords[0]) || matcher(matcherRecords[3]) {
+		t.Fatal("Expected the raw regex to match only John")
+	}
+}
+
+func TestFilterRecords(t *testing.T) {
+	records, err := filterRecords(matcherRecords, nil, "age", "desc", 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0]["id"] != "3" || records[1]["id"] != "1" {
+		t.Fatal("Expected records sorted by age descending. Got: ", records)
+	}
+
+	records, err = filterRecords(matcherRecords, nil, "age", "asc", 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0]["id"] != "3" || records[1]["id"] != "4" {
+		t.Fatal("Expected records without the order property to be last. Got: ", records)
+	}
+
+	records, err = filterRecords(matcherRecords, NewFilter().MatchPattern("name", "J%"), "", "", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 0 {
+		t.Fatal("Expected no records after the offset. Got: ", records)
+	}
+}
+
+func TestSortRecordsNestedPath(t *testing.T) {
+	records := []map[string]interface{}{
+		{"id": "1", "profile": map[string]interface{}{"lastName": "Smith"}},
+		{"id": "2"},
+		{"id": "3", "profile": map[string]interface{}{"lastName": "Doe"}},
+		{"id": "4", "profile.lastName": "Brown"},
+	}
+
+	sortRecords(records, "profile.lastName", "asc")
+	if records[0]["id"] != "4" || records[1]["id"] != "3" || records[2]["id"] != "1" || records[3]["id"] != "2" {
+		t.Fatal("Expected records sorted by the nested property. Got: ", records)
+	}
+}
+
+func TestRecordMatcherComparisons(t *testing.T) {
+	matches := func(filter Filter) []string {
+		matcher, err := toRecordMatcher(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []string{}
+		for _, record := range matcherRecords {
+			if matcher(record) {
+				ids = append(ids, record["id"].(string))
+			}
+		}
+		return ids
+	}
+
+	if ids := matches(Filter{"age": map[string]interface{}{OpGte: 30, OpLt: 41}}); len(ids) != 1 || ids[0] != "1" {
+		t.Fatal("Expected only John in the age range. Got: ", ids)
+	}
+	if ids := matches(Filter{"age": map[string]interface{}{OpGt: "20"}}); len(ids) != 0 {
+		t.Fatal("Expected a string not to be compared with numbers. Got: ", ids)
+	}
+	if ids := matches(Filter{"age": map[string]interface{}{OpNe: 30}}); len(ids) != 3 {
+		t.Fatal("Expected the records without the age to match $ne. Got: ", ids)
+	}
+	if ids := matches(Filter{"name": map[string]interface{}{OpIn: []string{"Bob", "Jane"}}}); len(ids) != 2 || ids[0] != "2" || ids[1] != "3" {
+		t.Fatal("Expected Jane and Bob to match $in. Got: ", ids)
+	}
+	if ids := matches(NewFilter().MatchNotIn("name", []string{"Bob", "Jane"})); len(ids) != 2 || ids[0] != "1" || ids[1] != "4" {
+		t.Fatal("Expected John and Johnny to match $nin. Got: ", ids)
+	}
+	if ids := matches(NewFilter().MatchNotIn("age", []int{30, 25})); len(ids) != 2 || ids[1] != "4" {
+		t.Fatal("Expected the records without the age to match $nin. Got: ", ids)
+	}
+}
+
+func TestRecordMatcherNulls(t *testing.T) {
+	records := []map[string]interface{}{
+		{"id": "1", "phone": "555"},
+		{"id": "2", "phone": nil},
+		{"id": "3"},
+	}
+	matches := func(filter Filter) string {
+		matcher, err := toRecordMatcher(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := ""
+		for _, record := range records {
+			if matcher(record) {
+				ids += record["id"].(string)
+			}
+		}
+		return ids
+	}
+
+	if ids := matches(NewFilter().MatchExists("phone", true)); ids != "12" {
+		t.Fatal("Expected the records with the phone, even if null. Got: ", ids)
+	}
+	if ids := matches(NewFilter().MatchExists("phone", false)); ids != "3" {
+		t.Fatal("Expected the record without the phone. Got: ", ids)
+	}
+	if ids := matches(NewFilter().MatchNull("phone", true)); ids != "2" {
+		t.Fatal("Expected the record with the null phone. Got: ", ids)
+	}
+	if ids := matches(NewFilter().MatchNull("phone", false)); ids != "1" {
+		t.Fatal("Expected the record with the phone set. Got: ", ids)
+	}
+	if _, err := toRecordMatcher(Filter{"phone": map[string]interface{}{OpNull: "yes"}}); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for a non-boolean $null. Got: ", err)
+	}
+}
+
+func TestRecordMatcherTimes(t *testing.T) {
+	from := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	matcher, err := toRecordMatcher(NewFilter().MatchGte("createdAt", from).MatchLt("createdAt", from.Add(time.Hour)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !matcher(map[string]interface{}{"createdAt": "2020-01-01T12:30:00.5Z"}) {
+		t.Fatal("Expected the time with fractional seconds in the range to match")
+	}
+	if !matcher(map[string]interface{}{"createdAt": "2020-01-01T14:00:00+02:00"}) {
+		t.Fatal("Expected the time with an offset in the range to match")
+	}
+	if matcher(map[string]interface{}{"createdAt": "2020-01-01T13:00:00Z"}) {
+		t.Fatal("Expected the end of the range to be excluded")
+	}
+}
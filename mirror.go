@@ -0,0 +1,362 @@
+package backends
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// MirrorFailure is saved in the dead-letter repository for every write that could not be mirrored.
+type MirrorFailure struct {
+	// Repository is the name of the repository.
+	Repository string `json:"repository"`
+	// Operation is the operation (OperationSave, OperationSaveAll, OperationUpdateAll, OperationDeleteOne or
+	// OperationDeleteAll).
+	Operation string `json:"operation"`
+	// Filter is the filter of the write.
+	Filter Filter `json:"filter,omitempty"`
+	// Object is the (normalized) object that was saved.
+	Object map[string]interface{} `json:"object,omitempty"`
+	// Objects are the (normalized) records that were created with SaveAll.
+	Objects []map[string]interface{} `json:"objects,omitempty"`
+	// Error is the error message.
+	Error string `json:"error"`
+	// FailedAt is the time of the failure.
+	FailedAt time.Time `json:"failedAt"`
+}
+
+// MirrorOptions configures the write mirroring.
+type MirrorOptions struct {
+	// DeadLetter is the repository where the failed mirror writes are saved. If nil, the failures are dropped.
+	// It should not be a repository of the mirrored backends.
+	DeadLetter Repository
+	// Workers is the number of goroutines that mirror the writes. Default is 1, which keeps the writes in order.
+	Workers int
+	// QueueSize is the maximal number of writes waiting to be mirrored. When the queue is full, the writes are not
+	// mirrored and are saved in the dead-letter repository instead. Default is 1000.
+	QueueSize int
+	// OnDeadLetterFailure is called with the failure and the error when the failure could not be saved in the
+	// dead-letter repository, so the write is lost. Default logs the failure.
+	OnDeadLetterFailure func(failure *MirrorFailure, err error)
+}
+
+// mirrorWrite is a write waiting to be mirrored.
+type mirrorWrite struct {
+	failure *MirrorFailure
+	write   func() error
+}
+
+// MirrorBackend is a Backend that mirrors the writes to a target backend.
+type MirrorBackend struct {
+	Backend
+	target  Backend
+	options *MirrorOptions
+	queue   chan *mirrorWrite
+	workers *sync.WaitGroup
+	mutex   *sync.RWMutex
+	closed  bool
+}
+
+// NewMirrorBackend wraps the primary backend so all successful writes (Save, DeleteOne and DeleteAll) are mirrored
+// to the target backend asynchronously. The callers always get the result of the primary backend and never wait
+// for the target backend. The mirroring is best-effort: the writes that fail (or don't fit in the queue) are saved
+// in the dead-letter repository, so they can be replayed later.
+// Together with NewShadowBackend this gives a migration path to another backend:
+//
+//	backend = backends.NewMirrorBackend(mongoBackend, dynamoBackend, &backends.MirrorOptions{
+//		DeadLetter: deadLetterRepo,
+//	})
+//	backend = backends.NewShadowBackend(backend, dynamoBackend, &backends.ShadowReadOptions{SampleRate: 0.1})
+//
+// The records created on the primary backend are mirrored with the values returned by the primary backend, so the
+// generated ids are the same on both backends. Shutdown waits for the queued writes to be mirrored.
+func NewMirrorBackend(primary Backend, target Backend, options *MirrorOptions) Backend {
+	if options == nil {
+		options = &MirrorOptions{}
+	}
+	if options.Workers < 1 {
+		options.Workers = 1
+	}
+	if options.QueueSize < 1 {
+		options.QueueSize = 1000
+	}
+	if options.OnDeadLetterFailure == nil {
+		options.OnDeadLetterFailure = func(failure *MirrorFailure, err error) {
+			log.Printf("ERROR: failed to save the failed %s write of %s to the dead-letter repository (%s): %s\n",
+				failure.Operation, failure.Repository, failure.Error, err.Error())
+		}
+	}
+
+	b := &MirrorBackend{
+		Backend: primary,
+		target:  target,
+		options: options,
+		queue:   make(chan *mirrorWrite, options.QueueSize),
+		workers: &sync.WaitGroup{},
+		mutex:   &sync.RWMutex{},
+	}
+
+	for i := 0; i < options.Workers; i++ {
+		b.workers.Add(1)
+		go b.work()
+	}
+
+	return b
+}
+
+// DefineRepository defines the repository on both the primary and the target backend.
+func (b *MirrorBackend) DefineRepository(name string, def RepositoryDefinition) (Repository, error) {
+	repo, err := b.Backend.DefineRepository(name, def)
+	if err != nil {
+		return nil, err
+	}
+	target, err := b.target.DefineRepository(name, def)
+	if err != nil {
+		return nil, err
+	}
+	return &MirrorRepository{
+		Repository: repo,
+		name:       name,
+		target:     target,
+		backend:    b,
+	}, nil
+}
+
+// GetRepository returns the repository from the primary backend, mirrored to the repository of the target backend.
+// If the repository is not defined on the target backend, the primary repository is returned unchanged.
+func (b *MirrorBackend) GetRepository(name string) (Repository, error) {
+	repo, err := b.Backend.GetRepository(name)
+	if err != nil {
+		return nil, err
+	}
+	target, err := b.target.GetRepository(name)
+	if err != nil {
+		return repo, nil
+	}
+	return &MirrorRepository{
+		Repository: repo,
+		name:       name,
+		target:     target,
+		backend:    b,
+	}, nil
+}
+
+// Shutdown waits for the queued writes to be mirrored and shuts down both backends.
+func (b *MirrorBackend) Shutdown() {
+	b.mutex.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.queue)
+	}
+	b.mutex.Unlock()
+
+	b.workers.Wait()
+	b.Backend.Shutdown()
+	b.target.Shutdown()
+}
+
+// enqueue queues the write to be mirrored. If the queue is full or the backend is shut down, the write
+// goes to the dead-letter repository.
+func (b *MirrorBackend) enqueue(write *mirrorWrite) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.closed {
+		b.deadLetter(write.failure, "backend is shut down")
+		return
+	}
+
+	select {
+	case b.queue <- write:
+	default:
+		b.deadLetter(write.failure, "mirror queue is full")
+	}
+}
+
+func (b *MirrorBackend) work() {
+	defer b.workers.Done()
+	for write := range b.queue {
+		if err := write.write(); err != nil {
+			b.deadLetter(write.failure, err.Error())
+		}
+	}
+}
+
+func (b *MirrorBackend) deadLetter(failure *MirrorFailure, reason string) {
+	if b.options.DeadLetter == nil {
+		return
+	}
+	failure.Error = reason
+	failure.FailedAt = time.Now()
+	if _, err := b.options.DeadLetter.Save(failure, nil); err != nil {
+		b.options.OnDeadLetterFailure(failure, err)
+	}
+}
+
+// MirrorRepository is a Repository whose writes are mirrored to a target repository.
+type MirrorRepository struct {
+	Repository
+	name    string
+	target  Repository
+	backend *MirrorBackend
+}
+
+// Save creates new record unless it does not exist, otherwise it updates the record.
+// The write is mirrored if it succeeds on the primary repository.
+func (r *MirrorRepository) Save(object interface{}, filter Filter) (interface{}, error) {
+	result, err := r.Repository.Save(object, filter)
+	if err != nil {
+		return result, err
+	}
+	filter = cloneFilter(filter)
+
+	// a new record is mirrored as returned by the primary, so it has the same id
+	mirrored := result
+	if filter != nil {
+		mirrored = object
+	}
+	normalized, nerr := normalizeValue(mirrored)
+	record, ok := normalized.(map[string]interface{})
+	failure := &MirrorFailure{
+		Repository: r.name,
+		Operation:  OperationSave,
+		Filter:     filter,
+		Object:     record,
+	}
+	if nerr != nil || !ok {
+		r.backend.deadLetter(failure, fmt.Sprintf("cannot mirror object of type %T", mirrored))
+		return result, err
+	}
+
+	r.backend.enqueue(&mirrorWrite{
+		failure: failure,
+		write: func() error {
+			_, err := r.target.Save(&record, filter)
+			return err
+		},
+	})
+	return result, err
+}
+
+// UpdateAll updates all matched records for given filter. The update is mirrored, with the same filter, if it
+// succeeds on the primary repository.
+func (r *MirrorRepository) UpdateAll(filter Filter, update interface{}) (int64, error) {
+	updated, err := r.Repository.UpdateAll(filter, update)
+	if err != nil {
+		return updated, err
+	}
+	filter = cloneFilter(filter)
+
+	normalized, nerr := normalizeValue(update)
+	record, ok := normalized.(map[string]interface{})
+	failure := &MirrorFailure{
+		Repository: r.name,
+		Operation:  OperationUpdateAll,
+		Filter:     filter,
+		Object:     record,
+	}
+	if nerr != nil || !ok {
+		r.backend.deadLetter(failure, fmt.Sprintf("cannot mirror update of type %T", update))
+		return updated, nil
+	}
+
+	r.backend.enqueue(&mirrorWrite{
+		failure: failure,
+		write: func() error {
+			_, err := r.target.UpdateAll(filter, &record)
+			return err
+		},
+	})
+	return updated, nil
+}
+
+// SaveAll creates the objects as new records. The created records are mirrored, as returned by the primary
+// repository, so they have the same ids. When the primary fails part way, the records it created are mirrored.
+func (r *MirrorRepository) SaveAll(objects interface{}) (interface{}, error) {
+	results, err := r.Repository.SaveAll(objects)
+	saved, ok := results.([]interface{})
+	if !ok || len(saved) == 0 {
+		return results, err
+	}
+
+	records := make([]map[string]interface{}, 0, len(saved))
+	for _, result := range saved {
+		normalized, nerr := normalizeValue(result)
+		record, ok := normalized.(map[string]interface{})
+		if nerr != nil || !ok {
+			r.backend.deadLetter(&MirrorFailure{
+				Repository: r.name,
+				Operation:  OperationSaveAll,
+			}, fmt.Sprintf("cannot mirror object of type %T", result))
+			continue
+		}
+		records = append(records, record)
+	}
+	if len(records) == 0 {
+		return results, err
+	}
+
+	r.backend.enqueue(&mirrorWrite{
+		failure: &MirrorFailure{
+			Repository: r.name,
+			Operation:  OperationSaveAll,
+			Objects:    records,
+		},
+		write: func() error {
+			_, err := r.target.SaveAll(records)
+			return err
+		},
+	})
+	return results, err
+}
+
+// DeleteOne deletes only one record for given filter. The delete is mirrored if it succeeds on the primary repository.
+func (r *MirrorRepository) DeleteOne(filter Filter) error {
+	if err := r.Repository.DeleteOne(filter); err != nil {
+		return err
+	}
+	filter = cloneFilter(filter)
+	r.backend.enqueue(&mirrorWrite{
+		failure: &MirrorFailure{
+			Repository: r.name,
+			Operation:  OperationDeleteOne,
+			Filter:     filter,
+		},
+		write: func() error {
+			return r.target.DeleteOne(filter)
+		},
+	})
+	return nil
+}
+
+// DeleteAll deletes all matched records for given filter. The delete is mirrored if it succeeds on the primary repository.
+func (r *MirrorRepository) DeleteAll(filter Filter) error {
+	if err := r.Repository.DeleteAll(filter); err != nil {
+		return err
+	}
+	filter = cloneFilter(filter)
+	r.backend.enqueue(&mirrorWrite{
+		failure: &MirrorFailure{
+			Repository: r.name,
+			Operation:  OperationDeleteAll,
+			Filter:     filter,
+		},
+		write: func() error {
+			return r.target.DeleteAll(filter)
+		},
+	})
+	return nil
+}
+
+// cloneFilter returns a copy of the filter, so the caller may reuse the filter while the write waits to be mirrored.
+func cloneFilter(filter Filter) Filter {
+	if filter == nil {
+		return nil
+	}
+	clone := Filter{}
+	for k, v := range filter {
+		clone[k] = v
+	}
+	return clone
+}
@@ -0,0 +1,120 @@
+package backends
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+// failingRepository is a test repository that fails all writes.
+type failingRepository struct {
+	*testRepository
+}
+
+func (r *failingRepository) Save(object interface{}, filter Filter) (interface{}, error) {
+	return nil, ErrBackendError("write failed")
+}
+
+func TestMirrorBackend(t *testing.T) {
+	primary := NewRepositoriesBackend(context.Background(), &config.DBInfo{}, testRepoBuilder, nil)
+	target := NewRepositoriesBackend(context.Background(), &config.DBInfo{}, testRepoBuilder, nil)
+	deadLetter := newTestRepository()
+
+	backend := NewMirrorBackend(primary, target, &MirrorOptions{DeadLetter: deadLetter})
+	repo, err := backend.DefineRepository("users", RepositoryDefinitionMap{"name": "users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = repo.Save(&map[string]interface{}{"id": "1", "name": "John"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repo.Save(&map[string]interface{}{"id": "2", "name": "Jane"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = repo.DeleteOne(NewFilter().Match("id", "2")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repo.UpdateAll(NewFilter().Match("name", "John"), &map[string]interface{}{"active": true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repo.SaveAll([]map[string]interface{}{{"id": "3", "name": "Bob"}, {"id": "4", "name": "Ann"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// waits for the mirrored writes
+	backend.Shutdown()
+
+	targetRepo, _ := target.GetRepository("users")
+	results, err := targetRepo.GetAll(nil, map[string]interface{}{}, "", "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mirrored := *results.(*[]*map[string]interface{})
+	if len(mirrored) != 3 || (*mirrored[0])["name"] != "John" || (*mirrored[0])["active"] != true || (*mirrored[2])["name"] != "Ann" {
+		t.Fatal("Expected John, Bob and Ann to be mirrored. Got: ", mirrored)
+	}
+	if len(deadLetter.records) != 0 {
+		t.Fatal("Expected no dead letters. Got: ", deadLetter.records)
+	}
+}
+
+func TestMirrorBackendDeadLetter(t *testing.T) {
+	primary := NewRepositoriesBackend(context.Background(), &config.DBInfo{}, testRepoBuilder, nil)
+	target := NewRepositoriesBackend(context.Background(), &config.DBInfo{}, func(def RepositoryDefinition, backend Backend) (Repository, error) {
+		return &failingRepository{newTestRepository()}, nil
+	}, nil)
+	deadLetter := newTestRepository()
+
+	backend := NewMirrorBackend(primary, target, &MirrorOptions{DeadLetter: deadLetter})
+	repo, err := backend.DefineRepository("users", RepositoryDefinitionMap{"name": "users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = repo.Save(&map[string]interface{}{"id": "1", "name": "John"}, nil); err != nil {
+		t.Fatal("Expected the primary write to succeed. Got: ", err)
+	}
+	backend.Shutdown()
+
+	if len(deadLetter.records) != 1 {
+		t.Fatal("Expected 1 dead letter. Got: ", deadLetter.records)
+	}
+	failure := deadLetter.records[0]
+	if failure["repository"] != "users" || failure["operation"] != OperationSave || !strings.Contains(failure["error"].(string), "write failed") {
+		t.Fatal("Invalid dead letter: ", failure)
+	}
+	if object, ok := failure["object"].(map[string]interface{}); !ok || object["id"] != "1" {
+		t.Fatal("Expected the object in the dead letter. Got: ", failure["object"])
+	}
+}
+
+func TestMirrorBackendDeadLetterFailure(t *testing.T) {
+	primary := NewRepositoriesBackend(context.Background(), &config.DBInfo{}, testRepoBuilder, nil)
+	target := NewRepositoriesBackend(context.Background(), &config.DBInfo{}, func(def RepositoryDefinition, backend Backend) (Repository, error) {
+		return &failingRepository{newTestRepository()}, nil
+	}, nil)
+
+	lost := []*MirrorFailure{}
+	backend := NewMirrorBackend(primary, target, &MirrorOptions{
+		DeadLetter: &failingRepository{newTestRepository()},
+		OnDeadLetterFailure: func(failure *MirrorFailure, err error) {
+			lost = append(lost, failure)
+		},
+	})
+	repo, err := backend.DefineRepository("users", RepositoryDefinitionMap{"name": "users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = repo.Save(&map[string]interface{}{"id": "1", "name": "John"}, nil); err != nil {
+		t.Fatal("Expected the primary write to succeed. Got: ", err)
+	}
+	backend.Shutdown()
+
+	if len(lost) != 1 || lost[0].Repository != "users" || lost[0].Object["id"] != "1" {
+		t.Fatal("Expected the lost write to be reported. Got: ", lost)
+	}
+}
@@ -0,0 +1,79 @@
+package backends
+
+// ModelDefinition is implemented by the repository definitions that have a model type associated with the repository.
+// RepositoryDefinitionMap implements it - see RepositoryDefinitionMap.WithModel.
+type ModelDefinition interface {
+	GetModel() interface{}
+}
+
+// WithModel associates the model type with the repository. The model is an example value of the type,
+// for example &User{}. The repositories defined with a model decode the results into the model type
+// when GetOne is called with nil result or GetAll is called with nil results type hint:
+//
+//	userRepo, err := backend.DefineRepository("users", backends.RepositoryDefinitionMap{
+//		"name": "users",
+//	}.WithModel(&User{}))
+//
+//	user, err := userRepo.GetOne(filter, nil) // user is *User
+//	users, err := userRepo.GetAll(filter, nil, "name", "asc", 0, 0) // users is *[]*User
+func (m RepositoryDefinitionMap) WithModel(model interface{}) RepositoryDefinitionMap {
+	m["model"] = model
+	return m
+}
+
+// GetModel returns the model associated with the repository, or nil if there is no model.
+func (m RepositoryDefinitionMap) GetModel() interface{} {
+	return m["model"]
+}
+
+// ModelRepository is a Repository that defaults the result types to the model type associated with the repository.
+type ModelRepository struct {
+	Repository
+	model interface{}
+}
+
+// NewModelRepository wraps the repository so the results are decoded into the model type when no type hint is given.
+func NewModelRepository(repo Repository, model interface{}) Repository {
+	return &ModelRepository{
+		Repository: repo,
+		model:      model,
+	}
+}
+
+// withModel wraps the repository with ModelRepository if the definition has a model associated.
+func withModel(repo Repository, def RepositoryDefinition) Repository {
+	modelDef, ok := def.(ModelDefinition)
+	if !ok {
+		return repo
+	}
+	model := modelDef.GetModel()
+	if model == nil {
+		return repo
+	}
+	return NewModelRepository(repo, model)
+}
+
+// Unwrap returns the wrapped repository, so its capabilities are found by AsRepository.
+func (r *ModelRepository) Unwrap() Repository {
+	return r.Repository
+}
+
+// GetOne fetches only one record for given filter. If result is nil, a new value of the model type is used.
+func (r *ModelRepository) GetOne(filter Filter, result interface{}) (interface{}, error) {
+	if result == nil {
+		model, err := CreateNewAsExample(r.model)
+		if err != nil {
+			return nil, err
+		}
+		result = model
+	}
+	return r.Repository.GetOne(filter, result)
+}
+
+// GetAll fetches all matched records for given filter. If the results type hint is nil, the model type is used.
+func (r *ModelRepository) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	if resultsTypeHint == nil {
+		resultsTypeHint = r.model
+	}
+	return r.Repository.GetAll(filter, resultsTypeHint, order, sorting, limit, offset)
+}
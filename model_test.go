@@ -0,0 +1,121 @@
+package backends
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+type modelUser struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestRepositoryWithModel(t *testing.T) {
+	backend := NewRepositoriesBackend(context.Background(), &config.DBInfo{}, testRepoBuilder, nil)
+
+	repo, err := backend.DefineRepository("users", RepositoryDefinitionMap{
+		"name": "users",
+	}.WithModel(&modelUser{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repo.Save(&modelUser{ID: "1", Name: "John"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := repo.GetOne(NewFilter().Match("id", "1"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, ok := result.(*modelUser)
+	if !ok || user.Name != "John" {
+		t.Fatalf("Expected *modelUser. Got: %#v", result)
+	}
+
+	results, err := repo.GetAll(nil, nil, "", "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, ok := results.(*[]*modelUser)
+	if !ok || len(*users) != 1 || (*users)[0].ID != "1" {
+		t.Fatalf("Expected *[]*modelUser. Got: %#v", results)
+	}
+
+	// the explicit type hint takes precedence over the model
+	results, err = repo.GetAll(nil, map[string]interface{}{}, "", "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok = results.(*[]*map[string]interface{}); !ok {
+		t.Fatalf("Expected *[]*map[string]interface{}. Got: %#v", results)
+	}
+}
+
+func TestModelRepositoryTransactAndCapabilities(t *testing.T) {
+	backend := NewDynamoBackend(&config.DBInfo{DatabaseName: "test"}, newFakeDynamoDB())
+	repo, err := backend.DefineRepository("users", RepositoryDefinitionMap{
+		"name":    "users",
+		"hashKey": "id",
+	}.WithModel(&modelUser{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repo.Save(&modelUser{ID: "1", Name: "John"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var collection *DynamoCollection
+	if !AsRepository(repo, &collection) {
+		t.Fatal("Expected the DynamoDB collection to be found under the model")
+	}
+	var rq RawQuerier
+	if !AsRepository(repo, &rq) {
+		t.Fatal("Expected the repository of a model to be a RawQuerier")
+	}
+	var watcher ChangeWatcher
+	if !AsRepository(repo, &watcher) {
+		t.Fatal("Expected the repository of a model to be a ChangeWatcher")
+	}
+	if _, err := Patch(repo, NewFilter().Match("id", "1"), nil, []string{"name"}); err != nil {
+		t.Fatal("Expected the field to be removed by the DynamoDB collection. Got: ", err)
+	}
+	var acl *ACLRepository
+	if AsRepository(repo, &acl) {
+		t.Fatal("Expected no ACLRepository in the chain")
+	}
+
+	err = backend.Transact(context.Background(), func(tx Transaction) error {
+		users, err := tx.GetRepository("users")
+		if err != nil {
+			return err
+		}
+		var checker ConditionChecker
+		if !AsRepository(users, &checker) {
+			t.Fatal("Expected the repository of the transaction to be a ConditionChecker")
+		}
+		if err := checker.Check(NewFilter().Match("id", "1")); err != nil {
+			return err
+		}
+		result, err := users.GetOne(NewFilter().Match("id", "1"), nil)
+		if err != nil {
+			return err
+		}
+		if _, ok := result.(*modelUser); !ok {
+			t.Fatalf("Expected *modelUser in the transaction. Got: %#v", result)
+		}
+		_, err = users.Save(&modelUser{ID: "2", Name: "Jane"}, nil)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := repo.GetOne(NewFilter().Match("id", "2"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user, ok := result.(*modelUser); !ok || user.Name != "Jane" {
+		t.Fatalf("Expected the user saved in the transaction. Got: %#v", result)
+	}
+}
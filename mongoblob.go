@@ -0,0 +1,186 @@
+package backends
+
+import (
+	"io"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// GridFSBlobRepository is a BlobRepository stored in GridFS, in the <name>.files and <name>.chunks collections of the
+// database of the backend. The content is split in chunks of 255kB, so the blobs may be larger than the 16MB limit of
+// a document, and the metadata is stored in the "metadata" property of the file.
+type GridFSBlobRepository struct {
+	session  *mgo.Session
+	database string
+	name     string
+}
+
+// gridFSReader is the content of a GridFS file. It closes the session of the file when it is closed.
+type gridFSReader struct {
+	*mgo.GridFile
+	session *mgo.Session
+}
+
+// GetBlobRepository returns the blob repository stored in GridFS with the name as prefix of its collections.
+func (b *MongoBackend) GetBlobRepository(name string) (BlobRepository, error) {
+	if name == "" {
+		return nil, ErrInvalidInput("blob repository name is missing and required")
+	}
+	repo := &GridFSBlobRepository{
+		session:  b.session,
+		database: b.GetConfig().DatabaseName,
+		name:     name,
+	}
+
+	session := b.session.Copy()
+	defer session.Close()
+	// the latest file with the name is the current content of the blob
+	if err := repo.gridFS(session).Files.EnsureIndexKey("filename", "uploadDate"); err != nil {
+		return nil, ErrBackendError(err)
+	}
+	return repo, nil
+}
+
+// Put stores the content as a new file, then removes the previous files with the name. The readers of a previous file
+// fail if it is removed before they read all of its chunks.
+func (r *GridFSBlobRepository) Put(name string, content io.Reader, contentType string, metadata map[string]string) (*BlobInfo, error) {
+	if err := validateBlobName(name); err != nil {
+		return nil, err
+	}
+	if contentType == "" {
+		contentType = blobContentType
+	}
+	metadata = blobMetadata(metadata)
+
+	session := r.session.Copy()
+	defer session.Close()
+	fs := r.gridFS(session)
+
+	file, err := fs.Create(name)
+	if err != nil {
+		return nil, ErrBackendError(err)
+	}
+	file.SetContentType(contentType)
+	if metadata != nil {
+		file.SetMeta(metadata)
+	}
+	if _, err := io.Copy(file, content); err != nil {
+		// the chunks written so far are removed when the aborted file is closed
+		file.Abort()
+		file.Close()
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, ErrBackendError(err)
+	}
+
+	previous := fs.Find(bson.M{"filename": name, "_id": bson.M{"$ne": file.Id()}}).Select(bson.M{"_id": 1}).Iter()
+	var doc struct {
+		ID interface{} `bson:"_id"`
+	}
+	for previous.Next(&doc) {
+		if err := fs.RemoveId(doc.ID); err != nil {
+			previous.Close()
+			return nil, ErrBackendError(err)
+		}
+	}
+	if err := previous.Close(); err != nil {
+		return nil, ErrBackendError(err)
+	}
+
+	return gridFSBlobInfo(file), nil
+}
+
+// Get opens the latest file with the name. The content must be closed.
+func (r *GridFSBlobRepository) Get(name string) (io.ReadCloser, *BlobInfo, error) {
+	session := r.session.Copy()
+	file, err := r.open(session, name)
+	if err != nil {
+		session.Close()
+		return nil, nil, err
+	}
+	return &gridFSReader{
+		GridFile: file,
+		session:  session,
+	}, gridFSBlobInfo(file), nil
+}
+
+// Stat returns the info of the latest file with the name.
+func (r *GridFSBlobRepository) Stat(name string) (*BlobInfo, error) {
+	session := r.session.Copy()
+	defer session.Close()
+	file, err := r.open(session, name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return gridFSBlobInfo(file), nil
+}
+
+// Delete removes all files with the name, with their chunks.
+func (r *GridFSBlobRepository) Delete(name string) error {
+	if err := validateBlobName(name); err != nil {
+		return err
+	}
+	session := r.session.Copy()
+	defer session.Close()
+	fs := r.gridFS(session)
+
+	count, err := fs.Find(bson.M{"filename": name}).Count()
+	if err != nil {
+		return ErrBackendError(err)
+	}
+	if count == 0 {
+		return ErrNotFound("blob not found")
+	}
+	if err := fs.Remove(name); err != nil {
+		return ErrBackendError(err)
+	}
+	return nil
+}
+
+// gridFS returns the GridFS of the repository on the session.
+func (r *GridFSBlobRepository) gridFS(session *mgo.Session) *mgo.GridFS {
+	return session.DB(r.database).GridFS(r.name)
+}
+
+// open opens the latest file with the name for reading.
+func (r *GridFSBlobRepository) open(session *mgo.Session, name string) (*mgo.GridFile, error) {
+	if err := validateBlobName(name); err != nil {
+		return nil, err
+	}
+	file, err := r.gridFS(session).Open(name)
+	if err == mgo.ErrNotFound {
+		return nil, ErrNotFound("blob not found")
+	}
+	if err != nil {
+		return nil, ErrBackendError(err)
+	}
+	return file, nil
+}
+
+// Close closes the file and its session.
+func (r *gridFSReader) Close() error {
+	err := r.GridFile.Close()
+	r.session.Close()
+	return err
+}
+
+// gridFSBlobInfo returns the info of the GridFS file.
+func gridFSBlobInfo(file *mgo.GridFile) *BlobInfo {
+	info := &BlobInfo{
+		Name:        file.Name(),
+		Size:        file.Size(),
+		ContentType: file.ContentType(),
+		UpdatedAt:   file.UploadDate(),
+	}
+	if info.ContentType == "" {
+		info.ContentType = blobContentType
+	}
+	var metadata map[string]string
+	if err := file.GetMeta(&metadata); err == nil && len(metadata) > 0 {
+		info.Metadata = metadata
+	}
+	return info
+}
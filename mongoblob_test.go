@@ -0,0 +1,64 @@
+package backends
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func TestGridFSBlobRepository(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode.")
+	}
+
+	bm := NewBackendSupport(map[string]*config.DBInfo{
+		"mongodb": &config.DBInfo{
+			DatabaseName: "testdb",
+			Host:         "localhost:27017",
+			Username:     "testuser",
+			Password:     "testpass",
+		},
+	})
+	backend, err := bm.GetBackend("mongodb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := backend.(BlobBackend).GetBlobRepository("attachments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Delete("invoice.pdf")
+
+	if _, err := repo.Put("invoice.pdf", strings.NewReader("first"), "application/pdf", nil); err != nil {
+		t.Fatal(err)
+	}
+	info, err := repo.Put("invoice.pdf", strings.NewReader("second"), "application/pdf", map[string]string{"OrderId": "42"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != 6 || info.ContentType != "application/pdf" || info.Metadata["orderid"] != "42" || info.UpdatedAt.IsZero() {
+		t.Fatal("Unexpected info: ", info)
+	}
+
+	content, info, err := repo.Get("invoice.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(content)
+	content.Close()
+	if err != nil || string(data) != "second" {
+		t.Fatal("Expected the latest content. Got: ", string(data), err)
+	}
+
+	if err := repo.Delete("invoice.pdf"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Stat("invoice.pdf"); !IsErrNotFound(err) {
+		t.Fatal("Expected ErrNotFound after Delete. Got: ", err)
+	}
+	if err := repo.Delete("invoice.pdf"); !IsErrNotFound(err) {
+		t.Fatal("Expected ErrNotFound from Delete. Got: ", err)
+	}
+}
@@ -0,0 +1,142 @@
+package backends
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoChangeAwaitTime is how long the server waits for new changes before it answers a getMore of a change stream
+// with an empty batch.
+var mongoChangeAwaitTime = time.Second
+
+// mongoChange is a change document of a MongoDB change stream.
+type mongoChange struct {
+	OperationType string                 `bson:"operationType"`
+	DocumentKey   map[string]interface{} `bson:"documentKey"`
+	FullDocument  map[string]interface{} `bson:"fullDocument"`
+	ClusterTime   primitive.Timestamp    `bson:"clusterTime"`
+}
+
+// Watch delivers the changes of the documents that match the filter, read from the change stream of the collection
+// with the official driver, so MongoDB must run as a replica set (or a sharded cluster). The changes made after Watch
+// returns are delivered in order, with the document after the change (looked up for the updates): the filter matches
+// the document as decoded from JSON (with the id as a hex string and the dates as RFC 3339 strings), or only the key
+// for the deletions, as MongoDB delivers no image of the deleted documents. The driver resumes the stream after the last delivered change when it fails with a resumable
+// error, for example on a failover. Returns ErrNotSupported on a standalone server.
+func (c *MongoCollection) Watch(filter Filter) (ChangeStream, error) {
+	collection, err := c.driverCollection()
+	if err != nil {
+		return nil, err
+	}
+	feed, err := newChangeFeed(filter, 100)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	streamOptions := options.ChangeStream().
+		SetFullDocument(options.UpdateLookup).
+		SetMaxAwaitTime(mongoChangeAwaitTime)
+	stream, err := collection.Watch(ctx, mongo.Pipeline{}, streamOptions)
+	if err != nil {
+		cancel()
+		var serverErr mongo.ServerError
+		// 40573: not a replica set, 40324: a server older than 3.6
+		if errors.As(err, &serverErr) && (serverErr.HasErrorCode(40573) || serverErr.HasErrorCode(40324)) {
+			return nil, ErrNotSupported(fmt.Sprintf("change streams are not supported by the MongoDB server: %s", err))
+		}
+		return nil, ErrBackendError(err)
+	}
+	go c.readChanges(ctx, cancel, stream, feed)
+	return feed, nil
+}
+
+// readChanges publishes the changes of the stream until the feed is stopped or the stream fails and cannot be resumed.
+// The events of the feed are closed once the stream is closed.
+func (c *MongoCollection) readChanges(ctx context.Context, cancel context.CancelFunc, stream *mongo.ChangeStream, feed *changeFeed) {
+	defer func() {
+		stream.Close(context.Background())
+		cancel()
+		close(feed.events)
+	}()
+	// stopping the feed interrupts the wait for the next change
+	go func() {
+		select {
+		case <-feed.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for stream.Next(ctx) {
+		change := mongoChange{}
+		if err := stream.Decode(&change); err != nil {
+			feed.fail(ErrBackendError(err))
+			return
+		}
+		event, err := c.changeEvent(change)
+		if err != nil {
+			feed.fail(err)
+			return
+		}
+		if event != nil && !feed.publish(event) {
+			return
+		}
+	}
+	if err := stream.Err(); err != nil && ctx.Err() == nil {
+		feed.fail(ErrBackendError(err))
+		return
+	}
+	feed.stop()
+}
+
+// changeEvent converts the change document to a ChangeEvent. Returns nil for the changes of the collection that are
+// not changes of a document, and an error once the stream is invalidated (the collection was dropped or renamed).
+func (c *MongoCollection) changeEvent(change mongoChange) (*ChangeEvent, error) {
+	event := &ChangeEvent{Time: time.Now()}
+	switch change.OperationType {
+	case "insert":
+		event.Type = ChangeInsert
+	case "update", "replace":
+		event.Type = ChangeUpdate
+	case "delete":
+		event.Type = ChangeDelete
+	case "invalidate":
+		return nil, ErrBackendError(fmt.Sprintf("MongoDB change stream of %s was invalidated", c.Name))
+	default:
+		return nil, nil
+	}
+	if change.ClusterTime.T != 0 {
+		event.Time = time.Unix(int64(change.ClusterTime.T), 0)
+	}
+	key, err := c.changeRecord(change.DocumentKey)
+	if err != nil {
+		return nil, err
+	}
+	event.Key = key
+	// an updated document that was deleted before it was looked up has no full document
+	if event.Type != ChangeDelete && change.FullDocument != nil {
+		if event.Record, err = c.changeRecord(change.FullDocument); err != nil {
+			return nil, err
+		}
+	}
+	return event, nil
+}
+
+// changeRecord converts the document of a change to a record decoded from JSON (see normalizeValue), with the id as
+// a hex string, so the filter of the feed matches the numbers, the times and the ids of the document.
+func (c *MongoCollection) changeRecord(document map[string]interface{}) (map[string]interface{}, error) {
+	record := fromMongoDriverDocument(document)
+	c.hexID(record)
+	normalized, err := normalizeValue(record)
+	if err != nil {
+		return nil, ErrBackendError(err)
+	}
+	return normalized.(map[string]interface{}), nil
+}
@@ -0,0 +1,145 @@
+package backends
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gopkg.in/mgo.v2"
+)
+
+func TestMongoChangeEvent(t *testing.T) {
+	collection := &MongoCollection{Collection: &mgo.Collection{Name: "users"}, repoDef: RepositoryDefinitionMap{}}
+	id := primitive.NewObjectID()
+	changed := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	event, err := collection.changeEvent(mongoChange{
+		OperationType: "replace",
+		DocumentKey:   map[string]interface{}{"_id": id},
+		FullDocument:  map[string]interface{}{"_id": id, "status": "active"},
+		ClusterTime:   primitive.Timestamp{T: uint32(changed.Unix()), I: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != ChangeUpdate || event.Key["id"] != id.Hex() || event.Record["id"] != id.Hex() || event.Record["status"] != "active" {
+		t.Fatal("Expected the update with the hex ids. Got: ", event)
+	}
+	if !event.Time.Equal(changed) {
+		t.Fatal("Expected the time of the cluster timestamp. Got: ", event.Time)
+	}
+
+	// the deletions have only the key
+	event, err = collection.changeEvent(mongoChange{OperationType: "delete", DocumentKey: map[string]interface{}{"_id": id}})
+	if err != nil || event.Type != ChangeDelete || event.Record != nil || event.Key["id"] != id.Hex() {
+		t.Fatal("Expected the deletion of the key. Got: ", event, err)
+	}
+
+	if event, err := collection.changeEvent(mongoChange{OperationType: "drop"}); err != nil || event != nil {
+		t.Fatal("Expected the drop to be skipped. Got: ", event, err)
+	}
+	if _, err := collection.changeEvent(mongoChange{OperationType: "invalidate"}); err == nil {
+		t.Fatal("Expected an error for the invalidated stream")
+	}
+}
+
+func TestMongoChangeEventFilter(t *testing.T) {
+	collection := &MongoCollection{Collection: &mgo.Collection{Name: "users"}, repoDef: RepositoryDefinitionMap{}}
+	id := primitive.NewObjectID()
+	teamID := primitive.NewObjectID()
+	joined := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	event, err := collection.changeEvent(mongoChange{
+		OperationType: "insert",
+		DocumentKey:   map[string]interface{}{"_id": id},
+		FullDocument: map[string]interface{}{
+			"_id":    id,
+			"age":    int32(30),
+			"score":  int64(1200),
+			"joined": primitive.NewDateTimeFromTime(joined),
+			"teamId": teamID,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filters := map[string]Filter{
+		"number":   NewFilter().Match("age", 30),
+		"range":    NewFilter().MatchGte("age", 18).MatchLt("score", 2000),
+		"time":     NewFilter().MatchGt("joined", joined.Add(-time.Hour)),
+		"objectId": NewFilter().Match("teamId", teamID.Hex()),
+	}
+	for name, filter := range filters {
+		feed, err := newChangeFeed(filter, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !feed.publish(event) || len(feed.events) != 1 {
+			t.Fatalf("Expected the %s filter to match the change. Got: %v", name, event.Record)
+		}
+	}
+
+	feed, err := newChangeFeed(NewFilter().MatchGt("age", 30), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !feed.publish(event) || len(feed.events) != 0 {
+		t.Fatal("Expected the range filter not to match the change")
+	}
+}
+
+func TestMongoWatch(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode.")
+	}
+
+	bm := NewBackendSupport(map[string]*config.DBInfo{
+		"mongodb": &config.DBInfo{
+			DatabaseName: "testdb",
+			Host:         "localhost:27017",
+			Username:     "testuser",
+			Password:     "testpass",
+		},
+	})
+	backend, err := bm.GetBackend("mongodb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := backend.DefineRepository("watch_coll", RepositoryDefinitionMap{"name": "watch_coll"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.DeleteAll(nil)
+
+	var watcher ChangeWatcher
+	if !AsRepository(repo, &watcher) {
+		t.Fatal("Expected the MongoDB repository to be a ChangeWatcher")
+	}
+	changes, err := watcher.Watch(NewFilter().Match("value", "watched"))
+	if IsErrorOfType(err, ErrNotSupported("")) {
+		t.Skip("MongoDB is not a replica set: ", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer changes.Close()
+
+	if _, err := repo.Save(&TestEntry{Value: "ignored"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := repo.Save(&TestEntry{Value: "watched"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changes.Next() {
+		t.Fatal("Expected a change. Got: ", changes.Err())
+	}
+	entry := TestEntry{}
+	if err := changes.Event().Decode(&entry); err != nil {
+		t.Fatal(err)
+	}
+	if changes.Event().Type != ChangeInsert || entry.ID != saved.(*TestEntry).ID {
+		t.Fatal("Expected the insert of the watched entry. Got: ", changes.Event())
+	}
+}
@@ -4,8 +4,13 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/url"
+	"os"
 	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Microkubes/microservice-tools/config"
@@ -17,10 +22,80 @@ import (
 // MONGO_CTX_KEY is mongoDB context key
 var MONGO_CTX_KEY = "MONGO_SESSION"
 
+// MONGO_SESSIONS_CTX_KEY is the context key of the registry of the sessions of the repositories with their own read
+// preference, so they are closed with the backend.
+var MONGO_SESSIONS_CTX_KEY = "MONGO_SESSIONS"
+
+// MONGO_CLIENT_CTX_KEY is the context key of the official MongoDB driver, for the transactions and the change streams.
+var MONGO_CLIENT_CTX_KEY = "MONGO_CLIENT"
+
+// The read preferences of the MongoDB sessions (see MongoReadPreferenceDefinition). The default is "monotonic": the
+// reads go to a secondary until the first write, and to the primary after it.
+const (
+	MongoReadPrimary            = "primary"
+	MongoReadPrimaryPreferred   = "primaryPreferred"
+	MongoReadSecondary          = "secondary"
+	MongoReadSecondaryPreferred = "secondaryPreferred"
+	MongoReadNearest            = "nearest"
+	MongoReadMonotonic          = "monotonic"
+)
+
+// MongoReadPreferenceDefinition is implemented by the repository definitions that read from other members of the
+// replica set than the backend. RepositoryDefinitionMap implements it with the "readPreference" property.
+type MongoReadPreferenceDefinition interface {
+	GetReadPreference() string
+}
+
+// GetReadPreference returns the read preference of the repository - MongoDB specific. Empty means the read
+// preference of the backend.
+func (m RepositoryDefinitionMap) GetReadPreference() string {
+	if readPreference, ok := m["readPreference"]; ok {
+		return readPreference.(string)
+	}
+
+	return ""
+}
+
+// MongoWriteConcernDefinition is implemented by the repository definitions that acknowledge the writes differently
+// than the backend. RepositoryDefinitionMap implements it with the "writeConcern" property.
+type MongoWriteConcernDefinition interface {
+	GetWriteConcern() map[string]interface{}
+}
+
+// GetWriteConcern returns the write concern of the repository - MongoDB specific: "w" is the number of the members
+// that acknowledge the writes, "majority" or a tag set, "wtimeout" is the time limit of the acknowledgment in
+// milliseconds, and "j" whether the writes are acknowledged after they are written to the journal. nil means the
+// write concern of the backend.
+func (m RepositoryDefinitionMap) GetWriteConcern() map[string]interface{} {
+	if writeConcern, ok := m["writeConcern"]; ok {
+		return writeConcern.(map[string]interface{})
+	}
+
+	return nil
+}
+
+// mongoSessionRegistry holds the sessions of the repositories of a backend, so they can be closed on shutdown.
+type mongoSessionRegistry struct {
+	sessions []*mgo.Session
+	mutex    *sync.Mutex
+}
+
+// close closes the sessions of the repositories.
+func (r *mongoSessionRegistry) close() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, session := range r.sessions {
+		session.Close()
+	}
+	r.sessions = nil
+}
+
 // MongoCollection wraps a mgo.Collection to embed methods in models.
 type MongoCollection struct {
 	*mgo.Collection
 	repoDef RepositoryDefinition
+	// driver is the official driver, for the transactions and the change streams
+	driver *mongoDriver
 }
 
 // MongoDBRepoBuilder builds new mongo collection.
@@ -47,7 +122,45 @@ func MongoDBRepoBuilder(repoDef RepositoryDefinition, backend Backend) (Reposito
 		return nil, ErrBackendError("collection name is missing and required")
 	}
 
-	mongoColl, err := PrepareDB(
+	if err := checkTTLExpired(repoDef); err != nil {
+		return nil, err
+	}
+
+	session, err := mongoRepositorySession(session, repoDef, backend)
+	if err != nil {
+		return nil, err
+	}
+
+	documentDB, _ := backend.GetFromContext(DOCUMENTDB_CTX_KEY).(bool)
+	driver, _ := backend.GetFromContext(MONGO_CLIENT_CTX_KEY).(*mongoDriver)
+
+	view, err := repositoryMongoView(repoDef)
+	if err != nil {
+		return nil, err
+	}
+	if view != nil {
+		if documentDB {
+			return nil, ErrNotSupported("DocumentDB does not support views")
+		}
+		database := session.DB(databaseName)
+		if err := ensureMongoView(database, collectionName, view); err != nil {
+			return nil, err
+		}
+		return &MongoView{
+			collection: &MongoCollection{
+				Collection: database.C(collectionName),
+				repoDef:    repoDef,
+				driver:     driver,
+			},
+		}, nil
+	}
+
+	collectionOptions, err := repositoryMongoOptions(repoDef, documentDB)
+	if err != nil {
+		return nil, err
+	}
+
+	mongoColl, err := prepareCollection(
 		session,
 		databaseName,
 		collectionName,
@@ -55,6 +168,7 @@ func MongoDBRepoBuilder(repoDef RepositoryDefinition, backend Backend) (Reposito
 		repoDef.EnableTTL(),
 		repoDef.GetTTL(),
 		repoDef.GetTTLAttribute(),
+		collectionOptions,
 	)
 
 	if err != nil {
@@ -64,10 +178,12 @@ func MongoDBRepoBuilder(repoDef RepositoryDefinition, backend Backend) (Reposito
 	return &MongoCollection{
 		Collection: mongoColl,
 		repoDef:    repoDef,
+		driver:     driver,
 	}, nil
 }
 
-// MongoDBBackendBuilder returns RepositoriesBackend
+// MongoDBBackendBuilder returns a MongoBackend. The repositories use an mgo session, and the transactions and the change
+// streams a client of the official driver, connected on their first use (see MongoBackend.Transact).
 func MongoDBBackendBuilder(conf *config.DBInfo, manager BackendManager) (Backend, error) {
 
 	session, err := NewSession(conf.Host, conf.Username, conf.Password, conf.DatabaseName)
@@ -75,44 +191,403 @@ func MongoDBBackendBuilder(conf *config.DBInfo, manager BackendManager) (Backend
 		return nil, err
 	}
 
+	driver := newMongoDriver(conf, nil)
+	registry := &mongoSessionRegistry{mutex: &sync.Mutex{}}
 	ctx := context.WithValue(context.Background(), MONGO_CTX_KEY, session)
+	ctx = context.WithValue(ctx, MONGO_SESSIONS_CTX_KEY, registry)
+	ctx = context.WithValue(ctx, MONGO_CLIENT_CTX_KEY, driver)
+	done := make(chan struct{})
+	go watchSession(session, done)
 	cleanup := func() {
+		close(done)
+		registry.close()
 		session.Close()
+		driver.disconnect()
 	}
 
-	return NewRepositoriesBackend(ctx, conf, MongoDBRepoBuilder, cleanup), nil
+	return &MongoBackend{
+		Backend: NewRepositoriesBackend(ctx, conf, MongoDBRepoBuilder, cleanup),
+		session: session,
+		driver:  driver,
+	}, nil
 }
 
-// NewSession returns a new Mongo Session.
+// MongoPingInterval is how often the sessions of the MongoDB and the DocumentDB backends are pinged. A session that
+// can not reach its server (for example after the primary of the replica set failed over) is refreshed, so the next
+// requests go to the new primary.
+var MongoPingInterval = 5 * time.Second
+
+// NewSession returns a new Mongo Session. The host may be a single host, the comma-separated hosts of a replica set,
+// or a connection string (see mongoDialInfo), so the session connects to the whole replica set.
 func NewSession(Host string, Username string, Password string, Database string) (*mgo.Session, error) {
 
-	session, err := mgo.DialWithInfo(&mgo.DialInfo{
-		Addrs:    []string{Host},
-		Username: Username,
-		Password: Password,
-		Database: Database,
-		Timeout:  30 * time.Second,
-	})
+	info, err := mongoDialInfo(Host, Username, Password, Database)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := mgo.DialWithInfo(info)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := configureMongoSession(session, Host); err != nil {
+		session.Close()
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// mongoDialInfo returns the dial info of the host, which may be:
+//   - a single host ("mongo:27017"), or the comma-separated seed hosts of a replica set ("mongo1:27017,mongo2:27017"),
+//     optionally prefixed with the name of the replica set ("rs0/mongo1:27017,mongo2:27017").
+//   - a connection string ("mongodb://mongo1,mongo2/users?replicaSet=rs0"), or a DNS seed list
+//     ("mongodb+srv://cluster0.example.mongodb.net/users"), see parseMongoURI.
+//
+// The name of the replica set may also be set with MONGO_REPLICA_SET environment variable. The username, the
+// password and the database override the ones of the connection string, unless they are empty.
+func mongoDialInfo(host string, username string, password string, database string) (*mgo.DialInfo, error) {
+	info := &mgo.DialInfo{}
+	if strings.HasPrefix(host, "mongodb://") || strings.HasPrefix(host, "mongodb+srv://") {
+		parsed, err := parseMongoURI(host)
+		if err != nil {
+			return nil, err
+		}
+		info = parsed
+	} else {
+		if i := strings.Index(host, "/"); i >= 0 {
+			info.ReplicaSetName = strings.TrimSpace(host[:i])
+			host = host[i+1:]
+		}
+		for _, addr := range strings.Split(host, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				info.Addrs = append(info.Addrs, addr)
+			}
+		}
+	}
+	if len(info.Addrs) == 0 {
+		return nil, ErrBackendError("MongoDB host is missing and required")
+	}
+
+	if replicaSet := os.Getenv("MONGO_REPLICA_SET"); replicaSet != "" {
+		info.ReplicaSetName = replicaSet
+	}
+	if username != "" {
+		info.Username = username
+	}
+	if password != "" {
+		info.Password = password
+	}
+	if database != "" {
+		info.Database = database
+	}
+	if info.Timeout == 0 {
+		info.Timeout = 30 * time.Second
+	}
+	return info, nil
+}
+
+// mongoMode returns the mgo session mode of the read preference.
+func mongoMode(readPreference string) (mgo.Mode, error) {
+	switch readPreference {
+	case MongoReadPrimary:
+		return mgo.Primary, nil
+	case MongoReadPrimaryPreferred:
+		return mgo.PrimaryPreferred, nil
+	case MongoReadSecondary:
+		return mgo.Secondary, nil
+	case MongoReadSecondaryPreferred:
+		return mgo.SecondaryPreferred, nil
+	case MongoReadNearest:
+		return mgo.Nearest, nil
+	case MongoReadMonotonic:
+		return mgo.Monotonic, nil
+	}
+	return 0, ErrBackendError(fmt.Sprintf("unknown MongoDB read preference %q", readPreference))
+}
+
+// mongoURIOptions returns the options of the connection string, none if the host is not a connection string.
+func mongoURIOptions(host string) (url.Values, error) {
+	if !strings.Contains(host, "://") || !strings.Contains(host, "?") {
+		return url.Values{}, nil
+	}
+	options, err := url.ParseQuery(host[strings.Index(host, "?")+1:])
+	if err != nil {
+		return nil, ErrBackendError("invalid options of the MongoDB connection string: " + err.Error())
+	}
+	return options, nil
+}
+
+// mongoSessionMode returns the mode of the session of the backend: the read preference of MONGO_READ_PREFERENCE
+// environment variable, or of the readPreference option of the connection string, otherwise monotonic.
+func mongoSessionMode(host string) (mgo.Mode, error) {
+	readPreference := os.Getenv("MONGO_READ_PREFERENCE")
+	if readPreference == "" {
+		options, err := mongoURIOptions(host)
+		if err != nil {
+			return 0, err
+		}
+		readPreference = options.Get("readPreference")
+	}
+	if readPreference == "" {
+		return mgo.Monotonic, nil
+	}
+	return mongoMode(readPreference)
+}
+
+// mongoSessionWriteConcern returns the write concern of the session of the backend: the w, wtimeoutMS and journal
+// options of the connection string, overridden by MONGO_WRITE_CONCERN, MONGO_WRITE_TIMEOUT (in milliseconds) and
+// MONGO_JOURNAL environment variables. Returns nil if none is set, for the default of mgo (acknowledged by the
+// primary).
+func mongoSessionWriteConcern(host string) (map[string]interface{}, error) {
+	options, err := mongoURIOptions(host)
 	if err != nil {
 		return nil, err
 	}
+	concern := map[string]interface{}{}
+	for key, sources := range map[string][]string{
+		"w":        {options.Get("w"), os.Getenv("MONGO_WRITE_CONCERN")},
+		"wtimeout": {options.Get("wtimeoutMS"), os.Getenv("MONGO_WRITE_TIMEOUT")},
+		"j":        {options.Get("journal"), os.Getenv("MONGO_JOURNAL")},
+	} {
+		for _, value := range sources {
+			if value != "" {
+				concern[key] = value
+			}
+		}
+	}
+	if len(concern) == 0 {
+		return nil, nil
+	}
+	return concern, nil
+}
+
+// mongoSafe returns the mgo safety mode of the write concern (see GetWriteConcern). The values may also be strings,
+// as in the connection strings. Returns nil for w 0, which does not wait for the acknowledgment of the writes.
+func mongoSafe(concern map[string]interface{}) (*mgo.Safe, error) {
+	safe := &mgo.Safe{}
+	unacknowledged := false
+	for key, value := range concern {
+		switch key {
+		case "w":
+			if mode, ok := value.(string); ok {
+				if n, err := strconv.Atoi(mode); err == nil {
+					value = n
+				} else {
+					safe.WMode = mode
+					continue
+				}
+			}
+			n, ok := mongoConcernNumber(value)
+			if !ok || n < 0 {
+				return nil, ErrBackendError(fmt.Sprintf("invalid write concern w: %v", value))
+			}
+			safe.W = n
+			unacknowledged = n == 0
+		case "wtimeout":
+			n, ok := mongoConcernNumber(value)
+			if !ok || n < 0 {
+				return nil, ErrBackendError(fmt.Sprintf("invalid write concern wtimeout: %v", value))
+			}
+			safe.WTimeout = n
+		case "j":
+			j, ok := value.(bool)
+			if s, isString := value.(string); isString {
+				var err error
+				j, err = strconv.ParseBool(s)
+				ok = err == nil
+			}
+			if !ok {
+				return nil, ErrBackendError(fmt.Sprintf("invalid write concern j: %v", value))
+			}
+			safe.J = j
+		default:
+			return nil, ErrBackendError("unknown write concern property " + key)
+		}
+	}
+	if unacknowledged && !safe.J {
+		return nil, nil
+	}
+	return safe, nil
+}
+
+// mongoConcernNumber returns the number of the write concern.
+func mongoConcernNumber(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), v == float64(int(v))
+	case string:
+		n, err := strconv.Atoi(v)
+		return n, err == nil
+	}
+	return 0, false
+}
 
+// configureMongoSession sets the read preference and the write concern of the session of the backend.
+func configureMongoSession(session *mgo.Session, host string) error {
+	mode, err := mongoSessionMode(host)
+	if err != nil {
+		return err
+	}
 	// SetMode - consistency mode for the session.
-	session.SetMode(mgo.Monotonic, true)
+	session.SetMode(mode, true)
+
+	concern, err := mongoSessionWriteConcern(host)
+	if err != nil || concern == nil {
+		return err
+	}
+	safe, err := mongoSafe(concern)
+	if err != nil {
+		return err
+	}
+	session.SetSafe(safe)
+	return nil
+}
+
+// mongoRepositorySession returns the session of the repository. The repositories with their own read preference or
+// write concern use a clone of the session of the backend, closed with the backend.
+func mongoRepositorySession(session *mgo.Session, repoDef RepositoryDefinition, backend Backend) (*mgo.Session, error) {
+	readPreference := ""
+	if readPreferenceDef, ok := repoDef.(MongoReadPreferenceDefinition); ok {
+		readPreference = readPreferenceDef.GetReadPreference()
+	}
+	var concern map[string]interface{}
+	if writeConcernDef, ok := repoDef.(MongoWriteConcernDefinition); ok {
+		concern = writeConcernDef.GetWriteConcern()
+	}
+	if readPreference == "" && concern == nil {
+		return session, nil
+	}
+
+	var mode mgo.Mode
+	var safe *mgo.Safe
+	var err error
+	if readPreference != "" {
+		if mode, err = mongoMode(readPreference); err != nil {
+			return nil, err
+		}
+	}
+	if concern != nil {
+		if safe, err = mongoSafe(concern); err != nil {
+			return nil, err
+		}
+	}
 
+	session = session.Clone()
+	if readPreference != "" {
+		session.SetMode(mode, true)
+	}
+	if concern != nil {
+		session.SetSafe(safe)
+	}
+	if registry, ok := backend.GetFromContext(MONGO_SESSIONS_CTX_KEY).(*mongoSessionRegistry); ok {
+		registry.mutex.Lock()
+		registry.sessions = append(registry.sessions, session)
+		registry.mutex.Unlock()
+	}
 	return session, nil
 }
 
-// PrepareDB ensure presence of persistent and immutable data in the DB. It creates indexes
+// watchSession pings the session every MongoPingInterval until done is closed, and refreshes the session when the
+// ping fails. mgo keeps the socket of the session to the primary after the primary fails, so without the refresh all
+// requests would fail until the service is restarted.
+func watchSession(session *mgo.Session, done chan struct{}) {
+	ticker := time.NewTicker(MongoPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := session.Ping(); err != nil {
+				log.Println("WARN: MongoDB server is not reachable, refreshing the session: ", err)
+				session.Refresh()
+			}
+		}
+	}
+}
+
+// PrepareDB ensure presence of persistent and immutable data in the DB. It creates indexes, with the sort directions
+// of the fields of the SortedIndexes
 func PrepareDB(session *mgo.Session, db string, dbCollection string, indexes []Index, enableTTL bool, TTL int, TTLField string) (*mgo.Collection, error) {
+	return prepareCollection(session, db, dbCollection, indexes, enableTTL, TTL, TTLField, &mongoCollectionOptions{})
+}
+
+// mongoCollectionOptions are the options of a collection beyond its indexes and its TTL, see prepareCollection.
+type mongoCollectionOptions struct {
+	// collation is the default collation of the collection
+	collation *mgo.Collation
+	// capped makes the collection capped
+	capped *mgo.CollectionInfo
+	// validator is the $jsonSchema validator of the data schema
+	validator bson.M
+	// textIndex is the text index of the collection
+	textIndex *mgo.Index
+	// documentDB downgrades the index options that DocumentDB does not support
+	documentDB bool
+}
+
+// repositoryMongoOptions returns the options of the collection of the repository definition. Returns ErrNotSupported
+// for the collations and the capped collections on DocumentDB.
+func repositoryMongoOptions(repoDef RepositoryDefinition, documentDB bool) (*mongoCollectionOptions, error) {
+	collation, err := repositoryCollation(repoDef)
+	if err != nil {
+		return nil, err
+	}
+	if collation != nil && documentDB {
+		return nil, ErrNotSupported("DocumentDB does not support collations")
+	}
+	capped, err := repositoryCapped(repoDef)
+	if err != nil {
+		return nil, err
+	}
+	if capped != nil && documentDB {
+		return nil, ErrNotSupported("DocumentDB does not support capped collections")
+	}
+	textIndex, err := repositoryTextIndex(repoDef)
+	if err != nil {
+		return nil, err
+	}
+	dataSchema, err := repositoryDataSchema(repoDef)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mongoCollectionOptions{
+		collation:  mongoCollation(collation),
+		capped:     mongoCapped(capped),
+		validator:  mongoValidator(dataSchema, repoDef.IsCustomID()),
+		textIndex:  mongoTextIndex(textIndex),
+		documentDB: documentDB,
+	}, nil
+}
+
+// prepareCollection creates the collection with the collation, as a capped collection and with the validator of the
+// options, if set, and the indexes of the collection, with the text index, if any. On DocumentDB, the index options
+// that DocumentDB does not support are downgraded.
+func prepareCollection(session *mgo.Session, db string, dbCollection string, indexes []Index, enableTTL bool, TTL int, TTLField string, options *mongoCollectionOptions) (*mgo.Collection, error) {
 
 	collection := session.DB(db).C(dbCollection)
+	if options.collation != nil || options.capped != nil || options.validator != nil {
+		// the indexes are created with the default collation of the collection
+		if err := ensureMongoCollection(collection, options.collation, options.capped, options.validator); err != nil {
+			return nil, err
+		}
+	}
+	ensureIndex := ensureMongoIndex
+	if options.documentDB {
+		ensureIndex = ensureDocumentDBIndex
+	}
 
 	// Define indexes
 	for _, elem := range indexes {
-		i := elem.GetFields()
 		index := mgo.Index{
-			Key:        i,
+			Key:        mongoIndexKey(elem),
 			Unique:     elem.Unique(),
 			DropDups:   true,
 			Background: true,
@@ -120,17 +595,14 @@ func PrepareDB(session *mgo.Session, db string, dbCollection string, indexes []I
 		}
 
 		// Create indexes
-		if err := collection.EnsureIndex(index); err != nil {
-			if qe, ok := err.(*mgo.QueryError); ok {
-				if qe.Code == 85 {
-					// IndexOptionsConflict - see here https://github.com/mongodb/mongo/blob/master/src/mongo/base/error_codes.err
-					// It means that there is already defined index and we try to redefine it, which is (mostly) fine.
-					log.Println("WARN: The index already exists and will not be updated. MongoDB error: ", err.Error())
-				}
-			} else {
-				log.Println("ERROR: while creating index. of type: ", reflect.TypeOf(err), " and values: ", fmt.Sprintf("%v", err))
-				return nil, err
-			}
+		if err := ensureIndex(collection, index); err != nil {
+			return nil, err
+		}
+	}
+
+	if options.textIndex != nil {
+		if err := ensureIndex(collection, *options.textIndex); err != nil {
+			return nil, err
 		}
 	}
 
@@ -151,7 +623,11 @@ func PrepareDB(session *mgo.Session, db string, dbCollection string, indexes []I
 			Sparse:      true,
 			ExpireAfter: time.Duration(TTL) * time.Second,
 		}
-		if err := collection.EnsureIndex(index); err != nil {
+		if options.documentDB {
+			if err := ensureDocumentDBIndex(collection, index); err != nil {
+				return nil, err
+			}
+		} else if err := collection.EnsureIndex(index); err != nil {
 			return nil, err
 		}
 
@@ -160,6 +636,53 @@ func PrepareDB(session *mgo.Session, db string, dbCollection string, indexes []I
 	return collection, nil
 }
 
+// mongoTextIndex returns the text index for mgo. Returns nil for nil.
+func mongoTextIndex(textIndex *TextIndex) *mgo.Index {
+	if textIndex == nil {
+		return nil
+	}
+	key := []string{}
+	for _, field := range textIndex.Fields {
+		key = append(key, "$text:"+field)
+	}
+	return &mgo.Index{
+		Key:             key,
+		Weights:         textIndex.Weights,
+		DefaultLanguage: textIndex.Language,
+		Background:      true,
+	}
+}
+
+// mongoIndexKey returns the key of the index for mgo, with the descending fields prefixed with "-".
+func mongoIndexKey(index Index) []string {
+	key := []string{}
+	for _, indexKey := range indexKeys(index) {
+		if indexKey.Descending {
+			key = append(key, "-"+indexKey.Field)
+		} else {
+			key = append(key, indexKey.Field)
+		}
+	}
+	return key
+}
+
+// ensureMongoIndex creates the index, unless it already exists.
+func ensureMongoIndex(collection *mgo.Collection, index mgo.Index) error {
+	if err := collection.EnsureIndex(index); err != nil {
+		if qe, ok := err.(*mgo.QueryError); ok {
+			if qe.Code == 85 {
+				// IndexOptionsConflict - see here https://github.com/mongodb/mongo/blob/master/src/mongo/base/error_codes.err
+				// It means that there is already defined index and we try to redefine it, which is (mostly) fine.
+				log.Println("WARN: The index already exists and will not be updated. MongoDB error: ", err.Error())
+			}
+		} else {
+			log.Println("ERROR: while creating index. of type: ", reflect.TypeOf(err), " and values: ", fmt.Sprintf("%v", err))
+			return err
+		}
+	}
+	return nil
+}
+
 // GetOne fetches only one record for given filter
 func (c *MongoCollection) GetOne(filter Filter, result interface{}) (interface{}, error) {
 
@@ -171,17 +694,25 @@ func (c *MongoCollection) GetOne(filter Filter, result interface{}) (interface{}
 		}
 	}
 
-	err := c.Find(filter).One(&record)
+	mongoFilter, err := c.mongoFilter(filter)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+
+	err = c.Find(mongoFilter).One(&record)
 	if err != nil {
 		if err == mgo.ErrNotFound {
 			return nil, err
 		}
 		return nil, err
 	}
-	if c.repoDef.IsCustomID() {
-		record["_id"] = record["_id"].(bson.ObjectId).Hex()
-	} else {
-		record["id"] = record["_id"].(bson.ObjectId).Hex()
+	// the documents of the views may have another _id, or none
+	if id, ok := record["_id"].(bson.ObjectId); ok {
+		if c.repoDef.IsCustomID() {
+			record["_id"] = id.Hex()
+		} else {
+			record["id"] = id.Hex()
+		}
 	}
 
 	err = MapToInterface(&record, &result)
@@ -192,8 +723,15 @@ func (c *MongoCollection) GetOne(filter Filter, result interface{}) (interface{}
 	return result, nil
 }
 
-// GetAll fetches all matched records for given filter
+// GetAll fetches all matched records for given filter.
+// The order may be a path to a field of an embedded document (for example "profile.lastName").
 func (c *MongoCollection) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	return c.GetAllFields(filter, resultsTypeHint, nil, order, sorting, limit, offset)
+}
+
+// GetAllFields fetches all matched records for given filter, with only the selected fields. The fields are
+// selected with a projection, so the other fields are not transferred. The id is always returned.
+func (c *MongoCollection) GetAllFields(filter Filter, resultsTypeHint interface{}, fields []string, order string, sorting string, limit int, offset int) (interface{}, error) {
 	resultsTypeHint = AsPtr(resultsTypeHint)
 	results := NewSliceOfType(resultsTypeHint)
 
@@ -207,12 +745,22 @@ func (c *MongoCollection) GetAll(filter Filter, resultsTypeHint interface{}, ord
 		}
 	}
 
-	mongoFilter, err := toMongoFilter(filter)
+	mongoFilter, err := c.mongoFilter(filter)
 	if err != nil {
 		return nil, ErrInvalidInput(err)
 	}
 
 	query := c.Find(mongoFilter)
+	if len(fields) > 0 {
+		projection := bson.M{}
+		for _, field := range fields {
+			if field == "id" && !c.repoDef.IsCustomID() {
+				field = "_id"
+			}
+			projection[field] = 1
+		}
+		query = query.Select(projection)
+	}
 	if order != "" {
 		if sorting == "desc" {
 			order = "-" + order
@@ -274,6 +822,46 @@ func (c *MongoCollection) GetAll(filter Filter, resultsTypeHint interface{}, ord
 	return slicePointer.Interface(), nil
 }
 
+// Count returns the number of records that match the filter.
+func (c *MongoCollection) Count(filter Filter) (int64, error) {
+	if !c.repoDef.IsCustomID() {
+		if err := stringToObjectID(filter); err != nil {
+			return 0, ErrInvalidInput(err)
+		}
+	}
+
+	mongoFilter, err := c.mongoFilter(filter)
+	if err != nil {
+		return 0, ErrInvalidInput(err)
+	}
+
+	count, err := c.Find(mongoFilter).Count()
+	if err != nil {
+		return 0, err
+	}
+	return int64(count), nil
+}
+
+// Exists reports whether a document matches the filter. The query is limited to a single document.
+func (c *MongoCollection) Exists(filter Filter) (bool, error) {
+	if !c.repoDef.IsCustomID() {
+		if err := stringToObjectID(filter); err != nil {
+			return false, ErrInvalidInput(err)
+		}
+	}
+
+	mongoFilter, err := c.mongoFilter(filter)
+	if err != nil {
+		return false, ErrInvalidInput(err)
+	}
+
+	count, err := c.Find(mongoFilter).Limit(1).Count()
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
 // Save creates new record unless it does not exist, otherwise it updates the record
 func (c *MongoCollection) Save(object interface{}, filter Filter) (interface{}, error) {
 
@@ -297,6 +885,9 @@ func (c *MongoCollection) Save(object interface{}, filter Filter) (interface{},
 			if mgo.IsDup(err) {
 				return nil, ErrAlreadyExists("record already exists!")
 			}
+			if isMongoValidationError(err) {
+				return nil, ErrInvalidInput(err)
+			}
 			return nil, err
 		}
 
@@ -330,6 +921,9 @@ func (c *MongoCollection) Save(object interface{}, filter Filter) (interface{},
 		if mgo.IsDup(err) {
 			return nil, ErrAlreadyExists("record already exists!")
 		}
+		if isMongoValidationError(err) {
+			return nil, ErrInvalidInput(err)
+		}
 
 		return nil, err
 	}
@@ -342,28 +936,288 @@ func (c *MongoCollection) Save(object interface{}, filter Filter) (interface{},
 	return result, nil
 }
 
-// DeleteOne deletes only one record for given filter
-func (c *MongoCollection) DeleteOne(filter Filter) error {
-
-	if !c.repoDef.IsCustomID() {
-		if err := stringToObjectID(filter); err != nil {
-			return ErrInvalidInput(err)
-		}
+// SaveAll inserts the objects (a slice) as new documents, with a single ordered bulk write. Returns the created
+// records, with the generated IDs. The insert stops at the first failure - the documents inserted before it are kept.
+// See WriteRecords for the unordered inserts and the error of each document.
+func (c *MongoCollection) SaveAll(objects interface{}) (interface{}, error) {
+	records, err := objectsToRecords(objects)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return []interface{}{}, nil
 	}
 
-	err := c.Remove(filter)
+	writes := make([]BulkWrite, len(records))
+	for i, record := range records {
+		writes[i] = BulkWrite{Insert: record}
+	}
+	result, err := c.WriteAll(writes, true)
 	if err != nil {
-		if err == mgo.ErrNotFound {
-			return ErrNotFound(err)
-		}
-		return err
+		return nil, firstBulkError(err)
 	}
+	return result.Records, nil
+}
 
-	return nil
+// UpdateAll sets the properties of the update on all matched documents for given filter, with a single
+// bulk write. Returns the number of the updated documents.
+func (c *MongoCollection) UpdateAll(filter Filter, update interface{}) (int64, error) {
+	result, err := c.WriteAll([]BulkWrite{{Filter: filter, Update: update}}, true)
+	if err != nil {
+		return 0, firstBulkError(err)
+	}
+	return result.Updated, nil
 }
 
-// DeleteAll deletes all matched records for given filter
-func (c *MongoCollection) DeleteAll(filter Filter) error {
+// WriteAll runs the inserts, the updates and the deletes with a single bulk write. In the unordered mode MongoDB
+// groups the writes by kind, so they may run in any order. See WriteRecords.
+func (c *MongoCollection) WriteAll(writes []BulkWrite, ordered bool) (*BulkResult, error) {
+	if err := validateBulkWrites(writes); err != nil {
+		return nil, err
+	}
+
+	bulk := c.Bulk()
+	if !ordered {
+		bulk.Unordered()
+	}
+	records := make([]map[string]interface{}, len(writes))
+	ids := make([]bson.ObjectId, len(writes))
+	for i, write := range writes {
+		switch {
+		case write.Insert != nil:
+			record, err := objectToRecord(i, write.Insert)
+			if err != nil {
+				return nil, err
+			}
+			ids[i] = bson.NewObjectId()
+			record["_id"] = ids[i]
+			if !c.repoDef.IsCustomID() {
+				delete(record, "id")
+			}
+			records[i] = record
+			bulk.Insert(record)
+		case write.Delete:
+			if !c.repoDef.IsCustomID() {
+				if err := stringToObjectID(write.Filter); err != nil {
+					return nil, ErrInvalidInput(err)
+				}
+			}
+			bulk.RemoveAll(write.Filter)
+		default:
+			selector, update, err := c.updateAllOperation(write.Filter, write.Update)
+			if err != nil {
+				return nil, err
+			}
+			bulk.UpdateAll(selector, update)
+		}
+	}
+
+	info, err := bulk.Run()
+	var errs []error
+	if err != nil {
+		err = mongoBulkError(err, len(writes), ordered)
+		bulkErr, ok := err.(*BulkWriteError)
+		if !ok {
+			return nil, err
+		}
+		errs = bulkErr.Errors
+	}
+
+	result := &BulkResult{Records: make([]interface{}, len(writes))}
+	for i, record := range records {
+		if record == nil || (errs != nil && errs[i] != nil) {
+			continue
+		}
+		if !c.repoDef.IsCustomID() {
+			record["id"] = ids[i].Hex()
+		}
+		result.Records[i] = record
+	}
+	if err != nil {
+		return result, err
+	}
+	result.Updated = int64(info.Modified)
+	return result, nil
+}
+
+// updateAllOperation returns the selector and the $set of an update of all documents matched by the filter.
+func (c *MongoCollection) updateAllOperation(filter Filter, update interface{}) (bson.M, bson.M, error) {
+	payload, err := InterfaceToMap(update)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the ids are immutable
+	delete(*payload, "_id")
+	if !c.repoDef.IsCustomID() {
+		delete(*payload, "id")
+	}
+
+	if !c.repoDef.IsCustomID() {
+		if err := stringToObjectID(filter); err != nil {
+			return nil, nil, ErrInvalidInput(err)
+		}
+	}
+
+	mongoFilter, err := c.mongoFilter(filter)
+	if err != nil {
+		return nil, nil, ErrInvalidInput(err)
+	}
+	return mongoFilter, bson.M{"$set": payload}, nil
+}
+
+// Patch sets the properties of set ($set) and removes the unset fields ($unset) of the first matched record, with a
+// single findAndModify. See Patch.
+func (c *MongoCollection) Patch(filter Filter, set interface{}, unset []string) (interface{}, error) {
+	var result interface{}
+
+	payload, err := InterfaceToMap(set)
+	if err != nil {
+		return nil, err
+	}
+	// the ids are immutable
+	delete(*payload, "_id")
+	if !c.repoDef.IsCustomID() {
+		delete(*payload, "id")
+	}
+
+	if !c.repoDef.IsCustomID() {
+		if err := stringToObjectID(filter); err != nil {
+			return nil, ErrInvalidInput(err)
+		}
+	}
+	mongoFilter, err := c.mongoFilter(filter)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+
+	update := bson.M{}
+	if len(*payload) > 0 {
+		update["$set"] = *payload
+	}
+	removed := bson.M{}
+	for _, field := range unset {
+		if field != "_id" {
+			removed[field] = ""
+		}
+	}
+	if len(removed) > 0 {
+		update["$unset"] = removed
+	}
+
+	var record map[string]interface{}
+	if len(update) == 0 {
+		// an empty update would replace the document
+		err = c.Find(mongoFilter).One(&record)
+	} else {
+		_, err = c.Find(mongoFilter).Apply(mgo.Change{Update: update, ReturnNew: true}, &record)
+	}
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, ErrNotFound("record not found")
+		}
+		if mgo.IsDup(err) {
+			return nil, ErrAlreadyExists("record already exists!")
+		}
+		if isMongoValidationError(err) {
+			return nil, ErrInvalidInput(err)
+		}
+		return nil, err
+	}
+	if c.repoDef.IsCustomID() {
+		record["_id"] = record["_id"].(bson.ObjectId).Hex()
+	} else {
+		record["id"] = record["_id"].(bson.ObjectId).Hex()
+	}
+
+	err = MapToInterface(&record, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// UpsertOne updates the first record matched by the filter with the properties of the object ($set), or creates it
+// with the properties and the insertOnly properties ($setOnInsert), with a single findAndModify. See SaveRecord.
+// Two concurrent upserts may both try to create the record, and one then fails on a unique index, so it is run once
+// more to update the record created by the other.
+func (c *MongoCollection) UpsertOne(object interface{}, filter Filter, insertOnly []string) (interface{}, error) {
+	payload, err := InterfaceToMap(object)
+	if err != nil {
+		return nil, err
+	}
+	// the ids are immutable
+	delete(*payload, "_id")
+	if !c.repoDef.IsCustomID() {
+		delete(*payload, "id")
+	}
+
+	if !c.repoDef.IsCustomID() {
+		if err := stringToObjectID(filter); err != nil {
+			return nil, ErrInvalidInput(err)
+		}
+	}
+	mongoFilter, err := c.mongoFilter(filter)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+
+	onInsert := bson.M{}
+	for _, field := range insertOnly {
+		if value, ok := (*payload)[field]; ok {
+			onInsert[field] = value
+			delete(*payload, field)
+		}
+	}
+	if id, ok := (*payload)["id"]; ok {
+		onInsert["id"] = id
+		delete(*payload, "id")
+	}
+	if len(*payload) == 0 && len(onInsert) == 0 {
+		// an empty update would replace the document, so the created record gets the id of the filter or a new one
+		id, ok := filter["_id"].(bson.ObjectId)
+		if !ok {
+			id = bson.NewObjectId()
+		}
+		onInsert["_id"] = id
+	}
+	update := bson.M{}
+	if len(*payload) > 0 {
+		update["$set"] = *payload
+	}
+	if len(onInsert) > 0 {
+		update["$setOnInsert"] = onInsert
+	}
+
+	var record map[string]interface{}
+	change := mgo.Change{Update: update, Upsert: true, ReturnNew: true}
+	_, err = c.Find(mongoFilter).Apply(change, &record)
+	if mgo.IsDup(err) {
+		_, err = c.Find(mongoFilter).Apply(change, &record)
+	}
+	if err != nil {
+		if mgo.IsDup(err) {
+			return nil, ErrAlreadyExists("record already exists!")
+		}
+		if isMongoValidationError(err) {
+			return nil, ErrInvalidInput(err)
+		}
+		return nil, err
+	}
+	if c.repoDef.IsCustomID() {
+		record["_id"] = record["_id"].(bson.ObjectId).Hex()
+	} else {
+		record["id"] = record["_id"].(bson.ObjectId).Hex()
+	}
+
+	err = MapToInterface(&record, &object)
+	if err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
+// DeleteOne deletes only one record for given filter
+func (c *MongoCollection) DeleteOne(filter Filter) error {
 
 	if !c.repoDef.IsCustomID() {
 		if err := stringToObjectID(filter); err != nil {
@@ -371,7 +1225,7 @@ func (c *MongoCollection) DeleteAll(filter Filter) error {
 		}
 	}
 
-	_, err := c.RemoveAll(filter)
+	err := c.Remove(filter)
 	if err != nil {
 		if err == mgo.ErrNotFound {
 			return ErrNotFound(err)
@@ -382,57 +1236,837 @@ func (c *MongoCollection) DeleteAll(filter Filter) error {
 	return nil
 }
 
-func toMongoFilter(filter Filter) (map[string]interface{}, error) {
-	mgf := map[string]interface{}{}
-	for key, value := range filter {
-		if specs, ok := value.(map[string]string); ok {
-			if pattern, ok := specs["$pattern"]; ok {
-				mongoPattern := toMongoPattern(pattern)
-				mgf[key] = bson.M{
-					"$regex": mongoPattern,
+// DeleteAll deletes all matched records for given filter, with a single bulk write.
+func (c *MongoCollection) DeleteAll(filter Filter) error {
+	if _, err := c.WriteAll([]BulkWrite{{Filter: filter, Delete: true}}, true); err != nil {
+		return firstBulkError(err)
+	}
+	return nil
+}
+
+// RawQuery runs a find filter (bson.M) or an aggregation pipeline ([]bson.M, see Pipe) on the collection. See
+// RawQuerier.
+func (c *MongoCollection) RawQuery(query interface{}, resultsTypeHint interface{}) (interface{}, error) {
+	switch q := query.(type) {
+	case bson.M:
+		records := []map[string]interface{}{}
+		if err := c.Find(q).All(&records); err != nil {
+			return nil, err
+		}
+		return c.rawResults(records, resultsTypeHint)
+	case []bson.M:
+		return c.Pipe(q, resultsTypeHint)
+	default:
+		return nil, ErrInvalidInput(fmt.Sprintf("MongoDB raw query must be bson.M or []bson.M, got %T", query))
+	}
+}
+
+// Pipe runs the aggregation pipeline on the collection, with the session of the backend, and returns the results as
+// RawQuery does. The results are returned as maps if the type hint is nil. It hides the Pipe of mgo.Collection, which
+// is still available as c.Collection.Pipe.
+func (c *MongoCollection) Pipe(pipeline []bson.M, resultsTypeHint interface{}) (interface{}, error) {
+	records := []map[string]interface{}{}
+	if err := c.Collection.Pipe(pipeline).All(&records); err != nil {
+		return nil, err
+	}
+	return c.rawResults(records, resultsTypeHint)
+}
+
+// rawResults converts the ObjectIds of the records of a raw query to their hex form, and the records to the results.
+func (c *MongoCollection) rawResults(records []map[string]interface{}, resultsTypeHint interface{}) (interface{}, error) {
+	for _, record := range records {
+		c.hexID(record)
+	}
+	if resultsTypeHint == nil {
+		resultsTypeHint = &map[string]interface{}{}
+	}
+	return recordsToResults(records, resultsTypeHint)
+}
+
+// hexID converts the ObjectId of the record to its hex form, in "id" (or in "_id" for the custom ids). The
+// aggregation results and the changes may have other ids than the ObjectIds, which are left as they are.
+func (c *MongoCollection) hexID(record map[string]interface{}) {
+	if id, ok := record["_id"].(bson.ObjectId); ok {
+		if c.repoDef.IsCustomID() {
+			record["_id"] = id.Hex()
+		} else {
+			record["id"] = id.Hex()
+			delete(record, "_id")
+		}
+	}
+}
+
+// mongoTextScore is the field of the relevance of the results of Search, removed from the records.
+const mongoTextScore = "_textScore"
+
+// Search searches the documents with the text index of the collection ($text), ordered by relevance. Returns
+// ErrNotSupported if the repository has no text index. See Searcher.
+func (c *MongoCollection) Search(text string, filter Filter, resultsTypeHint interface{}, limit int, offset int) (interface{}, error) {
+	query, err := c.textQuery(text, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	find := c.Find(query).Select(bson.M{mongoTextScore: bson.M{"$meta": "textScore"}}).Sort("$textScore:" + mongoTextScore)
+	if offset != 0 {
+		find = find.Skip(offset)
+	}
+	if limit != 0 {
+		find = find.Limit(limit)
+	}
+	records := []map[string]interface{}{}
+	if err := find.All(&records); err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		delete(record, mongoTextScore)
+		c.hexID(record)
+	}
+	return recordsToResults(records, resultsTypeHint)
+}
+
+// textQuery returns the query of the documents that match the filter and contain the text.
+func (c *MongoCollection) textQuery(text string, filter Filter) (bson.M, error) {
+	textIndex, err := repositoryTextIndex(c.repoDef)
+	if err != nil {
+		return nil, err
+	}
+	if textIndex == nil {
+		return nil, ErrNotSupported(fmt.Sprintf("repository %s has no text index", c.repoDef.GetName()))
+	}
+	if strings.TrimSpace(text) == "" {
+		return nil, ErrInvalidInput("search text must not be empty")
+	}
+
+	if !c.repoDef.IsCustomID() {
+		if err := stringToObjectID(filter); err != nil {
+			return nil, ErrInvalidInput(err)
+		}
+	}
+	query, err := c.mongoFilter(filter)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+	query["$text"] = bson.M{"$search": text}
+	return query, nil
+}
+
+// mongoRecordCursor is the result of the find, the aggregate and the getMore commands.
+type mongoRecordCursor struct {
+	Cursor struct {
+		ID         int64                    `bson:"id"`
+		FirstBatch []map[string]interface{} `bson:"firstBatch"`
+		NextBatch  []map[string]interface{} `bson:"nextBatch"`
+	} `bson:"cursor"`
+}
+
+// mongoFind runs the find command of the query with run, and reads all batches of its cursor. mgo has no API for the
+// options of the find command that it predates, like the collation.
+func mongoFind(run func(cmd bson.D, result interface{}) error, collection string, query bson.M, collation *mgo.Collation, order string, sorting string, limit int, offset int) ([]map[string]interface{}, error) {
+	cmd := bson.D{
+		{Name: "find", Value: collection},
+		{Name: "filter", Value: query},
+	}
+	if order != "" {
+		direction := 1
+		if sorting == "desc" {
+			direction = -1
+		}
+		cmd = append(cmd, bson.DocElem{Name: "sort", Value: bson.D{{Name: order, Value: direction}}})
+	}
+	if offset != 0 {
+		cmd = append(cmd, bson.DocElem{Name: "skip", Value: offset})
+	}
+	if limit != 0 {
+		cmd = append(cmd, bson.DocElem{Name: "limit", Value: limit})
+	}
+	if collation != nil {
+		cmd = append(cmd, bson.DocElem{Name: "collation", Value: collation})
+	}
+
+	result := mongoRecordCursor{}
+	if err := run(cmd, &result); err != nil {
+		return nil, err
+	}
+	records := result.Cursor.FirstBatch
+	for result.Cursor.ID != 0 {
+		cursorID := result.Cursor.ID
+		result = mongoRecordCursor{}
+		err := run(bson.D{
+			{Name: "getMore", Value: cursorID},
+			{Name: "collection", Value: collection},
+		}, &result)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, result.Cursor.NextBatch...)
+	}
+	return records, nil
+}
+
+// GetAllCollated fetches all matched records for given filter, comparing the strings with the collation instead of
+// the collation of the collection, both in the filter and in the order. See CollatedQuerier.
+func (c *MongoCollection) GetAllCollated(collation *Collation, filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	if err := collation.validate(); err != nil {
+		return nil, err
+	}
+	if !c.repoDef.IsCustomID() {
+		if err := stringToObjectID(filter); err != nil {
+			return nil, ErrInvalidInput(err)
+		}
+	}
+	query, err := c.mongoFilter(filter)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+
+	run := func(cmd bson.D, result interface{}) error {
+		return c.Database.Run(cmd, result)
+	}
+	records, err := mongoFind(run, c.Name, query, mongoCollation(collation), order, sorting, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		c.hexID(record)
+	}
+	return recordsToResults(records, resultsTypeHint)
+}
+
+// mongoCollation converts the collation to the collation of mgo. Returns nil for nil.
+func mongoCollation(collation *Collation) *mgo.Collation {
+	if collation == nil {
+		return nil
+	}
+	return &mgo.Collation{
+		Locale:          collation.Locale,
+		Strength:        collation.Strength,
+		CaseLevel:       collation.CaseLevel,
+		NumericOrdering: collation.NumericOrdering,
+	}
+}
+
+// ensureMongoCollection creates the collection with the collation as its default collation, so all queries, sorts
+// and indexes of the collection use it, as a capped collection if capped is set, and with the validator, if set. The
+// collation and the limits can't be changed later, so an existing collection must already have the same collation,
+// and be capped with the same limits if capped is set. The validator of an existing collection is replaced.
+func ensureMongoCollection(collection *mgo.Collection, collation *mgo.Collation, capped *mgo.CollectionInfo, validator bson.M) error {
+	result := struct {
+		Cursor struct {
+			FirstBatch []struct {
+				Options struct {
+					Collation *mgo.Collation `bson:"collation"`
+					Capped    bool           `bson:"capped"`
+					Size      int            `bson:"size"`
+					Max       int            `bson:"max"`
+				} `bson:"options"`
+			} `bson:"firstBatch"`
+		} `bson:"cursor"`
+	}{}
+	err := collection.Database.Run(bson.D{
+		{Name: "listCollections", Value: 1},
+		{Name: "filter", Value: bson.M{"name": collection.Name}},
+	}, &result)
+	if err != nil {
+		return ErrBackendError(err)
+	}
+	// "simple" is the binary comparison, which the collections without a collation use
+	want := collation
+	if collation != nil && collation.Locale == "simple" {
+		want = nil
+	}
+
+	if len(result.Cursor.FirstBatch) == 0 {
+		if want == nil && capped == nil && validator == nil {
+			return nil
+		}
+		cmd := bson.D{{Name: "create", Value: collection.Name}}
+		if validator != nil {
+			cmd = append(cmd, mongoValidationOptions(validator)...)
+		}
+		if want != nil {
+			cmd = append(cmd, bson.DocElem{Name: "collation", Value: want})
+		}
+		if capped != nil {
+			cmd = append(cmd, bson.DocElem{Name: "capped", Value: true}, bson.DocElem{Name: "size", Value: capped.MaxBytes})
+			if capped.MaxDocs > 0 {
+				cmd = append(cmd, bson.DocElem{Name: "max", Value: capped.MaxDocs})
+			}
+		}
+		err := collection.Database.Run(cmd, nil)
+		// 48: NamespaceExists, the collection was created concurrently
+		if queryErr, ok := err.(*mgo.QueryError); err != nil && !(ok && queryErr.Code == 48) {
+			return ErrBackendError(err)
+		}
+		return nil
+	}
+
+	options := result.Cursor.FirstBatch[0].Options
+	if !sameMongoCollation(options.Collation, want) {
+		return ErrBackendError(fmt.Sprintf("collection %s already exists with collation %s, can't use collation %s", collection.Name, describeMongoCollation(options.Collation), describeMongoCollation(want)))
+	}
+	if validator != nil {
+		cmd := append(bson.D{{Name: "collMod", Value: collection.Name}}, mongoValidationOptions(validator)...)
+		if err := collection.Database.Run(cmd, nil); err != nil {
+			return ErrBackendError(err)
+		}
+	}
+	if capped == nil {
+		return nil
+	}
+	if !options.Capped {
+		return ErrBackendError(fmt.Sprintf("collection %s already exists and is not capped", collection.Name))
+	}
+	// MongoDB rounds the size up to a multiple of 256 bytes
+	if (options.Size+255)/256 != (capped.MaxBytes+255)/256 || options.Max != capped.MaxDocs {
+		return ErrBackendError(fmt.Sprintf("collection %s already exists capped at %d bytes and %d documents, can't cap it at %d bytes and %d documents", collection.Name, options.Size, options.Max, capped.MaxBytes, capped.MaxDocs))
+	}
+	return nil
+}
+
+// mongoCapped returns the options of the capped collection for mgo. Returns nil for nil.
+func mongoCapped(capped *Capped) *mgo.CollectionInfo {
+	if capped == nil {
+		return nil
+	}
+	return &mgo.CollectionInfo{
+		Capped:   true,
+		MaxBytes: capped.MaxBytes,
+		MaxDocs:  capped.MaxDocuments,
+	}
+}
+
+// mongoValidator returns the $jsonSchema validator of the collection from the schema of the records. Returns nil for
+// nil. Unless the repository has custom ids, the id is the _id of the documents, so it is left out.
+func mongoValidator(schema *DataSchema, customID bool) bson.M {
+	if schema == nil {
+		return nil
+	}
+	jsonSchema := mongoJSONSchema(schema)
+	if !customID {
+		if properties, ok := jsonSchema["properties"].(bson.M); ok {
+			delete(properties, "id")
+			if len(properties) == 0 {
+				delete(jsonSchema, "properties")
+			}
+		}
+		if required, ok := jsonSchema["required"].([]string); ok {
+			kept := []string{}
+			for _, property := range required {
+				if property != "id" {
+					kept = append(kept, property)
 				}
-				continue
 			}
-			return nil, fmt.Errorf("unknown filter specification - supported type is $pattern")
+			if len(kept) > 0 {
+				jsonSchema["required"] = kept
+			} else {
+				delete(jsonSchema, "required")
+			}
 		}
-		mgf[key] = value // copy over the key=>value pairs to do exact matching
 	}
-	return mgf, nil
+	return bson.M{"$jsonSchema": jsonSchema}
 }
 
-func toMongoPattern(pattern string) string {
-	mongoPattern := ""
+// mongoSchemaTypes are the BSON types of the types of the DataSchema.
+var mongoSchemaTypes = map[string][]string{
+	SchemaString:  {"string"},
+	SchemaNumber:  {"int", "long", "double", "decimal"},
+	SchemaInteger: {"int", "long"},
+	SchemaBoolean: {"bool"},
+	SchemaDate:    {"date"},
+	SchemaObject:  {"object"},
+	SchemaArray:   {"array"},
+}
+
+// mongoJSONSchema converts the schema to the $jsonSchema of MongoDB, with the BSON types of the values.
+func mongoJSONSchema(schema *DataSchema) bson.M {
+	jsonSchema := bson.M{}
+	if schema.Type != "" {
+		types := append([]string{}, mongoSchemaTypes[schema.Type]...)
+		if schema.Nullable {
+			types = append(types, "null")
+		}
+		if len(types) == 1 {
+			jsonSchema["bsonType"] = types[0]
+		} else {
+			jsonSchema["bsonType"] = types
+		}
+	}
+	if len(schema.Properties) > 0 {
+		properties := bson.M{}
+		for property, propertySchema := range schema.Properties {
+			properties[property] = mongoJSONSchema(propertySchema)
+		}
+		jsonSchema["properties"] = properties
+	}
+	if len(schema.Required) > 0 {
+		jsonSchema["required"] = schema.Required
+	}
+	if schema.Items != nil {
+		jsonSchema["items"] = mongoJSONSchema(schema.Items)
+	}
+	if len(schema.Enum) > 0 {
+		enum := schema.Enum
+		if schema.Nullable {
+			enum = append(append([]interface{}{}, enum...), nil)
+		}
+		jsonSchema["enum"] = enum
+	}
+	if schema.Minimum != nil {
+		jsonSchema["minimum"] = *schema.Minimum
+	}
+	if schema.Maximum != nil {
+		jsonSchema["maximum"] = *schema.Maximum
+	}
+	if schema.MinLength > 0 {
+		jsonSchema["minLength"] = schema.MinLength
+	}
+	if schema.MaxLength > 0 {
+		jsonSchema["maxLength"] = schema.MaxLength
+	}
+	if schema.Pattern != "" {
+		jsonSchema["pattern"] = schema.Pattern
+	}
+	return jsonSchema
+}
 
-	prev := '\000'
+// isMongoValidationError reports whether the write failed because a document does not match the validator of the
+// collection (DocumentValidationFailure).
+func isMongoValidationError(err error) bool {
+	switch e := err.(type) {
+	case *mgo.LastError:
+		return e.Code == 121
+	case *mgo.QueryError:
+		return e.Code == 121
+	case *mgo.BulkError:
+		for _, c := range e.Cases() {
+			if isMongoValidationError(c.Err) {
+				return true
+			}
+		}
+	}
+	return false
+}
 
-	for _, r := range pattern {
-		if r == '%' {
-			if prev == '%' {
-				mongoPattern += "%"
-				prev = '\000'
-				continue
+// mongoWriteError converts the duplicate key errors and the validation errors of a write to ErrAlreadyExists and
+// ErrInvalidInput.
+func mongoWriteError(err error) error {
+	if mgo.IsDup(err) {
+		return ErrAlreadyExists("record already exists!")
+	}
+	if isMongoValidationError(err) {
+		return ErrInvalidInput(err)
+	}
+	return err
+}
+
+// mongoBulkError converts the error of a bulk write of n writes to *BulkWriteError, with the error of each failed
+// write. MongoDB before 2.6 does not report which inserts failed, so then the error is returned as it is.
+func mongoBulkError(err error, n int, ordered bool) error {
+	bulkErr, ok := err.(*mgo.BulkError)
+	if !ok || len(bulkErr.Cases()) == 0 {
+		return mongoWriteError(err)
+	}
+
+	errs := make([]error, n)
+	first := n
+	for _, c := range bulkErr.Cases() {
+		if c.Index < 0 || c.Index >= n {
+			return mongoWriteError(c.Err)
+		}
+		errs[c.Index] = mongoWriteError(c.Err)
+		if c.Index < first {
+			first = c.Index
+		}
+	}
+	if ordered {
+		for i := first + 1; i < n; i++ {
+			if errs[i] == nil {
+				errs[i] = errBulkNotWritten
 			}
-			prev = r
-			continue
 		}
-		if prev == '%' {
-			mongoPattern += ".*"
+	}
+	return &BulkWriteError{Errors: errs}
+}
+
+// mongoValidationOptions returns the options of the create and the collMod commands that set the validator. The
+// validation is moderate: the documents that were stored before the validator, and are invalid, can still be updated.
+func mongoValidationOptions(validator bson.M) bson.D {
+	return bson.D{
+		{Name: "validator", Value: validator},
+		{Name: "validationLevel", Value: "moderate"},
+		{Name: "validationAction", Value: "error"},
+	}
+}
+
+// sameMongoCollation reports whether the collations compare the strings the same way. MongoDB fills the options
+// that are not set with the defaults of the locale, so only the options of Collation are compared.
+func sameMongoCollation(a *mgo.Collation, b *mgo.Collation) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	strength := func(c *mgo.Collation) int {
+		if c.Strength == 0 {
+			return 3
+		}
+		return c.Strength
+	}
+	return a.Locale == b.Locale && strength(a) == strength(b) && a.CaseLevel == b.CaseLevel && a.NumericOrdering == b.NumericOrdering
+}
+
+// describeMongoCollation returns the locale and the strength of the collation, for the errors.
+func describeMongoCollation(collation *mgo.Collation) string {
+	if collation == nil {
+		return "simple"
+	}
+	return fmt.Sprintf("%s (strength %d)", collation.Locale, collation.Strength)
+}
+
+// GetManyByIDs fetches the records with the given ids with a single find, with $in on the ids. See GetManyByIDs.
+func (c *MongoCollection) GetManyByIDs(ids []string, resultsTypeHint interface{}) (interface{}, error) {
+	ids = uniqueIDs(ids)
+
+	query := bson.M{}
+	if c.repoDef.IsCustomID() {
+		query["id"] = bson.M{"$in": ids}
+	} else {
+		objectIDs := make([]bson.ObjectId, 0, len(ids))
+		for _, id := range ids {
+			if !bson.IsObjectIdHex(id) {
+				return nil, ErrInvalidInput(fmt.Sprintf("id %s is a invalid hex representation of an ObjectId", id))
+			}
+			objectIDs = append(objectIDs, bson.ObjectIdHex(id))
+		}
+		query["_id"] = bson.M{"$in": objectIDs}
+	}
+
+	records := []map[string]interface{}{}
+	if len(ids) > 0 {
+		if err := c.Find(query).All(&records); err != nil {
+			return nil, err
 		}
-		if r != '\000' {
-			mongoPattern += string(r)
+	}
+	for _, record := range records {
+		if c.repoDef.IsCustomID() {
+			record["_id"] = record["_id"].(bson.ObjectId).Hex()
+		} else {
+			record["id"] = record["_id"].(bson.ObjectId).Hex()
 		}
+	}
 
-		prev = r
+	if resultsTypeHint == nil {
+		resultsTypeHint = &map[string]interface{}{}
+	}
+	return recordsToResults(orderedRecords(ids, records, "id"), resultsTypeHint)
+}
+
+// parentFilter converts the filter of a parent record, for the updates of its children.
+func (c *MongoCollection) parentFilter(parent Filter) (bson.M, error) {
+	if !c.repoDef.IsCustomID() {
+		if err := stringToObjectID(parent); err != nil {
+			return nil, ErrInvalidInput(err)
+		}
 	}
-	if prev == '%' {
-		// at the very end of the pattern
-		mongoPattern += ".*"
+	mongoFilter, err := c.mongoFilter(parent)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+	return mongoFilter, nil
+}
+
+// updateChildren runs the update on the first record matched by the filter. If no record matches, the parent is
+// checked: ErrNotFound is returned if the parent does not exist, otherwise the error returned by notMatched.
+func (c *MongoCollection) updateChildren(parent bson.M, filter bson.M, update bson.M, notMatched func() error) error {
+	err := c.Update(filter, update)
+	if err == nil {
+		return nil
+	}
+	if err != mgo.ErrNotFound {
+		return err
+	}
+	count, err := c.Find(parent).Count()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound("record not found")
+	}
+	return notMatched()
+}
+
+// AddChild appends the child to the array field of the parent record with $push. The child is not added if the
+// parent already has a child with the same id.
+func (c *MongoCollection) AddChild(parent Filter, field string, idProperty string, child map[string]interface{}) error {
+	mongoFilter, err := c.parentFilter(parent)
+	if err != nil {
+		return err
+	}
+	filter := bson.M{"$and": []bson.M{mongoFilter, {field + "." + idProperty: bson.M{"$ne": child[idProperty]}}}}
+	return c.updateChildren(mongoFilter, filter, bson.M{"$push": bson.M{field: child}}, func() error {
+		return ErrAlreadyExists(fmt.Sprintf("child %v already exists in %s", child[idProperty], field))
+	})
+}
+
+// UpdateChild sets the properties of the child with the positional operator ($).
+func (c *MongoCollection) UpdateChild(parent Filter, field string, idProperty string, childID interface{}, update map[string]interface{}) error {
+	mongoFilter, err := c.parentFilter(parent)
+	if err != nil {
+		return err
+	}
+	payload := bson.M{}
+	for k, v := range update {
+		payload[field+".$."+k] = v
+	}
+	filter := bson.M{"$and": []bson.M{mongoFilter, {field + "." + idProperty: childID}}}
+	return c.updateChildren(mongoFilter, filter, bson.M{"$set": payload}, func() error {
+		return ErrNotFound(fmt.Sprintf("child %v not found in %s", childID, field))
+	})
+}
+
+// RemoveChild removes the child from the array field of the parent record with $pull.
+func (c *MongoCollection) RemoveChild(parent Filter, field string, idProperty string, childID interface{}) error {
+	mongoFilter, err := c.parentFilter(parent)
+	if err != nil {
+		return err
+	}
+	filter := bson.M{"$and": []bson.M{mongoFilter, {field + "." + idProperty: childID}}}
+	return c.updateChildren(mongoFilter, filter, bson.M{"$pull": bson.M{field: bson.M{idProperty: childID}}}, func() error {
+		return ErrNotFound(fmt.Sprintf("child %v not found in %s", childID, field))
+	})
+}
+
+// Explain explains the query of the filter with the explain command, and counts the matched documents. The query is
+// a full scan if the winning plan reads the collection (COLLSCAN). See ExplainRepository.
+func (c *MongoCollection) Explain(filter Filter, order string, sorting string) (*QueryPlan, error) {
+	if !c.repoDef.IsCustomID() {
+		if err := stringToObjectID(filter); err != nil {
+			return nil, ErrInvalidInput(err)
+		}
+	}
+
+	mongoFilter, err := c.mongoFilter(filter)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+
+	query := c.Find(mongoFilter)
+	if order != "" {
+		if sorting == "desc" {
+			order = "-" + order
+		}
+		query = query.Sort(order)
+	}
+
+	details := bson.M{}
+	start := time.Now()
+	if err := query.Explain(&details); err != nil {
+		return nil, ErrBackendError(err)
+	}
+	matched, err := c.Find(mongoFilter).Count()
+	if err != nil {
+		return nil, ErrBackendError(err)
+	}
+
+	plan := &QueryPlan{
+		Backend:  "mongodb",
+		Query:    mongoFilter,
+		Scanned:  -1,
+		Matched:  int64(matched),
+		Duration: time.Since(start),
+		Details:  details,
+	}
+	explainMongoPlan(details, plan)
+	return plan, nil
+}
+
+// explainMongoPlan reads the stages, the index and the number of the examined documents from the explain document.
+// The layout of the document depends on the version of the server, so the whole document is searched.
+func explainMongoPlan(value interface{}, plan *QueryPlan) {
+	switch v := value.(type) {
+	case bson.M:
+		explainMongoPlan(map[string]interface{}(v), plan)
+	case map[string]interface{}:
+		for key, item := range v {
+			switch key {
+			case "stage":
+				if item == "COLLSCAN" {
+					plan.FullScan = true
+				}
+			case "indexName":
+				if name, ok := item.(string); ok && plan.Index == "" {
+					plan.Index = name
+				}
+			case "totalDocsExamined", "nscannedObjects":
+				if examined, ok := versionNumber(item); ok && examined > plan.Scanned {
+					plan.Scanned = examined
+				}
+			case "cursor":
+				// the explain output of the servers before 3.0
+				if cursor, ok := item.(string); ok && strings.HasPrefix(cursor, "BasicCursor") {
+					plan.FullScan = true
+				}
+			}
+			explainMongoPlan(item, plan)
+		}
+	case []interface{}:
+		for _, item := range v {
+			explainMongoPlan(item, plan)
+		}
+	}
+}
+
+// EstimatedCount returns the number of the documents from the metadata of the collection, with the count command
+// without a query. See EstimatedCounter.
+func (c *MongoCollection) EstimatedCount() (int64, error) {
+	count, err := c.Collection.Count()
+	if err != nil {
+		return 0, ErrBackendError(err)
+	}
+	return int64(count), nil
+}
+
+// Stats returns the number of the documents and their size, as reported by the collStats command.
+func (c *MongoCollection) Stats() (*RepositoryStats, error) {
+	result := struct {
+		Count int64 `bson:"count"`
+		Size  int64 `bson:"size"`
+	}{}
+	err := c.Collection.Database.Run(bson.D{{Name: "collStats", Value: c.Collection.Name}}, &result)
+	if err != nil {
+		return nil, ErrBackendError(err)
+	}
+	return &RepositoryStats{
+		Records:   result.Count,
+		SizeBytes: result.Size,
+	}, nil
+}
+
+// MongoQueryTranslator translates filters into MongoDB queries (bson.M).
+type MongoQueryTranslator struct{}
+
+// Translate translates the filter AST into a MongoDB query document.
+func (t *MongoQueryTranslator) Translate(ast *FilterAST) (interface{}, error) {
+	query := bson.M{}
+	specs := map[string]bson.M{}
+	properties := []string{}
+
+	for _, cond := range ast.Conditions {
+		if _, ok := specs[cond.Property]; !ok {
+			specs[cond.Property] = bson.M{}
+			properties = append(properties, cond.Property)
+		}
+		switch cond.Operator {
+		case OpEq:
+			specs[cond.Property]["$eq"] = cond.Value
+		case OpPattern, OpRegex:
+			if _, ok := specs[cond.Property]["$regex"]; ok {
+				return nil, ErrInvalidInput(fmt.Sprintf("%s and %s cannot be combined on property %s", OpPattern, OpRegex, cond.Property))
+			}
+			if cond.Operator == OpPattern {
+				specs[cond.Property]["$regex"] = toMongoPattern(cond.Value.(string))
+			} else {
+				specs[cond.Property]["$regex"] = cond.Value
+			}
+		case OpNe, OpGt, OpGte, OpLt, OpLte, OpIn, OpNin, OpExists:
+			// the operators have the same names in MongoDB
+			specs[cond.Property][cond.Operator] = cond.Value
+		case OpNull:
+			if cond.Value.(bool) {
+				// null matches the missing fields as well, so the null fields are matched by their type
+				specs[cond.Property]["$type"] = 10
+				continue
+			}
+			if _, ok := specs[cond.Property]["$ne"]; ok {
+				return nil, ErrInvalidInput(fmt.Sprintf("%s and %s cannot be combined on property %s", OpNull, OpNe, cond.Property))
+			}
+			// $ne null excludes the missing fields as well
+			specs[cond.Property]["$ne"] = nil
+		default:
+			return nil, ErrInvalidInput(fmt.Sprintf("operator %s is not supported by MongoDB backend", cond.Operator))
+		}
+	}
+
+	for _, property := range properties {
+		spec := specs[property]
+		if value, ok := spec["$eq"]; ok && len(spec) == 1 {
+			// plain exact match
+			query[property] = value
+			continue
+		}
+		query[property] = spec
+	}
+
+	return query, nil
+}
+
+var mongoQueryTranslator = &MongoQueryTranslator{}
+
+// mongoFilter converts the filter to a Mongo query that skips the expired documents (see TTLExpiredDefinition). The
+// TTL index deletes a document TTL seconds after the time in its TTL field, so the documents with an older time are
+// expired. The documents without a time in the TTL field never expire.
+func (c *MongoCollection) mongoFilter(filter Filter) (bson.M, error) {
+	query, err := toMongoFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	grace, ok := ttlGrace(c.repoDef)
+	if !ok {
+		return query, nil
+	}
+	expired := time.Now().Add(-time.Duration(c.repoDef.GetTTL())*time.Second - grace)
+	live := bson.M{c.repoDef.GetTTLAttribute(): bson.M{"$not": bson.M{"$lte": expired}}}
+	if len(query) == 0 {
+		return live, nil
+	}
+	return bson.M{"$and": []bson.M{query, live}}, nil
+}
+
+func toMongoFilter(filter Filter) (bson.M, error) {
+	query, err := TranslateFilter(filter, mongoQueryTranslator)
+	if err != nil {
+		return nil, err
+	}
+	return query.(bson.M), nil
+}
+
+// toMongoPattern converts a 'LIKE' pattern to a regular expression. The literal parts of the pattern
+// are escaped, so the regular expression metacharacters in the pattern (like "." or "(") are matched literally.
+// The expression is anchored at the start and at the end, unless the pattern starts or ends with a wildcard.
+func toMongoPattern(pattern string) string {
+	parts := []string{}
+	literal := ""
+	leadingWildcard := false
+	trailingWildcard := false
+
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r != '%' {
+			literal += string(r)
+			trailingWildcard = false
+			continue
+		}
+		if i+1 < len(runes) && runes[i+1] == '%' {
+			// "%%" is an escaped, literal "%"
+			literal += "%"
+			trailingWildcard = false
+			i++
+			continue
+		}
+		if i == 0 {
+			leadingWildcard = true
+		}
+		parts = append(parts, regexp.QuoteMeta(literal))
+		literal = ""
+		trailingWildcard = true
 	}
+	parts = append(parts, regexp.QuoteMeta(literal))
 
-	if !strings.HasPrefix(mongoPattern, ".*") {
+	mongoPattern := strings.Join(parts, ".*")
+	if !leadingWildcard {
 		mongoPattern = "^" + mongoPattern
 	}
-	if !strings.HasSuffix(mongoPattern, ".*") {
+	if !trailingWildcard {
 		mongoPattern = mongoPattern + "$"
 	}
 	return mongoPattern
@@ -3,8 +3,11 @@ package backends
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/Microkubes/microservice-tools/config"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 )
 
 func TestToMongoPattern(t *testing.T) {
@@ -43,6 +46,16 @@ func TestToMongoPattern(t *testing.T) {
 		t.Fatal("Expected the pattern to be at the end. Got: ", pattern)
 	}
 
+	pattern = toMongoPattern("a.b(c)%")
+	if pattern != `^a\.b\(c\).*` {
+		t.Fatal("Expected the metacharacters to be escaped. Got: ", pattern)
+	}
+
+	pattern = toMongoPattern("ends with.*")
+	if pattern != `^ends with\.\*$` {
+		t.Fatal("Expected the pattern to be anchored at the end. Got: ", pattern)
+	}
+
 }
 
 type TestEntry struct {
@@ -127,4 +140,649 @@ func TestMongoDBIntergration(t *testing.T) {
 	if len(*resArr) != 1 {
 		t.Fatal("Expected exactly 1 result, but got: ", len(*resArr))
 	}
+
+	updated, err := repo.UpdateAll(NewFilter().MatchPattern("value", "a%"), &map[string]interface{}{"checked": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated != 2 {
+		t.Fatal("Expected 2 updated entries, but got: ", updated)
+	}
+	if count, err := repo.Count(NewFilter().Match("checked", true)); err != nil || count != 2 {
+		t.Fatal("Expected 2 checked entries, but got: ", count, err)
+	}
+
+	addresses := Children(repo, "addresses")
+	parent := NewFilter().Match("value", "aa")
+	if _, err := addresses.Add(parent, map[string]interface{}{"id": "home", "city": "Skopje"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := addresses.Add(parent, map[string]interface{}{"id": "home"}); err == nil || !IsErrAlreadyExists(err) {
+		t.Fatal("Expected already exists error for the duplicate child id. Got: ", err)
+	}
+	address, err := addresses.Update(parent, "home", map[string]interface{}{"zip": "1000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if address["city"] != "Skopje" || address["zip"] != "1000" {
+		t.Fatal("Expected the address to be updated. Got: ", address)
+	}
+	if err := addresses.Remove(parent, "home"); err != nil {
+		t.Fatal(err)
+	}
+
+	patched, err := Patch(repo, NewFilter().Match("value", "aa"), &map[string]interface{}{"note": "patched"}, []string{"checked"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record := patched.(map[string]interface{}); record["note"] != "patched" || record["checked"] != nil {
+		t.Fatal("Expected the note to be set and checked removed. Got: ", record)
+	}
+
+	all, err := repo.GetAll(nil, &map[string]interface{}{}, "value", "asc", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, record := range *all.(*[]*map[string]interface{}) {
+		ids = append([]string{(*record)["id"].(string)}, ids...)
+	}
+	fetched, err := GetManyByIDs(repo, ids, &TestEntry{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := *fetched.(*[]*TestEntry); len(entries) != len(ids) {
+		t.Fatal("Expected all entries to be fetched by their ids. Got: ", len(entries))
+	}
+	if count, err := repo.Count(NewFilter().MatchIn("id", ids)); err != nil || count != int64(len(ids)) {
+		t.Fatal("Expected all entries to be matched by $in on their ids. Got: ", count, err)
+	}
+	if err := addresses.Remove(parent, "home"); err == nil || !IsErrNotFound(err) {
+		t.Fatal("Expected not found error for the removed child. Got: ", err)
+	}
+
+	results, err = repo.(RawQuerier).RawQuery(bson.M{"value": bson.M{"$in": []string{"aa", "ba"}}}, &TestEntry{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resArr := results.(*[]*TestEntry); len(*resArr) != 2 {
+		t.Fatal("Expected 2 results of the raw query, but got: ", len(*resArr))
+	}
+	grouped, err := repo.(RawQuerier).RawQuery([]bson.M{
+		{"$match": bson.M{"checked": true}},
+		{"$group": bson.M{"_id": "$checked", "total": bson.M{"$sum": 1}}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if groups := *grouped.(*[]*map[string]interface{}); len(groups) != 1 || (*groups[0])["total"] != float64(2) {
+		t.Fatal("Expected the aggregated total. Got: ", groups)
+	}
+	piped, err := repo.(*MongoCollection).Pipe([]bson.M{
+		{"$match": bson.M{"value": bson.M{"$in": []string{"aa", "ba"}}}},
+		{"$sort": bson.M{"value": -1}},
+	}, &TestEntry{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := *piped.(*[]*TestEntry); len(entries) != 2 || entries[0].Value != "ba" || entries[0].ID == "" {
+		t.Fatal("Expected the sorted entries of the pipeline with their ids. Got: ", entries)
+	}
+}
+
+func TestMongoQueryTranslator(t *testing.T) {
+	query, err := toMongoFilter(NewFilter().MatchPattern("name", "John%").Match("role", "user"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if query["role"] != "user" {
+		t.Fatal("Expected exact match on role. Got: ", query["role"])
+	}
+	nameSpec, ok := query["name"].(bson.M)
+	if !ok {
+		t.Fatal("Expected specification for name. Got: ", query["name"])
+	}
+	if nameSpec["$regex"] != "^John.*" {
+		t.Fatal("Expected regex for name. Got: ", nameSpec["$regex"])
+	}
+}
+
+func TestMongoQueryTranslatorComparisons(t *testing.T) {
+	query, err := toMongoFilter(Filter{
+		"age":    map[string]interface{}{OpGt: 18, OpLte: 65},
+		"status": map[string]interface{}{OpIn: []string{"active", "invited"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ageSpec, ok := query["age"].(bson.M)
+	if !ok || ageSpec["$gt"] != 18 || ageSpec["$lte"] != 65 {
+		t.Fatal("Expected the range for age. Got: ", query["age"])
+	}
+	statusSpec, ok := query["status"].(bson.M)
+	if !ok || len(statusSpec["$in"].([]interface{})) != 2 {
+		t.Fatal("Expected $in for status. Got: ", query["status"])
+	}
+}
+
+func TestMongoQueryTranslatorNulls(t *testing.T) {
+	query, err := toMongoFilter(NewFilter().MatchNull("phone", true).MatchExists("email", false).MatchNull("name", false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec := query["phone"].(bson.M); spec["$type"] != 10 {
+		t.Fatal("Expected the null phone to be matched by its type. Got: ", spec)
+	}
+	if spec := query["email"].(bson.M); spec["$exists"] != false {
+		t.Fatal("Expected $exists for email. Got: ", spec)
+	}
+	if spec, ok := query["name"].(bson.M)["$ne"]; !ok || spec != nil {
+		t.Fatal("Expected $ne null for name. Got: ", query["name"])
+	}
+
+	if _, err := toMongoFilter(Filter{"name": map[string]interface{}{OpNe: "x", OpNull: false}}); err == nil {
+		t.Fatal("Expected error when combining $ne and $null")
+	}
+}
+
+func TestMongoQueryTranslatorRegex(t *testing.T) {
+	query, err := toMongoFilter(NewFilter().MatchRegex("name", "^J(ohn|ane)$"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nameSpec, ok := query["name"].(bson.M)
+	if !ok || nameSpec["$regex"] != "^J(ohn|ane)$" {
+		t.Fatal("Expected raw regex for name. Got: ", query["name"])
+	}
+
+	_, err = toMongoFilter(Filter{"name": map[string]interface{}{"$pattern": "J%", "$regex": "^J"}})
+	if err == nil {
+		t.Fatal("Expected error when combining $pattern and $regex")
+	}
+}
+
+func TestMongoTTLExpired(t *testing.T) {
+	collection := &MongoCollection{repoDef: RepositoryDefinitionMap{
+		"enableTtl":      true,
+		"ttl":            3600,
+		"ttlAttribute":   "createdAt",
+		"ttlGracePeriod": 60,
+	}}
+	query, err := collection.mongoFilter(NewFilter().Match("role", "user"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	and, ok := query["$and"].([]bson.M)
+	if !ok || len(and) != 2 || and[0]["role"] != "user" {
+		t.Fatal("Expected the filter and the TTL condition. Got: ", query)
+	}
+	// the documents created more than the TTL and the grace period ago are expired
+	expired := and[1]["createdAt"].(bson.M)["$not"].(bson.M)["$lte"].(time.Time)
+	if cutoff := time.Now().Add(-3660 * time.Second); expired.Sub(cutoff) > time.Second || cutoff.Sub(expired) > time.Second {
+		t.Fatal("Expected the documents created before ", cutoff, " to be expired. Got: ", expired)
+	}
+
+	collection.repoDef.(RepositoryDefinitionMap)["ttlExpired"] = TTLExpiredInclude
+	if query, err := collection.mongoFilter(NewFilter().Match("role", "user")); err != nil || !reflect.DeepEqual(query, bson.M{"role": "user"}) {
+		t.Fatal("Expected the expired documents to be included. Got: ", query, err)
+	}
+}
+
+func TestMongoDialInfo(t *testing.T) {
+	for _, test := range []struct {
+		host       string
+		addrs      []string
+		replicaSet string
+		database   string
+	}{
+		{"mongo:27017", []string{"mongo:27017"}, "", "users"},
+		{"mongo1:27017, mongo2:27017,", []string{"mongo1:27017", "mongo2:27017"}, "", "users"},
+		{"rs0/mongo1:27017,mongo2:27017", []string{"mongo1:27017", "mongo2:27017"}, "rs0", "users"},
+		{"mongodb://mongo1,mongo2/admin?replicaSet=rs1", []string{"mongo1", "mongo2"}, "rs1", "users"},
+	} {
+		info, err := mongoDialInfo(test.host, "user", "secret", "users")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(info.Addrs, test.addrs) || info.ReplicaSetName != test.replicaSet || info.Database != test.database {
+			t.Fatalf("Invalid dial info for %q. Got %v, %q, %q", test.host, info.Addrs, info.ReplicaSetName, info.Database)
+		}
+		if info.Username != "user" || info.Password != "secret" || info.Timeout != 30*time.Second {
+			t.Fatal("Expected the credentials and the timeout to be set. Got: ", info)
+		}
+	}
+
+	t.Setenv("MONGO_REPLICA_SET", "rs2")
+	if info, err := mongoDialInfo("mongo1,mongo2", "", "", ""); err != nil || info.ReplicaSetName != "rs2" {
+		t.Fatal("Expected the replica set of the environment. Got: ", info, err)
+	}
+
+	for _, host := range []string{"", " , ", "rs0/", "mongodb://mongo/?ssl=maybe"} {
+		if _, err := mongoDialInfo(host, "", "", ""); err == nil {
+			t.Fatalf("Expected an error for host %q", host)
+		}
+	}
+}
+
+func TestMongoReadPreference(t *testing.T) {
+	for readPreference, expected := range map[string]mgo.Mode{
+		MongoReadPrimary:            mgo.Primary,
+		MongoReadPrimaryPreferred:   mgo.PrimaryPreferred,
+		MongoReadSecondary:          mgo.Secondary,
+		MongoReadSecondaryPreferred: mgo.SecondaryPreferred,
+		MongoReadNearest:            mgo.Nearest,
+		MongoReadMonotonic:          mgo.Monotonic,
+	} {
+		if mode, err := mongoMode(readPreference); err != nil || mode != expected {
+			t.Fatalf("Expected mode %v for %s. Got %v, %v", expected, readPreference, mode, err)
+		}
+	}
+	if _, err := mongoMode("fastest"); err == nil {
+		t.Fatal("Expected an error for an unknown read preference")
+	}
+
+	// the backend reads with the read preference of the connection string, monotonic by default
+	if mode, err := mongoSessionMode("mongo1,mongo2"); err != nil || mode != mgo.Monotonic {
+		t.Fatal("Expected monotonic mode by default. Got: ", mode, err)
+	}
+	if mode, err := mongoSessionMode("mongodb://mongo1,mongo2/?replicaSet=rs0&readPreference=secondaryPreferred"); err != nil || mode != mgo.SecondaryPreferred {
+		t.Fatal("Expected the read preference of the connection string. Got: ", mode, err)
+	}
+	if _, err := parseMongoURI("mongodb://mongo/?readPreference=fastest"); err == nil {
+		t.Fatal("Expected an error for an unknown read preference of the connection string")
+	}
+	t.Setenv("MONGO_READ_PREFERENCE", MongoReadNearest)
+	if mode, err := mongoSessionMode("mongodb://mongo/?readPreference=secondary"); err != nil || mode != mgo.Nearest {
+		t.Fatal("Expected the read preference of the environment. Got: ", mode, err)
+	}
+
+	if readPreference := (RepositoryDefinitionMap{"readPreference": MongoReadSecondary}).GetReadPreference(); readPreference != MongoReadSecondary {
+		t.Fatal("Expected the read preference of the repository. Got: ", readPreference)
+	}
+}
+
+func TestMongoWriteConcern(t *testing.T) {
+	for _, test := range []struct {
+		concern map[string]interface{}
+		safe    *mgo.Safe
+	}{
+		{map[string]interface{}{"w": "majority", "wtimeout": 5000, "j": true}, &mgo.Safe{WMode: "majority", WTimeout: 5000, J: true}},
+		{map[string]interface{}{"w": float64(2), "wtimeout": "100", "j": "false"}, &mgo.Safe{W: 2, WTimeout: 100}},
+		{map[string]interface{}{"w": "dc-east"}, &mgo.Safe{WMode: "dc-east"}},
+		{map[string]interface{}{"w": 0}, nil},
+		{map[string]interface{}{}, &mgo.Safe{}},
+	} {
+		safe, err := mongoSafe(test.concern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(safe, test.safe) {
+			t.Fatalf("Expected %v for the write concern %v. Got %v", test.safe, test.concern, safe)
+		}
+	}
+	for _, invalid := range []map[string]interface{}{{"w": -1}, {"w": 1.5}, {"wtimeout": "soon"}, {"j": "maybe"}, {"fsync": true}} {
+		if _, err := mongoSafe(invalid); err == nil {
+			t.Fatal("Expected an error for the write concern ", invalid)
+		}
+	}
+
+	// the write concern of the backend
+	if concern, err := mongoSessionWriteConcern("mongo1,mongo2"); err != nil || concern != nil {
+		t.Fatal("Expected the default write concern. Got: ", concern, err)
+	}
+	concern, err := mongoSessionWriteConcern("mongodb://mongo1,mongo2/?w=majority&wtimeoutMS=2000")
+	if err != nil || !reflect.DeepEqual(concern, map[string]interface{}{"w": "majority", "wtimeout": "2000"}) {
+		t.Fatal("Expected the write concern of the connection string. Got: ", concern, err)
+	}
+	t.Setenv("MONGO_WRITE_CONCERN", "1")
+	t.Setenv("MONGO_JOURNAL", "true")
+	concern, err = mongoSessionWriteConcern("mongodb://mongo1,mongo2/?w=majority&wtimeoutMS=2000")
+	if err != nil || !reflect.DeepEqual(concern, map[string]interface{}{"w": "1", "wtimeout": "2000", "j": "true"}) {
+		t.Fatal("Expected the write concern of the environment. Got: ", concern, err)
+	}
+	if _, err := parseMongoURI("mongodb://mongo/?journal=maybe"); err == nil {
+		t.Fatal("Expected an error for an invalid journal option of the connection string")
+	}
+
+	definition := RepositoryDefinitionMap{"writeConcern": map[string]interface{}{"w": "majority"}}
+	if concern := definition.GetWriteConcern(); concern["w"] != "majority" {
+		t.Fatal("Expected the write concern of the repository. Got: ", concern)
+	}
+}
+
+func TestMongoCollation(t *testing.T) {
+	collation := mongoCollation(&Collation{Locale: "fr", Strength: 2, CaseLevel: true})
+	if collation.Locale != "fr" || collation.Strength != 2 || !collation.CaseLevel || mongoCollation(nil) != nil {
+		t.Fatal("Expected the mgo collation. Got: ", collation)
+	}
+
+	// MongoDB returns the defaults of the locale with the collation of a collection
+	existing := &mgo.Collation{Locale: "fr", Strength: 2, CaseLevel: true, CaseFirst: "off", Alternate: "non-ignorable", Backwards: true}
+	if !sameMongoCollation(existing, collation) {
+		t.Fatal("Expected the collations to be the same")
+	}
+	if !sameMongoCollation(&mgo.Collation{Locale: "de", Strength: 3}, &mgo.Collation{Locale: "de"}) {
+		t.Fatal("Expected the default strength to be 3")
+	}
+	if sameMongoCollation(existing, &mgo.Collation{Locale: "fr", Strength: 1}) || sameMongoCollation(nil, collation) || !sameMongoCollation(nil, nil) {
+		t.Fatal("Expected the collations to differ")
+	}
+}
+
+func TestMongoCapped(t *testing.T) {
+	capped := mongoCapped(&Capped{MaxBytes: 4096, MaxDocuments: 10})
+	if !capped.Capped || capped.MaxBytes != 4096 || capped.MaxDocs != 10 || mongoCapped(nil) != nil {
+		t.Fatal("Expected the mgo collection options. Got: ", capped)
+	}
+}
+
+func TestMongoCappedCollection(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode.")
+	}
+
+	bm := NewBackendSupport(map[string]*config.DBInfo{
+		"mongodb": &config.DBInfo{
+			DatabaseName: "testdb",
+			Host:         "localhost:27017",
+			Username:     "testuser",
+			Password:     "testpass",
+		},
+	})
+	backend, err := bm.GetBackend("mongodb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := backend.DefineRepository("audit_log", RepositoryDefinitionMap{
+		"name":   "audit_log",
+		"capped": map[string]interface{}{"maxBytes": 4096, "maxDocuments": 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.(*MongoCollection).DropCollection()
+
+	for _, value := range []string{"first", "second", "third", "fourth"} {
+		if _, err := repo.Save(&TestEntry{Value: value}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if count, err := repo.Count(nil); err != nil || count != 3 {
+		t.Fatal("Expected the oldest record to be removed. Got: ", count, err)
+	}
+	if exists, err := repo.Exists(NewFilter().Match("value", "first")); err != nil || exists {
+		t.Fatal("Expected the first record to be removed. Got: ", exists, err)
+	}
+
+	// the limits of an existing collection can't be changed
+	other := NewBackendSupport(map[string]*config.DBInfo{
+		"mongodb": &config.DBInfo{
+			DatabaseName: "testdb",
+			Host:         "localhost:27017",
+			Username:     "testuser",
+			Password:     "testpass",
+		},
+	})
+	otherBackend, err := other.GetBackend("mongodb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = otherBackend.DefineRepository("audit_log", RepositoryDefinitionMap{
+		"name":   "audit_log",
+		"capped": map[string]interface{}{"maxBytes": 8192},
+	})
+	if err == nil {
+		t.Fatal("Expected an error for other limits of an existing collection")
+	}
+}
+
+func TestMongoUpsert(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode.")
+	}
+
+	bm := NewBackendSupport(map[string]*config.DBInfo{
+		"mongodb": &config.DBInfo{
+			DatabaseName: "testdb",
+			Host:         "localhost:27017",
+			Username:     "testuser",
+			Password:     "testpass",
+		},
+	})
+	backend, err := bm.GetBackend("mongodb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := backend.DefineRepository("profiles", RepositoryDefinitionMap{
+		"name":    "profiles",
+		"indexes": []Index{NewUniqueIndex("userId")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.DeleteAll(nil)
+
+	filter := func() Filter {
+		return NewFilter().Match("userId", "user-1")
+	}
+	created, err := SaveRecord(repo, &map[string]interface{}{"name": "John", "createdAt": "monday"}, filter(), Upsert("createdAt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := *created.(*map[string]interface{})
+	if record["userId"] != "user-1" || record["name"] != "John" || record["createdAt"] != "monday" || record["id"] == nil {
+		t.Fatal("Expected the record to be created with the filter. Got: ", record)
+	}
+
+	updated, err := SaveRecord(repo, &map[string]interface{}{"name": "Johnny", "createdAt": "tuesday"}, filter(), Upsert("createdAt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	record = *updated.(*map[string]interface{})
+	if record["name"] != "Johnny" || record["createdAt"] != "monday" || record["id"] != (*created.(*map[string]interface{}))["id"] {
+		t.Fatal("Expected the record to be updated without the insert-only properties. Got: ", record)
+	}
+	if count, err := repo.Count(nil); err != nil || count != 1 {
+		t.Fatal("Expected a single record. Got: ", count, err)
+	}
+}
+
+func TestMongoBulkError(t *testing.T) {
+	if err := mongoWriteError(&mgo.LastError{Code: 11000}); !IsErrAlreadyExists(err) {
+		t.Fatal("Expected ErrAlreadyExists from a duplicate key. Got: ", err)
+	}
+	if err := mongoWriteError(&mgo.QueryError{Code: 121}); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput from a validation failure. Got: ", err)
+	}
+	// the failed writes are not known
+	if err := mongoBulkError(&mgo.LastError{Code: 11000}, 2, true); !IsErrAlreadyExists(err) {
+		t.Fatal("Expected the error itself. Got: ", err)
+	}
+	if err := mongoBulkError(&mgo.BulkError{}, 2, true); err == nil {
+		t.Fatal("Expected an error without the failed writes")
+	}
+}
+
+func TestMongoWriteAll(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode.")
+	}
+
+	bm := NewBackendSupport(map[string]*config.DBInfo{
+		"mongodb": &config.DBInfo{
+			DatabaseName: "testdb",
+			Host:         "localhost:27017",
+			Username:     "testuser",
+			Password:     "testpass",
+		},
+	})
+	backend, err := bm.GetBackend("mongodb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := backend.DefineRepository("bulk_entries", RepositoryDefinitionMap{
+		"name":    "bulk_entries",
+		"indexes": []Index{NewUniqueIndex("value")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.DeleteAll(nil)
+
+	result, err := WriteRecords(repo, []BulkWrite{
+		{Insert: &TestEntry{Value: "first"}},
+		{Insert: &TestEntry{Value: "second"}},
+		{Filter: NewFilter().Match("value", "first"), Update: map[string]interface{}{"value": "updated"}},
+		{Filter: NewFilter().Match("value", "second"), Delete: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Updated != 1 || result.Records[0].(map[string]interface{})["id"] == nil {
+		t.Fatal("Expected the created records and the updated count. Got: ", result)
+	}
+	if count, err := repo.Count(nil); err != nil || count != 1 {
+		t.Fatal("Expected a single record. Got: ", count, err)
+	}
+
+	duplicates := func() []BulkWrite {
+		return []BulkWrite{
+			{Insert: &TestEntry{Value: "updated"}},
+			{Insert: &TestEntry{Value: "third"}},
+		}
+	}
+	result, err = WriteRecords(repo, duplicates())
+	bulkErr, ok := err.(*BulkWriteError)
+	if !ok || !IsErrAlreadyExists(bulkErr.Errors[0]) || bulkErr.Errors[1] != errBulkNotWritten || result.Records[1] != nil {
+		t.Fatal("Expected the ordered bulk write to stop at the duplicate. Got: ", err)
+	}
+	result, err = WriteRecords(repo, duplicates(), Unordered())
+	bulkErr, ok = err.(*BulkWriteError)
+	if !ok || !IsErrAlreadyExists(bulkErr.Errors[0]) || bulkErr.Errors[1] != nil || result.Records[1] == nil {
+		t.Fatal("Expected the unordered bulk write to insert the other record. Got: ", err)
+	}
+
+	if _, err := repo.SaveAll([]*TestEntry{{Value: "fourth"}, {Value: "third"}}); !IsErrAlreadyExists(err) {
+		t.Fatal("Expected ErrAlreadyExists from SaveAll. Got: ", err)
+	}
+}
+
+func TestMongoValidator(t *testing.T) {
+	schema := &DataSchema{
+		Type:     SchemaObject,
+		Required: []string{"id", "email"},
+		Properties: map[string]*DataSchema{
+			"id":     {Type: SchemaString},
+			"email":  {Type: SchemaString, Pattern: "@", MaxLength: 100},
+			"age":    {Type: SchemaInteger, Minimum: SchemaLimit(0), Nullable: true},
+			"status": {Enum: []interface{}{"active", "invited"}, Nullable: true},
+			"tags":   {Type: SchemaArray, Items: &DataSchema{Type: SchemaString}},
+		},
+	}
+	expected := bson.M{"$jsonSchema": bson.M{
+		"bsonType": "object",
+		"required": []string{"email"},
+		"properties": bson.M{
+			"email":  bson.M{"bsonType": "string", "pattern": "@", "maxLength": 100},
+			"age":    bson.M{"bsonType": []string{"int", "long", "null"}, "minimum": float64(0)},
+			"status": bson.M{"enum": []interface{}{"active", "invited", nil}},
+			"tags":   bson.M{"bsonType": "array", "items": bson.M{"bsonType": "string"}},
+		},
+	}}
+	if validator := mongoValidator(schema, false); !reflect.DeepEqual(validator, expected) {
+		t.Fatal("Expected the $jsonSchema without the id. Got: ", validator)
+	}
+
+	validator := mongoValidator(schema, true)
+	jsonSchema := validator["$jsonSchema"].(bson.M)
+	if !reflect.DeepEqual(jsonSchema["required"], []string{"id", "email"}) || jsonSchema["properties"].(bson.M)["id"] == nil {
+		t.Fatal("Expected the custom id in the $jsonSchema. Got: ", validator)
+	}
+	if mongoValidator(nil, false) != nil {
+		t.Fatal("Expected no validator without a schema")
+	}
+
+	if !isMongoValidationError(&mgo.LastError{Code: 121, Err: "Document failed validation"}) || isMongoValidationError(&mgo.LastError{Code: 11000}) {
+		t.Fatal("Expected only the code 121 to be a validation error")
+	}
+}
+
+func TestMongoDataSchema(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode.")
+	}
+
+	bm := NewBackendSupport(map[string]*config.DBInfo{
+		"mongodb": &config.DBInfo{
+			DatabaseName: "testdb",
+			Host:         "localhost:27017",
+			Username:     "testuser",
+			Password:     "testpass",
+		},
+	})
+	backend, err := bm.GetBackend("mongodb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := &DataSchema{
+		Type:       SchemaObject,
+		Required:   []string{"value"},
+		Properties: map[string]*DataSchema{"value": {Type: SchemaString, MinLength: 3}},
+	}
+	repo, err := backend.DefineRepository("validated", RepositoryDefinitionMap{"name": "validated"}.WithDataSchema(schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.DeleteAll(nil)
+	if _, err := repo.Save(&TestEntry{Value: "valid"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// the server rejects the writes that bypass the validation of the package
+	collection := repo.(*DataSchemaRepository).Repository.(*MongoCollection)
+	if _, err := collection.Save(&TestEntry{Value: "no"}, nil); !IsErrInvalidInput(err) {
+		t.Fatal("Expected the server to reject the invalid record. Got: ", err)
+	}
+}
+
+func TestMongoIndexKey(t *testing.T) {
+	key := mongoIndexKey(NewSortedIndex("", false, Ascending("userId"), Descending("createdAt")))
+	if !reflect.DeepEqual(key, []string{"userId", "-createdAt"}) {
+		t.Fatal("Expected the descending field prefixed with -. Got: ", key)
+	}
+	if key := mongoIndexKey(NewUniqueIndex("email")); !reflect.DeepEqual(key, []string{"email"}) {
+		t.Fatal("Expected the fields of the index. Got: ", key)
+	}
+}
+
+func TestMongoTextSearch(t *testing.T) {
+	index := mongoTextIndex(&TextIndex{Fields: []string{"title", "body"}, Weights: map[string]int{"title": 10}, Language: "none"})
+	if !reflect.DeepEqual(index.Key, []string{"$text:title", "$text:body"}) || index.Weights["title"] != 10 || index.DefaultLanguage != "none" {
+		t.Fatal("Expected the text index for mgo. Got: ", index)
+	}
+
+	collection := &MongoCollection{repoDef: RepositoryDefinitionMap{
+		"name":      "articles",
+		"textIndex": map[string]interface{}{"fields": []string{"title", "body"}},
+	}}
+	query, err := collection.textQuery("replica failover", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(query, bson.M{"$text": bson.M{"$search": "replica failover"}}) {
+		t.Fatal("Expected the $text query. Got: ", query)
+	}
+	query, err = collection.textQuery("failover", NewFilter().Match("status", "published"))
+	if err != nil || query["status"] != "published" || query["$text"] == nil {
+		t.Fatal("Expected the filter with the $text query. Got: ", query, err)
+	}
+	if _, err := collection.textQuery("  ", nil); !IsErrInvalidInput(err) {
+		t.Fatal("Expected an error for an empty text. Got: ", err)
+	}
+
+	plain := &MongoCollection{repoDef: RepositoryDefinitionMap{"name": "users"}}
+	if _, err := plain.Search("failover", nil, nil, 0, 0); !IsErrorOfType(err, ErrNotSupported("")) {
+		t.Fatal("Expected ErrNotSupported without a text index. Got: ", err)
+	}
 }
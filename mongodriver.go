@@ -0,0 +1,209 @@
+package backends
+
+import (
+	"context"
+	"crypto/tls"
+	"strings"
+	"sync"
+
+	"github.com/Microkubes/microservice-tools/config"
+	mongobson "go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// newMongoClient connects the official MongoDB driver to the database of the config, for the features that mgo
+// predates: the sessions of the transactions and the change streams. The host, the replica set and the credentials are
+// taken as for the mgo session (see mongoDialInfo), and a connection string is applied with all its options. With a
+// TLS config the client connects to DocumentDB, which does not support the retryable writes.
+func newMongoClient(conf *config.DBInfo, tlsConfig *tls.Config) (*mongo.Client, error) {
+	info, err := mongoDialInfo(conf.Host, conf.Username, conf.Password, conf.DatabaseName)
+	if err != nil {
+		return nil, err
+	}
+
+	clientOptions := options.Client()
+	if strings.HasPrefix(conf.Host, "mongodb://") || strings.HasPrefix(conf.Host, "mongodb+srv://") {
+		clientOptions.ApplyURI(conf.Host)
+	} else {
+		clientOptions.SetHosts(info.Addrs)
+	}
+	if info.ReplicaSetName != "" {
+		clientOptions.SetReplicaSet(info.ReplicaSetName)
+	}
+	if info.Username != "" {
+		source := info.Source
+		if source == "" {
+			source = info.Database
+		}
+		clientOptions.SetAuth(options.Credential{
+			AuthSource: source,
+			Username:   info.Username,
+			Password:   info.Password,
+		})
+	}
+	clientOptions.SetConnectTimeout(info.Timeout)
+	if tlsConfig != nil {
+		clientOptions.SetTLSConfig(tlsConfig)
+		clientOptions.SetRetryWrites(false)
+	}
+
+	client, err := mongo.Connect(context.Background(), clientOptions)
+	if err != nil {
+		return nil, ErrBackendError("failed to connect the MongoDB driver: " + err.Error())
+	}
+	return client, nil
+}
+
+// mongoDriver connects the official MongoDB driver on the first transaction or change stream, so the backends that use
+// neither open no second pool of connections next to the mgo session.
+type mongoDriver struct {
+	conf      *config.DBInfo
+	tlsConfig *tls.Config
+	once      *sync.Once
+	client    *mongo.Client
+	err       error
+}
+
+// newMongoDriver creates the mongoDriver of the config, see newMongoClient.
+func newMongoDriver(conf *config.DBInfo, tlsConfig *tls.Config) *mongoDriver {
+	return &mongoDriver{
+		conf:      conf,
+		tlsConfig: tlsConfig,
+		once:      &sync.Once{},
+	}
+}
+
+// connect returns the client of the driver, connected on the first call.
+func (d *mongoDriver) connect() (*mongo.Client, error) {
+	d.once.Do(func() {
+		d.client, d.err = newMongoClient(d.conf, d.tlsConfig)
+	})
+	return d.client, d.err
+}
+
+// disconnect disconnects the client if it was connected, which ends the sessions of the transactions on the server.
+// The driver is not connected after it.
+func (d *mongoDriver) disconnect() {
+	d.once.Do(func() {
+		d.err = ErrBackendError("the MongoDB backend is closed")
+	})
+	if d.client != nil {
+		d.client.Disconnect(context.Background())
+	}
+}
+
+// driverCollection returns the collection in the official driver, connected on the first call. Returns
+// ErrNotSupported if the backend has no driver.
+func (c *MongoCollection) driverCollection() (*mongo.Collection, error) {
+	if c.driver == nil {
+		return nil, ErrNotSupported("the repository has no client of the official MongoDB driver")
+	}
+	client, err := c.driver.connect()
+	if err != nil {
+		return nil, err
+	}
+	return client.Database(c.Database.Name).Collection(c.Name), nil
+}
+
+// toMongoDriverValue converts the mgo values of a query or a document (bson.M, bson.D, bson.ObjectId...) to the
+// values of the official driver, so the queries built for mgo can be sent with the driver.
+func toMongoDriverValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bson.ObjectId:
+		id := primitive.ObjectID{}
+		copy(id[:], v)
+		return id
+	case bson.M:
+		return toMongoDriverDocument(v)
+	case map[string]interface{}:
+		return toMongoDriverDocument(v)
+	case bson.D:
+		document := make(mongobson.D, len(v))
+		for i, element := range v {
+			document[i] = mongobson.E{Key: element.Name, Value: toMongoDriverValue(element.Value)}
+		}
+		return document
+	case []bson.M:
+		values := make(primitive.A, len(v))
+		for i, element := range v {
+			values[i] = toMongoDriverDocument(element)
+		}
+		return values
+	case []map[string]interface{}:
+		values := make(primitive.A, len(v))
+		for i, element := range v {
+			values[i] = toMongoDriverDocument(element)
+		}
+		return values
+	case []interface{}:
+		values := make(primitive.A, len(v))
+		for i, element := range v {
+			values[i] = toMongoDriverValue(element)
+		}
+		return values
+	case bson.RegEx:
+		return primitive.Regex{Pattern: v.Pattern, Options: v.Options}
+	case bson.Binary:
+		return primitive.Binary{Subtype: v.Kind, Data: v.Data}
+	case bson.MongoTimestamp:
+		return primitive.Timestamp{T: uint32(v >> 32), I: uint32(v)}
+	}
+	return value
+}
+
+// toMongoDriverDocument converts the mgo document to a document of the official driver.
+func toMongoDriverDocument(document map[string]interface{}) mongobson.M {
+	converted := mongobson.M{}
+	for key, value := range document {
+		converted[key] = toMongoDriverValue(value)
+	}
+	return converted
+}
+
+// fromMongoDriverValue converts the value decoded by the official driver to the value mgo decodes, so the records
+// read with the driver are the same as the records read with mgo (the ids are bson.ObjectId, the embedded documents
+// are maps and the dates are time.Time).
+func fromMongoDriverValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case primitive.ObjectID:
+		return bson.ObjectId(v[:])
+	case primitive.D:
+		return fromMongoDriverDocument(v.Map())
+	case primitive.M:
+		return fromMongoDriverDocument(v)
+	case map[string]interface{}:
+		return fromMongoDriverDocument(v)
+	case primitive.A:
+		values := make([]interface{}, len(v))
+		for i, element := range v {
+			values[i] = fromMongoDriverValue(element)
+		}
+		return values
+	case primitive.DateTime:
+		return v.Time()
+	case primitive.Timestamp:
+		return bson.MongoTimestamp(int64(v.T)<<32 | int64(v.I))
+	case primitive.Regex:
+		return bson.RegEx{Pattern: v.Pattern, Options: v.Options}
+	case primitive.Binary:
+		if v.Subtype == 0 {
+			return v.Data
+		}
+		return bson.Binary{Kind: v.Subtype, Data: v.Data}
+	case int32:
+		return int(v)
+	}
+	return value
+}
+
+// fromMongoDriverDocument converts the document decoded by the official driver to the record mgo decodes.
+func fromMongoDriverDocument(document map[string]interface{}) map[string]interface{} {
+	record := map[string]interface{}{}
+	for key, value := range document {
+		record[key] = fromMongoDriverValue(value)
+	}
+	return record
+}
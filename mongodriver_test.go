@@ -0,0 +1,57 @@
+package backends
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	mongobson "go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestMongoDriverValues(t *testing.T) {
+	id := bson.NewObjectId()
+	query := bson.M{
+		"_id":  bson.M{"$in": []interface{}{id}},
+		"name": bson.M{"$regex": "^jo"},
+		"$or":  []bson.M{{"age": 30}, {"tags": []string{"a"}}},
+	}
+	converted := toMongoDriverValue(query).(mongobson.M)
+	ids := converted["_id"].(mongobson.M)["$in"].(primitive.A)
+	if value, ok := ids[0].(primitive.ObjectID); !ok || value.Hex() != id.Hex() {
+		t.Fatal("Expected the id as an ObjectID of the driver. Got: ", ids[0])
+	}
+	if or := converted["$or"].(primitive.A); len(or) != 2 || !reflect.DeepEqual(or[0], mongobson.M{"age": 30}) {
+		t.Fatal("Expected the documents of $or as documents of the driver. Got: ", converted["$or"])
+	}
+	sort := toMongoDriverValue(bson.D{{Name: "name", Value: 1}})
+	if !reflect.DeepEqual(sort, mongobson.D{{Key: "name", Value: 1}}) {
+		t.Fatal("Expected an ordered document of the driver. Got: ", sort)
+	}
+
+	driverID, err := primitive.ObjectIDFromHex(id.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Truncate(time.Millisecond)
+	record := fromMongoDriverDocument(mongobson.M{
+		"_id":     driverID,
+		"created": primitive.NewDateTimeFromTime(now),
+		"address": primitive.D{{Key: "city", Value: "Skopje"}},
+		"tags":    primitive.A{"a", int32(2)},
+		"raw":     primitive.Binary{Data: []byte("data")},
+	})
+	expected := map[string]interface{}{
+		"_id":     id,
+		"created": now,
+		"address": map[string]interface{}{"city": "Skopje"},
+		"tags":    []interface{}{"a", 2},
+		"raw":     []byte("data"),
+	}
+	for key, value := range expected {
+		if !reflect.DeepEqual(record[key], value) && !(key == "created" && record[key].(time.Time).Equal(now)) {
+			t.Fatalf("Expected %s to be decoded as with mgo. Got: %#v", key, record[key])
+		}
+	}
+}
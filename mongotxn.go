@@ -0,0 +1,380 @@
+package backends
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	mongobson "go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// MongoBackend is a MongoDB backend. It implements TransactionalBackend.
+type MongoBackend struct {
+	Backend
+	session *mgo.Session
+	// driver is the official driver, for the transactions and the change streams
+	driver *mongoDriver
+}
+
+// mongoTransaction is a Transaction of a MongoBackend. The commands of the repositories are sent with the official
+// driver, with the context of the session of the transaction.
+type mongoTransaction struct {
+	backend *MongoBackend
+	client  *mongo.Client
+	ctx     mongo.SessionContext
+}
+
+// mongoTxnRepository is a repository whose commands are run in a MongoDB transaction.
+type mongoTxnRepository struct {
+	collection *MongoCollection
+	tx         *mongoTransaction
+}
+
+// Transact runs the function in a MongoDB transaction, so MongoDB 4.0 or later must run as a replica set (4.2 for a
+// sharded cluster). The transaction runs in a session of the official driver (WithTransaction), so the commands on the
+// repositories obtained from the transaction are committed atomically when the function returns nil, and discarded
+// when it returns an error:
+//   - the reads see the writes of the transaction, and a snapshot of the other documents,
+//   - a transaction should be short: MongoDB aborts the transactions that run longer than a minute.
+//
+// The function is run again while the transaction fails with a transient error (the TransientTransactionError label,
+// for example on a write conflict or a failover), and the commit is retried while its result is unknown (the
+// UnknownTransactionCommitResult label), for up to 2 minutes, so the function must not have side effects outside of
+// the transaction, and it must return the errors of the repositories of the transaction unchanged (or wrapped with
+// %w) for them to be retried. Returns ErrConflict if the transaction still failed with a transient error, and
+// ErrNotSupported if MongoDB is not a replica set. The commands are sent with the context, and the session is ended
+// when Transact returns. The client of the driver is connected by the first transaction.
+func (b *MongoBackend) Transact(ctx context.Context, fn func(tx Transaction) error) error {
+	client, err := b.driver.connect()
+	if err != nil {
+		return err
+	}
+	session, err := client.StartSession()
+	if err != nil {
+		return ErrBackendError("failed to start a MongoDB session: " + err.Error())
+	}
+	defer session.EndSession(context.Background())
+
+	transactionOptions := options.Transaction().
+		SetReadConcern(readconcern.Snapshot()).
+		SetWriteConcern(writeconcern.New(writeconcern.WMajority()))
+	_, err = session.WithTransaction(ctx, func(sessionCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(&mongoTransaction{
+			backend: b,
+			client:  client,
+			ctx:     sessionCtx,
+		})
+	}, transactionOptions)
+	return mongoTransactionError(err)
+}
+
+// mongoTransactionError converts the error of the driver that failed the transaction. The other errors (of the
+// function, or of the context) are returned as they are.
+func mongoTransactionError(err error) error {
+	var serverErr mongo.ServerError
+	if err == nil || !errors.As(err, &serverErr) {
+		return err
+	}
+	switch {
+	case serverErr.HasErrorLabel("TransientTransactionError") || serverErr.HasErrorLabel("UnknownTransactionCommitResult"):
+		return ErrConflict("transaction failed because of concurrent writes: " + err.Error())
+	case serverErr.HasErrorCode(20) && strings.Contains(err.Error(), "Transaction numbers"):
+		return ErrNotSupported("transactions require a MongoDB replica set: " + err.Error())
+	case mongo.IsDuplicateKeyError(err):
+		return ErrAlreadyExists("record already exists!")
+	}
+	return ErrBackendError(err.Error())
+}
+
+// GetRepository returns the repository with its commands run in the transaction. It is wrapped like the repository of
+// the backend, so the data schema, the versions, the enums, the model and the soft deletes apply to the transaction.
+func (t *mongoTransaction) GetRepository(name string) (Repository, error) {
+	repo, err := t.backend.GetRepository(name)
+	if err != nil {
+		return nil, err
+	}
+	collection, ok := unwrapRepository(repo).(*MongoCollection)
+	if !ok {
+		return nil, ErrBackendError(fmt.Sprintf("repository %s is not a mongodb repository", name))
+	}
+	return wrapRepository(&mongoTxnRepository{
+		collection: collection,
+		tx:         t,
+	}, collection.repoDef)
+}
+
+// filter returns the MongoDB query of the filter.
+func (r *mongoTxnRepository) filter(filter Filter) (bson.M, error) {
+	if !r.collection.repoDef.IsCustomID() {
+		if err := stringToObjectID(filter); err != nil {
+			return nil, ErrInvalidInput(err)
+		}
+	}
+	query, err := r.collection.mongoFilter(filter)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+	return query, nil
+}
+
+// driverCollection returns the collection of the repository in the official driver.
+func (r *mongoTxnRepository) driverCollection() *mongo.Collection {
+	return r.tx.client.Database(r.collection.Database.Name).Collection(r.collection.Name)
+}
+
+// find returns the documents that match the query, with their ids converted.
+func (r *mongoTxnRepository) find(query bson.M, order string, sorting string, limit int, offset int) ([]map[string]interface{}, error) {
+	findOptions := options.Find()
+	if order != "" {
+		direction := 1
+		if sorting == "desc" {
+			direction = -1
+		}
+		findOptions.SetSort(mongobson.D{{Key: order, Value: direction}})
+	}
+	if offset != 0 {
+		findOptions.SetSkip(int64(offset))
+	}
+	if limit != 0 {
+		findOptions.SetLimit(int64(limit))
+	}
+
+	cursor, err := r.driverCollection().Find(r.tx.ctx, toMongoDriverValue(query), findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(r.tx.ctx)
+	records := []map[string]interface{}{}
+	for cursor.Next(r.tx.ctx) {
+		document := mongobson.M{}
+		if err := cursor.Decode(&document); err != nil {
+			return nil, err
+		}
+		record := fromMongoDriverDocument(document)
+		r.collection.hexID(record)
+		records = append(records, record)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// insert inserts the records as new documents, and sets their generated ids. Returns ErrAlreadyExists for a
+// duplicate key.
+func (r *mongoTxnRepository) insert(records []map[string]interface{}) error {
+	ids := make([]bson.ObjectId, len(records))
+	docs := make([]interface{}, len(records))
+	for i, record := range records {
+		ids[i] = bson.NewObjectId()
+		record["_id"] = ids[i]
+		if !r.collection.repoDef.IsCustomID() {
+			delete(record, "id")
+		}
+		docs[i] = toMongoDriverValue(record)
+	}
+	if _, err := r.driverCollection().InsertMany(r.tx.ctx, docs); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrAlreadyExists("record already exists!")
+		}
+		return err
+	}
+	for i, record := range records {
+		if !r.collection.repoDef.IsCustomID() {
+			record["id"] = ids[i].Hex()
+		}
+	}
+	return nil
+}
+
+// update sets the properties of the payload on the first or on all documents that match the query. Returns the
+// number of the matched documents.
+func (r *mongoTxnRepository) update(query bson.M, payload map[string]interface{}, multi bool) (int64, error) {
+	// the ids are immutable
+	delete(payload, "_id")
+	if !r.collection.repoDef.IsCustomID() {
+		delete(payload, "id")
+	}
+	update := mongobson.M{"$set": toMongoDriverValue(payload)}
+	var result *mongo.UpdateResult
+	var err error
+	if multi {
+		result, err = r.driverCollection().UpdateMany(r.tx.ctx, toMongoDriverValue(query), update)
+	} else {
+		result, err = r.driverCollection().UpdateOne(r.tx.ctx, toMongoDriverValue(query), update)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return result.MatchedCount, nil
+}
+
+// delete deletes the first or all documents that match the query. Returns the number of the deleted documents.
+func (r *mongoTxnRepository) delete(query bson.M, multi bool) (int64, error) {
+	var result *mongo.DeleteResult
+	var err error
+	if multi {
+		result, err = r.driverCollection().DeleteMany(r.tx.ctx, toMongoDriverValue(query))
+	} else {
+		result, err = r.driverCollection().DeleteOne(r.tx.ctx, toMongoDriverValue(query))
+	}
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// GetOne fetches only one record for given filter, in the transaction.
+func (r *mongoTxnRepository) GetOne(filter Filter, result interface{}) (interface{}, error) {
+	query, err := r.filter(filter)
+	if err != nil {
+		return nil, err
+	}
+	records, err := r.find(query, "", "", 1, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrNotFound("record not found")
+	}
+	if err := MapToInterface(&records[0], &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetAll fetches all matched records for given filter, in the transaction.
+func (r *mongoTxnRepository) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	query, err := r.filter(filter)
+	if err != nil {
+		return nil, err
+	}
+	records, err := r.find(query, order, sorting, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return recordsToResults(records, resultsTypeHint)
+}
+
+// Count returns the number of records that match the filter, in the transaction. The count command can't be run in
+// a transaction, so the documents are counted with an aggregation (CountDocuments).
+func (r *mongoTxnRepository) Count(filter Filter) (int64, error) {
+	query, err := r.filter(filter)
+	if err != nil {
+		return 0, err
+	}
+	return r.driverCollection().CountDocuments(r.tx.ctx, toMongoDriverValue(query))
+}
+
+// Exists reports whether a document matches the filter, in the transaction.
+func (r *mongoTxnRepository) Exists(filter Filter) (bool, error) {
+	query, err := r.filter(filter)
+	if err != nil {
+		return false, err
+	}
+	records, err := r.find(query, "", "", 1, 0)
+	if err != nil {
+		return false, err
+	}
+	return len(records) > 0, nil
+}
+
+// Save creates a new record in the transaction if the filter is nil. Otherwise it updates the first matched record,
+// and returns it as updated. Returns ErrNotFound if no record matches the filter.
+func (r *mongoTxnRepository) Save(object interface{}, filter Filter) (interface{}, error) {
+	payload, err := InterfaceToMap(object)
+	if err != nil {
+		return nil, err
+	}
+
+	if filter == nil {
+		if err := r.insert([]map[string]interface{}{*payload}); err != nil {
+			return nil, err
+		}
+		if err := MapToInterface(payload, &object); err != nil {
+			return nil, err
+		}
+		return object, nil
+	}
+
+	query, err := r.filter(filter)
+	if err != nil {
+		return nil, err
+	}
+	matched, err := r.update(query, *payload, false)
+	if err != nil {
+		return nil, err
+	}
+	if matched == 0 {
+		return nil, ErrNotFound("record not found")
+	}
+	return r.GetOne(filter, object)
+}
+
+// SaveAll inserts the objects (a slice) as new documents in the transaction. Returns the created records, with the
+// generated IDs.
+func (r *mongoTxnRepository) SaveAll(objects interface{}) (interface{}, error) {
+	records, err := objectsToRecords(objects)
+	if err != nil {
+		return nil, err
+	}
+	saved := []interface{}{}
+	if len(records) == 0 {
+		return saved, nil
+	}
+	if err := r.insert(records); err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		saved = append(saved, record)
+	}
+	return saved, nil
+}
+
+// UpdateAll sets the properties of the update on all matched documents in the transaction. Returns the number of
+// the matched documents.
+func (r *mongoTxnRepository) UpdateAll(filter Filter, update interface{}) (int64, error) {
+	payload, err := InterfaceToMap(update)
+	if err != nil {
+		return 0, err
+	}
+	query, err := r.filter(filter)
+	if err != nil {
+		return 0, err
+	}
+	return r.update(query, *payload, true)
+}
+
+// DeleteOne deletes the first matched record in the transaction. Returns ErrNotFound if no record matches the
+// filter.
+func (r *mongoTxnRepository) DeleteOne(filter Filter) error {
+	query, err := r.filter(filter)
+	if err != nil {
+		return err
+	}
+	deleted, err := r.delete(query, false)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrNotFound("record not found")
+	}
+	return nil
+}
+
+// DeleteAll deletes all matched records in the transaction.
+func (r *mongoTxnRepository) DeleteAll(filter Filter) error {
+	query, err := r.filter(filter)
+	if err != nil {
+		return err
+	}
+	_, err = r.delete(query, true)
+	return err
+}
@@ -0,0 +1,119 @@
+package backends
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestMongoTransactionError(t *testing.T) {
+	if err := mongoTransactionError(mongo.CommandError{Code: 20, Message: "Transaction numbers are only allowed on a replica set member or mongos"}); !IsErrorOfType(err, ErrNotSupported("")) {
+		t.Fatal("Expected ErrNotSupported on a standalone server. Got: ", err)
+	}
+	// the transient errors were retried by the driver
+	if err := mongoTransactionError(mongo.CommandError{Code: 112, Message: "WriteConflict", Labels: []string{"TransientTransactionError"}}); !IsErrConflict(err) {
+		t.Fatal("Expected a conflict. Got: ", err)
+	}
+	if err := mongoTransactionError(fmt.Errorf("commit: %w", mongo.CommandError{Code: 50, Labels: []string{"UnknownTransactionCommitResult"}})); !IsErrConflict(err) {
+		t.Fatal("Expected a conflict for the wrapped error. Got: ", err)
+	}
+	if err := mongoTransactionError(mongo.CommandError{Code: 2, Message: "bad value"}); err == nil || !IsErrorOfType(err, ErrBackendError("bad value")) {
+		t.Fatal("Expected a backend error. Got: ", err)
+	}
+	// the errors of the function and of the context are returned as they are
+	failed := errors.New("failed")
+	if err := mongoTransactionError(failed); err != failed {
+		t.Fatal("Expected the error of the function. Got: ", err)
+	}
+	if err := mongoTransactionError(ErrNotFound("record not found")); !IsErrNotFound(err) {
+		t.Fatal("Expected ErrNotFound. Got: ", err)
+	}
+	if err := mongoTransactionError(nil); err != nil {
+		t.Fatal("Expected no error. Got: ", err)
+	}
+}
+
+func TestMongoTransact(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode.")
+	}
+
+	bm := NewBackendSupport(map[string]*config.DBInfo{
+		"mongodb": &config.DBInfo{
+			DatabaseName: "testdb",
+			Host:         "localhost:27017",
+			Username:     "testuser",
+			Password:     "testpass",
+		},
+	})
+	backend, err := bm.GetBackend("mongodb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"tx_orders", "tx_stock"} {
+		repo, err := backend.DefineRepository(name, RepositoryDefinitionMap{"name": name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer repo.DeleteAll(nil)
+	}
+	txBackend := backend.(TransactionalBackend)
+	stock, _ := backend.GetRepository("tx_stock")
+	item, err := stock.Save(&TestEntry{Value: "in stock"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	itemID := item.(*TestEntry).ID
+
+	err = txBackend.Transact(context.Background(), func(tx Transaction) error {
+		orders, err := tx.GetRepository("tx_orders")
+		if err != nil {
+			return err
+		}
+		stock, err := tx.GetRepository("tx_stock")
+		if err != nil {
+			return err
+		}
+		if _, err := orders.Save(&TestEntry{Value: "order"}, nil); err != nil {
+			return err
+		}
+		_, err = stock.Save(&TestEntry{Value: "sold"}, NewFilter().Match("id", itemID))
+		return err
+	})
+	if IsErrorOfType(err, ErrNotSupported("")) {
+		t.Skip("MongoDB is not a replica set: ", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	orders, _ := backend.GetRepository("tx_orders")
+	if count, err := orders.Count(nil); err != nil || count != 1 {
+		t.Fatal("Expected the committed order. Got: ", count, err)
+	}
+
+	// the writes are discarded when the function fails
+	failed := errors.New("failed")
+	err = txBackend.Transact(context.Background(), func(tx Transaction) error {
+		orders, err := tx.GetRepository("tx_orders")
+		if err != nil {
+			return err
+		}
+		if _, err := orders.Save(&TestEntry{Value: "discarded"}, nil); err != nil {
+			return err
+		}
+		if count, err := orders.Count(nil); err != nil || count != 2 {
+			t.Error("Expected the transaction to see its own writes. Got: ", count, err)
+		}
+		return failed
+	})
+	if err != failed {
+		t.Fatal("Expected the error of the function. Got: ", err)
+	}
+	if count, err := orders.Count(nil); err != nil || count != 1 {
+		t.Fatal("Expected the discarded order not to be saved. Got: ", count, err)
+	}
+}
@@ -0,0 +1,215 @@
+package backends
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2"
+)
+
+// lookupMongoSRV and lookupMongoTXT resolve the DNS seed list of a mongodb+srv connection string.
+var (
+	lookupMongoSRV = net.LookupSRV
+	lookupMongoTXT = net.LookupTXT
+)
+
+// mongoIgnoredOptions are the options of the connection strings (set by MongoDB Atlas for example) that mgo has no
+// equivalent for. They are ignored without a warning.
+var mongoIgnoredOptions = map[string]bool{
+	"retrywrites": true,
+	"appname":     true,
+}
+
+// parseMongoURI returns the dial info of a MongoDB connection string:
+//
+//	mongodb://[username:password@]host1[:port1][,host2[:port2],...][/database][?options]
+//	mongodb+srv://[username:password@]host[/database][?options]
+//
+// The hosts of a mongodb+srv connection string are the targets of the SRV record _mongodb._tcp.<host>, and the TXT
+// record of the host may set the authSource and the replicaSet options. TLS is enabled by default for them.
+// The supported options are authSource, authMechanism, gssapiServiceName, replicaSet, tls (or ssl), tlsCAFile,
+// maxPoolSize, connectTimeoutMS, readPreference, w, wtimeoutMS, journal and connect=direct. The other options are
+// ignored, with a warning.
+func parseMongoURI(uri string) (*mgo.DialInfo, error) {
+	srv := strings.HasPrefix(uri, "mongodb+srv://")
+	rest := strings.TrimPrefix(strings.TrimPrefix(uri, "mongodb+srv://"), "mongodb://")
+	if rest == uri {
+		return nil, ErrBackendError("MongoDB connection string must start with mongodb:// or mongodb+srv://")
+	}
+
+	query := ""
+	if i := strings.Index(rest, "?"); i >= 0 {
+		rest, query = rest[:i], rest[i+1:]
+	}
+	info := &mgo.DialInfo{}
+	if i := strings.Index(rest, "/"); i >= 0 {
+		database, err := url.PathUnescape(rest[i+1:])
+		if err != nil {
+			return nil, ErrBackendError("invalid database of the MongoDB connection string: " + err.Error())
+		}
+		rest, info.Database = rest[:i], database
+	}
+	if i := strings.LastIndex(rest, "@"); i >= 0 {
+		credentials := strings.SplitN(rest[:i], ":", 2)
+		rest = rest[i+1:]
+		var err error
+		if info.Username, err = url.PathUnescape(credentials[0]); err != nil {
+			return nil, ErrBackendError("invalid username of the MongoDB connection string: " + err.Error())
+		}
+		if len(credentials) == 2 {
+			if info.Password, err = url.PathUnescape(credentials[1]); err != nil {
+				return nil, ErrBackendError("invalid password of the MongoDB connection string: " + err.Error())
+			}
+		}
+	}
+	for _, addr := range strings.Split(rest, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			info.Addrs = append(info.Addrs, addr)
+		}
+	}
+	if len(info.Addrs) == 0 {
+		return nil, ErrBackendError("MongoDB connection string has no hosts")
+	}
+
+	options := url.Values{}
+	useTLS := false
+	if srv {
+		if len(info.Addrs) != 1 || strings.Contains(info.Addrs[0], ":") {
+			return nil, ErrBackendError("mongodb+srv connection string must have a single host without a port")
+		}
+		addrs, txtOptions, err := resolveMongoSeedList(info.Addrs[0])
+		if err != nil {
+			return nil, err
+		}
+		info.Addrs = addrs
+		options = txtOptions
+		useTLS = true
+	}
+	uriOptions, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, ErrBackendError("invalid options of the MongoDB connection string: " + err.Error())
+	}
+	// the options of the connection string override the options of the TXT record
+	for key, values := range uriOptions {
+		options[key] = values
+	}
+
+	caFile := ""
+	for key := range options {
+		value := options.Get(key)
+		switch strings.ToLower(key) {
+		case "authsource":
+			info.Source = value
+		case "authmechanism":
+			info.Mechanism = value
+		case "gssapiservicename":
+			info.Service = value
+		case "replicaset":
+			info.ReplicaSetName = value
+		case "tls", "ssl":
+			if useTLS, err = strconv.ParseBool(value); err != nil {
+				return nil, ErrBackendError(fmt.Sprintf("invalid %s option of the MongoDB connection string: %s", key, value))
+			}
+		case "tlscafile":
+			caFile = value
+		case "maxpoolsize":
+			if info.PoolLimit, err = strconv.Atoi(value); err != nil {
+				return nil, ErrBackendError("invalid maxPoolSize option of the MongoDB connection string: " + value)
+			}
+		case "connecttimeoutms":
+			timeout, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, ErrBackendError("invalid connectTimeoutMS option of the MongoDB connection string: " + value)
+			}
+			info.Timeout = time.Duration(timeout) * time.Millisecond
+		case "connect":
+			info.Direct = value == "direct"
+		case "readpreference":
+			// the mode of the session, see mongoSessionMode
+			if _, err := mongoMode(value); err != nil {
+				return nil, err
+			}
+		case "w", "wtimeoutms", "journal":
+			// the write concern of the session, see mongoSessionWriteConcern
+			concernKey := map[string]string{"w": "w", "wtimeoutms": "wtimeout", "journal": "j"}[strings.ToLower(key)]
+			if _, err := mongoSafe(map[string]interface{}{concernKey: value}); err != nil {
+				return nil, err
+			}
+		default:
+			if !mongoIgnoredOptions[strings.ToLower(key)] {
+				log.Printf("WARN: MongoDB connection string option %s is not supported and is ignored", key)
+			}
+		}
+	}
+
+	if caFile != "" {
+		useTLS = true
+	}
+	if useTLS {
+		tlsConfig := &tls.Config{}
+		if caFile != "" {
+			if tlsConfig, err = documentDBTLSConfig(caFile); err != nil {
+				return nil, err
+			}
+		}
+		info.DialServer = func(addr *mgo.ServerAddr) (net.Conn, error) {
+			return tls.Dial("tcp", addr.String(), tlsConfig)
+		}
+	}
+	return info, nil
+}
+
+// resolveMongoSeedList returns the hosts of the SRV record of the mongodb+srv host, and the options of its TXT
+// record. The hosts must be in the domain of the host (the host without its first label).
+func resolveMongoSeedList(host string) ([]string, url.Values, error) {
+	if strings.Count(host, ".") < 2 {
+		return nil, nil, ErrBackendError("mongodb+srv host must have at least three parts (host.domain.tld): " + host)
+	}
+	domain := host[strings.Index(host, "."):]
+
+	_, records, err := lookupMongoSRV("mongodb", "tcp", host)
+	if err != nil {
+		return nil, nil, ErrBackendError("failed to resolve the MongoDB seed list: " + err.Error())
+	}
+	if len(records) == 0 {
+		return nil, nil, ErrBackendError("no MongoDB hosts in the SRV record of " + host)
+	}
+	addrs := []string{}
+	for _, record := range records {
+		target := strings.TrimSuffix(record.Target, ".")
+		if !strings.HasSuffix(target, domain) {
+			return nil, nil, ErrBackendError(fmt.Sprintf("MongoDB host %s is not in the domain of %s", target, host))
+		}
+		addrs = append(addrs, net.JoinHostPort(target, strconv.Itoa(int(record.Port))))
+	}
+
+	options := url.Values{}
+	txt, err := lookupMongoTXT(host)
+	if err != nil {
+		// a host without a TXT record has no options
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			return addrs, options, nil
+		}
+		return nil, nil, ErrBackendError("failed to resolve the MongoDB options: " + err.Error())
+	}
+	if len(txt) > 1 {
+		return nil, nil, ErrBackendError("multiple TXT records for the MongoDB host " + host)
+	}
+	if len(txt) == 1 {
+		if options, err = url.ParseQuery(txt[0]); err != nil {
+			return nil, nil, ErrBackendError("invalid TXT record of the MongoDB host: " + err.Error())
+		}
+		for key := range options {
+			if key != "authSource" && key != "replicaSet" {
+				return nil, nil, ErrBackendError("unsupported option in the TXT record of the MongoDB host: " + key)
+			}
+		}
+	}
+	return addrs, options, nil
+}
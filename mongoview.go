@@ -0,0 +1,216 @@
+package backends
+
+import (
+	"fmt"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// MongoViewDefinition is implemented by the repository definitions of the repositories backed by a MongoDB view.
+// RepositoryDefinitionMap implements it with the "view" property, with the "on" collection (or view) and the
+// aggregation "pipeline" ([]bson.M or []map[string]interface{}) of the view:
+//
+//	activeUsers, err := backend.DefineRepository("active_users", backends.RepositoryDefinitionMap{
+//		"name": "active_users",
+//		"view": map[string]interface{}{
+//			"on":       "users",
+//			"pipeline": []bson.M{{"$match": bson.M{"status": "active"}}, {"$project": bson.M{"password": 0}}},
+//		},
+//	})
+type MongoViewDefinition interface {
+	GetView() map[string]interface{}
+}
+
+// MongoView is a read-only repository backed by a MongoDB view. The view is computed from its pipeline when it is
+// read, so it always reflects the source collection. The reads are the reads of a MongoCollection, and the writes
+// return ErrReadOnly.
+type MongoView struct {
+	collection *MongoCollection
+}
+
+// mongoViewSpec is the source and the pipeline of a view.
+type mongoViewSpec struct {
+	source   string
+	pipeline []bson.M
+}
+
+// GetView returns the source and the pipeline of the view that backs the repository - MongoDB specific.
+func (m RepositoryDefinitionMap) GetView() map[string]interface{} {
+	if view, ok := m["view"]; ok {
+		return view.(map[string]interface{})
+	}
+
+	return nil
+}
+
+// repositoryMongoView returns the view of the repository, or nil if the repository is not backed by a view. The view
+// can't have the options of the collections.
+func repositoryMongoView(repoDef RepositoryDefinition) (*mongoViewSpec, error) {
+	viewDef, ok := repoDef.(MongoViewDefinition)
+	if !ok || viewDef.GetView() == nil {
+		return nil, nil
+	}
+
+	view := &mongoViewSpec{}
+	for key, value := range viewDef.GetView() {
+		var ok bool
+		switch key {
+		case "on":
+			view.source, ok = value.(string)
+		case "pipeline":
+			switch stages := value.(type) {
+			case []bson.M:
+				view.pipeline, ok = stages, true
+			case []map[string]interface{}:
+				for _, stage := range stages {
+					view.pipeline = append(view.pipeline, bson.M(stage))
+				}
+				ok = true
+			}
+		default:
+			return nil, ErrBackendError(fmt.Sprintf("unknown view property %s", key))
+		}
+		if !ok {
+			return nil, ErrBackendError(fmt.Sprintf("invalid view %s: %v", key, value))
+		}
+	}
+	if view.source == "" {
+		return nil, ErrBackendError("source collection of the view is missing and required")
+	}
+	if view.pipeline == nil {
+		view.pipeline = []bson.M{}
+	}
+
+	if len(repoDef.GetIndexes()) > 0 || repoDef.EnableTTL() {
+		return nil, ErrBackendError("view can't have indexes or a TTL")
+	}
+	if collationDef, ok := repoDef.(CollationDefinition); ok && collationDef.GetCollation() != nil {
+		return nil, ErrBackendError("view can't have the collation of a collection")
+	}
+	if cappedDef, ok := repoDef.(CappedDefinition); ok && cappedDef.GetCapped() != nil {
+		return nil, ErrBackendError("view can't be capped")
+	}
+	if textIndexDef, ok := repoDef.(TextIndexDefinition); ok && textIndexDef.GetTextIndex() != nil {
+		return nil, ErrBackendError("view can't have a text index")
+	}
+	if schemaDef, ok := repoDef.(DataSchemaDefinition); ok && schemaDef.GetDataSchema() != nil {
+		return nil, ErrBackendError("view can't have a data schema, its records are not written")
+	}
+	return view, nil
+}
+
+// ensureMongoView creates the view, or updates the source and the pipeline of an existing view. Returns an error if
+// a collection with the name of the view exists.
+func ensureMongoView(database *mgo.Database, name string, view *mongoViewSpec) error {
+	result := struct {
+		Cursor struct {
+			FirstBatch []struct {
+				Type string `bson:"type"`
+			} `bson:"firstBatch"`
+		} `bson:"cursor"`
+	}{}
+	err := database.Run(bson.D{
+		{Name: "listCollections", Value: 1},
+		{Name: "filter", Value: bson.M{"name": name}},
+	}, &result)
+	if err != nil {
+		return ErrBackendError(err)
+	}
+
+	if len(result.Cursor.FirstBatch) == 0 {
+		err := database.Run(bson.D{
+			{Name: "create", Value: name},
+			{Name: "viewOn", Value: view.source},
+			{Name: "pipeline", Value: view.pipeline},
+		}, nil)
+		// 48: NamespaceExists, the view was created concurrently
+		if queryErr, ok := err.(*mgo.QueryError); err != nil && !(ok && queryErr.Code == 48) {
+			return ErrBackendError(err)
+		}
+		return nil
+	}
+
+	if result.Cursor.FirstBatch[0].Type != "view" {
+		return ErrBackendError(fmt.Sprintf("%s already exists and is not a view", name))
+	}
+	err = database.Run(bson.D{
+		{Name: "collMod", Value: name},
+		{Name: "viewOn", Value: view.source},
+		{Name: "pipeline", Value: view.pipeline},
+	}, nil)
+	if err != nil {
+		return ErrBackendError(err)
+	}
+	return nil
+}
+
+// GetOne fetches the first record of the view matched by the filter.
+func (v *MongoView) GetOne(filter Filter, result interface{}) (interface{}, error) {
+	return v.collection.GetOne(filter, result)
+}
+
+// GetAll fetches the records of the view matched by the filter.
+func (v *MongoView) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	return v.collection.GetAll(filter, resultsTypeHint, order, sorting, limit, offset)
+}
+
+// GetAllFields fetches the fields of the records of the view matched by the filter. See ProjectionRepository.
+func (v *MongoView) GetAllFields(filter Filter, resultsTypeHint interface{}, fields []string, order string, sorting string, limit int, offset int) (interface{}, error) {
+	return v.collection.GetAllFields(filter, resultsTypeHint, fields, order, sorting, limit, offset)
+}
+
+// GetAllCollated fetches the records of the view matched by the filter, with the collation. See CollatedQuerier.
+func (v *MongoView) GetAllCollated(collation *Collation, filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	return v.collection.GetAllCollated(collation, filter, resultsTypeHint, order, sorting, limit, offset)
+}
+
+// GetManyByIDs fetches the records of the view with the ids. See BatchGetRepository.
+func (v *MongoView) GetManyByIDs(ids []string, resultsTypeHint interface{}) (interface{}, error) {
+	return v.collection.GetManyByIDs(ids, resultsTypeHint)
+}
+
+// Count counts the records of the view matched by the filter.
+func (v *MongoView) Count(filter Filter) (int64, error) {
+	return v.collection.Count(filter)
+}
+
+// Exists checks whether the view has a record matched by the filter.
+func (v *MongoView) Exists(filter Filter) (bool, error) {
+	return v.collection.Exists(filter)
+}
+
+// RawQuery runs the find query or the aggregation pipeline on the view. See RawQuerier.
+func (v *MongoView) RawQuery(query interface{}, resultsTypeHint interface{}) (interface{}, error) {
+	return v.collection.RawQuery(query, resultsTypeHint)
+}
+
+// Save returns ErrReadOnly, the records of a view can't be written.
+func (v *MongoView) Save(object interface{}, filter Filter) (interface{}, error) {
+	return nil, v.readOnly()
+}
+
+// SaveAll returns ErrReadOnly, the records of a view can't be written.
+func (v *MongoView) SaveAll(objects interface{}) (interface{}, error) {
+	return nil, v.readOnly()
+}
+
+// UpdateAll returns ErrReadOnly, the records of a view can't be written.
+func (v *MongoView) UpdateAll(filter Filter, update interface{}) (int64, error) {
+	return 0, v.readOnly()
+}
+
+// DeleteOne returns ErrReadOnly, the records of a view can't be written.
+func (v *MongoView) DeleteOne(filter Filter) error {
+	return v.readOnly()
+}
+
+// DeleteAll returns ErrReadOnly, the records of a view can't be written.
+func (v *MongoView) DeleteAll(filter Filter) error {
+	return v.readOnly()
+}
+
+// readOnly returns the error of the writes.
+func (v *MongoView) readOnly() error {
+	return ErrReadOnly(fmt.Sprintf("%s is a read-only view", v.collection.Name))
+}
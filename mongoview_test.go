@@ -0,0 +1,129 @@
+package backends
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestRepositoryMongoView(t *testing.T) {
+	view, err := repositoryMongoView(RepositoryDefinitionMap{
+		"name": "active_users",
+		"view": map[string]interface{}{
+			"on":       "users",
+			"pipeline": []map[string]interface{}{{"$match": map[string]interface{}{"status": "active"}}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if view.source != "users" || !reflect.DeepEqual(view.pipeline, []bson.M{{"$match": map[string]interface{}{"status": "active"}}}) {
+		t.Fatal("Expected the view of the definition. Got: ", view)
+	}
+
+	if view, err := repositoryMongoView(RepositoryDefinitionMap{"name": "users"}); err != nil || view != nil {
+		t.Fatal("Expected no view. Got: ", view, err)
+	}
+	view, err = repositoryMongoView(RepositoryDefinitionMap{"view": map[string]interface{}{"on": "users"}})
+	if err != nil || view.pipeline == nil || len(view.pipeline) != 0 {
+		t.Fatal("Expected an empty pipeline. Got: ", view, err)
+	}
+
+	onUsers := map[string]interface{}{"on": "users"}
+	for _, def := range []RepositoryDefinitionMap{
+		{"view": map[string]interface{}{"pipeline": []bson.M{}}},
+		{"view": map[string]interface{}{"on": "users", "pipeline": bson.M{"$match": bson.M{}}}},
+		{"view": map[string]interface{}{"on": "users", "collation": "de"}},
+		{"view": onUsers, "indexes": []Index{NewNonUniqueIndex("email")}},
+		{"view": onUsers, "enableTtl": true, "ttl": 60, "ttlAttribute": "createdAt"},
+		{"view": onUsers, "collation": map[string]interface{}{"locale": "de"}},
+		{"view": onUsers, "capped": map[string]interface{}{"maxBytes": 4096}},
+		{"view": onUsers, "textIndex": map[string]interface{}{"fields": []string{"name"}}},
+		RepositoryDefinitionMap{"view": onUsers}.WithDataSchema(&DataSchema{Type: SchemaObject}),
+	} {
+		if _, err := repositoryMongoView(def); err == nil {
+			t.Fatal("Expected an error for the view definition ", def)
+		}
+	}
+}
+
+func TestMongoViewReadOnly(t *testing.T) {
+	view := &MongoView{collection: &MongoCollection{Collection: &mgo.Collection{Name: "active_users"}}}
+	if _, err := view.Save(&TestEntry{Value: "new"}, nil); !IsErrReadOnly(err) {
+		t.Fatal("Expected ErrReadOnly from Save. Got: ", err)
+	}
+	if _, err := view.SaveAll([]*TestEntry{{Value: "new"}}); !IsErrReadOnly(err) {
+		t.Fatal("Expected ErrReadOnly from SaveAll. Got: ", err)
+	}
+	if _, err := view.UpdateAll(nil, &TestEntry{Value: "new"}); !IsErrReadOnly(err) {
+		t.Fatal("Expected ErrReadOnly from UpdateAll. Got: ", err)
+	}
+	if err := view.DeleteOne(NewFilter().Match("value", "new")); !IsErrReadOnly(err) {
+		t.Fatal("Expected ErrReadOnly from DeleteOne. Got: ", err)
+	}
+	if err := view.DeleteAll(nil); !IsErrReadOnly(err) {
+		t.Fatal("Expected ErrReadOnly from DeleteAll. Got: ", err)
+	}
+	var _ ProjectionRepository = view
+	var _ RawQuerier = view
+}
+
+func TestMongoView(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode.")
+	}
+
+	bm := NewBackendSupport(map[string]*config.DBInfo{
+		"mongodb": &config.DBInfo{
+			DatabaseName: "testdb",
+			Host:         "localhost:27017",
+			Username:     "testuser",
+			Password:     "testpass",
+		},
+	})
+	backend, err := bm.GetBackend("mongodb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := backend.DefineRepository("view_entries", RepositoryDefinitionMap{"name": "view_entries"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer entries.DeleteAll(nil)
+	for _, value := range []string{"kept", "kept", "hidden"} {
+		if _, err := entries.Save(&TestEntry{Value: value}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	view, err := backend.DefineRepository("kept_entries", RepositoryDefinitionMap{
+		"name": "kept_entries",
+		"view": map[string]interface{}{
+			"on":       "view_entries",
+			"pipeline": []bson.M{{"$match": bson.M{"value": "kept"}}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer view.(*MongoView).collection.DropCollection()
+
+	if count, err := view.Count(nil); err != nil || count != 2 {
+		t.Fatal("Expected the records matched by the pipeline. Got: ", count, err)
+	}
+	results, err := view.GetAll(nil, &TestEntry{}, "", "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range *results.(*[]*TestEntry) {
+		if entry.Value != "kept" || entry.ID == "" {
+			t.Fatal("Unexpected record of the view: ", entry)
+		}
+	}
+	if _, err := view.Save(&TestEntry{Value: "kept"}, nil); !IsErrReadOnly(err) {
+		t.Fatal("Expected ErrReadOnly from Save. Got: ", err)
+	}
+}
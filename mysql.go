@@ -0,0 +1,94 @@
+package backends
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+// MySQLDialect is the SQLDialect of MySQL (5.7 or newer) and MariaDB, for the "mysql" driver (github.com/go-sql-driver/mysql).
+// Note that the MySQL upsert updates the existing row on a conflict on any unique index, not only on the key.
+type MySQLDialect struct{}
+
+// DataSourceName returns the data source name user:pass@tcp(host)/database.
+// If the host is already a data source name (contains "@" or "/"), it is used as is.
+func (MySQLDialect) DataSourceName(conf *config.DBInfo) (string, error) {
+	if strings.Contains(conf.Host, "@") || strings.Contains(conf.Host, "/") {
+		return conf.Host, nil
+	}
+	if conf.Host == "" {
+		return "", ErrBackendError("mysql host is missing from config")
+	}
+	if conf.DatabaseName == "" {
+		return "", ErrBackendError("database name is missing and required")
+	}
+
+	credentials := ""
+	if conf.Username != "" {
+		credentials = conf.Username
+		if conf.Password != "" {
+			credentials += ":" + conf.Password
+		}
+		credentials += "@"
+	}
+	return fmt.Sprintf("%stcp(%s)/%s", credentials, conf.Host, conf.DatabaseName), nil
+}
+
+// Quote quotes the identifier with backticks.
+func (MySQLDialect) Quote(identifier string) string {
+	return "`" + strings.Replace(identifier, "`", "``", -1) + "`"
+}
+
+// Placeholder returns ?.
+func (MySQLDialect) Placeholder(n int) string {
+	return "?"
+}
+
+// CreateTable returns the CREATE TABLE statement, with the indexes defined within the table
+// (MySQL has no CREATE INDEX IF NOT EXISTS).
+func (d MySQLDialect) CreateTable(table *SQLTable) []string {
+	dataType := "LONGTEXT"
+	if table.Binary {
+		dataType = "LONGBLOB"
+	}
+	definitions := []string{
+		fmt.Sprintf("%s VARCHAR(255) NOT NULL PRIMARY KEY", d.Quote(table.KeyColumn)),
+		fmt.Sprintf("%s %s NOT NULL", d.Quote(table.DataColumn), dataType),
+	}
+	for _, index := range table.Indexes {
+		definitions = append(definitions, fmt.Sprintf("%s VARCHAR(255)", d.Quote(index.Column)))
+	}
+	for _, index := range table.Indexes {
+		unique := ""
+		if index.Unique {
+			unique = "UNIQUE "
+		}
+		definitions = append(definitions, fmt.Sprintf("%sINDEX %s (%s)", unique, d.Quote(index.Name), d.Quote(index.Column)))
+	}
+	return []string{
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s) DEFAULT CHARSET=utf8mb4", d.Quote(table.Name), strings.Join(definitions, ", ")),
+	}
+}
+
+// Upsert returns INSERT ... ON DUPLICATE KEY UPDATE.
+func (d MySQLDialect) Upsert(table *SQLTable) string {
+	columns := table.Columns()
+	quoted := []string{}
+	placeholders := []string{}
+	updates := []string{}
+	for i, column := range columns {
+		quoted = append(quoted, d.Quote(column))
+		placeholders = append(placeholders, d.Placeholder(i+1))
+		if column != table.KeyColumn {
+			updates = append(updates, fmt.Sprintf("%s = VALUES(%s)", d.Quote(column), d.Quote(column)))
+		}
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON DUPLICATE KEY UPDATE %s",
+		d.Quote(table.Name), strings.Join(quoted, ", "), strings.Join(placeholders, ", "), strings.Join(updates, ", "))
+}
+
+// IsUniqueViolation returns true for the duplicate entry (1062) errors.
+func (MySQLDialect) IsUniqueViolation(err error) bool {
+	return strings.Contains(err.Error(), "Error 1062") || strings.Contains(err.Error(), "Duplicate entry")
+}
@@ -0,0 +1,39 @@
+package backends
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func TestMySQLDialect(t *testing.T) {
+	dialect := MySQLDialect{}
+
+	dsn, err := dialect.DataSourceName(&config.DBInfo{Host: "localhost:3306", DatabaseName: "users", Username: "user", Password: "pass"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dsn != "user:pass@tcp(localhost:3306)/users" {
+		t.Fatal("Unexpected data source name", dsn)
+	}
+
+	expected := []string{
+		"CREATE TABLE IF NOT EXISTS `users` (`id` VARCHAR(255) NOT NULL PRIMARY KEY, `data` LONGTEXT NOT NULL, `idx_email` VARCHAR(255), UNIQUE INDEX `users_email` (`idx_email`)) DEFAULT CHARSET=utf8mb4",
+	}
+	if statements := dialect.CreateTable(sqlTestTable); !reflect.DeepEqual(statements, expected) {
+		t.Fatal("Unexpected statements", statements)
+	}
+
+	binary := *sqlTestTable
+	binary.Binary = true
+	if statements := dialect.CreateTable(&binary); !strings.Contains(statements[0], "`data` LONGBLOB NOT NULL") {
+		t.Fatal("Unexpected statements for a binary table", statements)
+	}
+
+	upsert := "INSERT INTO `users` (`id`, `data`, `idx_email`) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE `data` = VALUES(`data`), `idx_email` = VALUES(`idx_email`)"
+	if statement := dialect.Upsert(sqlTestTable); statement != upsert {
+		t.Fatal("Unexpected upsert", statement)
+	}
+}
@@ -0,0 +1,481 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Microkubes/microservice-tools/config"
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	"github.com/satori/go.uuid"
+)
+
+// NEO4J_CTX_KEY is Neo4j context key
+var NEO4J_CTX_KEY = "NEO4J_DRIVER"
+
+// Neo4jRepository is a repository of Neo4j nodes. Each repository is a node label, and each record is a node
+// with the record properties. The nodes are identified by the "id" property.
+// Neo4j supports only primitive property values (and arrays of primitive values), so nested objects cannot be stored.
+type Neo4jRepository struct {
+	driver   neo4j.Driver
+	database string
+	label    string
+	repoDef  RepositoryDefinition
+}
+
+// CypherQuery is a Cypher WHERE clause with its parameters. The clause refers to the node as "n", for example:
+//
+//	WHERE n[$p0] = $v0
+type CypherQuery struct {
+	Where  string
+	Params map[string]interface{}
+}
+
+// CypherQueryTranslator translates filters into Cypher WHERE clauses (*CypherQuery).
+type CypherQueryTranslator struct{}
+
+// Translate translates the filter AST into Cypher WHERE clause.
+func (t *CypherQueryTranslator) Translate(ast *FilterAST) (interface{}, error) {
+	query := &CypherQuery{
+		Params: map[string]interface{}{},
+	}
+	conditions := []string{}
+
+	for i, cond := range ast.Conditions {
+		property := fmt.Sprintf("p%d", i)
+		value := fmt.Sprintf("v%d", i)
+		query.Params[property] = cond.Property
+
+		switch cond.Operator {
+		case OpEq:
+			conditions = append(conditions, fmt.Sprintf("n[$%s] = $%s", property, value))
+			query.Params[value] = cond.Value
+		case OpPattern:
+			conditions = append(conditions, fmt.Sprintf("n[$%s] =~ $%s", property, value))
+			query.Params[value] = toMongoPattern(cond.Value.(string))
+		case OpRegex:
+			// Cypher regular expressions must match the whole value, like in Java.
+			conditions = append(conditions, fmt.Sprintf("n[$%s] =~ $%s", property, value))
+			query.Params[value] = cond.Value
+		case OpNe:
+			// comparisons with a missing property are null, and null is not matched
+			conditions = append(conditions, fmt.Sprintf("(n[$%s] IS NULL OR n[$%s] <> $%s)", property, property, value))
+			query.Params[value] = cond.Value
+		case OpGt, OpGte, OpLt, OpLte:
+			conditions = append(conditions, fmt.Sprintf("n[$%s] %s $%s", property, comparisonOperators[cond.Operator], value))
+			query.Params[value] = cond.Value
+		case OpIn:
+			conditions = append(conditions, fmt.Sprintf("n[$%s] IN $%s", property, value))
+			query.Params[value] = cond.Value
+		case OpExists, OpNull:
+			// Neo4j does not store null properties, so a null property is a missing one
+			if cond.Value.(bool) == (cond.Operator == OpExists) {
+				conditions = append(conditions, fmt.Sprintf("n[$%s] IS NOT NULL", property))
+			} else {
+				conditions = append(conditions, fmt.Sprintf("n[$%s] IS NULL", property))
+			}
+		case OpNin:
+			conditions = append(conditions, fmt.Sprintf("(n[$%s] IS NULL OR NOT n[$%s] IN $%s)", property, property, value))
+			query.Params[value] = cond.Value
+		default:
+			return nil, ErrInvalidInput(fmt.Sprintf("operator %s is not supported by Neo4j backend", cond.Operator))
+		}
+	}
+
+	if len(conditions) > 0 {
+		query.Where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	return query, nil
+}
+
+var cypherQueryTranslator = &CypherQueryTranslator{}
+
+// Neo4jRepoBuilder builds new Neo4j repository (node label) and creates the constraints and the indexes for it.
+func Neo4jRepoBuilder(repoDef RepositoryDefinition, backend Backend) (Repository, error) {
+
+	driverObj := backend.GetFromContext(NEO4J_CTX_KEY)
+	if driverObj == nil {
+		return nil, ErrBackendError("neo4j driver not configured")
+	}
+
+	driver, ok := driverObj.(neo4j.Driver)
+	if !ok {
+		return nil, ErrBackendError("unknown driver type")
+	}
+
+	labelName := repoDef.GetName()
+	if labelName == "" {
+		return nil, ErrBackendError("label name is missing and required")
+	}
+
+	if repoDef.EnableTTL() {
+		return nil, ErrBackendError("TTL is not supported by the neo4j backend")
+	}
+
+	repo := &Neo4jRepository{
+		driver:   driver,
+		database: backend.GetConfig().DatabaseName,
+		label:    cypherName(labelName),
+		repoDef:  repoDef,
+	}
+
+	statements := []string{
+		fmt.Sprintf("CREATE CONSTRAINT IF NOT EXISTS ON (n:%s) ASSERT n.id IS UNIQUE", repo.label),
+	}
+	for _, index := range repoDef.GetIndexes() {
+		fields := []string{}
+		for _, field := range index.GetFields() {
+			fields = append(fields, "n."+cypherName(field))
+		}
+		if index.Unique() {
+			if len(fields) != 1 {
+				return nil, ErrBackendError("neo4j supports only single property unique indexes")
+			}
+			statements = append(statements, fmt.Sprintf("CREATE CONSTRAINT IF NOT EXISTS ON (n:%s) ASSERT %s IS UNIQUE", repo.label, fields[0]))
+			continue
+		}
+		statements = append(statements, fmt.Sprintf("CREATE INDEX IF NOT EXISTS FOR (n:%s) ON (%s)", repo.label, strings.Join(fields, ", ")))
+	}
+
+	for _, statement := range statements {
+		if _, err := repo.run(statement, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return repo, nil
+}
+
+// Neo4jBackendBuilder returns RepositoriesBackend.
+// The host is the Neo4j URI (for example neo4j://neo4j:7687). If no scheme is given, "neo4j://" is used.
+func Neo4jBackendBuilder(conf *config.DBInfo, manager BackendManager) (Backend, error) {
+
+	target := conf.Host
+	if !strings.Contains(target, "://") {
+		target = "neo4j://" + target
+	}
+
+	auth := neo4j.NoAuth()
+	if conf.Username != "" {
+		auth = neo4j.BasicAuth(conf.Username, conf.Password, "")
+	}
+
+	driver, err := neo4j.NewDriver(target, auth)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.WithValue(context.Background(), NEO4J_CTX_KEY, driver)
+	cleanup := func() {
+		driver.Close()
+	}
+
+	return NewRepositoriesBackend(ctx, conf, Neo4jRepoBuilder, cleanup), nil
+}
+
+// GetOne fetches only one node for given filter
+func (r *Neo4jRepository) GetOne(filter Filter, result interface{}) (interface{}, error) {
+	records, err := r.match(filter, "", "", 1, 0, "RETURN properties(n) AS n", nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrNotFound("record not found")
+	}
+
+	err = MapToInterface(&records[0], &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetAll fetches all matched nodes for given filter.
+// Sorting by nested properties is not supported, because the nodes cannot have nested properties.
+func (r *Neo4jRepository) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	if strings.Contains(order, ".") {
+		return nil, ErrNotSupported(fmt.Sprintf("sorting by nested property %s is not supported by neo4j backend", order))
+	}
+	records, err := r.match(filter, order, sorting, limit, offset, "RETURN properties(n) AS n", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return recordsToResults(records, resultsTypeHint)
+}
+
+// Count returns the number of records that match the filter.
+func (r *Neo4jRepository) Count(filter Filter) (int64, error) {
+	rows, err := r.match(filter, "", "", 0, 0, "RETURN count(n) AS total", nil)
+	if err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	total, ok := rows[0]["total"].(int64)
+	if !ok {
+		return 0, ErrBackendError(fmt.Sprintf("unexpected count result %v", rows[0]))
+	}
+	return total, nil
+}
+
+// Exists reports whether a record matches the filter. Only the id of the first matching node is returned.
+func (r *Neo4jRepository) Exists(filter Filter) (bool, error) {
+	rows, err := r.match(filter, "", "", 1, 0, "RETURN id(n) AS key", nil)
+	if err != nil {
+		return false, err
+	}
+	return len(rows) > 0, nil
+}
+
+// Save creates new node unless it does not exist, otherwise it updates the node properties.
+// New nodes are merged on the "id" property, so ErrAlreadyExists is returned if a node with the same id exists.
+func (r *Neo4jRepository) Save(object interface{}, filter Filter) (interface{}, error) {
+
+	var result interface{}
+
+	payload, err := InterfaceToMap(object)
+	if err != nil {
+		return nil, err
+	}
+
+	props, err := toNeo4jProperties(*payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var node interface{}
+
+	if filter == nil {
+		if id, ok := props["id"]; !ok || id == nil || id == "" {
+			id, err := uuid.NewV4()
+			if err != nil {
+				return nil, err
+			}
+			props["id"] = id.String()
+		}
+
+		records, err := r.run(fmt.Sprintf(
+			"MERGE (n:%s {id: $id}) ON CREATE SET n += $props, n._created = true "+
+				"WITH n, coalesce(n._created, false) AS created REMOVE n._created "+
+				"RETURN properties(n) AS n, created", r.label),
+			map[string]interface{}{
+				"id":    props["id"],
+				"props": props,
+			})
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == 0 || records[0]["created"] != true {
+			return nil, ErrAlreadyExists("record already exists!")
+		}
+		node = records[0]["n"]
+	} else {
+		// the id is immutable
+		delete(props, "id")
+
+		records, err := r.match(filter, "", "", 1, 0, "SET n += $props RETURN properties(n) AS n", map[string]interface{}{
+			"props": props,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == 0 {
+			return nil, ErrNotFound("record not found")
+		}
+		node = records[0]
+	}
+
+	err = MapToInterface(&node, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// SaveAll creates the objects (a slice) as new nodes, one by one. Returns the created nodes, as returned by Save.
+// The nodes created before a failure are not removed.
+func (r *Neo4jRepository) SaveAll(objects interface{}) (interface{}, error) {
+	records, err := objectsToRecords(objects)
+	if err != nil {
+		return nil, err
+	}
+	return saveEach(records, r.Save)
+}
+
+// UpdateAll sets the properties of the update on all matched nodes for given filter, with a single query.
+// Returns the number of the updated nodes.
+func (r *Neo4jRepository) UpdateAll(filter Filter, update interface{}) (int64, error) {
+	payload, err := InterfaceToMap(update)
+	if err != nil {
+		return 0, err
+	}
+	props, err := toNeo4jProperties(*payload)
+	if err != nil {
+		return 0, err
+	}
+	// the id is immutable
+	delete(props, "id")
+
+	rows, err := r.match(filter, "", "", 0, 0, "SET n += $props RETURN count(n) AS updated", map[string]interface{}{
+		"props": props,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	updated, ok := rows[0]["updated"].(int64)
+	if !ok {
+		return 0, ErrBackendError(fmt.Sprintf("unexpected update result %v", rows[0]))
+	}
+	return updated, nil
+}
+
+// DeleteOne deletes only one node (and its relationships) for given filter
+func (r *Neo4jRepository) DeleteOne(filter Filter) error {
+	records, err := r.match(filter, "", "", 1, 0, "DETACH DELETE n RETURN count(*) AS deleted", nil)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 || records[0]["deleted"] == int64(0) {
+		return ErrNotFound("record not found")
+	}
+	return nil
+}
+
+// DeleteAll deletes all matched nodes (and their relationships) for given filter
+func (r *Neo4jRepository) DeleteAll(filter Filter) error {
+	_, err := r.match(filter, "", "", 0, 0, "DETACH DELETE n", nil)
+	return err
+}
+
+// match runs a MATCH query on the repository nodes that match the filter. The given operation (for example
+// "RETURN properties(n) AS n") is appended to the query. If the operation returns "n", the records
+// returned are the values of "n", otherwise the records are the returned rows.
+func (r *Neo4jRepository) match(filter Filter, order string, sorting string, limit int, offset int, operation string, params map[string]interface{}) ([]map[string]interface{}, error) {
+	translated, err := TranslateFilter(filter, cypherQueryTranslator)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+	query := translated.(*CypherQuery)
+
+	for k, v := range params {
+		query.Params[k] = v
+	}
+
+	cypher := []string{fmt.Sprintf("MATCH (n:%s)", r.label)}
+	if query.Where != "" {
+		cypher = append(cypher, query.Where)
+	}
+	cypher = append(cypher, "WITH n")
+	if order != "" {
+		direction := "ASC"
+		if sorting == "desc" {
+			direction = "DESC"
+		}
+		cypher = append(cypher, "ORDER BY n[$order] "+direction)
+		query.Params["order"] = order
+	}
+	if offset != 0 {
+		cypher = append(cypher, "SKIP $offset")
+		query.Params["offset"] = offset
+	}
+	if limit != 0 {
+		cypher = append(cypher, "LIMIT $limit")
+		query.Params["limit"] = limit
+	}
+	cypher = append(cypher, operation)
+
+	rows, err := r.run(strings.Join(cypher, " "), query.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasSuffix(operation, " AS n") {
+		return rows, nil
+	}
+
+	records := []map[string]interface{}{}
+	for _, row := range rows {
+		if node, ok := row["n"].(map[string]interface{}); ok {
+			records = append(records, node)
+		}
+	}
+	return records, nil
+}
+
+// run runs the Cypher statement in an auto-commit transaction and returns the result rows.
+func (r *Neo4jRepository) run(cypher string, params map[string]interface{}) ([]map[string]interface{}, error) {
+	session := r.driver.NewSession(neo4j.SessionConfig{
+		AccessMode:   neo4j.AccessModeWrite,
+		DatabaseName: r.database,
+	})
+	defer session.Close()
+
+	result, err := session.Run(cypher, params)
+	if err != nil {
+		return nil, toNeo4jError(err)
+	}
+
+	rows := []map[string]interface{}{}
+	for result.Next() {
+		record := result.Record()
+		row := map[string]interface{}{}
+		for _, key := range record.Keys {
+			row[key], _ = record.Get(key)
+		}
+		rows = append(rows, row)
+	}
+	if err := result.Err(); err != nil {
+		return nil, toNeo4jError(err)
+	}
+
+	return rows, nil
+}
+
+// toNeo4jError maps the constraint violations to ErrAlreadyExists.
+func toNeo4jError(err error) error {
+	if strings.Contains(err.Error(), "ConstraintValidationFailed") {
+		return ErrAlreadyExists(err)
+	}
+	return err
+}
+
+// toNeo4jProperties converts the payload to node properties. Neo4j supports only primitive
+// values and arrays of primitive values as properties.
+func toNeo4jProperties(payload map[string]interface{}) (map[string]interface{}, error) {
+	normalized, err := normalizeValue(payload)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+
+	props := map[string]interface{}{}
+	for key, value := range normalized.(map[string]interface{}) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			return nil, ErrInvalidInput(fmt.Sprintf("property %s: nested objects are not supported by neo4j backend", key))
+		case []interface{}:
+			for _, item := range v {
+				switch item.(type) {
+				case map[string]interface{}, []interface{}:
+					return nil, ErrInvalidInput(fmt.Sprintf("property %s: only arrays of primitive values are supported by neo4j backend", key))
+				}
+			}
+		}
+		if value != nil {
+			props[key] = value
+		}
+	}
+	return props, nil
+}
+
+// cypherName escapes a label or a property name to be used in Cypher query.
+func cypherName(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
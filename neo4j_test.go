@@ -0,0 +1,68 @@
+package backends
+
+import (
+	"testing"
+)
+
+func TestCypherQueryTranslator(t *testing.T) {
+	translated, err := TranslateFilter(NewFilter().MatchPattern("name", "%doe").Match("role", "user"), cypherQueryTranslator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := translated.(*CypherQuery)
+
+	if query.Where != "WHERE n[$p0] =~ $v0 AND n[$p1] = $v1" {
+		t.Fatal("Invalid WHERE clause. Got: ", query.Where)
+	}
+	if query.Params["p0"] != "name" || query.Params["v0"] != ".*doe$" || query.Params["p1"] != "role" || query.Params["v1"] != "user" {
+		t.Fatal("Invalid parameters. Got: ", query.Params)
+	}
+}
+
+func TestCypherQueryTranslatorComparisons(t *testing.T) {
+	translated, err := TranslateFilter(Filter{"age": map[string]interface{}{OpLt: 65, OpNe: 30}}, cypherQueryTranslator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := translated.(*CypherQuery)
+
+	if query.Where != "WHERE n[$p0] < $v0 AND (n[$p1] IS NULL OR n[$p1] <> $v1)" {
+		t.Fatal("Invalid WHERE clause. Got: ", query.Where)
+	}
+}
+
+func TestCypherName(t *testing.T) {
+	if name := cypherName("user`s"); name != "`user``s`" {
+		t.Fatal("Expected the name to be escaped. Got: ", name)
+	}
+}
+
+func TestToNeo4jProperties(t *testing.T) {
+	props, err := toNeo4jProperties(map[string]interface{}{
+		"name":  "John",
+		"age":   30,
+		"roles": []string{"admin", "user"},
+		"note":  nil,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(props) != 3 || props["age"] != float64(30) {
+		t.Fatal("Invalid properties. Got: ", props)
+	}
+
+	if _, err := toNeo4jProperties(map[string]interface{}{
+		"address": map[string]interface{}{"city": "Skopje"},
+	}); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input for nested object. Got: ", err)
+	}
+}
+
+func TestNeo4jGetAllNestedOrder(t *testing.T) {
+	repo := &Neo4jRepository{label: cypherName("users")}
+
+	_, err := repo.GetAll(nil, &map[string]interface{}{}, "profile.lastName", "asc", 0, 0)
+	if err == nil || err.Error() != "not supported" {
+		t.Fatal("Expected not supported error. Got: ", err)
+	}
+}
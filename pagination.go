@@ -0,0 +1,121 @@
+package backends
+
+import "fmt"
+
+// Pagination holds the limit, the offset and the selected fields for fetching multiple records.
+// Unlike the limit and offset arguments of Repository.GetAll, where 0 means "no limit" and "no offset",
+// Pagination makes the difference between "no limit" and a limit of zero records explicit.
+type Pagination struct {
+	limit     int
+	unlimited bool
+	offset    int
+	fields    []string
+}
+
+// PageOption configures the Pagination.
+type PageOption func(p *Pagination) error
+
+// Limit sets the maximal number of records to be returned. Limit(0) returns no records at all.
+func Limit(n int) PageOption {
+	return func(p *Pagination) error {
+		if n < 0 {
+			return ErrInvalidInput(fmt.Sprintf("limit must not be negative, got %d", n))
+		}
+		p.limit = n
+		p.unlimited = false
+		return nil
+	}
+}
+
+// NoLimit returns all matched records. This is the default.
+func NoLimit() PageOption {
+	return func(p *Pagination) error {
+		p.limit = 0
+		p.unlimited = true
+		return nil
+	}
+}
+
+// Offset sets the number of matched records to be skipped.
+func Offset(n int) PageOption {
+	return func(p *Pagination) error {
+		if n < 0 {
+			return ErrInvalidInput(fmt.Sprintf("offset must not be negative, got %d", n))
+		}
+		p.offset = n
+		return nil
+	}
+}
+
+// WithFields selects the fields of the records to be fetched. By default all fields are fetched.
+// The fields of embedded documents are given as paths (for example "profile.lastName").
+func WithFields(fields ...string) PageOption {
+	return func(p *Pagination) error {
+		for _, field := range fields {
+			if field == "" {
+				return ErrInvalidInput("field name must not be empty")
+			}
+		}
+		p.fields = fields
+		return nil
+	}
+}
+
+// NewPagination creates new Pagination with the given options. Without options, all records are returned.
+func NewPagination(opts ...PageOption) (*Pagination, error) {
+	p := &Pagination{
+		unlimited: true,
+	}
+	for _, opt := range opts {
+		if err := opt(p); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// GetLimit returns the limit and whether the limit is set at all.
+func (p *Pagination) GetLimit() (int, bool) {
+	return p.limit, !p.unlimited
+}
+
+// GetOffset returns the number of records to be skipped.
+func (p *Pagination) GetOffset() int {
+	return p.offset
+}
+
+// GetFields returns the selected fields, or nil if all fields are fetched.
+func (p *Pagination) GetFields() []string {
+	return p.fields
+}
+
+// Empty reports whether the pagination selects no records at all (the limit is zero).
+func (p *Pagination) Empty() bool {
+	return !p.unlimited && p.limit == 0
+}
+
+// GetPage fetches the matched records from the repository, with limit, offset and the selected fields given as
+// typed options. For example:
+//
+//	results, err := backends.GetPage(repo, filter, &User{}, "name", "asc", backends.Limit(20), backends.Offset(40))
+//	results, err := backends.GetPage(repo, filter, &User{}, "", "", backends.WithFields("id", "email"))
+//
+// If the limit is zero, an empty result is returned without querying the repository.
+// Prefer GetPage over calling Repository.GetAll directly, so a request for zero records is never
+// interpreted as a request for all records.
+func GetPage(repo Repository, filter Filter, resultsTypeHint interface{}, order string, sorting string, opts ...PageOption) (interface{}, error) {
+	pagination, err := NewPagination(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if pagination.Empty() {
+		return recordsToResults(nil, resultsTypeHint)
+	}
+
+	limit, _ := pagination.GetLimit()
+	if fields := pagination.GetFields(); len(fields) > 0 {
+		return GetAllFields(repo, filter, resultsTypeHint, fields, order, sorting, limit, pagination.GetOffset())
+	}
+	return repo.GetAll(filter, resultsTypeHint, order, sorting, limit, pagination.GetOffset())
+}
@@ -0,0 +1,56 @@
+package backends
+
+import (
+	"testing"
+)
+
+func TestGetPage(t *testing.T) {
+	repo := newTestRepository()
+	for _, id := range []string{"1", "2", "3"} {
+		if _, err := repo.Save(map[string]interface{}{"id": id}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := GetPage(repo, nil, map[string]interface{}{}, "id", "asc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*results.(*[]*map[string]interface{})) != 3 {
+		t.Fatal("Expected all records without options. Got: ", results)
+	}
+
+	results, err = GetPage(repo, nil, map[string]interface{}{}, "id", "asc", Limit(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*results.(*[]*map[string]interface{})) != 0 {
+		t.Fatal("Expected no records with Limit(0). Got: ", results)
+	}
+
+	results, err = GetPage(repo, nil, map[string]interface{}{}, "id", "asc", Limit(1), Offset(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := *results.(*[]*map[string]interface{})
+	if len(page) != 1 || (*page[0])["id"] != "2" {
+		t.Fatal("Expected the second record. Got: ", page)
+	}
+
+	if _, err = GetPage(repo, nil, map[string]interface{}{}, "", "", Limit(-1)); err == nil {
+		t.Fatal("Expected error for negative limit")
+	}
+}
+
+func TestNewPagination(t *testing.T) {
+	p, err := NewPagination(Limit(10), NoLimit(), Offset(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, limited := p.GetLimit(); limited {
+		t.Fatal("Expected NoLimit to override the limit")
+	}
+	if p.GetOffset() != 5 || p.Empty() {
+		t.Fatal("Invalid pagination: ", p)
+	}
+}
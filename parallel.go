@@ -0,0 +1,103 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// DefaultParallelism is the maximal number of functions run concurrently by Parallel.
+const DefaultParallelism = 4
+
+// ParallelFunc is a function run by Parallel, typically a read from a repository.
+// The function should give up when the context is done.
+type ParallelFunc func(ctx context.Context) error
+
+// ParallelError is returned by Parallel when one or more functions fail.
+// Errors has an entry for every function, in the order the functions were given. The entry is nil
+// if the function succeeded.
+type ParallelError struct {
+	Errors []error
+}
+
+// Error returns the messages of all errors.
+func (e *ParallelError) Error() string {
+	messages := []string{}
+	for i, err := range e.Errors {
+		if err != nil {
+			messages = append(messages, fmt.Sprintf("#%d: %s", i, err.Error()))
+		}
+	}
+	return fmt.Sprintf("%d of %d parallel operations failed: %s", len(messages), len(e.Errors), strings.Join(messages, "; "))
+}
+
+// Parallel runs the functions concurrently, at most DefaultParallelism at the time, and waits for all of them to complete.
+// It is meant for hydrating a response from multiple repositories at once:
+//
+//	var user User
+//	var orders []*Order
+//	err := backends.Parallel(ctx,
+//		func(ctx context.Context) error {
+//			_, err := userRepo.GetOne(backends.NewFilter().Match("id", userID), &user)
+//			return err
+//		},
+//		func(ctx context.Context) error {
+//			results, err := ordersRepo.GetAll(backends.NewFilter().Match("userId", userID), &Order{}, "", "", 0, 0)
+//			if err == nil {
+//				orders = *results.(*[]*Order)
+//			}
+//			return err
+//		},
+//	)
+//
+// A failing function does not stop the others. If any function fails, *ParallelError is returned.
+// The functions that have not been started when the context is done are not run at all; they fail with the context error.
+func Parallel(ctx context.Context, fns ...ParallelFunc) error {
+	return ParallelN(ctx, DefaultParallelism, fns...)
+}
+
+// ParallelN runs the functions like Parallel, with at most maxConcurrent functions running at the same time.
+func ParallelN(ctx context.Context, maxConcurrent int, fns ...ParallelFunc) error {
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+
+	errs := make([]error, len(fns))
+	slots := make(chan struct{}, maxConcurrent)
+	wg := &sync.WaitGroup{}
+
+	for i, fn := range fns {
+		if err := ctx.Err(); err != nil {
+			errs[i] = err
+			continue
+		}
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			errs[i] = ctx.Err()
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, fn ParallelFunc) {
+			defer func() {
+				if r := recover(); r != nil {
+					errs[i] = ErrBackendError(fmt.Sprintf("panic: %v", r))
+				}
+				<-slots
+				wg.Done()
+			}()
+			errs[i] = fn(ctx)
+		}(i, fn)
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return &ParallelError{Errors: errs}
+		}
+	}
+	return nil
+}
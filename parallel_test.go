@@ -0,0 +1,86 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParallel(t *testing.T) {
+	mutex := &sync.Mutex{}
+	running := 0
+	maxRunning := 0
+
+	fns := []ParallelFunc{}
+	for i := 0; i < 10; i++ {
+		fns = append(fns, func(ctx context.Context) error {
+			mutex.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mutex.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mutex.Lock()
+			running--
+			mutex.Unlock()
+			return nil
+		})
+	}
+
+	if err := ParallelN(context.Background(), 3, fns...); err != nil {
+		t.Fatal(err)
+	}
+	if maxRunning > 3 {
+		t.Fatal("Expected at most 3 concurrent functions. Got: ", maxRunning)
+	}
+}
+
+func TestParallelAggregatesErrors(t *testing.T) {
+	completed := make([]bool, 3)
+	err := Parallel(context.Background(),
+		func(ctx context.Context) error {
+			return fmt.Errorf("first failed")
+		},
+		func(ctx context.Context) error {
+			completed[1] = true
+			return nil
+		},
+		func(ctx context.Context) error {
+			return ErrNotFound("third")
+		},
+	)
+
+	parallelErr, ok := err.(*ParallelError)
+	if !ok {
+		t.Fatal("Expected ParallelError. Got: ", err)
+	}
+	if parallelErr.Errors[0] == nil || parallelErr.Errors[1] != nil || parallelErr.Errors[2] == nil {
+		t.Fatal("Expected errors of the first and the third function. Got: ", parallelErr.Errors)
+	}
+	if !completed[1] {
+		t.Fatal("Expected the second function to complete")
+	}
+}
+
+func TestParallelCancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	called := false
+	err := Parallel(ctx, func(ctx context.Context) error {
+		called = true
+		return nil
+	})
+	parallelErr, ok := err.(*ParallelError)
+	if !ok || parallelErr.Errors[0] != context.Canceled {
+		t.Fatal("Expected context error. Got: ", err)
+	}
+	if called {
+		t.Fatal("Expected the function not to be run")
+	}
+}
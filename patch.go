@@ -0,0 +1,71 @@
+package backends
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PatchRepository is implemented by the repositories that remove fields from a stored record: MongoDB ($unset),
+// DynamoDB (REMOVE), the cache and the SQL backends.
+type PatchRepository interface {
+	Patch(filter Filter, set interface{}, unset []string) (interface{}, error)
+}
+
+// Patch updates the first record matched by the filter: the properties of set are set (as with Save), and the unset
+// fields are removed from the record. The fields of embedded documents are given as paths ("address.zip"). Returns
+// the updated record, or ErrNotFound if no record matches the filter:
+//
+//	user, err := backends.Patch(userRepo, backends.NewFilter().Match("id", id), &map[string]interface{}{
+//		"status": "verified",
+//	}, []string{"verificationCode", "verificationExpires"})
+//
+// The id can not be removed, and a field can not be both set and removed. Save can only set the fields, so the
+// repositories that do not implement PatchRepository (including the wrappers) return ErrNotSupported if there are
+// fields to remove.
+func Patch(repo Repository, filter Filter, set interface{}, unset []string) (interface{}, error) {
+	if len(filter) == 0 {
+		return nil, ErrInvalidInput("filter is required")
+	}
+
+	payload := map[string]interface{}{}
+	if set != nil {
+		setMap, err := InterfaceToMap(set)
+		if err != nil {
+			return nil, err
+		}
+		payload = *setMap
+	}
+	for _, field := range unset {
+		if field == "" || field == "id" {
+			return nil, ErrInvalidInput(fmt.Sprintf("field %q can not be removed", field))
+		}
+		for property := range payload {
+			if field == property || strings.HasPrefix(field, property+".") || strings.HasPrefix(property, field+".") {
+				return nil, ErrInvalidInput(fmt.Sprintf("field %s is both set and removed", field))
+			}
+		}
+	}
+
+	var patchRepo PatchRepository
+	if AsRepository(repo, &patchRepo) {
+		return patchRepo.Patch(filter, &payload, unset)
+	}
+	if len(unset) > 0 {
+		return nil, ErrNotSupported("repository can not remove fields")
+	}
+	return repo.Save(&payload, filter)
+}
+
+// removeRecordPath removes the field given as a path ("address.zip") from the record. Does nothing if the record has
+// no such field.
+func removeRecordPath(record map[string]interface{}, path string) {
+	segments := strings.Split(path, ".")
+	for _, segment := range segments[:len(segments)-1] {
+		nested, ok := record[segment].(map[string]interface{})
+		if !ok {
+			return
+		}
+		record = nested
+	}
+	delete(record, segments[len(segments)-1])
+}
@@ -0,0 +1,80 @@
+package backends
+
+import (
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func TestPatch(t *testing.T) {
+	backend, err := CacheBackendBuilder(&config.DBInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Shutdown()
+
+	repo, err := backend.DefineRepository("users", RepositoryDefinitionMap{"name": "users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Save(&map[string]interface{}{
+		"id":               "john",
+		"status":           "pending",
+		"verificationCode": "1234",
+		"address":          map[string]interface{}{"city": "Skopje", "zip": "1000"},
+	}, nil); err != nil {
+		t.Fatal(err)
+	}
+	user := NewFilter().Match("id", "john")
+
+	result, err := Patch(repo, user, &map[string]interface{}{"status": "verified"}, []string{"verificationCode", "address.zip"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	patched := result.(map[string]interface{})
+	if patched["status"] != "verified" {
+		t.Fatal("Expected the status to be set. Got: ", patched)
+	}
+	if _, ok := patched["verificationCode"]; ok {
+		t.Fatal("Expected the verification code to be removed. Got: ", patched)
+	}
+	address := patched["address"].(map[string]interface{})
+	if _, ok := address["zip"]; ok || address["city"] != "Skopje" {
+		t.Fatal("Expected only the zip to be removed from the address. Got: ", address)
+	}
+
+	stored, err := repo.GetOne(NewFilter().Match("id", "john"), &map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := (*stored.(*map[string]interface{}))["verificationCode"]; ok {
+		t.Fatal("Expected the verification code to be removed from the stored record. Got: ", stored)
+	}
+
+	if _, err := Patch(repo, NewFilter().Match("id", "jane"), nil, []string{"status"}); err == nil || !IsErrNotFound(err) {
+		t.Fatal("Expected not found error. Got: ", err)
+	}
+	if _, err := Patch(repo, user, nil, []string{"id"}); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input error for removing the id. Got: ", err)
+	}
+	if _, err := Patch(repo, user, &map[string]interface{}{"address": map[string]interface{}{}}, []string{"address.city"}); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input error for a field both set and removed. Got: ", err)
+	}
+	if _, err := Patch(repo, NewFilter(), nil, []string{"status"}); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input error for an empty filter. Got: ", err)
+	}
+}
+
+func TestPatchNotSupported(t *testing.T) {
+	repo := newTestRepository()
+	if _, err := repo.Save(&map[string]interface{}{"id": "john", "status": "pending"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Patch(repo, NewFilter().Match("id", "john"), &map[string]interface{}{"status": "verified"}, []string{"code"}); err == nil || !IsErrorOfType(err, ErrNotSupported("")) {
+		t.Fatal("Expected not supported error for removing fields. Got: ", err)
+	}
+	if _, err := Patch(repo, NewFilter().Match("id", "john"), &map[string]interface{}{"status": "verified"}, nil); err != nil {
+		t.Fatal("Expected the fields to be set with Save. Got: ", err)
+	}
+}
@@ -0,0 +1,73 @@
+package backends
+
+import "strings"
+
+// ProjectionRepository is implemented by the repositories that fetch only the selected fields of the records
+// natively, so the other fields are not transferred: MongoDB (projections) and DynamoDB (projection expressions).
+type ProjectionRepository interface {
+	GetAllFields(filter Filter, resultsTypeHint interface{}, fields []string, order string, sorting string, limit int, offset int) (interface{}, error)
+}
+
+// GetAllFields fetches all matched records for given filter, with only the selected fields. If the repository
+// implements ProjectionRepository, the fields are selected by the backend. Otherwise the whole records are fetched
+// and the other fields are dropped. The key of the records may be returned even if it is not selected.
+// The wrappers (HookedRepository, ACLRepository etc) do not implement ProjectionRepository, so the fields
+// are selected after the records are fetched.
+func GetAllFields(repo Repository, filter Filter, resultsTypeHint interface{}, fields []string, order string, sorting string, limit int, offset int) (interface{}, error) {
+	if len(fields) == 0 {
+		return repo.GetAll(filter, resultsTypeHint, order, sorting, limit, offset)
+	}
+	var projectionRepo ProjectionRepository
+	if AsRepository(repo, &projectionRepo) {
+		return projectionRepo.GetAllFields(filter, resultsTypeHint, fields, order, sorting, limit, offset)
+	}
+
+	results, err := repo.GetAll(filter, &map[string]interface{}{}, order, sorting, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	records, err := syncRecords(results)
+	if err != nil {
+		return nil, err
+	}
+	projected := make([]map[string]interface{}, 0, len(records))
+	for _, record := range records {
+		projected = append(projected, projectRecord(record, fields))
+	}
+
+	if resultsTypeHint == nil {
+		resultsTypeHint = &map[string]interface{}{}
+	}
+	return recordsToResults(projected, resultsTypeHint)
+}
+
+// projectRecord returns a copy of the record with only the selected fields. The fields of embedded documents are
+// given as paths ("profile.lastName").
+func projectRecord(record map[string]interface{}, fields []string) map[string]interface{} {
+	projected := map[string]interface{}{}
+	for _, field := range fields {
+		path := strings.Split(field, ".")
+		source := record
+		target := projected
+		for i, segment := range path {
+			value, ok := source[segment]
+			if !ok {
+				break
+			}
+			if i == len(path)-1 {
+				target[segment] = value
+				break
+			}
+			nested, ok := value.(map[string]interface{})
+			if !ok {
+				break
+			}
+			if _, ok := target[segment].(map[string]interface{}); !ok {
+				target[segment] = map[string]interface{}{}
+			}
+			source = nested
+			target = target[segment].(map[string]interface{})
+		}
+	}
+	return projected
+}
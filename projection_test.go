@@ -0,0 +1,39 @@
+package backends
+
+import "testing"
+
+func TestGetAllFields(t *testing.T) {
+	repo := newTestRepository()
+	users := []map[string]interface{}{
+		{"id": "1", "email": "alice@example.com", "password": "x", "profile": map[string]interface{}{"name": "Alice", "age": 30}},
+		{"id": "2", "email": "bob@example.com", "password": "y"},
+	}
+	for _, user := range users {
+		if _, err := repo.Save(user, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := GetPage(repo, nil, nil, "id", "asc", WithFields("id", "email", "profile.name"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := *results.(*[]*map[string]interface{})
+	if len(list) != 2 {
+		t.Fatal("Expected 2 records. Got: ", list)
+	}
+	alice := *list[0]
+	if len(alice) != 3 || alice["email"] != "alice@example.com" || alice["password"] != nil {
+		t.Fatal("Expected only the selected fields. Got: ", alice)
+	}
+	if profile := alice["profile"].(map[string]interface{}); len(profile) != 1 || profile["name"] != "Alice" {
+		t.Fatal("Expected only the name of the profile. Got: ", profile)
+	}
+	if bob := *list[1]; len(bob) != 2 || bob["profile"] != nil {
+		t.Fatal("Expected the missing fields to be skipped. Got: ", bob)
+	}
+
+	if _, err := GetPage(repo, nil, nil, "", "", WithFields("id", "")); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input error for an empty field. Got: ", err)
+	}
+}
@@ -0,0 +1,253 @@
+package backends
+
+import (
+	"fmt"
+)
+
+// QueryBuilder composes a Filter with comparisons, with the order and the page of the results:
+//
+//	users, err := backends.Query().
+//		Where("age").Gt(18).
+//		And().Where("status").In("active", "invited").
+//		OrderBy("createdAt").
+//		Limit(20).
+//		GetAll(userRepo, &User{})
+//
+// The conditions are joined with AND. The filter is compiled to the native query of the backend by its
+// QueryTranslator, like any other Filter, so Build can be used to get the filter for the other repository methods.
+// The comparisons (Gt, Gte, Lt, Lte) compare numbers with numbers and strings with strings; the records without the
+// property are not matched, except by Ne, NotIn and Missing.
+type QueryBuilder struct {
+	conditions map[string]map[string]interface{}
+	property   string
+	order      string
+	sorting    string
+	limit      int
+	offset     int
+	collation  *Collation
+	err        error
+}
+
+// Query creates an empty QueryBuilder that matches all records.
+func Query() *QueryBuilder {
+	return &QueryBuilder{
+		conditions: map[string]map[string]interface{}{},
+	}
+}
+
+// Where selects the property of the next condition.
+func (q *QueryBuilder) Where(property string) *QueryBuilder {
+	if property == "" {
+		q.fail(ErrInvalidInput("property of the query condition must not be empty"))
+	}
+	q.property = property
+	return q
+}
+
+// And is a no-op that keeps the chain readable. The conditions are always joined with AND.
+func (q *QueryBuilder) And() *QueryBuilder {
+	return q
+}
+
+// Eq matches the records whose property equals the value.
+func (q *QueryBuilder) Eq(value interface{}) *QueryBuilder {
+	return q.condition(OpEq, value)
+}
+
+// Ne matches the records whose property does not equal the value, or that don't have the property.
+func (q *QueryBuilder) Ne(value interface{}) *QueryBuilder {
+	return q.condition(OpNe, value)
+}
+
+// Gt matches the records whose property is greater than the value.
+func (q *QueryBuilder) Gt(value interface{}) *QueryBuilder {
+	return q.condition(OpGt, value)
+}
+
+// Gte matches the records whose property is greater than or equal to the value.
+func (q *QueryBuilder) Gte(value interface{}) *QueryBuilder {
+	return q.condition(OpGte, value)
+}
+
+// Lt matches the records whose property is less than the value.
+func (q *QueryBuilder) Lt(value interface{}) *QueryBuilder {
+	return q.condition(OpLt, value)
+}
+
+// Lte matches the records whose property is less than or equal to the value.
+func (q *QueryBuilder) Lte(value interface{}) *QueryBuilder {
+	return q.condition(OpLte, value)
+}
+
+// In matches the records whose property equals any of the values.
+func (q *QueryBuilder) In(values ...interface{}) *QueryBuilder {
+	return q.condition(OpIn, values)
+}
+
+// NotIn matches the records whose property equals none of the values, or that don't have the property.
+func (q *QueryBuilder) NotIn(values ...interface{}) *QueryBuilder {
+	return q.condition(OpNin, values)
+}
+
+// Exists matches the records that have the property, even if it is null.
+func (q *QueryBuilder) Exists() *QueryBuilder {
+	return q.condition(OpExists, true)
+}
+
+// Missing matches the records that don't have the property.
+func (q *QueryBuilder) Missing() *QueryBuilder {
+	return q.condition(OpExists, false)
+}
+
+// IsNull matches the records whose property is null.
+func (q *QueryBuilder) IsNull() *QueryBuilder {
+	return q.condition(OpNull, true)
+}
+
+// NotNull matches the records whose property is set to a value other than null.
+func (q *QueryBuilder) NotNull() *QueryBuilder {
+	return q.condition(OpNull, false)
+}
+
+// Like matches the records whose property matches the 'LIKE' pattern. See Filter.MatchPattern.
+func (q *QueryBuilder) Like(pattern string) *QueryBuilder {
+	return q.condition(OpPattern, pattern)
+}
+
+// Regex matches the records whose property matches the raw regular expression. See Filter.MatchRegex.
+func (q *QueryBuilder) Regex(regex string) *QueryBuilder {
+	return q.condition(OpRegex, regex)
+}
+
+// OrderBy orders the results by the property, ascending.
+func (q *QueryBuilder) OrderBy(property string) *QueryBuilder {
+	q.order = property
+	q.sorting = "asc"
+	return q
+}
+
+// OrderByDesc orders the results by the property, descending.
+func (q *QueryBuilder) OrderByDesc(property string) *QueryBuilder {
+	q.order = property
+	q.sorting = "desc"
+	return q
+}
+
+// Limit limits the number of the results. 0 means no limit.
+func (q *QueryBuilder) Limit(limit int) *QueryBuilder {
+	q.limit = limit
+	return q
+}
+
+// Offset skips the first results.
+func (q *QueryBuilder) Offset(offset int) *QueryBuilder {
+	q.offset = offset
+	return q
+}
+
+// Collation compares the strings of the query with the collation, both in the conditions and in the order. Only
+// GetAll runs the query with a collation, on the repositories that implement CollatedQuerier. nil removes the
+// collation.
+func (q *QueryBuilder) Collation(collation *Collation) *QueryBuilder {
+	if collation == nil {
+		q.collation = nil
+		return q
+	}
+	if err := collation.validate(); err != nil {
+		q.fail(err)
+	}
+	q.collation = collation
+	return q
+}
+
+// Build returns the filter of the query. Returns ErrInvalidInput if a condition is invalid.
+func (q *QueryBuilder) Build() (Filter, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+
+	filter := NewFilter()
+	for property, operators := range q.conditions {
+		if value, ok := operators[OpEq]; ok && len(operators) == 1 {
+			// plain values keep the key lookups of the backends
+			filter.Match(property, value)
+			continue
+		}
+		spec := map[string]interface{}{}
+		for operator, value := range operators {
+			spec[operator] = value
+		}
+		filter[property] = spec
+	}
+
+	if _, err := ParseFilter(filter); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// GetAll fetches the records matched by the query from the repository, ordered and paged.
+func (q *QueryBuilder) GetAll(repo Repository, resultsTypeHint interface{}) (interface{}, error) {
+	filter, err := q.Build()
+	if err != nil {
+		return nil, err
+	}
+	if q.collation != nil {
+		var collated CollatedQuerier
+		if !AsRepository(repo, &collated) {
+			return nil, ErrNotSupported("the repository does not run queries with a collation")
+		}
+		return collated.GetAllCollated(q.collation, filter, resultsTypeHint, q.order, q.sorting, q.limit, q.offset)
+	}
+	return repo.GetAll(filter, resultsTypeHint, q.order, q.sorting, q.limit, q.offset)
+}
+
+// GetOne fetches the first record matched by the query from the repository. The order and the page are ignored.
+func (q *QueryBuilder) GetOne(repo Repository, result interface{}) (interface{}, error) {
+	filter, err := q.Build()
+	if err != nil {
+		return nil, err
+	}
+	if q.collation != nil {
+		return nil, ErrInvalidInput("only GetAll runs the query with a collation")
+	}
+	return repo.GetOne(filter, result)
+}
+
+// Count counts the records matched by the query in the repository.
+func (q *QueryBuilder) Count(repo Repository) (int64, error) {
+	filter, err := q.Build()
+	if err != nil {
+		return 0, err
+	}
+	if q.collation != nil {
+		return 0, ErrInvalidInput("only GetAll runs the query with a collation")
+	}
+	return repo.Count(filter)
+}
+
+// condition adds the condition on the property selected with Where.
+func (q *QueryBuilder) condition(operator string, value interface{}) *QueryBuilder {
+	if q.property == "" {
+		q.fail(ErrInvalidInput(fmt.Sprintf("%s must follow Where", operator)))
+		return q
+	}
+	operators, ok := q.conditions[q.property]
+	if !ok {
+		operators = map[string]interface{}{}
+		q.conditions[q.property] = operators
+	}
+	if _, ok := operators[operator]; ok {
+		q.fail(ErrInvalidInput(fmt.Sprintf("%s is already set on property %s", operator, q.property)))
+		return q
+	}
+	operators[operator] = value
+	return q
+}
+
+// fail records the first error of the chain, returned by Build.
+func (q *QueryBuilder) fail(err error) {
+	if q.err == nil {
+		q.err = err
+	}
+}
@@ -0,0 +1,118 @@
+package backends
+
+import (
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func TestQueryBuilder(t *testing.T) {
+	filter, err := Query().Where("age").Gt(18).Lte(65).And().Where("status").In("active", "invited").And().Where("role").Eq("user").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter["role"] != "user" {
+		t.Fatal("Expected a plain match on role. Got: ", filter["role"])
+	}
+	age, ok := filter["age"].(map[string]interface{})
+	if !ok || age[OpGt] != 18 || age[OpLte] != 65 {
+		t.Fatal("Expected the range on age. Got: ", filter["age"])
+	}
+
+	if _, err := Query().Gt(18).Build(); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for a condition without Where. Got: ", err)
+	}
+	if _, err := Query().Where("age").Gt(18).Gt(21).Build(); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for a repeated operator. Got: ", err)
+	}
+	if _, err := Query().Where("status").In().Build(); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for an empty In. Got: ", err)
+	}
+}
+
+func TestQueryBuilderGetAll(t *testing.T) {
+	backend, err := CacheBackendBuilder(&config.DBInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Shutdown()
+
+	repo, err := backend.DefineRepository("users", RepositoryDefinitionMap{"name": "users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.SaveAll([]map[string]interface{}{
+		{"id": "1", "age": 17, "status": "active", "createdAt": 3},
+		{"id": "2", "age": 30, "status": "active", "createdAt": 2},
+		{"id": "3", "age": 42, "status": "invited", "createdAt": 1},
+		{"id": "4", "age": 50, "status": "suspended", "createdAt": 4},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := Query().Where("age").Gt(18).And().Where("status").In("active", "invited").OrderBy("createdAt").GetAll(repo, &map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := *results.(*[]*map[string]interface{})
+	if len(users) != 2 || (*users[0])["id"] != "3" || (*users[1])["id"] != "2" {
+		t.Fatal("Expected the adults that are active or invited, ordered by createdAt. Got: ", users)
+	}
+
+	count, err := Query().Where("status").Ne("active").Count(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Fatal("Expected 2 users that are not active. Got: ", count)
+	}
+
+	count, err = Query().Where("id").In("1", "3", "missing").And().Where("status").NotIn("invited").Count(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatal("Expected 1 user of the ids that is not invited. Got: ", count)
+	}
+}
+
+type collatedRepository struct {
+	Repository
+	collation *Collation
+}
+
+func (r *collatedRepository) GetAllCollated(collation *Collation, filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	r.collation = collation
+	return r.GetAll(filter, resultsTypeHint, order, sorting, limit, offset)
+}
+
+func TestQueryBuilderCollation(t *testing.T) {
+	backend, err := CacheBackendBuilder(&config.DBInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Shutdown()
+	repo, err := backend.DefineRepository("users", RepositoryDefinitionMap{"name": "users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	german := &Collation{Locale: "de", Strength: 1}
+	collated := &collatedRepository{Repository: repo}
+	if _, err := Query().Collation(german).OrderBy("lastName").GetAll(collated, &map[string]interface{}{}); err != nil {
+		t.Fatal(err)
+	}
+	if collated.collation != german {
+		t.Fatal("Expected the query to run with the collation. Got: ", collated.collation)
+	}
+
+	if _, err := Query().Collation(german).GetAll(repo, &map[string]interface{}{}); !IsErrorOfType(err, ErrNotSupported("")) {
+		t.Fatal("Expected ErrNotSupported without CollatedQuerier. Got: ", err)
+	}
+	if _, err := Query().Collation(german).Count(collated); !IsErrInvalidInput(err) {
+		t.Fatal("Expected only GetAll to run with a collation. Got: ", err)
+	}
+	if _, err := Query().Collation(&Collation{Strength: 2}).GetAll(collated, &map[string]interface{}{}); !IsErrInvalidInput(err) {
+		t.Fatal("Expected an error for a collation without a locale. Got: ", err)
+	}
+}
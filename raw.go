@@ -0,0 +1,25 @@
+package backends
+
+// RawQuerier is implemented by the repositories that run native queries, for the cases the Filter is not expressive
+// enough for (ranges, $or, JSON functions...):
+//
+//	var rq backends.RawQuerier
+//	if backends.AsRepository(repo, &rq) {
+//		users, err := rq.RawQuery(bson.M{"age": bson.M{"$gte": 18}}, &User{})
+//	}
+//
+// The query type depends on the backend:
+//
+//	MongoDB   bson.M (a find filter) or []bson.M (an aggregation pipeline)
+//	DynamoDB  *DynamoQuery (a filter expression of a scan) or *DynamoStatement (a PartiQL statement)
+//	ArangoDB  *ArangoQuery (AQL operations on the document "d", for example FILTER, SORT and LIMIT)
+//	SQL       *SQLQuery (a clause of the SELECT of the records, for example WHERE and ORDER BY)
+//
+// A query of another type is rejected with ErrInvalidInput. The raw queries bypass the semantics that the wrappers
+// add to a repository (hooks, ACLs, codecs, localization etc.), so the wrappers do not implement RawQuerier: run the
+// raw queries on the repository returned by the backend itself, found with AsRepository if it is defined with a model.
+type RawQuerier interface {
+	// RawQuery runs the native query and returns the records, as GetAll does. The records are returned as maps if
+	// the type hint is nil.
+	RawQuery(query interface{}, resultsTypeHint interface{}) (interface{}, error)
+}
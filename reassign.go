@@ -0,0 +1,127 @@
+package backends
+
+import "time"
+
+// ReassignOptions configures an owner re-assignment.
+type ReassignOptions struct {
+	// ACL sets the ACL property and the record key. Default is the ACLRepository defaults ("acl" and "id").
+	ACL *ACLOptions
+	// BatchSize is the number of records read at once. Default is 100.
+	BatchSize int
+	// Pause is the time to wait between the batches, so the re-assignment does not saturate the backend.
+	// Default is no pause.
+	Pause time.Duration
+	// Progress is called after each batch with the progress so far.
+	Progress func(progress ReassignProgress)
+	// DryRun counts the records that would be re-assigned, without changing them.
+	DryRun bool
+}
+
+// ReassignProgress is the progress of an owner re-assignment.
+type ReassignProgress struct {
+	// Scanned is the number of the records that matched the filter so far.
+	Scanned int
+	// Reassigned is the number of the records owned by the old owner that were transferred to the new owner.
+	Reassigned int
+	// Skipped is the number of the records with an invalid ACL.
+	Skipped int
+}
+
+// ReassignOwner transfers the ownership of the records that match the filter from oldOwner to newOwner, for example
+// when an employee leaves:
+//
+//	progress, err := backends.ReassignOwner(notesRepo, "alice", "bob", nil, &backends.ReassignOptions{
+//		Progress: func(p backends.ReassignProgress) {
+//			log.Printf("%d records scanned, %d reassigned", p.Scanned, p.Reassigned)
+//		},
+//	})
+//
+// In the ACL of every record, oldOwner is replaced with newOwner in the owners. The writers and the readers are not
+// changed. The records are read in batches with low priority (see WithPriority), ordered by the record key.
+// The re-assignment stops at the first error, and returns the progress so far with the error. It is safe to run it
+// again - the records that were already transferred are not changed.
+func ReassignOwner(repo Repository, oldOwner string, newOwner string, filter Filter, options *ReassignOptions) (*ReassignProgress, error) {
+	if oldOwner == "" || newOwner == "" {
+		return nil, ErrInvalidInput("both the old and the new owner are required")
+	}
+	if options == nil {
+		options = &ReassignOptions{}
+	}
+	aclOptions := withACLDefaults(options.ACL)
+	batchSize := options.BatchSize
+	if batchSize < 1 {
+		batchSize = 100
+	}
+
+	repo = WithPriority(repo, PriorityLow)
+	progress := &ReassignProgress{}
+
+	for offset := 0; ; offset += batchSize {
+		if offset > 0 && options.Pause > 0 {
+			time.Sleep(options.Pause)
+		}
+
+		results, err := repo.GetAll(filter, &map[string]interface{}{}, aclOptions.KeyProperty, "asc", batchSize, offset)
+		if err != nil {
+			return progress, err
+		}
+		records, err := syncRecords(results)
+		if err != nil {
+			return progress, err
+		}
+
+		for _, record := range records {
+			progress.Scanned++
+
+			acl, err := GetACL(record, aclOptions.Property)
+			if err != nil {
+				progress.Skipped++
+				continue
+			}
+			if acl == nil || !reassignOwners(acl, oldOwner, newOwner) {
+				continue
+			}
+
+			if !options.DryRun {
+				update := map[string]interface{}{}
+				if err := SetACL(update, aclOptions.Property, acl); err != nil {
+					return progress, err
+				}
+				key := NewFilter().Match(aclOptions.KeyProperty, record[aclOptions.KeyProperty])
+				if _, err := repo.Save(&update, key); err != nil {
+					return progress, err
+				}
+			}
+			progress.Reassigned++
+		}
+
+		if options.Progress != nil {
+			options.Progress(*progress)
+		}
+
+		if len(records) < batchSize {
+			return progress, nil
+		}
+	}
+}
+
+// reassignOwners replaces oldOwner with newOwner in the owners of the ACL.
+// Returns false if oldOwner is not an owner.
+func reassignOwners(acl *ACL, oldOwner string, newOwner string) bool {
+	found := false
+	owners := []string{}
+	for _, owner := range acl.Owners {
+		if owner == oldOwner {
+			found = true
+			continue
+		}
+		if owner != newOwner {
+			owners = append(owners, owner)
+		}
+	}
+	if !found {
+		return false
+	}
+	acl.Owners = append(owners, newOwner)
+	return true
+}
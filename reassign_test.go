@@ -0,0 +1,92 @@
+package backends
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReassignOwner(t *testing.T) {
+	repo, shutdown := newACLTestRepository(t)
+	defer shutdown()
+
+	for id, acl := range map[string]*ACL{
+		"1": {Owners: []string{"alice"}},
+		"2": {Owners: []string{"alice", "carol"}, Readers: []string{"alice"}},
+		"3": {Owners: []string{"carol"}},
+		"4": {Owners: []string{"alice", "bob"}},
+		"5": nil,
+	} {
+		record := map[string]interface{}{"id": id}
+		if acl != nil {
+			if err := SetACL(record, "acl", acl); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := repo.Save(&record, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := repo.Save(&map[string]interface{}{"id": "6", "acl": "invalid"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	dryRun, err := ReassignOwner(repo, "alice", "bob", nil, &ReassignOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dryRun.Reassigned != 3 {
+		t.Fatal("Expected 3 records to be reassigned in the dry run, got", dryRun.Reassigned)
+	}
+
+	reports := []ReassignProgress{}
+	progress, err := ReassignOwner(repo, "alice", "bob", nil, &ReassignOptions{
+		BatchSize: 4,
+		Progress: func(p ReassignProgress) {
+			reports = append(reports, p)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := ReassignProgress{Scanned: 6, Reassigned: 3, Skipped: 1}
+	if *progress != expected {
+		t.Fatal("Expected", expected, "got", *progress)
+	}
+	if len(reports) != 2 || reports[0].Scanned != 4 || reports[1] != expected {
+		t.Fatal("Expected progress reports after each batch, got", reports)
+	}
+
+	for id, owners := range map[string][]string{
+		"1": {"bob"},
+		"2": {"carol", "bob"},
+		"3": {"carol"},
+		"4": {"bob"},
+	} {
+		result, err := repo.GetOne(NewFilter().Match("id", id), &map[string]interface{}{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		acl, err := GetACL(*result.(*map[string]interface{}), "acl")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(acl.Owners, owners) {
+			t.Fatal("Expected owners", owners, "of record", id, "got", acl.Owners)
+		}
+		if id == "2" && !reflect.DeepEqual(acl.Readers, []string{"alice"}) {
+			t.Fatal("Expected the readers not to change, got", acl.Readers)
+		}
+	}
+
+	again, err := ReassignOwner(repo, "alice", "bob", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Reassigned != 0 {
+		t.Fatal("Expected no records to be reassigned again, got", again.Reassigned)
+	}
+
+	if _, err := ReassignOwner(repo, "", "bob", nil, nil); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input error, got", err)
+	}
+}
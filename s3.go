@@ -0,0 +1,585 @@
+package backends
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/Microkubes/microservice-tools/config"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/satori/go.uuid"
+)
+
+// S3_CTX_KEY is S3 context key
+var S3_CTX_KEY = "S3_SESSION"
+
+// s3DeleteBatchSize is the maximal number of objects deleted with one request.
+const s3DeleteBatchSize = 1000
+
+// s3ContentTypes are the content types of the objects, by codec.
+var s3ContentTypes = map[string]string{
+	CodecJSON:    "application/json",
+	CodecBSON:    "application/bson",
+	CodecMsgPack: "application/msgpack",
+}
+
+// S3API is the part of the S3 client (*s3.Client) used by the S3 repositories and the blob repositories.
+type S3API interface {
+	HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error)
+	CreateBucket(ctx context.Context, params *s3.CreateBucketInput, optFns ...func(*s3.Options)) (*s3.CreateBucketOutput, error)
+	GetBucketLifecycleConfiguration(ctx context.Context, params *s3.GetBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetBucketLifecycleConfigurationOutput, error)
+	PutBucketLifecycleConfiguration(ctx context.Context, params *s3.PutBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.PutBucketLifecycleConfigurationOutput, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error)
+	CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+}
+
+// S3Collection is a repository stored in an Amazon S3 bucket.
+// Every record is stored as an object with key <repository>/<hash key value>.<codec>, in the bucket named by the database name.
+// The records are encoded with the codec of the repository (JSON by default, see Codec).
+// The hash key of the repository definition is used as record key ("id" if not set).
+// GetAll lists all objects of the repository and filters them in memory, so S3 repositories are meant for
+// archival data that is mostly accessed by the key.
+// S3 has no conditional writes, so creating the same record concurrently is not detected.
+// TTL is mapped to a lifecycle expiration rule of the repository prefix. S3 expires the objects in days,
+// so the TTL is rounded up to whole days, counted from the last save of the record.
+type S3Collection struct {
+	client  S3API
+	bucket  string
+	prefix  string
+	codec   Codec
+	repoDef RepositoryDefinition
+}
+
+// s3Record is a decoded record together with its S3 key.
+type s3Record struct {
+	key   string
+	value map[string]interface{}
+}
+
+// S3RepoBuilder builds new S3 repository (key prefix).
+// If the bucket does not exist, builder will create it.
+// The context value may be an AWS config (aws.Config) or an S3 client (S3API).
+func S3RepoBuilder(repoDef RepositoryDefinition, backend Backend) (Repository, error) {
+
+	sessionObj := backend.GetFromContext(S3_CTX_KEY)
+	if sessionObj == nil {
+		return nil, ErrBackendError("s3 session not configured")
+	}
+
+	var client S3API
+	switch s := sessionObj.(type) {
+	case aws.Config:
+		client = newS3Client(s, "")
+	case S3API:
+		client = s
+	default:
+		return nil, ErrBackendError("unknown session type")
+	}
+
+	bucket := backend.GetConfig().DatabaseName
+	if bucket == "" {
+		return nil, ErrBackendError("database name is missing and required")
+	}
+
+	repositoryName := repoDef.GetName()
+	if repositoryName == "" {
+		return nil, ErrBackendError("repository name is missing and required")
+	}
+
+	codec, err := codecFor(repoDef)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := createBucket(client, bucket); err != nil {
+		return nil, err
+	}
+
+	prefix := repositoryName + "/"
+	if repoDef.EnableTTL() {
+		if err := setExpiration(client, bucket, repositoryName, prefix, repoDef.GetTTL()); err != nil {
+			return nil, err
+		}
+	}
+
+	return &S3Collection{
+		client:  client,
+		bucket:  bucket,
+		prefix:  prefix,
+		codec:   codec,
+		repoDef: repoDef,
+	}, nil
+}
+
+// S3BackendBuilder returns an S3Backend.
+// The AWS properties of the config (credentials, region and endpoint) are the same as for the DynamoDB backend.
+func S3BackendBuilder(dbInfo *config.DBInfo, manager BackendManager) (Backend, error) {
+
+	configAWS, err := newAWSConfig(dbInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewS3Backend(dbInfo, newS3Client(configAWS, dbInfo.AWSEndpoint)), nil
+}
+
+// newS3Client creates new S3 client from the AWS config, with the endpoint (unless it is empty).
+func newS3Client(configAWS aws.Config, endpoint string) *s3.Client {
+	return s3.NewFromConfig(configAWS, func(o *s3.Options) {
+		if endpoint != "" {
+			log.Println("Using AWS Endpoint: ", endpoint)
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+}
+
+// createBucket creates the bucket if it does not exist
+func createBucket(client S3API, bucket string) error {
+	_, err := client.HeadBucket(context.Background(), &s3.HeadBucketInput{
+		Bucket: aws.String(bucket),
+	})
+	if err == nil {
+		return nil
+	}
+	if !isS3NotFound(err) {
+		return err
+	}
+
+	_, err = client.CreateBucket(context.Background(), &s3.CreateBucketInput{
+		Bucket: aws.String(bucket),
+	})
+	if s3ErrorCode(err) == "BucketAlreadyOwnedByYou" {
+		return nil
+	}
+	return err
+}
+
+// setExpiration sets the lifecycle expiration rule for the repository prefix. The other rules of the bucket are kept.
+func setExpiration(client S3API, bucket string, repositoryName string, prefix string, ttl int) error {
+	if ttl <= 0 {
+		return ErrInvalidInput("TTL must be positive")
+	}
+
+	days := int32((ttl + 86399) / 86400)
+	ruleID := "backends-" + repositoryName
+	rule := types.LifecycleRule{
+		ID:     aws.String(ruleID),
+		Status: types.ExpirationStatusEnabled,
+		Filter: &types.LifecycleRuleFilter{
+			Prefix: aws.String(prefix),
+		},
+		Expiration: &types.LifecycleExpiration{
+			Days: aws.Int32(days),
+		},
+	}
+
+	rules := []types.LifecycleRule{}
+	current, err := client.GetBucketLifecycleConfiguration(context.Background(), &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		if s3ErrorCode(err) != "NoSuchLifecycleConfiguration" {
+			return err
+		}
+	} else {
+		for _, existing := range current.Rules {
+			if aws.ToString(existing.ID) == ruleID {
+				if existing.Expiration != nil && aws.ToInt32(existing.Expiration.Days) == days {
+					// already set
+					return nil
+				}
+				continue
+			}
+			rules = append(rules, existing)
+		}
+	}
+	rules = append(rules, rule)
+
+	_, err = client.PutBucketLifecycleConfiguration(context.Background(), &s3.PutBucketLifecycleConfigurationInput{
+		Bucket: aws.String(bucket),
+		LifecycleConfiguration: &types.BucketLifecycleConfiguration{
+			Rules: rules,
+		},
+	})
+	return err
+}
+
+// GetOne fetches only one record for given filter
+func (c *S3Collection) GetOne(filter Filter, result interface{}) (interface{}, error) {
+	records, err := c.find(filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrNotFound("record not found")
+	}
+
+	err = MapToInterface(&records[0].value, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetAll fetches all matched records for given filter
+func (c *S3Collection) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	records, err := c.find(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	values := []map[string]interface{}{}
+	for _, record := range records {
+		values = append(values, record.value)
+	}
+
+	values, err = filterRecords(values, nil, order, sorting, limit, offset)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+
+	return recordsToResults(values, resultsTypeHint)
+}
+
+// Count returns the number of records that match the filter.
+func (c *S3Collection) Count(filter Filter) (int64, error) {
+	records, err := c.find(filter)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(records)), nil
+}
+
+// Exists reports whether a record matches the filter.
+func (c *S3Collection) Exists(filter Filter) (bool, error) {
+	records, err := c.find(filter)
+	if err != nil {
+		return false, err
+	}
+	return len(records) > 0, nil
+}
+
+// Save creates new record unless it does not exist, otherwise it updates the record
+func (c *S3Collection) Save(object interface{}, filter Filter) (interface{}, error) {
+
+	var result interface{}
+
+	payload, err := InterfaceToMap(object)
+	if err != nil {
+		return nil, err
+	}
+
+	keyProperty := c.keyProperty()
+	var key string
+	record := map[string]interface{}{}
+
+	if filter == nil {
+		for k, v := range *payload {
+			record[k] = v
+		}
+		if id, ok := record[keyProperty]; !ok || id == nil || id == "" {
+			id, err := uuid.NewV4()
+			if err != nil {
+				return nil, err
+			}
+			record[keyProperty] = id.String()
+		}
+
+		key = c.key(record[keyProperty])
+		_, err := c.client.HeadObject(context.Background(), &s3.HeadObjectInput{
+			Bucket: aws.String(c.bucket),
+			Key:    aws.String(key),
+		})
+		if err == nil {
+			return nil, ErrAlreadyExists("record already exists!")
+		}
+		if !isS3NotFound(err) {
+			return nil, err
+		}
+	} else {
+		records, err := c.find(filter)
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == 0 {
+			return nil, ErrNotFound("record not found")
+		}
+
+		key = records[0].key
+		record = records[0].value
+		for k, v := range *payload {
+			if k == keyProperty {
+				// the key is immutable
+				continue
+			}
+			record[k] = v
+		}
+	}
+
+	if err := c.put(key, record); err != nil {
+		return nil, err
+	}
+
+	err = MapToInterface(&record, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// SaveAll creates the objects (a slice) as new records, one by one. Returns the created records, as returned by Save.
+// The records created before a failure are not removed.
+func (c *S3Collection) SaveAll(objects interface{}) (interface{}, error) {
+	records, err := objectsToRecords(objects)
+	if err != nil {
+		return nil, err
+	}
+	return saveEach(records, c.Save)
+}
+
+// UpdateAll updates all matched records for given filter with the properties of the update.
+// Returns the number of the updated records. The records are written one by one.
+func (c *S3Collection) UpdateAll(filter Filter, update interface{}) (int64, error) {
+	payload, err := InterfaceToMap(update)
+	if err != nil {
+		return 0, err
+	}
+
+	records, err := c.find(filter)
+	if err != nil {
+		return 0, err
+	}
+
+	keyProperty := c.keyProperty()
+	var updated int64
+	for _, record := range records {
+		for k, v := range *payload {
+			if k == keyProperty {
+				// the key is immutable
+				continue
+			}
+			record.value[k] = v
+		}
+		if err := c.put(record.key, record.value); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+	return updated, nil
+}
+
+// put encodes and writes the record to the object with the key.
+func (c *S3Collection) put(key string, record map[string]interface{}) error {
+	value, err := c.codec.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.client.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket:      aws.String(c.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(value),
+		ContentType: aws.String(s3ContentTypes[c.codec.Name()]),
+	})
+	return err
+}
+
+// DeleteOne deletes only one record for given filter
+func (c *S3Collection) DeleteOne(filter Filter) error {
+	records, err := c.find(filter)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return ErrNotFound("record not found")
+	}
+
+	_, err = c.client.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(records[0].key),
+	})
+	return err
+}
+
+// DeleteAll deletes all matched records for given filter
+func (c *S3Collection) DeleteAll(filter Filter) error {
+	keys := []string{}
+	if len(filter) == 0 {
+		var err error
+		keys, err = c.listKeys()
+		if err != nil {
+			return err
+		}
+	} else {
+		records, err := c.find(filter)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			keys = append(keys, record.key)
+		}
+	}
+
+	for start := 0; start < len(keys); start += s3DeleteBatchSize {
+		end := start + s3DeleteBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		objects := []types.ObjectIdentifier{}
+		for _, key := range keys[start:end] {
+			objects = append(objects, types.ObjectIdentifier{Key: aws.String(key)})
+		}
+
+		output, err := c.client.DeleteObjects(context.Background(), &s3.DeleteObjectsInput{
+			Bucket: aws.String(c.bucket),
+			Delete: &types.Delete{
+				Objects: objects,
+				Quiet:   aws.Bool(true),
+			},
+		})
+		if err != nil {
+			return err
+		}
+		if len(output.Errors) > 0 {
+			failed := output.Errors[0]
+			return ErrBackendError(fmt.Sprintf("failed to delete %s: %s", aws.ToString(failed.Key), aws.ToString(failed.Message)))
+		}
+	}
+
+	return nil
+}
+
+// keyProperty returns the name of the property used as record key - the hash key if set, otherwise "id".
+func (c *S3Collection) keyProperty() string {
+	if hashKey := c.repoDef.GetHashKey(); hashKey != "" {
+		return hashKey
+	}
+	return "id"
+}
+
+// key returns the S3 key for the record with the given key value.
+func (c *S3Collection) key(value interface{}) string {
+	return c.prefix + url.PathEscape(fmt.Sprintf("%v", value)) + "." + c.codec.Name()
+}
+
+// listKeys returns the keys of all records of the repository.
+func (c *S3Collection) listKeys() ([]string, error) {
+	keys := []string{}
+	paginator := s3.NewListObjectsV2Paginator(c.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(c.bucket),
+		Prefix: aws.String(c.prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range page.Contents {
+			key := aws.ToString(object.Key)
+			if strings.HasSuffix(key, "."+c.codec.Name()) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys, nil
+}
+
+// get fetches and decodes the record stored under the key. Returns nil if there is no such record.
+func (c *S3Collection) get(key string) (*s3Record, error) {
+	output, err := c.client.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if isS3NotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer output.Body.Close()
+
+	data, err := ioutil.ReadAll(output.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := c.codec.Unmarshal(data)
+	if err != nil {
+		return nil, ErrBackendError(err)
+	}
+
+	return &s3Record{
+		key:   key,
+		value: value,
+	}, nil
+}
+
+// find returns the records that match the filter.
+// If the filter has an exact match on the key property, only that object is fetched, otherwise
+// all objects under the repository prefix are fetched and matched in memory.
+func (c *S3Collection) find(filter Filter) ([]*s3Record, error) {
+	matcher, err := toRecordMatcher(filter)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+
+	var keys []string
+	if keyValue, ok := filter[c.keyProperty()]; ok && !isFilterSpec(keyValue) {
+		keys = []string{c.key(keyValue)}
+	} else {
+		keys, err = c.listKeys()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	records := []*s3Record{}
+	for _, key := range keys {
+		record, err := c.get(key)
+		if err != nil {
+			return nil, err
+		}
+		if record != nil && matcher(record.value) {
+			records = append(records, record)
+		}
+	}
+
+	return records, nil
+}
+
+// isS3NotFound returns true if the error means the object or the bucket does not exist.
+func isS3NotFound(err error) bool {
+	switch s3ErrorCode(err) {
+	case "NoSuchKey", "NoSuchBucket", "NotFound":
+		return true
+	}
+	return false
+}
+
+// s3ErrorCode returns the code of the S3 error, or "" if the error is not an error of the S3 API.
+func s3ErrorCode(err error) string {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return ""
+	}
+	return apiErr.ErrorCode()
+}
@@ -0,0 +1,343 @@
+package backends
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// fakeS3 is an in-memory S3 client with a single bucket.
+type fakeS3 struct {
+	S3API
+	mutex     sync.Mutex
+	bucket    string
+	objects   map[string][]byte
+	headers   map[string]*fakeS3Headers
+	uploads   map[string]*fakeS3Upload
+	lifecycle []types.LifecycleRule
+}
+
+// fakeS3Headers are the headers of an object.
+type fakeS3Headers struct {
+	contentType  *string
+	metadata     map[string]string
+	lastModified time.Time
+}
+
+// fakeS3Upload is a multipart upload in progress.
+type fakeS3Upload struct {
+	key     string
+	headers *fakeS3Headers
+	parts   map[int32][]byte
+}
+
+func newFakeS3Headers(contentType *string, metadata map[string]string) *fakeS3Headers {
+	// S3 returns the metadata keys canonicalized as HTTP headers
+	canonical := map[string]string{}
+	for key, value := range metadata {
+		canonical[http.CanonicalHeaderKey(key)] = value
+	}
+	return &fakeS3Headers{
+		contentType:  contentType,
+		metadata:     canonical,
+		lastModified: time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{
+		objects: map[string][]byte{},
+		headers: map[string]*fakeS3Headers{},
+		uploads: map[string]*fakeS3Upload{},
+	}
+}
+
+func (f *fakeS3) HeadBucket(ctx context.Context, input *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.bucket != aws.ToString(input.Bucket) {
+		return nil, &types.NotFound{}
+	}
+	return &s3.HeadBucketOutput{}, nil
+}
+
+func (f *fakeS3) CreateBucket(ctx context.Context, input *s3.CreateBucketInput, optFns ...func(*s3.Options)) (*s3.CreateBucketOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.bucket = aws.ToString(input.Bucket)
+	return &s3.CreateBucketOutput{}, nil
+}
+
+func (f *fakeS3) GetBucketLifecycleConfiguration(ctx context.Context, input *s3.GetBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetBucketLifecycleConfigurationOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.lifecycle == nil {
+		return nil, &smithy.GenericAPIError{Code: "NoSuchLifecycleConfiguration", Message: "no lifecycle"}
+	}
+	return &s3.GetBucketLifecycleConfigurationOutput{Rules: f.lifecycle}, nil
+}
+
+func (f *fakeS3) PutBucketLifecycleConfiguration(ctx context.Context, input *s3.PutBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.PutBucketLifecycleConfigurationOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.lifecycle = input.LifecycleConfiguration.Rules
+	return &s3.PutBucketLifecycleConfigurationOutput{}, nil
+}
+
+func (f *fakeS3) HeadObject(ctx context.Context, input *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	data, ok := f.objects[aws.ToString(input.Key)]
+	if !ok {
+		return nil, &types.NotFound{}
+	}
+	output := &s3.HeadObjectOutput{ContentLength: aws.Int64(int64(len(data)))}
+	if headers, ok := f.headers[aws.ToString(input.Key)]; ok {
+		output.ContentType = headers.contentType
+		output.Metadata = headers.metadata
+		output.LastModified = aws.Time(headers.lastModified)
+	}
+	return output, nil
+}
+
+func (f *fakeS3) GetObject(ctx context.Context, input *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	data, ok := f.objects[aws.ToString(input.Key)]
+	if !ok {
+		return nil, &types.NoSuchKey{}
+	}
+	output := &s3.GetObjectOutput{
+		Body:          ioutil.NopCloser(bytes.NewReader(data)),
+		ContentLength: aws.Int64(int64(len(data))),
+	}
+	if headers, ok := f.headers[aws.ToString(input.Key)]; ok {
+		output.ContentType = headers.contentType
+		output.Metadata = headers.metadata
+		output.LastModified = aws.Time(headers.lastModified)
+	}
+	return output, nil
+}
+
+func (f *fakeS3) PutObject(ctx context.Context, input *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	data, err := ioutil.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.objects[aws.ToString(input.Key)] = data
+	f.headers[aws.ToString(input.Key)] = newFakeS3Headers(input.ContentType, input.Metadata)
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeS3) DeleteObject(ctx context.Context, input *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	delete(f.objects, aws.ToString(input.Key))
+	delete(f.headers, aws.ToString(input.Key))
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (f *fakeS3) CreateMultipartUpload(ctx context.Context, input *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	uploadID := fmt.Sprintf("upload-%d", len(f.uploads)+1)
+	f.uploads[uploadID] = &fakeS3Upload{
+		key:     aws.ToString(input.Key),
+		headers: newFakeS3Headers(input.ContentType, input.Metadata),
+		parts:   map[int32][]byte{},
+	}
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String(uploadID)}, nil
+}
+
+func (f *fakeS3) UploadPart(ctx context.Context, input *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	upload, ok := f.uploads[aws.ToString(input.UploadId)]
+	if !ok {
+		return nil, &types.NoSuchUpload{}
+	}
+	data, err := ioutil.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	upload.parts[aws.ToInt32(input.PartNumber)] = data
+	return &s3.UploadPartOutput{ETag: aws.String(fmt.Sprintf("etag-%d", aws.ToInt32(input.PartNumber)))}, nil
+}
+
+func (f *fakeS3) CompleteMultipartUpload(ctx context.Context, input *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	upload, ok := f.uploads[aws.ToString(input.UploadId)]
+	if !ok {
+		return nil, &types.NoSuchUpload{}
+	}
+	data := []byte{}
+	for _, part := range input.MultipartUpload.Parts {
+		data = append(data, upload.parts[aws.ToInt32(part.PartNumber)]...)
+	}
+	f.objects[upload.key] = data
+	f.headers[upload.key] = upload.headers
+	delete(f.uploads, aws.ToString(input.UploadId))
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (f *fakeS3) AbortMultipartUpload(ctx context.Context, input *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	delete(f.uploads, aws.ToString(input.UploadId))
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func (f *fakeS3) DeleteObjects(ctx context.Context, input *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for _, object := range input.Delete.Objects {
+		delete(f.objects, aws.ToString(object.Key))
+	}
+	return &s3.DeleteObjectsOutput{}, nil
+}
+
+func (f *fakeS3) ListObjectsV2(ctx context.Context, input *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	f.mutex.Lock()
+	keys := []string{}
+	for key := range f.objects {
+		if strings.HasPrefix(key, aws.ToString(input.Prefix)) {
+			keys = append(keys, key)
+		}
+	}
+	f.mutex.Unlock()
+	sort.Strings(keys)
+
+	page := &s3.ListObjectsV2Output{}
+	for _, key := range keys {
+		page.Contents = append(page.Contents, types.Object{Key: aws.String(key)})
+	}
+	return page, nil
+}
+
+func newS3TestBackend(client *fakeS3) Backend {
+	ctx := context.WithValue(context.Background(), S3_CTX_KEY, S3API(client))
+	return NewRepositoriesBackend(ctx, &config.DBInfo{DatabaseName: "archive"}, S3RepoBuilder, func() {})
+}
+
+func TestS3Repository(t *testing.T) {
+	client := newFakeS3()
+	backend := newS3TestBackend(client)
+
+	repo, err := backend.DefineRepository("users", RepositoryDefinitionMap{
+		"name": "users",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.bucket != "archive" {
+		t.Fatal("Expected the bucket to be created, got", client.bucket)
+	}
+
+	for _, name := range []string{"alice", "bob", "carol"} {
+		if _, err := repo.Save(&map[string]interface{}{"id": name, "name": name, "active": name != "bob"}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := client.objects["users/alice.json"]; !ok {
+		t.Fatal("Expected the record to be stored under users/alice.json")
+	}
+
+	_, err = repo.Save(&map[string]interface{}{"id": "alice"}, nil)
+	if err == nil || err.Error() != "already exists" {
+		t.Fatal("Expected already exists error, got", err)
+	}
+
+	created, err := repo.Save(&map[string]interface{}{"name": "dave"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := created.(map[string]interface{})["id"].(string); id == "" {
+		t.Fatal("Expected generated id")
+	}
+
+	result, err := repo.GetOne(NewFilter().Match("id", "bob"), &map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (*result.(*map[string]interface{}))["name"] != "bob" {
+		t.Fatal("Expected bob, got", result)
+	}
+
+	results, err := repo.GetAll(NewFilter().Match("active", true), &map[string]interface{}{}, "name", "desc", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := *results.(*[]*map[string]interface{})
+	if len(list) != 2 || (*list[0])["name"] != "carol" || (*list[1])["name"] != "alice" {
+		t.Fatal("Expected carol and alice, got", list)
+	}
+
+	if _, err := repo.Save(&map[string]interface{}{"id": "other", "active": true}, NewFilter().Match("id", "bob")); err != nil {
+		t.Fatal(err)
+	}
+	result, err = repo.GetOne(NewFilter().Match("id", "bob"), &map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (*result.(*map[string]interface{}))["active"] != true {
+		t.Fatal("Expected bob to be updated, got", result)
+	}
+
+	if err := repo.DeleteOne(NewFilter().Match("id", "missing")); err == nil || err.Error() != "not found" {
+		t.Fatal("Expected not found error, got", err)
+	}
+	if err := repo.DeleteAll(NewFilter().Match("active", true)); err != nil {
+		t.Fatal(err)
+	}
+	results, err = repo.GetAll(nil, &map[string]interface{}{}, "", "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list := *results.(*[]*map[string]interface{}); len(list) != 1 || (*list[0])["name"] != "dave" {
+		t.Fatal("Expected only dave, got", list)
+	}
+}
+
+func TestS3RepositoryTTL(t *testing.T) {
+	client := newFakeS3()
+	client.lifecycle = []types.LifecycleRule{
+		{ID: aws.String("other"), Status: types.ExpirationStatusEnabled},
+	}
+	backend := newS3TestBackend(client)
+
+	_, err := backend.DefineRepository("sessions", RepositoryDefinitionMap{
+		"name":      "sessions",
+		"enableTtl": true,
+		"ttl":       90000,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(client.lifecycle) != 2 {
+		t.Fatal("Expected the existing rule to be kept, got", client.lifecycle)
+	}
+	rule := client.lifecycle[1]
+	if aws.ToString(rule.ID) != "backends-sessions" || aws.ToString(rule.Filter.Prefix) != "sessions/" {
+		t.Fatal("Unexpected rule", rule)
+	}
+	if days := aws.ToInt32(rule.Expiration.Days); days != 2 {
+		t.Fatal("Expected the TTL to be rounded up to 2 days, got", days)
+	}
+}
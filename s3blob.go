@@ -0,0 +1,227 @@
+package backends
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// s3BlobPartSize is the size of the parts of the multipart uploads, and the size up to which the blobs are uploaded
+// with a single request. 5MB is the minimal part size of S3.
+var s3BlobPartSize = 5 * 1024 * 1024
+
+// S3Backend is an S3 backend. It implements BlobBackend.
+type S3Backend struct {
+	Backend
+	client S3API
+}
+
+// S3BlobRepository is a BlobRepository stored in the bucket of the backend, with the objects under the
+// <repository>/ prefix. The metadata is stored in the user metadata of the objects, so it is limited to 2kB.
+type S3BlobRepository struct {
+	client S3API
+	bucket string
+	prefix string
+}
+
+// NewS3Backend creates an S3Backend with the client.
+func NewS3Backend(dbInfo *config.DBInfo, client S3API) *S3Backend {
+	ctx := context.WithValue(context.Background(), S3_CTX_KEY, client)
+	cleanup := func() {}
+
+	return &S3Backend{
+		Backend: NewRepositoriesBackend(ctx, dbInfo, S3RepoBuilder, cleanup),
+		client:  client,
+	}
+}
+
+// GetBlobRepository returns the blob repository with the name as prefix of its objects. If the bucket does not
+// exist, it is created. The name must not contain "/", so the objects of the repositories don't mix.
+func (b *S3Backend) GetBlobRepository(name string) (BlobRepository, error) {
+	if name == "" {
+		return nil, ErrInvalidInput("blob repository name is missing and required")
+	}
+	if strings.Contains(name, "/") {
+		return nil, ErrInvalidInput("blob repository name must not contain /")
+	}
+	bucket := b.GetConfig().DatabaseName
+	if bucket == "" {
+		return nil, ErrBackendError("database name is missing and required")
+	}
+	if err := createBucket(b.client, bucket); err != nil {
+		return nil, err
+	}
+
+	return &S3BlobRepository{
+		client: b.client,
+		bucket: bucket,
+		prefix: name + "/",
+	}, nil
+}
+
+// Put uploads the content with a single request if it is smaller than s3BlobPartSize, otherwise with a multipart
+// upload, so only one part is held in memory. The object is replaced atomically when the upload completes.
+func (r *S3BlobRepository) Put(name string, content io.Reader, contentType string, metadata map[string]string) (*BlobInfo, error) {
+	if err := validateBlobName(name); err != nil {
+		return nil, err
+	}
+	if contentType == "" {
+		contentType = blobContentType
+	}
+	metadata = blobMetadata(metadata)
+
+	part := make([]byte, s3BlobPartSize)
+	n, err := io.ReadFull(content, part)
+	switch err {
+	case io.EOF, io.ErrUnexpectedEOF:
+		_, err = r.client.PutObject(context.Background(), &s3.PutObjectInput{
+			Bucket:      aws.String(r.bucket),
+			Key:         aws.String(r.prefix + name),
+			Body:        bytes.NewReader(part[:n]),
+			ContentType: aws.String(contentType),
+			Metadata:    metadata,
+		})
+	case nil:
+		err = r.upload(name, content, part, contentType, metadata)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Stat(name)
+}
+
+// upload uploads the content with a multipart upload, starting with the first part already read. The upload is
+// aborted on an error, so its parts are not kept in the bucket.
+func (r *S3BlobRepository) upload(name string, content io.Reader, part []byte, contentType string, metadata map[string]string) error {
+	key := aws.String(r.prefix + name)
+	upload, err := r.client.CreateMultipartUpload(context.Background(), &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(r.bucket),
+		Key:         key,
+		ContentType: aws.String(contentType),
+		Metadata:    metadata,
+	})
+	if err != nil {
+		return err
+	}
+
+	parts := []types.CompletedPart{}
+	n := len(part)
+	for n > 0 {
+		number := aws.Int32(int32(len(parts) + 1))
+		output, err := r.client.UploadPart(context.Background(), &s3.UploadPartInput{
+			Bucket:     aws.String(r.bucket),
+			Key:        key,
+			UploadId:   upload.UploadId,
+			PartNumber: number,
+			Body:       bytes.NewReader(part[:n]),
+		})
+		if err != nil {
+			return r.abort(key, upload.UploadId, err)
+		}
+		parts = append(parts, types.CompletedPart{
+			ETag:       output.ETag,
+			PartNumber: number,
+		})
+
+		n, err = io.ReadFull(content, part)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return r.abort(key, upload.UploadId, err)
+		}
+	}
+
+	_, err = r.client.CompleteMultipartUpload(context.Background(), &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(r.bucket),
+		Key:             key,
+		UploadId:        upload.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		return r.abort(key, upload.UploadId, err)
+	}
+	return nil
+}
+
+// abort aborts the multipart upload and returns the error that failed it.
+func (r *S3BlobRepository) abort(key *string, uploadID *string, err error) error {
+	r.client.AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(r.bucket),
+		Key:      key,
+		UploadId: uploadID,
+	})
+	return err
+}
+
+// Get returns the content of the object. The content must be closed.
+func (r *S3BlobRepository) Get(name string) (io.ReadCloser, *BlobInfo, error) {
+	if err := validateBlobName(name); err != nil {
+		return nil, nil, err
+	}
+	output, err := r.client.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(r.bucket),
+		Key:    aws.String(r.prefix + name),
+	})
+	if err != nil {
+		if isS3NotFound(err) {
+			return nil, nil, ErrNotFound("blob not found")
+		}
+		return nil, nil, err
+	}
+
+	info := s3BlobInfo(name, output.ContentLength, output.ContentType, output.LastModified, output.Metadata)
+	return output.Body, info, nil
+}
+
+// Stat returns the info of the object, without its content.
+func (r *S3BlobRepository) Stat(name string) (*BlobInfo, error) {
+	if err := validateBlobName(name); err != nil {
+		return nil, err
+	}
+	output, err := r.client.HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String(r.bucket),
+		Key:    aws.String(r.prefix + name),
+	})
+	if err != nil {
+		if isS3NotFound(err) {
+			return nil, ErrNotFound("blob not found")
+		}
+		return nil, err
+	}
+
+	return s3BlobInfo(name, output.ContentLength, output.ContentType, output.LastModified, output.Metadata), nil
+}
+
+// Delete deletes the object. S3 does not report whether the object existed, so it is checked first.
+func (r *S3BlobRepository) Delete(name string) error {
+	if _, err := r.Stat(name); err != nil {
+		return err
+	}
+	_, err := r.client.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+		Bucket: aws.String(r.bucket),
+		Key:    aws.String(r.prefix + name),
+	})
+	return err
+}
+
+// s3BlobInfo returns the info of the blob from the headers of its object. S3 returns the metadata keys in the
+// canonical form of the HTTP headers ("Uploaded-By"), so they are lower-cased again.
+func s3BlobInfo(name string, size *int64, contentType *string, lastModified *time.Time, metadata map[string]string) *BlobInfo {
+	info := &BlobInfo{
+		Name:        name,
+		Size:        aws.ToInt64(size),
+		ContentType: aws.ToString(contentType),
+		Metadata:    blobMetadata(metadata),
+		UpdatedAt:   aws.ToTime(lastModified),
+	}
+	if info.ContentType == "" {
+		info.ContentType = blobContentType
+	}
+	return info
+}
@@ -0,0 +1,134 @@
+package backends
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func newS3BlobTestRepository(t *testing.T, client *fakeS3) BlobRepository {
+	backend := NewS3Backend(&config.DBInfo{DatabaseName: "archive"}, client)
+	repo, err := backend.GetBlobRepository("avatars")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func TestS3BlobRepository(t *testing.T) {
+	client := newFakeS3()
+	repo := newS3BlobTestRepository(t, client)
+	if client.bucket != "archive" {
+		t.Fatal("Expected the bucket to be created. Got: ", client.bucket)
+	}
+
+	info, err := repo.Put("user-1", strings.NewReader("png data"), "image/png", map[string]string{"uploadedBy": "user-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "user-1" || info.Size != 8 || info.ContentType != "image/png" || info.UpdatedAt.IsZero() {
+		t.Fatal("Unexpected info: ", info)
+	}
+	if info.Metadata["uploadedby"] != "user-1" || len(info.Metadata) != 1 {
+		t.Fatal("Expected the metadata with lower case keys. Got: ", info.Metadata)
+	}
+	if _, ok := client.objects["avatars/user-1"]; !ok {
+		t.Fatal("Expected the object under the repository prefix")
+	}
+
+	content, info, err := repo.Get("user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(content)
+	content.Close()
+	if err != nil || string(data) != "png data" || info.ContentType != "image/png" {
+		t.Fatal("Unexpected content: ", string(data), info, err)
+	}
+
+	// a blob without a content type is binary
+	if info, err = repo.Put("user-1", strings.NewReader("new"), "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if info.ContentType != "application/octet-stream" || info.Size != 3 || info.Metadata != nil {
+		t.Fatal("Expected the blob to be replaced. Got: ", info)
+	}
+
+	if err := repo.Delete("user-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Stat("user-1"); !IsErrNotFound(err) {
+		t.Fatal("Expected ErrNotFound after Delete. Got: ", err)
+	}
+	if _, _, err := repo.Get("user-1"); !IsErrNotFound(err) {
+		t.Fatal("Expected ErrNotFound from Get. Got: ", err)
+	}
+	if err := repo.Delete("user-1"); !IsErrNotFound(err) {
+		t.Fatal("Expected ErrNotFound from Delete. Got: ", err)
+	}
+	if _, err := repo.Put("", strings.NewReader("data"), "", nil); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for an empty name. Got: ", err)
+	}
+}
+
+func TestS3BlobRepositoryName(t *testing.T) {
+	backend := NewS3Backend(&config.DBInfo{DatabaseName: "archive"}, newFakeS3())
+	for _, name := range []string{"", "avatars/large"} {
+		if _, err := backend.GetBlobRepository(name); !IsErrInvalidInput(err) {
+			t.Fatalf("Expected ErrInvalidInput for %q. Got: %v", name, err)
+		}
+	}
+}
+
+// failingReader returns the content, then the error.
+type failingReader struct {
+	content io.Reader
+	err     error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	n, err := r.content.Read(p)
+	if err == io.EOF {
+		return n, r.err
+	}
+	return n, err
+}
+
+func TestS3BlobRepositoryMultipart(t *testing.T) {
+	partSize := s3BlobPartSize
+	s3BlobPartSize = 4
+	defer func() { s3BlobPartSize = partSize }()
+
+	client := newFakeS3()
+	repo := newS3BlobTestRepository(t, client)
+
+	info, err := repo.Put("report.csv", strings.NewReader("a,b\n1,2\n3,4\n"), "text/csv", map[string]string{"Rows": "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != 12 || info.ContentType != "text/csv" || info.Metadata["rows"] != "2" {
+		t.Fatal("Unexpected info: ", info)
+	}
+	if data := string(client.objects["avatars/report.csv"]); data != "a,b\n1,2\n3,4\n" {
+		t.Fatal("Expected the parts to be joined in order. Got: ", data)
+	}
+	if len(client.uploads) != 0 {
+		t.Fatal("Expected the upload to be completed")
+	}
+
+	// the upload is aborted when the content fails
+	failed := errors.New("connection reset")
+	if _, err := repo.Put("broken.csv", &failingReader{content: strings.NewReader("a,b\n1,2\n3"), err: failed}, "text/csv", nil); err != failed {
+		t.Fatal("Expected the error of the content. Got: ", err)
+	}
+	if len(client.uploads) != 0 {
+		t.Fatal("Expected the upload to be aborted")
+	}
+	if _, err := repo.Stat("broken.csv"); !IsErrNotFound(err) {
+		t.Fatal("Expected no blob from a failed upload. Got: ", err)
+	}
+}
@@ -0,0 +1,228 @@
+package backends
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// SagaAction is an action of a saga step, or the compensation that undoes it.
+type SagaAction func() error
+
+// SagaOptions configures a Saga.
+type SagaOptions struct {
+	// CompensationRetries is the number of times a failed compensation is retried. Default is 3.
+	CompensationRetries int
+	// RetryInterval is the interval before the first retry of a compensation, doubled before every next retry.
+	// Default is 100ms.
+	RetryInterval time.Duration
+	// OnCompensationFailure is called with every compensation that failed on all retries, so the records it should
+	// have restored can be repaired. Default is to log the failure.
+	OnCompensationFailure func(step string, err error)
+}
+
+// sagaStep is a step of a saga.
+type sagaStep struct {
+	name       string
+	action     SagaAction
+	compensate SagaAction
+}
+
+// SagaError is returned by Saga.Run when a step fails. The steps completed before it were compensated, except the
+// ones in CompensationErrors.
+type SagaError struct {
+	// Step is the name of the failed step.
+	Step string
+	// Err is the error of the failed step.
+	Err error
+	// Compensated are the names of the compensated steps, in the order they were compensated.
+	Compensated []string
+	// CompensationErrors are the errors of the compensations that failed, by the name of the step.
+	CompensationErrors map[string]error
+}
+
+// Error returns the error of the failed step and of the failed compensations.
+func (e *SagaError) Error() string {
+	message := fmt.Sprintf("saga step %s failed: %s", e.Step, e.Err.Error())
+	if len(e.CompensationErrors) > 0 {
+		failures := []string{}
+		for step, err := range e.CompensationErrors {
+			failures = append(failures, fmt.Sprintf("%s: %s", step, err.Error()))
+		}
+		message += fmt.Sprintf("; %d compensations failed: %s", len(failures), strings.Join(failures, "; "))
+	}
+	return message
+}
+
+// Saga sequences writes across repositories of different backends (for example MongoDB and DynamoDB), that can't be
+// committed in a single transaction. Every step has a compensation that undoes it. The steps are run in order, and if
+// one fails, the compensations of the completed steps are run in the reverse order:
+//
+//	err := backends.NewSaga(nil).
+//		Save("user", mongoUsers, user).
+//		Save("profile", dynamoProfiles, profile).
+//		Step("welcome", sendWelcomeEmail, nil).
+//		Run()
+//
+// Save, Update and Delete add the steps for the common writes, with compensations that restore the record. Step adds
+// a step with custom actions. The records may be seen in the intermediate states by the other readers, and the
+// compensations overwrite the concurrent writes of the same records.
+type Saga struct {
+	steps   []*sagaStep
+	options *SagaOptions
+}
+
+// NewSaga creates an empty saga.
+func NewSaga(options *SagaOptions) *Saga {
+	if options == nil {
+		options = &SagaOptions{}
+	}
+	if options.CompensationRetries < 1 {
+		options.CompensationRetries = 3
+	}
+	if options.RetryInterval <= 0 {
+		options.RetryInterval = 100 * time.Millisecond
+	}
+	if options.OnCompensationFailure == nil {
+		options.OnCompensationFailure = func(step string, err error) {
+			log.Printf("ERROR: failed to compensate saga step %s: %s\n", step, err.Error())
+		}
+	}
+	return &Saga{
+		steps:   []*sagaStep{},
+		options: options,
+	}
+}
+
+// Step adds a step with the action and its compensation. The compensation may be nil if the step can't or need not
+// be undone; such steps should come last.
+func (s *Saga) Step(name string, action SagaAction, compensate SagaAction) *Saga {
+	s.steps = append(s.steps, &sagaStep{
+		name:       name,
+		action:     action,
+		compensate: compensate,
+	})
+	return s
+}
+
+// Save adds a step that creates the record in the repository. The compensation deletes it by its id.
+func (s *Saga) Save(name string, repo Repository, object interface{}) *Saga {
+	var id interface{}
+	return s.Step(name, func() error {
+		saved, err := repo.Save(object, nil)
+		if err != nil {
+			return err
+		}
+		// the backends return the saved records as maps or as pointers to them
+		record, err := normalizeValue(saved)
+		if err != nil {
+			return err
+		}
+		if record, ok := record.(map[string]interface{}); ok {
+			id = record["id"]
+		}
+		return nil
+	}, func() error {
+		err := repo.DeleteOne(NewFilter().Match("id", id))
+		if err != nil && IsErrNotFound(err) {
+			return nil
+		}
+		return err
+	})
+}
+
+// Update adds a step that updates the first record matched by the filter. The record is read before the update, and
+// the compensation restores it. The properties added by the update are removed if the repository supports Patch.
+func (s *Saga) Update(name string, repo Repository, filter Filter, update interface{}) *Saga {
+	var original map[string]interface{}
+	return s.Step(name, func() error {
+		original = map[string]interface{}{}
+		if _, err := repo.GetOne(cloneFilter(filter), &original); err != nil {
+			return err
+		}
+		_, err := repo.Save(update, cloneFilter(filter))
+		return err
+	}, func() error {
+		payload, err := InterfaceToMap(update)
+		if err != nil {
+			return err
+		}
+		added := []string{}
+		for property := range *payload {
+			if _, ok := original[property]; !ok {
+				added = append(added, property)
+			}
+		}
+		restore := NewFilter().Match("id", original["id"])
+		var patchRepo PatchRepository
+		if AsRepository(repo, &patchRepo) && len(added) > 0 {
+			_, err = Patch(repo, restore, &original, added)
+			return err
+		}
+		_, err = repo.Save(&original, restore)
+		return err
+	})
+}
+
+// Delete adds a step that deletes the first record matched by the filter. The record is read before it is deleted,
+// and the compensation creates it again.
+func (s *Saga) Delete(name string, repo Repository, filter Filter) *Saga {
+	var original map[string]interface{}
+	return s.Step(name, func() error {
+		original = map[string]interface{}{}
+		if _, err := repo.GetOne(cloneFilter(filter), &original); err != nil {
+			return err
+		}
+		return repo.DeleteOne(NewFilter().Match("id", original["id"]))
+	}, func() error {
+		_, err := repo.Save(&original, nil)
+		if err != nil && IsErrAlreadyExists(err) {
+			return nil
+		}
+		return err
+	})
+}
+
+// Run runs the steps in order. If a step fails, the completed steps are compensated in the reverse order, and
+// *SagaError is returned.
+func (s *Saga) Run() error {
+	for i, step := range s.steps {
+		if err := step.action(); err != nil {
+			return s.compensate(s.steps[:i], step.name, err)
+		}
+	}
+	return nil
+}
+
+// compensate runs the compensations of the completed steps, in the reverse order.
+func (s *Saga) compensate(completed []*sagaStep, failed string, cause error) error {
+	sagaErr := &SagaError{
+		Step:               failed,
+		Err:                cause,
+		Compensated:        []string{},
+		CompensationErrors: map[string]error{},
+	}
+	for i := len(completed) - 1; i >= 0; i-- {
+		step := completed[i]
+		if step.compensate == nil {
+			continue
+		}
+		var err error
+		for attempt := 0; attempt <= s.options.CompensationRetries; attempt++ {
+			if attempt > 0 {
+				time.Sleep(s.options.RetryInterval * time.Duration(1<<uint(attempt-1)))
+			}
+			if err = step.compensate(); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			sagaErr.CompensationErrors[step.name] = err
+			s.options.OnCompensationFailure(step.name, err)
+			continue
+		}
+		sagaErr.Compensated = append(sagaErr.Compensated, step.name)
+	}
+	return sagaErr
+}
@@ -0,0 +1,92 @@
+package backends
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func TestSaga(t *testing.T) {
+	backend, err := CacheBackendBuilder(&config.DBInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Shutdown()
+
+	users, err := backend.DefineRepository("users", RepositoryDefinitionMap{"name": "users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	profiles, err := backend.DefineRepository("profiles", RepositoryDefinitionMap{"name": "profiles"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := users.Save(&map[string]interface{}{"id": "jane", "status": "active"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := profiles.Save(&map[string]interface{}{"id": "old", "user": "jane"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	failures := []string{}
+	saga := NewSaga(&SagaOptions{
+		RetryInterval: time.Millisecond,
+		OnCompensationFailure: func(step string, err error) {
+			failures = append(failures, step)
+		},
+	})
+	err = saga.
+		Save("user", users, &map[string]interface{}{"id": "john", "name": "John"}).
+		Update("status", users, NewFilter().Match("id", "jane"), &map[string]interface{}{"status": "suspended", "reason": "duplicate"}).
+		Delete("profile", profiles, NewFilter().Match("id", "old")).
+		Step("notify", func() error {
+			return errors.New("mail server is down")
+		}, nil).
+		Run()
+
+	sagaErr, ok := err.(*SagaError)
+	if !ok {
+		t.Fatal("Expected a saga error. Got: ", err)
+	}
+	if sagaErr.Step != "notify" || len(sagaErr.Compensated) != 3 || sagaErr.Compensated[0] != "profile" || len(failures) != 0 {
+		t.Fatal("Expected the completed steps to be compensated in the reverse order. Got: ", sagaErr.Compensated, failures)
+	}
+
+	if exists, err := users.Exists(NewFilter().Match("id", "john")); err != nil || exists {
+		t.Fatal("Expected the created user to be deleted. Got: ", exists, err)
+	}
+	jane := map[string]interface{}{}
+	if _, err := users.GetOne(NewFilter().Match("id", "jane"), &jane); err != nil {
+		t.Fatal(err)
+	}
+	if _, added := jane["reason"]; jane["status"] != "active" || added {
+		t.Fatal("Expected the updated user to be restored. Got: ", jane)
+	}
+	if exists, err := profiles.Exists(NewFilter().Match("id", "old")); err != nil || !exists {
+		t.Fatal("Expected the deleted profile to be created again. Got: ", exists, err)
+	}
+
+	attempts := 0
+	err = NewSaga(&SagaOptions{CompensationRetries: 2, RetryInterval: time.Millisecond, OnCompensationFailure: func(step string, err error) {
+		failures = append(failures, step)
+	}}).
+		Step("reserve", func() error { return nil }, func() error {
+			attempts++
+			return errors.New("unavailable")
+		}).
+		Step("charge", func() error { return errors.New("declined") }, nil).
+		Run()
+	sagaErr, ok = err.(*SagaError)
+	if !ok || sagaErr.CompensationErrors["reserve"] == nil {
+		t.Fatal("Expected the failed compensation to be reported. Got: ", err)
+	}
+	if attempts != 3 || len(failures) != 1 || failures[0] != "reserve" {
+		t.Fatal("Expected the compensation to be retried twice. Got: ", attempts, failures)
+	}
+
+	if err := NewSaga(nil).Save("user", users, &map[string]interface{}{"id": "jim"}).Run(); err != nil {
+		t.Fatal(err)
+	}
+}
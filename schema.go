@@ -0,0 +1,193 @@
+package backends
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// SchemaMode is the way a SchemaManager handles the repositories that don't match the declared ones.
+type SchemaMode int
+
+const (
+	// SchemaPermissive reports the violations (see SchemaOptions.OnViolation), but lets the repositories be defined.
+	// This is meant for the development environments.
+	SchemaPermissive SchemaMode = iota
+	// SchemaStrict rejects the repositories that are not declared or don't match the declaration with
+	// ErrSchemaViolation, so the service fails to start.
+	SchemaStrict
+)
+
+// SchemaOptions configures a SchemaManager.
+type SchemaOptions struct {
+	// Mode is SchemaPermissive (the default) or SchemaStrict.
+	Mode SchemaMode
+	// OnViolation is called with every violation, in both modes. Default is to log the violation.
+	OnViolation func(err error)
+}
+
+// SchemaManager is a BackendManager whose repositories must be declared in a WarmUpPlan. The plan is the registry
+// of all repositories of the service: defining a repository that is not in the plan, or that is defined with
+// another definition than the declared one (provisioning drift), is a violation. In strict mode the violations fail
+// the definition, so the service fails to start:
+//
+//	mode := backends.SchemaPermissive
+//	if env == "production" {
+//		mode = backends.SchemaStrict
+//	}
+//	manager = backends.NewSchemaManager(manager, plan, &backends.SchemaOptions{Mode: mode})
+//	if err := backends.WarmUp(manager, plan); err != nil {
+//		log.Fatal(err)
+//	}
+//
+// A repository is compared with the declaration by its definition: the indexes, the TTL, the keys, the capacities,
+// the GSIs, the LSIs, the auto scaling, the stream, the encryption, the point-in-time recovery and the custom id. The
+// actual state of the database (for example an existing DynamoDB table with other keys) is not inspected.
+type SchemaManager struct {
+	BackendManager
+	plan    *WarmUpPlan
+	options *SchemaOptions
+}
+
+// NewSchemaManager wraps the backend manager so all repositories of its backends are checked against the plan.
+func NewSchemaManager(manager BackendManager, plan *WarmUpPlan, options *SchemaOptions) *SchemaManager {
+	if options == nil {
+		options = &SchemaOptions{}
+	}
+	if options.OnViolation == nil {
+		options.OnViolation = func(err error) {
+			if details, ok := err.(*BackendErrorInfo); ok {
+				log.Printf("WARN: %s: %s\n", details.Error(), details.Details())
+				return
+			}
+			log.Printf("WARN: %s\n", err.Error())
+		}
+	}
+	return &SchemaManager{
+		BackendManager: manager,
+		plan:           plan,
+		options:        options,
+	}
+}
+
+// GetBackend returns the backend, with the repositories checked against the plan.
+func (m *SchemaManager) GetBackend(backendType string) (Backend, error) {
+	backend, err := m.BackendManager.GetBackend(backendType)
+	if err != nil {
+		return nil, err
+	}
+	return &SchemaBackend{
+		Backend:     backend,
+		backendType: backendType,
+		manager:     m,
+	}, nil
+}
+
+// violation reports the violation. Returns the error in strict mode, nil in permissive mode.
+func (m *SchemaManager) violation(message string) error {
+	err := ErrSchemaViolation(message)
+	m.options.OnViolation(err)
+	if m.options.Mode == SchemaStrict {
+		return err
+	}
+	return nil
+}
+
+// SchemaBackend is a Backend of a SchemaManager.
+type SchemaBackend struct {
+	Backend
+	backendType string
+	manager     *SchemaManager
+}
+
+// DefineRepository checks the repository against the declaration in the plan, and defines it on the underlying
+// backend. If the repository was already defined, the definition it was defined with is checked as well.
+func (b *SchemaBackend) DefineRepository(name string, def RepositoryDefinition) (Repository, error) {
+	declared, ok := b.manager.plan.Declared(b.backendType, name)
+	if !ok {
+		if err := b.manager.violation(fmt.Sprintf("repository %s/%s is not declared", b.backendType, name)); err != nil {
+			return nil, err
+		}
+		return b.Backend.DefineRepository(name, def)
+	}
+
+	if diff := definitionDiff(declared, def); len(diff) > 0 {
+		err := b.manager.violation(fmt.Sprintf("repository %s/%s differs from the declaration in %s", b.backendType, name, strings.Join(diff, ", ")))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if provider, ok := b.Backend.(RepositoryDefinitionProvider); ok {
+		if existing, err := provider.GetRepositoryDefinition(name); err == nil {
+			if diff := definitionDiff(declared, existing); len(diff) > 0 {
+				err := b.manager.violation(fmt.Sprintf("repository %s/%s was defined with a different %s", b.backendType, name, strings.Join(diff, ", ")))
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return b.Backend.DefineRepository(name, def)
+}
+
+// GetRepositoryDefinition returns the definition the repository was defined with, if the underlying backend keeps it.
+func (b *SchemaBackend) GetRepositoryDefinition(name string) (RepositoryDefinition, error) {
+	provider, ok := b.Backend.(RepositoryDefinitionProvider)
+	if !ok {
+		return nil, ErrNotSupported("backend does not keep the repository definitions")
+	}
+	return provider.GetRepositoryDefinition(name)
+}
+
+// definitionDiff returns the names of the properties that differ between the definitions.
+func definitionDiff(expected RepositoryDefinition, actual RepositoryDefinition) []string {
+	diff := []string{}
+	compare := func(property string, a, b interface{}) {
+		if !reflect.DeepEqual(a, b) {
+			diff = append(diff, property)
+		}
+	}
+	compare("indexes", indexSignatures(expected.GetIndexes()), indexSignatures(actual.GetIndexes()))
+	compare("TTL", expected.EnableTTL(), actual.EnableTTL())
+	if expected.EnableTTL() && actual.EnableTTL() {
+		compare("TTL", expected.GetTTL(), actual.GetTTL())
+		compare("TTL attribute", expected.GetTTLAttribute(), actual.GetTTLAttribute())
+	}
+	compare("hash key", expected.GetHashKey(), actual.GetHashKey())
+	compare("hash key type", expected.GetHashKeyType(), actual.GetHashKeyType())
+	compare("range key", expected.GetRangeKey(), actual.GetRangeKey())
+	compare("range key type", expected.GetRangeKeyType(), actual.GetRangeKeyType())
+	compare("read capacity", expected.GetReadCapacity(), actual.GetReadCapacity())
+	compare("write capacity", expected.GetWriteCapacity(), actual.GetWriteCapacity())
+	compare("GSI", expected.GetGSI(), actual.GetGSI())
+	compare("LSI", dynamoDefinition(expected).GetLSI(), dynamoDefinition(actual).GetLSI())
+	compare("auto scaling", dynamoDefinition(expected).GetAutoScaling(), dynamoDefinition(actual).GetAutoScaling())
+	compare("stream", dynamoDefinition(expected).EnableStream(), dynamoDefinition(actual).EnableStream())
+	compare("stream view type", dynamoDefinition(expected).GetStreamViewType(), dynamoDefinition(actual).GetStreamViewType())
+	compare("encryption", dynamoDefinition(expected).GetEncryption(), dynamoDefinition(actual).GetEncryption())
+	compare("point-in-time recovery", dynamoDefinition(expected).EnablePointInTimeRecovery(), dynamoDefinition(actual).EnablePointInTimeRecovery())
+	compare("custom id", expected.IsCustomID(), actual.IsCustomID())
+	return diff
+}
+
+// indexSignatures describes the indexes, independently of their order.
+func indexSignatures(indexes []Index) []string {
+	signatures := []string{}
+	for _, index := range indexes {
+		fields := []string{}
+		for _, key := range indexKeys(index) {
+			if key.Descending {
+				fields = append(fields, key.Field+" desc")
+			} else {
+				fields = append(fields, key.Field)
+			}
+		}
+		signatures = append(signatures, fmt.Sprintf("%s(%s) unique=%t", index.GetName(), strings.Join(fields, ","), index.Unique()))
+	}
+	sort.Strings(signatures)
+	return signatures
+}
@@ -0,0 +1,87 @@
+package backends
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSchemaManager(t *testing.T) {
+	calls := []string{}
+	plan := NewWarmUpPlan().
+		Repository("primary", "users", RepositoryDefinitionMap{"name": "users", "indexes": []Index{NewUniqueIndex("email")}})
+
+	violations := []error{}
+	manager := NewSchemaManager(newWarmUpManager(&calls), plan, &SchemaOptions{
+		Mode: SchemaStrict,
+		OnViolation: func(err error) {
+			violations = append(violations, err)
+		},
+	})
+	if err := WarmUp(manager, plan); err != nil {
+		t.Fatal(err)
+	}
+
+	backend, err := manager.GetBackend("primary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.DefineRepository("users", RepositoryDefinitionMap{"name": "users", "indexes": []Index{NewUniqueIndex("email")}}); err != nil {
+		t.Fatal("Expected the declared repository to be defined. Got: ", err)
+	}
+	if _, err := backend.DefineRepository("sessions", RepositoryDefinitionMap{"name": "sessions"}); err == nil || !IsErrSchemaViolation(err) {
+		t.Fatal("Expected schema violation for an undeclared repository. Got: ", err)
+	}
+	_, err = backend.DefineRepository("users", RepositoryDefinitionMap{"name": "users", "enableTtl": true, "ttl": 60})
+	if err == nil || !IsErrSchemaViolation(err) {
+		t.Fatal("Expected schema violation for a drifted definition. Got: ", err)
+	}
+	if details := err.(*BackendErrorInfo).Details(); !strings.Contains(details, "indexes, TTL") {
+		t.Fatal("Expected the differences in the error. Got: ", details)
+	}
+	if _, err := manager.GetBackend("secondary"); err != nil {
+		t.Fatal(err)
+	}
+	if len(violations) != 2 {
+		t.Fatal("Expected 2 violations. Got: ", violations)
+	}
+}
+
+func TestSchemaManagerDrift(t *testing.T) {
+	calls := []string{}
+	inner := newWarmUpManager(&calls)
+	backend, err := inner.GetBackend("primary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// defined before the startup, with another key
+	if _, err := backend.DefineRepository("users", RepositoryDefinitionMap{"name": "users", "hashKey": "email"}); err != nil {
+		t.Fatal(err)
+	}
+
+	plan := NewWarmUpPlan().Repository("primary", "users", RepositoryDefinitionMap{"name": "users"})
+	err = WarmUp(NewSchemaManager(inner, plan, &SchemaOptions{Mode: SchemaStrict, OnViolation: func(err error) {}}), plan)
+	if err == nil || !IsErrSchemaViolation(err.(*WarmUpError).Failed["primary/users"]) {
+		t.Fatal("Expected the startup to fail with a schema violation. Got: ", err)
+	}
+
+	violations := 0
+	permissive := NewSchemaManager(inner, plan, &SchemaOptions{OnViolation: func(err error) { violations++ }})
+	if err := WarmUp(permissive, plan); err != nil {
+		t.Fatal("Expected the permissive mode to report the drift only. Got: ", err)
+	}
+	if violations != 1 {
+		t.Fatal("Expected 1 violation. Got: ", violations)
+	}
+}
+
+func TestIndexSignatures(t *testing.T) {
+	ascending := indexSignatures([]Index{NewSortedIndex("recent", false, Ascending("userId"), Ascending("createdAt"))})
+	descending := indexSignatures([]Index{NewSortedIndex("recent", false, Ascending("userId"), Descending("createdAt"))})
+	if reflect.DeepEqual(ascending, descending) {
+		t.Fatal("Expected the direction of the fields to change the index. Got: ", descending)
+	}
+	if plain := indexSignatures([]Index{NewIndex("recent", false, "userId", "createdAt")}); !reflect.DeepEqual(plain, ascending) {
+		t.Fatal("Expected the fields of a plain index to be ascending. Got: ", plain, ascending)
+	}
+}
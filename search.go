@@ -0,0 +1,93 @@
+package backends
+
+import (
+	"fmt"
+)
+
+// Searcher is implemented by the repositories that search the records by the words of their text fields (MongoDB,
+// with the text index of the repository, see TextIndexDefinition):
+//
+//	var searcher backends.Searcher
+//	if backends.AsRepository(articleRepo, &searcher) {
+//		articles, err := searcher.Search("replica set failover", backends.NewFilter().Match("status", "published"), &Article{}, 20, 0)
+//	}
+//
+// The records match if their text fields contain any of the words (or their stems in the language of the index).
+// The text may also have phrases in quotes, which must all be contained, and words prefixed with "-", which must not
+// be. The results are ordered by relevance, and the filter narrows them further.
+type Searcher interface {
+	Search(text string, filter Filter, resultsTypeHint interface{}, limit int, offset int) (interface{}, error)
+}
+
+// TextIndex is the text index of a repository.
+type TextIndex struct {
+	// Fields are the indexed text fields.
+	Fields []string
+	// Weights are the weights of the fields in the relevance of the results, 1 by default.
+	Weights map[string]int
+	// Language is the language of the stemming and the stop words, "english" by default. "none" matches the words
+	// exactly.
+	Language string
+}
+
+// TextIndexDefinition is implemented by the repository definitions with a text index - MongoDB specific.
+// RepositoryDefinitionMap implements it with the "textIndex" property, with the "fields" ([]string), "weights"
+// (map[string]int) and "language" of the TextIndex.
+type TextIndexDefinition interface {
+	GetTextIndex() map[string]interface{}
+}
+
+// GetTextIndex returns the text index of the repository - MongoDB specific.
+func (m RepositoryDefinitionMap) GetTextIndex() map[string]interface{} {
+	if textIndex, ok := m["textIndex"]; ok {
+		return textIndex.(map[string]interface{})
+	}
+
+	return nil
+}
+
+// repositoryTextIndex returns the text index of the repository, or nil if it has none.
+func repositoryTextIndex(repoDef RepositoryDefinition) (*TextIndex, error) {
+	textIndexDef, ok := repoDef.(TextIndexDefinition)
+	if !ok || textIndexDef.GetTextIndex() == nil {
+		return nil, nil
+	}
+
+	textIndex := &TextIndex{}
+	for key, value := range textIndexDef.GetTextIndex() {
+		var ok bool
+		switch key {
+		case "fields":
+			textIndex.Fields, ok = value.([]string)
+		case "weights":
+			textIndex.Weights, ok = value.(map[string]int)
+		case "language":
+			textIndex.Language, ok = value.(string)
+		default:
+			return nil, ErrBackendError(fmt.Sprintf("unknown text index property %s", key))
+		}
+		if !ok {
+			return nil, ErrBackendError(fmt.Sprintf("invalid text index %s: %v", key, value))
+		}
+	}
+
+	if len(textIndex.Fields) == 0 {
+		return nil, ErrBackendError("text index must have at least one field")
+	}
+	fields := map[string]bool{}
+	for _, field := range textIndex.Fields {
+		if field == "" {
+			return nil, ErrBackendError("fields of the text index must not be empty")
+		}
+		fields[field] = true
+	}
+	for field, weight := range textIndex.Weights {
+		if !fields[field] {
+			return nil, ErrBackendError(fmt.Sprintf("weighted field %s is not a field of the text index", field))
+		}
+		if weight < 1 {
+			return nil, ErrBackendError(fmt.Sprintf("weight of the field %s must be at least 1, got %d", field, weight))
+		}
+	}
+	return textIndex, nil
+}
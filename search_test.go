@@ -0,0 +1,40 @@
+package backends
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRepositoryTextIndex(t *testing.T) {
+	textIndex, err := repositoryTextIndex(RepositoryDefinitionMap{
+		"name": "articles",
+		"textIndex": map[string]interface{}{
+			"fields":   []string{"title", "body"},
+			"weights":  map[string]int{"title": 10},
+			"language": "german",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(textIndex, &TextIndex{Fields: []string{"title", "body"}, Weights: map[string]int{"title": 10}, Language: "german"}) {
+		t.Fatal("Expected the text index of the definition. Got: ", textIndex)
+	}
+
+	if textIndex, err := repositoryTextIndex(RepositoryDefinitionMap{"name": "articles"}); err != nil || textIndex != nil {
+		t.Fatal("Expected no text index. Got: ", textIndex, err)
+	}
+
+	for _, properties := range []map[string]interface{}{
+		{},
+		{"fields": []string{""}},
+		{"fields": []interface{}{"title"}},
+		{"fields": []string{"title"}, "weights": map[string]int{"body": 2}},
+		{"fields": []string{"title"}, "weights": map[string]int{"title": 0}},
+		{"fields": []string{"title"}, "analyzer": "standard"},
+	} {
+		if _, err := repositoryTextIndex(RepositoryDefinitionMap{"textIndex": properties}); err == nil {
+			t.Fatal("Expected an error for the text index ", properties)
+		}
+	}
+}
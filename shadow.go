@@ -0,0 +1,235 @@
+package backends
+
+import (
+	"encoding/json"
+	"log"
+	"math/rand"
+	"reflect"
+	"sort"
+)
+
+// ShadowMismatch describes a read whose result from the shadow backend differs from the result of the primary backend.
+type ShadowMismatch struct {
+	// Operation is the operation (OperationGetOne or OperationGetAll).
+	Operation string
+	// Repository is the name of the repository.
+	Repository string
+	// Filter is the filter of the read.
+	Filter Filter
+	// Primary is the normalized (JSON decoded) result of the primary backend.
+	Primary interface{}
+	// PrimaryErr is the error returned by the primary backend.
+	PrimaryErr error
+	// Shadow is the normalized (JSON decoded) result of the shadow backend.
+	Shadow interface{}
+	// ShadowErr is the error returned by the shadow backend.
+	ShadowErr error
+}
+
+// ShadowReadOptions configures the shadow reads.
+type ShadowReadOptions struct {
+	// SampleRate is the fraction (0 to 1) of the reads that are also executed on the shadow backend.
+	SampleRate float64
+	// IgnoreFields are the fields that are left out of the comparison, for example backend specific fields.
+	IgnoreFields []string
+	// IgnoreOrder compares the GetAll results regardless of their order.
+	IgnoreOrder bool
+	// OnMismatch is called for every mismatch. By default the mismatches are logged.
+	OnMismatch func(mismatch *ShadowMismatch)
+}
+
+// ShadowBackend is a Backend that serves the reads from the primary backend and verifies them against the shadow backend.
+type ShadowBackend struct {
+	Backend
+	shadow  Backend
+	options *ShadowReadOptions
+}
+
+// NewShadowBackend wraps the primary backend so the sampled reads (GetOne and GetAll) are also executed on the shadow
+// backend and the results are compared. The callers always get the result of the primary backend. The shadow reads
+// run in the background, so they don't add latency to the reads.
+// The writes go to the primary backend only - the shadow backend is expected to be populated by the migration.
+// This is meant for validating a migration to another backend before the cutover:
+//
+//	backend = backends.NewShadowBackend(mongoBackend, dynamoBackend, &backends.ShadowReadOptions{
+//		SampleRate:   0.1,
+//		IgnoreFields: []string{"_id"},
+//		IgnoreOrder:  true,
+//	})
+func NewShadowBackend(primary Backend, shadow Backend, options *ShadowReadOptions) Backend {
+	if options == nil {
+		options = &ShadowReadOptions{
+			SampleRate: 1,
+		}
+	}
+	return &ShadowBackend{
+		Backend: primary,
+		shadow:  shadow,
+		options: options,
+	}
+}
+
+// DefineRepository defines the repository on both the primary and the shadow backend.
+func (b *ShadowBackend) DefineRepository(name string, def RepositoryDefinition) (Repository, error) {
+	repo, err := b.Backend.DefineRepository(name, def)
+	if err != nil {
+		return nil, err
+	}
+	shadowRepo, err := b.shadow.DefineRepository(name, def)
+	if err != nil {
+		return nil, err
+	}
+	return NewShadowRepository(name, repo, shadowRepo, b.options), nil
+}
+
+// GetRepository returns the repository from the primary backend, shadowed by the repository from the shadow backend.
+// If the repository is not defined on the shadow backend, the primary repository is returned unchanged.
+func (b *ShadowBackend) GetRepository(name string) (Repository, error) {
+	repo, err := b.Backend.GetRepository(name)
+	if err != nil {
+		return nil, err
+	}
+	shadowRepo, err := b.shadow.GetRepository(name)
+	if err != nil {
+		return repo, nil
+	}
+	return NewShadowRepository(name, repo, shadowRepo, b.options), nil
+}
+
+// Shutdown shuts down both backends.
+func (b *ShadowBackend) Shutdown() {
+	b.Backend.Shutdown()
+	b.shadow.Shutdown()
+}
+
+// ShadowRepository is a Repository that verifies the reads against a shadow repository.
+type ShadowRepository struct {
+	Repository
+	name    string
+	shadow  Repository
+	options *ShadowReadOptions
+}
+
+// NewShadowRepository wraps the repository so the sampled reads are verified against the shadow repository.
+func NewShadowRepository(name string, repo Repository, shadow Repository, options *ShadowReadOptions) Repository {
+	return &ShadowRepository{
+		Repository: repo,
+		name:       name,
+		shadow:     shadow,
+		options:    options,
+	}
+}
+
+// GetOne fetches only one record for given filter from the primary repository.
+func (r *ShadowRepository) GetOne(filter Filter, result interface{}) (interface{}, error) {
+	var shadowResult interface{}
+	if result != nil {
+		example, err := CreateNewAsExample(result)
+		if err != nil {
+			return nil, err
+		}
+		shadowResult = example
+	}
+
+	primary, err := r.Repository.GetOne(filter, result)
+	r.verify(OperationGetOne, filter, primary, err, func() (interface{}, error) {
+		return r.shadow.GetOne(filter, shadowResult)
+	})
+	return primary, err
+}
+
+// GetAll fetches all matched records for given filter from the primary repository.
+func (r *ShadowRepository) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	primary, err := r.Repository.GetAll(filter, resultsTypeHint, order, sorting, limit, offset)
+	r.verify(OperationGetAll, filter, primary, err, func() (interface{}, error) {
+		return r.shadow.GetAll(filter, resultsTypeHint, order, sorting, limit, offset)
+	})
+	return primary, err
+}
+
+// verify runs the shadow read in the background (if sampled) and compares the results.
+func (r *ShadowRepository) verify(operation string, filter Filter, primary interface{}, primaryErr error, read func() (interface{}, error)) {
+	if r.options.SampleRate <= 0 || (r.options.SampleRate < 1 && rand.Float64() >= r.options.SampleRate) {
+		return
+	}
+
+	// the primary result is normalized right away, because the caller may change it after the read returns
+	primaryValue := r.normalize(primary, primaryErr, operation)
+
+	go func() {
+		shadow, shadowErr := read()
+		shadowValue := r.normalize(shadow, shadowErr, operation)
+
+		if sameErrorClass(primaryErr, shadowErr) && reflect.DeepEqual(primaryValue, shadowValue) {
+			return
+		}
+
+		mismatch := &ShadowMismatch{
+			Operation:  operation,
+			Repository: r.name,
+			Filter:     filter,
+			Primary:    primaryValue,
+			PrimaryErr: primaryErr,
+			Shadow:     shadowValue,
+			ShadowErr:  shadowErr,
+		}
+		if r.options.OnMismatch != nil {
+			r.options.OnMismatch(mismatch)
+			return
+		}
+		log.Printf("shadow read mismatch on %s.%s (filter %v): primary=%v (err: %v), shadow=%v (err: %v)",
+			mismatch.Repository, mismatch.Operation, mismatch.Filter, mismatch.Primary, mismatch.PrimaryErr, mismatch.Shadow, mismatch.ShadowErr)
+	}()
+}
+
+// normalize converts the result to generic JSON values, without the ignored fields.
+func (r *ShadowRepository) normalize(result interface{}, err error, operation string) interface{} {
+	if err != nil || result == nil {
+		return nil
+	}
+
+	normalized, nerr := normalizeValue(result)
+	if nerr != nil {
+		return nil
+	}
+
+	if operation == OperationGetOne {
+		return r.withoutIgnored(normalized)
+	}
+
+	items, ok := normalized.([]interface{})
+	if !ok {
+		return normalized
+	}
+	for i, item := range items {
+		items[i] = r.withoutIgnored(item)
+	}
+	if r.options.IgnoreOrder {
+		sort.Slice(items, func(i, j int) bool {
+			a, _ := json.Marshal(items[i])
+			b, _ := json.Marshal(items[j])
+			return string(a) < string(b)
+		})
+	}
+	return items
+}
+
+func (r *ShadowRepository) withoutIgnored(value interface{}) interface{} {
+	record, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	for _, field := range r.options.IgnoreFields {
+		delete(record, field)
+	}
+	return record
+}
+
+// sameErrorClass checks if both errors are nil, or both are not nil with the same error message
+// (the error class for the BackendErrorInfo errors, like "not found").
+func sameErrorClass(a, b error) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Error() == b.Error()
+}
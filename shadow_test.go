@@ -0,0 +1,91 @@
+package backends
+
+import (
+	"testing"
+	"time"
+)
+
+func TestShadowRepository(t *testing.T) {
+	primary := newTestRepository()
+	shadow := newTestRepository()
+
+	for _, repo := range []*testRepository{primary, shadow} {
+		repo.Save(&map[string]interface{}{"id": "1", "name": "John"}, nil)
+		repo.Save(&map[string]interface{}{"id": "2", "name": "Jane"}, nil)
+	}
+	shadow.Save(&map[string]interface{}{"id": "3", "name": "Only in shadow"}, nil)
+
+	mismatches := make(chan *ShadowMismatch, 10)
+	repo := NewShadowRepository("users", primary, shadow, &ShadowReadOptions{
+		SampleRate: 1,
+		OnMismatch: func(mismatch *ShadowMismatch) {
+			mismatches <- mismatch
+		},
+	})
+
+	result, err := repo.GetOne(NewFilter().Match("id", "1"), &map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (*result.(*map[string]interface{}))["name"] != "John" {
+		t.Fatal("Expected the primary result. Got: ", result)
+	}
+
+	if _, err = repo.GetOne(NewFilter().Match("id", "3"), &map[string]interface{}{}); err == nil {
+		t.Fatal("Expected the primary not found error")
+	}
+	select {
+	case mismatch := <-mismatches:
+		if mismatch.Operation != OperationGetOne || mismatch.PrimaryErr == nil || mismatch.ShadowErr != nil {
+			t.Fatal("Invalid mismatch: ", mismatch)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a mismatch for the record missing from the primary")
+	}
+
+	if _, err = repo.GetAll(nil, map[string]interface{}{}, "", "", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case mismatch := <-mismatches:
+		if mismatch.Operation != OperationGetAll {
+			t.Fatal("Invalid mismatch: ", mismatch)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a mismatch for GetAll")
+	}
+
+	select {
+	case mismatch := <-mismatches:
+		t.Fatal("Unexpected mismatch: ", mismatch)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestShadowRepositoryIgnoreOrder(t *testing.T) {
+	primary := newTestRepository()
+	shadow := newTestRepository()
+	primary.Save(&map[string]interface{}{"id": "1", "_id": "a"}, nil)
+	primary.Save(&map[string]interface{}{"id": "2", "_id": "b"}, nil)
+	shadow.Save(&map[string]interface{}{"id": "2"}, nil)
+	shadow.Save(&map[string]interface{}{"id": "1"}, nil)
+
+	mismatches := make(chan *ShadowMismatch, 1)
+	repo := NewShadowRepository("users", primary, shadow, &ShadowReadOptions{
+		SampleRate:   1,
+		IgnoreFields: []string{"_id"},
+		IgnoreOrder:  true,
+		OnMismatch: func(mismatch *ShadowMismatch) {
+			mismatches <- mismatch
+		},
+	})
+
+	if _, err := repo.GetAll(nil, map[string]interface{}{}, "", "", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case mismatch := <-mismatches:
+		t.Fatal("Unexpected mismatch: ", mismatch)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
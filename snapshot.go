@@ -0,0 +1,147 @@
+package backends
+
+import "time"
+
+// RepositoryDefinitionProvider is implemented by the backends that keep the definitions of their repositories,
+// like RepositoriesBackend.
+type RepositoryDefinitionProvider interface {
+	GetRepositoryDefinition(name string) (RepositoryDefinition, error)
+}
+
+// SnapshotOptions configures a repository snapshot.
+type SnapshotOptions struct {
+	// Definition is the definition of the repository. Default is the definition the repository was defined with,
+	// if the backend keeps it (see RepositoryDefinitionProvider).
+	Definition RepositoryDefinition
+	// BatchSize is the number of records copied at once. Default is 100.
+	BatchSize int
+	// Pause is the time to wait between the batches, so the snapshot does not saturate the backend. Default is no pause.
+	Pause time.Duration
+}
+
+// SnapshotInfo describes a repository snapshot.
+type SnapshotInfo struct {
+	// Name is the name of the snapshot repository: <repository>_snapshot_<time of the snapshot in UTC>.
+	Name string
+	// Repository is the snapshot repository.
+	Repository Repository
+	// Records is the number of the copied records.
+	Records int
+	// CreatedAt is the time of the snapshot.
+	CreatedAt time.Time
+}
+
+// snapshotDefinition is the definition of a snapshot repository: the definition of the original repository,
+// with the snapshot name and without TTL. The DynamoDB settings are the ones of the original repository.
+type snapshotDefinition struct {
+	RepositoryDefinition
+	DynamoDefinition
+	name string
+}
+
+// GetName returns the name of the snapshot repository.
+func (d *snapshotDefinition) GetName() string {
+	return d.name
+}
+
+// EnableTTL returns false - the records in a snapshot never expire.
+func (d *snapshotDefinition) EnableTTL() bool {
+	return false
+}
+
+// GetCodec returns the codec of the original repository, so the snapshot is stored the same way.
+func (d *snapshotDefinition) GetCodec() string {
+	if codecDef, ok := d.RepositoryDefinition.(CodecDefinition); ok {
+		return codecDef.GetCodec()
+	}
+	return ""
+}
+
+// Snapshot copies the current contents of the repository into a new repository on the same backend, named
+// <repository>_snapshot_<time>, for example "users_snapshot_20190102T150405Z". The snapshot has the same definition
+// (indexes, keys) as the repository, except TTL. Take a snapshot before a risky migration, or to create a reproducible
+// test dataset:
+//
+//	snapshot, err := backends.Snapshot(backend, "users", &backends.SnapshotOptions{Pause: 100 * time.Millisecond})
+//
+// The records are copied in batches with low priority (see WithPriority), ordered by the record key (the hash key if set,
+// otherwise "id"). The snapshot is not atomic: the records saved or deleted while the snapshot is taken may or may
+// not be in the snapshot. If the copy fails, the partial snapshot is returned with the error.
+func Snapshot(backend Backend, name string, options *SnapshotOptions) (*SnapshotInfo, error) {
+	if options == nil {
+		options = &SnapshotOptions{}
+	}
+	batchSize := options.BatchSize
+	if batchSize < 1 {
+		batchSize = 100
+	}
+
+	repo, err := backend.GetRepository(name)
+	if err != nil {
+		return nil, err
+	}
+
+	def := options.Definition
+	if def == nil {
+		provider, ok := backend.(RepositoryDefinitionProvider)
+		if !ok {
+			return nil, ErrNotSupported("the backend does not keep the repository definitions, set the definition in the options")
+		}
+		if def, err = provider.GetRepositoryDefinition(name); err != nil {
+			return nil, err
+		}
+	}
+
+	createdAt := time.Now().UTC()
+	info := &SnapshotInfo{
+		Name:      name + "_snapshot_" + createdAt.Format("20060102T150405Z"),
+		CreatedAt: createdAt,
+	}
+
+	if _, err := backend.GetRepository(info.Name); err == nil {
+		return nil, ErrAlreadyExists("snapshot " + info.Name + " already exists")
+	}
+
+	snapshot, err := backend.DefineRepository(info.Name, &snapshotDefinition{
+		RepositoryDefinition: def,
+		DynamoDefinition:     dynamoDefinition(def),
+		name:                 info.Name,
+	})
+	if err != nil {
+		return nil, err
+	}
+	info.Repository = snapshot
+
+	order := def.GetHashKey()
+	if order == "" {
+		order = "id"
+	}
+	source := WithPriority(repo, PriorityLow)
+	target := WithPriority(snapshot, PriorityLow)
+
+	for offset := 0; ; offset += batchSize {
+		if offset > 0 && options.Pause > 0 {
+			time.Sleep(options.Pause)
+		}
+
+		results, err := source.GetAll(nil, &map[string]interface{}{}, order, "asc", batchSize, offset)
+		if err != nil {
+			return info, err
+		}
+		records, err := syncRecords(results)
+		if err != nil {
+			return info, err
+		}
+
+		for _, record := range records {
+			if _, err := target.Save(&record, nil); err != nil {
+				return info, err
+			}
+			info.Records++
+		}
+
+		if len(records) < batchSize {
+			return info, nil
+		}
+	}
+}
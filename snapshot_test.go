@@ -0,0 +1,68 @@
+package backends
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func TestSnapshot(t *testing.T) {
+	backend, err := CacheBackendBuilder(&config.DBInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Shutdown()
+
+	repo, err := backend.DefineRepository("users", RepositoryDefinitionMap{
+		"name":      "users",
+		"enableTtl": true,
+		"ttl":       3600,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := repo.Save(&map[string]interface{}{"id": fmt.Sprintf("user-%d", i), "index": i}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snapshot, err := Snapshot(backend, "users", &SnapshotOptions{BatchSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(snapshot.Name, "users_snapshot_") || snapshot.Records != 5 {
+		t.Fatal("Unexpected snapshot", snapshot)
+	}
+
+	// the snapshot is not affected by the later changes
+	if err := repo.DeleteAll(nil); err != nil {
+		t.Fatal(err)
+	}
+	snapshotRepo, err := backend.GetRepository(snapshot.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := snapshotRepo.GetAll(nil, &map[string]interface{}{}, "id", "asc", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := *results.(*[]*map[string]interface{})
+	if len(list) != 5 || (*list[4])["id"] != "user-4" {
+		t.Fatal("Expected all users in the snapshot, got", list)
+	}
+
+	def, err := backend.(RepositoryDefinitionProvider).GetRepositoryDefinition(snapshot.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if def.GetName() != snapshot.Name || def.EnableTTL() {
+		t.Fatal("Expected the snapshot definition without TTL, got", def)
+	}
+
+	if _, err := Snapshot(backend, "missing", nil); err == nil {
+		t.Fatal("Expected error for an unknown repository")
+	}
+}
@@ -0,0 +1,242 @@
+package backends
+
+import (
+	"time"
+)
+
+// SoftDeleteField is the property that holds the deletion time of the records of the soft-delete repositories, in
+// milliseconds since the epoch. It is 0 for the records that are not deleted.
+const SoftDeleteField = "deletedAt"
+
+// SoftDeleteDefinition is implemented by the repository definitions that enable soft deletes.
+// RepositoryDefinitionMap implements it with the "softDelete" property.
+type SoftDeleteDefinition interface {
+	IsSoftDelete() bool
+}
+
+// IsSoftDelete returns true if the records of the repository are soft-deleted (see SoftDeleteRepository).
+func (m RepositoryDefinitionMap) IsSoftDelete() bool {
+	if softDelete, ok := m["softDelete"]; ok {
+		return softDelete.(bool)
+	}
+
+	return false
+}
+
+// SoftDeleteRepository is a Repository whose deletions only mark the records as deleted, so they can be restored:
+//
+//	userRepo, err := backend.DefineRepository("users", backends.RepositoryDefinitionMap{
+//		"name":       "users",
+//		"softDelete": true,
+//	})
+//
+//	err = userRepo.DeleteOne(backends.NewFilter().Match("id", id)) // sets "deletedAt"
+//	_, err = userRepo.(*backends.SoftDeleteRepository).Restore(backends.NewFilter().Match("id", id))
+//
+// The deleted records have the time of the deletion in the "deletedAt" property, and the other records have 0. The
+// reads, counts and updates see only the records that are not deleted, unless the filter matches "deletedAt"
+// explicitly. The records saved before soft deletes were enabled must be updated with "deletedAt": 0, or they are
+// not found. The deleted records are removed for good with PurgeDeleted.
+type SoftDeleteRepository struct {
+	Repository
+	pageSize int
+}
+
+// NewSoftDeleteRepository wraps the repository so its records are soft-deleted.
+func NewSoftDeleteRepository(repo Repository) *SoftDeleteRepository {
+	return &SoftDeleteRepository{
+		Repository: repo,
+		pageSize:   100,
+	}
+}
+
+// withSoftDelete wraps the repository with SoftDeleteRepository if the definition enables soft deletes.
+func withSoftDelete(repo Repository, def RepositoryDefinition) Repository {
+	softDeleteDef, ok := def.(SoftDeleteDefinition)
+	if !ok || !softDeleteDef.IsSoftDelete() {
+		return repo
+	}
+	return NewSoftDeleteRepository(repo)
+}
+
+// wrapped returns the wrapped repository, so the transactions can wrap their repository the same way.
+func (r *SoftDeleteRepository) wrapped() Repository {
+	return r.Repository
+}
+
+// GetOne fetches the first record matched by the filter that is not deleted.
+func (r *SoftDeleteRepository) GetOne(filter Filter, result interface{}) (interface{}, error) {
+	return r.Repository.GetOne(r.live(filter), result)
+}
+
+// GetAll fetches the records matched by the filter that are not deleted.
+func (r *SoftDeleteRepository) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	return r.Repository.GetAll(r.live(filter), resultsTypeHint, order, sorting, limit, offset)
+}
+
+// Count counts the records matched by the filter that are not deleted.
+func (r *SoftDeleteRepository) Count(filter Filter) (int64, error) {
+	return r.Repository.Count(r.live(filter))
+}
+
+// Exists checks if a record that is not deleted matches the filter.
+func (r *SoftDeleteRepository) Exists(filter Filter) (bool, error) {
+	return r.Repository.Exists(r.live(filter))
+}
+
+// Save creates the record as not deleted if the filter is nil. Otherwise it updates the first record matched by
+// the filter that is not deleted. The deletion time can not be changed with Save.
+func (r *SoftDeleteRepository) Save(object interface{}, filter Filter) (interface{}, error) {
+	payload, err := InterfaceToMap(object)
+	if err != nil {
+		return nil, err
+	}
+
+	if filter == nil {
+		(*payload)[SoftDeleteField] = 0
+		return r.Repository.Save(payload, nil)
+	}
+	delete(*payload, SoftDeleteField)
+	return r.Repository.Save(payload, r.live(filter))
+}
+
+// SaveAll creates the records as not deleted.
+func (r *SoftDeleteRepository) SaveAll(objects interface{}) (interface{}, error) {
+	records, err := objectsToRecords(objects)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		record[SoftDeleteField] = 0
+	}
+	return r.Repository.SaveAll(records)
+}
+
+// UpdateAll updates the records matched by the filter that are not deleted. The deletion time can not be changed
+// with UpdateAll.
+func (r *SoftDeleteRepository) UpdateAll(filter Filter, update interface{}) (int64, error) {
+	payload, err := InterfaceToMap(update)
+	if err != nil {
+		return 0, err
+	}
+	delete(*payload, SoftDeleteField)
+	return r.Repository.UpdateAll(r.live(filter), payload)
+}
+
+// DeleteOne marks the first record matched by the filter as deleted. Returns ErrNotFound if no record that is not
+// deleted matches the filter.
+func (r *SoftDeleteRepository) DeleteOne(filter Filter) error {
+	record := map[string]interface{}{}
+	if _, err := r.Repository.GetOne(r.live(filter), &record); err != nil {
+		return err
+	}
+	updated, err := r.Repository.UpdateAll(NewFilter().Match("id", record["id"]).Match(SoftDeleteField, 0), &map[string]interface{}{
+		SoftDeleteField: syncNow(),
+	})
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		// deleted concurrently
+		return ErrNotFound("record not found")
+	}
+	return nil
+}
+
+// DeleteAll marks the records matched by the filter as deleted.
+func (r *SoftDeleteRepository) DeleteAll(filter Filter) error {
+	_, err := r.Repository.UpdateAll(r.live(filter), &map[string]interface{}{
+		SoftDeleteField: syncNow(),
+	})
+	return err
+}
+
+// Restore restores the deleted records matched by the filter. Returns the number of restored records.
+func (r *SoftDeleteRepository) Restore(filter Filter) (int, error) {
+	results, err := r.Repository.GetAll(cloneFilter(filter), &map[string]interface{}{}, "", "", 0, 0)
+	if err != nil {
+		return 0, err
+	}
+	records, err := syncRecords(results)
+	if err != nil {
+		return 0, err
+	}
+
+	restored := 0
+	for _, record := range records {
+		deletedAt, ok := syncTimestamp(record[SoftDeleteField])
+		if !ok || deletedAt == 0 {
+			continue
+		}
+		updated, err := r.Repository.UpdateAll(NewFilter().Match("id", record["id"]).Match(SoftDeleteField, deletedAt), &map[string]interface{}{
+			SoftDeleteField: 0,
+		})
+		if err != nil {
+			return restored, err
+		}
+		restored += int(updated)
+	}
+	return restored, nil
+}
+
+// PurgeDeleted removes the records deleted before the given time for good. Returns the number of purged records.
+func (r *SoftDeleteRepository) PurgeDeleted(before time.Time) (int, error) {
+	limit := before.UnixNano() / int64(time.Millisecond)
+
+	expired := []map[string]interface{}{}
+	// the deleted records come first, the most recently deleted at the top
+	for offset := 0; ; offset += r.pageSize {
+		results, err := r.Repository.GetAll(nil, &map[string]interface{}{}, SoftDeleteField, "desc", r.pageSize, offset)
+		if err != nil {
+			return 0, err
+		}
+		page, err := syncRecords(results)
+		if err != nil {
+			return 0, err
+		}
+
+		done := len(page) < r.pageSize
+		for _, record := range page {
+			deletedAt, ok := syncTimestamp(record[SoftDeleteField])
+			if !ok {
+				continue
+			}
+			if deletedAt == 0 {
+				done = true
+				break
+			}
+			if deletedAt < limit {
+				expired = append(expired, record)
+			}
+		}
+		if done {
+			break
+		}
+	}
+
+	purged := 0
+	for _, record := range expired {
+		err := r.Repository.DeleteOne(NewFilter().Match("id", record["id"]).Match(SoftDeleteField, record[SoftDeleteField]))
+		if err != nil {
+			if IsErrNotFound(err) {
+				// restored or purged concurrently
+				continue
+			}
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// live restricts the filter to the records that are not deleted, unless it matches the deletion time explicitly.
+func (r *SoftDeleteRepository) live(filter Filter) Filter {
+	live := cloneFilter(filter)
+	if live == nil {
+		live = NewFilter()
+	}
+	if _, ok := live[SoftDeleteField]; !ok {
+		live.Match(SoftDeleteField, 0)
+	}
+	return live
+}
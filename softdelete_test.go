@@ -0,0 +1,90 @@
+package backends
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func TestSoftDeleteRepository(t *testing.T) {
+	backend, err := CacheBackendBuilder(&config.DBInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Shutdown()
+
+	repo, err := backend.DefineRepository("users", RepositoryDefinitionMap{
+		"name":       "users",
+		"softDelete": true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	softDelete, ok := repo.(*SoftDeleteRepository)
+	if !ok {
+		t.Fatal("Expected a soft-delete repository")
+	}
+
+	if _, err := repo.Save(&map[string]interface{}{"id": "1", "name": "John"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.SaveAll([]map[string]interface{}{{"id": "2", "name": "Jane"}, {"id": "3", "name": "Jim"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.DeleteOne(NewFilter().Match("id", "1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.DeleteOne(NewFilter().Match("id", "1")); err == nil || !IsErrNotFound(err) {
+		t.Fatal("Expected not found error for the deleted record. Got: ", err)
+	}
+	if _, err := repo.GetOne(NewFilter().Match("id", "1"), nil); err == nil || !IsErrNotFound(err) {
+		t.Fatal("Expected the deleted record to be hidden. Got: ", err)
+	}
+	if count, err := repo.Count(nil); err != nil || count != 2 {
+		t.Fatal("Expected 2 records that are not deleted. Got: ", count, err)
+	}
+	if _, err := repo.Save(&map[string]interface{}{"name": "Johnny"}, NewFilter().Match("id", "1")); err == nil || !IsErrNotFound(err) {
+		t.Fatal("Expected not found error for an update of the deleted record. Got: ", err)
+	}
+
+	deleted, err := softDelete.Repository.GetOne(NewFilter().Match("id", "1"), &map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if at, ok := syncTimestamp((*deleted.(*map[string]interface{}))[SoftDeleteField]); !ok || at == 0 {
+		t.Fatal("Expected the deletion time to be set. Got: ", deleted)
+	}
+
+	restored, err := softDelete.Restore(NewFilter().Match("id", "1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored != 1 {
+		t.Fatal("Expected 1 restored record. Got: ", restored)
+	}
+	if exists, err := repo.Exists(NewFilter().Match("id", "1")); err != nil || !exists {
+		t.Fatal("Expected the restored record to be found. Got: ", exists, err)
+	}
+
+	if err := repo.DeleteAll(NewFilter().Match("name", "Jane")); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.DeleteOne(NewFilter().Match("id", "3")); err != nil {
+		t.Fatal(err)
+	}
+	purged, err := softDelete.PurgeDeleted(time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 2 {
+		t.Fatal("Expected 2 purged records. Got: ", purged)
+	}
+	if count, err := softDelete.Repository.Count(nil); err != nil || count != 1 {
+		t.Fatal("Expected only the restored record to be left. Got: ", count, err)
+	}
+	if restored, err := softDelete.Restore(NewFilter().Match("id", "2")); err != nil || restored != 0 {
+		t.Fatal("Expected the purged record not to be restored. Got: ", restored, err)
+	}
+}
@@ -0,0 +1,826 @@
+package backends
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+	"github.com/satori/go.uuid"
+)
+
+// SQL_CTX_KEY is SQL database context key
+var SQL_CTX_KEY = "SQL_DATABASE"
+
+// sqlKeyColumn and sqlDataColumn are the columns of every SQL table: the record key and the record JSON.
+const (
+	sqlKeyColumn  = "id"
+	sqlDataColumn = "data"
+)
+
+// SQLIndex is an index of a SQL table. Every index of the repository is stored in its own column,
+// as the JSON encoded array of the values of the index fields (NULL if a field is missing).
+type SQLIndex struct {
+	Name   string
+	Column string
+	Unique bool
+}
+
+// SQLTable describes the table of a repository.
+type SQLTable struct {
+	Name       string
+	KeyColumn  string
+	DataColumn string
+	// Binary is true if the data column holds binary data (the records are stored with a binary codec).
+	Binary  bool
+	Indexes []SQLIndex
+}
+
+// Columns returns all columns of the table: the key column, the data column and the index columns.
+func (t *SQLTable) Columns() []string {
+	columns := []string{t.KeyColumn, t.DataColumn}
+	for _, index := range t.Indexes {
+		columns = append(columns, index.Column)
+	}
+	return columns
+}
+
+// SQLDialect is the part of a SQL backend that differs between the databases. The records are always stored
+// the same way, so a new relational backend only needs a dialect (and a database/sql driver):
+//
+//	manager.SupportBackend("postgres", backends.NewSQLBackendBuilder("postgres", backends.PostgresDialect{}), props)
+type SQLDialect interface {
+	// DataSourceName returns the driver specific data source name for the configuration.
+	DataSourceName(conf *config.DBInfo) (string, error)
+	// Quote quotes the identifier (table, column or index name).
+	Quote(identifier string) string
+	// Placeholder returns the placeholder of the n-th (starting from 1) statement argument.
+	Placeholder(n int) string
+	// CreateTable returns the statements that create the table and its indexes, if they don't exist.
+	CreateTable(table *SQLTable) []string
+	// Upsert returns the statement that inserts a row with the given columns, or updates the row with the same key.
+	Upsert(table *SQLTable) string
+	// IsUniqueViolation returns true if the error is caused by a duplicate key or a unique index violation.
+	IsUniqueViolation(err error) bool
+}
+
+// SQLQuery is a raw query of a SQLCollection (see RawQuerier): a clause of the SELECT of the records of the table,
+// with its arguments. The placeholders of the arguments are those of the database, and the data column holds the
+// records encoded with the codec of the repository (JSON by default), so with PostgreSQL for example:
+//
+//	&backends.SQLQuery{Clause: "WHERE (data::jsonb->>'age')::int >= $1 ORDER BY data::jsonb->>'name'", Args: []interface{}{18}}
+type SQLQuery struct {
+	Clause string
+	Args   []interface{}
+}
+
+// sqlDatabase is the database and the dialect of a SQL backend.
+type sqlDatabase struct {
+	db      *sql.DB
+	dialect SQLDialect
+}
+
+// sqlQuerier is implemented by *sql.DB and *sql.Tx.
+type sqlQuerier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// sqlIdentifierChars matches the characters that are replaced in the generated column names.
+var sqlIdentifierChars = regexp.MustCompile("[^a-zA-Z0-9_]")
+
+// SQLCollection is a repository stored in a SQL table.
+// Every record is stored with the codec of the repository (JSON by default, see Codec), together with its key (the hash key if set, otherwise "id") and its index values.
+// The filters with an exact match on the key, or on all fields of an index, are served by the database;
+// all records are then matched, sorted and paginated in memory. Unique indexes are enforced by the database.
+// The indexes are created with the table; the indexes added to an existing repository are not created.
+// TTL is not supported.
+type SQLCollection struct {
+	db      *sql.DB
+	dialect SQLDialect
+	table   *SQLTable
+	codec   Codec
+	repoDef RepositoryDefinition
+}
+
+// NewSQLBackendBuilder returns the builder of SQL backends for the database/sql driver and the dialect.
+// The driver must be registered by importing it in the service, for example:
+//
+//	import _ "github.com/lib/pq"
+func NewSQLBackendBuilder(driverName string, dialect SQLDialect) BackendBuilder {
+	return func(conf *config.DBInfo, manager BackendManager) (Backend, error) {
+		dsn, err := dialect.DataSourceName(conf)
+		if err != nil {
+			return nil, err
+		}
+
+		db, err := sql.Open(driverName, dsn)
+		if err != nil {
+			return nil, ErrBackendError(fmt.Sprintf("cannot open %s database (is the driver imported?): %s", driverName, err.Error()))
+		}
+		if err := db.Ping(); err != nil {
+			db.Close()
+			return nil, err
+		}
+
+		ctx := context.WithValue(context.Background(), SQL_CTX_KEY, &sqlDatabase{
+			db:      db,
+			dialect: dialect,
+		})
+		cleanup := func() {
+			db.Close()
+		}
+
+		return NewRepositoriesBackend(ctx, conf, SQLRepoBuilder, cleanup), nil
+	}
+}
+
+// SQLRepoBuilder builds new SQL repository (table). If the table does not exist, builder will create it.
+func SQLRepoBuilder(repoDef RepositoryDefinition, backend Backend) (Repository, error) {
+
+	dbObj := backend.GetFromContext(SQL_CTX_KEY)
+	if dbObj == nil {
+		return nil, ErrBackendError("sql database not configured")
+	}
+
+	database, ok := dbObj.(*sqlDatabase)
+	if !ok {
+		return nil, ErrBackendError("unknown database type")
+	}
+
+	tableName := repoDef.GetName()
+	if tableName == "" {
+		return nil, ErrBackendError("table name is missing and required")
+	}
+
+	if repoDef.EnableTTL() {
+		return nil, ErrBackendError("TTL is not supported by the sql backends")
+	}
+
+	codec, err := codecFor(repoDef)
+	if err != nil {
+		return nil, err
+	}
+
+	table := &SQLTable{
+		Name:       tableName,
+		KeyColumn:  sqlKeyColumn,
+		DataColumn: sqlDataColumn,
+		Binary:     codec.Binary(),
+		Indexes:    []SQLIndex{},
+	}
+	for _, index := range repoDef.GetIndexes() {
+		name := sqlIdentifierChars.ReplaceAllString(index.GetName(), "_")
+		table.Indexes = append(table.Indexes, SQLIndex{
+			Name:   tableName + "_" + name,
+			Column: "idx_" + name,
+			Unique: index.Unique(),
+		})
+	}
+
+	for _, statement := range database.dialect.CreateTable(table) {
+		if _, err := database.db.Exec(statement); err != nil {
+			return nil, err
+		}
+	}
+
+	return &SQLCollection{
+		db:      database.db,
+		dialect: database.dialect,
+		table:   table,
+		codec:   codec,
+		repoDef: repoDef,
+	}, nil
+}
+
+// GetOne fetches only one record for given filter
+func (c *SQLCollection) GetOne(filter Filter, result interface{}) (interface{}, error) {
+	records, err := c.find(c.db, filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrNotFound("record not found")
+	}
+
+	err = MapToInterface(&records[0], &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetAll fetches all matched records for given filter
+func (c *SQLCollection) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	records, err := c.find(c.db, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err = filterRecords(records, nil, order, sorting, limit, offset)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+
+	return recordsToResults(records, resultsTypeHint)
+}
+
+// Count returns the number of records that match the filter. The rows are counted by the database if the filter
+// is empty or an exact match on the key, otherwise the records are matched in memory.
+func (c *SQLCollection) Count(filter Filter) (int64, error) {
+	keyValue, byKey := filter[c.keyProperty()]
+	if len(filter) == 0 || (len(filter) == 1 && byKey && !isFilterSpec(keyValue)) {
+		query := fmt.Sprintf("SELECT COUNT(*) FROM %s", c.dialect.Quote(c.table.Name))
+		condition, args, err := c.where(filter)
+		if err != nil {
+			return 0, err
+		}
+		if condition != "" {
+			query += " WHERE " + condition
+		}
+
+		var count int64
+		if err := c.db.QueryRow(query, args...).Scan(&count); err != nil {
+			return 0, err
+		}
+		return count, nil
+	}
+
+	records, err := c.find(c.db, filter)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(records)), nil
+}
+
+// Exists reports whether a record matches the filter. A key lookup or an empty filter is answered with
+// SELECT 1 without reading the record data.
+func (c *SQLCollection) Exists(filter Filter) (bool, error) {
+	keyValue, byKey := filter[c.keyProperty()]
+	if len(filter) == 0 || (len(filter) == 1 && byKey && !isFilterSpec(keyValue)) {
+		query := fmt.Sprintf("SELECT 1 FROM %s", c.dialect.Quote(c.table.Name))
+		condition, args, err := c.where(filter)
+		if err != nil {
+			return false, err
+		}
+		if condition != "" {
+			query += " WHERE " + condition
+		}
+		query += " LIMIT 1"
+
+		var found int
+		err = c.db.QueryRow(query, args...).Scan(&found)
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	records, err := c.find(c.db, filter)
+	if err != nil {
+		return false, err
+	}
+	return len(records) > 0, nil
+}
+
+// Save creates new record unless it does not exist, otherwise it updates the record
+func (c *SQLCollection) Save(object interface{}, filter Filter) (interface{}, error) {
+
+	var result interface{}
+
+	payload, err := InterfaceToMap(object)
+	if err != nil {
+		return nil, err
+	}
+
+	keyProperty := c.keyProperty()
+	record := map[string]interface{}{}
+
+	if filter == nil {
+		for k, v := range *payload {
+			record[k] = v
+		}
+		if id, ok := record[keyProperty]; !ok || id == nil || id == "" {
+			id, err := uuid.NewV4()
+			if err != nil {
+				return nil, err
+			}
+			record[keyProperty] = id.String()
+		}
+
+		values, err := c.rowValues(record)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := c.db.Exec(c.insertStatement(), values...); err != nil {
+			if c.dialect.IsUniqueViolation(err) {
+				return nil, ErrAlreadyExists("record already exists!")
+			}
+			return nil, err
+		}
+	} else {
+		tx, err := c.db.Begin()
+		if err != nil {
+			return nil, err
+		}
+
+		records, err := c.find(tx, filter)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if len(records) == 0 {
+			tx.Rollback()
+			return nil, ErrNotFound("record not found")
+		}
+
+		record = records[0]
+		if err := c.update(tx, record, *payload); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+	}
+
+	err = MapToInterface(&record, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Upsert saves the record by its key: the record is created, or replaced if a record with the same key exists.
+// Unlike Save, the stored record is replaced and not merged with the object.
+func (c *SQLCollection) Upsert(object interface{}) (interface{}, error) {
+
+	var result interface{}
+
+	record, err := InterfaceToMap(object)
+	if err != nil {
+		return nil, err
+	}
+	if id, ok := (*record)[c.keyProperty()]; !ok || id == nil || id == "" {
+		return nil, ErrInvalidInput(fmt.Sprintf("%s is required", c.keyProperty()))
+	}
+
+	values, err := c.rowValues(*record)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.db.Exec(c.dialect.Upsert(c.table), values...); err != nil {
+		if c.dialect.IsUniqueViolation(err) {
+			return nil, ErrAlreadyExists("record already exists!")
+		}
+		return nil, err
+	}
+
+	err = MapToInterface(record, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// SaveAll creates the objects (a slice) as new records, in a single transaction. Returns the created records, as
+// returned by Save. Nothing is created if any of the records already exists or violates a unique index.
+func (c *SQLCollection) SaveAll(objects interface{}) (interface{}, error) {
+	records, err := objectsToRecords(objects)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	keyProperty := c.keyProperty()
+	saved := []interface{}{}
+	for _, record := range records {
+		if id, ok := record[keyProperty]; !ok || id == nil || id == "" {
+			id, err := uuid.NewV4()
+			if err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+			record[keyProperty] = id.String()
+		}
+
+		values, err := c.rowValues(record)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if _, err := tx.Exec(c.insertStatement(), values...); err != nil {
+			tx.Rollback()
+			if c.dialect.IsUniqueViolation(err) {
+				return nil, ErrAlreadyExists("record already exists!")
+			}
+			return nil, err
+		}
+
+		var result interface{}
+		if err := MapToInterface(&record, &result); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		saved = append(saved, result)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+// Patch sets the properties of set and removes the unset fields of the first matched record, in a transaction.
+// See Patch.
+func (c *SQLCollection) Patch(filter Filter, set interface{}, unset []string) (interface{}, error) {
+	var result interface{}
+
+	payload, err := InterfaceToMap(set)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := c.find(tx, filter)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if len(records) == 0 {
+		tx.Rollback()
+		return nil, ErrNotFound("record not found")
+	}
+
+	record := records[0]
+	for _, field := range unset {
+		if field != c.keyProperty() {
+			removeRecordPath(record, field)
+		}
+	}
+	if err := c.update(tx, record, *payload); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	err = MapToInterface(&record, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// UpdateAll updates all matched records for given filter with the properties of the update, in a single
+// transaction. Returns the number of the updated records.
+func (c *SQLCollection) UpdateAll(filter Filter, update interface{}) (int64, error) {
+	payload, err := InterfaceToMap(update)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	records, err := c.find(tx, filter)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	for _, record := range records {
+		if err := c.update(tx, record, *payload); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int64(len(records)), nil
+}
+
+// update sets the properties of the payload on the record, except the key, and updates its row in the transaction.
+func (c *SQLCollection) update(tx *sql.Tx, record map[string]interface{}, payload map[string]interface{}) error {
+	for k, v := range payload {
+		if k == c.keyProperty() {
+			// the key is immutable
+			continue
+		}
+		record[k] = v
+	}
+
+	values, err := c.rowValues(record)
+	if err != nil {
+		return err
+	}
+	// the key is the last argument of the update statement
+	values = append(values[1:], values[0])
+	if _, err := tx.Exec(c.updateStatement(), values...); err != nil {
+		if c.dialect.IsUniqueViolation(err) {
+			return ErrAlreadyExists("record already exists!")
+		}
+		return err
+	}
+	return nil
+}
+
+// DeleteOne deletes only one record for given filter
+func (c *SQLCollection) DeleteOne(filter Filter) error {
+	records, err := c.find(c.db, filter)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return ErrNotFound("record not found")
+	}
+
+	_, err = c.db.Exec(c.deleteStatement(), c.key(records[0][c.keyProperty()]))
+	return err
+}
+
+// DeleteAll deletes all matched records for given filter
+func (c *SQLCollection) DeleteAll(filter Filter) error {
+	if len(filter) == 0 {
+		_, err := c.db.Exec(fmt.Sprintf("DELETE FROM %s", c.dialect.Quote(c.table.Name)))
+		return err
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	records, err := c.find(tx, filter)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, record := range records {
+		if _, err := tx.Exec(c.deleteStatement(), c.key(record[c.keyProperty()])); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// keyProperty returns the name of the property used as record key - the hash key if set, otherwise "id".
+func (c *SQLCollection) keyProperty() string {
+	if hashKey := c.repoDef.GetHashKey(); hashKey != "" {
+		return hashKey
+	}
+	return "id"
+}
+
+// key returns the value of the key column for the record key.
+func (c *SQLCollection) key(value interface{}) string {
+	return fmt.Sprintf("%v", value)
+}
+
+// rowValues returns the values of all table columns for the record.
+func (c *SQLCollection) rowValues(record map[string]interface{}) ([]interface{}, error) {
+	data, err := c.codec.Marshal(record)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+
+	values := []interface{}{c.key(record[c.keyProperty()]), data}
+	if !c.codec.Binary() {
+		values[1] = string(data)
+	}
+	for _, index := range c.repoDef.GetIndexes() {
+		value, ok, err := sqlIndexValue(index, record)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			// sparse index - the record does not have all of the fields
+			values = append(values, nil)
+			continue
+		}
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+// sqlIndexValue returns the JSON encoded values of the index fields. The second return value is false
+// if any of the fields is missing.
+func sqlIndexValue(index Index, values map[string]interface{}) (string, bool, error) {
+	fields := []interface{}{}
+	for _, field := range index.GetFields() {
+		value, ok := values[field]
+		if !ok || value == nil {
+			return "", false, nil
+		}
+		fields = append(fields, value)
+	}
+
+	normalized, err := normalizeValue(fields)
+	if err != nil {
+		return "", false, ErrInvalidInput(err)
+	}
+	encoded, err := json.Marshal(normalized)
+	if err != nil {
+		return "", false, ErrInvalidInput(err)
+	}
+	return string(encoded), true, nil
+}
+
+// placeholders returns the comma separated placeholders for the arguments from..to (inclusive).
+func (c *SQLCollection) placeholders(from, to int) string {
+	placeholders := []string{}
+	for n := from; n <= to; n++ {
+		placeholders = append(placeholders, c.dialect.Placeholder(n))
+	}
+	return strings.Join(placeholders, ", ")
+}
+
+// quoteColumns returns the comma separated quoted column names.
+func (c *SQLCollection) quoteColumns(columns []string) string {
+	quoted := []string{}
+	for _, column := range columns {
+		quoted = append(quoted, c.dialect.Quote(column))
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func (c *SQLCollection) insertStatement() string {
+	columns := c.table.Columns()
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", c.dialect.Quote(c.table.Name), c.quoteColumns(columns), c.placeholders(1, len(columns)))
+}
+
+// updateStatement returns the statement that updates all columns but the key; the key is the last argument.
+func (c *SQLCollection) updateStatement() string {
+	columns := c.table.Columns()[1:]
+	assignments := []string{}
+	for i, column := range columns {
+		assignments = append(assignments, fmt.Sprintf("%s = %s", c.dialect.Quote(column), c.dialect.Placeholder(i+1)))
+	}
+	return fmt.Sprintf("UPDATE %s SET %s WHERE %s = %s", c.dialect.Quote(c.table.Name), strings.Join(assignments, ", "),
+		c.dialect.Quote(c.table.KeyColumn), c.dialect.Placeholder(len(columns)+1))
+}
+
+func (c *SQLCollection) deleteStatement() string {
+	return fmt.Sprintf("DELETE FROM %s WHERE %s = %s", c.dialect.Quote(c.table.Name), c.dialect.Quote(c.table.KeyColumn), c.dialect.Placeholder(1))
+}
+
+// where returns the condition that narrows the rows for the filter: an exact match on the key, or on all fields
+// of an index (unique indexes are preferred). Returns empty condition if the filter is not covered.
+func (c *SQLCollection) where(filter Filter) (string, []interface{}, error) {
+	if value, ok := filter[c.keyProperty()]; ok && !isFilterSpec(value) {
+		return fmt.Sprintf("%s = %s", c.dialect.Quote(c.table.KeyColumn), c.dialect.Placeholder(1)), []interface{}{c.key(value)}, nil
+	}
+
+	var found Index
+	var column string
+	for i, index := range c.repoDef.GetIndexes() {
+		covered := len(index.GetFields()) > 0
+		for _, field := range index.GetFields() {
+			value, ok := filter[field]
+			if !ok || isFilterSpec(value) {
+				covered = false
+				break
+			}
+		}
+		if covered && (found == nil || (index.Unique() && !found.Unique())) {
+			found = index
+			column = c.table.Indexes[i].Column
+		}
+	}
+	if found == nil {
+		return "", nil, nil
+	}
+
+	value, _, err := sqlIndexValue(found, filter)
+	if err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprintf("%s = %s", c.dialect.Quote(column), c.dialect.Placeholder(1)), []interface{}{value}, nil
+}
+
+// find returns the records that match the filter.
+func (c *SQLCollection) find(querier sqlQuerier, filter Filter) ([]map[string]interface{}, error) {
+	matcher, err := toRecordMatcher(filter)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s", c.dialect.Quote(c.table.DataColumn), c.dialect.Quote(c.table.Name))
+	condition, args, err := c.where(filter)
+	if err != nil {
+		return nil, err
+	}
+	if condition != "" {
+		query += " WHERE " + condition
+	}
+
+	return c.query(querier, query, args, matcher)
+}
+
+// Explain selects the rows narrowed by the key or an index (see where), and counts the rows read and the records
+// that match the filter. The query is a full scan if no index covers the filter. See ExplainRepository.
+func (c *SQLCollection) Explain(filter Filter, order string, sorting string) (*QueryPlan, error) {
+	matcher, err := toRecordMatcher(filter)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+	condition, args, err := c.where(filter)
+	if err != nil {
+		return nil, err
+	}
+	query := &SQLQuery{Args: args}
+	if condition != "" {
+		query.Clause = "WHERE " + condition
+	}
+
+	var scanned int64
+	start := time.Now()
+	statement := fmt.Sprintf("SELECT %s FROM %s %s", c.dialect.Quote(c.table.DataColumn), c.dialect.Quote(c.table.Name), query.Clause)
+	records, err := c.query(c.db, statement, args, func(record map[string]interface{}) bool {
+		scanned++
+		return matcher(record)
+	})
+	if err != nil {
+		return nil, ErrBackendError(err)
+	}
+
+	return &QueryPlan{
+		Backend:  "sql",
+		Query:    query,
+		FullScan: condition == "",
+		Scanned:  scanned,
+		Matched:  int64(len(records)),
+		Duration: time.Since(start),
+	}, nil
+}
+
+// RawQuery selects the records with the clause of the query (*SQLQuery). See RawQuerier.
+func (c *SQLCollection) RawQuery(query interface{}, resultsTypeHint interface{}) (interface{}, error) {
+	sqlQuery, ok := query.(*SQLQuery)
+	if !ok {
+		return nil, ErrInvalidInput(fmt.Sprintf("SQL raw query must be *SQLQuery, got %T", query))
+	}
+	statement := fmt.Sprintf("SELECT %s FROM %s %s", c.dialect.Quote(c.table.DataColumn), c.dialect.Quote(c.table.Name), sqlQuery.Clause)
+	records, err := c.query(c.db, statement, sqlQuery.Args, func(record map[string]interface{}) bool {
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resultsTypeHint == nil {
+		resultsTypeHint = &map[string]interface{}{}
+	}
+	return recordsToResults(records, resultsTypeHint)
+}
+
+// query runs the SELECT of the data column and returns the records accepted by the matcher.
+func (c *SQLCollection) query(querier sqlQuerier, query string, args []interface{}, matcher RecordMatcher) ([]map[string]interface{}, error) {
+	rows, err := querier.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []map[string]interface{}{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		record, err := c.codec.Unmarshal(data)
+		if err != nil {
+			return nil, ErrBackendError(err)
+		}
+		if matcher(record) {
+			records = append(records, record)
+		}
+	}
+
+	return records, rows.Err()
+}
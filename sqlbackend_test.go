@@ -0,0 +1,366 @@
+package backends
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newSQLiteTestBackend(t *testing.T) (Backend, func()) {
+	dir, err := ioutil.TempDir("", "backends-sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend, err := NewSQLBackendBuilder("sqlite3", SQLiteDialect{})(&config.DBInfo{
+		DatabaseName: filepath.Join(dir, "test.db"),
+	}, nil)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return backend, func() {
+		backend.Shutdown()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSQLRepository(t *testing.T) {
+	backend, cleanup := newSQLiteTestBackend(t)
+	defer cleanup()
+
+	repo, err := backend.DefineRepository("users", RepositoryDefinitionMap{
+		"name":    "users",
+		"indexes": []Index{NewUniqueIndex("email"), NewNonUniqueIndex("org", "role")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := []map[string]interface{}{
+		{"id": "1", "email": "alice@example.com", "org": "a", "role": "admin", "age": 30},
+		{"id": "2", "email": "bob@example.com", "org": "a", "role": "user", "age": 25},
+		{"id": "3", "email": "carol@example.com", "org": "b", "role": "admin", "age": 35},
+	}
+	for _, user := range users {
+		if _, err := repo.Save(&user, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = repo.Save(&map[string]interface{}{"id": "1"}, nil)
+	if err == nil || err.Error() != "already exists" {
+		t.Fatal("Expected already exists error for the duplicate id, got", err)
+	}
+	_, err = repo.Save(&map[string]interface{}{"email": "alice@example.com"}, nil)
+	if err == nil || err.Error() != "already exists" {
+		t.Fatal("Expected already exists error for the duplicate email, got", err)
+	}
+
+	result, err := repo.GetOne(NewFilter().Match("email", "bob@example.com"), &map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (*result.(*map[string]interface{}))["id"] != "2" {
+		t.Fatal("Expected bob, got", result)
+	}
+
+	results, err := repo.GetAll(NewFilter().Match("org", "a").Match("role", "admin"), &map[string]interface{}{}, "", "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list := *results.(*[]*map[string]interface{}); len(list) != 1 || (*list[0])["id"] != "1" {
+		t.Fatal("Expected alice, got", list)
+	}
+
+	results, err = repo.GetAll(NewFilter().Match("role", "admin"), &map[string]interface{}{}, "age", "desc", 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list := *results.(*[]*map[string]interface{}); len(list) != 1 || (*list[0])["id"] != "3" {
+		t.Fatal("Expected carol, got", list)
+	}
+
+	if count, err := repo.Count(nil); err != nil || count != 3 {
+		t.Fatal("Expected 3 users, got", count, err)
+	}
+	if count, err := repo.Count(NewFilter().Match("id", "2")); err != nil || count != 1 {
+		t.Fatal("Expected 1 user by id, got", count, err)
+	}
+	if count, err := repo.Count(NewFilter().Match("role", "admin")); err != nil || count != 2 {
+		t.Fatal("Expected 2 admins, got", count, err)
+	}
+	if exists, err := repo.Exists(NewFilter().Match("id", "3")); err != nil || !exists {
+		t.Fatal("Expected user 3 to exist, got", exists, err)
+	}
+	if exists, err := repo.Exists(NewFilter().Match("id", "4")); err != nil || exists {
+		t.Fatal("Expected user 4 not to exist, got", exists, err)
+	}
+	if exists, err := repo.Exists(NewFilter().Match("org", "b").Match("role", "user")); err != nil || exists {
+		t.Fatal("Expected no users in org b, got", exists, err)
+	}
+
+	updated, err := repo.UpdateAll(NewFilter().Match("role", "admin"), &map[string]interface{}{"org": "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated != 2 {
+		t.Fatal("Expected 2 updated users, got", updated)
+	}
+	if count, err := repo.Count(NewFilter().Match("org", "c")); err != nil || count != 2 {
+		t.Fatal("Expected 2 users in org c, got", count, err)
+	}
+	if _, err := repo.UpdateAll(NewFilter().Match("org", "c"), &map[string]interface{}{"email": "admin@example.com"}); err == nil || err.Error() != "already exists" {
+		t.Fatal("Expected already exists error for the duplicate email, got", err)
+	}
+	if result, err := repo.GetOne(NewFilter().Match("id", "1"), &map[string]interface{}{}); err != nil || (*result.(*map[string]interface{}))["email"] != "alice@example.com" {
+		t.Fatal("Expected the failed update to be rolled back, got", result, err)
+	}
+	if _, err := repo.UpdateAll(NewFilter().Match("org", "c"), &map[string]interface{}{"org": "a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the index columns are updated with the record
+	if _, err := repo.Save(&map[string]interface{}{"id": "x", "org": "b"}, NewFilter().Match("id", "2")); err != nil {
+		t.Fatal(err)
+	}
+	results, err = repo.GetAll(NewFilter().Match("org", "b").Match("role", "user"), &map[string]interface{}{}, "", "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list := *results.(*[]*map[string]interface{}); len(list) != 1 || (*list[0])["id"] != "2" {
+		t.Fatal("Expected bob in org b, got", list)
+	}
+	_, err = repo.Save(&map[string]interface{}{"email": "carol@example.com"}, NewFilter().Match("id", "2"))
+	if err == nil || err.Error() != "already exists" {
+		t.Fatal("Expected already exists error for the duplicate email, got", err)
+	}
+
+	upserted, err := repo.(*SQLCollection).Upsert(&map[string]interface{}{"id": "2", "email": "robert@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upserted.(map[string]interface{})["org"] != nil {
+		t.Fatal("Expected the record to be replaced, got", upserted)
+	}
+	if _, err := repo.GetOne(NewFilter().Match("email", "robert@example.com"), &map[string]interface{}{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.DeleteOne(NewFilter().Match("email", "missing@example.com")); err == nil || err.Error() != "not found" {
+		t.Fatal("Expected not found error, got", err)
+	}
+	if err := repo.DeleteAll(NewFilter().Match("role", "admin")); err != nil {
+		t.Fatal(err)
+	}
+	results, err = repo.GetAll(nil, &map[string]interface{}{}, "", "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list := *results.(*[]*map[string]interface{}); len(list) != 1 || (*list[0])["id"] != "2" {
+		t.Fatal("Expected only robert, got", list)
+	}
+
+	if err := repo.DeleteAll(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetOne(NewFilter().Match("id", "2"), &map[string]interface{}{}); err == nil || err.Error() != "not found" {
+		t.Fatal("Expected not found error, got", err)
+	}
+}
+
+func TestSQLSaveAll(t *testing.T) {
+	backend, cleanup := newSQLiteTestBackend(t)
+	defer cleanup()
+
+	repo, err := backend.DefineRepository("users", RepositoryDefinitionMap{
+		"name":    "users",
+		"indexes": []Index{NewUniqueIndex("email")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type user struct {
+		ID    string `json:"id,omitempty"`
+		Email string `json:"email"`
+	}
+	saved, err := repo.SaveAll([]user{{ID: "1", Email: "alice@example.com"}, {Email: "bob@example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := saved.([]interface{})
+	if len(list) != 2 || list[1].(map[string]interface{})["id"] == "" {
+		t.Fatal("Expected 2 users with ids, got", list)
+	}
+
+	_, err = repo.SaveAll([]*user{{ID: "3", Email: "carol@example.com"}, {ID: "4", Email: "alice@example.com"}})
+	if err == nil || err.Error() != "already exists" {
+		t.Fatal("Expected already exists error for the duplicate email, got", err)
+	}
+	if exists, err := repo.Exists(NewFilter().Match("id", "3")); err != nil || exists {
+		t.Fatal("Expected the failed batch to be rolled back, got", exists, err)
+	}
+	if _, err := repo.SaveAll(nil); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input error, got", err)
+	}
+}
+
+func TestSQLRawQuery(t *testing.T) {
+	backend, cleanup := newSQLiteTestBackend(t)
+	defer cleanup()
+
+	repo, err := backend.DefineRepository("users", RepositoryDefinitionMap{"name": "users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.SaveAll([]map[string]interface{}{{"id": "1", "age": 30}, {"id": "2", "age": 15}, {"id": "3", "age": 45}}); err != nil {
+		t.Fatal(err)
+	}
+
+	rq, ok := repo.(RawQuerier)
+	if !ok {
+		t.Fatal("Expected the SQL repository to run raw queries")
+	}
+	results, err := rq.RawQuery(&SQLQuery{
+		Clause: "WHERE json_extract(data, '$.age') >= ? ORDER BY json_extract(data, '$.age') DESC",
+		Args:   []interface{}{18},
+	}, &map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := *results.(*[]*map[string]interface{})
+	if len(users) != 2 || (*users[0])["id"] != "3" || (*users[1])["id"] != "1" {
+		t.Fatal("Expected the adults, ordered by age. Got: ", users)
+	}
+
+	if _, err := rq.RawQuery("SELECT * FROM users", nil); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input error for a query of another type. Got: ", err)
+	}
+}
+
+func TestSQLPatch(t *testing.T) {
+	backend, cleanup := newSQLiteTestBackend(t)
+	defer cleanup()
+
+	repo, err := backend.DefineRepository("users", RepositoryDefinitionMap{"name": "users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Save(&map[string]interface{}{"id": "1", "status": "pending", "code": "1234"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Patch(repo, NewFilter().Match("id", "1"), &map[string]interface{}{"status": "verified"}, []string{"code"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	patched := result.(map[string]interface{})
+	if _, ok := patched["code"]; ok || patched["status"] != "verified" {
+		t.Fatal("Expected the status to be set and the code removed. Got: ", patched)
+	}
+	if count, err := repo.Count(NewFilter().Match("code", "1234")); err != nil || count != 0 {
+		t.Fatal("Expected the code to be removed from the stored record. Got: ", count, err)
+	}
+}
+
+func TestSQLExplain(t *testing.T) {
+	backend, cleanup := newSQLiteTestBackend(t)
+	defer cleanup()
+
+	repo, err := backend.DefineRepository("users", RepositoryDefinitionMap{
+		"name":    "users",
+		"indexes": []Index{NewUniqueIndex("email")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, email := range []string{"john@example.com", "jane@example.com", "jim@example.com"} {
+		if _, err := repo.Save(&map[string]interface{}{"id": fmt.Sprintf("%d", i), "email": email, "role": "user"}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plan, err := Explain(repo, NewFilter().Match("email", "jane@example.com"), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Backend != "sql" || plan.FullScan || plan.Scanned != 1 || plan.Matched != 1 {
+		t.Fatal("Expected the row to be selected by the index. Got: ", plan)
+	}
+	if query := plan.Query.(*SQLQuery); !strings.HasPrefix(query.Clause, "WHERE ") || len(query.Args) != 1 {
+		t.Fatal("Expected the condition on the index. Got: ", query)
+	}
+
+	plan, err = Explain(repo, NewFilter().Match("role", "user"), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.FullScan || plan.Scanned != 3 || plan.Matched != 3 {
+		t.Fatal("Expected a full scan of the table. Got: ", plan)
+	}
+}
+
+func TestSQLRepositoryExistingTable(t *testing.T) {
+	backend, cleanup := newSQLiteTestBackend(t)
+	defer cleanup()
+
+	def := RepositoryDefinitionMap{
+		"name":    "tokens",
+		"hashKey": "token",
+		"indexes": []Index{NewUniqueIndex("user")},
+	}
+	repo, err := backend.DefineRepository("tokens", def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Save(&map[string]interface{}{"token": "t1", "user": "u1"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// the table is not recreated
+	again, err := SQLRepoBuilder(def, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := again.GetOne(NewFilter().Match("token", "t1"), &map[string]interface{}{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSQLRepositoryCodec(t *testing.T) {
+	backend, cleanup := newSQLiteTestBackend(t)
+	defer cleanup()
+
+	repo, err := backend.DefineRepository("events", RepositoryDefinitionMap{
+		"name":    "events",
+		"codec":   CodecMsgPack,
+		"indexes": []Index{NewNonUniqueIndex("type")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !repo.(*SQLCollection).table.Binary {
+		t.Fatal("Expected a binary data column")
+	}
+
+	for i, eventType := range []string{"login", "logout", "login"} {
+		if _, err := repo.Save(&map[string]interface{}{"id": strconv.Itoa(i), "type": eventType, "seq": i}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := repo.GetAll(NewFilter().Match("type", "login"), &map[string]interface{}{}, "seq", "desc", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list := *results.(*[]*map[string]interface{}); len(list) != 2 || (*list[0])["id"] != "2" || (*list[0])["seq"] != float64(2) {
+		t.Fatal("Expected the login events, got", list)
+	}
+}
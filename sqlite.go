@@ -0,0 +1,46 @@
+package backends
+
+import (
+	"strings"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+// SQLiteDialect is the SQLDialect of SQLite (3.24 or newer), for the "sqlite3" driver (github.com/mattn/go-sqlite3).
+type SQLiteDialect struct{}
+
+// DataSourceName returns the path to the database file, which is the database name.
+func (SQLiteDialect) DataSourceName(conf *config.DBInfo) (string, error) {
+	if conf.DatabaseName == "" {
+		return "", ErrBackendError("database name is missing and required")
+	}
+	return conf.DatabaseName, nil
+}
+
+// Quote quotes the identifier with double quotes.
+func (SQLiteDialect) Quote(identifier string) string {
+	return `"` + strings.Replace(identifier, `"`, `""`, -1) + `"`
+}
+
+// Placeholder returns ?.
+func (SQLiteDialect) Placeholder(n int) string {
+	return "?"
+}
+
+// CreateTable returns the CREATE TABLE and CREATE INDEX statements.
+func (d SQLiteDialect) CreateTable(table *SQLTable) []string {
+	if table.Binary {
+		return createTableStatements(d, table, "BLOB")
+	}
+	return createTableStatements(d, table, "TEXT")
+}
+
+// Upsert returns INSERT ... ON CONFLICT (key) DO UPDATE.
+func (d SQLiteDialect) Upsert(table *SQLTable) string {
+	return upsertOnConflict(d, table)
+}
+
+// IsUniqueViolation returns true for the UNIQUE and PRIMARY KEY constraint errors.
+func (SQLiteDialect) IsUniqueViolation(err error) bool {
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
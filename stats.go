@@ -0,0 +1,35 @@
+package backends
+
+// RepositoryStats are the storage statistics of a repository.
+type RepositoryStats struct {
+	// Records is the number of the records in the repository.
+	Records int64
+	// SizeBytes is the size of the stored records in bytes, -1 if the backend does not report it.
+	SizeBytes int64
+}
+
+// StatsRepository is implemented by the repositories that report their statistics natively
+// (MongoDB, DynamoDB and Cache).
+type StatsRepository interface {
+	Stats() (*RepositoryStats, error)
+}
+
+// GetStats returns the statistics of the repository. If the repository does not report them (see StatsRepository),
+// the records are counted with Count, with low priority (see WithPriority), and the size is not known.
+// Note that the wrappers (ACLRepository, PrioritizedRepository etc) do not report the statistics of
+// the wrapped repository, so use GetStats on the repository returned by the backend.
+func GetStats(repo Repository) (*RepositoryStats, error) {
+	var statsRepo StatsRepository
+	if AsRepository(repo, &statsRepo) {
+		return statsRepo.Stats()
+	}
+
+	records, err := WithPriority(repo, PriorityLow).Count(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &RepositoryStats{
+		Records:   records,
+		SizeBytes: -1,
+	}, nil
+}
@@ -0,0 +1,34 @@
+package backends
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestGetStats(t *testing.T) {
+	repo, shutdown := newACLTestRepository(t)
+	defer shutdown()
+
+	for i := 0; i < 1005; i++ {
+		if _, err := repo.Save(&map[string]interface{}{"id": fmt.Sprintf("%d", i)}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := GetStats(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Records != 1005 || stats.SizeBytes <= 0 {
+		t.Fatal("Expected the cache to report the records and the size. Got: ", stats)
+	}
+
+	// the wrapped repository is counted
+	stats, err = GetStats(&struct{ Repository }{repo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Records != 1005 || stats.SizeBytes != -1 {
+		t.Fatal("Expected the records to be counted. Got: ", stats)
+	}
+}
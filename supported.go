@@ -32,6 +32,143 @@ func addSupported(manager BackendManager) {
 			},
 		},
 	})
+
+	manager.SupportBackend("s3", S3BackendBuilder, map[string]interface{}{
+		"dbName":      "string",
+		"credentials": "string",
+		"awsRegion":   "string",
+		"database":    "string",
+		"collections": map[string]interface{}{
+			"string": map[string]interface{}{
+				"enableTTL": "bool",
+				"TTL":       "int",
+			},
+		},
+	})
+
+	manager.SupportBackend("etcd", EtcdBackendBuilder, map[string]interface{}{
+		"dbName":   "string",
+		"host":     "string",
+		"database": "string",
+		"collections": map[string]interface{}{
+			"string": map[string]interface{}{
+				"enableTTL": "bool",
+				"TTL":       "int",
+			},
+		},
+		"user": "string",
+		"pass": "string",
+	})
+
+	manager.SupportBackend("arangodb", ArangoDBBackendBuilder, map[string]interface{}{
+		"dbName":   "string",
+		"host":     "string",
+		"database": "string",
+		"collections": map[string]interface{}{
+			"string": map[string]interface{}{
+				"indexes":   "string array",
+				"enableTTL": "bool",
+				"TTL":       "int",
+			},
+		},
+		"user": "string",
+		"pass": "string",
+	})
+
+	manager.SupportBackend("tikv", TiKVBackendBuilder, map[string]interface{}{
+		"dbName":      "string",
+		"host":        "string",
+		"database":    "string",
+		"collections": map[string]interface{}{},
+	})
+
+	manager.SupportBackend("foundationdb", FDBBackendBuilder, map[string]interface{}{
+		"dbName":      "string",
+		"host":        "string",
+		"database":    "string",
+		"collections": map[string]interface{}{},
+	})
+
+	manager.SupportBackend("leveldb", LevelDBBackendBuilder, map[string]interface{}{
+		"dbName":   "string",
+		"database": "string",
+		"collections": map[string]interface{}{
+			"string": map[string]interface{}{
+				"indexes": "string array",
+			},
+		},
+	})
+
+	manager.SupportBackend("cache", CacheBackendBuilder, map[string]interface{}{
+		"dbName": "string",
+		"collections": map[string]interface{}{
+			"string": map[string]interface{}{
+				"enableTTL": "bool",
+				"TTL":       "int",
+				"maxSizeMB": "int",
+			},
+		},
+	})
+
+	manager.SupportBackend("neo4j", Neo4jBackendBuilder, map[string]interface{}{
+		"dbName":   "string",
+		"host":     "string",
+		"database": "string",
+		"collections": map[string]interface{}{
+			"string": map[string]interface{}{
+				"indexes": "string array",
+			},
+		},
+		"user": "string",
+		"pass": "string",
+	})
+
+	manager.SupportBackend("documentdb", DocumentDBBackendBuilder, map[string]interface{}{
+		"dbName":   "string",
+		"host":     "string",
+		"database": "string",
+		"collections": map[string]interface{}{
+			"string": map[string]interface{}{
+				"indexes":   "string array",
+				"enableTTL": "bool",
+				"TTL":       "int",
+			},
+		},
+		"user": "string",
+		"pass": "string",
+	})
+
+	manager.SupportBackend("couchdb", CouchDBBackendBuilder, map[string]interface{}{
+		"dbName":   "string",
+		"host":     "string",
+		"database": "string",
+		"collections": map[string]interface{}{
+			"string": map[string]interface{}{
+				"indexes": "string array",
+			},
+		},
+		"user": "string",
+		"pass": "string",
+	})
+
+	for name, builder := range map[string]BackendBuilder{
+		"postgres": NewSQLBackendBuilder("postgres", PostgresDialect{}),
+		"mysql":    NewSQLBackendBuilder("mysql", MySQLDialect{}),
+		"sqlite":   NewSQLBackendBuilder("sqlite3", SQLiteDialect{}),
+	} {
+		manager.SupportBackend(name, builder, map[string]interface{}{
+			"dbName":   "string",
+			"host":     "string",
+			"database": "string",
+			"collections": map[string]interface{}{
+				"string": map[string]interface{}{
+					"indexes": "string array",
+				},
+			},
+			"user": "string",
+			"pass": "string",
+		})
+	}
 }
 
 // NewBackendSupport registers new backends
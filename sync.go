@@ -0,0 +1,322 @@
+package backends
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Changes holds the changes of a repository since a sync token.
+type Changes struct {
+	// Records are the records created or updated since the token (the latest version of each record).
+	Records []map[string]interface{}
+	// Deleted are the tombstones of the records deleted since the token.
+	Deleted []*Tombstone
+	// Token is the sync token to pass to the next ChangesSince call.
+	Token string
+}
+
+// SyncOptions configures the change tracking.
+type SyncOptions struct {
+	// Tombstones is the repository where the deletions are recorded. It is required, and should be on the same backend,
+	// with an index on "repository" and "deletedAt".
+	Tombstones Repository
+	// UpdatedAtProperty is the property set to the time of the last save (milliseconds since the epoch).
+	// Default is "updatedAt". The repositories should have an index on it.
+	UpdatedAtProperty string
+	// PageSize is the number of records fetched at once by ChangesSince. Default is 100.
+	PageSize int
+	// TombstoneTTL is the time after which the tombstones are purged (see NewTombstoneStore). Default is to keep them.
+	TombstoneTTL time.Duration
+	// Actor is recorded as the deleter in the tombstones, unless another is given with DeleteOneAs or DeleteAllAs.
+	Actor string
+
+	store *TombstoneStore
+}
+
+// SyncBackend is a Backend whose repositories track the changes for the incremental sync of clients.
+type SyncBackend struct {
+	Backend
+	options *SyncOptions
+}
+
+// NewSyncBackend wraps the backend so the changes of its repositories can be fetched incrementally with ChangesSince.
+// Every save stamps the record with the time of the save, and every delete records a tombstone, so the changes
+// can be found with the operations that all backends support (sorting, limit and offset).
+//
+// Only the writes made through the wrapped backend are tracked. The time of the save is taken from the
+// local clock, so the clocks of the service instances should be synchronized.
+func NewSyncBackend(backend Backend, options *SyncOptions) Backend {
+	if options.UpdatedAtProperty == "" {
+		options.UpdatedAtProperty = "updatedAt"
+	}
+	if options.PageSize < 1 {
+		options.PageSize = 100
+	}
+	if options.store == nil {
+		options.store = NewTombstoneStore(options.Tombstones, options.TombstoneTTL)
+	}
+	return &SyncBackend{
+		Backend: backend,
+		options: options,
+	}
+}
+
+// DefineRepository defines the repository (collection/table) on the underlying backend.
+func (b *SyncBackend) DefineRepository(name string, def RepositoryDefinition) (Repository, error) {
+	repo, err := b.Backend.DefineRepository(name, def)
+	if err != nil {
+		return nil, err
+	}
+	return NewSyncRepository(repo, name, b.options), nil
+}
+
+// GetRepository return the repository (collection/table) from the underlying backend.
+func (b *SyncBackend) GetRepository(name string) (Repository, error) {
+	repo, err := b.Backend.GetRepository(name)
+	if err != nil {
+		return nil, err
+	}
+	return NewSyncRepository(repo, name, b.options), nil
+}
+
+// SyncRepository is a Repository that tracks its changes. The deletions are recorded with a TombstoneRepository.
+type SyncRepository struct {
+	*TombstoneRepository
+	name    string
+	options *SyncOptions
+}
+
+// NewSyncRepository wraps the repository so its changes are tracked.
+func NewSyncRepository(repo Repository, name string, options *SyncOptions) *SyncRepository {
+	store := options.store
+	if store == nil {
+		store = NewTombstoneStore(options.Tombstones, options.TombstoneTTL)
+	}
+	return &SyncRepository{
+		TombstoneRepository: NewTombstoneRepository(repo, name, store, options.Actor),
+		name:                name,
+		options:             options,
+	}
+}
+
+// ChangesSince returns the changes of the repository since the sync token. The repository must be a SyncRepository
+// (see NewSyncBackend), otherwise ErrNotSupported is returned. An empty token returns all records:
+//
+//	changes, err := backends.ChangesSince(repo, request.SyncToken)
+//	if err != nil {
+//		return err
+//	}
+//	// send changes.Records, changes.Deleted and changes.Token to the client
+//
+// The changes made at the same millisecond as the token may be returned again, so the clients should apply them
+// idempotently (an upsert by id, and a delete that ignores missing records). If the tombstones are purged
+// (SyncOptions.TombstoneTTL), the tokens older than the TTL are rejected with ErrInvalidInput, and the client
+// should sync again with an empty token.
+func ChangesSince(repo Repository, token string) (*Changes, error) {
+	syncRepo, ok := repo.(*SyncRepository)
+	if !ok {
+		return nil, ErrNotSupported("repository does not track changes")
+	}
+	return syncRepo.ChangesSince(token)
+}
+
+// Save creates new record unless it does not exist, otherwise it updates the record.
+// The record is stamped with the time of the save.
+func (r *SyncRepository) Save(object interface{}, filter Filter) (interface{}, error) {
+	payload, err := InterfaceToMap(object)
+	if err != nil {
+		return nil, err
+	}
+	record := map[string]interface{}{}
+	for k, v := range *payload {
+		record[k] = v
+	}
+	record[r.options.UpdatedAtProperty] = syncNow()
+
+	return r.Repository.Save(&record, filter)
+}
+
+// UpdateAll updates all matched records for given filter. The records are stamped with the time of the update.
+func (r *SyncRepository) UpdateAll(filter Filter, update interface{}) (int64, error) {
+	payload, err := InterfaceToMap(update)
+	if err != nil {
+		return 0, err
+	}
+	record := map[string]interface{}{}
+	for k, v := range *payload {
+		record[k] = v
+	}
+	record[r.options.UpdatedAtProperty] = syncNow()
+
+	return r.Repository.UpdateAll(filter, &record)
+}
+
+// SaveAll creates the objects as new records. The records are stamped with the time of the save.
+func (r *SyncRepository) SaveAll(objects interface{}) (interface{}, error) {
+	records, err := objectsToRecords(objects)
+	if err != nil {
+		return nil, err
+	}
+	now := syncNow()
+	for _, record := range records {
+		record[r.options.UpdatedAtProperty] = now
+	}
+	return r.Repository.SaveAll(records)
+}
+
+// ChangesSince returns the records saved and the tombstones of the records deleted since the token.
+// If a record was deleted and saved again since the token, only the latest change is returned.
+func (r *SyncRepository) ChangesSince(token string) (*Changes, error) {
+	since := int64(0)
+	if token != "" {
+		var err error
+		since, err = strconv.ParseInt(token, 10, 64)
+		if err != nil || since < 0 {
+			return nil, ErrInvalidInput(fmt.Sprintf("invalid sync token %s", token))
+		}
+		if ttl := r.options.TombstoneTTL; ttl > 0 && since < syncNow()-int64(ttl/time.Millisecond) {
+			// the tombstones of the deletions since the token may have been purged
+			return nil, ErrInvalidInput(fmt.Sprintf("sync token %s has expired", token))
+		}
+	}
+	latest := since
+
+	records := map[string]map[string]interface{}{}
+	updatedAt := map[string]int64{}
+	err := r.scan(r.Repository, nil, r.options.UpdatedAtProperty, since, func(record map[string]interface{}, at int64) {
+		id := fmt.Sprintf("%v", record["id"])
+		if _, ok := records[id]; ok {
+			// the record moved while paging, the first one seen is the latest
+			return
+		}
+		records[id] = record
+		updatedAt[id] = at
+		if at > latest {
+			latest = at
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tombstones := map[string]*Tombstone{}
+	if token != "" {
+		err = r.scan(r.options.Tombstones, NewFilter().Match("repository", r.name), "deletedAt", since, func(record map[string]interface{}, at int64) {
+			id := fmt.Sprintf("%v", record["recordId"])
+			if _, ok := tombstones[id]; ok {
+				return
+			}
+			actor, _ := record["actor"].(string)
+			tombstones[id] = &Tombstone{
+				ID:         fmt.Sprintf("%v", record["id"]),
+				Repository: r.name,
+				RecordID:   id,
+				DeletedAt:  at,
+				Actor:      actor,
+			}
+			if at > latest {
+				latest = at
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	changes := &Changes{
+		Records: []map[string]interface{}{},
+		Deleted: []*Tombstone{},
+		Token:   strconv.FormatInt(latest, 10),
+	}
+	for id, record := range records {
+		if tombstone, ok := tombstones[id]; ok && tombstone.DeletedAt >= updatedAt[id] {
+			continue
+		}
+		changes.Records = append(changes.Records, record)
+	}
+	for id, tombstone := range tombstones {
+		if at, ok := updatedAt[id]; ok && at > tombstone.DeletedAt {
+			continue
+		}
+		changes.Deleted = append(changes.Deleted, tombstone)
+	}
+
+	return changes, nil
+}
+
+// scan pages through the records of the repository from the newest to the oldest (by the timestamp property)
+// and calls fn for every record stamped at or after since. The records without the timestamp are skipped.
+func (r *SyncRepository) scan(repo Repository, filter Filter, property string, since int64, fn func(record map[string]interface{}, at int64)) error {
+	pageSize := r.options.PageSize
+	for offset := 0; ; offset += pageSize {
+		results, err := repo.GetAll(filter, &map[string]interface{}{}, property, "desc", pageSize, offset)
+		if err != nil {
+			return err
+		}
+		page, err := syncRecords(results)
+		if err != nil {
+			return err
+		}
+
+		for _, record := range page {
+			at, ok := syncTimestamp(record[property])
+			if !ok {
+				continue
+			}
+			if at < since {
+				return nil
+			}
+			fn(record, at)
+		}
+
+		if len(page) < pageSize {
+			return nil
+		}
+	}
+}
+
+// syncNow returns the current time in milliseconds since the epoch.
+func syncNow() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
+// syncTimestamp converts the stored timestamp to milliseconds since the epoch.
+func syncTimestamp(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case float64:
+		return int64(v), true
+	case json.Number:
+		at, err := v.Int64()
+		return at, err == nil
+	}
+	return 0, false
+}
+
+// syncRecords normalizes the results of GetAll to a list of records.
+func syncRecords(results interface{}) ([]map[string]interface{}, error) {
+	normalized, err := normalizeValue(results)
+	if err != nil {
+		return nil, err
+	}
+	list, ok := normalized.([]interface{})
+	if !ok {
+		if normalized == nil {
+			return []map[string]interface{}{}, nil
+		}
+		return nil, ErrBackendError(fmt.Sprintf("unexpected results type %T", results))
+	}
+
+	records := []map[string]interface{}{}
+	for _, item := range list {
+		if record, ok := item.(map[string]interface{}); ok {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
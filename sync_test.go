@@ -0,0 +1,179 @@
+package backends
+
+import (
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func newSyncTestRepository(t *testing.T, pageSize int) (Repository, func()) {
+	cache, err := CacheBackendBuilder(&config.DBInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tombstones, err := cache.DefineRepository("tombstones", RepositoryDefinitionMap{"name": "tombstones"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := NewSyncBackend(cache, &SyncOptions{
+		Tombstones: tombstones,
+		PageSize:   pageSize,
+	})
+	repo, err := backend.DefineRepository("notes", RepositoryDefinitionMap{"name": "notes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo, backend.Shutdown
+}
+
+// changedIDs returns the ids of the changed and the deleted records, without the changes made at the token time
+// (which are returned again).
+func changedIDs(changes *Changes, token string) ([]string, []string) {
+	records := []string{}
+	for _, record := range changes.Records {
+		if at, _ := syncTimestamp(record["updatedAt"]); strconv.FormatInt(at, 10) == token {
+			continue
+		}
+		records = append(records, record["id"].(string))
+	}
+	deleted := []string{}
+	for _, tombstone := range changes.Deleted {
+		if strconv.FormatInt(tombstone.DeletedAt, 10) == token {
+			continue
+		}
+		deleted = append(deleted, tombstone.RecordID)
+	}
+	sort.Strings(records)
+	sort.Strings(deleted)
+	return records, deleted
+}
+
+// tick makes sure the next change gets a later timestamp.
+func tick() {
+	time.Sleep(3 * time.Millisecond)
+}
+
+func TestChangesSince(t *testing.T) {
+	repo, shutdown := newSyncTestRepository(t, 2)
+	defer shutdown()
+
+	for _, id := range []string{"a", "b", "c"} {
+		if _, err := repo.Save(&map[string]interface{}{"id": id, "text": id}, nil); err != nil {
+			t.Fatal(err)
+		}
+		tick()
+	}
+
+	changes, err := ChangesSince(repo, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, deleted := changedIDs(changes, "")
+	if len(records) != 3 || len(deleted) != 0 {
+		t.Fatal("Expected all records on the first sync, got", records, deleted)
+	}
+	token := changes.Token
+
+	tick()
+	if _, err := repo.Save(&map[string]interface{}{"text": "updated"}, NewFilter().Match("id", "b")); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.DeleteOne(NewFilter().Match("id", "c")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Save(&map[string]interface{}{"id": "d"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err = ChangesSince(repo, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, deleted = changedIDs(changes, token)
+	if len(records) != 2 || records[0] != "b" || records[1] != "d" {
+		t.Fatal("Expected b and d to be changed, got", records)
+	}
+	if len(deleted) != 1 || deleted[0] != "c" {
+		t.Fatal("Expected c to be deleted, got", deleted)
+	}
+	if changes.Token <= token {
+		t.Fatal("Expected the token to advance, got", changes.Token)
+	}
+	token = changes.Token
+
+	// deleted and created again
+	tick()
+	if err := repo.DeleteAll(NewFilter().Match("id", "a")); err != nil {
+		t.Fatal(err)
+	}
+	tick()
+	if _, err := repo.Save(&map[string]interface{}{"id": "a"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err = ChangesSince(repo, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, deleted = changedIDs(changes, token)
+	if len(records) != 1 || records[0] != "a" || len(deleted) != 0 {
+		t.Fatal("Expected only a to be changed, got", records, deleted)
+	}
+	token = changes.Token
+
+	tick()
+	changes, err = ChangesSince(repo, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes.Token != token {
+		t.Fatal("Expected the token not to change, got", changes.Token)
+	}
+	records, deleted = changedIDs(changes, token)
+	if len(records) != 0 || len(deleted) != 0 {
+		t.Fatal("Expected no new changes, got", records, deleted)
+	}
+}
+
+func TestChangesSinceNotSupported(t *testing.T) {
+	if _, err := ChangesSince(newTestRepository(), ""); err == nil || err.Error() != "not supported" {
+		t.Fatal("Expected not supported error, got", err)
+	}
+
+	repo, shutdown := newSyncTestRepository(t, 10)
+	defer shutdown()
+	if _, err := ChangesSince(repo, "yesterday"); err == nil || err.Error() != "invalid input" {
+		t.Fatal("Expected invalid input error, got", err)
+	}
+}
+
+func TestChangesSinceExpiredToken(t *testing.T) {
+	cache, err := CacheBackendBuilder(&config.DBInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Shutdown()
+	tombstones, err := cache.DefineRepository("tombstones", RepositoryDefinitionMap{"name": "tombstones"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := NewSyncBackend(cache, &SyncOptions{
+		Tombstones:   tombstones,
+		TombstoneTTL: time.Hour,
+	})
+	repo, err := backend.DefineRepository("notes", RepositoryDefinitionMap{"name": "notes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired := strconv.FormatInt(syncNow()-int64(2*time.Hour/time.Millisecond), 10)
+	if _, err := ChangesSince(repo, expired); err == nil || err.Error() != "invalid input" {
+		t.Fatal("Expected invalid input error for the expired token, got", err)
+	}
+	if _, err := ChangesSince(repo, ""); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,216 @@
+package backends
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QueryTelemetryOptions configures QueryTelemetry.
+type QueryTelemetryOptions struct {
+	// SlowQueryThreshold is the duration above which a query is logged as slow. Default is 100ms.
+	SlowQueryThreshold time.Duration
+	// MaxSlowQueries is the number of the most recent slow queries kept in the slow-query log. Default is 100.
+	MaxSlowQueries int
+}
+
+// QueryShape is the shape of a filter: the properties it matches and how, without the values.
+// The queries with the same shape are served by the same index.
+type QueryShape struct {
+	// Repository is the name of the repository.
+	Repository string
+	// Equality are the properties matched exactly or with a list of values, sorted by name.
+	Equality []string
+	// Patterns are the properties matched with a pattern, a regular expression or a comparison, sorted by name.
+	Patterns []string
+	// Order is the property the results are ordered by.
+	Order string
+}
+
+// key returns the unique key of the shape.
+func (s QueryShape) key() string {
+	return s.Repository + "|" + strings.Join(s.Equality, ",") + "|" + strings.Join(s.Patterns, ",") + "|" + s.Order
+}
+
+// QueryShapeStats are the statistics of the queries with the same shape.
+type QueryShapeStats struct {
+	Shape QueryShape
+	// Queries is the number of the queries.
+	Queries int
+	// SlowQueries is the number of the slow queries.
+	SlowQueries int
+	// TotalDuration is the total duration of the queries.
+	TotalDuration time.Duration
+	// MaxDuration is the duration of the slowest query.
+	MaxDuration time.Duration
+}
+
+// SlowQuery is an entry of the slow-query log.
+type SlowQuery struct {
+	// Operation is the name of the operation (OperationGetAll etc).
+	Operation string
+	// Shape is the shape of the filter.
+	Shape QueryShape
+	// Filter is the canonical form of the filter (see Filter.Canonical).
+	Filter string
+	// Duration is the duration of the query.
+	Duration time.Duration
+	// At is the time the query started.
+	At time.Time
+}
+
+// QueryTelemetry records the shapes of the filters of the repository operations, and the slow queries.
+// It collects the data through hooks (see Hooks), so it can be added to any backend:
+//
+//	telemetry := backends.NewQueryTelemetry(nil)
+//	backend = backends.NewHookedBackend(backend, telemetry.Hooks())
+//
+// Add the telemetry hooks after the other hooks: if a before hook fails, the operation is not recorded.
+// The operations without a filter (creating records, reading all records unordered) are not recorded.
+type QueryTelemetry struct {
+	options *QueryTelemetryOptions
+	mutex   *sync.Mutex
+	started map[*Operation]time.Time
+	shapes  map[string]*QueryShapeStats
+	slow    []SlowQuery
+}
+
+// NewQueryTelemetry creates new QueryTelemetry.
+func NewQueryTelemetry(options *QueryTelemetryOptions) *QueryTelemetry {
+	if options == nil {
+		options = &QueryTelemetryOptions{}
+	}
+	if options.SlowQueryThreshold <= 0 {
+		options.SlowQueryThreshold = 100 * time.Millisecond
+	}
+	if options.MaxSlowQueries <= 0 {
+		options.MaxSlowQueries = 100
+	}
+	return &QueryTelemetry{
+		options: options,
+		mutex:   &sync.Mutex{},
+		started: map[*Operation]time.Time{},
+		shapes:  map[string]*QueryShapeStats{},
+		slow:    []SlowQuery{},
+	}
+}
+
+// Hooks returns the hooks that record the operations.
+func (t *QueryTelemetry) Hooks() *Hooks {
+	return &Hooks{
+		Before: []BeforeHook{t.before},
+		After:  []AfterHook{t.after},
+	}
+}
+
+// before records the start of the operation.
+func (t *QueryTelemetry) before(op *Operation) error {
+	if len(op.Filter) == 0 && op.Order == "" {
+		return nil
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.started[op] = time.Now()
+	return nil
+}
+
+// after records the duration and the shape of the operation.
+func (t *QueryTelemetry) after(op *Operation, result interface{}, err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	start, ok := t.started[op]
+	if !ok {
+		return
+	}
+	delete(t.started, op)
+	duration := time.Since(start)
+
+	ast, parseErr := ParseFilter(op.Filter)
+	if parseErr != nil {
+		return
+	}
+	shape := QueryShape{
+		Repository: op.Repository,
+		Equality:   []string{},
+		Patterns:   []string{},
+		Order:      op.Order,
+	}
+	for _, cond := range ast.Conditions {
+		if cond.Operator == OpEq || cond.Operator == OpIn {
+			shape.Equality = appendUnique(shape.Equality, cond.Property)
+		} else {
+			shape.Patterns = appendUnique(shape.Patterns, cond.Property)
+		}
+	}
+
+	stats, ok := t.shapes[shape.key()]
+	if !ok {
+		stats = &QueryShapeStats{Shape: shape}
+		t.shapes[shape.key()] = stats
+	}
+	stats.Queries++
+	stats.TotalDuration += duration
+	if duration > stats.MaxDuration {
+		stats.MaxDuration = duration
+	}
+
+	if duration >= t.options.SlowQueryThreshold {
+		stats.SlowQueries++
+		canonical, _ := ast.Canonical()
+		t.slow = append(t.slow, SlowQuery{
+			Operation: op.Name,
+			Shape:     shape,
+			Filter:    canonical,
+			Duration:  duration,
+			At:        start,
+		})
+		if len(t.slow) > t.options.MaxSlowQueries {
+			t.slow = t.slow[len(t.slow)-t.options.MaxSlowQueries:]
+		}
+	}
+}
+
+// Shapes returns the statistics of all recorded query shapes, the slowest (by total duration) first.
+func (t *QueryTelemetry) Shapes() []QueryShapeStats {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	shapes := []QueryShapeStats{}
+	for _, stats := range t.shapes {
+		shapes = append(shapes, *stats)
+	}
+	sort.Slice(shapes, func(i, j int) bool {
+		if shapes[i].TotalDuration != shapes[j].TotalDuration {
+			return shapes[i].TotalDuration > shapes[j].TotalDuration
+		}
+		return shapes[i].Shape.key() < shapes[j].Shape.key()
+	})
+	return shapes
+}
+
+// SlowQueries returns the slow-query log, the oldest query first.
+func (t *QueryTelemetry) SlowQueries() []SlowQuery {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return append([]SlowQuery{}, t.slow...)
+}
+
+// Reset clears the recorded data.
+func (t *QueryTelemetry) Reset() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.shapes = map[string]*QueryShapeStats{}
+	t.slow = []SlowQuery{}
+}
+
+// appendUnique appends the value unless it is already in the list.
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
@@ -0,0 +1,66 @@
+package backends
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func TestQueryTelemetry(t *testing.T) {
+	backend, err := CacheBackendBuilder(&config.DBInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Shutdown()
+
+	telemetry := NewQueryTelemetry(&QueryTelemetryOptions{SlowQueryThreshold: time.Nanosecond, MaxSlowQueries: 2})
+	hooked := NewHookedBackend(backend, telemetry.Hooks())
+	repo, err := hooked.DefineRepository("users", RepositoryDefinitionMap{"name": "users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := repo.Save(&map[string]interface{}{"id": "1", "status": "active", "org": "acme", "name": "John"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := repo.GetAll(NewFilter().Match("status", "active").Match("org", "acme").MatchPattern("name", "J%"), &map[string]interface{}{}, "createdAt", "desc", 10, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := repo.GetOne(Filter{"org": map[string]interface{}{"$eq": "acme"}, "status": "active"}, &map[string]interface{}{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetAll(nil, &map[string]interface{}{}, "", "", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	shapes := telemetry.Shapes()
+	if len(shapes) != 2 {
+		t.Fatal("Expected 2 query shapes. Got: ", shapes)
+	}
+	byQueries := map[int]QueryShapeStats{}
+	for _, stats := range shapes {
+		byQueries[stats.Queries] = stats
+	}
+	ordered := byQueries[2].Shape
+	if ordered.Repository != "users" || !reflect.DeepEqual(ordered.Equality, []string{"org", "status"}) ||
+		!reflect.DeepEqual(ordered.Patterns, []string{"name"}) || ordered.Order != "createdAt" {
+		t.Fatal("Invalid shape. Got: ", ordered)
+	}
+	if byQueries[1].Shape.Order != "" || byQueries[2].SlowQueries != 2 || byQueries[2].MaxDuration <= 0 {
+		t.Fatal("Invalid shape stats. Got: ", byQueries)
+	}
+
+	slow := telemetry.SlowQueries()
+	if len(slow) != 2 || slow[1].Operation != OperationGetOne || slow[1].Filter != `[["org","$eq",["string","acme"]],["status","$eq",["string","active"]]]` {
+		t.Fatal("Expected the 2 most recent slow queries. Got: ", slow)
+	}
+
+	telemetry.Reset()
+	if len(telemetry.Shapes()) != 0 || len(telemetry.SlowQueries()) != 0 {
+		t.Fatal("Expected no data after reset")
+	}
+}
@@ -0,0 +1,455 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+	"github.com/satori/go.uuid"
+	tikverr "github.com/tikv/client-go/v2/error"
+	"github.com/tikv/client-go/v2/txnkv"
+	"github.com/tikv/client-go/v2/txnkv/transaction"
+)
+
+// TIKV_CTX_KEY is TiKV context key
+var TIKV_CTX_KEY = "TIKV_CLIENT"
+
+// tikvRequestTimeout is the timeout for a single TiKV transaction.
+const tikvRequestTimeout = 30 * time.Second
+
+// TiKVCollection is a repository stored in TiKV.
+// Every record is stored, encoded with the codec of the repository (JSON by default, see Codec), under the repository prefix: /<database>/<repository>/<id>.
+// All operations run in (optimistic) TiKV transactions, so the writes are strongly consistent: a create fails if the
+// record exists, and an update or a delete fails if the record was changed concurrently.
+// The records are filtered in memory, unless the filter has an exact match on the key property.
+type TiKVCollection struct {
+	client  *txnkv.Client
+	prefix  string
+	codec   Codec
+	repoDef RepositoryDefinition
+}
+
+// tikvRecord is a decoded record together with its TiKV key.
+type tikvRecord struct {
+	key   []byte
+	value map[string]interface{}
+}
+
+// TiKVRepoBuilder builds new TiKV repository (keys prefix).
+func TiKVRepoBuilder(repoDef RepositoryDefinition, backend Backend) (Repository, error) {
+
+	clientObj := backend.GetFromContext(TIKV_CTX_KEY)
+	if clientObj == nil {
+		return nil, ErrBackendError("tikv client not configured")
+	}
+
+	client, ok := clientObj.(*txnkv.Client)
+	if !ok {
+		return nil, ErrBackendError("unknown client type")
+	}
+
+	databaseName := backend.GetConfig().DatabaseName
+	if databaseName == "" {
+		return nil, ErrBackendError("database name is missing and required")
+	}
+
+	repositoryName := repoDef.GetName()
+	if repositoryName == "" {
+		return nil, ErrBackendError("repository name is missing and required")
+	}
+
+	if repoDef.EnableTTL() {
+		return nil, ErrBackendError("TTL is not supported by the tikv backend")
+	}
+
+	codec, err := codecFor(repoDef)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TiKVCollection{
+		client:  client,
+		prefix:  fmt.Sprintf("/%s/%s/", databaseName, repositoryName),
+		codec:   codec,
+		repoDef: repoDef,
+	}, nil
+}
+
+// TiKVBackendBuilder returns RepositoriesBackend.
+// The host contains the comma separated addresses of the PD (placement driver) servers.
+func TiKVBackendBuilder(conf *config.DBInfo, manager BackendManager) (Backend, error) {
+
+	if conf.Host == "" {
+		return nil, ErrBackendError("tikv pd endpoints are missing from config")
+	}
+
+	client, err := txnkv.NewClient(strings.Split(conf.Host, ","))
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.WithValue(context.Background(), TIKV_CTX_KEY, client)
+	cleanup := func() {
+		client.Close()
+	}
+
+	return NewRepositoriesBackend(ctx, conf, TiKVRepoBuilder, cleanup), nil
+}
+
+// GetOne fetches only one record for given filter
+func (c *TiKVCollection) GetOne(filter Filter, result interface{}) (interface{}, error) {
+	var records []*tikvRecord
+	err := c.inTxn(func(ctx context.Context, txn *transaction.KVTxn) error {
+		var err error
+		records, err = c.find(ctx, txn, filter)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrNotFound("record not found")
+	}
+
+	err = MapToInterface(&records[0].value, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetAll fetches all matched records for given filter
+func (c *TiKVCollection) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	var records []*tikvRecord
+	err := c.inTxn(func(ctx context.Context, txn *transaction.KVTxn) error {
+		var err error
+		records, err = c.find(ctx, txn, filter)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	values := []map[string]interface{}{}
+	for _, record := range records {
+		values = append(values, record.value)
+	}
+
+	values, err = filterRecords(values, nil, order, sorting, limit, offset)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+
+	return recordsToResults(values, resultsTypeHint)
+}
+
+// Count returns the number of records that match the filter.
+func (c *TiKVCollection) Count(filter Filter) (int64, error) {
+	var records []*tikvRecord
+	err := c.inTxn(func(ctx context.Context, txn *transaction.KVTxn) error {
+		var err error
+		records, err = c.find(ctx, txn, filter)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(records)), nil
+}
+
+// Exists reports whether a record matches the filter.
+func (c *TiKVCollection) Exists(filter Filter) (bool, error) {
+	var records []*tikvRecord
+	err := c.inTxn(func(ctx context.Context, txn *transaction.KVTxn) error {
+		var err error
+		records, err = c.find(ctx, txn, filter)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return len(records) > 0, nil
+}
+
+// Save creates new record unless it does not exist, otherwise it updates the record
+func (c *TiKVCollection) Save(object interface{}, filter Filter) (interface{}, error) {
+
+	var result interface{}
+
+	payload, err := InterfaceToMap(object)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.inTxn(func(ctx context.Context, txn *transaction.KVTxn) error {
+		if filter == nil {
+			keyProperty := c.keyProperty()
+			if id, ok := (*payload)[keyProperty]; !ok || id == nil || id == "" {
+				id, err := uuid.NewV4()
+				if err != nil {
+					return err
+				}
+				(*payload)[keyProperty] = id.String()
+			}
+
+			key := c.key((*payload)[keyProperty])
+			_, err := txn.Get(ctx, key)
+			if err == nil {
+				return ErrAlreadyExists("record already exists!")
+			}
+			if !tikverr.IsErrNotFound(err) {
+				return err
+			}
+
+			value, err := c.codec.Marshal(*payload)
+			if err != nil {
+				return err
+			}
+			return txn.Set(key, value)
+		}
+
+		records, err := c.find(ctx, txn, filter)
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			return ErrNotFound("record not found")
+		}
+		if err := c.update(txn, records[0], *payload); err != nil {
+			return err
+		}
+		payload = &records[0].value
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = MapToInterface(payload, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// SaveAll creates the objects (a slice) as new records, in a single transaction. Returns the created records, as
+// returned by Save. Nothing is created if any of the records already exists.
+func (c *TiKVCollection) SaveAll(objects interface{}) (interface{}, error) {
+	records, err := objectsToRecords(objects)
+	if err != nil {
+		return nil, err
+	}
+
+	keyProperty := c.keyProperty()
+	err = c.inTxn(func(ctx context.Context, txn *transaction.KVTxn) error {
+		for _, record := range records {
+			if id, ok := record[keyProperty]; !ok || id == nil || id == "" {
+				id, err := uuid.NewV4()
+				if err != nil {
+					return err
+				}
+				record[keyProperty] = id.String()
+			}
+
+			// the transaction reads its own writes, so the duplicates within the objects are found as well
+			key := c.key(record[keyProperty])
+			_, err := txn.Get(ctx, key)
+			if err == nil {
+				return ErrAlreadyExists("record already exists!")
+			}
+			if !tikverr.IsErrNotFound(err) {
+				return err
+			}
+
+			value, err := c.codec.Marshal(record)
+			if err != nil {
+				return err
+			}
+			if err := txn.Set(key, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	saved := []interface{}{}
+	for _, record := range records {
+		var result interface{}
+		if err := MapToInterface(&record, &result); err != nil {
+			return nil, err
+		}
+		saved = append(saved, result)
+	}
+	return saved, nil
+}
+
+// UpdateAll updates all matched records for given filter with the properties of the update, in a single
+// transaction. Returns the number of the updated records.
+func (c *TiKVCollection) UpdateAll(filter Filter, update interface{}) (int64, error) {
+	payload, err := InterfaceToMap(update)
+	if err != nil {
+		return 0, err
+	}
+
+	var updated int64
+	err = c.inTxn(func(ctx context.Context, txn *transaction.KVTxn) error {
+		records, err := c.find(ctx, txn, filter)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			if err := c.update(txn, record, *payload); err != nil {
+				return err
+			}
+		}
+		updated = int64(len(records))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return updated, nil
+}
+
+// update sets the properties of the payload on the record, except the key, and writes it in the transaction.
+func (c *TiKVCollection) update(txn *transaction.KVTxn, record *tikvRecord, payload map[string]interface{}) error {
+	for k, v := range payload {
+		if k == c.keyProperty() {
+			// the key is immutable
+			continue
+		}
+		record.value[k] = v
+	}
+
+	value, err := c.codec.Marshal(record.value)
+	if err != nil {
+		return err
+	}
+	return txn.Set(record.key, value)
+}
+
+// DeleteOne deletes only one record for given filter
+func (c *TiKVCollection) DeleteOne(filter Filter) error {
+	return c.inTxn(func(ctx context.Context, txn *transaction.KVTxn) error {
+		records, err := c.find(ctx, txn, filter)
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			return ErrNotFound("record not found")
+		}
+		return txn.Delete(records[0].key)
+	})
+}
+
+// DeleteAll deletes all matched records for given filter
+func (c *TiKVCollection) DeleteAll(filter Filter) error {
+	return c.inTxn(func(ctx context.Context, txn *transaction.KVTxn) error {
+		records, err := c.find(ctx, txn, filter)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			if err := txn.Delete(record.key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// inTxn runs the function in a new transaction. The transaction is committed if the function succeeds,
+// otherwise it is rolled back.
+func (c *TiKVCollection) inTxn(fn func(ctx context.Context, txn *transaction.KVTxn) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), tikvRequestTimeout)
+	defer cancel()
+
+	txn, err := c.client.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(ctx, txn); err != nil {
+		txn.Rollback()
+		return err
+	}
+
+	return txn.Commit(ctx)
+}
+
+// keyProperty returns the name of the property used as record key - the hash key if set, otherwise "id".
+func (c *TiKVCollection) keyProperty() string {
+	if hashKey := c.repoDef.GetHashKey(); hashKey != "" {
+		return hashKey
+	}
+	return "id"
+}
+
+// key returns the TiKV key for the record with the given key value.
+func (c *TiKVCollection) key(value interface{}) []byte {
+	return []byte(c.prefix + url.PathEscape(fmt.Sprintf("%v", value)))
+}
+
+// find returns the records that match the filter.
+// If the filter has an exact match on the key property, only that key is fetched, otherwise
+// all records under the repository prefix are scanned and matched in memory.
+func (c *TiKVCollection) find(ctx context.Context, txn *transaction.KVTxn, filter Filter) ([]*tikvRecord, error) {
+	matcher, err := toRecordMatcher(filter)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+
+	records := []*tikvRecord{}
+	collect := func(key []byte, data []byte) error {
+		value, err := c.codec.Unmarshal(data)
+		if err != nil {
+			return ErrBackendError(err)
+		}
+		if matcher(value) {
+			records = append(records, &tikvRecord{
+				key:   append([]byte{}, key...),
+				value: value,
+			})
+		}
+		return nil
+	}
+
+	if keyValue, ok := filter[c.keyProperty()]; ok && !isFilterSpec(keyValue) {
+		key := c.key(keyValue)
+		data, err := txn.Get(ctx, key)
+		if tikverr.IsErrNotFound(err) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return records, collect(key, data)
+	}
+
+	// the prefix ends with "/", so all keys of the repository are less than the prefix with "/" replaced by "0".
+	upperBound := []byte(c.prefix[:len(c.prefix)-1] + "0")
+	iter, err := txn.Iter([]byte(c.prefix), upperBound)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	for iter.Valid() {
+		if err := collect(iter.Key(), iter.Value()); err != nil {
+			return nil, err
+		}
+		if err := iter.Next(); err != nil {
+			return nil, err
+		}
+	}
+
+	return records, nil
+}
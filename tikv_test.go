@@ -0,0 +1,84 @@
+package backends
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func TestTiKVKey(t *testing.T) {
+	coll := &TiKVCollection{
+		prefix:  "/testdb/configs/",
+		repoDef: RepositoryDefinitionMap{"name": "configs"},
+	}
+
+	if coll.keyProperty() != "id" {
+		t.Fatal("Expected id to be the default key property. Got: ", coll.keyProperty())
+	}
+	if key := string(coll.key("a/b")); key != "/testdb/configs/a%2Fb" {
+		t.Fatal("Expected the key to be escaped. Got: ", key)
+	}
+}
+
+func TestTiKVRepoBuilder(t *testing.T) {
+	backend := NewRepositoriesBackend(context.Background(), &config.DBInfo{DatabaseName: "testdb"}, TiKVRepoBuilder, nil)
+	if _, err := backend.DefineRepository("configs", RepositoryDefinitionMap{"name": "configs"}); err == nil {
+		t.Fatal("Expected error when tikv client is not configured")
+	}
+}
+
+func TestTiKVIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode.")
+	}
+
+	bm := NewBackendSupport(map[string]*config.DBInfo{
+		"tikv": &config.DBInfo{
+			DatabaseName: "testdb",
+			Host:         "localhost:2379",
+		},
+	})
+
+	backend, err := bm.GetBackend("tikv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := backend.DefineRepository("test_entries", RepositoryDefinitionMap{
+		"name": "test_entries",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.DeleteAll(nil)
+
+	for _, entry := range []TestEntry{
+		TestEntry{
+			Value: "aa",
+		},
+		TestEntry{
+			Value: "ab",
+		},
+		TestEntry{
+			Value: "ba",
+		},
+	} {
+		if _, err := repo.Save(&entry, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := repo.GetAll(NewFilter().MatchPattern("value", "a%"), &TestEntry{}, "value", "asc", 100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resArr, ok := results.(*[]*TestEntry)
+	if !ok {
+		t.Fatal("Expected a pointer to an array of entries. Got type: ", reflect.TypeOf(results))
+	}
+	if len(*resArr) != 2 {
+		t.Fatal("Expected 2 results, but got: ", len(*resArr))
+	}
+}
@@ -0,0 +1,83 @@
+package backends
+
+import (
+	"reflect"
+	"regexp"
+	"time"
+)
+
+// TimeLayout is the layout of the times stored as strings by the backends that compare the strings by their bytes
+// (DynamoDB): RFC 3339 in UTC, with all nine digits of the fractional seconds. The times in this layout sort the
+// same as strings and as times, and are still decoded into time.Time.
+const TimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+// rfc3339Pattern matches the strings in the RFC 3339 format, as time.Time is encoded to JSON.
+var rfc3339Pattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})$`)
+
+// formatTime formats the time in TimeLayout.
+func formatTime(t time.Time) string {
+	return t.UTC().Format(TimeLayout)
+}
+
+// parseTime parses the string in the RFC 3339 format.
+func parseTime(value string) (time.Time, bool) {
+	if !rfc3339Pattern.MatchString(value) {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// parseTimes parses both strings in the RFC 3339 format.
+func parseTimes(a, b string) (time.Time, time.Time, bool) {
+	at, ok := parseTime(a)
+	if !ok {
+		return time.Time{}, time.Time{}, false
+	}
+	bt, ok := parseTime(b)
+	if !ok {
+		return time.Time{}, time.Time{}, false
+	}
+	return at, bt, true
+}
+
+// equalValues compares the JSON decoded values. The RFC 3339 strings are equal if they are the same instant, in any
+// time zone and with any precision.
+func equalValues(a, b interface{}) bool {
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+	as, ok := a.(string)
+	if !ok {
+		return false
+	}
+	bs, ok := b.(string)
+	if !ok {
+		return false
+	}
+	at, bt, ok := parseTimes(as, bs)
+	return ok && at.Equal(bt)
+}
+
+// canonicalTimes rewrites the RFC 3339 strings of the JSON decoded value (see normalizeValue) in TimeLayout. The maps
+// and the lists are rewritten in place.
+func canonicalTimes(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		if t, ok := parseTime(v); ok {
+			return formatTime(t)
+		}
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = canonicalTimes(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = canonicalTimes(item)
+		}
+	}
+	return value
+}
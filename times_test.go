@@ -0,0 +1,41 @@
+package backends
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCanonicalTimes(t *testing.T) {
+	record := canonicalTimes(map[string]interface{}{
+		"createdAt": "2020-01-01T14:00:00.5+02:00",
+		"dates":     []interface{}{"2020-01-01T12:00:00Z"},
+		"name":      "2020-01-01",
+	}).(map[string]interface{})
+
+	if record["createdAt"] != "2020-01-01T12:00:00.500000000Z" {
+		t.Fatal("Expected the time in UTC with nanoseconds. Got: ", record["createdAt"])
+	}
+	if record["dates"].([]interface{})[0] != "2020-01-01T12:00:00.000000000Z" {
+		t.Fatal("Expected the time in the list to be rewritten. Got: ", record["dates"])
+	}
+	if record["name"] != "2020-01-01" {
+		t.Fatal("Expected a string that is not a time to be kept. Got: ", record["name"])
+	}
+
+	parsed, err := time.Parse(time.RFC3339Nano, record["createdAt"].(string))
+	if err != nil || !parsed.Equal(time.Date(2020, 1, 1, 12, 0, 0, 500000000, time.UTC)) {
+		t.Fatal("Expected the time to be decoded back. Got: ", parsed, err)
+	}
+}
+
+func TestEqualValues(t *testing.T) {
+	if !equalValues("2020-01-01T14:00:00+02:00", "2020-01-01T12:00:00.000Z") {
+		t.Fatal("Expected the same instant in different zones to be equal")
+	}
+	if equalValues("2020-01-01T14:00:00+02:00", "2020-01-01T14:00:00Z") {
+		t.Fatal("Expected different instants not to be equal")
+	}
+	if !equalValues(float64(1), float64(1)) || equalValues("a", "b") {
+		t.Fatal("Expected the other values to be compared exactly")
+	}
+}
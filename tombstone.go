@@ -0,0 +1,255 @@
+package backends
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+// tombstonePurgeInterval is the maximal interval between the automatic purges of the expired tombstones.
+const tombstonePurgeInterval = time.Hour
+
+// Tombstone records the deletion of a record, so the clients that sync the repository (and the replicas)
+// can delete it as well.
+type Tombstone struct {
+	// ID is the id of the tombstone.
+	ID string `json:"id"`
+	// Repository is the name of the repository.
+	Repository string `json:"repository"`
+	// RecordID is the id of the deleted record.
+	RecordID string `json:"recordId"`
+	// DeletedAt is the time of the deletion, in milliseconds since the epoch.
+	DeletedAt int64 `json:"deletedAt"`
+	// Actor is the user or service that deleted the record, if known.
+	Actor string `json:"actor,omitempty"`
+}
+
+// TombstoneStore saves the tombstones of the deleted records in a repository, and purges them once they expire.
+type TombstoneStore struct {
+	repo     Repository
+	ttl      time.Duration
+	pageSize int
+
+	mutex     sync.Mutex
+	lastPurge time.Time
+	purging   bool
+}
+
+// NewTombstoneStore creates a TombstoneStore that saves the tombstones in the repository. The repository should have
+// an index on "repository" and "deletedAt".
+// If ttl is greater than zero, the tombstones older than ttl are purged automatically in the background after a
+// deletion, at most once per ttl (or an hour, if shorter). The clients that did not sync for longer than ttl miss the
+// purged deletions, so they should sync again from scratch.
+func NewTombstoneStore(repo Repository, ttl time.Duration) *TombstoneStore {
+	return &TombstoneStore{
+		repo:      repo,
+		ttl:       ttl,
+		pageSize:  100,
+		lastPurge: time.Now(),
+	}
+}
+
+// Bury saves a tombstone for every deleted record of the repository.
+func (s *TombstoneStore) Bury(repository string, recordIDs []string, actor string) error {
+	deletedAt := syncNow()
+	for _, recordID := range recordIDs {
+		id, err := uuid.NewV4()
+		if err != nil {
+			return err
+		}
+		tombstone := &Tombstone{
+			ID:         id.String(),
+			Repository: repository,
+			RecordID:   recordID,
+			DeletedAt:  deletedAt,
+			Actor:      actor,
+		}
+		if _, err := s.repo.Save(tombstone, nil); err != nil {
+			return err
+		}
+	}
+
+	s.schedulePurge()
+	return nil
+}
+
+// Purge deletes the tombstones older than the TTL. Returns the number of deleted tombstones.
+// Does nothing if the store has no TTL.
+func (s *TombstoneStore) Purge() (int, error) {
+	if s.ttl <= 0 {
+		return 0, nil
+	}
+	before := syncNow() - int64(s.ttl/time.Millisecond)
+
+	expired := []string{}
+	for offset := 0; ; offset += s.pageSize {
+		results, err := s.repo.GetAll(nil, &map[string]interface{}{}, "deletedAt", "asc", s.pageSize, offset)
+		if err != nil {
+			return 0, err
+		}
+		page, err := syncRecords(results)
+		if err != nil {
+			return 0, err
+		}
+
+		done := len(page) < s.pageSize
+		for _, record := range page {
+			at, ok := syncTimestamp(record["deletedAt"])
+			if !ok {
+				continue
+			}
+			if at >= before {
+				done = true
+				break
+			}
+			expired = append(expired, fmt.Sprintf("%v", record["id"]))
+		}
+		if done {
+			break
+		}
+	}
+
+	purged := 0
+	for _, id := range expired {
+		if err := s.repo.DeleteOne(NewFilter().Match("id", id)); err != nil {
+			if IsErrNotFound(err) {
+				// purged concurrently
+				continue
+			}
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// schedulePurge starts a purge in the background, unless one is running or the last one was recent.
+func (s *TombstoneStore) schedulePurge() {
+	if s.ttl <= 0 {
+		return
+	}
+	interval := s.ttl
+	if interval > tombstonePurgeInterval {
+		interval = tombstonePurgeInterval
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.purging || time.Since(s.lastPurge) < interval {
+		return
+	}
+	s.purging = true
+
+	go func() {
+		if _, err := s.Purge(); err != nil {
+			log.Printf("failed to purge the expired tombstones: %v", err)
+		}
+		s.mutex.Lock()
+		s.purging = false
+		s.lastPurge = time.Now()
+		s.mutex.Unlock()
+	}()
+}
+
+// TombstoneBackend is a Backend whose repositories record a tombstone for every deleted record.
+type TombstoneBackend struct {
+	Backend
+	store *TombstoneStore
+	actor string
+}
+
+// NewTombstoneBackend wraps the backend so the deletions in its repositories are recorded in the tombstone store.
+// The actor is recorded as the deleter, unless another is given with DeleteOneAs or DeleteAllAs.
+func NewTombstoneBackend(backend Backend, store *TombstoneStore, actor string) Backend {
+	return &TombstoneBackend{
+		Backend: backend,
+		store:   store,
+		actor:   actor,
+	}
+}
+
+// DefineRepository defines the repository (collection/table) on the underlying backend.
+func (b *TombstoneBackend) DefineRepository(name string, def RepositoryDefinition) (Repository, error) {
+	repo, err := b.Backend.DefineRepository(name, def)
+	if err != nil {
+		return nil, err
+	}
+	return NewTombstoneRepository(repo, name, b.store, b.actor), nil
+}
+
+// GetRepository return the repository (collection/table) from the underlying backend.
+func (b *TombstoneBackend) GetRepository(name string) (Repository, error) {
+	repo, err := b.Backend.GetRepository(name)
+	if err != nil {
+		return nil, err
+	}
+	return NewTombstoneRepository(repo, name, b.store, b.actor), nil
+}
+
+// TombstoneRepository is a Repository that records a tombstone for every deleted record.
+type TombstoneRepository struct {
+	Repository
+	name  string
+	store *TombstoneStore
+	actor string
+}
+
+// NewTombstoneRepository wraps the repository so its deletions are recorded in the tombstone store.
+func NewTombstoneRepository(repo Repository, name string, store *TombstoneStore, actor string) *TombstoneRepository {
+	return &TombstoneRepository{
+		Repository: repo,
+		name:       name,
+		store:      store,
+		actor:      actor,
+	}
+}
+
+// DeleteOne deletes only one record for given filter and records its tombstone.
+func (r *TombstoneRepository) DeleteOne(filter Filter) error {
+	return r.DeleteOneAs(filter, r.actor)
+}
+
+// DeleteAll deletes all matched records for given filter and records their tombstones.
+func (r *TombstoneRepository) DeleteAll(filter Filter) error {
+	return r.DeleteAllAs(filter, r.actor)
+}
+
+// DeleteOneAs deletes only one record for given filter and records its tombstone, with the actor as the deleter.
+func (r *TombstoneRepository) DeleteOneAs(filter Filter, actor string) error {
+	record := map[string]interface{}{}
+	if _, err := r.Repository.GetOne(filter, &record); err != nil {
+		return err
+	}
+	if err := r.Repository.DeleteOne(filter); err != nil {
+		return err
+	}
+	return r.store.Bury(r.name, tombstoneRecordIDs([]map[string]interface{}{record}), actor)
+}
+
+// DeleteAllAs deletes all matched records for given filter and records their tombstones, with the actor as the deleter.
+func (r *TombstoneRepository) DeleteAllAs(filter Filter, actor string) error {
+	results, err := r.Repository.GetAll(filter, &map[string]interface{}{}, "", "", 0, 0)
+	if err != nil {
+		return err
+	}
+	records, err := syncRecords(results)
+	if err != nil {
+		return err
+	}
+	if err := r.Repository.DeleteAll(filter); err != nil {
+		return err
+	}
+	return r.store.Bury(r.name, tombstoneRecordIDs(records), actor)
+}
+
+// tombstoneRecordIDs returns the ids of the records.
+func tombstoneRecordIDs(records []map[string]interface{}) []string {
+	ids := []string{}
+	for _, record := range records {
+		ids = append(ids, fmt.Sprintf("%v", record["id"]))
+	}
+	return ids
+}
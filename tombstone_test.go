@@ -0,0 +1,103 @@
+package backends
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func newTombstoneTestBackend(t *testing.T, ttl time.Duration) (Backend, Repository) {
+	cache, err := CacheBackendBuilder(&config.DBInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tombstones, err := cache.DefineRepository("tombstones", RepositoryDefinitionMap{"name": "tombstones"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewTombstoneBackend(cache, NewTombstoneStore(tombstones, ttl), "service"), tombstones
+}
+
+func listTombstones(t *testing.T, tombstones Repository) []*Tombstone {
+	results, err := tombstones.GetAll(nil, &Tombstone{}, "recordId", "asc", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *results.(*[]*Tombstone)
+}
+
+func TestTombstoneRepository(t *testing.T) {
+	backend, tombstones := newTombstoneTestBackend(t, 0)
+	defer backend.Shutdown()
+
+	repo, err := backend.DefineRepository("notes", RepositoryDefinitionMap{"name": "notes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		if _, err := repo.Save(&map[string]interface{}{"id": id, "draft": id != "a"}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := repo.DeleteOne(NewFilter().Match("id", "a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.(*TombstoneRepository).DeleteAllAs(NewFilter().Match("draft", true), "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.DeleteOne(NewFilter().Match("id", "a")); err == nil || err.Error() != "not found" {
+		t.Fatal("Expected not found error, got", err)
+	}
+
+	list := listTombstones(t, tombstones)
+	if len(list) != 3 {
+		t.Fatal("Expected 3 tombstones, got", list)
+	}
+	for i, expected := range []Tombstone{
+		{Repository: "notes", RecordID: "a", Actor: "service"},
+		{Repository: "notes", RecordID: "b", Actor: "alice"},
+		{Repository: "notes", RecordID: "c", Actor: "alice"},
+	} {
+		tombstone := list[i]
+		if tombstone.ID == "" || tombstone.DeletedAt == 0 || tombstone.Repository != expected.Repository ||
+			tombstone.RecordID != expected.RecordID || tombstone.Actor != expected.Actor {
+			t.Fatal("Unexpected tombstone", tombstone)
+		}
+	}
+}
+
+func TestTombstoneStorePurge(t *testing.T) {
+	backend, tombstones := newTombstoneTestBackend(t, 50*time.Millisecond)
+	defer backend.Shutdown()
+	store := backend.(*TombstoneBackend).store
+
+	if err := store.Bury("notes", []string{"a", "b"}, ""); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if err := store.Bury("notes", []string{"c"}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// the purge started by the last deletion runs in the background
+	deadline := time.Now().Add(time.Second)
+	for len(listTombstones(t, tombstones)) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the expired tombstones to be purged, got", listTombstones(t, tombstones))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if list := listTombstones(t, tombstones); list[0].RecordID != "c" {
+		t.Fatal("Expected the tombstone of c to be kept, got", list[0])
+	}
+
+	purged, err := store.Purge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 0 {
+		t.Fatal("Expected nothing to purge, got", purged)
+	}
+}
@@ -0,0 +1,69 @@
+package backends
+
+import "context"
+
+// Transaction gives access to the repositories of a backend within a transaction.
+// All operations on the repositories obtained from the transaction are committed atomically
+// when the transaction function returns nil, and discarded when it returns an error.
+type Transaction interface {
+	GetRepository(name string) (Repository, error)
+}
+
+// ConditionChecker is implemented by the repositories of the transactions that can check a condition on a record
+// without writing it (DynamoDB). The transaction is committed only if the record still matches the filter when it is
+// committed, for example to place an order only while the account is active:
+//
+//	accounts, err := tx.GetRepository("accounts")
+//	if err != nil {
+//		return err
+//	}
+//	var checker backends.ConditionChecker
+//	if !backends.AsRepository(accounts, &checker) {
+//		return errors.New("condition checks are not supported")
+//	}
+//	if err := checker.Check(backends.NewFilter().Match("id", accountID).Match("status", "active")); err != nil {
+//		return err
+//	}
+type ConditionChecker interface {
+	Check(filter Filter) error
+}
+
+// TransactionalBackend is implemented by the backends that can run operations on multiple repositories atomically.
+// For example:
+//
+//	txBackend, ok := backend.(backends.TransactionalBackend)
+//	if !ok {
+//		return errors.New("transactions are not supported")
+//	}
+//	err := txBackend.Transact(ctx, func(tx backends.Transaction) error {
+//		orders, err := tx.GetRepository("orders")
+//		if err != nil {
+//			return err
+//		}
+//		stock, err := tx.GetRepository("stock")
+//		if err != nil {
+//			return err
+//		}
+//		if _, err = orders.Save(order, nil); err != nil {
+//			return err
+//		}
+//		_, err = stock.Save(&Stock{Available: available - 1}, backends.NewFilter().Match("id", itemID))
+//		return err
+//	})
+//
+// The backend may run the transaction function more than once (for example on conflicts),
+// so the function must not have side effects outside of the transaction.
+// The transaction is abandoned when the context is canceled or its deadline passes: the requests of the transaction
+// run with the context, no attempt is started after it is done, and its error is returned.
+// The repositories must be defined on the backend before they are used in a transaction. The repositories of the
+// transaction apply the definition of the repository like the repositories of the backend: the records are validated
+// against the data schema, the versions are checked and bumped (as conditions of the transaction), the enums are
+// encoded, the results default to the model and the soft-deleted records are not seen. Note that the writes of a
+// DynamoDB transaction are not visible to its reads, so Save of a versioned repository returns the record as it was
+// before the transaction.
+// The FoundationDB, DynamoDB and MongoDB backends implement TransactionalBackend.
+// Note that the backend wrappers (NewHookedBackend, NewLimitedBackend, NewShadowBackend) don't implement TransactionalBackend.
+type TransactionalBackend interface {
+	Backend
+	Transact(ctx context.Context, fn func(tx Transaction) error) error
+}
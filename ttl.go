@@ -0,0 +1,76 @@
+package backends
+
+import (
+	"fmt"
+	"time"
+)
+
+// The ways the reads handle the records whose TTL has passed, but which the database has not deleted yet. DynamoDB
+// deletes the expired items within a few days, MongoDB once a minute.
+const (
+	// TTLExpiredExclude skips the expired records (the default), or only the records expired for longer than the
+	// grace period.
+	TTLExpiredExclude = "exclude"
+	// TTLExpiredInclude reads the expired records until the database deletes them.
+	TTLExpiredInclude = "include"
+)
+
+// TTLExpiredDefinition is implemented by the repository definitions that choose how the reads handle the expired
+// records of a repository with TTL. RepositoryDefinitionMap implements it with the "ttlExpired" and the
+// "ttlGracePeriod" properties.
+type TTLExpiredDefinition interface {
+	GetTTLExpired() string
+	GetTTLGracePeriod() int
+}
+
+// GetTTLExpired returns how the reads handle the expired records: TTLExpiredExclude or TTLExpiredInclude. Empty
+// means TTLExpiredExclude.
+func (m RepositoryDefinitionMap) GetTTLExpired() string {
+	if expired, ok := m["ttlExpired"]; ok {
+		return expired.(string)
+	}
+
+	return ""
+}
+
+// GetTTLGracePeriod returns the time in seconds after their TTL for which the expired records are still read.
+func (m RepositoryDefinitionMap) GetTTLGracePeriod() int {
+	if gracePeriod, ok := m["ttlGracePeriod"]; ok {
+		return gracePeriod.(int)
+	}
+
+	return 0
+}
+
+// checkTTLExpired validates the handling of the expired records of the repository.
+func checkTTLExpired(repoDef RepositoryDefinition) error {
+	expiredDef, ok := repoDef.(TTLExpiredDefinition)
+	if !ok {
+		return nil
+	}
+	switch expiredDef.GetTTLExpired() {
+	case "", TTLExpiredExclude, TTLExpiredInclude:
+	default:
+		return ErrBackendError(fmt.Sprintf("unknown ttlExpired %q, must be %q or %q", expiredDef.GetTTLExpired(), TTLExpiredExclude, TTLExpiredInclude))
+	}
+	if expiredDef.GetTTLGracePeriod() < 0 {
+		return ErrBackendError("TTL grace period must not be negative")
+	}
+	return nil
+}
+
+// ttlGrace returns how long after their TTL the expired records are still read, and false if the reads do not
+// exclude the expired records (TTL is not enabled, or TTLExpiredInclude).
+func ttlGrace(repoDef RepositoryDefinition) (time.Duration, bool) {
+	if !repoDef.EnableTTL() {
+		return 0, false
+	}
+	expiredDef, ok := repoDef.(TTLExpiredDefinition)
+	if !ok {
+		return 0, true
+	}
+	if expiredDef.GetTTLExpired() == TTLExpiredInclude {
+		return 0, false
+	}
+	return time.Duration(expiredDef.GetTTLGracePeriod()) * time.Second, true
+}
@@ -0,0 +1,38 @@
+package backends
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTTLExpired(t *testing.T) {
+	definition := RepositoryDefinitionMap{"enableTtl": true, "ttl": 60, "ttlAttribute": "expiresAt"}
+	if expired := definition.GetTTLExpired(); expired != "" {
+		t.Fatal("Expected the default handling of the expired records. Got: ", expired)
+	}
+	if grace, ok := ttlGrace(definition); !ok || grace != 0 {
+		t.Fatal("Expected the expired records to be excluded by default. Got: ", grace, ok)
+	}
+
+	definition["ttlGracePeriod"] = 300
+	if grace, ok := ttlGrace(definition); !ok || grace != 5*time.Minute {
+		t.Fatal("Expected the records expired for more than 5 minutes to be excluded. Got: ", grace, ok)
+	}
+
+	definition["ttlExpired"] = TTLExpiredInclude
+	if _, ok := ttlGrace(definition); ok {
+		t.Fatal("Expected the expired records to be included")
+	}
+	if _, ok := ttlGrace(RepositoryDefinitionMap{"ttlExpired": TTLExpiredExclude}); ok {
+		t.Fatal("Expected nothing to be excluded without TTL")
+	}
+
+	if err := checkTTLExpired(definition); err != nil {
+		t.Fatal(err)
+	}
+	for _, invalid := range []RepositoryDefinitionMap{{"ttlExpired": "hide"}, {"ttlGracePeriod": -1}} {
+		if err := checkTTLExpired(invalid); err == nil {
+			t.Fatal("Expected an error for ", invalid)
+		}
+	}
+}
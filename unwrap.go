@@ -0,0 +1,43 @@
+package backends
+
+import "reflect"
+
+// RepositoryWrapper is implemented by the repositories that wrap the repository of a backend without changing what is
+// read or written, for example ModelRepository, which only defaults the type of the results. The capabilities of the
+// wrapped repository (RawQuerier, ChangeWatcher, PatchRepository etc.) keep their meaning through such wrappers, so
+// AsRepository and the transactions follow the Unwrap chain to find them.
+type RepositoryWrapper interface {
+	// Unwrap returns the wrapped repository.
+	Unwrap() Repository
+}
+
+// AsRepository finds the first repository in the Unwrap chain of repo (see RepositoryWrapper) that can be assigned to
+// the value target points to, and sets target to it, like errors.As. Use it instead of a type assertion to find a
+// capability of the repositories returned by the backends, which may be wrapped (for example when the repository is
+// defined with a model):
+//
+//	var rq backends.RawQuerier
+//	if backends.AsRepository(repo, &rq) {
+//		users, err := rq.RawQuery(bson.M{"age": bson.M{"$gte": 18}}, &User{})
+//	}
+//
+// Panics if target is not a non-nil pointer.
+func AsRepository(repo Repository, target interface{}) bool {
+	value := reflect.ValueOf(target)
+	if value.Kind() != reflect.Ptr || value.IsNil() {
+		panic("backends: target must be a non-nil pointer")
+	}
+	targetType := value.Type().Elem()
+	for repo != nil {
+		if reflect.TypeOf(repo).AssignableTo(targetType) {
+			value.Elem().Set(reflect.ValueOf(repo))
+			return true
+		}
+		wrapper, ok := repo.(RepositoryWrapper)
+		if !ok {
+			return false
+		}
+		repo = wrapper.Unwrap()
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package backends
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func TestAsRepository(t *testing.T) {
+	backend := NewRepositoriesBackend(context.Background(), &config.DBInfo{}, testRepoBuilder, nil)
+	repo, err := backend.DefineRepository("users", RepositoryDefinitionMap{"name": "users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped := NewModelRepository(NewModelRepository(repo, &modelUser{}), &modelUser{})
+
+	var found Repository
+	if !AsRepository(wrapped, &found) || found != wrapped {
+		t.Fatal("Expected the outermost repository. Got: ", found)
+	}
+	var model *ModelRepository
+	if !AsRepository(wrapped, &model) || model != wrapped {
+		t.Fatal("Expected the outermost model repository. Got: ", model)
+	}
+	var patchRepo PatchRepository
+	if _, isPatchRepo := repo.(PatchRepository); AsRepository(wrapped, &patchRepo) != isPatchRepo {
+		t.Fatal("Expected the capability of the innermost repository")
+	}
+	if AsRepository(nil, &found) {
+		t.Fatal("Expected no repository for nil")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Expected a panic for a target that is not a pointer")
+		}
+	}()
+	AsRepository(wrapped, "users")
+}
@@ -0,0 +1,57 @@
+package backends
+
+// UpsertRepository is implemented by the repositories that create or update a record with a single atomic write
+// (MongoDB, with an upsert).
+type UpsertRepository interface {
+	// UpsertOne updates the first record matched by the filter with the properties of the object, or creates the
+	// record if none matches. The insertOnly properties are set only when the record is created.
+	UpsertOne(object interface{}, filter Filter, insertOnly []string) (interface{}, error)
+}
+
+// saveOptions holds the options of SaveRecord.
+type saveOptions struct {
+	upsert     bool
+	insertOnly []string
+}
+
+// SaveOption configures SaveRecord.
+type SaveOption func(o *saveOptions)
+
+// Upsert makes SaveRecord create the record matched by the filter if it does not exist, instead of returning
+// ErrNotFound. The insertOnly properties (for example "createdAt") are set only when the record is created, and are
+// kept when it is updated. The id is never changed, so it is always insert-only.
+func Upsert(insertOnly ...string) SaveOption {
+	return func(o *saveOptions) {
+		o.upsert = true
+		o.insertOnly = append(o.insertOnly, insertOnly...)
+	}
+}
+
+// SaveRecord saves the object with Repository.Save. With the Upsert option, the record matched by the filter is
+// updated, or created if it does not exist, with a single atomic write, so the concurrent saves of the same record
+// don't both create it:
+//
+//	profile, err := backends.SaveRecord(profileRepo, &Profile{UserID: userID, Name: name, CreatedAt: now},
+//		backends.NewFilter().Match("userId", userID), backends.Upsert("createdAt"))
+//
+// The filter is required with Upsert, and its equality conditions are set on the created record. The repositories
+// that do not implement UpsertRepository (including the wrappers) return ErrNotSupported, because saving the record
+// with a separate check would not be atomic.
+func SaveRecord(repo Repository, object interface{}, filter Filter, opts ...SaveOption) (interface{}, error) {
+	options := &saveOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if !options.upsert {
+		return repo.Save(object, filter)
+	}
+	if len(filter) == 0 {
+		return nil, ErrInvalidInput("filter is required")
+	}
+	var upsertRepo UpsertRepository
+	if !AsRepository(repo, &upsertRepo) {
+		return nil, ErrNotSupported("repository can not upsert records")
+	}
+	return upsertRepo.UpsertOne(object, filter, options.insertOnly)
+}
@@ -0,0 +1,54 @@
+package backends
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+type upsertingRepository struct {
+	Repository
+	insertOnly []string
+}
+
+func (r *upsertingRepository) UpsertOne(object interface{}, filter Filter, insertOnly []string) (interface{}, error) {
+	r.insertOnly = insertOnly
+	return object, nil
+}
+
+func TestSaveRecord(t *testing.T) {
+	backend, err := CacheBackendBuilder(&config.DBInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Shutdown()
+
+	repo, err := backend.DefineRepository("profiles", RepositoryDefinitionMap{"name": "profiles"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := SaveRecord(repo, &map[string]interface{}{"id": "john", "name": "John"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.(map[string]interface{})["name"] != "John" {
+		t.Fatal("Expected the record to be saved without options. Got: ", saved)
+	}
+
+	john := NewFilter().Match("id", "john")
+	if _, err := SaveRecord(repo, &map[string]interface{}{"name": "Johnny"}, john, Upsert()); !IsErrorOfType(err, ErrNotSupported("")) {
+		t.Fatal("Expected ErrNotSupported from a repository that can't upsert. Got: ", err)
+	}
+
+	upserting := &upsertingRepository{Repository: repo}
+	if _, err := SaveRecord(upserting, &map[string]interface{}{"name": "Johnny"}, nil, Upsert()); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput without a filter. Got: ", err)
+	}
+	if _, err := SaveRecord(upserting, &map[string]interface{}{"name": "Johnny"}, john, Upsert("createdAt"), Upsert("createdBy")); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(upserting.insertOnly, []string{"createdAt", "createdBy"}) {
+		t.Fatal("Expected the insert-only properties of the options. Got: ", upserting.insertOnly)
+	}
+}
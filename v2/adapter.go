@@ -0,0 +1,188 @@
+package backends
+
+import (
+	"context"
+
+	v1 "github.com/JormungandrK/backends"
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+// FromV1 adapts the v1 repository to v2. The v1 repositories read, write and count; the v1 SyncRepository tracks its
+// changes, so it is a Watcher as well.
+func FromV1(repo v1.Repository) FullRepository {
+	// the v1 method set is the union of Reader, Writer and Counter
+	return repo
+}
+
+// BackendFromV1 adapts the v1 backend to v2. If the v1 backend runs transactions (v1 TransactionalBackend), the
+// adapted backend is Transactional.
+func BackendFromV1(backend v1.Backend) Backend {
+	adapted := &v1Backend{backend: backend}
+	if txBackend, ok := backend.(v1.TransactionalBackend); ok {
+		return &v1TransactionalBackend{v1Backend: adapted, txBackend: txBackend}
+	}
+	return adapted
+}
+
+// ToV1 adapts the v2 repository to the code that expects a v1 Repository. The writes of a repository that is not
+// a Writer fail with ErrNotSupported. If the repository is not a Counter, the records are counted by fetching them.
+func ToV1(repo Repository) v1.Repository {
+	if v1Repo, ok := repo.(v1.Repository); ok {
+		return v1Repo
+	}
+	return &v2Repository{Repository: repo}
+}
+
+// v1Backend is a v1 backend adapted to v2.
+type v1Backend struct {
+	backend v1.Backend
+}
+
+// DefineRepository defines the repository on the v1 backend.
+func (b *v1Backend) DefineRepository(name string, def RepositoryDefinition) (Repository, error) {
+	repo, err := b.backend.DefineRepository(name, def)
+	if err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// GetRepository returns the repository of the v1 backend.
+func (b *v1Backend) GetRepository(name string) (Repository, error) {
+	repo, err := b.backend.GetRepository(name)
+	if err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// GetConfig returns the configuration of the v1 backend.
+func (b *v1Backend) GetConfig() *config.DBInfo {
+	return b.backend.GetConfig()
+}
+
+// Shutdown shuts the v1 backend down.
+func (b *v1Backend) Shutdown() {
+	b.backend.Shutdown()
+}
+
+// v1TransactionalBackend is a v1 TransactionalBackend adapted to v2.
+type v1TransactionalBackend struct {
+	*v1Backend
+	txBackend v1.TransactionalBackend
+}
+
+// Transact runs fn in a transaction of the v1 backend.
+func (b *v1TransactionalBackend) Transact(ctx context.Context, fn func(tx Transaction) error) error {
+	return b.txBackend.Transact(ctx, func(tx v1.Transaction) error {
+		return fn(&v1Transaction{tx: tx})
+	})
+}
+
+// v1Transaction is a v1 Transaction adapted to v2.
+type v1Transaction struct {
+	tx v1.Transaction
+}
+
+// GetRepository returns the repository within the transaction.
+func (t *v1Transaction) GetRepository(name string) (Repository, error) {
+	repo, err := t.tx.GetRepository(name)
+	if err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// v2Repository is a v2 repository adapted to v1.
+type v2Repository struct {
+	Repository
+}
+
+// writer returns the repository as a Writer, or ErrNotSupported if it does not write.
+func (r *v2Repository) writer() (Writer, error) {
+	writer, ok := r.Repository.(Writer)
+	if !ok {
+		return nil, ErrNotSupported("repository is read-only")
+	}
+	return writer, nil
+}
+
+// Save saves the record, if the repository is a Writer.
+func (r *v2Repository) Save(object interface{}, filter Filter) (interface{}, error) {
+	writer, err := r.writer()
+	if err != nil {
+		return nil, err
+	}
+	return writer.Save(object, filter)
+}
+
+// SaveAll creates the records, if the repository is a Writer.
+func (r *v2Repository) SaveAll(objects interface{}) (interface{}, error) {
+	writer, err := r.writer()
+	if err != nil {
+		return nil, err
+	}
+	return writer.SaveAll(objects)
+}
+
+// UpdateAll updates the matched records, if the repository is a Writer.
+func (r *v2Repository) UpdateAll(filter Filter, update interface{}) (int64, error) {
+	writer, err := r.writer()
+	if err != nil {
+		return 0, err
+	}
+	return writer.UpdateAll(filter, update)
+}
+
+// DeleteOne deletes the matched record, if the repository is a Writer.
+func (r *v2Repository) DeleteOne(filter Filter) error {
+	writer, err := r.writer()
+	if err != nil {
+		return err
+	}
+	return writer.DeleteOne(filter)
+}
+
+// DeleteAll deletes the matched records, if the repository is a Writer.
+func (r *v2Repository) DeleteAll(filter Filter) error {
+	writer, err := r.writer()
+	if err != nil {
+		return err
+	}
+	return writer.DeleteAll(filter)
+}
+
+// Count counts the matched records. If the repository is not a Counter, the records are fetched and counted.
+func (r *v2Repository) Count(filter Filter) (int64, error) {
+	if counter, ok := r.Repository.(Counter); ok {
+		return counter.Count(filter)
+	}
+	results, err := r.Repository.GetAll(filter, &map[string]interface{}{}, "", "", 0, 0)
+	if err != nil {
+		return 0, err
+	}
+	count := int64(0)
+	err = v1.IterateOverSlice(results, func(i int, item interface{}) error {
+		count++
+		return nil
+	})
+	return count, err
+}
+
+// Exists reports whether a record matches the filter. If the repository is not a Counter, the first matched record
+// is fetched.
+func (r *v2Repository) Exists(filter Filter) (bool, error) {
+	if counter, ok := r.Repository.(Counter); ok {
+		return counter.Exists(filter)
+	}
+	results, err := r.Repository.GetAll(filter, &map[string]interface{}{}, "", "", 1, 0)
+	if err != nil {
+		return false, err
+	}
+	exists := false
+	err = v1.IterateOverSlice(results, func(i int, item interface{}) error {
+		exists = true
+		return nil
+	})
+	return exists, err
+}
@@ -0,0 +1,151 @@
+package backends
+
+import (
+	"context"
+	"testing"
+
+	v1 "github.com/JormungandrK/backends"
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+// archive is a read-only repository: it implements only Reader.
+type archive struct {
+	records []map[string]interface{}
+}
+
+func (a *archive) GetOne(filter Filter, result interface{}) (interface{}, error) {
+	return a.records[0], nil
+}
+
+func (a *archive) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	records := a.records
+	if limit > 0 && limit < len(records) {
+		records = records[:limit]
+	}
+	return records, nil
+}
+
+// txBackend is a v1 backend that runs the transactions without isolation.
+type txBackend struct {
+	v1.Backend
+	transactions int
+}
+
+func (b *txBackend) Transact(ctx context.Context, fn func(tx v1.Transaction) error) error {
+	b.transactions++
+	return fn(b.Backend)
+}
+
+func TestBackendFromV1(t *testing.T) {
+	cache, err := v1.CacheBackendBuilder(&config.DBInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := BackendFromV1(cache)
+	defer backend.Shutdown()
+
+	repo, err := backend.DefineRepository("users", RepositoryDefinitionMap{"name": "users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, ok := repo.(FullRepository)
+	if !ok {
+		t.Fatal("Expected the v1 repository to read, write and count")
+	}
+	if _, ok := repo.(Watcher); ok {
+		t.Fatal("Expected the v1 repository not to track its changes")
+	}
+	if _, ok := backend.(Transactional); ok {
+		t.Fatal("Expected the cache backend not to run transactions")
+	}
+
+	if _, err := users.Save(&map[string]interface{}{"id": "1", "name": "John"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := users.Count(nil); err != nil || count != 1 {
+		t.Fatal("Expected 1 record. Got: ", count, err)
+	}
+
+	if _, err := backend.GetRepository("missing"); err == nil {
+		t.Fatal("Expected an error for the undefined repository")
+	}
+
+	tx := &txBackend{Backend: cache}
+	transactional, ok := BackendFromV1(tx).(Transactional)
+	if !ok {
+		t.Fatal("Expected the transactional v1 backend to be Transactional")
+	}
+	err = transactional.Transact(context.Background(), func(tx Transaction) error {
+		repo, err := tx.GetRepository("users")
+		if err != nil {
+			return err
+		}
+		_, err = repo.(Writer).Save(&map[string]interface{}{"id": "2"}, nil)
+		return err
+	})
+	if err != nil || tx.transactions != 1 {
+		t.Fatal("Expected the transaction to run. Got: ", err)
+	}
+}
+
+func TestFromV1Watcher(t *testing.T) {
+	cache, err := v1.CacheBackendBuilder(&config.DBInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Shutdown()
+	tombstones, err := cache.DefineRepository("tombstones", RepositoryDefinitionMap{"name": "tombstones"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := v1.NewSyncBackend(cache, &v1.SyncOptions{Tombstones: tombstones}).DefineRepository("users", RepositoryDefinitionMap{"name": "users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := FromV1(repo)
+	if _, err := users.Save(&map[string]interface{}{"id": "1"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	watcher, ok := users.(Watcher)
+	if !ok {
+		t.Fatal("Expected the v1 sync repository to be a Watcher")
+	}
+	changes, err := watcher.ChangesSince("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes.Records) != 1 {
+		t.Fatal("Expected the saved record. Got: ", changes.Records)
+	}
+}
+
+func TestToV1(t *testing.T) {
+	repo := ToV1(&archive{records: []map[string]interface{}{{"id": "1"}, {"id": "2"}}})
+
+	if _, err := repo.Save(&map[string]interface{}{"id": "3"}, nil); err == nil || !v1.IsErrorOfType(err, ErrNotSupported("")) {
+		t.Fatal("Expected not supported error for the write. Got: ", err)
+	}
+	if err := repo.DeleteAll(nil); err == nil || !v1.IsErrorOfType(err, ErrNotSupported("")) {
+		t.Fatal("Expected not supported error for the delete. Got: ", err)
+	}
+	if count, err := repo.Count(nil); err != nil || count != 2 {
+		t.Fatal("Expected the records to be counted. Got: ", count, err)
+	}
+	if exists, err := repo.Exists(nil); err != nil || !exists {
+		t.Fatal("Expected a record to exist. Got: ", exists, err)
+	}
+
+	cache, err := v1.CacheBackendBuilder(&config.DBInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Shutdown()
+	users, err := cache.DefineRepository("users", RepositoryDefinitionMap{"name": "users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ToV1(FromV1(users)) != users {
+		t.Fatal("Expected the v1 repository to be returned as is")
+	}
+}
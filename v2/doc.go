@@ -0,0 +1,27 @@
+// Package backends (import path github.com/JormungandrK/backends/v2) is the version 2 API of the backends. The
+// monolithic v1 Repository interface is split into capability interfaces:
+//
+//	Reader         GetOne, GetAll
+//	Writer         Save, SaveAll, UpdateAll, DeleteOne, DeleteAll
+//	Counter        Count, Exists
+//	Watcher        ChangesSince
+//	Transactional  Transact (implemented by the backends)
+//
+// A repository implements only the capabilities its backend truly supports, so a read-only source (a replica, an
+// archive, a view) does not have to implement the writes with errors. The code that needs a capability takes it as
+// its parameter type, so passing a repository without it fails at compile time:
+//
+//	func Rename(users backends.ReadWriter, id string, name string) error
+//
+// and the code that works with any repository asserts the capability:
+//
+//	if watcher, ok := repo.(backends.Watcher); ok {
+//		changes, err := watcher.ChangesSince(token)
+//	}
+//
+// The v1 and v2 APIs are used side by side during the migration. The filters, the definitions, the errors and the
+// other types that did not change are aliases of the v1 types. FromV1 and BackendFromV1 adapt the v1 repositories and
+// backends to v2 (all v1 backends work with v2 this way), and ToV1 adapts a v2 repository to the code that still
+// expects a v1 Repository. The backends move to v2 one by one by implementing the v2 interfaces directly; v1 stays
+// unchanged until all of them have moved.
+package backends
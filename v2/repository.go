@@ -0,0 +1,93 @@
+package backends
+
+import (
+	"context"
+
+	v1 "github.com/JormungandrK/backends"
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+// Filter is the filter of the records (see the v1 Filter).
+type Filter = v1.Filter
+
+// RepositoryDefinition defines a repository (see the v1 RepositoryDefinition).
+type RepositoryDefinition = v1.RepositoryDefinition
+
+// RepositoryDefinitionMap is the configuration map of a repository (see the v1 RepositoryDefinitionMap).
+type RepositoryDefinitionMap = v1.RepositoryDefinitionMap
+
+// Changes are the changes of a repository since a sync token (see Watcher).
+type Changes = v1.Changes
+
+// NewFilter creates a new filter.
+var NewFilter = v1.NewFilter
+
+// ErrNotSupported is the error class for the operations that the repository or the backend does not support.
+var ErrNotSupported = v1.ErrNotSupported
+
+// Reader is implemented by the repositories that read records.
+// GetAll treats limit 0 as "no limit" and offset 0 as "no offset".
+type Reader interface {
+	GetOne(filter Filter, result interface{}) (interface{}, error)
+	GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error)
+}
+
+// Writer is implemented by the repositories that create, update and delete records.
+type Writer interface {
+	Save(object interface{}, filter Filter) (interface{}, error)
+	SaveAll(objects interface{}) (interface{}, error)
+	UpdateAll(filter Filter, update interface{}) (int64, error)
+	DeleteOne(filter Filter) error
+	DeleteAll(filter Filter) error
+}
+
+// Counter is implemented by the repositories that count the records without fetching them.
+type Counter interface {
+	Count(filter Filter) (int64, error)
+	Exists(filter Filter) (bool, error)
+}
+
+// Watcher is implemented by the repositories that track their changes, for the incremental sync of the clients.
+// An empty token returns all records.
+type Watcher interface {
+	ChangesSince(token string) (*Changes, error)
+}
+
+// Repository is the minimal repository: every repository reads records. The other capabilities are asserted.
+type Repository interface {
+	Reader
+}
+
+// ReadWriter is a repository that reads and writes records.
+type ReadWriter interface {
+	Reader
+	Writer
+}
+
+// FullRepository has all capabilities of the v1 Repository.
+type FullRepository interface {
+	Reader
+	Writer
+	Counter
+}
+
+// Backend defines the repositories of a database.
+type Backend interface {
+	DefineRepository(name string, def RepositoryDefinition) (Repository, error)
+	GetRepository(name string) (Repository, error)
+	GetConfig() *config.DBInfo
+	Shutdown()
+}
+
+// Transaction gives access to the repositories of a backend within a transaction (see Transactional).
+type Transaction interface {
+	GetRepository(name string) (Repository, error)
+}
+
+// Transactional is implemented by the backends that run operations on multiple repositories atomically. The
+// operations are committed when fn returns nil and discarded when it returns an error. The backend may run fn more
+// than once, so it must not have side effects outside of the transaction. The transaction is abandoned once the
+// context is done.
+type Transactional interface {
+	Transact(ctx context.Context, fn func(tx Transaction) error) error
+}
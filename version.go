@@ -0,0 +1,143 @@
+package backends
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// VersionField is the property that holds the version of the records of the versioned repositories.
+const VersionField = "version"
+
+// VersionedDefinition is implemented by the repository definitions that enable optimistic concurrency control.
+// RepositoryDefinitionMap implements it with the "versioned" property.
+type VersionedDefinition interface {
+	IsVersioned() bool
+}
+
+// IsVersioned returns true if the records of the repository are versioned (see VersionedRepository).
+func (m RepositoryDefinitionMap) IsVersioned() bool {
+	if versioned, ok := m["versioned"]; ok {
+		return versioned.(bool)
+	}
+
+	return false
+}
+
+// VersionedRepository is a Repository with optimistic concurrency control. Every record has a version, starting at 1.
+// An update must carry the version of the record it was read at, and is applied only if the record still has that
+// version, so concurrent updates can not overwrite each other:
+//
+//	articleRepo, err := backend.DefineRepository("articles", backends.RepositoryDefinitionMap{
+//		"name":      "articles",
+//		"versioned": true,
+//	})
+//
+//	article.Title = "New title" // article.Version is the version the article was read at
+//	_, err = articleRepo.Save(article, backends.NewFilter().Match("id", article.ID))
+//	if backends.IsErrConflict(err) {
+//		// the article was modified in the meantime - read it again and retry
+//	}
+//
+// The version is checked and bumped with a conditional UpdateAll, so the update is atomic on every backend. The
+// filter of an update should match a single record. UpdateAll and DeleteAll are not versioned.
+type VersionedRepository struct {
+	Repository
+}
+
+// NewVersionedRepository wraps the repository so the records are versioned.
+func NewVersionedRepository(repo Repository) Repository {
+	return &VersionedRepository{
+		Repository: repo,
+	}
+}
+
+// withVersioning wraps the repository with VersionedRepository if the definition enables versioning.
+func withVersioning(repo Repository, def RepositoryDefinition) Repository {
+	versionedDef, ok := def.(VersionedDefinition)
+	if !ok || !versionedDef.IsVersioned() {
+		return repo
+	}
+	return NewVersionedRepository(repo)
+}
+
+// wrapped returns the wrapped repository, so the transactions can wrap their repository the same way.
+func (r *VersionedRepository) wrapped() Repository {
+	return r.Repository
+}
+
+// Save creates the record with version 1 if the filter is nil. Otherwise the first record matched by the filter is
+// updated if it still has the version of the object, and its version is bumped. Returns ErrInvalidInput if the
+// object has no version, ErrNotFound if no record matches the filter and ErrConflict if the record has another
+// version.
+func (r *VersionedRepository) Save(object interface{}, filter Filter) (interface{}, error) {
+	payload, err := InterfaceToMap(object)
+	if err != nil {
+		return nil, err
+	}
+
+	if filter == nil {
+		(*payload)[VersionField] = 1
+		return r.Repository.Save(payload, nil)
+	}
+
+	version, ok := versionNumber((*payload)[VersionField])
+	if !ok {
+		return nil, ErrInvalidInput(fmt.Sprintf("%s is required to update a versioned record", VersionField))
+	}
+	(*payload)[VersionField] = version + 1
+
+	updated, err := r.Repository.UpdateAll(cloneFilter(filter).Match(VersionField, version), payload)
+	if err != nil {
+		return nil, err
+	}
+	if updated == 0 {
+		exists, err := r.Repository.Exists(cloneFilter(filter))
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, ErrNotFound("record not found")
+		}
+		return nil, ErrConflict(fmt.Sprintf("record was modified concurrently, expected %s %d", VersionField, version))
+	}
+
+	record := map[string]interface{}{}
+	if _, err := r.Repository.GetOne(cloneFilter(filter), &record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// SaveAll creates the records with version 1.
+func (r *VersionedRepository) SaveAll(objects interface{}) (interface{}, error) {
+	records, err := objectsToRecords(objects)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		record[VersionField] = 1
+	}
+	return r.Repository.SaveAll(records)
+}
+
+// versionNumber converts the version (a number, possibly decoded from JSON) to an integer.
+func versionNumber(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, false
+		}
+		return int64(v), true
+	case json.Number:
+		n, err := v.Int64()
+		return n, err == nil
+	}
+	return 0, false
+}
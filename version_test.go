@@ -0,0 +1,84 @@
+package backends
+
+import (
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+type testArticle struct {
+	ID      string `json:"id,omitempty"`
+	Title   string `json:"title,omitempty"`
+	Version int    `json:"version,omitempty"`
+}
+
+func TestVersionedRepository(t *testing.T) {
+	backend, err := CacheBackendBuilder(&config.DBInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Shutdown()
+
+	repo, err := backend.DefineRepository("articles", RepositoryDefinitionMap{
+		"name":      "articles",
+		"versioned": true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := repo.(*VersionedRepository); !ok {
+		t.Fatal("Expected a versioned repository")
+	}
+
+	if _, err := repo.Save(&testArticle{ID: "1", Title: "Draft", Version: 7}, nil); err != nil {
+		t.Fatal(err)
+	}
+	filter := NewFilter().Match("id", "1")
+	result, err := repo.GetOne(filter, &testArticle{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	article := result.(*testArticle)
+	if article.Version != 1 {
+		t.Fatal("Expected the created article to have version 1. Got: ", article.Version)
+	}
+
+	// two concurrent editors read the same version
+	first := *article
+	second := *article
+
+	first.Title = "First"
+	saved, err := repo.Save(&first, NewFilter().Match("id", "1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record := saved.(map[string]interface{}); record["title"] != "First" || record["version"] != float64(2) {
+		t.Fatal("Expected the article to be updated and the version bumped. Got: ", record)
+	}
+
+	second.Title = "Second"
+	if _, err := repo.Save(&second, NewFilter().Match("id", "1")); err == nil || !IsErrConflict(err) {
+		t.Fatal("Expected conflict error for the stale version. Got: ", err)
+	}
+	result, err = repo.GetOne(NewFilter().Match("id", "1"), &testArticle{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored := result.(*testArticle); stored.Title != "First" || stored.Version != 2 {
+		t.Fatal("Expected the first update to be kept. Got: ", stored)
+	}
+
+	if _, err := repo.Save(&map[string]interface{}{"title": "No version"}, NewFilter().Match("id", "1")); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input error for an update without a version. Got: ", err)
+	}
+	if _, err := repo.Save(&testArticle{Title: "Missing", Version: 1}, NewFilter().Match("id", "2")); err == nil || !IsErrNotFound(err) {
+		t.Fatal("Expected not found error. Got: ", err)
+	}
+
+	if _, err := repo.SaveAll([]*testArticle{{ID: "2", Title: "Two"}, {ID: "3", Title: "Three"}}); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := repo.Count(NewFilter().Match("version", 1)); err != nil || count != 2 {
+		t.Fatal("Expected the saved articles to have version 1. Got: ", count, err)
+	}
+}
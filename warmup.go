@@ -0,0 +1,226 @@
+package backends
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// WarmUpFunc is a startup step. It gets the backend manager the plan is run with.
+type WarmUpFunc func(manager BackendManager) error
+
+// warmUpStep is a step of the WarmUpPlan.
+type warmUpStep struct {
+	name      string
+	fn        WarmUpFunc
+	dependsOn []string
+	// repository is the definition of the repository defined by the step (nil for the other steps).
+	repository RepositoryDefinition
+}
+
+// WarmUpPlan describes the backends and the repositories that must be ready when the service starts,
+// together with the dependencies between them. The steps are named: a backend step is named by the backend
+// type ("mongodb"), a repository step by the backend type and the repository name ("mongodb/users").
+// A repository step always depends on its backend step.
+// For example, to have the schema registry ready before the data repositories:
+//
+//	plan := backends.NewWarmUpPlan().
+//		Repository("mongodb", "schemas", schemasDef).
+//		Repository("dynamodb", "users", usersDef, "mongodb/schemas").
+//		Step("migrations", runMigrations, "mongodb/schemas")
+//
+//	if err := backends.WarmUp(manager, plan); err != nil {
+//		log.Fatal(err)
+//	}
+type WarmUpPlan struct {
+	steps map[string]*warmUpStep
+}
+
+// NewWarmUpPlan creates new empty WarmUpPlan.
+func NewWarmUpPlan() *WarmUpPlan {
+	return &WarmUpPlan{
+		steps: map[string]*warmUpStep{},
+	}
+}
+
+// Step adds a custom step to the plan, that runs once all of the steps it depends on are done.
+func (p *WarmUpPlan) Step(name string, fn WarmUpFunc, dependsOn ...string) *WarmUpPlan {
+	p.steps[name] = &warmUpStep{
+		name:      name,
+		fn:        fn,
+		dependsOn: dependsOn,
+	}
+	return p
+}
+
+// Backend adds a step that builds the backend of the given type.
+func (p *WarmUpPlan) Backend(backendType string, dependsOn ...string) *WarmUpPlan {
+	return p.Step(backendType, func(manager BackendManager) error {
+		_, err := manager.GetBackend(backendType)
+		return err
+	}, dependsOn...)
+}
+
+// Repository adds a step that defines the repository on the backend of the given type.
+// The backend step is added to the plan, unless it is already there.
+func (p *WarmUpPlan) Repository(backendType string, name string, def RepositoryDefinition, dependsOn ...string) *WarmUpPlan {
+	if _, ok := p.steps[backendType]; !ok {
+		p.Backend(backendType)
+	}
+	p.Step(backendType+"/"+name, func(manager BackendManager) error {
+		backend, err := manager.GetBackend(backendType)
+		if err != nil {
+			return err
+		}
+		_, err = backend.DefineRepository(name, def)
+		return err
+	}, append([]string{backendType}, dependsOn...)...)
+	p.steps[backendType+"/"+name].repository = def
+	return p
+}
+
+// Declared returns the definition of the repository, if the plan defines it on the backend of the given type.
+func (p *WarmUpPlan) Declared(backendType string, name string) (RepositoryDefinition, bool) {
+	step, ok := p.steps[backendType+"/"+name]
+	if !ok || step.repository == nil {
+		return nil, false
+	}
+	return step.repository, true
+}
+
+// WarmUpError is returned by WarmUp when the plan is invalid or when some of the steps fail.
+type WarmUpError struct {
+	// Failed holds the errors of the failed steps, by step name.
+	Failed map[string]error
+	// Skipped holds the steps that were not run, with the name of the dependency that failed (or was skipped).
+	Skipped map[string]string
+}
+
+// Error returns the description of the failed and the skipped steps.
+func (e *WarmUpError) Error() string {
+	messages := []string{}
+	failed := []string{}
+	for name := range e.Failed {
+		failed = append(failed, name)
+	}
+	sort.Strings(failed)
+	for _, name := range failed {
+		messages = append(messages, fmt.Sprintf("%s failed: %s", name, e.Failed[name].Error()))
+	}
+	skipped := []string{}
+	for name := range e.Skipped {
+		skipped = append(skipped, name)
+	}
+	sort.Strings(skipped)
+	for _, name := range skipped {
+		messages = append(messages, fmt.Sprintf("%s skipped: depends on %s", name, e.Skipped[name]))
+	}
+	return "warm up failed: " + strings.Join(messages, "; ")
+}
+
+// WarmUp runs the steps of the plan in dependency order. A step runs only after all of its dependencies succeeded;
+// the steps that depend on a failed step are skipped, and the other steps still run, so all problems are reported at once.
+// The steps that don't depend on each other run in the order of their names.
+// Returns *WarmUpError if a step depends on an unknown step, if the dependencies have a cycle, or if any step fails.
+func WarmUp(manager BackendManager, plan *WarmUpPlan) error {
+	order, err := plan.order()
+	if err != nil {
+		return err
+	}
+
+	result := &WarmUpError{
+		Failed:  map[string]error{},
+		Skipped: map[string]string{},
+	}
+
+	for _, name := range order {
+		step := plan.steps[name]
+
+		blocked := ""
+		for _, dependency := range step.dependsOn {
+			if _, failed := result.Failed[dependency]; failed {
+				blocked = dependency
+				break
+			}
+			if _, skipped := result.Skipped[dependency]; skipped {
+				blocked = dependency
+				break
+			}
+		}
+		if blocked != "" {
+			result.Skipped[name] = blocked
+			continue
+		}
+
+		if err := step.fn(manager); err != nil {
+			result.Failed[name] = err
+		}
+	}
+
+	if len(result.Failed) > 0 {
+		return result
+	}
+	return nil
+}
+
+// order returns the step names sorted topologically. Returns *WarmUpError for unknown dependencies and cycles.
+func (p *WarmUpPlan) order() ([]string, error) {
+	names := []string{}
+	for name := range p.steps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	invalid := map[string]error{}
+	dependents := map[string][]string{}
+	pending := map[string]int{}
+
+	for _, name := range names {
+		step := p.steps[name]
+		pending[name] = 0
+		for _, dependency := range step.dependsOn {
+			if _, ok := p.steps[dependency]; !ok {
+				invalid[name] = fmt.Errorf("unknown dependency %s", dependency)
+				continue
+			}
+			dependents[dependency] = append(dependents[dependency], name)
+			pending[name]++
+		}
+	}
+	if len(invalid) > 0 {
+		return nil, &WarmUpError{Failed: invalid}
+	}
+
+	ready := []string{}
+	for _, name := range names {
+		if pending[name] == 0 {
+			ready = append(ready, name)
+		}
+	}
+
+	order := []string{}
+	for len(ready) > 0 {
+		name := ready[0]
+		ready = ready[1:]
+		order = append(order, name)
+
+		for _, dependent := range dependents[name] {
+			pending[dependent]--
+			if pending[dependent] == 0 {
+				ready = append(ready, dependent)
+				sort.Strings(ready)
+			}
+		}
+	}
+
+	if len(order) != len(p.steps) {
+		for name, count := range pending {
+			if count > 0 {
+				invalid[name] = fmt.Errorf("dependency cycle")
+			}
+		}
+		return nil, &WarmUpError{Failed: invalid}
+	}
+
+	return order, nil
+}
@@ -0,0 +1,130 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func newWarmUpManager(calls *[]string) BackendManager {
+	manager := NewBackendManager(map[string]*config.DBInfo{
+		"primary":   &config.DBInfo{},
+		"secondary": &config.DBInfo{},
+	})
+	for _, backendType := range []string{"primary", "secondary"} {
+		backendType := backendType
+		manager.SupportBackend(backendType, func(conf *config.DBInfo, manager BackendManager) (Backend, error) {
+			*calls = append(*calls, backendType)
+			return NewRepositoriesBackend(context.Background(), conf, testRepoBuilder, nil), nil
+		}, map[string]interface{}{})
+	}
+	return manager
+}
+
+func TestWarmUpOrder(t *testing.T) {
+	calls := []string{}
+	manager := newWarmUpManager(&calls)
+
+	record := func(name string) WarmUpFunc {
+		return func(manager BackendManager) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+
+	plan := NewWarmUpPlan().
+		Repository("primary", "users", RepositoryDefinitionMap{"name": "users"}, "schemas").
+		Step("schemas", record("schemas"), "secondary/registry").
+		Repository("secondary", "registry", RepositoryDefinitionMap{"name": "registry"}).
+		Step("after-users", record("after-users"), "primary/users")
+
+	if err := WarmUp(manager, plan); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"primary", "secondary", "schemas", "after-users"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("Expected calls %v, got %v", expected, calls)
+	}
+
+	backend, _ := manager.GetBackend("primary")
+	if _, err := backend.GetRepository("users"); err != nil {
+		t.Fatal("Expected the users repository to be defined:", err)
+	}
+}
+
+func TestWarmUpFailedStep(t *testing.T) {
+	calls := []string{}
+	manager := newWarmUpManager(&calls)
+
+	plan := NewWarmUpPlan().
+		Step("schemas", func(manager BackendManager) error {
+			return fmt.Errorf("registry unavailable")
+		}).
+		Repository("primary", "users", RepositoryDefinitionMap{"name": "users"}, "schemas").
+		Step("cache", func(manager BackendManager) error {
+			return nil
+		}, "primary/users").
+		Backend("secondary")
+
+	err := WarmUp(manager, plan)
+	warmUpErr, ok := err.(*WarmUpError)
+	if !ok {
+		t.Fatalf("Expected *WarmUpError, got %v", err)
+	}
+	if len(warmUpErr.Failed) != 1 || warmUpErr.Failed["schemas"] == nil {
+		t.Fatalf("Expected only schemas to fail, got %v", warmUpErr.Failed)
+	}
+	expectedSkipped := map[string]string{
+		"primary/users": "schemas",
+		"cache":         "primary/users",
+	}
+	if !reflect.DeepEqual(warmUpErr.Skipped, expectedSkipped) {
+		t.Fatalf("Expected skipped %v, got %v", expectedSkipped, warmUpErr.Skipped)
+	}
+
+	// the independent steps still run
+	expectedCalls := []string{"primary", "secondary"}
+	if !reflect.DeepEqual(calls, expectedCalls) {
+		t.Fatalf("Expected calls %v, got %v", expectedCalls, calls)
+	}
+
+	expectedMessage := "warm up failed: schemas failed: registry unavailable; cache skipped: depends on primary/users; primary/users skipped: depends on schemas"
+	if err.Error() != expectedMessage {
+		t.Fatalf("Expected message %q, got %q", expectedMessage, err.Error())
+	}
+}
+
+func TestWarmUpInvalidPlan(t *testing.T) {
+	noop := func(manager BackendManager) error {
+		return nil
+	}
+
+	err := WarmUp(NewBackendManager(nil), NewWarmUpPlan().Step("a", noop, "missing"))
+	if warmUpErr, ok := err.(*WarmUpError); !ok || warmUpErr.Failed["a"] == nil {
+		t.Fatalf("Expected unknown dependency error for a, got %v", err)
+	}
+
+	ran := false
+	plan := NewWarmUpPlan().
+		Step("a", noop, "b").
+		Step("b", noop, "a").
+		Step("c", func(manager BackendManager) error {
+			ran = true
+			return nil
+		})
+	err = WarmUp(NewBackendManager(nil), plan)
+	warmUpErr, ok := err.(*WarmUpError)
+	if !ok {
+		t.Fatalf("Expected *WarmUpError, got %v", err)
+	}
+	if len(warmUpErr.Failed) != 2 || warmUpErr.Failed["a"] == nil || warmUpErr.Failed["b"] == nil {
+		t.Fatalf("Expected a cycle between a and b, got %v", warmUpErr.Failed)
+	}
+	if ran {
+		t.Fatal("Expected no step to run when the plan has a cycle")
+	}
+}
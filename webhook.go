@@ -0,0 +1,370 @@
+package backends
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+// Webhook event types.
+const (
+	WebhookEventCreate = "create"
+	WebhookEventUpdate = "update"
+	WebhookEventDelete = "delete"
+)
+
+// WebhookSignatureHeader is the HTTP header with the HMAC-SHA256 signature of the request body, as
+// "sha256=<hex digest>". The digest is computed with the secret of the webhook.
+const WebhookSignatureHeader = "X-Webhook-Signature"
+
+// WebhookEventHeader is the HTTP header with the event type.
+const WebhookEventHeader = "X-Webhook-Event"
+
+// WebhookEvent is a change of a repository, as delivered to the webhooks (as the JSON body of a POST request).
+type WebhookEvent struct {
+	// ID is the unique id of the event. It is the same for all deliveries (and retries) of the event, so the
+	// receivers can detect duplicates.
+	ID string `json:"id"`
+	// Type is the event type (WebhookEventCreate, WebhookEventUpdate or WebhookEventDelete).
+	Type string `json:"type"`
+	// Repository is the name of the repository.
+	Repository string `json:"repository"`
+	// Operation is the repository operation that caused the event (OperationSave, OperationDeleteAll etc).
+	Operation string `json:"operation"`
+	// Filter is the filter of the update or delete.
+	Filter Filter `json:"filter,omitempty"`
+	// Record is the created or updated record. For UpdateAll, it is the update that was applied to all records
+	// that match the filter.
+	Record map[string]interface{} `json:"record,omitempty"`
+	// Time is the time of the change.
+	Time time.Time `json:"time"`
+}
+
+// Webhook is an HTTP endpoint subscribed to the events of a repository.
+type Webhook struct {
+	// URL is the endpoint the events are posted to.
+	URL string
+	// Secret is the key used to sign the request body (see WebhookSignatureHeader). If empty, the requests are
+	// not signed.
+	Secret string
+	// Events are the event types delivered to the webhook. If empty, all events are delivered.
+	Events []string
+	// Headers are additional HTTP headers sent with every request (for example an authorization header).
+	Headers map[string]string
+}
+
+// accepts returns true if the webhook is subscribed to the event type.
+func (w *Webhook) accepts(eventType string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookFailure is an event that could not be delivered to a webhook, as saved in the dead-letter repository.
+type WebhookFailure struct {
+	// URL is the URL of the webhook.
+	URL string `json:"url"`
+	// Event is the event that was not delivered.
+	Event *WebhookEvent `json:"event"`
+	// Attempts is the number of delivery attempts.
+	Attempts int `json:"attempts"`
+	// Error is the error of the last attempt.
+	Error string `json:"error"`
+	// FailedAt is the time of the failure.
+	FailedAt time.Time `json:"failedAt"`
+}
+
+// WebhookOptions configures the webhook dispatcher.
+type WebhookOptions struct {
+	// Client is the HTTP client used to deliver the events. Default is a client with a 10 second timeout.
+	Client *http.Client
+	// MaxRetries is the number of times a failed delivery is retried. Default is 3.
+	MaxRetries int
+	// RetryBackoff is the wait before the first retry. It is doubled for every next retry. Default is 1 second.
+	RetryBackoff time.Duration
+	// DeadLetter is the repository where the events that could not be delivered are saved. If nil, they are dropped.
+	// It should not be a repository with webhooks.
+	DeadLetter Repository
+	// Workers is the number of goroutines that deliver the events. Default is 1, which keeps the events in order.
+	Workers int
+	// QueueSize is the maximal number of deliveries waiting to be sent. When the queue is full, the events are
+	// not delivered and are saved in the dead-letter repository instead. Default is 1000.
+	QueueSize int
+}
+
+// webhookDelivery is an event waiting to be delivered to a webhook.
+type webhookDelivery struct {
+	webhook *Webhook
+	event   *WebhookEvent
+}
+
+// WebhookDispatcher delivers the create, update and delete events of the repositories to the registered webhooks.
+type WebhookDispatcher struct {
+	options  *WebhookOptions
+	webhooks map[string][]*Webhook
+	queue    chan *webhookDelivery
+	workers  *sync.WaitGroup
+	mutex    *sync.RWMutex
+	closed   bool
+}
+
+// NewWebhookDispatcher creates a dispatcher that delivers the events asynchronously. The events of the
+// repositories are captured with a hook:
+//
+//	dispatcher := backends.NewWebhookDispatcher(&backends.WebhookOptions{DeadLetter: deadLetterRepo})
+//	dispatcher.Register("orders", &backends.Webhook{
+//		URL:    "https://billing.example.com/hooks/orders",
+//		Secret: billingSecret,
+//		Events: []string{backends.WebhookEventCreate},
+//	})
+//	backend = backends.NewHookedBackend(backend, &backends.Hooks{
+//		After: []backends.AfterHook{dispatcher.Hook()},
+//	})
+//
+// The delivery is at-least-once: a request that fails (a network error, or a 429 or 5xx response) is retried with
+// an exponential backoff, and the events that cannot be delivered are saved in the dead-letter repository, so they
+// can be replayed later. Shutdown waits for the queued events to be delivered.
+func NewWebhookDispatcher(options *WebhookOptions) *WebhookDispatcher {
+	if options == nil {
+		options = &WebhookOptions{}
+	}
+	if options.Client == nil {
+		options.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if options.MaxRetries < 0 {
+		options.MaxRetries = 0
+	} else if options.MaxRetries == 0 {
+		options.MaxRetries = 3
+	}
+	if options.RetryBackoff <= 0 {
+		options.RetryBackoff = time.Second
+	}
+	if options.Workers < 1 {
+		options.Workers = 1
+	}
+	if options.QueueSize < 1 {
+		options.QueueSize = 1000
+	}
+
+	d := &WebhookDispatcher{
+		options:  options,
+		webhooks: map[string][]*Webhook{},
+		queue:    make(chan *webhookDelivery, options.QueueSize),
+		workers:  &sync.WaitGroup{},
+		mutex:    &sync.RWMutex{},
+	}
+
+	for i := 0; i < options.Workers; i++ {
+		d.workers.Add(1)
+		go d.work()
+	}
+
+	return d
+}
+
+// Register subscribes the webhook to the events of the repository.
+func (d *WebhookDispatcher) Register(repository string, webhook *Webhook) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.webhooks[repository] = append(d.webhooks[repository], webhook)
+}
+
+// Hook returns the hook that captures the events of the successful writes (Save, SaveAll, UpdateAll, DeleteOne and
+// DeleteAll) and dispatches them to the webhooks of the repository.
+func (d *WebhookDispatcher) Hook() AfterHook {
+	return func(op *Operation, result interface{}, err error) {
+		if err != nil {
+			return
+		}
+		for _, event := range webhookEvents(op, result) {
+			d.Dispatch(event)
+		}
+	}
+}
+
+// webhookEvents returns the events of the repository operation.
+func webhookEvents(op *Operation, result interface{}) []*WebhookEvent {
+	event := func(eventType string, filter Filter, record interface{}) *WebhookEvent {
+		e := &WebhookEvent{
+			Type:       eventType,
+			Repository: op.Repository,
+			Operation:  op.Name,
+			Filter:     cloneFilter(filter),
+		}
+		if record != nil {
+			if normalized, err := normalizeValue(record); err == nil {
+				e.Record, _ = normalized.(map[string]interface{})
+			}
+		}
+		return e
+	}
+
+	switch op.Name {
+	case OperationSave:
+		if op.Filter == nil {
+			return []*WebhookEvent{event(WebhookEventCreate, nil, result)}
+		}
+		return []*WebhookEvent{event(WebhookEventUpdate, op.Filter, result)}
+	case OperationSaveAll:
+		created, _ := result.([]interface{})
+		events := make([]*WebhookEvent, 0, len(created))
+		for _, record := range created {
+			events = append(events, event(WebhookEventCreate, nil, record))
+		}
+		return events
+	case OperationUpdateAll:
+		if updated, _ := result.(int64); updated == 0 {
+			return nil
+		}
+		return []*WebhookEvent{event(WebhookEventUpdate, op.Filter, op.Object)}
+	case OperationDeleteOne, OperationDeleteAll:
+		return []*WebhookEvent{event(WebhookEventDelete, op.Filter, nil)}
+	}
+	return nil
+}
+
+// Dispatch queues the event to be delivered to the webhooks of its repository that are subscribed to the event
+// type. The event ID and time are set if empty. If the queue is full or the dispatcher is shut down, the event
+// goes to the dead-letter repository.
+func (d *WebhookDispatcher) Dispatch(event *WebhookEvent) {
+	if event.ID == "" {
+		id, err := uuid.NewV4()
+		if err == nil {
+			event.ID = id.String()
+		}
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	for _, webhook := range d.webhooks[event.Repository] {
+		if !webhook.accepts(event.Type) {
+			continue
+		}
+		if d.closed {
+			d.deadLetter(webhook, event, 0, "dispatcher is shut down")
+			continue
+		}
+		select {
+		case d.queue <- &webhookDelivery{webhook: webhook, event: event}:
+		default:
+			d.deadLetter(webhook, event, 0, "webhook queue is full")
+		}
+	}
+}
+
+// Shutdown waits for the queued events to be delivered (or retried until they fail) and stops the workers.
+func (d *WebhookDispatcher) Shutdown() {
+	d.mutex.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.queue)
+	}
+	d.mutex.Unlock()
+
+	d.workers.Wait()
+}
+
+func (d *WebhookDispatcher) work() {
+	defer d.workers.Done()
+	for delivery := range d.queue {
+		d.deliver(delivery)
+	}
+}
+
+// deliver posts the event to the webhook, retrying the failed requests.
+func (d *WebhookDispatcher) deliver(delivery *webhookDelivery) {
+	body, err := json.Marshal(delivery.event)
+	if err != nil {
+		d.deadLetter(delivery.webhook, delivery.event, 0, err.Error())
+		return
+	}
+
+	backoff := d.options.RetryBackoff
+	attempts := 0
+	for {
+		attempts++
+		retry, err := d.post(delivery.webhook, delivery.event, body)
+		if err == nil {
+			return
+		}
+		if !retry || attempts > d.options.MaxRetries {
+			d.deadLetter(delivery.webhook, delivery.event, attempts, err.Error())
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post sends a single request to the webhook. Returns whether the request can be retried if it failed.
+func (d *WebhookDispatcher) post(webhook *Webhook, event *WebhookEvent, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, event.Type)
+	for name, value := range webhook.Headers {
+		req.Header.Set(name, value)
+	}
+	if webhook.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(webhook.Secret, body))
+	}
+
+	resp, err := d.options.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	// drain the body, so the connection can be reused
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("webhook responded with %s", resp.Status)
+}
+
+func (d *WebhookDispatcher) deadLetter(webhook *Webhook, event *WebhookEvent, attempts int, reason string) {
+	if d.options.DeadLetter == nil {
+		return
+	}
+	// best-effort - there is nowhere to report the failure to save the failure
+	d.options.DeadLetter.Save(&WebhookFailure{
+		URL:      webhook.URL,
+		Event:    event,
+		Attempts: attempts,
+		Error:    reason,
+		FailedAt: time.Now(),
+	}, nil)
+}
+
+// SignWebhookPayload returns the signature of the request body, as sent in WebhookSignatureHeader.
+// The receivers verify the requests by comparing the header with the signature of the body they received
+// (with hmac.Equal).
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,137 @@
+package backends
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func TestWebhookDispatcher(t *testing.T) {
+	mutex := &sync.Mutex{}
+	events := []*WebhookEvent{}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mutex.Lock()
+		defer mutex.Unlock()
+		requests++
+		if requests == 1 {
+			// the first delivery is retried
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get(WebhookSignatureHeader) != SignWebhookPayload("secret", body) {
+			t.Error("Invalid signature: ", r.Header.Get(WebhookSignatureHeader))
+		}
+		event := &WebhookEvent{}
+		if err := json.Unmarshal(body, event); err != nil {
+			t.Error(err)
+		}
+		if r.Header.Get(WebhookEventHeader) != event.Type {
+			t.Error("Expected the event type header. Got: ", r.Header.Get(WebhookEventHeader))
+		}
+		events = append(events, event)
+	}))
+	defer server.Close()
+
+	deadLetter := newTestRepository()
+	dispatcher := NewWebhookDispatcher(&WebhookOptions{DeadLetter: deadLetter, RetryBackoff: time.Millisecond})
+	dispatcher.Register("users", &Webhook{URL: server.URL, Secret: "secret", Events: []string{WebhookEventCreate, WebhookEventDelete}})
+
+	backend := NewHookedBackend(NewRepositoriesBackend(context.Background(), &config.DBInfo{}, testRepoBuilder, nil), &Hooks{
+		After: []AfterHook{dispatcher.Hook()},
+	})
+	users, err := backend.DefineRepository("users", RepositoryDefinitionMap{"name": "users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	orders, err := backend.DefineRepository("orders", RepositoryDefinitionMap{"name": "orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := users.Save(&map[string]interface{}{"id": "1", "name": "John"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := users.GetOne(NewFilter().Match("id", "1"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := users.UpdateAll(NewFilter().Match("id", "1"), &map[string]interface{}{"active": true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.DeleteOne(NewFilter().Match("id", "1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := orders.Save(&map[string]interface{}{"id": "1"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	dispatcher.Shutdown()
+
+	if len(events) != 2 {
+		t.Fatal("Expected the create and delete events. Got: ", events)
+	}
+	if events[0].Type != WebhookEventCreate || events[0].Repository != "users" || events[0].Record["name"] != "John" || events[0].ID == "" {
+		t.Fatal("Invalid create event: ", events[0])
+	}
+	if events[1].Type != WebhookEventDelete || events[1].Filter["id"] != "1" {
+		t.Fatal("Invalid delete event: ", events[1])
+	}
+	if requests != 3 {
+		t.Fatal("Expected the failed delivery to be retried. Got requests: ", requests)
+	}
+	if len(deadLetter.records) != 0 {
+		t.Fatal("Expected no dead letters. Got: ", deadLetter.records)
+	}
+}
+
+func TestWebhookDispatcherDeadLetter(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	deadLetter := newTestRepository()
+	dispatcher := NewWebhookDispatcher(&WebhookOptions{DeadLetter: deadLetter, MaxRetries: 2, RetryBackoff: time.Millisecond})
+	dispatcher.Register("users", &Webhook{URL: server.URL, Headers: map[string]string{"Authorization": "Bearer token"}})
+	dispatcher.Register("users", &Webhook{URL: server.URL + "/unauthorized"})
+
+	dispatcher.Dispatch(&WebhookEvent{Type: WebhookEventUpdate, Repository: "users", Record: map[string]interface{}{"id": "1"}})
+	dispatcher.Shutdown()
+
+	// 3 attempts for the server error, 1 for the unauthorized request (not retried)
+	if requests != 4 {
+		t.Fatal("Expected 4 requests. Got: ", requests)
+	}
+	if len(deadLetter.records) != 2 {
+		t.Fatal("Expected 2 dead letters. Got: ", deadLetter.records)
+	}
+	failure := deadLetter.records[0]
+	if failure["url"] != server.URL || failure["attempts"] != float64(3) || failure["error"] != "webhook responded with 500 Internal Server Error" {
+		t.Fatal("Invalid dead letter: ", failure)
+	}
+	if event, ok := failure["event"].(map[string]interface{}); !ok || event["type"] != WebhookEventUpdate || event["id"] == "" {
+		t.Fatal("Expected the event in the dead letter. Got: ", failure["event"])
+	}
+	if deadLetter.records[1]["attempts"] != float64(1) {
+		t.Fatal("Expected the unauthorized request not to be retried. Got: ", deadLetter.records[1])
+	}
+
+	dispatcher.Dispatch(&WebhookEvent{Type: WebhookEventDelete, Repository: "users"})
+	if len(deadLetter.records) != 4 {
+		t.Fatal("Expected the events dispatched after shutdown to be dead-lettered. Got: ", deadLetter.records)
+	}
+}